@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/imcanugur/go-adb-monitor/internal/config"
+	"github.com/imcanugur/go-adb-monitor/internal/notify"
+)
+
+// runAlertRules implements `adb-monitor alert-rules`: it prints Prometheus
+// alerting rules equivalent to the webhook triggers the server would fire
+// with the same flags (or ADB_MONITOR_* environment), so rules exported to
+// Prometheus stay in sync with in-process alerting.
+func runAlertRules(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("alert-rules", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		threshold = fs.Int("error-spike-threshold", notify.DefaultErrorSpikeThreshold, "Capture errors per 30s that fire capture_error_spike")
+		triggers  = fs.String("webhook-triggers", "", "Comma-separated triggers to export (default: all)")
+		group     = fs.String("group", "adb-monitor", "Prometheus rule group name")
+		output    = fs.String("o", "", "Write the rule file here instead of stdout")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s alert-rules [flags]\n\nPrints Prometheus alerting rules over /api/metrics that mirror the webhook triggers.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := config.ApplyEnv(fs, os.LookupEnv); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	cfg := notify.RuleConfig{Group: *group, ErrorSpikeThreshold: *threshold, Triggers: parseTriggers(*triggers)}
+
+	w := stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := notify.WritePrometheusRules(w, cfg); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// parseTriggers splits a -webhook-triggers value.
+func parseTriggers(s string) []notify.Trigger {
+	var triggers []notify.Trigger
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			triggers = append(triggers, notify.Trigger(t))
+		}
+	}
+	return triggers
+}
@@ -5,16 +5,19 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
 	"github.com/imcanugur/go-adb-monitor/internal/event"
 	"github.com/imcanugur/go-adb-monitor/internal/logging"
 	"github.com/imcanugur/go-adb-monitor/internal/monitor"
 	"github.com/imcanugur/go-adb-monitor/internal/tracker"
+	"github.com/imcanugur/go-adb-monitor/internal/tui"
 )
 
 func main() {
@@ -31,15 +34,42 @@ func run() error {
 		logLevel     = flag.String("log-level", "info", "Log level: debug, info, warn, error")
 		logFormat    = flag.String("log-format", "text", "Log format: text, json")
 		propInterval = flag.Duration("prop-interval", monitor.DefaultPropInterval, "Device property collection interval")
+		propsFile    = flag.String("props-file", "", "JSON file of the system properties, dumpsys sections and shell probes to collect (default: a built-in set)")
+		propsChanged = flag.Bool("props-changes-only", false, "Publish full device properties only when one changed; changes are always published")
 		jsonOutput   = flag.Bool("json-events", false, "Print events as JSON to stdout")
+		tuiMode      = flag.Bool("tui", false, "Show a live terminal dashboard of devices, captures and traffic")
+		captureMode  = flag.String("capture", "auto", "Capture mode for the dashboard: auto, tcpdump, ss, procnet, vpn, emulator, off")
+		logFile      = flag.String("log-file", "", "Write logs to this file (with -tui, logs are discarded unless set)")
 	)
 	flag.Parse()
 
+	var mode capture.Mode
+	if *tuiMode && *captureMode != "off" {
+		var err error
+		if mode, err = capture.ParseMode(*captureMode); err != nil {
+			return err
+		}
+	}
+
 	// --- Logger ---
+	var logOut io.Writer
+	switch {
+	case *logFile != "":
+		f, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("open log file: %w", err)
+		}
+		defer f.Close()
+		logOut = f
+	case *tuiMode:
+		// Log lines would scribble over the dashboard.
+		logOut = io.Discard
+	}
 	level := parseLogLevel(*logLevel)
 	log := logging.New(logging.Config{
 		Level:  level,
 		Format: *logFormat,
+		Output: logOut,
 	})
 
 	log.Info("adb-monitor starting",
@@ -66,20 +96,50 @@ func run() error {
 	bus := event.NewBus(512)
 	defer bus.Close()
 
-	// Subscribe a logger/printer for all events.
-	bus.Subscribe("stdout_printer", eventPrinter(log, *jsonOutput))
+	var dash *tui.Dashboard
+	if *tuiMode {
+		dash = tui.New()
+		bus.Subscribe("tui", dash.HandleEvent)
+		if *captureMode != "off" {
+			captures := newCaptureRunner(ctx, client, log, dash, mode)
+			bus.Subscribe("tui_captures", captures.handleEvent)
+		}
+	} else {
+		// Subscribe a logger/printer for all events.
+		bus.Subscribe("stdout_printer", eventPrinter(log, *jsonOutput))
+	}
 
 	// --- Device Tracker (streaming) ---
 	deviceTracker := tracker.New(client, bus, log)
 
 	// --- Device Monitor (per-device property collector) ---
+	props, err := monitor.OpenProps(*propsFile)
+	if err != nil {
+		return err
+	}
 	deviceMonitor := monitor.New(client, bus, log, monitor.Config{
-		PropInterval: *propInterval,
+		PropInterval:      *propInterval,
+		SuppressUnchanged: *propsChanged,
+		Props:             props,
 	})
 
 	// --- Run all components ---
 	errCh := make(chan error, 2)
 
+	if dash != nil {
+		dashCtx, stopDash := context.WithCancel(ctx)
+		dashDone := make(chan struct{})
+		go func() {
+			defer close(dashDone)
+			dash.Run(dashCtx, os.Stdout, tui.DefaultRefresh)
+		}()
+		// Restore the screen before anything else is printed.
+		defer func() {
+			stopDash()
+			<-dashDone
+		}()
+	}
+
 	go func() {
 		errCh <- deviceTracker.Run(ctx)
 	}()
@@ -137,6 +197,16 @@ func eventPrinter(log *slog.Logger, jsonOutput bool) event.Handler {
 				"serial", e.Serial,
 				"props", e.Props,
 			)
+		case event.DevicePropertiesChanged:
+			log.Info("EVENT: device properties changed",
+				"serial", e.Serial,
+				"changes", e.Changes,
+			)
+		case event.SecurityPropChanged:
+			log.Warn("EVENT: security property changed",
+				"serial", e.Serial,
+				"changes", e.Changes,
+			)
 		}
 	}
 }
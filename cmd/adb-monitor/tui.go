@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+	"github.com/imcanugur/go-adb-monitor/internal/tui"
+)
+
+// captureRunner starts a capture engine for each device that comes online
+// and stops it when the device goes away, feeding the dashboard.
+type captureRunner struct {
+	ctx    context.Context
+	client *adb.Client
+	log    *slog.Logger
+	dash   *tui.Dashboard
+	mode   capture.Mode
+
+	mu      sync.Mutex
+	running map[string]*captureRun
+}
+
+type captureRun struct {
+	cancel context.CancelFunc
+}
+
+func newCaptureRunner(ctx context.Context, client *adb.Client, log *slog.Logger, dash *tui.Dashboard, mode capture.Mode) *captureRunner {
+	return &captureRunner{
+		ctx:     ctx,
+		client:  client,
+		log:     log,
+		dash:    dash,
+		mode:    mode,
+		running: make(map[string]*captureRun),
+	}
+}
+
+// handleEvent is an event.Handler.
+func (c *captureRunner) handleEvent(e event.Event) {
+	switch e.Type {
+	case event.DeviceConnected, event.DeviceStateChanged:
+		if e.NewState.IsOnline() {
+			c.start(e.Serial)
+		} else {
+			c.stop(e.Serial)
+		}
+	case event.DeviceDisconnected:
+		c.stop(e.Serial)
+	}
+}
+
+func (c *captureRunner) start(serial string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.running[serial]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	run := &captureRun{cancel: cancel}
+	c.running[serial] = run
+
+	engine := capture.NewEngine(c.client, c.log, serial, c.mode)
+	c.dash.Track(ctx, serial, engine)
+	go func() {
+		if err := engine.Run(ctx); err != nil && ctx.Err() == nil {
+			c.log.Warn("capture ended", "serial", serial, "error", err)
+		}
+		cancel()
+		c.mu.Lock()
+		// A later start may already have replaced this run.
+		if c.running[serial] == run {
+			delete(c.running, serial)
+		}
+		c.mu.Unlock()
+	}()
+}
+
+func (c *captureRunner) stop(serial string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if run, ok := c.running[serial]; ok {
+		run.cancel()
+		delete(c.running, serial)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !headless
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// Embed the frontend assets and platform-tools (ADB) into the binary.
+// This makes the output a completely self-contained single file. Build
+// with -tags headless to leave both out (see embed_headless.go).
+var (
+	//go:embed frontend
+	frontendEmbed embed.FS
+
+	//go:embed platform-tools
+	platformToolsEmbed embed.FS
+
+	frontendFS      fs.FS = frontendEmbed
+	platformToolsFS fs.FS = platformToolsEmbed
+)
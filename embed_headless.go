@@ -0,0 +1,14 @@
+//go:build headless
+
+package main
+
+import "io/fs"
+
+// Headless builds embed neither the dashboard nor ADB, so they build
+// without the frontend and platform-tools directories: the API is served
+// alone unless -frontend-dir points at a copy of the dashboard, and ADB is
+// looked up on the system.
+var (
+	frontendFS      fs.FS
+	platformToolsFS fs.FS
+)
@@ -6,6 +6,18 @@
 (function () {
     'use strict';
 
+    // ---- Server Config ----
+    // The server injects its settings into index.html (and serves them at
+    // /api/ui-config); the defaults match a server at the domain root.
+    const config = Object.assign({
+        base_path: '',
+        api_base: '/api',
+        auth: { mode: 'none' },
+        read_only: false,
+        features: {},
+        polling: { status_interval_ms: 2000, max_table_rows: 2000 },
+    }, window.ADB_MONITOR_CONFIG || {});
+
     // ---- State ----
     const state = {
         devices: [],
@@ -14,11 +26,17 @@
         selectedRowId: null,
         activeTab: 'packets',
         filter: '',
+        // Search terms like port:443, sent to /api/events so the server
+        // filters the stream; the rest of the search is matched here.
+        streamFilter: '',
         captures: {},
         autoScroll: true,
-        maxTableRows: 2000,
+        maxTableRows: config.polling.max_table_rows || 2000,
+        readOnly: !!config.read_only,
+        team: '',
         packetCount: 0,
         connectionCount: 0,
+        lastEventId: '',
     };
 
     // ---- DOM Refs ----
@@ -27,6 +45,8 @@
 
     const dom = {
         deviceList: $('#device-list'),
+        discoveredSection: $('#discovered-section'),
+        discoveredList: $('#discovered-list'),
         deviceCountBadge: $('#device-count-badge'),
         captureBadge: $('#capture-badge'),
         packetsBody: $('#packets-body'),
@@ -39,11 +59,16 @@
         statusAdb: $('#status-adb'),
         statusPackets: $('#status-packets'),
         statusConnections: $('#status-connections'),
+        statusTraffic: $('#status-traffic'),
         statusPool: $('#status-pool'),
         statusMemory: $('#status-memory'),
         tabPacketsCount: $('#tab-packets-count'),
         tabConnectionsCount: $('#tab-connections-count'),
         btnAutoscroll: $('#btn-autoscroll'),
+        shellOverlay: $('#shell-overlay'),
+        shellTitle: $('#shell-title'),
+        shellOutput: $('#shell-output'),
+        shellInput: $('#shell-input'),
     };
 
     // ---- Toast Notifications ----
@@ -74,20 +99,41 @@
     }
 
     // ---- HTTP API helpers ----
-    async function api(path, opts = {}) {
-        const resp = await fetch('/api' + path, {
-            headers: { 'Content-Type': 'application/json' },
-            ...opts,
-        });
+    // When the server runs with -auth-token, the token is kept in
+    // localStorage and sent as a bearer token (or ?token= for SSE).
+    const TOKEN_KEY = 'adbMonitorToken';
+
+    function authToken() {
+        return localStorage.getItem(TOKEN_KEY) || '';
+    }
+
+    function promptForToken() {
+        const tok = window.prompt('This server requires an access token:');
+        if (tok) localStorage.setItem(TOKEN_KEY, tok.trim());
+        return !!tok;
+    }
+
+    async function api(path, opts = {}, retried = false) {
+        const headers = { 'Content-Type': 'application/json' };
+        const tok = authToken();
+        if (tok) headers['Authorization'] = 'Bearer ' + tok;
+
+        const resp = await fetch(config.api_base + path, { headers, ...opts });
+        if (resp.status === 401 && !retried && promptForToken()) {
+            connectSSE();
+            return api(path, opts, true);
+        }
         if (!resp.ok) {
             const err = await resp.json().catch(() => ({ error: resp.statusText }));
-            throw new Error(err.error || resp.statusText);
+            throw new Error((err.error || resp.statusText) + (err.hint ? ' — ' + err.hint : ''));
         }
         return resp.json();
     }
 
     function apiGet(path) { return api(path); }
-    function apiPost(path) { return api(path, { method: 'POST' }); }
+    function apiPost(path, body) {
+        return api(path, body === undefined ? { method: 'POST' } : { method: 'POST', body: JSON.stringify(body) });
+    }
 
     // ---- Server-Sent Events ----
     let eventSource = null;
@@ -95,47 +141,223 @@
     function connectSSE() {
         if (eventSource) eventSource.close();
 
-        eventSource = new EventSource('/api/events');
+        // The browser resends Last-Event-ID on its own reconnects; a new
+        // EventSource needs it as a query parameter to get missed events.
+        const params = new URLSearchParams();
+        const tok = authToken();
+        if (tok) params.set('token', tok);
+        if (state.lastEventId) params.set('last_event_id', state.lastEventId);
+        new URLSearchParams(state.streamFilter).forEach((v, k) => params.set(k, v));
+        const qs = params.toString();
+        eventSource = new EventSource(config.api_base + '/events' + (qs ? '?' + qs : ''));
+
+        const on = (type, fn) => eventSource.addEventListener(type, (e) => {
+            if (e.lastEventId) state.lastEventId = e.lastEventId;
+            fn(e);
+        });
+
+        on('device:connected', (e) => {
+            const evt = JSON.parse(e.data);
+            if (evt.device) addOrUpdateDevice({ ...evt.device, label: evt.label });
+        });
+
+        on('device:updated', (e) => {
+            addOrUpdateDevice(JSON.parse(e.data));
+        });
+
+        on('device:health', (e) => {
+            const results = JSON.parse(e.data);
+            state.devices.forEach(d => {
+                if (results[d.serial]) d.health = results[d.serial];
+            });
+            renderDeviceList();
+        });
+
+        on('device:health_changed', (e) => {
+            const evt = JSON.parse(e.data);
+            const kind = evt.status === 'healthy' ? 'success' : 'error';
+            showToast(`${evt.serial}: ${evt.previous} → ${evt.status} (${evt.score})`, kind);
+        });
+
+        on('app:foreground_changed', (e) => {
+            const evt = JSON.parse(e.data);
+            const d = state.devices.find(d => d.serial === evt.serial);
+            if (!d) return;
+            d.foreground = evt.package ? { package: evt.package, activity: evt.activity, start: evt.timestamp } : null;
+            renderDeviceList();
+        });
+
+        // Updates are left out: app stores update dozens at a time.
+        ['installed', 'removed'].forEach(type => {
+            on('package:' + type, (e) => {
+                const evt = JSON.parse(e.data);
+                showToast(`${evt.serial}: ${evt.package.name} ${type}`);
+            });
+        });
+
+        on('battery:threshold', (e) => {
+            const evt = JSON.parse(e.data);
+            if (evt.direction !== 'down' || evt.threshold > 20) return;
+            showToast(`${evt.serial}: battery at ${evt.level}%`, 'error');
+        });
+
+        on('battery:drain', (e) => {
+            const evt = JSON.parse(e.data);
+            showToast(`${evt.serial}: capture drains the battery ${evt.percent_per_hour.toFixed(1)}%/h`, 'error');
+        });
 
-        eventSource.addEventListener('device:connected', (e) => {
+        on('capture:paused', (e) => {
             const evt = JSON.parse(e.data);
-            if (evt.device) addOrUpdateDevice(evt.device);
+            showToast(`${evt.serial}: capture paused at ${evt.level}% battery, resumes at ${evt.resume_level}%`, 'error');
+        });
+
+        on('security:prop_changed', (e) => {
+            const c = JSON.parse(e.data);
+            showToast(`${c.serial}: ${c.prop.replace(/_/g, ' ')} ${c.old || 'unset'} → ${c.new || 'unset'}`, 'error');
+        });
+
+        on('device:labeled', (e) => {
+            const label = JSON.parse(e.data);
+            const dev = state.devices.find(d => d.serial === label.serial);
+            if (!dev) return;
+            dev.label = (label.name || label.group || (label.tags || []).length) ? label : undefined;
+            renderDeviceList();
         });
 
-        eventSource.addEventListener('device:disconnected', (e) => {
+        on('device:disconnected', (e) => {
             const evt = JSON.parse(e.data);
             removeDevice(evt.serial);
         });
 
-        eventSource.addEventListener('device:state_changed', (e) => {
+        on('device:state_changed', (e) => {
+            const evt = JSON.parse(e.data);
+            if (evt.device) addOrUpdateDevice({ ...evt.device, label: evt.label });
+        });
+
+        on('device:unauthorized', (e) => {
             const evt = JSON.parse(e.data);
-            if (evt.device) addOrUpdateDevice(evt.device);
+            showToast(`${evt.serial}: ${evt.message}`, 'error');
+        });
+
+        on('device:authorized', (e) => {
+            const evt = JSON.parse(e.data);
+            showToast(`${evt.serial} authorized`, 'success');
+        });
+
+        on('packets:batch', (e) => {
+            const batch = JSON.parse(e.data);
+            (batch.packets || []).forEach(addPacketRow);
         });
 
-        eventSource.addEventListener('packet:new', (e) => {
-            const pkt = JSON.parse(e.data);
-            addPacketRow(pkt);
+        on('connection:new', (e) => {
+            const conn = JSON.parse(e.data);
+            addConnectionRow(conn);
         });
 
-        eventSource.addEventListener('connection:new', (e) => {
+        on('connection:closed', (e) => {
             const conn = JSON.parse(e.data);
             addConnectionRow(conn);
         });
 
-        eventSource.addEventListener('capture:stopped', (e) => {
+        on('capture:stopped', (e) => {
             const data = JSON.parse(e.data);
             delete state.captures[data.serial];
             renderDeviceList();
             updateCaptureBadge();
         });
 
-        eventSource.addEventListener('devices:refreshed', (e) => {
+        on('capture:rollout_progress', (e) => {
+            const p = JSON.parse(e.data);
+            const d = p.device;
+            if (d.status === 'started' || d.status === 'running') {
+                state.captures[d.serial] = true;
+                renderDeviceList();
+                updateCaptureBadge();
+            } else if (d.status === 'failed') {
+                showToast(`${d.serial}: ${d.error}${d.hint ? ` (${d.hint})` : ''}`, 'error');
+            }
+        });
+
+        on('capture:rollout_completed', (e) => {
+            const r = JSON.parse(e.data);
+            const msg = `Capture started on ${r.started + r.running} of ${r.total} devices` +
+                (r.failed ? `, ${r.failed} failed` : '');
+            showToast(msg, r.failed ? 'error' : 'success');
+        });
+
+        on('capture:degraded', (e) => {
+            const data = JSON.parse(e.data);
+            const msg = data.fallback
+                ? `${data.serial}: ${data.mode} failed, using ${data.fallback}`
+                : `${data.serial}: ${data.mode} restarting (#${data.restarts})`;
+            showToast(msg, 'error');
+        });
+
+        on('threat:detected', (e) => {
+            const t = JSON.parse(e.data);
+            const who = t.app ? `${t.app} on ${t.serial}` : t.serial;
+            showToast(`${who}: ${t.host || t.ip} matched ${t.threat}`, 'error');
+        });
+
+        on('tls:weak', (e) => {
+            const t = JSON.parse(e.data);
+            showToast(`${t.serial}: ${t.detail}`, 'error');
+        });
+
+        on('anomaly:detected', (e) => {
+            const a = JSON.parse(e.data);
+            const who = a.app ? `${a.app} on ${a.serial}` : a.serial;
+            const msg = a.kind === 'new_destination'
+                ? `${who}: new destination ${a.destination}`
+                : `${who}: ${a.metric} ${a.kind === 'volume_high' ? 'spike' : 'drop'} (${Math.round(a.observed)} vs ~${Math.round(a.baseline)})`;
+            showToast(msg, 'error');
+        });
+
+        on('capture:started', (e) => {
+            const data = JSON.parse(e.data);
+            state.captures[data.serial] = true;
+            renderDeviceList();
+            updateCaptureBadge();
+        });
+
+        on('adb:server_restarted', () => {
+            showToast('ADB server restarted — resuming captures', 'error');
+        });
+
+        on('adb:server_down', (e) => {
+            const data = JSON.parse(e.data);
+            showToast(`ADB server not responding (${data.reason}) — restarting it`, 'error');
+        });
+
+        on('adb:server_up', () => {
+            showToast('ADB server is up again', 'success');
+        });
+
+        on('adb:outdated', (e) => {
+            const info = JSON.parse(e.data);
+            dom.statusAdb.textContent = `ADB: v${info.version}`;
+            showToast(info.warning, 'error');
+        });
+
+        on('enrichment:updated', (e) => {
+            backfillHostname(JSON.parse(e.data));
+        });
+
+        on('stats:traffic', (e) => {
+            const stats = JSON.parse(e.data);
+            const rate = (stats.rates || []).find(r => r.window === '1m0s');
+            const top = (stats.hosts || [])[0];
+            dom.statusTraffic.textContent = `Req/min: ${rate ? rate.per_minute.toFixed(0) : 0}` +
+                (top ? ` · Top: ${top.key}` : '');
+        });
+
+        on('devices:refreshed', (e) => {
             const devices = JSON.parse(e.data);
             state.devices = devices || [];
             renderDeviceList();
         });
 
-        eventSource.addEventListener('store:cleared', () => {
+        on('store:cleared', () => {
             dom.packetsBody.innerHTML = '';
             dom.connectionsBody.innerHTML = '';
             dom.packetsEmpty.classList.remove('hidden');
@@ -145,7 +367,12 @@
             updateTabBadges();
         });
 
-        eventSource.addEventListener('ping', () => {});
+        on('ping', () => {});
+
+        on('stream:gap', () => {
+            showToast('Missed some live events while disconnected', 'error');
+            refreshDevices();
+        });
 
         eventSource.onerror = () => {
             console.warn('SSE connection lost, reconnecting...');
@@ -155,17 +382,35 @@
     // ---- Initialization ----
     async function init() {
         setupEventListeners();
+        document.body.classList.toggle('read-only', state.readOnly);
+        // Ask for the token up front rather than after the first 401.
+        if (config.auth.mode === 'token' && !authToken()) promptForToken();
         connectSSE();
 
         try {
-            const data = await apiGet('/adb/version');
-            dom.statusAdb.textContent = `ADB: v${data.version}`;
+            const mode = await apiGet('/server/mode');
+            state.readOnly = !!mode.read_only;
+            document.body.classList.toggle('read-only', state.readOnly);
+            // Team tokens see only their team's devices and none of the
+            // server-wide controls.
+            state.team = mode.team || '';
+            document.body.classList.toggle('team', !!state.team);
+        } catch (e) {
+            // Older servers have no mode endpoint; assume full control.
+        }
+
+        if (state.team) {
+            dom.statusAdb.textContent = `Team: ${state.team}`;
+        } else try {
+            const info = await apiGet('/adb/info');
+            dom.statusAdb.textContent = `ADB: v${info.version}`;
+            if (info.warning) showToast(info.warning, 'error');
         } catch (e) {
             dom.statusAdb.textContent = 'ADB: not connected';
         }
 
         await refreshDevices();
-        setInterval(updateStatus, 2000);
+        setInterval(updateStatus, config.polling.status_interval_ms || 2000);
     }
 
     // ---- Event Listeners ----
@@ -176,6 +421,14 @@
         $('#btn-clear').addEventListener('click', clearData);
         $('#btn-close-detail').addEventListener('click', closeDetail);
         $('#btn-export').addEventListener('click', exportData);
+        $('#btn-close-shell').addEventListener('click', closeShell);
+        $('#btn-shell-interrupt').addEventListener('click', () => sendShellInput('\x03'));
+        $('#shell-form').addEventListener('submit', (e) => {
+            e.preventDefault();
+            sendShellInput(dom.shellInput.value + '\n');
+            dom.shellInput.value = '';
+        });
+        window.addEventListener('resize', sendShellSize);
 
         dom.btnAutoscroll.addEventListener('click', () => {
             state.autoScroll = !state.autoScroll;
@@ -183,10 +436,21 @@
             showToast(state.autoScroll ? 'Auto-scroll ON' : 'Auto-scroll OFF');
         });
 
+        let streamFilterTimer = null;
         dom.searchInput.addEventListener('input', (e) => {
-            state.filter = e.target.value.toLowerCase();
+            const { text, stream } = parseSearch(e.target.value);
+            state.filter = text;
             applyFilterToTable(dom.packetsBody);
             applyFilterToTable(dom.connectionsBody);
+
+            // Reconnect once typing pauses; last_event_id keeps the events
+            // in between.
+            clearTimeout(streamFilterTimer);
+            streamFilterTimer = setTimeout(() => {
+                if (stream === state.streamFilter) return;
+                state.streamFilter = stream;
+                connectSSE();
+            }, 400);
         });
 
         $$('.tab').forEach(tab => {
@@ -195,6 +459,8 @@
 
         // Keyboard shortcuts
         document.addEventListener('keydown', (e) => {
+            // Keys typed into the shell belong to the device.
+            if (e.target === dom.shellInput) return;
             // Escape — close detail panel
             if (e.key === 'Escape') {
                 closeDetail();
@@ -216,7 +482,7 @@
             // Ctrl+L — clear data
             if ((e.ctrlKey || e.metaKey) && e.key === 'l') {
                 e.preventDefault();
-                clearData();
+                if (!state.readOnly) clearData();
                 return;
             }
             // 1/2 — switch tabs
@@ -230,19 +496,58 @@
     // ---- Device Management ----
     async function refreshDevices() {
         try {
-            const devices = await apiPost('/devices/refresh');
+            // Re-scanning is server-wide; teams list their devices.
+            const devices = state.team ? await apiGet('/devices') : await apiPost('/devices/refresh');
             state.devices = devices || [];
             renderDeviceList();
         } catch (e) {
             console.error('Failed to refresh devices:', e);
         }
+        if (!state.team) refreshDiscovered();
+    }
+
+    // Wireless devices the ADB server sees over mDNS but is not connected to.
+    async function refreshDiscovered() {
+        let found = [];
+        try {
+            found = await apiGet('/devices/discovered');
+        } catch (e) {
+            // mDNS disabled or an older server.
+        }
+        dom.discoveredSection.classList.toggle('hidden', found.length === 0);
+        dom.discoveredList.innerHTML = found.map(s => `
+                <div class="device-item">
+                    <div class="device-status offline"></div>
+                    <div class="device-info">
+                        <div class="device-serial" title="${escapeHtml(s.instance)}">${escapeHtml(s.serial || s.instance)}</div>
+                        <div class="device-model">${escapeHtml(s.addr)}${s.pairing ? ' · pair with adb pair first' : ''}</div>
+                    </div>
+                    ${s.pairing ? '' : `<button class="device-connect-btn" data-addr="${escapeHtml(s.addr)}" title="Connect">Connect</button>`}
+                </div>
+            `).join('');
+
+        dom.discoveredList.querySelectorAll('.device-connect-btn').forEach(btn => {
+            btn.addEventListener('click', async () => {
+                btn.disabled = true;
+                try {
+                    const res = await apiPost('/devices/connect', { addr: btn.dataset.addr });
+                    showToast(res.message, 'success');
+                    await refreshDevices();
+                } catch (e) {
+                    showToast('Connect failed: ' + e.message, 'error');
+                    btn.disabled = false;
+                }
+            });
+        });
     }
 
     function addOrUpdateDevice(device) {
         if (!device) return;
         const idx = state.devices.findIndex(d => d.serial === device.serial);
         if (idx >= 0) {
-            state.devices[idx] = device;
+            // Tracker events do not carry the detected class or health.
+            const prev = state.devices[idx];
+            state.devices[idx] = { device_class: prev.device_class, health: prev.health, ...device };
         } else {
             state.devices.push(device);
         }
@@ -267,13 +572,27 @@
 
         dom.deviceCountBadge.textContent = `${state.devices.length} device${state.devices.length !== 1 ? 's' : ''}`;
 
-        dom.deviceList.innerHTML = state.devices.map(d => {
+        // Worst health first, so devices needing attention are on top;
+        // devices not scored yet go last.
+        const score = d => (d.health ? d.health.score : 101);
+        const sorted = [...state.devices].sort((a, b) =>
+            score(a) - score(b) || a.serial.localeCompare(b.serial));
+
+        dom.deviceList.innerHTML = sorted.map(d => {
             const isCapturing = !!state.captures[d.serial];
             const statusClass = isCapturing ? 'capturing' :
                 d.state === 'device' ? 'online' :
                 d.state === 'unauthorized' ? 'unauthorized' : 'offline';
             const selected = state.selectedDevice === d.serial ? 'selected' : '';
             const model = d.model || d.product || 'Unknown';
+            const deviceClass = d.device_class ? ` · ${escapeHtml(d.device_class)}` : '';
+            const health = d.health ? `
+                    <span class="device-health ${healthClass(d.health.score)}" title="${escapeHtml((d.health.reasons || ['healthy']).join('\n'))}">${d.health.score}</span>` : '';
+            const label = d.label || {};
+            const group = label.group ? ` · ${escapeHtml(label.group)}` : '';
+            const tags = (label.tags || []).map(t => `<span class="device-tag">${escapeHtml(t)}</span>`).join('');
+            const foreground = d.foreground ? `
+                        <div class="device-model" title="${escapeHtml(d.foreground.activity || d.foreground.package)}">&#9656; ${escapeHtml(d.foreground.package)}</div>` : '';
             const btnLabel = isCapturing ? '&#9632;' : '&#9654;';
             const btnClass = isCapturing ? 'active' : '';
 
@@ -281,9 +600,11 @@
                 <div class="device-item ${selected}" data-serial="${d.serial}">
                     <div class="device-status ${statusClass}"></div>
                     <div class="device-info">
-                        <div class="device-serial">${escapeHtml(d.serial)}</div>
-                        <div class="device-model">${escapeHtml(model)} · ${d.state}</div>
+                        <div class="device-serial" title="${escapeHtml(d.serial)}">${escapeHtml(label.name || d.serial)}${tags}</div>
+                        <div class="device-model">${escapeHtml(model)}${deviceClass}${group} · ${d.state}</div>${foreground}
                     </div>
+                    ${health}
+                    <button class="device-shell-btn" data-serial="${d.serial}" title="Open Shell" ${d.state === 'device' ? '' : 'disabled'}>&gt;_</button>
                     <button class="device-capture-btn ${btnClass}" data-serial="${d.serial}" title="${isCapturing ? 'Stop' : 'Start'} Capture">
                         ${btnLabel}
                     </button>
@@ -293,7 +614,7 @@
 
         dom.deviceList.querySelectorAll('.device-item').forEach(el => {
             el.addEventListener('click', (e) => {
-                if (e.target.closest('.device-capture-btn')) return;
+                if (e.target.closest('.device-capture-btn, .device-shell-btn')) return;
                 state.selectedDevice = el.dataset.serial;
                 renderDeviceList();
             });
@@ -306,9 +627,22 @@
             });
         });
 
+        dom.deviceList.querySelectorAll('.device-shell-btn').forEach(btn => {
+            btn.addEventListener('click', (e) => {
+                e.stopPropagation();
+                openShell(btn.dataset.serial);
+            });
+        });
+
         updateCaptureBadge();
     }
 
+    function healthClass(score) {
+        if (score >= 80) return 'health-good';
+        if (score >= 50) return 'health-warn';
+        return 'health-bad';
+    }
+
     async function toggleCapture(serial) {
         if (state.captures[serial]) {
             await apiPost('/capture/stop/' + encodeURIComponent(serial));
@@ -328,13 +662,8 @@
 
     async function startAllCaptures() {
         try {
-            await apiPost('/capture/start-all');
-            state.devices.forEach(d => {
-                if (d.state === 'device') state.captures[d.serial] = true;
-            });
-            renderDeviceList();
-            updateCaptureBadge();
-            showToast('Capture started on all devices', 'success');
+            const r = await apiPost('/capture/start-all');
+            showToast(`Starting capture on ${r.total} devices, ${r.parallel} at a time`, 'success');
         } catch (e) {
             console.error('Failed to start all captures:', e);
             showToast('Failed to start captures', 'error');
@@ -404,6 +733,7 @@
             : '';
         const flagsLabel = (!method && pkt.flags && !isLogcat) ? pkt.flags : '';
         const sourceTag = isLogcat ? '<span class="source-logcat" title="Captured from logcat">LC</span> ' : '';
+        const threatTag = pkt.malicious ? `<span class="threat-tag" title="${escapeHtml(pkt.threat || '')}">!</span>` : '';
 
         tr.innerHTML = `
             <td class="col-time">${time}</td>
@@ -412,13 +742,16 @@
             <td class="col-src truncate">${escapeHtml(pkt.src_ip || '')}${pkt.src_port ? ':' + pkt.src_port : ''}</td>
             <td class="col-dst truncate">${escapeHtml(pkt.dst_ip || '')}${pkt.dst_port ? ':' + pkt.dst_port : ''}</td>
             <td class="col-method ${methodClass}">${sourceTag}${method || flagsLabel}</td>
-            <td class="col-host truncate" title="${escapeHtml(hostPath)}">${escapeHtml(hostPath)}</td>
+            <td class="col-host truncate" title="${escapeHtml(hostPath)}">${threatTag}${escapeHtml(hostPath)}</td>
             <td class="col-len">${pkt.length || (isLogcat ? '—' : 0)}</td>
         `;
 
         if (isLogcat) {
             tr.classList.add('logcat-row');
         }
+        if (pkt.malicious) {
+            tr.classList.add('malicious-row');
+        }
 
         tr.addEventListener('click', () => {
             selectRow(dom.packetsBody, pkt.id);
@@ -440,14 +773,19 @@
     function addConnectionRow(conn) {
         if (!conn || !conn.id) return;
 
-        dom.connectionsEmpty.classList.add('hidden');
-        state.connectionCount++;
-        updateTabBadges();
+        // Updates (new byte counters, late hostname) reuse the connection ID.
+        const existing = dom.connectionsBody.querySelector(`tr[data-id="${CSS.escape(conn.id)}"]`);
+        if (!existing) {
+            dom.connectionsEmpty.classList.add('hidden');
+            state.connectionCount++;
+            updateTabBadges();
+        }
 
         if (state.filter && !matchesConnectionFilter(conn)) return;
 
-        const tr = document.createElement('tr');
+        const tr = existing || document.createElement('tr');
         tr.dataset.id = conn.id;
+        tr.classList.toggle('conn-closed', !!conn.closed_at);
 
         const proto = conn.protocol || 'TCP';
         const protoClass = `proto-${proto.toLowerCase()}`;
@@ -455,6 +793,7 @@
         const seen = formatTime(conn.first_seen);
         const appName = conn.app_name || '';
         const hostname = conn.hostname || '';
+        const threatTag = conn.malicious ? `<span class="threat-tag" title="${escapeHtml(conn.threat || '')}">!</span>` : '';
 
         tr.innerHTML = `
             <td class="col-device truncate">${escapeHtml(conn.serial || '')}</td>
@@ -462,16 +801,23 @@
             <td class="col-state ${stateClass}">${conn.state || ''}</td>
             <td class="col-local truncate">${escapeHtml(conn.local_ip || '')}:${conn.local_port || ''}</td>
             <td class="col-remote truncate">${escapeHtml(conn.remote_ip || '')}:${conn.remote_port || ''}</td>
-            <td class="col-host truncate" title="${escapeHtml(hostname)}">${escapeHtml(hostname)}</td>
+            <td class="col-host truncate" title="${escapeHtml(hostname)}">${threatTag}${escapeHtml(hostname)}</td>
             <td class="col-app truncate" title="${escapeHtml(appName)}">${escapeHtml(shortPkg(appName))}</td>
+            <td class="col-bytes" title="sent / received">${formatTraffic(conn)}</td>
             <td class="col-seen">${seen}</td>
         `;
 
-        tr.addEventListener('click', () => {
+        tr.classList.toggle('malicious-row', !!conn.malicious);
+
+        tr.onclick = () => {
             selectRow(dom.connectionsBody, conn.id);
             showConnectionDetail(conn);
-        });
+        };
 
+        if (existing) {
+            if (state.selectedRowId === conn.id) showConnectionDetail(conn);
+            return;
+        }
         dom.connectionsBody.appendChild(tr);
 
         while (dom.connectionsBody.children.length > state.maxTableRows) {
@@ -479,6 +825,24 @@
         }
     }
 
+    // Fill the host column of rows shown before their IP was resolved.
+    function backfillHostname(u) {
+        const matches = (td) => td && td.textContent.startsWith(u.ip + ':');
+        const patch = (tbody, ipCols) => {
+            for (const tr of tbody.children) {
+                const host = tr.querySelector('.col-host');
+                const device = tr.querySelector('.col-device');
+                if (!host || host.textContent || !device || device.textContent !== u.serial) continue;
+                if (ipCols.some(col => matches(tr.querySelector(col)))) {
+                    host.textContent = u.hostname;
+                    host.title = u.hostname;
+                }
+            }
+        };
+        patch(dom.packetsBody, ['.col-src', '.col-dst']);
+        patch(dom.connectionsBody, ['.col-remote']);
+    }
+
     // ---- Detail Panel ----
     function showPacketDetail(pkt) {
         state.selectedPacket = pkt;
@@ -539,6 +903,7 @@
                 ${detailRow('State', conn.state)}
                 ${detailRow('UID', conn.uid)}
                 ${conn.app_name ? detailRow('App', conn.app_name, true) : ''}
+                ${conn.process ? detailRow('Process', conn.process + (conn.pid ? ' (' + conn.pid + ')' : ''), true) : ''}
                 ${conn.hostname ? detailRow('Host', conn.hostname, true) : ''}
             </div>
             <div class="detail-section">
@@ -558,6 +923,13 @@
                 ${detailRow('First Seen', new Date(conn.first_seen).toLocaleTimeString())}
                 ${detailRow('Last Seen', new Date(conn.last_seen).toLocaleTimeString())}
             </div>
+            ${conn.bytes_sent || conn.bytes_received || conn.rtt_ms ? `
+            <div class="detail-section">
+                <h4>Traffic</h4>
+                ${detailRow('Sent', formatBytes(conn.bytes_sent || 0))}
+                ${detailRow('Received', formatBytes(conn.bytes_received || 0))}
+                ${conn.rtt_ms ? detailRow('RTT', conn.rtt_ms.toFixed(1) + ' ms') : ''}
+            </div>` : ''}
         `;
 
         bindCopyButtons();
@@ -605,6 +977,87 @@
         });
     }
 
+    // ---- Device Shell ----
+    // Terminal bytes travel as binary WebSocket frames; resize and exit are
+    // JSON text frames.
+    let shellSocket = null;
+    const shellDecoder = new TextDecoder();
+    const shellEncoder = new TextEncoder();
+    const SHELL_SCROLLBACK = 200000;
+    const ANSI_RE = /\x1b\[[0-?]*[ -\/]*[@-~]|\x1b\][^\x07]*\x07|\x1b[()][0-9A-Za-z]|\r/g;
+
+    function shellSize() {
+        const style = getComputedStyle(dom.shellOutput);
+        const charWidth = parseFloat(style.fontSize) * 0.6;
+        const lineHeight = parseFloat(style.lineHeight) || parseFloat(style.fontSize) * 1.4;
+        return {
+            rows: Math.max(10, Math.floor(dom.shellOutput.clientHeight / lineHeight)),
+            cols: Math.max(20, Math.floor(dom.shellOutput.clientWidth / charWidth)),
+        };
+    }
+
+    function openShell(serial) {
+        closeShell();
+        dom.shellTitle.textContent = 'Shell — ' + serial;
+        dom.shellOutput.textContent = '';
+        dom.shellOverlay.classList.remove('hidden');
+        dom.shellInput.focus();
+
+        const { rows, cols } = shellSize();
+        const params = new URLSearchParams({ rows, cols });
+        const tok = authToken();
+        if (tok) params.set('token', tok);
+        const proto = location.protocol === 'https:' ? 'wss:' : 'ws:';
+        const url = `${proto}//${location.host}${config.api_base}/devices/${encodeURIComponent(serial)}/shell?${params}`;
+
+        const sock = new WebSocket(url);
+        sock.binaryType = 'arraybuffer';
+        sock.onmessage = (e) => {
+            if (typeof e.data !== 'string') {
+                appendShellOutput(shellDecoder.decode(e.data, { stream: true }));
+                return;
+            }
+            const msg = JSON.parse(e.data);
+            if (msg.type === 'exit') {
+                appendShellOutput(`\n[process exited${msg.code >= 0 ? ' with code ' + msg.code : ''}]\n`);
+            } else if (msg.type === 'error') {
+                appendShellOutput(`\n[error: ${msg.message}]\n`);
+            }
+        };
+        sock.onclose = () => {
+            if (shellSocket === sock) shellSocket = null;
+        };
+        sock.onerror = () => showToast('Shell connection failed', 'error');
+        shellSocket = sock;
+    }
+
+    function closeShell() {
+        if (shellSocket) {
+            shellSocket.close();
+            shellSocket = null;
+        }
+        dom.shellOverlay.classList.add('hidden');
+    }
+
+    function sendShellInput(text) {
+        if (shellSocket && shellSocket.readyState === WebSocket.OPEN) {
+            shellSocket.send(shellEncoder.encode(text));
+        }
+    }
+
+    function sendShellSize() {
+        if (shellSocket && shellSocket.readyState === WebSocket.OPEN) {
+            shellSocket.send(JSON.stringify({ type: 'resize', ...shellSize() }));
+        }
+    }
+
+    function appendShellOutput(text) {
+        let out = dom.shellOutput.textContent + text.replace(ANSI_RE, '');
+        if (out.length > SHELL_SCROLLBACK) out = out.slice(-SHELL_SCROLLBACK);
+        dom.shellOutput.textContent = out;
+        dom.shellOutput.scrollTop = dom.shellOutput.scrollHeight;
+    }
+
     // ---- Export ----
     function exportData() {
         const rows = [];
@@ -689,6 +1142,24 @@
         return div.innerHTML;
     }
 
+    // parseSearch splits the search box into the serial:, host:, port: and
+    // app: terms /api/events filters by, as a query string, and the rest
+    // of the text, lower-cased. Several serial: terms mean any of them.
+    function parseSearch(value) {
+        const terms = {};
+        const text = [];
+        value.trim().split(/\s+/).forEach(term => {
+            const m = term.match(/^(serial|host|port|app):(.+)$/i);
+            const key = m && m[1].toLowerCase();
+            if (key === 'serial') (terms.serial = terms.serial || []).push(m[2]);
+            else if (m && (key !== 'port' || (/^\d+$/.test(m[2]) && +m[2] > 0 && +m[2] < 65536))) terms[key] = m[2];
+            else if (term) text.push(term.toLowerCase());
+        });
+        const stream = new URLSearchParams();
+        Object.keys(terms).sort().forEach(k => stream.set(k, [].concat(terms[k]).join(',')));
+        return { text: text.join(' '), stream: stream.toString() };
+    }
+
     function matchesFilter(pkt) {
         const f = state.filter;
         if (!f) return true;
@@ -735,6 +1206,18 @@
     }
 
     // Shorten package name: "com.google.android.apps.maps" → "c.g.a.a.maps"
+    function formatBytes(n) {
+        if (n < 1024) return n + ' B';
+        if (n < 1024 * 1024) return (n / 1024).toFixed(1) + ' KB';
+        if (n < 1024 * 1024 * 1024) return (n / (1024 * 1024)).toFixed(1) + ' MB';
+        return (n / (1024 * 1024 * 1024)).toFixed(2) + ' GB';
+    }
+
+    function formatTraffic(conn) {
+        if (!conn.bytes_sent && !conn.bytes_received) return '';
+        return `${formatBytes(conn.bytes_sent || 0)} / ${formatBytes(conn.bytes_received || 0)}`;
+    }
+
     function shortPkg(pkg) {
         if (!pkg) return '';
         const parts = pkg.split('.');
@@ -1,3 +1,5 @@
 module github.com/imcanugur/go-adb-monitor
 
 go 1.22.6
+
+require github.com/google/gopacket v1.1.19
@@ -0,0 +1,109 @@
+package adb
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CommandRecord describes one command the client ran on a device.
+type CommandRecord struct {
+	Serial string
+	// Service is the adbd service: "shell", "shell,v2", "sync", "root",
+	// "reverse" and so on. Command is what it ran: the shell command line,
+	// or the path of a sync transfer.
+	Service  string
+	Command  string
+	Start    time.Time
+	Duration time.Duration
+	// Bytes counts the output read, or for a push the bytes sent.
+	Bytes int64
+	// ExitCode is the shell's exit status, or ShellExitUnknown.
+	ExitCode int
+	Err      error
+}
+
+// Auditor receives a record of every device command once it finished. It
+// is called from the goroutine that ran the command, so it must be quick.
+type Auditor func(CommandRecord)
+
+// SetAuditor makes the client report every device command to fn; nil
+// stops reporting.
+func (c *Client) SetAuditor(fn Auditor) {
+	if fn == nil {
+		c.auditor.Store(nil)
+		return
+	}
+	c.auditor.Store(&fn)
+}
+
+// audit reports a finished command, if an auditor is set.
+func (c *Client) audit(serial, service string, start time.Time, n int64, exitCode int, err error) {
+	fn := c.auditor.Load()
+	if fn == nil {
+		return
+	}
+	name, command, _ := strings.Cut(service, ":")
+	(*fn)(CommandRecord{
+		Serial:   serial,
+		Service:  name,
+		Command:  redactCommand(command),
+		Start:    start,
+		Duration: time.Since(start),
+		Bytes:    n,
+		ExitCode: exitCode,
+		Err:      err,
+	})
+}
+
+// inputText matches an input text command and everything after it: where
+// the text ends depends on its shell quoting, so the rest of the command
+// line is hidden with it.
+var inputText = regexp.MustCompile(`(?s)\binput\s+text\s.*`)
+
+// redactCommand hides the text typed by input text commands in command.
+func redactCommand(command string) string {
+	return inputText.ReplaceAllLiteralString(command, "input text [redacted]")
+}
+
+// auditedStream reports a long-lived command when it is closed, with the
+// bytes read from it by then. Reads and Close may run on different
+// goroutines; a nil auditedStream does nothing.
+type auditedStream struct {
+	c        *Client
+	serial   string
+	service  string
+	start    time.Time
+	n        atomic.Int64
+	exitCode atomic.Int64
+	once     sync.Once
+}
+
+func (c *Client) newAuditedStream(serial, service string, start time.Time) *auditedStream {
+	s := &auditedStream{c: c, serial: serial, service: service, start: start}
+	s.exitCode.Store(ShellExitUnknown)
+	return s
+}
+
+func (s *auditedStream) read(n int) {
+	if s != nil {
+		s.n.Add(int64(n))
+	}
+}
+
+func (s *auditedStream) exited(code int) {
+	if s != nil {
+		s.exitCode.Store(int64(code))
+	}
+}
+
+func (s *auditedStream) done() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		s.c.audit(s.serial, s.service, s.start, s.n.Load(), int(s.exitCode.Load()), nil)
+	})
+}
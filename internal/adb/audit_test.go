@@ -0,0 +1,32 @@
+package adb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRedactCommand(t *testing.T) {
+	tests := map[string]string{
+		"input text 'hunter2'":                        "input text [redacted]",
+		"input text 'correct%shorse'; input keyevent": "input text [redacted]",
+		"su -c 'input  text '\\''pin'\\'''":           "su -c 'input text [redacted]",
+		"input tap 540 1200":                          "input tap 540 1200",
+		"input keyevent KEYCODE_ENTER":                "input keyevent KEYCODE_ENTER",
+		"getprop ro.product.model":                    "getprop ro.product.model",
+	}
+	for cmd, want := range tests {
+		if got := redactCommand(cmd); got != want {
+			t.Errorf("redactCommand(%q) = %q, want %q", cmd, got, want)
+		}
+	}
+}
+
+func TestAudit_RedactsInputText(t *testing.T) {
+	var got CommandRecord
+	c := NewClient("")
+	c.SetAuditor(func(r CommandRecord) { got = r })
+	c.audit("dev1", "shell,v2,raw:input text 'user@example.com'", time.Now(), 0, 0, nil)
+	if got.Command != "input text [redacted]" {
+		t.Errorf("Command = %q", got.Command)
+	}
+}
@@ -0,0 +1,71 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DeviceClass is the form factor of a device.
+type DeviceClass string
+
+const (
+	ClassUnknown    DeviceClass = ""
+	ClassPhone      DeviceClass = "phone"
+	ClassTablet     DeviceClass = "tablet"
+	ClassTV         DeviceClass = "tv"
+	ClassWatch      DeviceClass = "watch"
+	ClassAutomotive DeviceClass = "automotive"
+	ClassChromeOS   DeviceClass = "chromeos"
+)
+
+// ClassProps are the system properties ClassifyDevice looks at.
+var ClassProps = []string{
+	"ro.build.characteristics",
+	"ro.boot.container",
+	"ro.boot.hardware",
+	"ro.product.device",
+}
+
+// HasBattery reports whether devices of this class usually run on battery.
+// TV boxes and cars report a fake or absent battery.
+func (c DeviceClass) HasBattery() bool {
+	return c != ClassTV && c != ClassAutomotive
+}
+
+// ClassifyDevice derives the form factor from system properties (see
+// ClassProps). ro.build.characteristics is a comma-separated list such as
+// "tablet,nosdcard" or "tv"; ChromeOS runs Android in a container (ARC++)
+// or VM (ARCVM, hardware "bertha").
+func ClassifyDevice(props map[string]string) DeviceClass {
+	if props["ro.boot.container"] == "1" || strings.HasPrefix(props["ro.boot.hardware"], "bertha") {
+		return ClassChromeOS
+	}
+
+	for _, c := range strings.Split(props["ro.build.characteristics"], ",") {
+		switch strings.TrimSpace(c) {
+		case "tv":
+			return ClassTV
+		case "watch":
+			return ClassWatch
+		case "automotive":
+			return ClassAutomotive
+		case "tablet":
+			return ClassTablet
+		}
+	}
+
+	if props["ro.build.characteristics"] == "" && props["ro.product.device"] == "" {
+		return ClassUnknown
+	}
+	return ClassPhone
+}
+
+// DetectDeviceClass reads ClassProps from the device and classifies it.
+func (c *Client) DetectDeviceClass(ctx context.Context, serial string) (DeviceClass, error) {
+	props, err := c.GetDeviceProps(ctx, serial, ClassProps...)
+	if err != nil {
+		return ClassUnknown, fmt.Errorf("detecting device class: %w", err)
+	}
+	return ClassifyDevice(props), nil
+}
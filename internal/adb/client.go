@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,6 +21,14 @@ const (
 // Client communicates with the ADB server over TCP.
 type Client struct {
 	addr string
+
+	// legacyShell records serials that rejected shell v2, so ShellV2 goes
+	// straight to the legacy protocol for them and OpenShellV2 fails fast.
+	legacyShell sync.Map
+	// features caches Features by serial.
+	features sync.Map
+
+	auditor atomic.Pointer[Auditor]
 }
 
 // NewClient creates a new ADB client targeting the given server address.
@@ -50,18 +60,18 @@ func (c *Client) dial(ctx context.Context) (net.Conn, error) {
 // RawCommand opens a connection, sends the command, verifies OKAY, and returns
 // the open connection for the caller to read the response stream.
 // The caller is responsible for closing the returned connection.
+//
+// The connection carries ctx's deadline, or defaultDialTimeout if ctx has
+// none, so a server that never answers cannot hang the caller. Streaming
+// callers clear it once the handshake is done.
 func (c *Client) RawCommand(ctx context.Context, cmd string) (net.Conn, error) {
 	conn, err := c.dial(ctx)
 	if err != nil {
 		return nil, err
 	}
-
-	// Set deadline from context if present.
-	if deadline, ok := ctx.Deadline(); ok {
-		if err := conn.SetDeadline(deadline); err != nil {
-			conn.Close()
-			return nil, fmt.Errorf("setting deadline: %w", err)
-		}
+	if err := conn.SetDeadline(handshakeDeadline(ctx)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("setting deadline: %w", err)
 	}
 
 	if err := writeCommand(conn, cmd); err != nil {
@@ -77,6 +87,15 @@ func (c *Client) RawCommand(ctx context.Context, cmd string) (net.Conn, error) {
 	return conn, nil
 }
 
+// handshakeDeadline bounds protocol exchanges: ctx's deadline, or
+// defaultDialTimeout from now.
+func handshakeDeadline(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+	return time.Now().Add(defaultDialTimeout)
+}
+
 // Command sends a command and reads the full length-prefixed response.
 func (c *Client) Command(ctx context.Context, cmd string) (string, error) {
 	conn, err := c.RawCommand(ctx, cmd)
@@ -89,28 +108,19 @@ func (c *Client) Command(ctx context.Context, cmd string) (string, error) {
 }
 
 // DeviceCommand sends a command targeted at a specific device serial.
-func (c *Client) DeviceCommand(ctx context.Context, serial, cmd string) (string, error) {
-	conn, err := c.dial(ctx)
+// The handshake is bounded like RawCommand's. Output is read until ctx's
+// deadline, if any; without one, cancelling ctx aborts the read.
+func (c *Client) DeviceCommand(ctx context.Context, serial, cmd string) (out string, err error) {
+	defer func(start time.Time) {
+		c.audit(serial, cmd, start, int64(len(out)), ShellExitUnknown, err)
+	}(time.Now())
+
+	conn, err := c.openTransport(ctx, serial)
 	if err != nil {
 		return "", err
 	}
 	defer conn.Close()
 
-	if deadline, ok := ctx.Deadline(); ok {
-		if err := conn.SetDeadline(deadline); err != nil {
-			return "", fmt.Errorf("setting deadline: %w", err)
-		}
-	}
-
-	// First, select the device transport.
-	hostCmd := fmt.Sprintf("host:transport:%s", serial)
-	if err := writeCommand(conn, hostCmd); err != nil {
-		return "", fmt.Errorf("writing transport selection: %w", err)
-	}
-	if err := readStatus(conn, hostCmd); err != nil {
-		return "", fmt.Errorf("selecting device %s: %w", serial, err)
-	}
-
 	// Then, send the actual command.
 	if err := writeCommand(conn, cmd); err != nil {
 		return "", fmt.Errorf("writing device command %q: %w", cmd, err)
@@ -119,7 +129,16 @@ func (c *Client) DeviceCommand(ctx context.Context, serial, cmd string) (string,
 		return "", err
 	}
 
-	return readShellOutput(conn)
+	if _, ok := ctx.Deadline(); !ok {
+		conn.SetDeadline(time.Time{})
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		defer stop()
+	}
+	out, err = readShellOutput(conn)
+	if err != nil && ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	return out, err
 }
 
 // Shell runs a shell command on the specified device and returns its output.
@@ -162,6 +181,23 @@ func (c *Client) TrackDevices(ctx context.Context) (net.Conn, error) {
 	return conn, nil
 }
 
+// HostFeatures returns the features the ADB server supports, such as
+// "shell_v2" and "cmd".
+func (c *Client) HostFeatures(ctx context.Context) ([]string, error) {
+	resp, err := c.Command(ctx, "host:host-features")
+	if err != nil {
+		return nil, fmt.Errorf("host-features: %w", err)
+	}
+	return parseFeatures(resp), nil
+}
+
+// ReconnectOffline asks the server to reconnect every offline or
+// unauthorized device, which makes devices ask for authorization again. It
+// returns the server's summary.
+func (c *Client) ReconnectOffline(ctx context.Context) (string, error) {
+	return c.Command(ctx, "host:reconnect-offline")
+}
+
 // ServerVersion returns the ADB server version.
 func (c *Client) ServerVersion(ctx context.Context) (string, error) {
 	return c.Command(ctx, "host:version")
@@ -0,0 +1,94 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// RebootTarget selects what a device reboots into.
+type RebootTarget string
+
+const (
+	RebootSystem     RebootTarget = ""
+	RebootBootloader RebootTarget = "bootloader"
+	RebootRecovery   RebootTarget = "recovery"
+)
+
+// Reboot reboots the device into target, like `adb reboot`. It returns
+// once adbd accepted the request; the device then drops off the tracker
+// until it is back.
+func (c *Client) Reboot(ctx context.Context, serial string, target RebootTarget) (err error) {
+	cmd := "reboot:" + string(target)
+	defer func(start time.Time) {
+		c.audit(serial, cmd, start, 0, ShellExitUnknown, err)
+	}(time.Now())
+
+	conn, err := c.openTransport(ctx, serial)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := writeCommand(conn, cmd); err != nil {
+		return fmt.Errorf("writing device command %q: %w", cmd, err)
+	}
+	if err := readStatus(conn, cmd); err != nil {
+		return err
+	}
+	// adbd closes the stream once the reboot is under way; whatever ends
+	// it (EOF, a reset, the deadline) the request went through.
+	conn.SetDeadline(handshakeDeadline(ctx))
+	io.Copy(io.Discard, conn)
+	return nil
+}
+
+// Root restarts adbd as root, like `adb root`, and returns its message.
+// Production builds refuse with ErrNotPermitted.
+func (c *Client) Root(ctx context.Context, serial string) (string, error) {
+	return c.controlCommand(ctx, serial, "root:")
+}
+
+// Unroot restarts adbd as the shell user, like `adb unroot`.
+func (c *Client) Unroot(ctx context.Context, serial string) (string, error) {
+	return c.controlCommand(ctx, serial, "unroot:")
+}
+
+// Remount remounts the system partitions read-write, like `adb remount`.
+// It needs adbd running as root; on devices with verified boot the message
+// may ask for a reboot before the change takes effect.
+func (c *Client) Remount(ctx context.Context, serial string) (string, error) {
+	return c.controlCommand(ctx, serial, "remount:")
+}
+
+// controlCommand runs an adbd service that answers with a status message,
+// turning refusals into errors. adbd may restart right after answering,
+// so the read is bounded even without a ctx deadline.
+func (c *Client) controlCommand(ctx context.Context, serial, cmd string) (string, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+	}
+	out, err := c.DeviceCommand(ctx, serial, cmd)
+	if err != nil {
+		return "", err
+	}
+	return out, controlError(cmd, out)
+}
+
+// controlError interprets the message of a control service: adbd answers
+// refusals with text, not FAIL.
+func controlError(cmd, out string) error {
+	lower := strings.ToLower(out)
+	name := strings.TrimSuffix(cmd, ":")
+	switch {
+	case strings.Contains(lower, "cannot run as root"), strings.Contains(lower, "not running as root"):
+		return fmt.Errorf("%s: %w: %s", name, ErrNotPermitted, out)
+	case strings.Contains(lower, "failed"), strings.Contains(lower, "error"):
+		return fmt.Errorf("%s: %w: %s", name, ErrCommandFailed, out)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package adb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestControlError(t *testing.T) {
+	tests := []struct {
+		cmd, out string
+		want     error
+	}{
+		{"root:", "restarting adbd as root", nil},
+		{"root:", "adbd is already running as root", nil},
+		{"root:", "adbd cannot run as root in production builds", ErrNotPermitted},
+		{"remount:", "Not running as root. Try \"adb root\" first.", ErrNotPermitted},
+		{"remount:", "remount succeeded", nil},
+		{"remount:", "remount of the / superblock failed: Permission denied", ErrCommandFailed},
+		{"unroot:", "restarting adbd as non root", nil},
+	}
+	for _, tt := range tests {
+		err := controlError(tt.cmd, tt.out)
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("controlError(%q, %q) = %v, want %v", tt.cmd, tt.out, err, tt.want)
+		}
+	}
+}
@@ -33,8 +33,20 @@ type Device struct {
 	Model     string      `json:"model,omitempty"`
 	DeviceTag string      `json:"device_tag,omitempty"`
 	Transport string      `json:"transport,omitempty"`
-	FirstSeen time.Time   `json:"first_seen"`
-	LastSeen  time.Time   `json:"last_seen"`
+	// USB is the port of a USB device, from devices -l; Link is how the
+	// device is attached.
+	USB  string `json:"usb,omitempty"`
+	Link Link   `json:"link,omitempty"`
+	// LatencyMs is the latest ADB round trip to the device, filled in by
+	// the bridge's link probe.
+	LatencyMs float64 `json:"latency_ms,omitempty"`
+	// Class is the form factor, filled in by the bridge once detected.
+	Class DeviceClass `json:"device_class,omitempty"`
+	// Features are the ADB features the device and server share, such as
+	// shell_v2 and sendrecv_v2, filled in by the bridge once read.
+	Features  []string  `json:"features,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
 }
 
 // String returns a human-readable representation of the device.
@@ -42,6 +54,13 @@ func (d Device) String() string {
 	return fmt.Sprintf("%s [%s] model=%s", d.Serial, d.State, d.Model)
 }
 
+// IsNetwork reports whether the device is connected over the network: its
+// serial is a host:port address, or an mDNS service name for wireless
+// debugging. Its serial then changes with its address.
+func (d Device) IsNetwork() bool {
+	return strings.Contains(d.Serial, ":") || strings.Contains(d.Serial, "._adb")
+}
+
 // ParseDeviceList parses the output format of ADB's track-devices-l or devices -l.
 // Each line: <serial>\t<state>\t<properties...>
 // Properties are key:value pairs separated by spaces.
@@ -95,8 +114,11 @@ func parseDeviceLine(line string, now time.Time) Device {
 			dev.DeviceTag = value
 		case "transport_id":
 			dev.Transport = value
+		case "usb":
+			dev.USB = value
 		}
 	}
+	dev.Link = LinkOf(dev.Serial, dev.USB)
 
 	return dev
 }
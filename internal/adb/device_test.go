@@ -112,3 +112,70 @@ func TestDevice_String(t *testing.T) {
 		t.Errorf("unexpected String(): %q", s)
 	}
 }
+
+func TestDevice_IsNetwork(t *testing.T) {
+	for serial, want := range map[string]bool{
+		"ABC123":           false,
+		"emulator-5554":    false,
+		"192.168.1.5:5555": true,
+		"[fe80::1]:5555":   true,
+		"adb-ABC123-x1y2z3._adb-tls-connect._tcp": true,
+	} {
+		if got := (Device{Serial: serial}).IsNetwork(); got != want {
+			t.Errorf("IsNetwork(%q) = %v, want %v", serial, got, want)
+		}
+	}
+}
+
+func TestLinkOf(t *testing.T) {
+	input := `HVA0T18B14001251       device usb:1-1.2 product:flame model:Pixel_4 device:flame transport_id:2
+ABC123                 device product:x model:y device:z transport_id:3
+emulator-5554          device product:sdk model:sdk device:emu64xa transport_id:1
+192.168.1.100:5555     device product:flame model:Pixel_4 device:flame transport_id:4
+adb-ABC123-x1y2z3._adb-tls-connect._tcp device transport_id:5`
+
+	want := []struct {
+		link Link
+		usb  string
+	}{
+		{LinkUSB, "1-1.2"},
+		{LinkUSB, ""},
+		{LinkEmulator, ""},
+		{LinkTCP, ""},
+		{LinkTCP, ""},
+	}
+	devices := ParseDeviceList(input)
+	if len(devices) != len(want) {
+		t.Fatalf("expected %d devices, got %d", len(want), len(devices))
+	}
+	for i, d := range devices {
+		if d.Link != want[i].link || d.USB != want[i].usb {
+			t.Errorf("%s: link %q usb %q, want %q %q", d.Serial, d.Link, d.USB, want[i].link, want[i].usb)
+		}
+	}
+	if !LinkTCP.IsWireless() || LinkUSB.IsWireless() || LinkOf("", "") != LinkUnknown {
+		t.Error("IsWireless or empty serial misclassified")
+	}
+}
+
+func TestClassifyDevice(t *testing.T) {
+	tests := []struct {
+		name  string
+		props map[string]string
+		want  DeviceClass
+	}{
+		{"phone", map[string]string{"ro.build.characteristics": "nosdcard", "ro.product.device": "flame"}, ClassPhone},
+		{"tablet", map[string]string{"ro.build.characteristics": "tablet,nosdcard"}, ClassTablet},
+		{"tv", map[string]string{"ro.build.characteristics": "tv"}, ClassTV},
+		{"watch", map[string]string{"ro.build.characteristics": "nosdcard,watch"}, ClassWatch},
+		{"automotive", map[string]string{"ro.build.characteristics": "automotive"}, ClassAutomotive},
+		{"arc++", map[string]string{"ro.boot.container": "1", "ro.build.characteristics": "tablet"}, ClassChromeOS},
+		{"arcvm", map[string]string{"ro.boot.hardware": "bertha_x86_64"}, ClassChromeOS},
+		{"no props", map[string]string{}, ClassUnknown},
+	}
+	for _, tt := range tests {
+		if got := ClassifyDevice(tt.props); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package adb
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var (
@@ -15,11 +16,26 @@ var (
 	// ErrDeviceNotFound indicates the target device is not connected.
 	ErrDeviceNotFound = errors.New("device not found")
 
+	// ErrDeviceOffline indicates the target device is connected but offline.
+	ErrDeviceOffline = errors.New("device offline")
+
+	// ErrDeviceUnauthorized indicates the device has not accepted this
+	// host's ADB key.
+	ErrDeviceUnauthorized = errors.New("device unauthorized")
+
 	// ErrCommandFailed indicates the ADB server rejected a command.
 	ErrCommandFailed = errors.New("adb command failed")
 
 	// ErrConnectionClosed indicates the connection was closed unexpectedly.
 	ErrConnectionClosed = errors.New("connection closed")
+
+	// ErrShellV2Unsupported indicates the device rejected the shell v2
+	// service (adbd older than Android 7.0).
+	ErrShellV2Unsupported = errors.New("device does not support shell v2")
+
+	// ErrNotPermitted indicates the device refused a root-only service,
+	// e.g. `adb root` on a production build or remount without root.
+	ErrNotPermitted = errors.New("not permitted on this device")
 )
 
 // ServerError wraps an error returned by the ADB server with the server's message.
@@ -35,3 +51,38 @@ func (e *ServerError) Error() string {
 func (e *ServerError) Unwrap() error {
 	return ErrCommandFailed
 }
+
+// Is matches the device errors the server's message reports, e.g.
+// "device 'emulator-5554' not found" matches ErrDeviceNotFound.
+func (e *ServerError) Is(target error) bool {
+	msg := strings.ToLower(e.Message)
+	switch target {
+	case ErrDeviceNotFound:
+		return strings.HasPrefix(msg, "device") && strings.Contains(msg, "not found") ||
+			strings.HasPrefix(msg, "no devices")
+	case ErrDeviceOffline:
+		return strings.HasPrefix(msg, "device offline")
+	case ErrDeviceUnauthorized:
+		return strings.HasPrefix(msg, "device unauthorized")
+	}
+	return false
+}
+
+// ExitError reports a shell command that ran but exited with a non-zero
+// status. Stderr holds the tail of its error output.
+type ExitError struct {
+	Command  string
+	ExitCode int
+	Stderr   string
+}
+
+func (e *ExitError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("command %q exited with status %d", e.Command, e.ExitCode)
+	}
+	return fmt.Sprintf("command %q exited with status %d: %s", e.Command, e.ExitCode, e.Stderr)
+}
+
+func (e *ExitError) Unwrap() error {
+	return ErrCommandFailed
+}
@@ -0,0 +1,67 @@
+package adb
+
+import (
+	"context"
+	"slices"
+)
+
+// Device features, as listed by host-serial:<serial>:features, that change
+// how the client talks to a device.
+const (
+	// FeatureShellV2 is the shell protocol with separate stdout, stderr and
+	// exit code.
+	FeatureShellV2 = "shell_v2"
+	// FeatureCmd is the cmd binary, a faster front end to system services
+	// than pm or am.
+	FeatureCmd = "cmd"
+	// FeatureStatV2 is the sync STA2/LST2 requests, with 64-bit sizes.
+	FeatureStatV2 = "stat_v2"
+	// FeatureSendRecvV2 is the sync SND2/RCV2 requests.
+	FeatureSendRecvV2 = "sendrecv_v2"
+)
+
+// Features returns the features the device and the ADB server both
+// support. They are read with DeviceFeatures on first use and cached until
+// ForgetDevice; a failed read is not cached.
+func (c *Client) Features(ctx context.Context, serial string) ([]string, error) {
+	if f, ok := c.features.Load(serial); ok {
+		return f.([]string), nil
+	}
+	features, err := c.DeviceFeatures(ctx, serial)
+	if err != nil {
+		return nil, err
+	}
+	if features == nil {
+		features = []string{}
+	}
+	c.features.Store(serial, features)
+	return features, nil
+}
+
+// ForgetDevice drops what the client learned about serial's protocols, to
+// be learned again: its features and whether it rejected shell v2. Call it
+// when the device connects or changes state, since a reboot, an update or
+// the ADB server behind it may change them.
+func (c *Client) ForgetDevice(serial string) {
+	c.features.Delete(serial)
+	c.legacyShell.Delete(serial)
+}
+
+// useShellV2 reports whether to try shell v2 on serial: unless it rejected
+// it before or its features leave it out. Devices whose features cannot be
+// read are tried, and fall back when they reject it.
+func (c *Client) useShellV2(ctx context.Context, serial string) bool {
+	if _, legacy := c.legacyShell.Load(serial); legacy {
+		return false
+	}
+	features, err := c.Features(ctx, serial)
+	return err != nil || slices.Contains(features, FeatureShellV2)
+}
+
+// useSyncV2 reports whether serial's features list the v2 sync transfer
+// requests. A device whose features cannot be read gets v1, which every
+// device speaks.
+func (c *Client) useSyncV2(ctx context.Context, serial string) bool {
+	features, err := c.Features(ctx, serial)
+	return err == nil && slices.Contains(features, FeatureSendRecvV2)
+}
@@ -0,0 +1,89 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// featureServer answers every host-serial:<serial>:features request with
+// features and counts them.
+func featureServer(t *testing.T, features string) (string, *atomic.Int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var reads atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if _, err := ReadLengthPrefixed(conn); err == nil {
+				reads.Add(1)
+				fmt.Fprintf(conn, "%s%04x%s", wireOkay, len(features), features)
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), &reads
+}
+
+func TestFeatures_Cached(t *testing.T) {
+	addr, reads := featureServer(t, "cmd,stat_v2,sendrecv_v2\n")
+	c := NewClient(addr)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		features, err := c.Features(ctx, "dev1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(features, []string{"cmd", "stat_v2", "sendrecv_v2"}) {
+			t.Fatalf("features = %v", features)
+		}
+	}
+	if n := reads.Load(); n != 1 {
+		t.Errorf("features read %d times, want 1", n)
+	}
+	if c.useShellV2(ctx, "dev1") {
+		t.Error("shell v2 chosen without shell_v2")
+	}
+	if !c.useSyncV2(ctx, "dev1") {
+		t.Error("sync v1 chosen despite sendrecv_v2")
+	}
+
+	c.ForgetDevice("dev1")
+	if _, err := c.Features(ctx, "dev1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := reads.Load(); n != 2 {
+		t.Errorf("features read %d times after ForgetDevice, want 2", n)
+	}
+}
+
+func TestFeatures_Unreadable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(ln.Addr().String())
+	ln.Close()
+
+	ctx := context.Background()
+	if _, err := c.Features(ctx, "dev1"); err == nil {
+		t.Fatal("expected an error without a server")
+	}
+	if !c.useShellV2(ctx, "dev1") {
+		t.Error("shell v2 not tried when features are unknown")
+	}
+	if c.useSyncV2(ctx, "dev1") {
+		t.Error("sync v2 chosen when features are unknown")
+	}
+}
@@ -0,0 +1,156 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func FuzzReadLengthPrefixed(f *testing.F) {
+	for _, seed := range []string{"000chello, world", "0000", "ffff", "000ahello", "zzzz", "00", ""} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bytes.NewReader(data)
+		got, err := ReadLengthPrefixed(r)
+		if err != nil {
+			if !errors.Is(err, ErrProtocol) && !errors.Is(err, io.EOF) {
+				t.Fatalf("error %v wraps neither ErrProtocol nor io.EOF", err)
+			}
+			return
+		}
+		if consumed := len(data) - r.Len(); consumed != 4+len(got) {
+			t.Fatalf("consumed %d bytes for a %d-byte payload", consumed, len(got))
+		}
+	})
+}
+
+func FuzzReadStatus(f *testing.F) {
+	for _, seed := range []string{"OKAY", "FAIL0005error", "FAIL00", "FAIL", "BAAD", "OK", ""} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		err := readStatus(bytes.NewReader(data), "host:test")
+		if err == nil {
+			if !bytes.HasPrefix(data, []byte(wireOkay)) {
+				t.Fatalf("accepted %q", data)
+			}
+			return
+		}
+		if !errors.Is(err, ErrProtocol) && !errors.Is(err, ErrConnectionClosed) && !errors.Is(err, ErrCommandFailed) {
+			t.Fatalf("unclassified error: %v", err)
+		}
+	})
+}
+
+func FuzzParseDeviceList(f *testing.F) {
+	for _, seed := range []string{
+		"emulator-5554\tdevice product:sdk model:Pixel device:generic transport_id:1\n",
+		"R58M123\tunauthorized usb:1-1 transport_id:2\n0123\tno permissions (udev)\n",
+		"\t\t\n:\n x",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data string) {
+		for _, d := range ParseDeviceList(data) {
+			if d.Serial == "" || strings.ContainsAny(d.Serial, " \t\n\r") {
+				t.Fatalf("bad serial %q", d.Serial)
+			}
+			if parseState(string(d.State)) != d.State && d.State != StateNoPermission {
+				t.Fatalf("unknown state %q", d.State)
+			}
+		}
+	})
+}
+
+func TestReadLengthPrefixed_Truncated(t *testing.T) {
+	for _, input := range []string{"00", "000ahello"} {
+		_, err := ReadLengthPrefixed(strings.NewReader(input))
+		if !errors.Is(err, ErrProtocol) {
+			t.Errorf("%q: got %v, want ErrProtocol", input, err)
+		}
+	}
+	// A clean end between messages is io.EOF, not a protocol error.
+	if _, err := ReadLengthPrefixed(strings.NewReader("")); !errors.Is(err, io.EOF) || errors.Is(err, ErrProtocol) {
+		t.Errorf("empty stream: got %v, want io.EOF", err)
+	}
+}
+
+func TestReadStatus_Classification(t *testing.T) {
+	tests := []struct {
+		input string
+		want  error
+	}{
+		{"", ErrConnectionClosed},
+		{"OK", ErrProtocol},
+		{"FAIL00", ErrProtocol},
+		{"FAIL000ashort", ErrProtocol},
+		{"FAIL0003bad", ErrCommandFailed},
+	}
+	for _, tt := range tests {
+		if err := readStatus(strings.NewReader(tt.input), "host:test"); !errors.Is(err, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.input, err, tt.want)
+		}
+	}
+}
+
+// fakeServer accepts one connection, answers each request with OKAY and
+// then stays silent until the test ends.
+func fakeServer(t *testing.T, answers int) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		ln.Close()
+	})
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for i := 0; i < answers; i++ {
+			if _, err := ReadLengthPrefixed(conn); err != nil {
+				return
+			}
+			fmt.Fprint(conn, wireOkay)
+		}
+		<-done
+	}()
+	return ln.Addr().String()
+}
+
+func TestRawCommand_SilentServer(t *testing.T) {
+	c := NewClient(fakeServer(t, 0))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := c.Command(ctx, "host:version"); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("returned after %s", elapsed)
+	}
+}
+
+func TestDeviceCommand_CancelWithoutDeadline(t *testing.T) {
+	c := NewClient(fakeServer(t, 2))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	_, err := c.Shell(ctx, "dev1", "sleep 1000")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
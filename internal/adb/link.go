@@ -0,0 +1,67 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Link is how a device is attached to the ADB server.
+type Link string
+
+const (
+	LinkUnknown Link = ""
+	// LinkUSB is a device on a USB cable.
+	LinkUSB Link = "usb"
+	// LinkTCP is a device reached over TCP/IP: adb connect, or wireless
+	// debugging found over mDNS. Its latency varies with the network, and
+	// captures may stall while it roams.
+	LinkTCP Link = "tcp"
+	// LinkEmulator is an emulator on the ADB server's host.
+	LinkEmulator Link = "emulator"
+)
+
+// IsWireless reports whether the link runs over the network.
+func (l Link) IsWireless() bool {
+	return l == LinkTCP
+}
+
+// LinkOf returns the link of a device from its serial and the usb property
+// of devices -l, which names the USB port it is plugged into. A serial that
+// is neither an address nor an emulator's is a USB serial number, even on
+// hosts whose ADB server omits the usb property.
+func LinkOf(serial, usb string) Link {
+	switch {
+	case serial == "":
+		return LinkUnknown
+	case usb != "":
+		return LinkUSB
+	case strings.HasPrefix(serial, "emulator-"):
+		return LinkEmulator
+	case Device{Serial: serial}.IsNetwork():
+		return LinkTCP
+	default:
+		return LinkUSB
+	}
+}
+
+// DeviceFeatures returns the features the device and the ADB server both
+// support, such as "shell_v2" and "cmd", from host-serial:<serial>:features.
+func (c *Client) DeviceFeatures(ctx context.Context, serial string) ([]string, error) {
+	resp, err := c.Command(ctx, fmt.Sprintf("host-serial:%s:features", serial))
+	if err != nil {
+		return nil, fmt.Errorf("features of %s: %w", serial, err)
+	}
+	return parseFeatures(resp), nil
+}
+
+// parseFeatures splits a comma-separated feature list.
+func parseFeatures(resp string) []string {
+	var features []string
+	for _, f := range strings.Split(strings.TrimSpace(resp), ",") {
+		if f != "" {
+			features = append(features, f)
+		}
+	}
+	return features
+}
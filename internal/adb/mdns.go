@@ -0,0 +1,97 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// mDNS service types advertised by adbd.
+const (
+	// MDNSConnect is a device listening for TCP connections (adb tcpip).
+	MDNSConnect = "_adb._tcp"
+	// MDNSTLSConnect is a device with wireless debugging on that this host
+	// has paired with or may connect to.
+	MDNSTLSConnect = "_adb-tls-connect._tcp"
+	// MDNSTLSPairing is a device showing a pairing code; it must be paired
+	// with `adb pair` before it can be connected.
+	MDNSTLSPairing = "_adb-tls-pairing._tcp"
+)
+
+// MDNSService is a device service discovered by the ADB server's mDNS
+// browser.
+type MDNSService struct {
+	// Instance is the advertised name, "adb-<serial>-<suffix>" for
+	// wireless debugging.
+	Instance string `json:"instance"`
+	Type     string `json:"type"`
+	// Addr is the host:port to connect or pair to.
+	Addr string `json:"addr"`
+	// Serial is the device serial read from Instance, if it has one.
+	Serial string `json:"serial,omitempty"`
+}
+
+// Pairing reports whether the service only accepts pairing.
+func (s MDNSService) Pairing() bool {
+	return s.Type == MDNSTLSPairing
+}
+
+// MDNSServices lists the services the ADB server has discovered over mDNS
+// (`adb mdns services`). Servers with mDNS disabled list none.
+func (c *Client) MDNSServices(ctx context.Context) ([]MDNSService, error) {
+	resp, err := c.Command(ctx, "host:mdns:services")
+	if err != nil {
+		return nil, fmt.Errorf("mdns services: %w", err)
+	}
+	return ParseMDNSServices(resp), nil
+}
+
+// ParseMDNSServices parses the "instance\ttype\taddr" lines of the
+// host:mdns:services response.
+func ParseMDNSServices(resp string) []MDNSService {
+	var services []MDNSService
+	for _, line := range strings.Split(resp, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		s := MDNSService{
+			Instance: fields[0],
+			Type:     strings.TrimSuffix(fields[1], "."),
+			Addr:     fields[2],
+		}
+		if rest, ok := strings.CutPrefix(s.Instance, "adb-"); ok {
+			if i := strings.LastIndexByte(rest, '-'); i > 0 {
+				s.Serial = rest[:i]
+			}
+		}
+		services = append(services, s)
+	}
+	return services
+}
+
+// Connect asks the server to connect to a device listening on addr
+// (host:port), as `adb connect` does, and returns the server's message.
+// The server answers failures as text, which are returned as errors.
+func (c *Client) Connect(ctx context.Context, addr string) (string, error) {
+	resp, err := c.Command(ctx, "host:connect:"+addr)
+	if err != nil {
+		return "", fmt.Errorf("connect %s: %w", addr, err)
+	}
+	resp = strings.TrimSpace(resp)
+	if err := connectError(addr, resp); err != nil {
+		return "", err
+	}
+	return resp, nil
+}
+
+// connectError maps the text of a failed host:connect to an error, or
+// returns nil for "connected to ..." and "already connected to ...".
+func connectError(addr, resp string) error {
+	for _, prefix := range []string{"failed", "cannot", "unable"} {
+		if strings.HasPrefix(resp, prefix) {
+			return &ServerError{Command: "host:connect:" + addr, Message: resp}
+		}
+	}
+	return nil
+}
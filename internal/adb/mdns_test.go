@@ -0,0 +1,41 @@
+package adb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMDNSServices(t *testing.T) {
+	resp := "adb-R58M123ABC-vWgJpq\t_adb-tls-connect._tcp.\t192.168.1.20:37123\n" +
+		"adb-R58M123ABC-vWgJpq\t_adb-tls-pairing._tcp.\t192.168.1.20:41234\n" +
+		"Pixel_7\t_adb._tcp.\t192.168.1.21:5555\n" +
+		"garbage line\n"
+	got := ParseMDNSServices(resp)
+	if len(got) != 3 {
+		t.Fatalf("got %d services: %+v", len(got), got)
+	}
+	if s := got[0]; s.Type != MDNSTLSConnect || s.Addr != "192.168.1.20:37123" || s.Serial != "R58M123ABC" || s.Pairing() {
+		t.Errorf("connect service = %+v", s)
+	}
+	if !got[1].Pairing() {
+		t.Errorf("pairing service = %+v", got[1])
+	}
+	if s := got[2]; s.Type != MDNSConnect || s.Serial != "" {
+		t.Errorf("tcp service = %+v", s)
+	}
+}
+
+func TestConnectError(t *testing.T) {
+	for resp, fails := range map[string]bool{
+		"connected to 192.168.1.20:37123":                              false,
+		"already connected to 192.168.1.20:37123":                      false,
+		"failed to connect to '192.168.1.20:5555': Connection refused": true,
+		"cannot connect to 192.168.1.20:5555: No route to host (113)":  true,
+		"failed to authenticate to 192.168.1.20:37123":                 true,
+	} {
+		err := connectError("192.168.1.20:5555", resp)
+		if (err != nil) != fails || fails && !errors.Is(err, ErrCommandFailed) {
+			t.Errorf("connectError(%q) = %v", resp, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// GetDeviceProps reads every system property of a device with a single
+// getprop and returns those named, or all of them if none are. Properties
+// the device does not have are left out.
+func (c *Client) GetDeviceProps(ctx context.Context, serial string, props ...string) (map[string]string, error) {
+	out, err := c.Shell(ctx, serial, "getprop")
+	if err != nil {
+		return nil, fmt.Errorf("getprop on %s: %w", serial, err)
+	}
+	all := ParseGetprop(out)
+	if len(props) == 0 {
+		return all, nil
+	}
+	want := make(map[string]string, len(props))
+	for _, p := range props {
+		if v, ok := all[p]; ok {
+			want[p] = v
+		}
+	}
+	return want, nil
+}
+
+// ParseGetprop parses the "[key]: [value]" lines getprop prints without
+// arguments. A value may span lines; lines that are not part of an entry
+// are skipped.
+func ParseGetprop(out string) map[string]string {
+	props := make(map[string]string)
+	out = strings.ReplaceAll(out, "\r\n", "\n")
+	for len(out) > 0 {
+		line, rest, _ := strings.Cut(out, "\n")
+		out = rest
+		key, value, ok := strings.Cut(line, "]: [")
+		if !ok || !strings.HasPrefix(key, "[") {
+			continue
+		}
+		// A value ends at the first line ending in "]".
+		for !strings.HasSuffix(value, "]") && out != "" {
+			line, out, _ = strings.Cut(out, "\n")
+			value += "\n" + line
+		}
+		props[key[1:]] = strings.TrimSuffix(value, "]")
+	}
+	return props
+}
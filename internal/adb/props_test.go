@@ -0,0 +1,34 @@
+package adb
+
+import "testing"
+
+func TestParseGetprop(t *testing.T) {
+	out := "[ro.build.version.sdk]: [34]\r\n" +
+		"[ro.product.model]: [Pixel 8]\n" +
+		"[persist.sys.locale]: []\n" +
+		"[ro.boot.motd]: [first\nsecond]\n" +
+		"garbage line\n" +
+		"[ro.product.device]: [shiba]"
+	got := ParseGetprop(out)
+	want := map[string]string{
+		"ro.build.version.sdk": "34",
+		"ro.product.model":     "Pixel 8",
+		"persist.sys.locale":   "",
+		"ro.boot.motd":         "first\nsecond",
+		"ro.product.device":    "shiba",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d props, want %d: %v", len(got), len(want), got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestParseGetprop_Empty(t *testing.T) {
+	if got := ParseGetprop(""); len(got) != 0 {
+		t.Errorf("got %v, want none", got)
+	}
+}
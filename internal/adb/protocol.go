@@ -2,6 +2,7 @@ package adb
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -21,10 +22,18 @@ func writeCommand(w io.Writer, cmd string) error {
 }
 
 // readStatus reads the 4-byte status response (OKAY or FAIL).
-// On FAIL it reads the accompanying error message.
+// On FAIL it reads the accompanying error message. A connection that closes
+// before a full status arrives yields ErrConnectionClosed; anything other
+// than OKAY/FAIL, or a malformed FAIL message, yields ErrProtocol.
 func readStatus(r io.Reader, cmd string) error {
 	status := make([]byte, 4)
-	if _, err := io.ReadFull(r, status); err != nil {
+	if n, err := io.ReadFull(r, status); err != nil {
+		if n == 0 && errors.Is(err, io.EOF) {
+			return fmt.Errorf("reading status for %q: %w", cmd, ErrConnectionClosed)
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("%w: truncated status %q for %q", ErrProtocol, status[:n], cmd)
+		}
 		return fmt.Errorf("reading status: %w", err)
 	}
 
@@ -34,19 +43,30 @@ func readStatus(r io.Reader, cmd string) error {
 	case wireFail:
 		msg, err := ReadLengthPrefixed(r)
 		if err != nil {
-			return fmt.Errorf("reading fail message: %w", err)
+			if !errors.Is(err, ErrProtocol) {
+				err = fmt.Errorf("%w: %w", ErrProtocol, err)
+			}
+			return fmt.Errorf("reading fail message for %q: %w", cmd, err)
 		}
 		return &ServerError{Command: cmd, Message: msg}
 	default:
-		return fmt.Errorf("%w: unexpected status %q", ErrProtocol, status)
+		return fmt.Errorf("%w: unexpected status %q for %q", ErrProtocol, status, cmd)
 	}
 }
 
 // ReadLengthPrefixed reads a 4-hex-digit length prefix and then that many bytes.
 // Exported for use by the tracker package which reads from a raw ADB connection.
+//
+// The 4-digit prefix bounds a payload, and so the allocation, at 64 KiB.
+// A stream that ends cleanly before the prefix returns an error wrapping
+// io.EOF. A stream cut inside the prefix or payload, or a prefix that is not
+// hex, returns an error wrapping ErrProtocol.
 func ReadLengthPrefixed(r io.Reader) (string, error) {
 	lengthBuf := make([]byte, 4)
-	if _, err := io.ReadFull(r, lengthBuf); err != nil {
+	if n, err := io.ReadFull(r, lengthBuf); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return "", fmt.Errorf("%w: truncated length prefix %q: %w", ErrProtocol, lengthBuf[:n], err)
+		}
 		return "", fmt.Errorf("reading length prefix: %w", err)
 	}
 
@@ -71,7 +91,10 @@ func ReadLengthPrefixed(r io.Reader) (string, error) {
 	}
 
 	payload := make([]byte, length)
-	if _, err := io.ReadFull(r, payload); err != nil {
+	if n, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return "", fmt.Errorf("%w: truncated payload (%d of %d bytes): %w", ErrProtocol, n, length, io.ErrUnexpectedEOF)
+		}
 		return "", fmt.Errorf("reading payload (%d bytes): %w", length, err)
 	}
 	return string(payload), nil
@@ -2,8 +2,10 @@ package adb
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 	"testing"
 )
@@ -102,6 +104,30 @@ func TestReadStatus_FAIL(t *testing.T) {
 	}
 }
 
+func TestServerError_Is(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want error
+	}{
+		{"device 'emulator-5554' not found", ErrDeviceNotFound},
+		{"no devices/emulators found", ErrDeviceNotFound},
+		{"device offline", ErrDeviceOffline},
+		{"device unauthorized.\nThis adb server's $ADB_VENDOR_KEYS is not set", ErrDeviceUnauthorized},
+		{"closed", nil},
+	}
+	for _, tt := range tests {
+		err := fmt.Errorf("wrapped: %w", &ServerError{Command: "host:transport:x", Message: tt.msg})
+		for _, target := range []error{ErrDeviceNotFound, ErrDeviceOffline, ErrDeviceUnauthorized} {
+			if got := errors.Is(err, target); got != (target == tt.want) {
+				t.Errorf("%q: errors.Is(%v) = %v", tt.msg, target, got)
+			}
+		}
+		if !errors.Is(err, ErrCommandFailed) {
+			t.Errorf("%q: not ErrCommandFailed", tt.msg)
+		}
+	}
+}
+
 func TestReadStatus_InvalidStatus(t *testing.T) {
 	r := strings.NewReader("BAAD")
 	err := readStatus(r, "test")
@@ -166,3 +192,26 @@ func TestReadLengthPrefixed_ReadError(t *testing.T) {
 		t.Fatal("expected error")
 	}
 }
+
+func BenchmarkReadLengthPrefixed(b *testing.B) {
+	corpus, err := os.ReadFile("testdata/track_devices.bin")
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := bytes.NewReader(corpus)
+
+	b.SetBytes(int64(len(corpus)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(corpus)
+		for {
+			if _, err := ReadLengthPrefixed(r); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				b.Fatal(err)
+			}
+		}
+	}
+}
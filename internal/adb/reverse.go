@@ -0,0 +1,41 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Reverse sets up a reverse forward on the device, like `adb reverse`:
+// connections to remote on the device (e.g. "tcp:8080") are tunnelled to
+// local on the host. An existing forward of remote is replaced.
+func (c *Client) Reverse(ctx context.Context, serial, remote, local string) error {
+	return c.reverseCommand(ctx, serial, fmt.Sprintf("reverse:forward:%s;%s", remote, local))
+}
+
+// KillReverse removes the reverse forward of remote on the device.
+func (c *Client) KillReverse(ctx context.Context, serial, remote string) error {
+	return c.reverseCommand(ctx, serial, "reverse:killforward:"+remote)
+}
+
+// reverseCommand runs a reverse: service. The first status acknowledges
+// that the service opened, the second that the device applied the request.
+func (c *Client) reverseCommand(ctx context.Context, serial, cmd string) (err error) {
+	defer func(start time.Time) {
+		c.audit(serial, cmd, start, 0, ShellExitUnknown, err)
+	}(time.Now())
+
+	conn, err := c.openTransport(ctx, serial)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := writeCommand(conn, cmd); err != nil {
+		return fmt.Errorf("writing device command %q: %w", cmd, err)
+	}
+	if err := readStatus(conn, cmd); err != nil {
+		return err
+	}
+	return readStatus(conn, cmd)
+}
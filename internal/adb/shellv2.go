@@ -0,0 +1,419 @@
+package adb
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Shell protocol v2 packet IDs (system/core/adb/shell_protocol.h).
+// Every packet is a 1-byte ID, a 4-byte little-endian length and the data.
+const (
+	ShellStdin      byte = 0
+	ShellStdout     byte = 1
+	ShellStderr     byte = 2
+	ShellExit       byte = 3
+	ShellCloseStdin byte = 4
+	ShellWindowSize byte = 5
+)
+
+// maxShellPacket bounds the size of a single incoming shell packet. adbd
+// never sends more than its 32 KiB buffer at once.
+const maxShellPacket = 1 << 20
+
+// ShellPacket is one framed message of the shell v2 protocol.
+type ShellPacket struct {
+	ID   byte
+	Data []byte
+}
+
+// ShellV2Options configures a shell v2 session.
+type ShellV2Options struct {
+	// PTY allocates a pseudo-terminal on the device (interactive shells,
+	// window resizing). Without it stdout and stderr are kept separate.
+	PTY bool
+	// Term sets $TERM for PTY sessions, e.g. "xterm-256color".
+	Term string
+}
+
+// shellV2Service builds the service string, e.g. "shell,v2,pty,TERM=xterm:ls".
+func shellV2Service(command string, opts ShellV2Options) string {
+	args := []string{"shell", "v2"}
+	if opts.PTY {
+		args = append(args, "pty")
+		if opts.Term != "" {
+			args = append(args, "TERM="+opts.Term)
+		}
+	} else {
+		args = append(args, "raw")
+	}
+	return strings.Join(args, ",") + ":" + command
+}
+
+// writeShellPacket frames data as a shell v2 packet.
+func writeShellPacket(w io.Writer, id byte, data []byte) error {
+	buf := make([]byte, 5+len(data))
+	buf[0] = id
+	binary.LittleEndian.PutUint32(buf[1:5], uint32(len(data)))
+	copy(buf[5:], data)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readShellPacket reads one shell v2 packet.
+func readShellPacket(r io.Reader) (ShellPacket, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return ShellPacket{}, err
+	}
+	length := binary.LittleEndian.Uint32(hdr[1:5])
+	if length > maxShellPacket {
+		return ShellPacket{}, fmt.Errorf("%w: shell packet of %d bytes", ErrProtocol, length)
+	}
+	pkt := ShellPacket{ID: hdr[0], Data: make([]byte, length)}
+	if _, err := io.ReadFull(r, pkt.Data); err != nil {
+		return ShellPacket{}, fmt.Errorf("reading shell packet: %w", err)
+	}
+	return pkt, nil
+}
+
+// ShellExitUnknown is the exit code reported when the device only speaks
+// the legacy shell protocol, which does not carry exit status.
+const ShellExitUnknown = -1
+
+// maxShellStderr bounds the stderr kept by ShellSession.Read.
+const maxShellStderr = 4 << 10
+
+// ShellResult is the outcome of a command run with ShellV2.
+type ShellResult struct {
+	Command  string `json:"command"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+	// Truncated is set when ShellV2Limit stopped the command at its limit.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Err returns an *ExitError if the command exited with a non-zero status.
+// An unknown status (legacy shell) is not treated as a failure.
+func (r *ShellResult) Err() error {
+	if r.ExitCode == 0 || r.ExitCode == ShellExitUnknown {
+		return nil
+	}
+	return &ExitError{Command: r.Command, ExitCode: r.ExitCode, Stderr: strings.TrimSpace(r.Stderr)}
+}
+
+// ShellV2 runs command on the device and returns stdout, stderr and the exit
+// code separately. A non-zero exit is not an error; use ShellResult.Err. On
+// devices without shell v2, as their features say or found when they
+// reject it, it falls back to the legacy protocol, with stdout and stderr
+// merged into Stdout and ExitCode set to ShellExitUnknown.
+func (c *Client) ShellV2(ctx context.Context, serial, command string) (*ShellResult, error) {
+	return c.ShellV2Limit(ctx, serial, command, 0)
+}
+
+// ShellV2Limit is ShellV2 keeping at most limit bytes each of stdout and
+// stderr, or all of them if limit is zero. Output beyond that is never
+// buffered: the command is stopped, and the result has Truncated set and
+// ExitCode ShellExitUnknown.
+func (c *Client) ShellV2Limit(ctx context.Context, serial, command string, limit int) (*ShellResult, error) {
+	sess, err := c.OpenShellV2(ctx, serial, command, ShellV2Options{})
+	if err == nil {
+		defer sess.Close()
+		return sess.collect(command, limit)
+	}
+	if !errors.Is(err, ErrShellV2Unsupported) {
+		return nil, err
+	}
+	c.legacyShell.Store(serial, struct{}{})
+
+	if limit <= 0 {
+		out, err := c.Shell(ctx, serial, command)
+		if err != nil {
+			return nil, err
+		}
+		return &ShellResult{Command: command, Stdout: out, ExitCode: ShellExitUnknown}, nil
+	}
+	stream, err := c.OpenShellStream(ctx, serial, command)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	out := cappedBuffer{limit: limit}
+	if _, err := io.Copy(&out, stream); err != nil && !errors.Is(err, errOutputLimit) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("reading shell output: %w", err)
+	}
+	return &ShellResult{Command: command, Stdout: out.String(), ExitCode: ShellExitUnknown, Truncated: out.over}, nil
+}
+
+// errOutputLimit stops a copy into a full cappedBuffer.
+var errOutputLimit = errors.New("output limit reached")
+
+// cappedBuffer keeps the first limit bytes written to it, or all of them
+// if limit is zero. A write going over keeps what fits, sets over and
+// fails with errOutputLimit.
+type cappedBuffer struct {
+	buf   []byte
+	limit int
+	over  bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && len(b.buf)+len(p) > b.limit {
+		n := b.limit - len(b.buf)
+		b.buf = append(b.buf, p[:n]...)
+		b.over = true
+		return n, errOutputLimit
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// String returns the kept bytes with surrounding space trimmed. When the
+// output was cut, a UTF-8 sequence split by the cut is dropped.
+func (b *cappedBuffer) String() string {
+	out := b.buf
+	if b.over {
+		out = trimPartialRune(out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence from the end of b.
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// ShellSession is an open shell v2 connection to a device. Reads and writes
+// may happen concurrently from different goroutines.
+type ShellSession struct {
+	conn   net.Conn
+	cancel context.CancelFunc
+	wmu    sync.Mutex
+	audit  *auditedStream
+
+	// State for Read.
+	pending  []byte
+	stderr   []byte
+	exitCode int
+	exited   bool
+}
+
+// OpenShellV2 starts command (an interactive shell if empty) using the shell
+// v2 protocol. If the device rejects the service with a FAIL, or rejected
+// it before, or its features leave it out, the error wraps
+// ErrShellV2Unsupported. Other errors are returned as they are.
+func (c *Client) OpenShellV2(ctx context.Context, serial, command string, opts ShellV2Options) (*ShellSession, error) {
+	if !c.useShellV2(ctx, serial) {
+		return nil, fmt.Errorf("%w: %s", ErrShellV2Unsupported, serial)
+	}
+	start := time.Now()
+	service := shellV2Service(command, opts)
+	conn, err := c.openTransport(ctx, serial)
+	if err != nil {
+		c.audit(serial, service, start, 0, ShellExitUnknown, err)
+		return nil, err
+	}
+
+	if err := writeCommand(conn, service); err != nil {
+		conn.Close()
+		err = fmt.Errorf("writing shell command: %w", err)
+		c.audit(serial, service, start, 0, ShellExitUnknown, err)
+		return nil, err
+	}
+	// Only a FAIL answer means the device rejected shell v2; timeouts and
+	// broken connections say nothing about it. A device without shell v2
+	// is not audited here: the caller falls back to the legacy shell,
+	// which is.
+	if err := readStatus(conn, service); err != nil {
+		conn.Close()
+		var serverErr *ServerError
+		if errors.As(err, &serverErr) {
+			return nil, fmt.Errorf("%w: %w", ErrShellV2Unsupported, err)
+		}
+		c.audit(serial, service, start, 0, ShellExitUnknown, err)
+		return nil, err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		conn.SetDeadline(time.Time{})
+	}
+
+	sessCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		<-sessCtx.Done()
+		conn.Close()
+	}()
+	return &ShellSession{
+		conn:     conn,
+		cancel:   cancel,
+		exitCode: ShellExitUnknown,
+		audit:    c.newAuditedStream(serial, service, start),
+	}, nil
+}
+
+// openTransport dials the server and selects the device transport. The
+// handshake runs under ctx's deadline, or defaultDialTimeout if it has none.
+func (c *Client) openTransport(ctx context.Context, serial string) (net.Conn, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(handshakeDeadline(ctx))
+
+	hostCmd := fmt.Sprintf("host:transport:%s", serial)
+	if err := writeCommand(conn, hostCmd); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("writing transport: %w", err)
+	}
+	if err := readStatus(conn, hostCmd); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("selecting device %s: %w", serial, err)
+	}
+	return conn, nil
+}
+
+// ReadPacket returns the next packet from the device (stdout, stderr or
+// exit). It returns io.EOF once the device closes the session. Do not mix
+// ReadPacket with Read on the same session.
+func (s *ShellSession) ReadPacket() (ShellPacket, error) {
+	pkt, err := readShellPacket(s.conn)
+	if err == nil {
+		switch pkt.ID {
+		case ShellStdout, ShellStderr:
+			s.audit.read(len(pkt.Data))
+		case ShellExit:
+			if len(pkt.Data) > 0 {
+				s.audit.exited(int(pkt.Data[0]))
+			}
+		}
+	}
+	return pkt, err
+}
+
+// Read implements io.Reader over the command's stdout. Stderr is kept
+// aside (see Stderr) and Read returns io.EOF once the command exits, after
+// which ExitCode is valid.
+func (s *ShellSession) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.exited {
+			return 0, io.EOF
+		}
+		pkt, err := s.ReadPacket()
+		if err != nil {
+			return 0, err
+		}
+		switch pkt.ID {
+		case ShellStdout:
+			s.pending = pkt.Data
+		case ShellStderr:
+			s.stderr = append(s.stderr, pkt.Data...)
+			if len(s.stderr) > maxShellStderr {
+				s.stderr = s.stderr[len(s.stderr)-maxShellStderr:]
+			}
+		case ShellExit:
+			s.exited = true
+			if len(pkt.Data) > 0 {
+				s.exitCode = int(pkt.Data[0])
+			}
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// ExitCode returns the command's exit status once Read has returned io.EOF,
+// or ShellExitUnknown if the session ended without an exit packet.
+func (s *ShellSession) ExitCode() int {
+	return s.exitCode
+}
+
+// Stderr returns the tail of the command's error output seen by Read.
+func (s *ShellSession) Stderr() string {
+	return string(s.stderr)
+}
+
+// collect reads the session to completion into a ShellResult, keeping up
+// to limit bytes of each stream as ShellV2Limit describes.
+func (s *ShellSession) collect(command string, limit int) (*ShellResult, error) {
+	res := &ShellResult{Command: command, ExitCode: ShellExitUnknown}
+	stdout, stderr := cappedBuffer{limit: limit}, cappedBuffer{limit: limit}
+	for {
+		pkt, err := s.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading shell output: %w", err)
+		}
+		switch pkt.ID {
+		case ShellStdout:
+			stdout.Write(pkt.Data)
+		case ShellStderr:
+			stderr.Write(pkt.Data)
+		case ShellExit:
+			if len(pkt.Data) > 0 {
+				res.ExitCode = int(pkt.Data[0])
+			}
+		}
+		if stdout.over || stderr.over {
+			res.Truncated = true
+			break
+		}
+		if pkt.ID == ShellExit {
+			break
+		}
+	}
+	res.Stdout = stdout.String()
+	res.Stderr = stderr.String()
+	return res, nil
+}
+
+// Write sends p to the command's stdin.
+func (s *ShellSession) Write(p []byte) (int, error) {
+	if err := s.send(ShellStdin, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// CloseStdin signals end of input to the command.
+func (s *ShellSession) CloseStdin() error {
+	return s.send(ShellCloseStdin, nil)
+}
+
+// Resize changes the PTY window size. It has no effect on raw sessions.
+func (s *ShellSession) Resize(rows, cols int) error {
+	return s.send(ShellWindowSize, []byte(fmt.Sprintf("%dx%d,0x0", rows, cols)))
+}
+
+// Close terminates the session.
+func (s *ShellSession) Close() error {
+	s.audit.done()
+	s.cancel()
+	return s.conn.Close()
+}
+
+func (s *ShellSession) send(id byte, data []byte) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return writeShellPacket(s.conn, id, data)
+}
@@ -0,0 +1,197 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestShellV2Service(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		opts ShellV2Options
+		want string
+	}{
+		{"", ShellV2Options{PTY: true, Term: "xterm-256color"}, "shell,v2,pty,TERM=xterm-256color:"},
+		{"ls /sdcard", ShellV2Options{}, "shell,v2,raw:ls /sdcard"},
+		{"top", ShellV2Options{PTY: true}, "shell,v2,pty:top"},
+	}
+	for _, tt := range tests {
+		if got := shellV2Service(tt.cmd, tt.opts); got != tt.want {
+			t.Errorf("shellV2Service(%q): got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestShellPacket_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeShellPacket(&buf, ShellStdout, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeShellPacket(&buf, ShellExit, []byte{3}); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.Bytes()[:5]; !bytes.Equal(got, []byte{1, 5, 0, 0, 0}) {
+		t.Errorf("header: got %v", got)
+	}
+
+	pkt, err := readShellPacket(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkt.ID != ShellStdout || string(pkt.Data) != "hello" {
+		t.Errorf("first packet: %+v", pkt)
+	}
+	pkt, err = readShellPacket(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkt.ID != ShellExit || len(pkt.Data) != 1 || pkt.Data[0] != 3 {
+		t.Errorf("exit packet: %+v", pkt)
+	}
+	if _, err := readShellPacket(&buf); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestReadShellPacket_TooLarge(t *testing.T) {
+	hdr := []byte{ShellStdout, 0xff, 0xff, 0xff, 0x7f}
+	if _, err := readShellPacket(bytes.NewReader(hdr)); !errors.Is(err, ErrProtocol) {
+		t.Errorf("expected ErrProtocol, got %v", err)
+	}
+}
+
+func TestShellSession_Read(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		writeShellPacket(server, ShellStdout, []byte("listening\n"))
+		writeShellPacket(server, ShellStderr, []byte("tcpdump: permission denied\n"))
+		writeShellPacket(server, ShellStdout, []byte("done\n"))
+		writeShellPacket(server, ShellExit, []byte{1})
+		server.Close()
+	}()
+
+	s := &ShellSession{conn: client, cancel: func() {}, exitCode: ShellExitUnknown}
+	out, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "listening\ndone\n" {
+		t.Errorf("stdout: got %q", out)
+	}
+	if s.ExitCode() != 1 {
+		t.Errorf("exit code: got %d, want 1", s.ExitCode())
+	}
+	if s.Stderr() != "tcpdump: permission denied\n" {
+		t.Errorf("stderr: got %q", s.Stderr())
+	}
+}
+
+func TestShellResult_Err(t *testing.T) {
+	if err := (&ShellResult{ExitCode: 0}).Err(); err != nil {
+		t.Errorf("exit 0: %v", err)
+	}
+	if err := (&ShellResult{ExitCode: ShellExitUnknown}).Err(); err != nil {
+		t.Errorf("unknown exit: %v", err)
+	}
+
+	err := (&ShellResult{Command: "tcpdump", ExitCode: 2, Stderr: "no such device\n"}).Err()
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != 2 || exitErr.Stderr != "no such device" {
+		t.Fatalf("got %v", err)
+	}
+	if !errors.Is(err, ErrCommandFailed) {
+		t.Error("ExitError should unwrap to ErrCommandFailed")
+	}
+}
+
+func TestShellSession_Audit(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		writeShellPacket(server, ShellStdout, []byte("12345"))
+		writeShellPacket(server, ShellStderr, []byte("err"))
+		writeShellPacket(server, ShellExit, []byte{2})
+		server.Close()
+	}()
+
+	var got []CommandRecord
+	c := NewClient("")
+	c.SetAuditor(func(r CommandRecord) { got = append(got, r) })
+	s := &ShellSession{conn: client, cancel: func() {}, exitCode: ShellExitUnknown,
+		audit: c.newAuditedStream("dev", "shell,v2,raw:getprop", time.Now())}
+	if _, err := s.collect("getprop", 0); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	s.Close()
+
+	if len(got) != 1 {
+		t.Fatalf("got %d records, want 1", len(got))
+	}
+	r := got[0]
+	if r.Serial != "dev" || r.Service != "shell,v2,raw" || r.Command != "getprop" || r.Bytes != 8 || r.ExitCode != 2 {
+		t.Errorf("record = %+v", r)
+	}
+}
+
+func TestShellSession_CollectLimit(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		writeShellPacket(server, ShellStdout, []byte("héllo"))
+		writeShellPacket(server, ShellStdout, []byte(" wörld"))
+		// Never read: collect stops at the limit.
+		writeShellPacket(server, ShellStdout, []byte("more"))
+		server.Close()
+	}()
+
+	s := &ShellSession{conn: client, cancel: func() {}, exitCode: ShellExitUnknown}
+	res, err := s.collect("cat", 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The cut falls inside "ö", which is dropped.
+	if res.Stdout != "héllo w" || !res.Truncated || res.ExitCode != ShellExitUnknown {
+		t.Errorf("got %+v", res)
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	b := cappedBuffer{limit: 4}
+	if n, err := b.Write([]byte("ab")); n != 2 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if _, err := b.Write([]byte("cdef")); !errors.Is(err, errOutputLimit) {
+		t.Fatalf("Write over the limit: %v", err)
+	}
+	if got := b.String(); got != "abcd" || !b.over {
+		t.Errorf("got %q, over=%v", got, b.over)
+	}
+
+	unlimited := cappedBuffer{}
+	unlimited.Write(bytes.Repeat([]byte("x"), 1<<16))
+	if unlimited.over || len(unlimited.String()) != 1<<16 {
+		t.Error("zero limit cut the output")
+	}
+}
+
+func TestShellV2_TimeoutKeepsShellV2(t *testing.T) {
+	// The transport is selected, but the shell service never answers.
+	c := NewClient(fakeServer(t, 1))
+	c.features.Store("dev1", []string{FeatureShellV2})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := c.ShellV2(ctx, "dev1", "getprop")
+	if err == nil || errors.Is(err, ErrShellV2Unsupported) {
+		t.Fatalf("got %v, want a timeout not wrapping ErrShellV2Unsupported", err)
+	}
+	if !c.useShellV2(context.Background(), "dev1") {
+		t.Error("device demoted to the legacy shell after a timeout")
+	}
+}
@@ -0,0 +1,29 @@
+package adb
+
+import "strings"
+
+// ShellQuote quotes s as a single sh word, for building device command
+// lines from untrusted values.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ValidPackageName reports whether name is a well-formed Android package
+// name, e.g. com.example.app. Such names need no quoting in a command line.
+func ValidPackageName(name string) bool {
+	parts := strings.Split(name, ".")
+	if len(parts) < 2 {
+		return false
+	}
+	for _, p := range parts {
+		if p == "" || !(p[0] >= 'a' && p[0] <= 'z' || p[0] >= 'A' && p[0] <= 'Z') {
+			return false
+		}
+		for _, c := range p {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
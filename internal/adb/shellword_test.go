@@ -0,0 +1,33 @@
+package adb
+
+import "testing"
+
+func TestShellQuote(t *testing.T) {
+	for s, want := range map[string]string{
+		"":              `''`,
+		"port 80":       `'port 80'`,
+		"it's":          `'it'\''s'`,
+		"$(reboot); ls": `'$(reboot); ls'`,
+	} {
+		if got := ShellQuote(s); got != want {
+			t.Errorf("ShellQuote(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestValidPackageName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"com.example.app":   true,
+		"org.mozilla.fenix": true,
+		"com.Example_2.app": true,
+		"example":           false,
+		"com..example":      false,
+		"com.1example":      false,
+		"com.example; rm":   false,
+		"com.example.app ":  false,
+	} {
+		if got := ValidPackageName(name); got != want {
+			t.Errorf("%q: got %v, want %v", name, got, want)
+		}
+	}
+}
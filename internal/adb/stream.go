@@ -14,15 +14,25 @@ import (
 type ShellStream struct {
 	conn   net.Conn
 	cancel context.CancelFunc
+	audit  *auditedStream
 }
 
 // Read implements io.Reader; reads raw shell output bytes.
 func (s *ShellStream) Read(p []byte) (int, error) {
-	return s.conn.Read(p)
+	n, err := s.conn.Read(p)
+	s.audit.read(n)
+	return n, err
+}
+
+// Write sends raw bytes to the shell's stdin. Only interactive sessions
+// (empty command) read from the connection.
+func (s *ShellStream) Write(p []byte) (int, error) {
+	return s.conn.Write(p)
 }
 
 // Close terminates the streaming shell session.
 func (s *ShellStream) Close() error {
+	s.audit.done()
 	s.cancel()
 	return s.conn.Close()
 }
@@ -31,44 +41,39 @@ func (s *ShellStream) Close() error {
 // The returned ShellStream delivers continuous output (e.g. from tcpdump).
 // A background goroutine watches ctx for cancellation and closes the connection.
 func (c *Client) OpenShellStream(ctx context.Context, serial, command string) (*ShellStream, error) {
-	conn, err := c.dial(ctx)
+	start := time.Now()
+	shellCmd := fmt.Sprintf("shell:%s", command)
+	conn, err := c.openTransport(ctx, serial)
 	if err != nil {
-		return nil, fmt.Errorf("dialing for shell stream: %w", err)
-	}
-
-	// Clear any dial deadline; this is a long-lived connection.
-	if err := conn.SetDeadline(time.Time{}); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("clearing deadline: %w", err)
-	}
-
-	// Select device transport.
-	hostCmd := fmt.Sprintf("host:transport:%s", serial)
-	if err := writeCommand(conn, hostCmd); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("writing transport: %w", err)
-	}
-	if err := readStatus(conn, hostCmd); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("selecting device %s: %w", serial, err)
+		c.audit(serial, shellCmd, start, 0, ShellExitUnknown, err)
+		return nil, err
 	}
 
 	// Open shell.
-	shellCmd := fmt.Sprintf("shell:%s", command)
 	if err := writeCommand(conn, shellCmd); err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("writing shell command: %w", err)
+		err = fmt.Errorf("writing shell command: %w", err)
+		c.audit(serial, shellCmd, start, 0, ShellExitUnknown, err)
+		return nil, err
 	}
 	if err := readStatus(conn, shellCmd); err != nil {
 		conn.Close()
+		c.audit(serial, shellCmd, start, 0, ShellExitUnknown, err)
 		return nil, err
 	}
 
+	// The handshake is done; this is a long-lived connection.
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("clearing deadline: %w", err)
+	}
+
 	streamCtx, cancel := context.WithCancel(ctx)
 
 	stream := &ShellStream{
 		conn:   conn,
 		cancel: cancel,
+		audit:  c.newAuditedStream(serial, shellCmd, start),
 	}
 
 	// Close the connection when the parent or stream context is cancelled.
@@ -0,0 +1,252 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// syncMaxChunk is the largest DATA payload the sync protocol accepts.
+const syncMaxChunk = 64 << 10
+
+// Push copies r to remotePath on the device with the given permission
+// bits, using the sync service (what `adb push` uses), in its v2 form when
+// the device's features list it. The file's mtime is set to now.
+func (c *Client) Push(ctx context.Context, serial string, r io.Reader, remotePath string, perm fs.FileMode) (err error) {
+	src := &countingReader{r: r}
+	defer func(start time.Time) {
+		c.audit(serial, "sync:push "+remotePath, start, src.n, ShellExitUnknown, err)
+	}(time.Now())
+
+	v2 := c.useSyncV2(ctx, serial)
+	conn, err := c.openTransport(ctx, serial)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := writeCommand(conn, "sync:"); err != nil {
+		return fmt.Errorf("writing sync: %w", err)
+	}
+	if err := readStatus(conn, "sync:"); err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		conn.SetDeadline(time.Time{})
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	err = pushFile(conn, src, remotePath, perm, time.Now(), v2)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// pushFile runs one SEND exchange on an open sync connection:
+//
+//	SEND <len> "path,mode"  DATA <len> bytes ...  DONE <mtime>
+//
+// answered by OKAY, or FAIL <len> message. With v2 the request is SND2,
+// which carries the mode in a setup packet of its own:
+//
+//	SND2 <len> path  SND2 <mode> <flags>  DATA ...
+func pushFile(rw io.ReadWriter, r io.Reader, remotePath string, perm fs.FileMode, mtime time.Time, v2 bool) error {
+	mode := uint32(perm.Perm()) | 0o100000 // S_IFREG
+	if v2 {
+		if err := writeSyncRequest(rw, "SND2", []byte(remotePath)); err != nil {
+			return fmt.Errorf("sync SND2 %s: %w", remotePath, err)
+		}
+		if err := writeSyncSetup(rw, "SND2", mode, 0); err != nil { // no compression
+			return fmt.Errorf("sync SND2 %s: %w", remotePath, err)
+		}
+	} else {
+		spec := fmt.Sprintf("%s,%d", remotePath, mode)
+		if err := writeSyncRequest(rw, "SEND", []byte(spec)); err != nil {
+			return fmt.Errorf("sync SEND %s: %w", remotePath, err)
+		}
+	}
+
+	buf := make([]byte, syncMaxChunk)
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			if err := writeSyncRequest(rw, "DATA", buf[:n]); err != nil {
+				return fmt.Errorf("sync DATA %s: %w", remotePath, err)
+			}
+		}
+		if errors.Is(rerr, io.EOF) {
+			break
+		}
+		if rerr != nil {
+			return fmt.Errorf("reading %s source: %w", remotePath, rerr)
+		}
+	}
+
+	var done [8]byte
+	copy(done[:], "DONE")
+	binary.LittleEndian.PutUint32(done[4:], uint32(mtime.Unix()))
+	if _, err := rw.Write(done[:]); err != nil {
+		return fmt.Errorf("sync DONE %s: %w", remotePath, err)
+	}
+
+	return readSyncStatus(rw, "sync push "+remotePath)
+}
+
+// Pull copies remotePath on the device to w using the sync service (what
+// `adb pull` uses), in its v2 form when the device's features list it, and
+// returns the number of bytes copied.
+func (c *Client) Pull(ctx context.Context, serial, remotePath string, w io.Writer) (n int64, err error) {
+	defer func(start time.Time) {
+		c.audit(serial, "sync:pull "+remotePath, start, n, ShellExitUnknown, err)
+	}(time.Now())
+
+	v2 := c.useSyncV2(ctx, serial)
+	conn, err := c.openTransport(ctx, serial)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if err := writeCommand(conn, "sync:"); err != nil {
+		return 0, fmt.Errorf("writing sync: %w", err)
+	}
+	if err := readStatus(conn, "sync:"); err != nil {
+		return 0, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		conn.SetDeadline(time.Time{})
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	n, err = pullFile(conn, remotePath, w, v2)
+	if err != nil && ctx.Err() != nil {
+		return n, ctx.Err()
+	}
+	return n, err
+}
+
+// pullFile runs one RECV exchange on an open sync connection:
+//
+//	RECV <len> path
+//
+// answered by DATA <len> bytes ... DONE <0>, or FAIL <len> message. With
+// v2 the request is RCV2 followed by its setup packet, RCV2 <flags>; the
+// reply is the same.
+func pullFile(rw io.ReadWriter, remotePath string, w io.Writer, v2 bool) (int64, error) {
+	if v2 {
+		if err := writeSyncRequest(rw, "RCV2", []byte(remotePath)); err != nil {
+			return 0, fmt.Errorf("sync RCV2 %s: %w", remotePath, err)
+		}
+		if err := writeSyncSetup(rw, "RCV2", 0); err != nil {
+			return 0, fmt.Errorf("sync RCV2 %s: %w", remotePath, err)
+		}
+	} else if err := writeSyncRequest(rw, "RECV", []byte(remotePath)); err != nil {
+		return 0, fmt.Errorf("sync RECV %s: %w", remotePath, err)
+	}
+
+	cmd := "sync pull " + remotePath
+	var total int64
+	buf := make([]byte, syncMaxChunk)
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(rw, hdr[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return total, fmt.Errorf("reading %q: %w", cmd, ErrConnectionClosed)
+			}
+			return total, fmt.Errorf("%w: reading %q: %w", ErrProtocol, cmd, err)
+		}
+		n := binary.LittleEndian.Uint32(hdr[4:])
+		switch string(hdr[:4]) {
+		case "DATA":
+			if n > syncMaxChunk {
+				return total, fmt.Errorf("%w: chunk of %d bytes for %q", ErrProtocol, n, cmd)
+			}
+			if _, err := io.ReadFull(rw, buf[:n]); err != nil {
+				return total, fmt.Errorf("%w: reading %q: %w", ErrProtocol, cmd, err)
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return total, fmt.Errorf("writing %s: %w", remotePath, err)
+			}
+			total += int64(n)
+		case "DONE":
+			return total, nil
+		case wireFail:
+			// Let readSyncStatus parse the message from the header.
+			return total, readSyncStatus(io.MultiReader(bytes.NewReader(hdr[:]), rw), cmd)
+		default:
+			return total, fmt.Errorf("%w: unexpected sync reply %q for %q", ErrProtocol, hdr[:4], cmd)
+		}
+	}
+}
+
+// writeSyncRequest writes a sync packet: a 4-byte id, a little-endian
+// length and the payload.
+func writeSyncRequest(w io.Writer, id string, payload []byte) error {
+	hdr := make([]byte, 8, 8+len(payload))
+	copy(hdr, id)
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(len(payload)))
+	_, err := w.Write(append(hdr, payload...))
+	return err
+}
+
+// writeSyncSetup writes the setup packet that follows a v2 request: its
+// id and fields, little-endian. SND2 has the file mode and flags, RCV2 the
+// flags alone; flags of zero ask for an uncompressed transfer.
+func writeSyncSetup(w io.Writer, id string, fields ...uint32) error {
+	setup := make([]byte, 4, 4+4*len(fields))
+	copy(setup, id)
+	for _, f := range fields {
+		setup = binary.LittleEndian.AppendUint32(setup, f)
+	}
+	_, err := w.Write(setup)
+	return err
+}
+
+// readSyncStatus reads the OKAY or FAIL reply that ends a sync exchange.
+func readSyncStatus(r io.Reader, cmd string) error {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("reading status for %q: %w", cmd, ErrConnectionClosed)
+		}
+		return fmt.Errorf("%w: reading status for %q: %w", ErrProtocol, cmd, err)
+	}
+	n := binary.LittleEndian.Uint32(hdr[4:])
+	switch string(hdr[:4]) {
+	case wireOkay:
+		return nil
+	case wireFail:
+		if n > syncMaxChunk {
+			return fmt.Errorf("%w: fail message of %d bytes for %q", ErrProtocol, n, cmd)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return fmt.Errorf("%w: reading fail message for %q: %w", ErrProtocol, cmd, err)
+		}
+		return &ServerError{Command: cmd, Message: string(msg)}
+	default:
+		return fmt.Errorf("%w: unexpected sync status %q for %q", ErrProtocol, hdr[:4], cmd)
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,143 @@
+package adb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// syncConn replays canned device replies and records what was sent.
+type syncConn struct {
+	io.Reader
+	sent bytes.Buffer
+}
+
+func (c *syncConn) Write(p []byte) (int, error) { return c.sent.Write(p) }
+
+func TestPushFile(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), syncMaxChunk+10)
+	conn := &syncConn{Reader: strings.NewReader("OKAY\x00\x00\x00\x00")}
+	mtime := time.Unix(1700000000, 0)
+
+	if err := pushFile(conn, bytes.NewReader(payload), "/data/local/tmp/bin", 0o755, mtime, false); err != nil {
+		t.Fatal(err)
+	}
+
+	out := conn.sent.Bytes()
+	next := func(wantID string) []byte {
+		t.Helper()
+		if len(out) < 8 || string(out[:4]) != wantID {
+			t.Fatalf("expected %s packet, got %q", wantID, out[:min(len(out), 8)])
+		}
+		n := binary.LittleEndian.Uint32(out[4:8])
+		if wantID == "DONE" {
+			out = out[8:]
+			return nil
+		}
+		body := out[8 : 8+n]
+		out = out[8+n:]
+		return body
+	}
+
+	if spec := string(next("SEND")); spec != "/data/local/tmp/bin,33261" { // 0100755
+		t.Errorf("SEND spec = %q", spec)
+	}
+	var got []byte
+	for len(out) >= 4 && string(out[:4]) == "DATA" {
+		chunk := next("DATA")
+		if len(chunk) > syncMaxChunk {
+			t.Errorf("chunk of %d bytes exceeds the sync limit", len(chunk))
+		}
+		got = append(got, chunk...)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("pushed %d bytes, want %d", len(got), len(payload))
+	}
+	next("DONE")
+	if len(out) != 0 {
+		t.Errorf("trailing bytes after DONE: %q", out)
+	}
+}
+
+func TestPushFile_Fail(t *testing.T) {
+	conn := &syncConn{Reader: strings.NewReader("FAIL\x11\x00\x00\x00permission denied")}
+	err := pushFile(conn, strings.NewReader("data"), "/system/bin/x", 0o755, time.Now(), false)
+
+	var se *ServerError
+	if !errors.As(err, &se) || se.Message != "permission denied" {
+		t.Fatalf("expected ServerError, got %v", err)
+	}
+	if !errors.Is(err, ErrCommandFailed) {
+		t.Errorf("expected ErrCommandFailed, got %v", err)
+	}
+}
+
+func TestReadSyncStatus_Malformed(t *testing.T) {
+	for _, in := range []string{"", "OKA", "WHAT\x00\x00\x00\x00", "FAIL\xff\xff\xff\xff"} {
+		err := readSyncStatus(strings.NewReader(in), "sync")
+		if err == nil {
+			t.Errorf("%q: expected error", in)
+			continue
+		}
+		if !errors.Is(err, ErrProtocol) && !errors.Is(err, ErrConnectionClosed) {
+			t.Errorf("%q: unclassified error %v", in, err)
+		}
+	}
+}
+
+func TestPullFile(t *testing.T) {
+	reply := "DATA\x05\x00\x00\x00hello" + "DATA\x06\x00\x00\x00 world" + "DONE\x00\x00\x00\x00"
+	conn := &syncConn{Reader: strings.NewReader(reply)}
+	var got bytes.Buffer
+
+	n, err := pullFile(conn, "/sdcard/rec.mp4", &got, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 11 || got.String() != "hello world" {
+		t.Errorf("pulled %d bytes %q", n, got.String())
+	}
+	if sent := conn.sent.String(); sent != "RECV\x0f\x00\x00\x00/sdcard/rec.mp4" {
+		t.Errorf("sent %q", sent)
+	}
+}
+
+func TestPullFile_Fail(t *testing.T) {
+	conn := &syncConn{Reader: strings.NewReader("FAIL\x19\x00\x00\x00No such file or directory")}
+	_, err := pullFile(conn, "/sdcard/missing.mp4", io.Discard, false)
+
+	var se *ServerError
+	if !errors.As(err, &se) || se.Message != "No such file or directory" {
+		t.Fatalf("expected ServerError, got %v", err)
+	}
+	for _, in := range []string{"", "DATA\xff\xff\xff\xff", "WHAT\x00\x00\x00\x00"} {
+		if _, err := pullFile(&syncConn{Reader: strings.NewReader(in)}, "/x", io.Discard, false); !errors.Is(err, ErrProtocol) && !errors.Is(err, ErrConnectionClosed) {
+			t.Errorf("%q: unclassified error %v", in, err)
+		}
+	}
+}
+
+func TestSyncV2Requests(t *testing.T) {
+	conn := &syncConn{Reader: strings.NewReader("OKAY\x00\x00\x00\x00")}
+	if err := pushFile(conn, strings.NewReader("hi"), "/data/local/tmp/x", 0o644, time.Unix(1, 0), true); err != nil {
+		t.Fatal(err)
+	}
+	want := "SND2\x11\x00\x00\x00/data/local/tmp/x" + "SND2\xa4\x81\x00\x00\x00\x00\x00\x00" + // 0100644, no flags
+		"DATA\x02\x00\x00\x00hi" + "DONE\x01\x00\x00\x00"
+	if sent := conn.sent.String(); sent != want {
+		t.Errorf("push sent %q, want %q", sent, want)
+	}
+
+	conn = &syncConn{Reader: strings.NewReader("DATA\x02\x00\x00\x00hiDONE\x00\x00\x00\x00")}
+	var got bytes.Buffer
+	if _, err := pullFile(conn, "/sdcard/x", &got, true); err != nil || got.String() != "hi" {
+		t.Fatalf("pulled %q, %v", got.String(), err)
+	}
+	if sent := conn.sent.String(); sent != "RCV2\x09\x00\x00\x00/sdcard/x"+"RCV2\x00\x00\x00\x00" {
+		t.Errorf("pull sent %q", sent)
+	}
+}
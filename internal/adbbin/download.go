@@ -0,0 +1,357 @@
+package adbbin
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRepositoryURL is Google's SDK repository manifest, which lists
+	// every platform-tools release with its archives and checksums.
+	DefaultRepositoryURL = "https://dl.google.com/android/repository/repository2-1.xml"
+
+	// downloadTimeout bounds fetching the manifest and the archive.
+	downloadTimeout = 5 * time.Minute
+	// maxArchiveSize guards against a manifest announcing a runaway size.
+	maxArchiveSize = 200 << 20
+)
+
+// DownloadConfig configures NewFromDownload. Zero values select defaults.
+type DownloadConfig struct {
+	// RepositoryURL is the SDK repository manifest; archive URLs in it are
+	// relative to it. Defaults to DefaultRepositoryURL.
+	RepositoryURL string
+	// CacheDir keeps downloaded platform-tools, one directory per archive
+	// checksum. Defaults to go-adb-monitor/platform-tools under the user
+	// cache directory.
+	CacheDir string
+	// Client performs the downloads. Defaults to a client with a 5 minute
+	// timeout.
+	Client *http.Client
+
+	// goos and goarch override the host platform in tests.
+	goos, goarch string
+}
+
+// NewFromDownload returns a Manager using the official platform-tools for
+// this OS and architecture, downloaded from Google's SDK repository into
+// the cache directory unless the latest release is already there. The
+// archive's size and SHA-1 from the manifest are verified before it is
+// extracted. When the repository cannot be reached, the newest cached
+// release is used.
+func NewFromDownload(ctx context.Context, log *slog.Logger, cfg DownloadConfig) (*Manager, error) {
+	m := &Manager{log: log.With("component", "adbbin")}
+	if cfg.RepositoryURL == "" {
+		cfg.RepositoryURL = DefaultRepositoryURL
+	}
+	if cfg.CacheDir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("locate cache dir: %w", err)
+		}
+		cfg.CacheDir = filepath.Join(base, "go-adb-monitor", "platform-tools")
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: downloadTimeout}
+	}
+	if cfg.goos == "" {
+		cfg.goos, cfg.goarch = runtime.GOOS, runtime.GOARCH
+	}
+
+	dir, err := m.fetchPlatformTools(ctx, cfg)
+	if err != nil {
+		cached, ok := newestCached(cfg.CacheDir)
+		if !ok {
+			return nil, err
+		}
+		m.log.Warn("platform-tools download failed, using cached copy", "dir", cached, "error", err)
+		dir = cached
+	}
+
+	m.adbPath = filepath.Join(dir, "platform-tools", adbBinaryName())
+	m.downloaded = true
+	if !isExecutable(m.adbPath) {
+		return nil, fmt.Errorf("downloaded ADB binary not executable at %s", m.adbPath)
+	}
+	m.log.Info("downloaded ADB ready", "path", m.adbPath)
+	return m, nil
+}
+
+// sdkRepository is the part of the SDK repository manifest that describes
+// packages and their archives.
+type sdkRepository struct {
+	Packages []struct {
+		Path     string `xml:"path,attr"`
+		Revision struct {
+			Major int `xml:"major"`
+			Minor int `xml:"minor"`
+			Micro int `xml:"micro"`
+		} `xml:"revision"`
+		Channel struct {
+			Ref string `xml:"ref,attr"`
+		} `xml:"channelRef"`
+		Archives []sdkArchive `xml:"archives>archive"`
+	} `xml:"remotePackage"`
+}
+
+type sdkArchive struct {
+	Complete struct {
+		Size     int64  `xml:"size"`
+		Checksum string `xml:"checksum"`
+		URL      string `xml:"url"`
+	} `xml:"complete"`
+	HostOS   string `xml:"host-os"`
+	HostArch string `xml:"host-arch"`
+}
+
+// platformToolsRelease is the platform-tools archive chosen for a host.
+type platformToolsRelease struct {
+	Revision string
+	URL      string
+	Size     int64
+	SHA1     string
+}
+
+// findPlatformTools picks the newest stable platform-tools archive for the
+// host from a repository manifest.
+func findPlatformTools(manifest []byte, goos, goarch string) (platformToolsRelease, error) {
+	var repo sdkRepository
+	if err := xml.Unmarshal(manifest, &repo); err != nil {
+		return platformToolsRelease{}, fmt.Errorf("parse repository manifest: %w", err)
+	}
+
+	hostOS := map[string]string{"linux": "linux", "darwin": "macosx", "windows": "windows"}[goos]
+	hostArch := map[string]string{"amd64": "x64", "arm64": "aarch64", "386": "x86"}[goarch]
+
+	var (
+		best    platformToolsRelease
+		bestRev [3]int
+	)
+	for _, p := range repo.Packages {
+		// channel-0 is the stable channel; packages without a channel
+		// reference are stable too.
+		if p.Path != "platform-tools" || (p.Channel.Ref != "" && p.Channel.Ref != "channel-0") {
+			continue
+		}
+		rev := [3]int{p.Revision.Major, p.Revision.Minor, p.Revision.Micro}
+		if best.URL != "" && !revisionLess(bestRev, rev) {
+			continue
+		}
+		for _, a := range p.Archives {
+			if a.HostOS != hostOS || (a.HostArch != "" && a.HostArch != hostArch) {
+				continue
+			}
+			best = platformToolsRelease{
+				Revision: fmt.Sprintf("%d.%d.%d", rev[0], rev[1], rev[2]),
+				URL:      a.Complete.URL,
+				Size:     a.Complete.Size,
+				SHA1:     strings.ToLower(strings.TrimSpace(a.Complete.Checksum)),
+			}
+			bestRev = rev
+			break
+		}
+	}
+	if best.URL == "" {
+		return best, fmt.Errorf("no platform-tools release for %s/%s in the repository", goos, goarch)
+	}
+	if len(best.SHA1) != 2*sha1.Size {
+		return best, fmt.Errorf("platform-tools %s has no SHA-1 checksum", best.Revision)
+	}
+	return best, nil
+}
+
+func revisionLess(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// fetchPlatformTools makes sure the latest release is extracted in the
+// cache and returns its directory.
+func (m *Manager) fetchPlatformTools(ctx context.Context, cfg DownloadConfig) (string, error) {
+	manifest, err := httpGet(ctx, cfg.Client, cfg.RepositoryURL, 16<<20)
+	if err != nil {
+		return "", fmt.Errorf("fetch repository manifest: %w", err)
+	}
+	rel, err := findPlatformTools(manifest, cfg.goos, cfg.goarch)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(cfg.CacheDir, rel.SHA1)
+	if isExecutable(filepath.Join(dir, "platform-tools", adbBinaryName())) {
+		m.log.Info("using cached platform-tools", "revision", rel.Revision, "dir", dir)
+		return dir, nil
+	}
+
+	base, err := url.Parse(cfg.RepositoryURL)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(rel.URL)
+	if err != nil {
+		return "", fmt.Errorf("archive URL %q: %w", rel.URL, err)
+	}
+	archiveURL := base.ResolveReference(ref).String()
+	if rel.Size <= 0 || rel.Size > maxArchiveSize {
+		return "", fmt.Errorf("platform-tools archive size %d out of range", rel.Size)
+	}
+
+	m.log.Info("downloading platform-tools", "revision", rel.Revision, "url", archiveURL, "bytes", rel.Size)
+	data, err := httpGet(ctx, cfg.Client, archiveURL, rel.Size+1)
+	if err != nil {
+		return "", fmt.Errorf("download platform-tools: %w", err)
+	}
+	if int64(len(data)) != rel.Size {
+		return "", fmt.Errorf("platform-tools archive is %d bytes, manifest says %d", len(data), rel.Size)
+	}
+	sum := sha1.Sum(data)
+	if got := hex.EncodeToString(sum[:]); got != rel.SHA1 {
+		return "", fmt.Errorf("platform-tools checksum mismatch: got %s, want %s", got, rel.SHA1)
+	}
+
+	// Extract next to the final directory and rename, so an interrupted
+	// extraction is never mistaken for a complete one.
+	if err := os.MkdirAll(cfg.CacheDir, 0755); err != nil {
+		return "", fmt.Errorf("create cache dir: %w", err)
+	}
+	tmp, err := os.MkdirTemp(cfg.CacheDir, ".extract-*")
+	if err != nil {
+		return "", fmt.Errorf("create extraction dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := extractZip(data, tmp); err != nil {
+		return "", fmt.Errorf("extract platform-tools: %w", err)
+	}
+	os.RemoveAll(dir)
+	if err := os.Rename(tmp, dir); err != nil {
+		return "", fmt.Errorf("install platform-tools: %w", err)
+	}
+	m.log.Info("platform-tools cached", "revision", rel.Revision, "dir", dir)
+	return dir, nil
+}
+
+// httpGet returns the body of a successful GET, failing if it is longer
+// than limit bytes.
+func httpGet(ctx context.Context, client *http.Client, rawURL string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("GET %s: response larger than %d bytes", rawURL, limit)
+	}
+	return data, nil
+}
+
+// extractZip writes the archive into dir, keeping file modes and refusing
+// entries that would land outside dir.
+func extractZip(data []byte, dir string) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		target := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if target != dir && !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+			return fmt.Errorf("entry %q escapes the archive", f.Name)
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			continue // platform-tools has none that adb needs
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := writeZipFile(f, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeZipFile(f *zip.File, target string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	mode := f.Mode().Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+	if runtime.GOOS != "windows" && f.Name == "platform-tools/"+adbBinaryName() {
+		mode |= 0755
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// newestCached returns the most recently installed cached release.
+func newestCached(cacheDir string) (string, bool) {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return "", false
+	}
+	var (
+		best    string
+		bestMod time.Time
+	)
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(cacheDir, e.Name())
+		adb := filepath.Join(dir, "platform-tools", adbBinaryName())
+		info, err := os.Stat(adb)
+		if err != nil || !isExecutable(adb) {
+			continue
+		}
+		if info.ModTime().After(bestMod) {
+			best, bestMod = dir, info.ModTime()
+		}
+	}
+	return best, best != ""
+}
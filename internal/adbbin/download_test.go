@@ -0,0 +1,174 @@
+package adbbin
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const testManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<sdk:sdk-repository xmlns:sdk="http://schemas.android.com/sdk/android/repo/repository2/01">
+  <channel id="channel-0">stable</channel>
+  <remotePackage path="platform-tools">
+    <revision><major>34</major><minor>0</minor><micro>5</micro></revision>
+    <channelRef ref="channel-0"/>
+    <archives>
+      <archive><complete><size>1</size><checksum type="sha1">%[3]s</checksum><url>old-linux.zip</url></complete><host-os>linux</host-os></archive>
+    </archives>
+  </remotePackage>
+  <remotePackage path="platform-tools">
+    <revision><major>35</major><minor>0</minor><micro>2</micro></revision>
+    <channelRef ref="channel-0"/>
+    <archives>
+      <archive><complete><size>%[1]d</size><checksum type="sha1">%[2]s</checksum><url>platform-tools_r35.0.2-darwin.zip</url></complete><host-os>macosx</host-os></archive>
+      <archive><complete><size>%[1]d</size><checksum type="sha1">%[2]s</checksum><url>platform-tools_r35.0.2-linux.zip</url></complete><host-os>linux</host-os></archive>
+    </archives>
+  </remotePackage>
+  <remotePackage path="platform-tools">
+    <revision><major>36</major><minor>0</minor><micro>0</micro></revision>
+    <channelRef ref="channel-3"/>
+    <archives>
+      <archive><complete><size>1</size><checksum type="sha1">%[3]s</checksum><url>canary-linux.zip</url></complete><host-os>linux</host-os></archive>
+    </archives>
+  </remotePackage>
+</sdk:sdk-repository>`
+
+// platformToolsZip builds a platform-tools archive; evil adds an entry
+// that points outside the extraction directory.
+func platformToolsZip(t *testing.T, evil bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	hdr := &zip.FileHeader{Name: "platform-tools/adb", Method: zip.Deflate}
+	hdr.SetMode(0755)
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "#!/bin/sh\n")
+	if evil {
+		if _, err := zw.Create("../evil"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestFindPlatformTools(t *testing.T) {
+	manifest := fmt.Sprintf(testManifest, 10, "0123456789abcdef0123456789abcdef01234567", "00")
+	rel, err := findPlatformTools([]byte(manifest), "linux", "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Revision != "35.0.2" || rel.URL != "platform-tools_r35.0.2-linux.zip" || rel.Size != 10 {
+		t.Errorf("release = %+v", rel)
+	}
+	if _, err := findPlatformTools([]byte(manifest), "freebsd", "amd64"); err == nil {
+		t.Error("expected no release for freebsd")
+	}
+}
+
+func TestNewFromDownload(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on exec bits")
+	}
+	var archive atomic.Value
+	var downloads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := archive.Load().([]byte)
+		switch r.URL.Path {
+		case "/repository/repository2-1.xml":
+			sum := sha1.Sum(data)
+			fmt.Fprintf(w, testManifest, len(data), hex.EncodeToString(sum[:]), "00")
+		case "/repository/platform-tools_r35.0.2-linux.zip":
+			downloads.Add(1)
+			w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := DownloadConfig{
+		RepositoryURL: srv.URL + "/repository/repository2-1.xml",
+		CacheDir:      filepath.Join(t.TempDir(), "cache"),
+		goos:          "linux",
+		goarch:        "amd64",
+	}
+
+	// An archive with an entry escaping the extraction dir is rejected as
+	// a whole and leaves nothing behind.
+	archive.Store(platformToolsZip(t, true))
+	if _, err := NewFromDownload(ctx, log, cfg); err == nil {
+		t.Fatal("expected path traversal error")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(cfg.CacheDir), "evil")); err == nil {
+		t.Fatal("entry escaped the extraction dir")
+	}
+	if entries, _ := os.ReadDir(cfg.CacheDir); len(entries) != 0 {
+		t.Errorf("cache not empty after a failed download: %v", entries)
+	}
+
+	archive.Store(platformToolsZip(t, false))
+	m, err := NewFromDownload(ctx, log, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isExecutable(m.Path()) || filepath.Base(filepath.Dir(m.Path())) != "platform-tools" {
+		t.Errorf("adb path = %s", m.Path())
+	}
+
+	// The cached release is reused without downloading it again, and
+	// still used once the repository is gone.
+	before := downloads.Load()
+	if _, err := NewFromDownload(ctx, log, cfg); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	m2, err := NewFromDownload(ctx, log, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if downloads.Load() != before || m2.Path() != m.Path() {
+		t.Errorf("downloads %d -> %d, path %s", before, downloads.Load(), m2.Path())
+	}
+}
+
+func TestFetchPlatformTools_ChecksumMismatch(t *testing.T) {
+	data := platformToolsZip(t, false)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repository2-1.xml" {
+			fmt.Fprintf(w, testManifest, len(data), strings.Repeat("ab", sha1.Size), "00")
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	m := &Manager{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	_, err := m.fetchPlatformTools(context.Background(), DownloadConfig{
+		RepositoryURL: srv.URL + "/repository2-1.xml",
+		CacheDir:      t.TempDir(),
+		Client:        srv.Client(),
+		goos:          "linux",
+		goarch:        "amd64",
+	})
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package adbbin
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PublicKey is the RSA key the local ADB server authenticates to devices
+// with. Devices show its fingerprint in the "Allow USB debugging?" dialog.
+type PublicKey struct {
+	// Path is the adbkey.pub file the key was read from.
+	Path string `json:"path"`
+	// Key is the key in adbkey.pub format: base64 blob and comment.
+	Key string `json:"key"`
+	// Fingerprint is the MD5 of the key blob as colon-separated hex, as
+	// Android displays it.
+	Fingerprint string `json:"fingerprint"`
+	// Comment is usually user@host.
+	Comment string `json:"comment,omitempty"`
+}
+
+// KeyDir returns the directory ADB keeps its key pair in: ANDROID_USER_HOME,
+// else $ANDROID_SDK_HOME/.android, else ~/.android.
+func KeyDir() (string, error) {
+	if dir := os.Getenv("ANDROID_USER_HOME"); dir != "" {
+		return dir, nil
+	}
+	if home := os.Getenv("ANDROID_SDK_HOME"); home != "" {
+		return filepath.Join(home, ".android"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".android"), nil
+}
+
+// ReadPublicKey reads the host's adbkey.pub from KeyDir. The file does not
+// exist until the ADB server has started once.
+func ReadPublicKey() (PublicKey, error) {
+	dir, err := KeyDir()
+	if err != nil {
+		return PublicKey{}, fmt.Errorf("locating adb key: %w", err)
+	}
+	path := filepath.Join(dir, "adbkey.pub")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	k, err := ParsePublicKey(string(data))
+	if err != nil {
+		return PublicKey{}, fmt.Errorf("%s: %w", path, err)
+	}
+	k.Path = path
+	return k, nil
+}
+
+// ParsePublicKey parses the contents of an adbkey.pub file.
+func ParsePublicKey(s string) (PublicKey, error) {
+	blob, comment, _ := strings.Cut(strings.TrimSpace(s), " ")
+	raw, err := base64.StdEncoding.DecodeString(blob)
+	if err != nil || len(raw) == 0 {
+		return PublicKey{}, errors.New("malformed adb public key")
+	}
+	sum := md5.Sum(raw)
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return PublicKey{
+		Key:         strings.TrimSpace(s),
+		Fingerprint: strings.Join(hex, ":"),
+		Comment:     strings.TrimSpace(comment),
+	}, nil
+}
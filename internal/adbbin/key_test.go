@@ -0,0 +1,30 @@
+package adbbin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadPublicKey(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ANDROID_USER_HOME", dir)
+	if err := os.WriteFile(filepath.Join(dir, "adbkey.pub"), []byte("aGVsbG8= dev@build-host\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := ReadPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Fingerprint != "5D:41:40:2A:BC:4B:2A:76:B9:71:9D:91:10:17:C5:92" { // md5("hello")
+		t.Errorf("fingerprint = %s", k.Fingerprint)
+	}
+	if k.Comment != "dev@build-host" || k.Key != "aGVsbG8= dev@build-host" || k.Path != filepath.Join(dir, "adbkey.pub") {
+		t.Errorf("key = %+v", k)
+	}
+
+	if _, err := ParsePublicKey("not base64!"); err == nil {
+		t.Error("expected error for malformed key")
+	}
+}
@@ -9,16 +9,24 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
 // Manager handles the ADB binary lifecycle.
-// It can either use an embedded FS (extracted to a temp dir at startup)
-// or discover ADB from the system.
+// It can either use an embedded FS (extracted to a temp dir at startup),
+// discover ADB from the system, or download the official platform-tools.
 type Manager struct {
 	log     *slog.Logger
 	adbPath string
 	tempDir string // non-empty when we extracted embedded files
+	// downloaded is set when adbPath is a platform-tools release kept in
+	// the download cache.
+	downloaded bool
+
+	// superMu guards super, what Supervise last found.
+	superMu sync.Mutex
+	super   SupervisorStatus
 }
 
 // New creates a Manager that searches the system for ADB.
@@ -121,7 +129,7 @@ func (m *Manager) EnsureServer() error {
 	cmd.Stderr = os.Stderr
 
 	// Set LD_LIBRARY_PATH for bundled shared libs.
-	if m.tempDir != "" {
+	if m.tempDir != "" || m.downloaded {
 		libDir := filepath.Join(filepath.Dir(m.adbPath), "lib64")
 		if _, err := os.Stat(libDir); err == nil {
 			cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+libDir)
@@ -0,0 +1,238 @@
+package adbbin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+// Supervisor defaults.
+const (
+	DefaultCheckInterval = 10 * time.Second
+	DefaultLogMaxSize    = 10 << 20
+	DefaultLogKeep       = 3
+
+	// checkTimeout bounds one health check.
+	checkTimeout = 5 * time.Second
+)
+
+// SupervisorConfig configures Manager.Supervise.
+type SupervisorConfig struct {
+	// Check probes the server, e.g. with a host:version request; an error
+	// means it is down.
+	Check func(context.Context) error
+	// Interval is how often the server is checked; 0 means
+	// DefaultCheckInterval.
+	Interval time.Duration
+	// Bus, if set, receives ADBServerDown when a check fails and
+	// ADBServerUp when the server answers again.
+	Bus *event.Bus
+
+	// LogFile is the server's log, ServerLogPath() if empty. Once it
+	// outgrows LogMaxSize (DefaultLogMaxSize if 0, never if negative) it
+	// is rotated to LogFile.1, keeping LogKeep old logs (DefaultLogKeep
+	// if 0, none if negative).
+	LogFile    string
+	LogMaxSize int64
+	LogKeep    int
+}
+
+// SupervisorStatus reports the server as the supervisor last saw it.
+type SupervisorStatus struct {
+	Up bool `json:"up"`
+	// Since is when the server was last found up or down.
+	Since       time.Time `json:"since"`
+	LastCheck   time.Time `json:"last_check"`
+	LastError   string    `json:"last_error,omitempty"`
+	Restarts    int       `json:"restarts"`
+	LastRestart time.Time `json:"last_restart,omitempty"`
+	LogFile     string    `json:"log_file,omitempty"`
+	// LogRotations counts the rotations of LogFile.
+	LogRotations int `json:"log_rotations"`
+}
+
+// ServerLogPath returns where the ADB server writes its log:
+// $TMPDIR/adb.<uid>.log, or %TEMP%\adb.log on Windows.
+func ServerLogPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.TempDir(), "adb.log")
+	}
+	return filepath.Join(os.TempDir(), "adb."+strconv.Itoa(os.Getuid())+".log")
+}
+
+// SupervisorStatus returns what Supervise last found, and false if it has
+// not run.
+func (m *Manager) SupervisorStatus() (SupervisorStatus, bool) {
+	m.superMu.Lock()
+	defer m.superMu.Unlock()
+	return m.super, !m.super.LastCheck.IsZero()
+}
+
+// Supervise checks the server every cfg.Interval until ctx is done. A
+// server that fails a check is reported down and started again; one that
+// answers after being down is reported up. The server's log is rotated as
+// it grows.
+func (m *Manager) Supervise(ctx context.Context, cfg SupervisorConfig) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultCheckInterval
+	}
+	if cfg.LogFile == "" {
+		cfg.LogFile = ServerLogPath()
+	}
+	if cfg.LogMaxSize == 0 {
+		cfg.LogMaxSize = DefaultLogMaxSize
+	}
+	if cfg.LogKeep == 0 {
+		cfg.LogKeep = DefaultLogKeep
+	}
+	m.superMu.Lock()
+	m.super = SupervisorStatus{Up: true, Since: time.Now(), LogFile: cfg.LogFile}
+	m.superMu.Unlock()
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := m.check(ctx, cfg)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			m.log.Warn("ADB server not responding, restarting it", "error", err)
+			m.restart(ctx, cfg)
+		}
+		if cfg.LogMaxSize > 0 {
+			m.rotateLog(cfg)
+		}
+	}
+}
+
+// check runs cfg.Check and records the outcome, publishing a change of
+// state.
+func (m *Manager) check(ctx context.Context, cfg SupervisorConfig) error {
+	checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+	err := cfg.Check(checkCtx)
+	cancel()
+	if ctx.Err() != nil {
+		return err
+	}
+
+	now := time.Now()
+	m.superMu.Lock()
+	wasUp := m.super.Up
+	m.super.LastCheck = now
+	m.super.Up = err == nil
+	if err != nil {
+		m.super.LastError = err.Error()
+	}
+	if wasUp != m.super.Up {
+		m.super.Since = now
+	}
+	m.superMu.Unlock()
+
+	switch {
+	case wasUp && err != nil:
+		m.publish(cfg, event.Event{Type: event.ADBServerDown, Reason: err.Error(), Timestamp: now})
+	case !wasUp && err == nil:
+		m.log.Info("ADB server is up again")
+		m.publish(cfg, event.Event{Type: event.ADBServerUp, Timestamp: now})
+	}
+	return err
+}
+
+// restart starts the server and checks it again at once, so it is
+// reported up without waiting for the next tick.
+func (m *Manager) restart(ctx context.Context, cfg SupervisorConfig) {
+	err := m.EnsureServer()
+	m.superMu.Lock()
+	m.super.Restarts++
+	m.super.LastRestart = time.Now()
+	m.superMu.Unlock()
+	if err != nil {
+		m.log.Error("failed to restart ADB server", "error", err)
+		return
+	}
+	m.check(ctx, cfg)
+}
+
+func (m *Manager) publish(cfg SupervisorConfig, e event.Event) {
+	if cfg.Bus != nil {
+		cfg.Bus.Publish(e)
+	}
+}
+
+// rotateLog rotates the server log once it outgrows cfg.LogMaxSize.
+func (m *Manager) rotateLog(cfg SupervisorConfig) {
+	rotated, err := rotateLog(cfg.LogFile, cfg.LogMaxSize, cfg.LogKeep)
+	if err != nil {
+		m.log.Warn("failed to rotate ADB server log", "path", cfg.LogFile, "error", err)
+		return
+	}
+	if rotated {
+		m.superMu.Lock()
+		m.super.LogRotations++
+		m.superMu.Unlock()
+		m.log.Info("rotated ADB server log", "path", cfg.LogFile)
+	}
+}
+
+// rotateLog moves path to path.1, path.1 to path.2 and so on, keeping keep
+// old logs, when path is at least maxSize bytes. The server keeps the log
+// open for appending, so it is copied and truncated rather than renamed.
+func rotateLog(path string, maxSize int64, keep int) (bool, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if info.Size() < maxSize {
+		return false, nil
+	}
+
+	if keep > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", path, keep))
+		for i := keep - 1; i >= 1; i-- {
+			err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return false, err
+			}
+		}
+		if err := copyFile(path, path+".1"); err != nil {
+			return false, err
+		}
+	}
+	return true, os.Truncate(path, 0)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
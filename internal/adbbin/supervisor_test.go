@@ -0,0 +1,118 @@
+package adbbin
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+func TestRotateLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "adb.log")
+	write := func(s string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(p string) string {
+		b, _ := os.ReadFile(p)
+		return string(b)
+	}
+
+	if rotated, err := rotateLog(path, 10, 2); rotated || err != nil {
+		t.Fatalf("missing log: rotated=%v err=%v", rotated, err)
+	}
+	write("short")
+	if rotated, _ := rotateLog(path, 10, 2); rotated {
+		t.Fatal("rotated a log under the limit")
+	}
+
+	for _, s := range []string{"first log!", "second log", "third log!"} {
+		write(s)
+		if rotated, err := rotateLog(path, 10, 2); !rotated || err != nil {
+			t.Fatalf("%q: rotated=%v err=%v", s, rotated, err)
+		}
+	}
+	if got := read(path); got != "" {
+		t.Errorf("log not truncated: %q", got)
+	}
+	if got := read(path + ".1"); got != "third log!" {
+		t.Errorf(".1 = %q", got)
+	}
+	if got := read(path + ".2"); got != "second log" {
+		t.Errorf(".2 = %q", got)
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("kept more than 2 rotated logs")
+	}
+}
+
+func TestSupervisorCheck(t *testing.T) {
+	bus := event.NewBus(16)
+	defer bus.Close()
+	events := make(chan event.Event, 16)
+	bus.Subscribe("test", func(e event.Event) { events <- e })
+
+	m := &Manager{log: slog.Default()}
+	m.super = SupervisorStatus{Up: true}
+	var down bool
+	cfg := SupervisorConfig{
+		Bus: bus,
+		Check: func(context.Context) error {
+			if down {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+	}
+
+	next := func() event.Event {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+			return event.Event{}
+		}
+	}
+
+	m.check(context.Background(), cfg)
+	down = true
+	for i := range 2 {
+		if err := m.check(context.Background(), cfg); err == nil {
+			t.Fatalf("check %d passed on a down server", i)
+		}
+	}
+	if e := next(); e.Type != event.ADBServerDown || !strings.Contains(e.Reason, "refused") {
+		t.Errorf("event = %+v, want adb_server_down", e)
+	}
+	down = false
+	m.check(context.Background(), cfg)
+	if e := next(); e.Type != event.ADBServerUp {
+		t.Errorf("event = %+v, want adb_server_up", e)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("unexpected %s", e.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	st, ok := m.SupervisorStatus()
+	if !ok || !st.Up || st.LastError != "connection refused" {
+		t.Errorf("status = %+v", st)
+	}
+}
+
+func TestServerLogPath(t *testing.T) {
+	if got := filepath.Base(ServerLogPath()); !strings.HasPrefix(got, "adb.") || !strings.HasSuffix(got, ".log") {
+		t.Errorf("ServerLogPath = %s", got)
+	}
+}
@@ -0,0 +1,117 @@
+package adbbin
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// Version is an ADB version as reported by `adb version`, e.g. 1.0.41 from
+// platform-tools 35.0.2.
+type Version struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+	Patch int `json:"patch"`
+	// Revision is the platform-tools release, e.g. "35.0.2-12147458"; empty
+	// when the version was derived from the server protocol version.
+	Revision string `json:"revision,omitempty"`
+}
+
+// MinVersion is the oldest ADB this tool is tested against. Older servers
+// lack track-devices-l, which device tracking depends on.
+var MinVersion = Version{Major: 1, Minor: 0, Patch: 41}
+
+// Feature thresholds. Shell protocol v2 (separate stderr and exit codes)
+// arrived with adb 1.0.35, the long-format track-devices-l with 1.0.41.
+var (
+	shellV2Version       = Version{Major: 1, Minor: 0, Patch: 35}
+	trackDevicesLVersion = Version{Major: 1, Minor: 0, Patch: 41}
+)
+
+// platformToolsReleases is where upgrades are pointed to.
+const platformToolsReleases = "https://developer.android.com/tools/releases/platform-tools"
+
+// ParseVersion parses the output of `adb version`:
+//
+//	Android Debug Bridge version 1.0.41
+//	Version 35.0.2-12147458
+//	Installed as /usr/bin/adb
+func ParseVersion(out string) (Version, error) {
+	var (
+		v     Version
+		found bool
+	)
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, "Android Debug Bridge version "):
+			rest := strings.TrimPrefix(line, "Android Debug Bridge version ")
+			if _, err := fmt.Sscanf(rest, "%d.%d.%d", &v.Major, &v.Minor, &v.Patch); err != nil {
+				return Version{}, fmt.Errorf("parse adb version %q: %w", rest, err)
+			}
+			found = true
+		case strings.HasPrefix(line, "Version "):
+			v.Revision = strings.TrimSpace(strings.TrimPrefix(line, "Version "))
+		}
+	}
+	if !found {
+		return Version{}, fmt.Errorf("no version in adb output %q", strings.TrimSpace(out))
+	}
+	return v, nil
+}
+
+// ServerVersion returns the version matching the protocol version an ADB
+// server reports for host:version (41 for 1.0.41).
+func ServerVersion(protocol int) Version {
+	return Version{Major: 1, Minor: 0, Patch: protocol}
+}
+
+// String returns the version as major.minor.patch.
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less reports whether v is older than o. Revisions are not compared.
+func (v Version) Less(o Version) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	return v.Patch < o.Patch
+}
+
+// Supported reports whether v is at least MinVersion.
+func (v Version) Supported() bool {
+	return !v.Less(MinVersion)
+}
+
+// SupportsShellV2 reports whether v speaks shell protocol v2.
+func (v Version) SupportsShellV2() bool {
+	return !v.Less(shellV2Version)
+}
+
+// SupportsTrackDevicesL reports whether v serves host:track-devices-l.
+func (v Version) SupportsTrackDevicesL() bool {
+	return !v.Less(trackDevicesLVersion)
+}
+
+// UpgradeHint returns a message asking to upgrade, or "" when v is
+// supported.
+func (v Version) UpgradeHint() string {
+	if v.Supported() {
+		return ""
+	}
+	return fmt.Sprintf("ADB %s is older than the minimum supported %s; update platform-tools from %s", v, MinVersion, platformToolsReleases)
+}
+
+// ParsedVersion runs `adb version` and parses its output.
+func (m *Manager) ParsedVersion() (Version, error) {
+	out, err := m.Version()
+	if err != nil {
+		return Version{}, err
+	}
+	return ParseVersion(out)
+}
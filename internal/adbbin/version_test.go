@@ -0,0 +1,41 @@
+package adbbin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	out := "Android Debug Bridge version 1.0.41\nVersion 35.0.2-12147458\nInstalled as /usr/bin/adb\nRunning on Linux 6.8.0 (x86_64)\n"
+	v, err := ParseVersion(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != (Version{Major: 1, Minor: 0, Patch: 41, Revision: "35.0.2-12147458"}) {
+		t.Errorf("version = %+v", v)
+	}
+	if !v.Supported() || !v.SupportsShellV2() || !v.SupportsTrackDevicesL() || v.UpgradeHint() != "" {
+		t.Errorf("1.0.41 should be fully supported")
+	}
+
+	if _, err := ParseVersion("adb: command not found"); err == nil {
+		t.Error("expected error for output without a version")
+	}
+}
+
+func TestVersionCompatibility(t *testing.T) {
+	old := ServerVersion(39)
+	if old.String() != "1.0.39" {
+		t.Errorf("String() = %s", old)
+	}
+	if old.Supported() || old.SupportsTrackDevicesL() || !old.SupportsShellV2() {
+		t.Errorf("1.0.39: supported=%v track-devices-l=%v shell-v2=%v",
+			old.Supported(), old.SupportsTrackDevicesL(), old.SupportsShellV2())
+	}
+	if hint := old.UpgradeHint(); !strings.Contains(hint, "1.0.39") || !strings.Contains(hint, MinVersion.String()) {
+		t.Errorf("hint = %q", hint)
+	}
+	if !ServerVersion(40).Less(ServerVersion(41)) || ServerVersion(41).Less(ServerVersion(41)) {
+		t.Error("Less ordering wrong")
+	}
+}
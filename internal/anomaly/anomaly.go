@@ -0,0 +1,460 @@
+// Package anomaly learns what normal traffic looks like for each device and
+// app — the destinations it talks to, how many requests it makes and how
+// many bytes it moves per window — and reports traffic that departs from
+// it: destinations never seen before, and volumes a configurable factor
+// above or below their baseline.
+package anomaly
+
+import (
+	"math"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+const (
+	// DefaultFactor is how far a window's volume may stray from its
+	// baseline, in either direction, before it is reported.
+	DefaultFactor = 3.0
+	// DefaultWindow is the length of the windows volumes are measured over.
+	DefaultWindow = time.Minute
+	// DefaultLearning is how long a device or app is observed before it
+	// can raise anomalies.
+	DefaultLearning = 30 * time.Minute
+	// DefaultMinBytes and DefaultMinRequests are the per-window volumes
+	// below which a spike or a drop is too small to report.
+	DefaultMinBytes    = 64 << 10
+	DefaultMinRequests = 10
+
+	// alpha weighs the latest window in a learned baseline's moving
+	// average.
+	alpha = 0.1
+	// maxDestinations bounds the destinations remembered per device or
+	// app; past it, new destinations are no longer reported.
+	maxDestinations = 4096
+	// maxRecent bounds the anomalies kept for Recent.
+	maxRecent = 500
+	// connIdleWindows is how many windows a connection's byte counters are
+	// kept after it was last seen.
+	connIdleWindows = 10
+)
+
+// Kind names a kind of anomaly.
+type Kind string
+
+const (
+	// KindNewDestination is traffic to a host or IP outside the baseline.
+	KindNewDestination Kind = "new_destination"
+	// KindVolumeHigh is a window whose volume is Factor times its baseline
+	// or more.
+	KindVolumeHigh Kind = "volume_high"
+	// KindVolumeLow is a window whose volume fell to a Factor-th of its
+	// baseline or less.
+	KindVolumeLow Kind = "volume_low"
+)
+
+// Metric names the volume a volume anomaly is about.
+type Metric string
+
+const (
+	MetricBytes    Metric = "bytes"
+	MetricRequests Metric = "requests"
+)
+
+// Anomaly is one departure from a baseline. App is empty for anomalies of
+// the device as a whole.
+type Anomaly struct {
+	Kind   Kind   `json:"kind"`
+	Serial string `json:"serial"`
+	App    string `json:"app,omitempty"`
+	// Destination is set for KindNewDestination.
+	Destination string `json:"destination,omitempty"`
+	// Metric, Observed and Baseline are set for volume anomalies: the
+	// window's volume against the baseline's per-window average.
+	Metric    Metric    `json:"metric,omitempty"`
+	Observed  float64   `json:"observed,omitempty"`
+	Baseline  float64   `json:"baseline,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Config tunes the detector. Zero fields select the defaults.
+type Config struct {
+	Factor      float64
+	Window      time.Duration
+	Learning    time.Duration
+	MinBytes    int64
+	MinRequests int
+}
+
+func (c Config) withDefaults() Config {
+	if c.Factor <= 1 {
+		c.Factor = DefaultFactor
+	}
+	if c.Window <= 0 {
+		c.Window = DefaultWindow
+	}
+	if c.Learning <= 0 {
+		c.Learning = DefaultLearning
+	}
+	if c.MinBytes <= 0 {
+		c.MinBytes = DefaultMinBytes
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = DefaultMinRequests
+	}
+	return c
+}
+
+// Baseline summarizes what has been learned about a device or app.
+type Baseline struct {
+	Serial string `json:"serial"`
+	App    string `json:"app,omitempty"`
+	// Learning is set until enough windows were seen to raise anomalies.
+	Learning     bool `json:"learning"`
+	Windows      int  `json:"windows"`
+	Destinations int  `json:"destinations"`
+	// BytesPerWindow and RequestsPerWindow are the baseline volumes.
+	BytesPerWindow    float64 `json:"bytes_per_window"`
+	RequestsPerWindow float64 `json:"requests_per_window"`
+}
+
+type key struct {
+	serial, app string
+}
+
+// baseline is the learned state of one device or app.
+type baseline struct {
+	destinations map[string]struct{}
+	windows      int
+	bytesAvg     float64
+	requestsAvg  float64
+
+	// Volumes of the current window.
+	bytes    int64
+	requests int
+}
+
+// Detector learns baselines from observed traffic and reports anomalies.
+// It is safe for concurrent use.
+type Detector struct {
+	cfg Config
+	// learnWindows is the number of windows in cfg.Learning.
+	learnWindows int
+
+	mu        sync.Mutex
+	baselines map[key]*baseline
+	conns     capture.ConnCounters
+	recent    []Anomaly
+	totals    map[Total]uint64
+}
+
+// Total counts the anomalies of one kind reported for a device.
+type Total struct {
+	Serial string
+	Kind   Kind
+}
+
+// New creates a detector.
+func New(cfg Config) *Detector {
+	cfg = cfg.withDefaults()
+	return &Detector{
+		cfg:          cfg,
+		learnWindows: int(math.Ceil(float64(cfg.Learning) / float64(cfg.Window))),
+		baselines:    make(map[key]*baseline),
+		totals:       make(map[Total]uint64),
+	}
+}
+
+// Window returns the length of a window; Tick should be called this often.
+func (d *Detector) Window() time.Duration {
+	return d.cfg.Window
+}
+
+// ObserveConnection accounts a connection as reported by a capture: its
+// first sighting is a request to its destination, and growth of its byte
+// counters is traffic. Destinations are attributed to the connection's app
+// when it is known.
+func (d *Detector) ObserveConnection(c capture.Connection) []Anomaly {
+	dest := c.Hostname
+	if dest == "" {
+		dest = c.RemoteIP
+	}
+	now := c.LastSeen
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	bytes, known := d.conns.Observe(c, now)
+	if known {
+		// An update: only a newly resolved hostname is news, and it names
+		// a destination already reported by IP.
+		d.learn(c.Serial, c.AppName, dest)
+		d.count(c.Serial, c.AppName, bytes, 0)
+		return nil
+	}
+	d.count(c.Serial, c.AppName, bytes, 1)
+	return d.observeDestination(c.Serial, c.AppName, dest, now)
+}
+
+// ObservePacket accounts a captured packet: its length as traffic, HTTP
+// requests and TCP SYNs as requests, and its remote end as a destination.
+// Packets without payload or a connection opening carry nothing to learn
+// from and are skipped; this includes the packets a capture derives from
+// connections, which ObserveConnection accounts.
+func (d *Detector) ObservePacket(p capture.NetworkPacket) []Anomaly {
+	var requests int
+	if p.HTTPMethod != "" || p.Flags == "S" {
+		requests = 1
+	}
+	if p.Length <= 0 && requests == 0 {
+		return nil
+	}
+	now := p.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.count(p.Serial, "", int64(max(p.Length, 0)), requests)
+	return d.observeDestination(p.Serial, "", packetDestination(p), now)
+}
+
+// packetDestination returns the host of an HTTP request, or the remote end
+// of a packet: the non-private address, preferring the destination.
+func packetDestination(p capture.NetworkPacket) string {
+	if p.HTTPHost != "" {
+		return p.HTTPHost
+	}
+	if !isLocal(p.DstIP) || isLocal(p.SrcIP) {
+		return p.DstIP
+	}
+	return p.SrcIP
+}
+
+func isLocal(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	return addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified()
+}
+
+// count adds volume to the current window of the device and of its app.
+func (d *Detector) count(serial, app string, bytes int64, requests int) {
+	for _, k := range keys(serial, app) {
+		b := d.baseline(k)
+		b.bytes += bytes
+		b.requests += requests
+	}
+}
+
+// learn adds dest to the baselines of the device and its app without
+// reporting it.
+func (d *Detector) learn(serial, app, dest string) {
+	if dest == "" {
+		return
+	}
+	for _, k := range keys(serial, app) {
+		if b := d.baseline(k); len(b.destinations) < maxDestinations {
+			b.destinations[dest] = struct{}{}
+		}
+	}
+}
+
+// observeDestination learns dest for the device and its app and reports it
+// if it is new to the most specific of them that is done learning.
+func (d *Detector) observeDestination(serial, app, dest string, now time.Time) []Anomaly {
+	if dest == "" {
+		return nil
+	}
+	ks := keys(serial, app)
+	b := d.baseline(ks[len(ks)-1])
+	_, seen := b.destinations[dest]
+	report := !seen && b.windows >= d.learnWindows && len(b.destinations) < maxDestinations
+	d.learn(serial, app, dest)
+	if !report {
+		return nil
+	}
+	a := Anomaly{Kind: KindNewDestination, Serial: serial, App: app, Destination: dest, Timestamp: now}
+	d.record(a)
+	return []Anomaly{a}
+}
+
+// keys returns the device's key, followed by its app's if app is known.
+func keys(serial, app string) []key {
+	if app == "" {
+		return []key{{serial: serial}}
+	}
+	return []key{{serial: serial}, {serial: serial, app: app}}
+}
+
+func (d *Detector) baseline(k key) *baseline {
+	b, ok := d.baselines[k]
+	if !ok {
+		b = &baseline{destinations: make(map[string]struct{})}
+		d.baselines[k] = b
+	}
+	return b
+}
+
+// Tick closes the current window at now: the volumes of each device and
+// app being captured, as reported by active, are compared with their
+// baselines and folded into them. Devices not being captured keep their
+// baselines untouched, so a stopped capture does not read as a drop.
+func (d *Detector) Tick(now time.Time, active func(serial string) bool) []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var out []Anomaly
+	for k, b := range d.baselines {
+		bytes, requests := b.bytes, b.requests
+		b.bytes, b.requests = 0, 0
+		if !active(k.serial) {
+			continue
+		}
+		if b.windows >= d.learnWindows {
+			if m, ok := d.deviates(float64(bytes), b.bytesAvg, float64(d.cfg.MinBytes)); ok {
+				out = append(out, Anomaly{Kind: m, Serial: k.serial, App: k.app, Metric: MetricBytes,
+					Observed: float64(bytes), Baseline: b.bytesAvg, Timestamp: now})
+			}
+			if m, ok := d.deviates(float64(requests), b.requestsAvg, float64(d.cfg.MinRequests)); ok {
+				out = append(out, Anomaly{Kind: m, Serial: k.serial, App: k.app, Metric: MetricRequests,
+					Observed: float64(requests), Baseline: b.requestsAvg, Timestamp: now})
+			}
+		}
+		b.fold(float64(bytes), float64(requests), d.learnWindows)
+	}
+
+	d.conns.Forget(now, connIdleWindows*d.cfg.Window)
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Serial != out[j].Serial {
+			return out[i].Serial < out[j].Serial
+		}
+		if out[i].App != out[j].App {
+			return out[i].App < out[j].App
+		}
+		return out[i].Metric < out[j].Metric
+	})
+	for _, a := range out {
+		d.record(a)
+	}
+	return out
+}
+
+// deviates reports whether observed is a high or low anomaly against avg.
+// Volumes under floor on both sides of the comparison are never reported.
+func (d *Detector) deviates(observed, avg, floor float64) (Kind, bool) {
+	switch {
+	case observed >= floor && observed >= avg*d.cfg.Factor:
+		return KindVolumeHigh, true
+	case avg >= floor && observed <= avg/d.cfg.Factor:
+		return KindVolumeLow, true
+	}
+	return "", false
+}
+
+// fold adds a window to the baseline: a plain mean while learning, a
+// moving average afterwards so the baseline follows gradual change.
+func (b *baseline) fold(bytes, requests float64, learnWindows int) {
+	b.windows++
+	w := alpha
+	if b.windows <= learnWindows {
+		w = 1 / float64(b.windows)
+	}
+	b.bytesAvg += (bytes - b.bytesAvg) * w
+	b.requestsAvg += (requests - b.requestsAvg) * w
+}
+
+func (d *Detector) record(a Anomaly) {
+	if len(d.recent) == maxRecent {
+		copy(d.recent, d.recent[1:])
+		d.recent = d.recent[:maxRecent-1]
+	}
+	d.recent = append(d.recent, a)
+	d.totals[Total{Serial: a.Serial, Kind: a.Kind}]++
+}
+
+// Totals returns how many anomalies of each kind were reported per device
+// since the detector was created.
+func (d *Detector) Totals() map[Total]uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make(map[Total]uint64, len(d.totals))
+	for t, n := range d.totals {
+		out[t] = n
+	}
+	return out
+}
+
+// Recent returns the latest anomalies, newest first, of serial or of every
+// device if serial is empty; at most n if n > 0.
+func (d *Detector) Recent(serial string, n int) []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := []Anomaly{}
+	for i := len(d.recent) - 1; i >= 0; i-- {
+		if serial != "" && d.recent[i].Serial != serial {
+			continue
+		}
+		out = append(out, d.recent[i])
+		if n > 0 && len(out) == n {
+			break
+		}
+	}
+	return out
+}
+
+// Baselines returns the baselines of serial, or of every device if serial
+// is empty, sorted by serial and app.
+func (d *Detector) Baselines(serial string) []Baseline {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := []Baseline{}
+	for k, b := range d.baselines {
+		if serial != "" && k.serial != serial {
+			continue
+		}
+		out = append(out, Baseline{
+			Serial:            k.serial,
+			App:               k.app,
+			Learning:          b.windows < d.learnWindows,
+			Windows:           b.windows,
+			Destinations:      len(b.destinations),
+			BytesPerWindow:    b.bytesAvg,
+			RequestsPerWindow: b.requestsAvg,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Serial != out[j].Serial {
+			return out[i].Serial < out[j].Serial
+		}
+		return out[i].App < out[j].App
+	})
+	return out
+}
+
+// Reset forgets everything learned about serial, which starts learning
+// again. It reports whether there was anything to forget.
+func (d *Detector) Reset(serial string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var found bool
+	for k := range d.baselines {
+		if k.serial == serial {
+			delete(d.baselines, k)
+			found = true
+		}
+	}
+	return found
+}
@@ -0,0 +1,97 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+func always(string) bool { return true }
+
+func TestDetector_NewDestination(t *testing.T) {
+	d := New(Config{Window: time.Minute, Learning: 2 * time.Minute})
+	now := time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC)
+	conn := func(port uint16, host, app string) capture.Connection {
+		return capture.Connection{Serial: "A", LocalIP: "10.0.0.2", LocalPort: port, RemoteIP: "93.184.216.34",
+			RemotePort: 443, Protocol: capture.ProtoTCP, Hostname: host, AppName: app, LastSeen: now}
+	}
+
+	// Anything goes while learning.
+	if got := d.ObserveConnection(conn(1000, "example.com", "com.app")); len(got) != 0 {
+		t.Fatalf("learning: %+v", got)
+	}
+	d.Tick(now, always)
+	d.Tick(now, always)
+
+	if got := d.ObserveConnection(conn(1001, "example.com", "com.app")); len(got) != 0 {
+		t.Errorf("known destination: %+v", got)
+	}
+	got := d.ObserveConnection(conn(1002, "evil.example", "com.app"))
+	if len(got) != 1 || got[0].Kind != KindNewDestination || got[0].App != "com.app" || got[0].Destination != "evil.example" {
+		t.Errorf("new destination = %+v", got)
+	}
+	// An update of a known connection never reports.
+	if got := d.ObserveConnection(conn(1002, "other.example", "com.app")); len(got) != 0 {
+		t.Errorf("update: %+v", got)
+	}
+	// The app's destination is known to the device as a whole.
+	pkt := capture.NetworkPacket{Serial: "A", SrcIP: "10.0.0.2", DstIP: "1.1.1.1", Length: 100, HTTPHost: "evil.example"}
+	if got := d.ObservePacket(pkt); len(got) != 0 {
+		t.Errorf("packet to known host: %+v", got)
+	}
+	pkt.HTTPHost = ""
+	pkt.SrcIP, pkt.DstIP = "8.8.8.8", "10.0.0.2"
+	if got := d.ObservePacket(pkt); len(got) != 1 || got[0].Destination != "8.8.8.8" || got[0].App != "" {
+		t.Errorf("inbound packet = %+v", got)
+	}
+	// Packets without payload are skipped.
+	pkt.SrcIP, pkt.Length = "9.9.9.9", 0
+	if got := d.ObservePacket(pkt); len(got) != 0 {
+		t.Errorf("empty packet: %+v", got)
+	}
+
+	if recent := d.Recent("A", 1); len(recent) != 1 || recent[0].Destination != "8.8.8.8" {
+		t.Errorf("Recent = %+v", recent)
+	}
+}
+
+func TestDetector_Volume(t *testing.T) {
+	d := New(Config{Factor: 3, Window: time.Minute, Learning: 3 * time.Minute, MinBytes: 1000, MinRequests: 5})
+	now := time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC)
+	window := func(bytes int) []Anomaly {
+		d.ObservePacket(capture.NetworkPacket{Serial: "A", SrcIP: "10.0.0.2", DstIP: "1.1.1.1", Length: bytes})
+		now = now.Add(time.Minute)
+		return d.Tick(now, always)
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := window(2000); len(got) != 0 {
+			t.Fatalf("learning window %d: %+v", i, got)
+		}
+	}
+	if got := window(5000); len(got) != 0 {
+		t.Errorf("within factor: %+v", got)
+	}
+	got := window(20000)
+	if len(got) != 1 || got[0].Kind != KindVolumeHigh || got[0].Metric != MetricBytes || got[0].Observed != 20000 {
+		t.Errorf("spike = %+v", got)
+	}
+
+	// A stopped capture neither reports nor moves the baseline.
+	before := d.Baselines("A")[0]
+	if got := d.Tick(now, func(string) bool { return false }); len(got) != 0 {
+		t.Errorf("inactive: %+v", got)
+	}
+	if after := d.Baselines("A")[0]; after != before {
+		t.Errorf("inactive tick moved baseline: %+v -> %+v", before, after)
+	}
+
+	if got := window(1); len(got) != 1 || got[0].Kind != KindVolumeLow {
+		t.Errorf("drop = %+v", got)
+	}
+
+	if !d.Reset("A") || len(d.Baselines("")) != 0 {
+		t.Error("Reset kept baselines")
+	}
+}
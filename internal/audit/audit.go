@@ -0,0 +1,272 @@
+// Package audit logs every command the server runs on a device — when, on
+// which device, how long it took and how much output it produced — for
+// labs whose compliance policy asks for a record. Entries are kept in
+// memory for queries and appended to a JSON lines file.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+const (
+	// DefaultMaxEntries is how many entries are kept in memory.
+	DefaultMaxEntries = 50000
+	// MaxFileSize is the size at which the file is rotated to <path>.1,
+	// replacing the previous one.
+	MaxFileSize = 64 << 20
+)
+
+// Entry is one command run on a device.
+type Entry struct {
+	ID     uint64    `json:"id"`
+	Time   time.Time `json:"time"`
+	Serial string    `json:"serial"`
+	// Service is the adbd service ("shell", "shell,v2,raw", "sync",
+	// "reverse", "root", ...) and Command what it ran.
+	Service    string  `json:"service"`
+	Command    string  `json:"command,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+	// Bytes is the output read, or for a push the bytes sent.
+	Bytes int64 `json:"bytes"`
+	// ExitCode is set when the shell reported one (shell v2 only).
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Query selects entries. Zero fields match everything.
+type Query struct {
+	Serial string
+	// Service matches the service or, for "shell", any shell variant.
+	Service string
+	// Command matches entries whose command contains it.
+	Command  string
+	From, To time.Time
+	// Failed keeps only commands that failed or exited non-zero.
+	Failed bool
+	// Limit caps the result, newest first.
+	Limit int
+}
+
+func (q Query) match(e *Entry) bool {
+	return (q.Serial == "" || e.Serial == q.Serial) &&
+		(q.Service == "" || e.Service == q.Service || strings.HasPrefix(e.Service, q.Service+",")) &&
+		(q.Command == "" || strings.Contains(e.Command, q.Command)) &&
+		(q.From.IsZero() || !e.Time.Before(q.From)) &&
+		(q.To.IsZero() || !e.Time.After(q.To)) &&
+		(!q.Failed || e.Error != "" || (e.ExitCode != nil && *e.ExitCode != 0))
+}
+
+// Log is the audit log. It is safe for concurrent use.
+type Log struct {
+	path       string
+	maxEntries int
+
+	mu      sync.Mutex
+	entries []Entry // oldest first
+	seq     uint64
+	file    *os.File
+	size    int64
+	failing bool
+}
+
+// Open opens the audit log appended to path, loading its latest
+// maxEntries entries (DefaultMaxEntries if zero). An empty path keeps the
+// log in memory only.
+func Open(path string, maxEntries int) (*Log, error) {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	l := &Log{path: path, maxEntries: maxEntries}
+	if path == "" {
+		return l, nil
+	}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	if err := l.openFile(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) load() error {
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read audit log: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var e Entry
+		// A line torn by a crash is skipped.
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+		l.seq = max(l.seq, e.ID)
+		l.entries = append(l.entries, e)
+		if len(l.entries) > 2*l.maxEntries {
+			l.entries = append(l.entries[:0:0], l.entries[len(l.entries)-l.maxEntries:]...)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read audit log %s: %w", l.path, err)
+	}
+	if over := len(l.entries) - l.maxEntries; over > 0 {
+		l.entries = l.entries[over:]
+	}
+	return nil
+}
+
+func (l *Log) openFile() error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	l.file, l.size = f, st.Size()
+	return nil
+}
+
+// Path returns the file the log is appended to, or "" if in memory.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Record adds the entry of a finished device command; see Add.
+func (l *Log) Record(r adb.CommandRecord) (Entry, error) {
+	e := Entry{
+		Time:       r.Start,
+		Serial:     r.Serial,
+		Service:    r.Service,
+		Command:    r.Command,
+		DurationMs: float64(r.Duration.Microseconds()) / 1000,
+		Bytes:      r.Bytes,
+	}
+	if r.ExitCode != adb.ShellExitUnknown {
+		code := r.ExitCode
+		e.ExitCode = &code
+	}
+	if r.Err != nil {
+		e.Error = r.Err.Error()
+	}
+	return l.Add(e)
+}
+
+// Add assigns e an ID, keeps it and appends it to the file. Entries over
+// the capacity are dropped from memory, oldest first. Only the first of
+// consecutive write failures is returned, so a full disk is reported once.
+func (l *Log) Add(e Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	e.ID = l.seq
+	l.entries = append(l.entries, e)
+	if over := len(l.entries) - l.maxEntries; over > 0 {
+		// Append reallocates once the slack is used up, so the backing
+		// array does not grow without bound.
+		l.entries = l.entries[over:]
+	}
+
+	err := l.writeLocked(e)
+	if err == nil {
+		l.failing = false
+		return e, nil
+	}
+	if l.failing {
+		return e, nil
+	}
+	l.failing = true
+	return e, err
+}
+
+func (l *Log) writeLocked(e Entry) error {
+	if l.file == nil {
+		if l.path == "" {
+			return nil
+		}
+		if err := l.openFile(); err != nil {
+			return err
+		}
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if l.size > 0 && l.size+int64(len(line)) > MaxFileSize {
+		if err := l.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	return nil
+}
+
+// rotateLocked moves the file to <path>.1 and starts a new one.
+func (l *Log) rotateLocked() error {
+	l.file.Close()
+	l.file = nil
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return fmt.Errorf("rotate audit log: %w", err)
+	}
+	return l.openFile()
+}
+
+// Query returns the entries matching q, newest first.
+func (l *Log) Query(q Query) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := []Entry{}
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		e := &l.entries[i]
+		if !q.match(e) {
+			continue
+		}
+		out = append(out, *e)
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+	}
+	return out
+}
+
+// Close closes the file; later entries are kept in memory only.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	l.path = ""
+	return err
+}
@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+func TestLog_RecordAndQuery(t *testing.T) {
+	l, err := Open("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	l.Record(adb.CommandRecord{Serial: "a", Service: "shell", Command: "getprop ro.serialno", Start: start,
+		Duration: 12 * time.Millisecond, Bytes: 9, ExitCode: adb.ShellExitUnknown})
+	l.Record(adb.CommandRecord{Serial: "b", Service: "shell,v2,raw", Command: "pm list packages", Start: start.Add(time.Second),
+		Bytes: 2048, ExitCode: 1})
+	l.Record(adb.CommandRecord{Serial: "a", Service: "sync", Command: "pull /sdcard/x.mp4", Start: start.Add(2 * time.Second),
+		ExitCode: adb.ShellExitUnknown, Err: errors.New("no such file")})
+
+	all := l.Query(Query{})
+	if len(all) != 3 || all[0].ID != 3 || all[2].ID != 1 {
+		t.Fatalf("entries = %+v", all)
+	}
+	if e := all[2]; e.DurationMs != 12 || e.Bytes != 9 || e.ExitCode != nil {
+		t.Errorf("entry = %+v", e)
+	}
+	if got := l.Query(Query{Service: "shell"}); len(got) != 2 {
+		t.Errorf("shell entries = %d, want 2", len(got))
+	}
+	if got := l.Query(Query{Serial: "a", Command: "getprop"}); len(got) != 1 || got[0].ID != 1 {
+		t.Errorf("getprop entries = %+v", got)
+	}
+	if got := l.Query(Query{Failed: true}); len(got) != 2 {
+		t.Errorf("failed entries = %d, want 2", len(got))
+	}
+	if got := l.Query(Query{From: start.Add(time.Second), Limit: 1}); len(got) != 1 || got[0].ID != 3 {
+		t.Errorf("limited entries = %+v", got)
+	}
+}
+
+func TestLog_Persisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []string{"one", "two", "three"} {
+		if _, err := l.Add(Entry{Time: time.Now(), Serial: "a", Service: "shell", Command: cmd}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := l.Query(Query{}); len(got) != 2 {
+		t.Errorf("in memory = %d, want 2", len(got))
+	}
+	l.Close()
+
+	l, err = Open(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := l.Query(Query{})
+	if len(got) != 2 || got[0].Command != "three" || got[1].Command != "two" {
+		t.Fatalf("reloaded = %+v", got)
+	}
+	// IDs continue after the reload.
+	if e, _ := l.Add(Entry{Serial: "a", Service: "shell"}); e.ID != 4 {
+		t.Errorf("next ID = %d, want 4", e.ID)
+	}
+}
@@ -0,0 +1,158 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adbbin"
+)
+
+// adbInfo is the result of GET /api/adb/info and the payload of
+// adb:outdated.
+type adbInfo struct {
+	// Path is the local ADB binary; empty with a remote server or when no
+	// binary was found.
+	Path          string          `json:"path,omitempty"`
+	BinaryVersion *adbbin.Version `json:"binary_version,omitempty"`
+	ServerVersion *adbbin.Version `json:"server_version,omitempty"`
+	// Version is the version compatibility is judged by: the server's when
+	// it is reachable, since that is what the monitor talks to, else the
+	// binary's.
+	Version    string      `json:"version"`
+	MinVersion string      `json:"min_version"`
+	Supported  bool        `json:"supported"`
+	Features   adbFeatures `json:"features"`
+	// HostFeatures is the server's own feature list (host:host-features).
+	HostFeatures []string `json:"host_features,omitempty"`
+	// Supervisor is what the supervisor of a local server last found.
+	Supervisor *adbbin.SupervisorStatus `json:"supervisor,omitempty"`
+	// Warning asks to upgrade when the version is unsupported.
+	Warning string `json:"warning,omitempty"`
+}
+
+// adbFeatures are the ADB capabilities the monitor relies on.
+type adbFeatures struct {
+	TrackDevicesL bool `json:"track_devices_l"`
+	ShellV2       bool `json:"shell_v2"`
+}
+
+// binaryVersion returns the parsed `adb version` of the local binary, run
+// once since the binary does not change while we run.
+func (a *App) binaryVersion() (*adbbin.Version, error) {
+	if a.adbBin == nil {
+		return nil, errors.New("no local ADB binary")
+	}
+	a.adbVersionOnce.Do(func() {
+		v, err := a.adbBin.ParsedVersion()
+		if err != nil {
+			a.adbVersionErr = err
+			return
+		}
+		a.adbVersion = &v
+	})
+	return a.adbVersion, a.adbVersionErr
+}
+
+// ADBInfo reports the ADB binary and server versions and whether they are
+// recent enough for the monitor.
+func (a *App) ADBInfo(ctx context.Context) (adbInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	info := adbInfo{MinVersion: adbbin.MinVersion.String()}
+	if a.adbBin != nil {
+		info.Path = a.adbBin.Path()
+		if st, ok := a.adbBin.SupervisorStatus(); ok {
+			info.Supervisor = &st
+		}
+	}
+	binary, binErr := a.binaryVersion()
+	info.BinaryVersion = binary
+
+	var effective *adbbin.Version
+	raw, srvErr := a.client.ServerVersion(ctx)
+	if srvErr == nil {
+		// host:version answers with the protocol version in hex.
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 16, 32)
+		if err != nil {
+			srvErr = errors.New("unexpected server version " + strconv.Quote(raw))
+		} else {
+			v := adbbin.ServerVersion(int(n))
+			if binary != nil && !binary.Less(v) && !v.Less(*binary) {
+				v.Revision = binary.Revision // the server is our binary
+			}
+			info.ServerVersion = &v
+			effective = &v
+		}
+	}
+	if effective == nil {
+		effective = binary
+	}
+	if effective == nil {
+		if a.adbBin == nil {
+			return info, srvErr
+		}
+		return info, errors.Join(srvErr, binErr)
+	}
+
+	info.Version = effective.String()
+	info.Supported = effective.Supported()
+	info.Warning = effective.UpgradeHint()
+	info.Features = adbFeatures{
+		TrackDevicesL: effective.SupportsTrackDevicesL(),
+		ShellV2:       effective.SupportsShellV2(),
+	}
+	if srvErr == nil {
+		if features, err := a.client.HostFeatures(ctx); err == nil {
+			info.HostFeatures = features
+			info.Features.ShellV2 = slices.Contains(features, "shell_v2")
+		}
+	}
+	return info, nil
+}
+
+// checkADBVersion warns, in the log and as adb:outdated, when the ADB in use
+// is older than adbbin.MinVersion.
+func (a *App) checkADBVersion(ctx context.Context) {
+	info, err := a.ADBInfo(ctx)
+	if err != nil {
+		a.log.Debug("ADB version check failed", "error", err)
+		return
+	}
+	if info.Warning != "" {
+		a.log.Warn("unsupported ADB version", "version", info.Version, "min", info.MinVersion, "path", info.Path)
+		a.sse.Broadcast("adb:outdated", info)
+	}
+}
+
+func (a *App) handleGetADBInfo(w http.ResponseWriter, r *http.Request) {
+	info, err := a.ADBInfo(r.Context())
+	if err != nil {
+		writeADBError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// superviseADBServer has the local ADB server checked with host:version
+// every a.adbRestart and started again when it does not answer, its log
+// rotated, and adb_server_down and adb_server_up published. The tracker
+// then reconnects and reports adb:server_restarted, which resumes the
+// interrupted captures.
+func (a *App) superviseADBServer(ctx context.Context) {
+	a.adbBin.Supervise(ctx, adbbin.SupervisorConfig{
+		Check: func(ctx context.Context) error {
+			_, err := a.client.ServerVersion(ctx)
+			return err
+		},
+		Interval:   a.adbRestart,
+		Bus:        a.bus,
+		LogMaxSize: a.adbLogMaxSize,
+		LogKeep:    a.adbLogKeep,
+	})
+}
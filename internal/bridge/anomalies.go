@@ -0,0 +1,102 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/anomaly"
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/notify"
+)
+
+// runAnomalies closes an anomaly detection window every detector window
+// until ctx is done.
+func (a *App) runAnomalies(ctx context.Context) {
+	ticker := time.NewTicker(a.anomalies.Window())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.reportAnomalies(a.anomalies.Tick(now, a.capturing))
+		}
+	}
+}
+
+// capturing reports whether a capture is running on serial.
+func (a *App) capturing(serial string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.captures[serial]
+	return ok
+}
+
+func (a *App) observePacket(pkt capture.NetworkPacket) {
+	if a.anomalies != nil {
+		a.reportAnomalies(a.anomalies.ObservePacket(pkt))
+	}
+}
+
+func (a *App) observeConnection(conn capture.Connection) {
+	if a.anomalies != nil {
+		a.reportAnomalies(a.anomalies.ObserveConnection(conn))
+	}
+}
+
+// reportAnomalies sends anomaly:detected to the dashboard and fires
+// traffic_anomaly webhooks.
+func (a *App) reportAnomalies(found []anomaly.Anomaly) {
+	for _, an := range found {
+		a.sse.Broadcast("anomaly:detected", an)
+
+		subject := "device " + an.Serial
+		if an.App != "" {
+			subject = fmt.Sprintf("%s on %s", an.App, an.Serial)
+		}
+		details := map[string]string{"kind": string(an.Kind), "app": an.App}
+		var msg string
+		if an.Kind == anomaly.KindNewDestination {
+			msg = fmt.Sprintf("%s talked to new destination %s", subject, an.Destination)
+			details["destination"] = an.Destination
+		} else {
+			msg = fmt.Sprintf("%s moved %.0f %s in %s against a baseline of %.0f",
+				subject, an.Observed, an.Metric, a.anomalies.Window(), an.Baseline)
+			details["metric"] = string(an.Metric)
+			details["observed"] = strconv.FormatFloat(an.Observed, 'f', 0, 64)
+			details["baseline"] = strconv.FormatFloat(an.Baseline, 'f', 1, 64)
+		}
+		a.log.Info("traffic anomaly", "serial", an.Serial, "app", an.App, "kind", an.Kind, "destination", an.Destination)
+		a.notifier.Notify(notify.Notification{
+			Trigger:   notify.TriggerTrafficAnomaly,
+			Serial:    an.Serial,
+			Message:   msg,
+			Details:   details,
+			Timestamp: an.Timestamp,
+		})
+	}
+}
+
+// ============================================
+// HTTP Handlers
+// ============================================
+
+func (a *App) handleGetAnomalies(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.anomalies.Recent(r.URL.Query().Get("serial"), queryInt(r, "n", 100)))
+}
+
+func (a *App) handleGetBaselines(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.anomalies.Baselines(r.URL.Query().Get("serial")))
+}
+
+func (a *App) handleResetBaseline(w http.ResponseWriter, r *http.Request) {
+	if !a.anomalies.Reset(r.PathValue("serial")) {
+		writeError(w, http.StatusNotFound, "no baseline for device")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "reset"})
+}
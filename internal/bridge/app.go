@@ -3,20 +3,56 @@ package bridge
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io/fs"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/adbbin"
+	"github.com/imcanugur/go-adb-monitor/internal/anomaly"
+	"github.com/imcanugur/go-adb-monitor/internal/audit"
 	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/correlate"
+	"github.com/imcanugur/go-adb-monitor/internal/downloads"
+	"github.com/imcanugur/go-adb-monitor/internal/elastic"
 	"github.com/imcanugur/go-adb-monitor/internal/event"
+	"github.com/imcanugur/go-adb-monitor/internal/graphql"
+	"github.com/imcanugur/go-adb-monitor/internal/health"
+	"github.com/imcanugur/go-adb-monitor/internal/intel"
+	"github.com/imcanugur/go-adb-monitor/internal/inventory"
+	"github.com/imcanugur/go-adb-monitor/internal/labels"
+	"github.com/imcanugur/go-adb-monitor/internal/linkstat"
+	"github.com/imcanugur/go-adb-monitor/internal/monitor"
+	"github.com/imcanugur/go-adb-monitor/internal/netstate"
+	"github.com/imcanugur/go-adb-monitor/internal/notify"
 	"github.com/imcanugur/go-adb-monitor/internal/pool"
+	"github.com/imcanugur/go-adb-monitor/internal/processor"
+	"github.com/imcanugur/go-adb-monitor/internal/registry"
+	"github.com/imcanugur/go-adb-monitor/internal/report"
+	"github.com/imcanugur/go-adb-monitor/internal/schedule"
+	"github.com/imcanugur/go-adb-monitor/internal/sink"
 	"github.com/imcanugur/go-adb-monitor/internal/store"
+	"github.com/imcanugur/go-adb-monitor/internal/teams"
+	"github.com/imcanugur/go-adb-monitor/internal/timeseries"
 	"github.com/imcanugur/go-adb-monitor/internal/tracker"
 )
 
+const (
+	// DefaultDrainTimeout is how long Shutdown waits for captures to drain.
+	DefaultDrainTimeout = 10 * time.Second
+	// captureCleanupTimeout bounds the device cleanup after one capture.
+	captureCleanupTimeout = 5 * time.Second
+	// captureWarmupTimeout bounds the checks POST /api/capture/start/{serial}
+	// runs before answering, deploying tcpdump included.
+	captureWarmupTimeout = 90 * time.Second
+)
+
 // App is the main application controller.
 // It wires ADB tracking, network capture, and exposes HTTP API + SSE events.
 type App struct {
@@ -24,22 +60,126 @@ type App struct {
 	cancel context.CancelFunc
 	log    *slog.Logger
 
-	client  *adb.Client
-	bus     *event.Bus
-	tracker *tracker.Tracker
-	store   *store.Store
-	pool    *pool.Pool
-	sse     *SSEHub
+	client    *adb.Client
+	bus       *event.Bus
+	tracker   *tracker.Tracker
+	store     *store.Store
+	pool      *pool.Pool
+	sse       *SSEHub
+	notifier  *notify.Notifier
+	health    *health.Tracker
+	packages  *inventory.Tracker
+	network   *netstate.Tracker
+	links     *linkstat.Tracker
+	labels    *labels.Store
+	registry  *registry.Registry
+	audit     *audit.Log
+	teams     *teams.Teams
+	schedules *schedule.Store
+	series    *timeseries.Store
+	downloads *downloads.Store
+	traces    *correlate.Correlator
+	props     *monitor.PropStore
+	monitor   *monitor.Monitor // nil when property collection is off
+	anomalies *anomaly.Detector
+	reports   *report.Reporter
+	threats   *intel.Matcher
+	enrichers []capture.Enricher
+	processor *processor.Processor // nil when no processor is configured
+	sink      *sink.Sink           // nil when no broker is configured
+	elastic   *elastic.Exporter    // nil when no cluster is configured
+	deltas    *storeDeltas
+	batcher   *packetBatcher
+
+	readOnly            bool
+	authRequired        bool
+	basePath            string
+	adminToken          string
+	errorSpikeThreshold int
+	graphqlEnabled      bool
+	tcpdumpBins         fs.FS
+	vpnAPK              string
+	captureBuffer       capture.BufferConfig
+	captureSampling     capture.SamplingConfig
+	authRetry           time.Duration
+	adbRestart          time.Duration
+	adbLogMaxSize       int64
+	adbLogKeep          int
+	drainTimeout        time.Duration
+	batteryPauseLevel   int
+	batteryResumeLevel  int
+	batteryDrainWarn    float64
+	rolloutParallel     int
+	// snapshotFile is where the store is snapshotted, "" if nowhere.
+	snapshotFile string
+
+	graphqlOnce sync.Once
+	graphql     *graphql.Schema
+
+	openAPIOnce sync.Once
+	openAPIDoc  map[string]any
+
+	execSeq    atomic.Uint64 // bulk exec run IDs
+	rolloutSeq atomic.Uint64 // capture rollout IDs
+
+	exporters sync.WaitGroup // running sink and Elasticsearch exporter
+
+	adbBin         *adbbin.Manager
+	adbVersionOnce sync.Once
+	adbVersion     *adbbin.Version
+	adbVersionErr  error
 
 	mu       sync.Mutex
 	captures map[string]*deviceCapture // serial -> active capture
 	devices  map[string]adb.Device     // serial -> device
+	resume   map[string]pendingResume  // serial -> the interrupted capture
+	// batteryPaused are the captures paused for a low battery, waiting for
+	// their device to charge.
+	batteryPaused map[string]batteryPause
+	// rollouts are the recent start-alls, oldest first.
+	rollouts []*captureRollout
+
+	recordings map[string]*screenRecording // serial -> running screenrecord, nil while starting
+
+	disconnects  map[string]uint64    // serial -> times dropped off the ADB server
+	unauthorized map[string]time.Time // serial -> since when it is unauthorized
+	scheduled    map[string]string    // serial -> schedule that started its capture
+
+	deviceProps map[string]map[string]string // serial -> last collected properties
+
+	scheduleMu sync.Mutex // serializes applySchedules
+
+	threatMu     sync.Mutex
+	threatAlerts map[string]time.Time // serial and threat -> last threat:detected
+
+	tlsMu     sync.Mutex
+	tlsAlerts map[string]time.Time // serial, server and issue -> last tls:weak
+
+	batteryMu       sync.Mutex
+	drainWarned     map[string]time.Time         // serial -> last battery:drain
+	batteryWarnings map[batteryWarningKey]uint64 // for /api/metrics
 }
 
 // deviceCapture tracks per-device capture state.
 type deviceCapture struct {
 	engine *capture.Engine
+	spec   captureSpec
 	cancel context.CancelFunc
+	// started is when the capture was asked for.
+	started time.Time
+	// done is closed once the engine has stopped, its buffered data is
+	// in the store and the device is cleaned up.
+	done chan struct{}
+}
+
+// captureSpec is how a capture was asked for, so an interrupted one
+// resumes the same way.
+type captureSpec struct {
+	mode     capture.Mode
+	buffer   capture.BufferConfig
+	sampling capture.SamplingConfig
+	// app restricts the capture to one package, unless "".
+	app string
 }
 
 // Config holds application configuration.
@@ -47,6 +187,190 @@ type Config struct {
 	ADBAddr     string
 	MaxWorkers  int
 	StoreConfig store.Config
+
+	// MaxTasksPerDevice caps the pool tasks running at once for one
+	// device, counting its capture. Zero leaves it uncapped.
+	MaxTasksPerDevice int
+
+	// Events configures the internal device event bus: the queue length
+	// of each subscriber and what happens when one fills up. The buffer
+	// defaults to 1024 events.
+	Events event.Config
+
+	// ADB is the local ADB binary, if any; it backs the version checks of
+	// /api/adb/info.
+	ADB *adbbin.Manager
+	// ADBRestartInterval is how often the ADB server is checked; a server
+	// that does not answer is started again with ADB. Zero disables the
+	// checks, as does a nil ADB.
+	ADBRestartInterval time.Duration
+	// ADBLogMaxSize and ADBLogKeep rotate the log of a supervised server;
+	// see adbbin.SupervisorConfig.
+	ADBLogMaxSize int64
+	ADBLogKeep    int
+
+	// ReadOnly disables every endpoint that changes server or device state
+	// (capture control, clearing data). Live views and SSE keep working.
+	ReadOnly bool
+
+	// BasePath is the path prefix the server is mounted under (see
+	// WithBasePath), "" at the root. It is advertised to the dashboard and
+	// in the OpenAPI document.
+	BasePath string
+
+	// AuthRequired tells the dashboard that the API needs a token
+	// (RequireToken wraps the server).
+	AuthRequired bool
+
+	// AdminToken must be presented to the device control endpoints
+	// (reboot, root, remount). Empty disables them.
+	AdminToken string
+
+	// Labels holds operator-assigned device names, groups and tags. Nil
+	// keeps them in memory only.
+	Labels *labels.Store
+
+	// Registry remembers every device seen: first seen, reconnects and
+	// uptime, across restarts. Nil keeps it in memory only.
+	Registry *registry.Registry
+
+	// Audit logs every command run on a device. Nil keeps it in memory
+	// only.
+	Audit *audit.Log
+
+	// Teams assigns devices and tokens to teams; a team's tokens see and
+	// control only its devices. Nil gives every token every device.
+	Teams *teams.Teams
+
+	// Schedules holds capture schedules. Nil keeps them in memory only.
+	Schedules *schedule.Store
+
+	// Metrics holds the sampled device metrics served by
+	// /api/devices/{serial}/metrics. Nil keeps them in memory only.
+	Metrics *timeseries.Store
+
+	// Downloads keeps files pulled from devices, such as screen
+	// recordings. Nil disables them.
+	Downloads *downloads.Store
+
+	// SnapshotFile is where POST /api/store/snapshot writes the store and
+	// RestoreSnapshot reads it from. Empty disables snapshots.
+	SnapshotFile string
+
+	// TraceWindow is how far apart the URL, DNS lookup and connection of
+	// one request may be and still be traced as one flow;
+	// correlate.DefaultWindow if zero.
+	TraceWindow time.Duration
+
+	// Props is the set of system properties, dumpsys sections and shell
+	// probes collected from every online device, changeable through
+	// PUT /api/monitor/props. Nil collects monitor.DefaultPropSet.
+	Props *monitor.PropStore
+	// PropInterval is how often the properties are collected. Zero
+	// disables collection.
+	PropInterval time.Duration
+
+	// Anomalies learns traffic baselines from every capture and reports
+	// departures from them. Nil disables anomaly detection.
+	Anomalies *anomaly.Detector
+
+	// Reports summarizes every capture's traffic per device and app into
+	// daily and weekly reports. Nil disables reports.
+	Reports *report.Reporter
+
+	// Threats matches traffic against threat-intelligence feeds, which
+	// are loaded at startup and refreshed in the background. Nil disables
+	// matching.
+	Threats *intel.Matcher
+
+	// Enrichers run on every capture's packets and connections after the
+	// built-in DNS, UID and threat enrichers, e.g. to tag addresses with
+	// their owner from an asset database. They are shared by all captures,
+	// so they must be safe for concurrent use.
+	Enrichers []capture.Enricher
+	// Processor sends packets, connections and device events to an
+	// external command or HTTP endpoint and applies its annotations. It
+	// runs after Enrichers. Nil disables it.
+	Processor *processor.Processor
+
+	// Sink publishes captured packets, connections and device events to
+	// a message broker. Nil disables it.
+	Sink *sink.Sink
+	// Elastic bulk-indexes captured packets and connections into
+	// Elasticsearch or OpenSearch. Nil disables it.
+	Elastic *elastic.Exporter
+
+	// Notify configures webhook delivery retries.
+	Notify notify.Config
+	// Notifier delivers the webhooks created through the API. Nil keeps
+	// them in memory only, delivered as Notify configures.
+	Notifier *notify.Notifier
+	// Webhooks are registered with the notifier at startup, in addition to
+	// any created through the API. They are not saved.
+	Webhooks []notify.Webhook
+	// ErrorSpikeThreshold is the number of capture errors per sampling
+	// interval that fires a capture_error_spike notification.
+	ErrorSpikeThreshold int
+
+	// GraphQL enables the read-only /api/graphql endpoint.
+	GraphQL bool
+
+	// TcpdumpBinaries holds static tcpdump builds pushed to rooted devices
+	// that lack tcpdump, named as capture.TcpdumpBinaryName returns. Nil
+	// disables deployment.
+	TcpdumpBinaries fs.FS
+
+	// VPNCompanionAPK is the path of the VpnService companion APK installed
+	// on devices that lack it when capturing in vpn mode. Empty requires it
+	// to be installed already.
+	VPNCompanionAPK string
+
+	// CaptureBuffer sizes the output channels of each capture and says
+	// what happens when its consumer falls behind. A capture started
+	// through the API may override it.
+	CaptureBuffer capture.BufferConfig
+	// CaptureSampling thins out the packets of each capture: one in N,
+	// and caps on packets and bytes per second. A capture started
+	// through the API may override it.
+	CaptureSampling capture.SamplingConfig
+
+	// BatteryPauseLevel pauses a device's capture when its battery
+	// discharges to this level or below, and BatteryResumeLevel resumes it
+	// once the device has charged back to that level. A zero pause level
+	// disables pausing; the resume level is raised to 10 points above the
+	// pause level if it is not higher.
+	BatteryPauseLevel  int
+	BatteryResumeLevel int
+	// BatteryDrainWarn is the battery drain, in percent per hour, at which
+	// a capturing device raises battery:drain. Zero disables the warning.
+	BatteryDrainWarn float64
+
+	// CaptureRolloutParallel is how many captures a start-all prepares
+	// at once; DefaultCaptureRolloutParallel if zero.
+	CaptureRolloutParallel int
+
+	// DrainTimeout bounds how long Shutdown waits for captures to flush
+	// their buffered data and kill tcpdump on their devices;
+	// DefaultDrainTimeout if zero.
+	DrainTimeout time.Duration
+
+	// AuthRetryInterval is how long a device may stay unauthorized before
+	// the ADB server is asked to reconnect it, which prompts for
+	// authorization again; retries repeat at that interval. Zero disables
+	// them.
+	AuthRetryInterval time.Duration
+
+	// PacketBatchInterval and PacketBatchSize control how captured packets
+	// are coalesced into packets:batch events: a batch is sent every
+	// interval, or once it holds size packets. Zero selects
+	// DefaultPacketBatchInterval and DefaultPacketBatchSize.
+	PacketBatchInterval time.Duration
+	PacketBatchSize     int
+
+	// SSEClientRate caps the events per second sent to each SSE client;
+	// events over the limit are dropped for that client. Zero disables the
+	// limit.
+	SSEClientRate float64
 }
 
 // NewApp creates the application controller.
@@ -57,24 +381,151 @@ func NewApp(log *slog.Logger, cfg Config) *App {
 	if cfg.MaxWorkers <= 0 {
 		cfg.MaxWorkers = 100
 	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = DefaultDrainTimeout
+	}
+	if cfg.ErrorSpikeThreshold <= 0 {
+		cfg.ErrorSpikeThreshold = notify.DefaultErrorSpikeThreshold
+	}
+	if cfg.CaptureRolloutParallel <= 0 {
+		cfg.CaptureRolloutParallel = DefaultCaptureRolloutParallel
+	}
+	if cfg.BatteryResumeLevel <= cfg.BatteryPauseLevel {
+		cfg.BatteryResumeLevel = min(cfg.BatteryPauseLevel+10, 100)
+	}
 
 	client := adb.NewClient(cfg.ADBAddr)
-	bus := event.NewBus(1024)
+	if cfg.Events.BufferSize <= 0 {
+		cfg.Events.BufferSize = 1024
+	}
+	if cfg.Events.Log == nil {
+		cfg.Events.Log = log
+	}
+	bus := event.NewBusWithConfig(cfg.Events)
 	dataStore := store.New(cfg.StoreConfig)
 	workerPool := pool.New(cfg.MaxWorkers, log)
+	workerPool.SetMaxPerDevice(cfg.MaxTasksPerDevice)
 	deviceTracker := tracker.New(client, bus, log)
 
-	return &App{
-		log:      log.With("component", "bridge"),
-		client:   client,
-		bus:      bus,
-		tracker:  deviceTracker,
-		store:    dataStore,
-		pool:     workerPool,
-		sse:      NewSSEHub(),
-		captures: make(map[string]*deviceCapture),
-		devices:  make(map[string]adb.Device),
+	if cfg.Labels == nil {
+		cfg.Labels, _ = labels.Open("")
 	}
+	if cfg.Schedules == nil {
+		cfg.Schedules, _ = schedule.Open("")
+	}
+	if cfg.Metrics == nil {
+		cfg.Metrics, _ = timeseries.Open("", 0)
+	}
+	if cfg.Downloads == nil {
+		cfg.Downloads = downloads.Open("")
+	}
+	if cfg.Registry == nil {
+		cfg.Registry, _ = registry.Open("")
+	}
+	if cfg.Audit == nil {
+		cfg.Audit, _ = audit.Open("", 0)
+	}
+	if cfg.Props == nil {
+		cfg.Props, _ = monitor.OpenProps("")
+	}
+	var deviceMonitor *monitor.Monitor
+	if cfg.PropInterval > 0 {
+		deviceMonitor = monitor.New(client, bus, log, monitor.Config{
+			PropInterval:      cfg.PropInterval,
+			SuppressUnchanged: true,
+			Props:             cfg.Props,
+		})
+	}
+
+	notifier := cfg.Notifier
+	if notifier == nil {
+		notifier = notify.New(log, cfg.Notify)
+	}
+	for _, w := range cfg.Webhooks {
+		if _, err := notifier.AddConfigured(w); err != nil {
+			log.Warn("ignoring configured webhook", "url", w.URL, "error", err)
+		}
+	}
+
+	sse := NewSSEHub(cfg.SSEClientRate)
+	sse.owns = cfg.Teams.Owns
+
+	a := &App{
+		log:       log.With("component", "bridge"),
+		client:    client,
+		bus:       bus,
+		tracker:   deviceTracker,
+		store:     dataStore,
+		pool:      workerPool,
+		sse:       sse,
+		notifier:  notifier,
+		health:    health.NewTracker(),
+		packages:  inventory.NewTracker(),
+		network:   netstate.NewTracker(),
+		links:     linkstat.NewTracker(),
+		labels:    cfg.Labels,
+		registry:  cfg.Registry,
+		audit:     cfg.Audit,
+		teams:     cfg.Teams,
+		schedules: cfg.Schedules,
+		series:    cfg.Metrics,
+		downloads: cfg.Downloads,
+		traces:    correlate.New(correlate.Config{Window: cfg.TraceWindow}),
+		props:     cfg.Props,
+		monitor:   deviceMonitor,
+		anomalies: cfg.Anomalies,
+		reports:   cfg.Reports,
+		threats:   cfg.Threats,
+		enrichers: cfg.Enrichers,
+		processor: cfg.Processor,
+		sink:      cfg.Sink,
+		elastic:   cfg.Elastic,
+		deltas:    newStoreDeltas(),
+		batcher:   newPacketBatcher(cfg.PacketBatchInterval, cfg.PacketBatchSize),
+		captures:  make(map[string]*deviceCapture),
+		devices:   make(map[string]adb.Device),
+		resume:    make(map[string]pendingResume),
+
+		batteryPaused: make(map[string]batteryPause),
+
+		recordings: make(map[string]*screenRecording),
+
+		disconnects:  make(map[string]uint64),
+		unauthorized: make(map[string]time.Time),
+		scheduled:    make(map[string]string),
+
+		deviceProps: make(map[string]map[string]string),
+
+		threatAlerts: make(map[string]time.Time),
+		tlsAlerts:    make(map[string]time.Time),
+
+		drainWarned:     make(map[string]time.Time),
+		batteryWarnings: make(map[batteryWarningKey]uint64),
+
+		readOnly:            cfg.ReadOnly,
+		snapshotFile:        cfg.SnapshotFile,
+		authRequired:        cfg.AuthRequired,
+		basePath:            cfg.BasePath,
+		adminToken:          cfg.AdminToken,
+		errorSpikeThreshold: cfg.ErrorSpikeThreshold,
+		graphqlEnabled:      cfg.GraphQL,
+		tcpdumpBins:         cfg.TcpdumpBinaries,
+		vpnAPK:              cfg.VPNCompanionAPK,
+		captureBuffer:       cfg.CaptureBuffer,
+		captureSampling:     cfg.CaptureSampling,
+		authRetry:           cfg.AuthRetryInterval,
+		adbRestart:          cfg.ADBRestartInterval,
+		adbLogMaxSize:       cfg.ADBLogMaxSize,
+		adbLogKeep:          cfg.ADBLogKeep,
+		drainTimeout:        cfg.DrainTimeout,
+		batteryPauseLevel:   cfg.BatteryPauseLevel,
+		batteryResumeLevel:  cfg.BatteryResumeLevel,
+		batteryDrainWarn:    cfg.BatteryDrainWarn,
+		rolloutParallel:     cfg.CaptureRolloutParallel,
+		adbBin:              cfg.ADB,
+	}
+	client.SetAuditor(a.recordCommand)
+	return a
 }
 
 // Startup initializes the application: starts the device tracker, subscribes to events.
@@ -85,6 +536,97 @@ func (a *App) Startup(ctx context.Context) {
 	// Subscribe to device events for internal tracking + SSE emission.
 	a.bus.Subscribe("bridge_devices", a.handleDeviceEvent)
 
+	// Webhook notifications for device and capture conditions.
+	a.bus.Subscribe("notify", a.notifier.HandleEvent)
+	go a.notifier.Run(a.ctx)
+	go a.watchCaptureErrors(a.ctx)
+
+	// Periodic traffic aggregates for dashboard charts.
+	go a.broadcastTraffic(a.ctx)
+
+	// Per-device health scores, sampled into the metric histories.
+	go a.probeHealth(a.ctx)
+	go a.probeLinks(a.ctx)
+	go a.saveMetrics(a.ctx)
+
+	// Foreground app tracking, package inventories and network state.
+	go a.trackForeground(a.ctx)
+	go a.trackPackages(a.ctx)
+	go a.trackNetwork(a.ctx)
+
+	// Warn about an ADB too old for device tracking.
+	go a.checkADBVersion(a.ctx)
+
+	// Bring a local ADB server back when it dies.
+	if a.adbRestart > 0 && a.adbBin != nil {
+		go a.superviseADBServer(a.ctx)
+	}
+
+	// Re-prompt devices left unauthorized.
+	if a.authRetry > 0 {
+		go a.retryUnauthorized(a.ctx)
+	}
+
+	// Scheduled capture windows.
+	go a.runSchedules(a.ctx)
+
+	// Traffic anomaly detection.
+	if a.anomalies != nil {
+		go a.runAnomalies(a.ctx)
+	}
+
+	// Daily and weekly traffic reports.
+	if a.reports != nil {
+		a.exporters.Add(1)
+		go func() {
+			defer a.exporters.Done()
+			a.reports.Run(a.ctx)
+		}()
+	}
+
+	// Threat-intelligence feeds.
+	if a.threats != nil {
+		go func() {
+			a.threats.Load(a.ctx)
+			a.threats.Run(a.ctx)
+		}()
+	}
+
+	// Packets, connections and device events for an external processor.
+	if a.processor != nil {
+		a.bus.Subscribe("processor", a.processor.Event)
+		a.exporters.Add(1)
+		go func() {
+			defer a.exporters.Done()
+			a.processor.Run(a.ctx)
+		}()
+	}
+
+	// Packets, connections and device events for an external broker.
+	if a.sink != nil {
+		a.bus.Subscribe("sink", a.sink.Event)
+		a.exporters.Add(1)
+		go func() {
+			defer a.exporters.Done()
+			a.sink.Run(a.ctx)
+		}()
+	}
+
+	// Long-term packet and connection history in Elasticsearch.
+	if a.elastic != nil {
+		a.exporters.Add(1)
+		go func() {
+			defer a.exporters.Done()
+			a.elastic.Run(a.ctx)
+		}()
+	}
+
+	// Device properties, dumpsys sections and probes. Subscribed before
+	// the tracker starts, so no device is announced unseen.
+	if a.monitor != nil {
+		a.monitor.Start(a.ctx)
+	}
+
 	// Start the device tracker.
 	go func() {
 		if err := a.tracker.Run(a.ctx); err != nil && a.ctx.Err() == nil {
@@ -92,41 +634,81 @@ func (a *App) Startup(ctx context.Context) {
 		}
 	}()
 
-	// Notify UI on store changes.
-	a.store.SetOnChange(func() {
-		a.sse.Broadcast("store:updated", map[string]interface{}{})
-	})
+	// Stream store changes to the UI in throttled batches.
+	a.store.SetOnChange(a.deltas.add)
+	go a.broadcastStoreDeltas(a.ctx)
+	go a.broadcastPacketBatches(a.ctx)
 }
 
-// Shutdown gracefully stops all captures and background work.
+// Shutdown gracefully stops all captures and background work. Captures are
+// drained first: their buffered packets are stored and tcpdump is killed on
+// the devices, for up to the configured drain timeout.
 func (a *App) Shutdown() {
 	a.log.Info("application shutting down")
-	a.stopAllCaptures()
+	a.drainCaptures(a.drainTimeout)
+	a.stopScreenRecords(a.drainTimeout)
 	a.bus.Close()
 	if a.cancel != nil {
 		a.cancel()
 	}
 	a.pool.Wait()
+	// The exporters flush what the drained captures queued.
+	flushed := make(chan struct{})
+	go func() {
+		a.exporters.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(a.drainTimeout):
+		a.log.Warn("exporters did not flush in time")
+	}
+	if err := a.series.Save(); err != nil {
+		a.log.Warn("failed to save device metrics", "error", err)
+	}
+	if err := a.registry.Close(time.Now()); err != nil {
+		a.log.Warn("failed to save device registry", "error", err)
+	}
+	if err := a.audit.Close(); err != nil {
+		a.log.Warn("failed to close audit log", "error", err)
+	}
+}
+
+// Alive reports whether the application is responsive: its state lock can
+// be taken before ctx is done. A service watchdog pings only while it is.
+func (a *App) Alive(ctx context.Context) error {
+	locked := make(chan struct{})
+	go func() {
+		a.mu.Lock()
+		a.mu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		return errors.New("application state lock is held too long")
+	}
 }
 
 // RegisterRoutes mounts all HTTP API routes on the given mux.
 func (a *App) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("GET /api/devices", a.handleGetDevices)
-	mux.HandleFunc("POST /api/devices/refresh", a.handleRefreshDevices)
-	mux.HandleFunc("GET /api/adb/version", a.handleGetADBVersion)
-	mux.HandleFunc("POST /api/capture/start-all", a.handleStartAllCaptures)
-	mux.HandleFunc("POST /api/capture/stop-all", a.handleStopAllCaptures)
-	mux.HandleFunc("POST /api/capture/start/{serial}", a.handleStartCapture)
-	mux.HandleFunc("POST /api/capture/stop/{serial}", a.handleStopCapture)
-	mux.HandleFunc("GET /api/capture/status", a.handleGetCaptureStatus)
-	mux.HandleFunc("GET /api/packets/{serial}", a.handleGetDevicePackets)
-	mux.HandleFunc("GET /api/packets", a.handleGetRecentPackets)
-	mux.HandleFunc("GET /api/connections/{serial}", a.handleGetDeviceConnections)
-	mux.HandleFunc("GET /api/connections", a.handleGetRecentConnections)
-	mux.HandleFunc("GET /api/store/stats", a.handleGetStoreStats)
-	mux.HandleFunc("GET /api/pool/stats", a.handleGetPoolStats)
-	mux.HandleFunc("POST /api/clear", a.handleClearData)
-	mux.Handle("GET /api/events", a.sse)
+	for _, rt := range a.routes() {
+		mux.HandleFunc(rt.method+" "+rt.path, a.guard(rt, rt.handler))
+	}
+}
+
+// guard wraps h in the checks rt asks for: read-only mode first, then the
+// admin token, then the caller's team.
+func (a *App) guard(rt route, h http.HandlerFunc) http.HandlerFunc {
+	h = a.teamScoped(rt, h)
+	if rt.admin {
+		h = a.admin(h)
+	}
+	if rt.mutating {
+		h = a.mutating(h)
+	}
+	return h
 }
 
 // ============================================
@@ -134,29 +716,74 @@ func (a *App) RegisterRoutes(mux *http.ServeMux) {
 // ============================================
 
 func (a *App) handleDeviceEvent(e event.Event) {
+	a.recordDeviceEvent(e)
+	a.recordIdentity(e)
+
 	switch e.Type {
 	case event.DeviceConnected:
 		if e.Device != nil {
 			a.mu.Lock()
-			a.devices[e.Serial] = *e.Device
+			a.forgetFeaturesLocked(e.Serial)
+			a.putDeviceLocked(*e.Device)
 			a.mu.Unlock()
 		}
-		a.sse.Broadcast("device:connected", e)
+		a.sse.Broadcast("device:connected", a.labeled(e))
+		a.trackAuthorization(e)
+		if e.NewState.IsOnline() {
+			a.ensureDeviceClass(e.Serial)
+			a.ensureDeviceFeatures(e.Serial)
+			a.resumeCapture(e.Serial)
+		}
 
 	case event.DeviceDisconnected:
+		a.health.RecordFlap(e.Serial, e.Timestamp)
+		a.links.Forget(e.Serial)
+		a.client.ForgetDevice(e.Serial)
 		a.mu.Lock()
 		delete(a.devices, e.Serial)
+		delete(a.unauthorized, e.Serial)
+		delete(a.deviceProps, e.Serial)
+		a.disconnects[e.Serial]++
 		a.mu.Unlock()
-		a.StopCapture(e.Serial)
-		a.sse.Broadcast("device:disconnected", e)
+		a.stopCapture(e.Serial)
+		a.store.SetForeground(e.Serial, "", "", e.Timestamp)
+		a.sse.Broadcast("device:disconnected", a.labeled(e))
 
 	case event.DeviceStateChanged:
+		a.health.RecordFlap(e.Serial, e.Timestamp)
 		if e.Device != nil {
 			a.mu.Lock()
-			a.devices[e.Serial] = *e.Device
+			a.forgetFeaturesLocked(e.Serial)
+			a.putDeviceLocked(*e.Device)
 			a.mu.Unlock()
 		}
-		a.sse.Broadcast("device:state_changed", e)
+		a.sse.Broadcast("device:state_changed", a.labeled(e))
+		a.trackAuthorization(e)
+		if e.NewState.IsOnline() {
+			a.ensureDeviceClass(e.Serial)
+			a.ensureDeviceFeatures(e.Serial)
+			a.resumeCapture(e.Serial)
+		}
+
+	case event.DeviceProperties:
+		a.mu.Lock()
+		a.deviceProps[e.Serial] = e.Props
+		a.mu.Unlock()
+
+	case event.DevicePropertiesChanged:
+		a.sse.Broadcast("device:properties_changed", propsChange{Serial: e.Serial, Changes: e.Changes})
+
+	case event.SecurityPropChanged:
+		a.broadcastSecurityChanges(e)
+
+	case event.ADBServerRestarted:
+		a.handleServerRestart()
+
+	case event.ADBServerDown:
+		a.sse.Broadcast("adb:server_down", map[string]string{"reason": e.Reason})
+
+	case event.ADBServerUp:
+		a.sse.Broadcast("adb:server_up", map[string]string{})
 	}
 }
 
@@ -187,46 +814,177 @@ func (a *App) RefreshDevices() ([]adb.Device, error) {
 	}
 
 	a.mu.Lock()
+	prev := a.devices
 	a.devices = make(map[string]adb.Device, len(devices))
-	for _, d := range devices {
-		a.devices[d.Serial] = d
+	for i, d := range devices {
+		if d.Class == adb.ClassUnknown {
+			d.Class = prev[d.Serial].Class
+		}
+		if d.LatencyMs == 0 {
+			d.LatencyMs = prev[d.Serial].LatencyMs
+		}
+		if d.Features == nil {
+			d.Features = prev[d.Serial].Features
+		}
+		devices[i] = a.putDeviceLocked(d)
 	}
 	a.mu.Unlock()
 
-	a.sse.Broadcast("devices:refreshed", devices)
+	for _, d := range devices {
+		a.ensureDeviceClass(d.Serial)
+		a.ensureDeviceFeatures(d.Serial)
+	}
+
+	a.sse.Broadcast("devices:refreshed", a.withHealth(devices))
 	return devices, nil
 }
 
-// StartCapture begins network capture on the specified device.
+// StartCapture begins network capture on the specified device, picking the
+// capture mode automatically.
 func (a *App) StartCapture(serial string) error {
+	return a.StartCaptureMode(serial, capture.ModeAuto)
+}
+
+// StartCaptureMode begins network capture on the specified device in the
+// given mode. It is a no-op when a capture is already running.
+func (a *App) StartCaptureMode(serial string, mode capture.Mode) error {
+	return a.startCapture(serial, captureSpec{mode: mode, buffer: a.captureBuffer, sampling: a.captureSampling})
+}
+
+// startCapture is StartCaptureMode with the rest of the spec. The engine
+// prepares itself once running; a capture that cannot run stops again.
+func (a *App) startCapture(serial string, spec captureSpec) error {
+	engine := a.newCaptureEngine(serial, spec)
+	if engine == nil {
+		return nil
+	}
+	return a.runCapture(serial, spec, engine)
+}
+
+// startCaptureChecked is startCapture that prepares the engine first, so
+// the capture is only started when its checks pass; their failure is
+// returned as a *capture.StartError.
+func (a *App) startCaptureChecked(ctx context.Context, serial string, spec captureSpec) (capture.Mode, error) {
+	engine := a.newCaptureEngine(serial, spec)
+	if engine == nil {
+		return capture.ModeAuto, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, captureWarmupTimeout)
+	defer cancel()
+	if err := engine.Prepare(ctx); err != nil {
+		return capture.ModeAuto, err
+	}
+	return engine.Mode(), a.runCapture(serial, spec, engine)
+}
+
+// newCaptureEngine sets up the engine of a capture, or returns nil if one
+// is running on serial.
+func (a *App) newCaptureEngine(serial string, spec captureSpec) *capture.Engine {
 	a.mu.Lock()
 	if _, running := a.captures[serial]; running {
 		a.mu.Unlock()
 		return nil
 	}
+	// Started by hand, a capture paused for the battery is no longer
+	// waiting to resume.
+	delete(a.batteryPaused, serial)
+	a.mu.Unlock()
+
+	engine := capture.NewEngine(a.client, a.log, serial, spec.mode)
+	a.mu.Lock()
+	engine.SetDeviceClass(a.devices[serial].Class)
 	a.mu.Unlock()
+	engine.SetTcpdumpBinaries(a.tcpdumpBins)
+	engine.SetVPNCompanion(a.vpnAPK)
+	engine.SetBuffer(spec.buffer)
+	engine.SetSampling(spec.sampling)
+	engine.SetApp(spec.app)
+	if a.threats != nil {
+		engine.SetThreatMatcher(a.threats)
+	}
+	for _, en := range a.enrichers {
+		engine.AddEnricher(en)
+	}
+	if a.processor != nil {
+		engine.AddEnricher(a.processor)
+	}
+	return engine
+}
 
-	engine := capture.NewEngine(a.client, a.log, serial, capture.ModeAuto)
+// runCapture runs engine as the capture of serial, unless another capture
+// started there meanwhile.
+func (a *App) runCapture(serial string, spec captureSpec, engine *capture.Engine) error {
 	captureCtx, captureCancel := context.WithCancel(a.ctx)
 
+	dc := &deviceCapture{
+		engine:  engine,
+		spec:    spec,
+		cancel:  captureCancel,
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
 	a.mu.Lock()
-	a.captures[serial] = &deviceCapture{
-		engine: engine,
-		cancel: captureCancel,
+	if _, running := a.captures[serial]; running {
+		a.mu.Unlock()
+		captureCancel()
+		return nil
 	}
+	a.captures[serial] = dc
 	a.mu.Unlock()
 
-	return a.pool.Submit(a.ctx, pool.Task{
-		Name: "capture:" + serial,
+	// Capture startup goes ahead of bulk work queued for other devices.
+	err := a.pool.Submit(captureCtx, pool.Task{
+		Name:     "capture:" + serial,
+		Serial:   serial,
+		Priority: pool.PriorityHigh,
 		Fn: func(ctx context.Context) error {
-			go a.drainPackets(serial, engine.Packets(), captureCtx.Done())
-			go a.drainConnections(serial, engine.Connections(), captureCtx.Done())
+			defer close(dc.done)
+
+			// The drains outlive the capture context so they can flush what
+			// the engine buffered before it stopped.
+			stopped := make(chan struct{})
+			var drains sync.WaitGroup
+			drains.Add(3)
+			go func() {
+				defer drains.Done()
+				a.drainPackets(serial, engine.Packets(), stopped)
+			}()
+			go func() {
+				defer drains.Done()
+				a.drainConnections(serial, engine.Connections(), stopped)
+			}()
+			go func() {
+				defer drains.Done()
+				a.drainClosedConnections(engine.ClosedConnections(), stopped)
+			}()
+			go a.drainDNSLookups(engine.DNSLookups(), captureCtx.Done())
+			go a.drainTLSSessions(engine.TLSSessions(), captureCtx.Done())
+			go a.drainHostnames(engine.Hostnames(), captureCtx.Done())
+			go a.drainDegraded(engine.Degraded(), captureCtx.Done())
+			go a.drainBackpressure(engine.Backpressure(), captureCtx.Done())
 
 			err := engine.Run(captureCtx)
+			close(stopped)
+			drains.Wait()
+
+			cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), captureCleanupTimeout)
+			if cerr := engine.Cleanup(cleanupCtx); cerr != nil {
+				a.log.Warn("capture cleanup failed", "serial", serial, "error", cerr)
+			}
+			cancel()
 
 			a.mu.Lock()
-			delete(a.captures, serial)
+			if a.captures[serial] == dc {
+				delete(a.captures, serial)
+			}
+			// The engine returned without being cancelled: its streams died
+			// under it. Remember the serial so the capture can be resumed
+			// once the transport comes back.
+			if captureCtx.Err() == nil && a.ctx.Err() == nil {
+				a.resume[serial] = pendingResume{since: time.Now(), spec: spec}
+			}
 			a.mu.Unlock()
+			captureCancel()
 
 			a.sse.Broadcast("capture:stopped", map[string]string{
 				"serial": serial,
@@ -234,10 +992,31 @@ func (a *App) StartCapture(serial string) error {
 			return err
 		},
 	})
+	if err != nil {
+		// Stopped, or the app shut down, before a worker was free.
+		a.mu.Lock()
+		if a.captures[serial] == dc {
+			delete(a.captures, serial)
+		}
+		a.mu.Unlock()
+		captureCancel()
+		close(dc.done)
+	}
+	return err
 }
 
 // StopCapture stops network capture on the specified device.
 func (a *App) StopCapture(serial string) {
+	a.mu.Lock()
+	delete(a.resume, serial)
+	delete(a.batteryPaused, serial)
+	a.mu.Unlock()
+	a.stopCapture(serial)
+}
+
+// stopCapture cancels the running capture for serial without clearing any
+// pending resume request.
+func (a *App) stopCapture(serial string) {
 	a.mu.Lock()
 	dc, ok := a.captures[serial]
 	if ok {
@@ -251,29 +1030,42 @@ func (a *App) StopCapture(serial string) {
 	}
 }
 
-// StartAllCaptures begins capture on all connected online devices.
-func (a *App) StartAllCaptures() int {
+// StopAllCaptures stops capture on all devices.
+func (a *App) StopAllCaptures() {
+	a.cancelRollouts(deviceSelector{})
+	a.mu.Lock()
+	a.resume = make(map[string]pendingResume)
+	a.batteryPaused = make(map[string]batteryPause)
+	a.mu.Unlock()
+	a.stopAllCaptures()
+}
+
+// stopCaptures stops capture on the devices matching sel, including ones
+// waiting to be resumed or paused for their battery.
+func (a *App) stopCaptures(sel deviceSelector) {
+	a.cancelRollouts(sel)
 	a.mu.Lock()
 	var serials []string
-	for serial, dev := range a.devices {
-		if dev.State.IsOnline() {
+	for serial := range a.captures {
+		if a.selects(sel, serial) {
+			serials = append(serials, serial)
+		}
+	}
+	for serial := range a.resume {
+		if a.selects(sel, serial) {
+			serials = append(serials, serial)
+		}
+	}
+	for serial := range a.batteryPaused {
+		if a.selects(sel, serial) {
 			serials = append(serials, serial)
 		}
 	}
 	a.mu.Unlock()
 
-	started := 0
 	for _, serial := range serials {
-		if err := a.StartCapture(serial); err == nil {
-			started++
-		}
+		a.StopCapture(serial)
 	}
-	return started
-}
-
-// StopAllCaptures stops capture on all devices.
-func (a *App) StopAllCaptures() {
-	a.stopAllCaptures()
 }
 
 // GetCaptureStatus returns which devices have active captures.
@@ -300,38 +1092,119 @@ func (a *App) GetADBVersion() (string, error) {
 // ============================================
 
 func (a *App) handleGetDevices(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, a.GetDevices())
+	sel := a.selectorFromQuery(r)
+	var devices []adb.Device
+	for _, d := range a.GetDevices() {
+		if a.selects(sel, d.Serial) {
+			devices = append(devices, d)
+		}
+	}
+	writeJSON(w, http.StatusOK, a.withHealth(devices))
 }
 
 func (a *App) handleRefreshDevices(w http.ResponseWriter, r *http.Request) {
 	devices, err := a.RefreshDevices()
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeADBError(w, http.StatusInternalServerError, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, devices)
+	writeJSON(w, http.StatusOK, a.withHealth(devices))
 }
 
 func (a *App) handleGetADBVersion(w http.ResponseWriter, r *http.Request) {
 	version, err := a.GetADBVersion()
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeADBError(w, http.StatusInternalServerError, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"version": version})
 }
 
+// captureStarted is the body of POST /api/capture/start/{serial}.
+type captureStarted struct {
+	Status string `json:"status"`
+	Serial string `json:"serial"`
+	// Mode is the capture mode the checks settled on.
+	Mode string `json:"mode"`
+}
+
 func (a *App) handleStartCapture(w http.ResponseWriter, r *http.Request) {
 	serial := r.PathValue("serial")
 	if serial == "" {
 		writeError(w, http.StatusBadRequest, "serial is required")
 		return
 	}
-	if err := a.StartCapture(serial); err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+	mode, err := capture.ParseMode(r.URL.Query().Get("mode"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	buf := a.captureBuffer
+	if v := r.URL.Query().Get("drop"); v != "" {
+		if buf.Policy, err = capture.ParseDropPolicy(v); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if v := r.URL.Query().Get("buffer"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > capture.MaxBufferSize {
+			writeError(w, http.StatusBadRequest, "buffer must be between 1 and "+strconv.Itoa(capture.MaxBufferSize))
+			return
+		}
+		buf.Size = n
+	}
+	sampling := a.captureSampling
+	if v := r.URL.Query().Get("sample"); v != "" {
+		if sampling.Rate, err = strconv.Atoi(v); err != nil {
+			writeError(w, http.StatusBadRequest, "sample must be an integer")
+			return
+		}
+	}
+	if v := r.URL.Query().Get("max_pps"); v != "" {
+		if sampling.MaxPPS, err = strconv.Atoi(v); err != nil {
+			writeError(w, http.StatusBadRequest, "max_pps must be an integer")
+			return
+		}
+	}
+	if v := r.URL.Query().Get("max_bps"); v != "" {
+		if sampling.MaxBPS, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "max_bps must be an integer")
+			return
+		}
+	}
+	if err := sampling.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	app := r.URL.Query().Get("app")
+	if app != "" && !adb.ValidPackageName(app) {
+		writeError(w, http.StatusBadRequest, "invalid app package name")
+		return
+	}
+	if a.writeDeviceError(w, serial) {
+		return
+	}
+	// The engine looks the app up itself; the inventory only catches a
+	// typo early.
+	if inv, ok := a.packages.Get(serial); ok && app != "" &&
+		!slices.ContainsFunc(inv.Packages, func(p inventory.Package) bool { return p.Name == app }) {
+		writeErrorCode(w, http.StatusNotFound, codeNotFound, app+" is not installed on "+serial)
+		return
+	}
+	a.mu.Lock()
+	_, running := a.captures[serial]
+	a.mu.Unlock()
+	if running {
+		writeErrorCode(w, http.StatusConflict, codeCaptureAlreadyRunning, "capture already running on "+serial)
+		return
+	}
+	settled, err := a.startCaptureChecked(r.Context(), serial, captureSpec{mode: mode, buffer: buf, sampling: sampling, app: app})
+	if err != nil {
+		writeCaptureStartError(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]string{"status": "started", "serial": serial})
+	writeJSON(w, http.StatusOK, captureStarted{Status: "started", Serial: serial, Mode: settled.String()})
 }
 
 func (a *App) handleStopCapture(w http.ResponseWriter, r *http.Request) {
@@ -344,55 +1217,61 @@ func (a *App) handleStopCapture(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "stopped", "serial": serial})
 }
 
-func (a *App) handleStartAllCaptures(w http.ResponseWriter, r *http.Request) {
-	count := a.StartAllCaptures()
-	writeJSON(w, http.StatusOK, map[string]int{"started": count})
-}
-
 func (a *App) handleStopAllCaptures(w http.ResponseWriter, r *http.Request) {
-	a.StopAllCaptures()
+	if sel := a.selectorFromQuery(r); !sel.IsZero() {
+		a.stopCaptures(sel)
+	} else {
+		a.StopAllCaptures()
+	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "stopped"})
 }
 
 func (a *App) handleGetCaptureStatus(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, a.GetCaptureStatus())
-}
-
-func (a *App) handleGetRecentPackets(w http.ResponseWriter, r *http.Request) {
-	n := queryInt(r, "n", 200)
-	writeJSON(w, http.StatusOK, a.store.GetRecentPackets(n))
+	status := a.GetCaptureStatus()
+	if team := a.teamOf(r); team != "" {
+		for serial := range status {
+			if !a.teams.Owns(team, serial) {
+				delete(status, serial)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
 }
 
-func (a *App) handleGetDevicePackets(w http.ResponseWriter, r *http.Request) {
+func (a *App) handleGetDeviceDNS(w http.ResponseWriter, r *http.Request) {
 	serial := r.PathValue("serial")
 	n := queryInt(r, "n", 200)
-	writeJSON(w, http.StatusOK, a.store.GetPacketsBySerial(serial, n))
+	writeJSON(w, http.StatusOK, a.store.GetDNSLookupsBySerial(serial, n))
 }
 
-func (a *App) handleGetRecentConnections(w http.ResponseWriter, r *http.Request) {
-	n := queryInt(r, "n", 200)
-	writeJSON(w, http.StatusOK, a.store.GetRecentConnections(n))
+func (a *App) handleGetStoreStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.store.Stats())
 }
 
-func (a *App) handleGetDeviceConnections(w http.ResponseWriter, r *http.Request) {
-	serial := r.PathValue("serial")
-	n := queryInt(r, "n", 200)
-	writeJSON(w, http.StatusOK, a.store.GetConnectionsBySerial(serial, n))
+func (a *App) handleGetPoolStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.pool.Stats())
 }
 
-func (a *App) handleGetStoreStats(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, a.store.Stats())
+func (a *App) handleCancelPoolTask(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid task id")
+		return
+	}
+	if !a.pool.Cancel(id) {
+		writeError(w, http.StatusNotFound, "no pending task with that id")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "cancelled"})
 }
 
-func (a *App) handleGetPoolStats(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]int{
-		"active":      a.pool.ActiveCount(),
-		"max_workers": a.pool.MaxWorkers(),
-	})
+func (a *App) handleGetBusStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.bus.Stats())
 }
 
 func (a *App) handleClearData(w http.ResponseWriter, r *http.Request) {
 	a.store.Clear()
+	a.traces.Clear()
 	a.sse.Broadcast("store:cleared", map[string]interface{}{})
 	writeJSON(w, http.StatusOK, map[string]string{"status": "cleared"})
 }
@@ -401,32 +1280,190 @@ func (a *App) handleClearData(w http.ResponseWriter, r *http.Request) {
 // Internal helpers
 // ============================================
 
+// drainPackets stores captured packets until done is closed, then flushes
+// the ones still buffered.
 func (a *App) drainPackets(serial string, ch <-chan capture.NetworkPacket, done <-chan struct{}) {
+	handle := func(pkt capture.NetworkPacket) {
+		a.store.AddPacket(pkt)
+		a.traces.AddPacket(pkt)
+		a.batcher.add(pkt)
+		a.observePacket(pkt)
+		a.checkPacketThreat(pkt)
+		if a.reports != nil {
+			a.reports.ObservePacket(pkt)
+		}
+		if a.sink != nil {
+			a.sink.Packet(pkt)
+		}
+		if a.elastic != nil {
+			a.elastic.Packet(pkt)
+		}
+	}
 	for {
 		select {
 		case <-done:
-			return
+			for {
+				select {
+				case pkt := <-ch:
+					handle(pkt)
+				default:
+					return
+				}
+			}
 		case pkt, ok := <-ch:
 			if !ok {
 				return
 			}
-			a.store.AddPacket(pkt)
-			a.sse.Broadcast("packet:new", pkt)
+			handle(pkt)
 		}
 	}
 }
 
+// drainConnections stores connection snapshots until done is closed, then
+// flushes the ones still buffered.
 func (a *App) drainConnections(serial string, ch <-chan capture.Connection, done <-chan struct{}) {
+	handle := func(conn capture.Connection) {
+		a.store.AddConnection(conn)
+		a.traces.AddConnection(conn)
+		a.sse.Broadcast("connection:new", conn)
+		a.observeConnection(conn)
+		a.checkConnectionThreat(conn)
+		if a.reports != nil {
+			a.reports.ObserveConnection(conn)
+		}
+		if a.sink != nil {
+			a.sink.Connection(conn)
+		}
+		if a.elastic != nil {
+			a.elastic.Connection(conn)
+		}
+	}
 	for {
 		select {
 		case <-done:
-			return
+			for {
+				select {
+				case conn := <-ch:
+					handle(conn)
+				default:
+					return
+				}
+			}
 		case conn, ok := <-ch:
 			if !ok {
 				return
 			}
-			a.store.AddConnection(conn)
-			a.sse.Broadcast("connection:new", conn)
+			handle(conn)
+		}
+	}
+}
+
+// drainClosedConnections records connection teardowns until done is
+// closed, then flushes the ones still buffered.
+func (a *App) drainClosedConnections(ch <-chan capture.Connection, done <-chan struct{}) {
+	handle := func(conn capture.Connection) {
+		a.store.CloseConnection(conn)
+		a.sse.Broadcast("connection:closed", conn)
+		if a.reports != nil {
+			a.reports.ObserveConnection(conn)
+		}
+		if a.sink != nil {
+			a.sink.Connection(conn)
+		}
+		if a.elastic != nil {
+			a.elastic.Connection(conn)
+		}
+	}
+	for {
+		select {
+		case <-done:
+			for {
+				select {
+				case conn := <-ch:
+					handle(conn)
+				default:
+					return
+				}
+			}
+		case conn, ok := <-ch:
+			if !ok {
+				return
+			}
+			handle(conn)
+		}
+	}
+}
+
+func (a *App) drainDNSLookups(ch <-chan capture.DNSLookup, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case l, ok := <-ch:
+			if !ok {
+				return
+			}
+			a.store.AddDNSLookup(l)
+			a.traces.AddDNSLookup(l)
+			a.sse.Broadcast("dns:lookup", l)
+			if a.reports != nil {
+				a.reports.ObserveLookup(l)
+			}
+		}
+	}
+}
+
+// drainHostnames backfills stored packets and connections when the resolver
+// learns a hostname after their IP was first seen.
+func (a *App) drainHostnames(ch <-chan capture.HostnameUpdate, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case u, ok := <-ch:
+			if !ok {
+				return
+			}
+			a.checkHostnameThreat(u)
+			pkts, conns := a.store.BackfillHostname(u.Serial, u.IP, u.Hostname, store.DefaultBackfillDepth)
+			if pkts+conns == 0 {
+				continue
+			}
+			a.sse.Broadcast("enrichment:updated", map[string]interface{}{
+				"serial":      u.Serial,
+				"ip":          u.IP,
+				"hostname":    u.Hostname,
+				"packets":     pkts,
+				"connections": conns,
+			})
+		}
+	}
+}
+
+// drainCaptures stops every capture and waits up to timeout for them to
+// flush their data and clean up their devices.
+func (a *App) drainCaptures(timeout time.Duration) {
+	a.mu.Lock()
+	pending := make(map[string]*deviceCapture, len(a.captures))
+	for serial, dc := range a.captures {
+		pending[serial] = dc
+	}
+	a.mu.Unlock()
+	a.stopAllCaptures()
+	if len(pending) == 0 {
+		return
+	}
+
+	a.log.Info("draining captures", "count", len(pending), "timeout", timeout)
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for serial, dc := range pending {
+		select {
+		case <-dc.done:
+			delete(pending, serial)
+		case <-deadline.C:
+			a.log.Warn("capture drain timed out", "remaining", sortedKeys(pending))
+			return
 		}
 	}
 }
@@ -455,10 +1492,6 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-func writeError(w http.ResponseWriter, status int, msg string) {
-	writeJSON(w, status, map[string]string{"error": msg})
-}
-
 func queryInt(r *http.Request, key string, def int) int {
 	s := r.URL.Query().Get(key)
 	if s == "" {
@@ -0,0 +1,56 @@
+package bridge
+
+import (
+	"net/http"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/audit"
+)
+
+// recordCommand adds a device command to the audit log. It runs on the
+// goroutine of every command the ADB client finishes.
+func (a *App) recordCommand(r adb.CommandRecord) {
+	if _, err := a.audit.Record(r); err != nil {
+		a.log.Warn("failed to write audit log", "path", a.audit.Path(), "error", err)
+	}
+}
+
+// handleListAudit lists the commands run on devices, newest first.
+// Query parameters: serial, service, command, failed, from, to, n.
+func (a *App) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := audit.Query{
+		Serial:  q.Get("serial"),
+		Service: q.Get("service"),
+		Command: q.Get("command"),
+		Failed:  q.Get("failed") == "true",
+	}
+	var err error
+	if query.From, err = parseTimeParam(q.Get("from")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	if query.To, err = parseTimeParam(q.Get("to")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+	n := queryInt(r, "n", 500)
+
+	team := a.teamOf(r)
+	if team == "" {
+		query.Limit = n
+	}
+	entries := a.audit.Query(query)
+
+	// Team tokens see the commands run on their devices only.
+	out := entries[:0]
+	for _, e := range entries {
+		if len(out) == n {
+			break
+		}
+		if team == "" || a.teams.Owns(team, e.Serial) {
+			out = append(out, e)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,77 @@
+package bridge
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// RequireToken wraps h so that every /api/ request must present token,
+// either as "Authorization: Bearer <token>" or as a ?token= query parameter
+// (EventSource cannot set headers). Static assets stay public so the
+// dashboard can load and prompt for the token. An empty token disables the
+// check. Any of alt (the admin token) is accepted as well.
+func RequireToken(token string, h http.Handler, alt ...string) http.Handler {
+	if token == "" {
+		return h
+	}
+	accepted := []string{token}
+	for _, t := range alt {
+		if t != "" {
+			accepted = append(accepted, t)
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The dashboard reads its config before it has a token.
+		if !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/ui-config" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if !tokenIn(requestToken(r), accepted) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="adb-monitor"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// admin wraps a handler that controls a device or makes the host dial out
+// (reboot, root, remount, connect, input, screenrecord, shell and exec): it
+// runs only when the server has an admin token and the caller presents it.
+func (a *App) admin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.adminToken == "" {
+			writeErrorCode(w, http.StatusForbidden, codeAdminRequired, "device control is disabled; start the server with -admin-token")
+			return
+		}
+		if !tokenIn(requestToken(r), []string{a.adminToken}) {
+			writeErrorCode(w, http.StatusForbidden, codeAdminRequired, "device control requires the admin token")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// tokenIn reports, in constant time per candidate, whether tok is one of
+// accepted.
+func tokenIn(tok string, accepted []string) bool {
+	found := false
+	for _, want := range accepted {
+		if subtle.ConstantTimeCompare([]byte(tok), []byte(want)) == 1 {
+			found = true
+		}
+	}
+	return found
+}
+
+// requestToken extracts the caller's token from the request.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if tok, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(tok)
+		}
+	}
+	return r.URL.Query().Get("token")
+}
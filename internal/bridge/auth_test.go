@@ -0,0 +1,71 @@
+package bridge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/imcanugur/go-adb-monitor/internal/teams"
+)
+
+func TestAdminGate(t *testing.T) {
+	ts, err := teams.New([]teams.Team{
+		{Name: "payments", Tokens: []string{"pay"}, Devices: []string{"dev1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	rs := []route{
+		{method: "POST", path: "/api/devices/{serial}/reboot", mutating: true, admin: true},
+		{method: "POST", path: "/api/devices/exec", teams: true, mutating: true, admin: true},
+		{method: "GET", path: "/api/devices/{serial}/health"},
+	}
+	// serve builds the handler the way main does: the routes wrapped like
+	// RegisterRoutes, behind RequireToken with the team and admin tokens.
+	serve := func(adminToken string) http.Handler {
+		a := &App{teams: ts, adminToken: adminToken}
+		mux := http.NewServeMux()
+		for _, rt := range rs {
+			mux.HandleFunc(rt.method+" "+rt.path, a.guard(rt, ok))
+		}
+		return RequireToken("server", mux, append(ts.Tokens(), adminToken)...)
+	}
+
+	tests := []struct {
+		name       string
+		adminToken string
+		method     string
+		path       string
+		token      string
+		want       int
+		wantCode   string
+	}{
+		{"no admin token configured", "", "POST", "/api/devices/dev1/reboot", "server", http.StatusForbidden, codeAdminRequired},
+		{"no token", "", "POST", "/api/devices/dev1/reboot", "", http.StatusUnauthorized, ""},
+		{"auth token", "root", "POST", "/api/devices/dev1/reboot", "server", http.StatusForbidden, codeAdminRequired},
+		{"team token on own device", "root", "POST", "/api/devices/dev1/reboot", "pay", http.StatusForbidden, codeAdminRequired},
+		{"team token on team route", "root", "POST", "/api/devices/exec", "pay", http.StatusForbidden, codeAdminRequired},
+		{"admin token", "root", "POST", "/api/devices/dev1/reboot", "root", http.StatusOK, ""},
+		{"admin token on team route", "root", "POST", "/api/devices/exec", "root", http.StatusOK, ""},
+		{"admin token on other routes", "root", "GET", "/api/devices/dev3/health", "root", http.StatusOK, ""},
+		{"wrong token", "root", "POST", "/api/devices/dev1/reboot", "nope", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		r.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		serve(tt.adminToken).ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+			continue
+		}
+		if tt.wantCode != "" {
+			var body apiError
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != tt.wantCode {
+				t.Errorf("%s: body %s, want code %q", tt.name, w.Body, tt.wantCode)
+			}
+		}
+	}
+}
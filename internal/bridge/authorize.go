@@ -0,0 +1,125 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/adbbin"
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+// unauthorizedEvent is the payload of device:unauthorized.
+type unauthorizedEvent struct {
+	Serial string `json:"serial"`
+	// Fingerprint is the host key fingerprint the device's "Allow USB
+	// debugging?" dialog shows; empty when the key could not be read.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	KeyPath     string `json:"key_path,omitempty"`
+	// Message says what to do, for dashboards and logs.
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// authorizedEvent is the payload of device:authorized.
+type authorizedEvent struct {
+	Serial string `json:"serial"`
+	// WaitedMs is how long the device was unauthorized.
+	WaitedMs  int64     `json:"waited_ms"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// trackAuthorization announces devices that become unauthorized, with
+// what to check on them, and devices whose authorization was granted.
+func (a *App) trackAuthorization(e event.Event) {
+	a.mu.Lock()
+	since, was := a.unauthorized[e.Serial]
+	if e.NewState == adb.StateUnauthorized {
+		if !was {
+			a.unauthorized[e.Serial] = e.Timestamp
+		}
+	} else {
+		delete(a.unauthorized, e.Serial)
+	}
+	a.mu.Unlock()
+
+	switch {
+	case e.NewState == adb.StateUnauthorized && !was:
+		ev := unauthorizedEvent{
+			Serial:    e.Serial,
+			Message:   "Accept the \"Allow USB debugging?\" prompt on the device",
+			Timestamp: e.Timestamp,
+		}
+		if key, err := adbbin.ReadPublicKey(); err == nil {
+			ev.Fingerprint, ev.KeyPath = key.Fingerprint, key.Path
+			ev.Message += "; the computer's RSA key fingerprint is " + key.Fingerprint
+		}
+		a.log.Warn("device unauthorized", "serial", e.Serial, "fingerprint", ev.Fingerprint)
+		a.sse.Broadcast("device:unauthorized", ev)
+
+	case was && e.NewState.IsOnline():
+		waited := e.Timestamp.Sub(since)
+		a.log.Info("device authorized", "serial", e.Serial, "waited", waited)
+		a.sse.Broadcast("device:authorized", authorizedEvent{
+			Serial: e.Serial, WaitedMs: waited.Milliseconds(), Timestamp: e.Timestamp,
+		})
+	}
+}
+
+// retryUnauthorized asks the ADB server to reconnect offline and
+// unauthorized devices whenever one has waited authRetry, so a dismissed
+// or timed-out prompt appears again.
+func (a *App) retryUnauthorized(ctx context.Context) {
+	ticker := time.NewTicker(a.authRetry)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			var due []string
+			a.mu.Lock()
+			for serial, since := range a.unauthorized {
+				if now.Sub(since) >= a.authRetry {
+					due = append(due, serial)
+					// Count the wait again from this attempt.
+					a.unauthorized[serial] = now
+				}
+			}
+			a.mu.Unlock()
+			if len(due) == 0 {
+				continue
+			}
+
+			reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			out, err := a.client.ReconnectOffline(reqCtx)
+			cancel()
+			if err != nil {
+				a.log.Warn("reconnecting unauthorized devices failed", "serials", due, "error", err)
+				continue
+			}
+			a.log.Info("reconnecting unauthorized devices", "serials", due, "result", out)
+		}
+	}
+}
+
+// ============================================
+// HTTP Handlers
+// ============================================
+
+func (a *App) handleGetADBPublicKey(w http.ResponseWriter, r *http.Request) {
+	key, err := adbbin.ReadPublicKey()
+	if errors.Is(err, fs.ErrNotExist) {
+		writeError(w, http.StatusNotFound, "no adbkey.pub yet; it is created when the ADB server first starts")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, key)
+}
@@ -0,0 +1,100 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+const (
+	// DefaultPacketBatchInterval is how often captured packets are flushed
+	// to SSE clients as one packets:batch event.
+	DefaultPacketBatchInterval = 250 * time.Millisecond
+	// DefaultPacketBatchSize is how many packets trigger a flush before the
+	// interval is up.
+	DefaultPacketBatchSize = 200
+)
+
+// packetBatch is the payload of packets:batch.
+type packetBatch struct {
+	Packets []capture.NetworkPacket `json:"packets"`
+}
+
+// packetBatcher coalesces captured packets so that a busy tcpdump capture
+// costs one SSE event per flush instead of one per packet.
+type packetBatcher struct {
+	interval time.Duration
+	size     int
+
+	mu      sync.Mutex
+	pending []capture.NetworkPacket
+	full    chan struct{} // signalled when pending reaches size
+}
+
+func newPacketBatcher(interval time.Duration, size int) *packetBatcher {
+	if interval <= 0 {
+		interval = DefaultPacketBatchInterval
+	}
+	if size <= 0 {
+		size = DefaultPacketBatchSize
+	}
+	return &packetBatcher{interval: interval, size: size, full: make(chan struct{}, 1)}
+}
+
+// add queues pkt for the next batch.
+func (b *packetBatcher) add(pkt capture.NetworkPacket) {
+	b.mu.Lock()
+	b.pending = append(b.pending, pkt)
+	full := len(b.pending) >= b.size
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// take returns up to size queued packets, oldest first.
+func (b *packetBatcher) take() []capture.NetworkPacket {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := min(len(b.pending), b.size)
+	if n == 0 {
+		return nil
+	}
+	batch := b.pending[:n:n]
+	b.pending = append([]capture.NetworkPacket(nil), b.pending[n:]...)
+	return batch
+}
+
+// broadcastPacketBatches flushes queued packets as packets:batch every
+// interval, or as soon as a full batch is queued, until ctx is done.
+func (a *App) broadcastPacketBatches(ctx context.Context) {
+	b := a.batcher
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.full:
+		}
+		for {
+			batch := b.take()
+			if batch == nil {
+				break
+			}
+			a.sse.Broadcast("packets:batch", packetBatch{Packets: batch})
+			if len(batch) < b.size {
+				break
+			}
+		}
+	}
+}
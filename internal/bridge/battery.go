@@ -0,0 +1,308 @@
+package bridge
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/health"
+	"github.com/imcanugur/go-adb-monitor/internal/notify"
+	"github.com/imcanugur/go-adb-monitor/internal/store"
+)
+
+const (
+	// DefaultBatteryPauseLevel and DefaultBatteryResumeLevel are suggested
+	// battery levels to pause a capture at and resume it from.
+	DefaultBatteryPauseLevel  = 15
+	DefaultBatteryResumeLevel = 30
+	// DefaultBatteryDrainWarn is a suggested drain, in percent per hour, to
+	// warn about while capturing.
+	DefaultBatteryDrainWarn = 10
+
+	// drainWindow is how far back the battery drain of a capturing device
+	// is measured.
+	drainWindow = 30 * time.Minute
+	// drainMinSpan is the shortest unplugged stretch a drain is measured
+	// over: levels move in whole percents, so shorter ones are noise.
+	drainMinSpan = 10 * time.Minute
+	// drainWarnInterval is how long battery:drain stays quiet for a device
+	// after warning about it.
+	drainWarnInterval = 30 * time.Minute
+)
+
+// batteryThresholds are the levels at which a battery:threshold event fires
+// when a device's charge crosses them in either direction.
+var batteryThresholds = []int{5, 10, 20, 50, 80}
+
+// batteryThresholdEvent is the payload of battery:threshold.
+type batteryThresholdEvent struct {
+	Serial    string `json:"serial"`
+	Level     int    `json:"level"`
+	Threshold int    `json:"threshold"`
+	// Direction is "down" when discharging past the threshold, "up" when
+	// charging past it.
+	Direction string `json:"direction"`
+}
+
+// batteryChargingEvent is the payload of battery:charging.
+type batteryChargingEvent struct {
+	Serial  string `json:"serial"`
+	Level   int    `json:"level"`
+	Plugged bool   `json:"plugged"`
+	Status  string `json:"status,omitempty"`
+}
+
+// batteryDrainEvent is the payload of battery:drain.
+type batteryDrainEvent struct {
+	Serial string `json:"serial"`
+	Level  int    `json:"level"`
+	// PercentPerHour is the drain while capturing, measured over the last
+	// 30 minutes unplugged at most.
+	PercentPerHour float64 `json:"percent_per_hour"`
+	Threshold      float64 `json:"threshold"`
+}
+
+// capturePausedEvent is the payload of capture:paused.
+type capturePausedEvent struct {
+	Serial      string `json:"serial"`
+	Reason      string `json:"reason"`
+	Level       int    `json:"level"`
+	ResumeLevel int    `json:"resume_level"`
+}
+
+// batteryPause is a capture paused for a low battery, to be started again
+// with spec.
+type batteryPause struct {
+	spec  captureSpec
+	since time.Time
+}
+
+// batteryWarningKey counts battery warnings per device and kind: "drain"
+// or "paused".
+type batteryWarningKey struct {
+	serial, kind string
+}
+
+// batteryHistory is the body of GET /api/devices/{serial}/battery/history.
+type batteryHistory struct {
+	store.BatteryHistory
+	// CaptureDrainPerHour is the drain while capturing, in percent per
+	// hour, once there are enough unplugged samples to measure it.
+	CaptureDrainPerHour *float64 `json:"capture_drain_per_hour,omitempty"`
+	// CapturePaused is set while the capture waits for the device to
+	// charge.
+	CapturePaused bool `json:"capture_paused"`
+}
+
+// recordBattery stores a battery reading and broadcasts battery:threshold
+// and battery:charging when it differs meaningfully from the last one.
+func (a *App) recordBattery(serial string, b *health.Battery, now time.Time) {
+	cur := store.BatterySample{
+		Timestamp:    now,
+		Level:        b.Level,
+		TemperatureC: b.TemperatureC,
+		Plugged:      b.Plugged,
+		Status:       b.Status,
+	}
+	prev, ok := a.store.AddBatterySample(serial, cur)
+	a.checkCaptureBattery(serial, cur, now)
+	if !ok {
+		return
+	}
+
+	for _, t := range batteryThresholds {
+		var dir string
+		switch {
+		case prev.Level > t && cur.Level <= t:
+			dir = "down"
+		case prev.Level < t && cur.Level >= t:
+			dir = "up"
+		default:
+			continue
+		}
+		a.sse.Broadcast("battery:threshold", batteryThresholdEvent{
+			Serial: serial, Level: cur.Level, Threshold: t, Direction: dir,
+		})
+	}
+
+	if cur.Plugged != prev.Plugged || cur.Status != prev.Status {
+		a.sse.Broadcast("battery:charging", batteryChargingEvent{
+			Serial: serial, Level: cur.Level, Plugged: cur.Plugged, Status: cur.Status,
+		})
+	}
+}
+
+// checkCaptureBattery pauses the capture of a device whose battery ran
+// low, resumes it once the device has charged, and warns when a capture
+// drains the battery fast.
+func (a *App) checkCaptureBattery(serial string, b store.BatterySample, now time.Time) {
+	a.mu.Lock()
+	dc, capturing := a.captures[serial]
+	p, paused := a.batteryPaused[serial]
+	a.mu.Unlock()
+
+	switch {
+	case capturing && a.batteryPauseLevel > 0 && !b.Plugged && b.Level <= a.batteryPauseLevel:
+		a.pauseForBattery(serial, dc, b.Level, now)
+	case paused && b.Level >= a.batteryResumeLevel:
+		a.resumeFromBattery(serial, p, b.Level)
+	case capturing && a.batteryDrainWarn > 0:
+		rate, ok := a.captureDrain(serial, now)
+		if ok && rate >= a.batteryDrainWarn {
+			a.warnDrain(serial, b.Level, rate, now)
+		}
+	}
+}
+
+func (a *App) pauseForBattery(serial string, dc *deviceCapture, level int, now time.Time) {
+	a.mu.Lock()
+	if a.captures[serial] != dc {
+		a.mu.Unlock()
+		return
+	}
+	a.batteryPaused[serial] = batteryPause{spec: dc.spec, since: now}
+	a.mu.Unlock()
+	a.stopCapture(serial)
+
+	a.log.Warn("capture paused for low battery", "serial", serial, "level", level, "resume_level", a.batteryResumeLevel)
+	a.sse.Broadcast("capture:paused", capturePausedEvent{
+		Serial: serial, Reason: "battery", Level: level, ResumeLevel: a.batteryResumeLevel,
+	})
+	a.countBatteryWarning(serial, "paused")
+	a.notifier.Notify(notify.Notification{
+		Trigger: notify.TriggerCaptureBattery,
+		Serial:  serial,
+		Message: fmt.Sprintf("capture on %s paused at %d%% battery until it charges to %d%%", serial, level, a.batteryResumeLevel),
+		Details: map[string]string{
+			"kind":         "paused",
+			"level":        strconv.Itoa(level),
+			"resume_level": strconv.Itoa(a.batteryResumeLevel),
+		},
+		Timestamp: now,
+	})
+}
+
+func (a *App) resumeFromBattery(serial string, p batteryPause, level int) {
+	a.mu.Lock()
+	if cur, ok := a.batteryPaused[serial]; !ok || cur.since != p.since {
+		a.mu.Unlock()
+		return
+	}
+	delete(a.batteryPaused, serial)
+	a.mu.Unlock()
+
+	if err := a.startCapture(serial, p.spec); err != nil {
+		a.log.Warn("failed to resume capture after charging", "serial", serial, "error", err)
+		return
+	}
+	a.log.Info("capture resumed after charging", "serial", serial, "level", level,
+		"paused_for", time.Since(p.since).Round(time.Second))
+	a.sse.Broadcast("capture:started", map[string]string{"serial": serial, "reason": "battery"})
+}
+
+func (a *App) warnDrain(serial string, level int, rate float64, now time.Time) {
+	a.batteryMu.Lock()
+	if last, ok := a.drainWarned[serial]; ok && now.Sub(last) < drainWarnInterval {
+		a.batteryMu.Unlock()
+		return
+	}
+	a.drainWarned[serial] = now
+	a.batteryMu.Unlock()
+
+	a.log.Warn("capture draining battery", "serial", serial, "level", level, "percent_per_hour", rate)
+	a.sse.Broadcast("battery:drain", batteryDrainEvent{
+		Serial: serial, Level: level, PercentPerHour: rate, Threshold: a.batteryDrainWarn,
+	})
+	a.countBatteryWarning(serial, "drain")
+	a.notifier.Notify(notify.Notification{
+		Trigger: notify.TriggerCaptureBattery,
+		Serial:  serial,
+		Message: fmt.Sprintf("capture on %s drains its battery by %.1f%% per hour (at %d%%)", serial, rate, level),
+		Details: map[string]string{
+			"kind":             "drain",
+			"level":            strconv.Itoa(level),
+			"percent_per_hour": strconv.FormatFloat(rate, 'f', 1, 64),
+		},
+		Timestamp: now,
+	})
+}
+
+func (a *App) countBatteryWarning(serial, kind string) {
+	a.batteryMu.Lock()
+	a.batteryWarnings[batteryWarningKey{serial: serial, kind: kind}]++
+	a.batteryMu.Unlock()
+}
+
+// captureDrain returns the battery drain of the capture running on serial,
+// in percent per hour, over the last drainWindow of it at most.
+func (a *App) captureDrain(serial string, now time.Time) (float64, bool) {
+	a.mu.Lock()
+	dc, ok := a.captures[serial]
+	a.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	from := now.Add(-drainWindow)
+	if dc.started.After(from) {
+		from = dc.started
+	}
+	h, ok := a.store.BatteryHistory(serial, from, time.Time{})
+	if !ok {
+		return 0, false
+	}
+	return drainRate(h.Samples)
+}
+
+// drainRate returns the battery drain in percent per hour over the latest
+// unplugged stretch of samples, if it spans drainMinSpan.
+func drainRate(samples []store.BatterySample) (float64, bool) {
+	start := -1
+	for i, s := range samples {
+		switch {
+		case s.Plugged:
+			start = -1
+		case start < 0 || s.Level > samples[i-1].Level:
+			// Unplugged again, or a level that rose without a plug seen.
+			start = i
+		}
+	}
+	if start < 0 {
+		return 0, false
+	}
+	first, last := samples[start], samples[len(samples)-1]
+	span := last.Timestamp.Sub(first.Timestamp)
+	if span < drainMinSpan {
+		return 0, false
+	}
+	return float64(first.Level-last.Level) / span.Hours(), true
+}
+
+func (a *App) handleGetBatteryHistory(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	q := r.URL.Query()
+	from, err := parseTimeParam(q.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	to, err := parseTimeParam(q.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+
+	h, ok := a.store.BatteryHistory(serial, from, to)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no battery history for "+serial)
+		return
+	}
+	resp := batteryHistory{BatteryHistory: h}
+	if rate, ok := a.captureDrain(serial, time.Now()); ok {
+		resp.CaptureDrainPerHour = &rate
+	}
+	a.mu.Lock()
+	_, resp.CapturePaused = a.batteryPaused[serial]
+	a.mu.Unlock()
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,89 @@
+package bridge
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+// deviceControlTimeout bounds one reboot, root or remount request.
+const deviceControlTimeout = 30 * time.Second
+
+// rebootTargets maps ?target= to what the device reboots into.
+var rebootTargets = map[string]adb.RebootTarget{
+	"":           adb.RebootSystem,
+	"normal":     adb.RebootSystem,
+	"bootloader": adb.RebootBootloader,
+	"recovery":   adb.RebootRecovery,
+}
+
+// controlResult is the response of the device control endpoints and the
+// payload of device:control.
+type controlResult struct {
+	Serial string `json:"serial"`
+	// Action is reboot, root, unroot or remount.
+	Action string `json:"action"`
+	Target string `json:"target,omitempty"`
+	// Output is adbd's message, e.g. "restarting adbd as root".
+	Output    string    `json:"output,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// controlled logs a device control action and announces it.
+func (a *App) controlled(res controlResult) {
+	res.Timestamp = time.Now()
+	a.log.Info("device control", "serial", res.Serial, "action", res.Action, "target", res.Target, "output", res.Output)
+	a.sse.Broadcast("device:control", res)
+}
+
+// writeControlError maps refusals to 409 and other failures, which come
+// from the device or the ADB server, to 502.
+func writeControlError(w http.ResponseWriter, err error) {
+	writeADBError(w, http.StatusBadGateway, err)
+}
+
+// ============================================
+// HTTP Handlers
+// ============================================
+
+func (a *App) handleReboot(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	name := r.URL.Query().Get("target")
+	target, ok := rebootTargets[name]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "target must be normal, bootloader or recovery")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), deviceControlTimeout)
+	defer cancel()
+	if err := a.client.Reboot(ctx, serial, target); err != nil {
+		writeControlError(w, err)
+		return
+	}
+	if name == "" {
+		name = "normal"
+	}
+	res := controlResult{Serial: serial, Action: "reboot", Target: name}
+	a.controlled(res)
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleADBDControl serves the root, unroot and remount endpoints.
+func (a *App) handleADBDControl(action string, run func(context.Context, string) (string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serial := r.PathValue("serial")
+		ctx, cancel := context.WithTimeout(r.Context(), deviceControlTimeout)
+		defer cancel()
+		out, err := run(ctx, serial)
+		if err != nil {
+			writeControlError(w, err)
+			return
+		}
+		res := controlResult{Serial: serial, Action: action, Output: out}
+		a.controlled(res)
+		writeJSON(w, http.StatusOK, res)
+	}
+}
@@ -0,0 +1,116 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/store"
+)
+
+const (
+	// storeDeltaInterval is how often collected store changes are broadcast
+	// as one store:delta event.
+	storeDeltaInterval = 500 * time.Millisecond
+	// maxStoreDelta bounds the entries of each kind in one store:delta;
+	// anything beyond is only counted in Dropped.
+	maxStoreDelta = 500
+)
+
+// storeDelta is the payload of store:delta: what was added to or changed in
+// the store since the previous one.
+type storeDelta struct {
+	Packets     []capture.NetworkPacket `json:"packets,omitempty"`
+	Connections []capture.Connection    `json:"connections,omitempty"`
+	// UpdatedConnections holds the latest state of connections whose state
+	// or counters changed, once per connection.
+	UpdatedConnections []capture.Connection `json:"updated_connections,omitempty"`
+	DNSLookups         []capture.DNSLookup  `json:"dns_lookups,omitempty"`
+	// Dropped counts changes left out because of the size limit; a client
+	// seeing it should refetch over REST.
+	Dropped int `json:"dropped,omitempty"`
+}
+
+// storeDeltas collects store changes between broadcasts.
+type storeDeltas struct {
+	mu      sync.Mutex
+	pending storeDelta
+	updated map[string]int // connection ID -> index in UpdatedConnections
+}
+
+func newStoreDeltas() *storeDeltas {
+	return &storeDeltas{updated: make(map[string]int)}
+}
+
+// add records one change. Hostname backfills are not part of the delta;
+// they are announced as enrichment:updated.
+func (d *storeDeltas) add(c store.Change) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p := &d.pending
+	switch c.Kind {
+	case store.PacketAdded:
+		if len(p.Packets) < maxStoreDelta {
+			p.Packets = append(p.Packets, *c.Packet)
+			return
+		}
+	case store.ConnectionAdded:
+		if len(p.Connections) < maxStoreDelta {
+			p.Connections = append(p.Connections, *c.Connection)
+			return
+		}
+	case store.ConnectionUpdated:
+		if i, ok := d.updated[c.Connection.ID]; ok {
+			p.UpdatedConnections[i] = *c.Connection
+			return
+		}
+		if len(p.UpdatedConnections) < maxStoreDelta {
+			d.updated[c.Connection.ID] = len(p.UpdatedConnections)
+			p.UpdatedConnections = append(p.UpdatedConnections, *c.Connection)
+			return
+		}
+	case store.DNSLookupAdded:
+		if len(p.DNSLookups) < maxStoreDelta {
+			p.DNSLookups = append(p.DNSLookups, *c.DNSLookup)
+			return
+		}
+	default:
+		return
+	}
+	p.Dropped++
+}
+
+// take returns the collected changes and starts a new batch. ok is false
+// when nothing changed.
+func (d *storeDeltas) take() (delta storeDelta, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delta = d.pending
+	if len(delta.Packets)+len(delta.Connections)+len(delta.UpdatedConnections)+len(delta.DNSLookups)+delta.Dropped == 0 {
+		return delta, false
+	}
+	d.pending = storeDelta{}
+	clear(d.updated)
+	return delta, true
+}
+
+// broadcastStoreDeltas sends the collected store changes as store:delta
+// every storeDeltaInterval until ctx is done.
+func (a *App) broadcastStoreDeltas(ctx context.Context) {
+	ticker := time.NewTicker(storeDeltaInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if delta, ok := a.deltas.take(); ok {
+				a.sse.Broadcast("store:delta", delta)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package bridge
+
+import (
+	"context"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+// classDetectTimeout bounds the property reads behind device class detection.
+const classDetectTimeout = 10 * time.Second
+
+// putDeviceLocked stores d, carrying over a device class detected earlier,
+// its features and the latest link latency (the tracker and host:devices-l
+// never report them). It returns the stored device. The caller must hold
+// a.mu.
+func (a *App) putDeviceLocked(d adb.Device) adb.Device {
+	if d.Class == adb.ClassUnknown {
+		d.Class = a.devices[d.Serial].Class
+	}
+	if d.Features == nil {
+		d.Features = a.devices[d.Serial].Features
+	}
+	if d.LatencyMs == 0 {
+		d.LatencyMs = a.devices[d.Serial].LatencyMs
+	}
+	a.devices[d.Serial] = d
+	return d
+}
+
+// ensureDeviceClass starts background class detection for an online device
+// whose form factor is not known yet.
+func (a *App) ensureDeviceClass(serial string) {
+	a.mu.Lock()
+	d, ok := a.devices[serial]
+	a.mu.Unlock()
+	if !ok || !d.State.IsOnline() || d.Class != adb.ClassUnknown {
+		return
+	}
+	go a.detectDeviceClass(serial)
+}
+
+// detectDeviceClass probes the device's form factor, records it and sends
+// device:updated so the dashboard can label the device.
+func (a *App) detectDeviceClass(serial string) {
+	ctx, cancel := context.WithTimeout(a.ctx, classDetectTimeout)
+	defer cancel()
+
+	class, err := a.client.DetectDeviceClass(ctx, serial)
+	if err != nil || class == adb.ClassUnknown {
+		a.log.Debug("device class detection failed", "serial", serial, "error", err)
+		return
+	}
+
+	a.mu.Lock()
+	d, ok := a.devices[serial]
+	if ok {
+		d.Class = class
+		a.devices[serial] = d
+	}
+	a.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	a.log.Info("device class detected", "serial", serial, "class", class)
+	a.sse.Broadcast("device:updated", d)
+}
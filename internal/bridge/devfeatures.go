@@ -0,0 +1,61 @@
+package bridge
+
+import (
+	"context"
+	"time"
+)
+
+// featureReadTimeout bounds reading the features of a device.
+const featureReadTimeout = 5 * time.Second
+
+// ensureDeviceFeatures starts reading the ADB features of an online device
+// whose features are not known yet. The client caches them too, and picks
+// shell and sync protocols by them.
+func (a *App) ensureDeviceFeatures(serial string) {
+	a.mu.Lock()
+	d, ok := a.devices[serial]
+	a.mu.Unlock()
+	if !ok || !d.State.IsOnline() || d.Features != nil {
+		return
+	}
+	go a.readDeviceFeatures(serial)
+}
+
+// readDeviceFeatures records the features of a device and sends
+// device:updated with them.
+func (a *App) readDeviceFeatures(serial string) {
+	ctx, cancel := context.WithTimeout(a.ctx, featureReadTimeout)
+	defer cancel()
+
+	features, err := a.client.Features(ctx, serial)
+	if err != nil {
+		a.log.Debug("device features unavailable", "serial", serial, "error", err)
+		return
+	}
+
+	a.mu.Lock()
+	d, ok := a.devices[serial]
+	if ok {
+		d.Features = features
+		a.devices[serial] = d
+	}
+	a.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	a.log.Debug("device features read", "serial", serial, "features", features)
+	a.sse.Broadcast("device:updated", d)
+}
+
+// forgetFeaturesLocked drops the features known of serial, in the client
+// too, to be read again: a device that connects or changes state may have
+// rebooted into another build, or be behind a new ADB server. The caller
+// must hold a.mu.
+func (a *App) forgetFeaturesLocked(serial string) {
+	a.client.ForgetDevice(serial)
+	if d, ok := a.devices[serial]; ok {
+		d.Features = nil
+		a.devices[serial] = d
+	}
+}
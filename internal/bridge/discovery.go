@@ -0,0 +1,86 @@
+package bridge
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+// maxConnectBody bounds the body of POST /api/devices/connect.
+const maxConnectBody = 4 << 10
+
+// discoveredDevice is a wireless device the ADB server sees over mDNS but
+// is not connected to.
+type discoveredDevice struct {
+	adb.MDNSService
+	// Pairing devices show a pairing code and must be paired with
+	// `adb pair` before they can be connected.
+	Pairing bool `json:"pairing"`
+}
+
+// connectRequest is the body of POST /api/devices/connect.
+type connectRequest struct {
+	Addr string `json:"addr"`
+}
+
+// connectResult is the response of POST /api/devices/connect.
+type connectResult struct {
+	Addr    string `json:"addr"`
+	Message string `json:"message"`
+}
+
+// discoveredDevices lists the mDNS services of devices that are not
+// connected under any of the serials adb gives them: the address, the
+// mDNS instance name, or the device serial when it is plugged in by USB.
+func (a *App) discoveredDevices(services []adb.MDNSService) []discoveredDevice {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	out := []discoveredDevice{}
+	for _, s := range services {
+		connected := false
+		for _, serial := range []string{s.Addr, s.Instance + "." + s.Type, s.Serial} {
+			if _, ok := a.devices[serial]; ok && serial != "" {
+				connected = true
+				break
+			}
+		}
+		if !connected {
+			out = append(out, discoveredDevice{MDNSService: s, Pairing: s.Pairing()})
+		}
+	}
+	return out
+}
+
+func (a *App) handleGetDiscovered(w http.ResponseWriter, r *http.Request) {
+	services, err := a.client.MDNSServices(r.Context())
+	if err != nil {
+		writeADBError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.discoveredDevices(services))
+}
+
+// handleConnect connects the ADB server to a wireless device; the device
+// then arrives through the tracker like any other.
+func (a *App) handleConnect(w http.ResponseWriter, r *http.Request) {
+	var req connectRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxConnectBody)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if _, _, err := net.SplitHostPort(req.Addr); err != nil {
+		writeError(w, http.StatusBadRequest, "addr must be host:port")
+		return
+	}
+	msg, err := a.client.Connect(r.Context(), req.Addr)
+	if err != nil {
+		writeADBError(w, http.StatusBadGateway, err)
+		return
+	}
+	a.log.Info("connected wireless device", "addr", req.Addr, "message", msg)
+	writeJSON(w, http.StatusOK, connectResult{Addr: req.Addr, Message: msg})
+}
@@ -0,0 +1,150 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+// Error codes of the API error envelope. Clients should branch on the code;
+// the message is for people and may change.
+const (
+	codeBadRequest            = "BAD_REQUEST"
+	codeUnauthorized          = "UNAUTHORIZED"
+	codeForbidden             = "FORBIDDEN"
+	codeReadOnly              = "READ_ONLY"
+	codeAdminRequired         = "ADMIN_REQUIRED"
+	codeNotFound              = "NOT_FOUND"
+	codeConflict              = "CONFLICT"
+	codeDeviceNotFound        = "DEVICE_NOT_FOUND"
+	codeDeviceOffline         = "DEVICE_OFFLINE"
+	codeDeviceUnauthorized    = "DEVICE_UNAUTHORIZED"
+	codeNotPermitted          = "NOT_PERMITTED"
+	codeCaptureAlreadyRunning = "CAPTURE_ALREADY_RUNNING"
+	codeCaptureNotRunning     = "CAPTURE_NOT_RUNNING"
+	codeCaptureStartFailed    = "CAPTURE_START_FAILED"
+	codeADBUnreachable        = "ADB_UNREACHABLE"
+	codeADBCommandFailed      = "ADB_COMMAND_FAILED"
+	codeTimeout               = "TIMEOUT"
+	codeInternal              = "INTERNAL"
+)
+
+// errorCodes lists every code, for the OpenAPI document.
+var errorCodes = []string{
+	codeBadRequest, codeUnauthorized, codeForbidden, codeReadOnly, codeAdminRequired,
+	codeNotFound, codeConflict, codeDeviceNotFound, codeDeviceOffline, codeDeviceUnauthorized,
+	codeNotPermitted, codeCaptureAlreadyRunning, codeCaptureNotRunning, codeCaptureStartFailed, codeADBUnreachable,
+	codeADBCommandFailed, codeTimeout, codeInternal,
+}
+
+// apiError is the JSON body of every error response.
+type apiError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+	// Step and Hint are set when a capture fails to start: the check that
+	// failed (shell, mode or app) and what to do about it.
+	Step string `json:"step,omitempty"`
+	Hint string `json:"hint,omitempty"`
+}
+
+// writeError writes an error with the generic code of its status.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeErrorCode(w, status, statusCode(status), msg)
+}
+
+func writeErrorCode(w http.ResponseWriter, status int, code, msg string) {
+	writeJSON(w, status, apiError{Error: msg, Code: code})
+}
+
+// statusCode is the code of errors that have no more specific one.
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return codeBadRequest
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusBadGateway:
+		return codeADBCommandFailed
+	case http.StatusServiceUnavailable:
+		return codeADBUnreachable
+	case http.StatusGatewayTimeout:
+		return codeTimeout
+	default:
+		return codeInternal
+	}
+}
+
+// writeADBError maps an error from the ADB client or a device to a status
+// and code. Errors it does not recognise are written with status.
+func writeADBError(w http.ResponseWriter, status int, err error) {
+	status, code := adbErrorCode(status, err)
+	writeErrorCode(w, status, code, err.Error())
+}
+
+// adbErrorCode is the status and code writeADBError writes for err.
+func adbErrorCode(status int, err error) (int, string) {
+	var exitErr *adb.ExitError
+	switch {
+	case errors.Is(err, adb.ErrServerNotRunning):
+		return http.StatusServiceUnavailable, codeADBUnreachable
+	case errors.Is(err, adb.ErrDeviceNotFound):
+		return http.StatusNotFound, codeDeviceNotFound
+	case errors.Is(err, adb.ErrDeviceOffline):
+		return http.StatusConflict, codeDeviceOffline
+	case errors.Is(err, adb.ErrDeviceUnauthorized):
+		return http.StatusConflict, codeDeviceUnauthorized
+	case errors.Is(err, adb.ErrNotPermitted):
+		return http.StatusConflict, codeNotPermitted
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, codeTimeout
+	case errors.As(err, &exitErr), errors.Is(err, adb.ErrCommandFailed):
+		return http.StatusBadGateway, codeADBCommandFailed
+	default:
+		return status, statusCode(status)
+	}
+}
+
+// writeCaptureStartError writes why a capture did not start. A failed
+// check keeps the code of the ADB error behind it, if any, and carries
+// its step and hint; checks that found the device unfit for the capture
+// are 422 CAPTURE_START_FAILED.
+func writeCaptureStartError(w http.ResponseWriter, err error) {
+	var startErr *capture.StartError
+	if !errors.As(err, &startErr) {
+		writeADBError(w, http.StatusInternalServerError, err)
+		return
+	}
+	status, code := adbErrorCode(http.StatusUnprocessableEntity, startErr.Err)
+	if status == http.StatusUnprocessableEntity {
+		code = codeCaptureStartFailed
+	}
+	writeJSON(w, status, apiError{Error: err.Error(), Code: code, Step: startErr.Step, Hint: startErr.Hint})
+}
+
+// writeDeviceError writes the error for a serial that is unknown or not
+// online, and reports whether it did.
+func (a *App) writeDeviceError(w http.ResponseWriter, serial string) bool {
+	a.mu.Lock()
+	dev, ok := a.devices[serial]
+	a.mu.Unlock()
+	switch {
+	case !ok:
+		writeErrorCode(w, http.StatusNotFound, codeDeviceNotFound, "device not found")
+	case dev.State == adb.StateUnauthorized:
+		writeErrorCode(w, http.StatusConflict, codeDeviceUnauthorized, "device is unauthorized")
+	case !dev.State.IsOnline():
+		writeErrorCode(w, http.StatusConflict, codeDeviceOffline, "device is "+string(dev.State))
+	default:
+		return false
+	}
+	return true
+}
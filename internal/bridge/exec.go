@@ -0,0 +1,216 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/pool"
+)
+
+const (
+	// defaultExecTimeout bounds each device's run when the request does not.
+	defaultExecTimeout = 30 * time.Second
+	// maxExecTimeout is the largest per-device timeout a request may ask for.
+	maxExecTimeout = 10 * time.Minute
+	// maxExecOutput bounds the stdout and stderr kept per device; a command
+	// writing more is stopped.
+	maxExecOutput = 64 << 10
+	// maxExecBody bounds the request body.
+	maxExecBody = 1 << 20
+)
+
+// execRequest is the body of POST /api/devices/exec.
+type execRequest struct {
+	Command string `json:"command"`
+	// Serials are the devices to run on; if empty, every online device,
+	// or those in Group and carrying Tag when given.
+	Serials []string `json:"serials,omitempty"`
+	Group   string   `json:"group,omitempty"`
+	Tag     string   `json:"tag,omitempty"`
+	// TimeoutMs bounds each device's run (default 30000, max 600000).
+	TimeoutMs int `json:"timeout_ms,omitempty"`
+}
+
+// execResult is the outcome of the command on one device. Error is set
+// when the command could not be run at all, in which case ExitCode is -1.
+// Devices without shell v2 report stderr within Stdout and an unknown exit
+// code (adb.ShellExitUnknown), which counts as success. Truncated means the
+// command wrote more than maxExecOutput and was stopped there, so its exit
+// code is unknown too.
+type execResult struct {
+	Serial     string  `json:"serial"`
+	ExitCode   int     `json:"exit_code"`
+	Stdout     string  `json:"stdout"`
+	Stderr     string  `json:"stderr"`
+	Truncated  bool    `json:"truncated,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// execResponse is the result of POST /api/devices/exec. Results are in the
+// order of the requested serials.
+type execResponse struct {
+	ID         string       `json:"id"`
+	Command    string       `json:"command"`
+	Results    []execResult `json:"results"`
+	Succeeded  int          `json:"succeeded"`
+	Failed     int          `json:"failed"`
+	DurationMs float64      `json:"duration_ms"`
+}
+
+// execProgress is the payload of exec:progress, sent as each device
+// finishes.
+type execProgress struct {
+	ID     string     `json:"id"`
+	Done   int        `json:"done"`
+	Total  int        `json:"total"`
+	Result execResult `json:"result"`
+}
+
+// handleBulkExec runs a shell command on many devices through the worker
+// pool and answers once every device has finished. exec:started,
+// exec:progress and exec:completed report the run over SSE meanwhile.
+func (a *App) handleBulkExec(w http.ResponseWriter, r *http.Request) {
+	var req execRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxExecBody)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Command) == "" {
+		writeError(w, http.StatusBadRequest, "command is required")
+		return
+	}
+	timeout := defaultExecTimeout
+	if req.TimeoutMs < 0 || time.Duration(req.TimeoutMs)*time.Millisecond > maxExecTimeout {
+		writeError(w, http.StatusBadRequest, "timeout_ms must be between 0 and "+strconv.Itoa(int(maxExecTimeout/time.Millisecond)))
+		return
+	}
+	if req.TimeoutMs > 0 {
+		timeout = time.Duration(req.TimeoutMs) * time.Millisecond
+	}
+
+	team := a.teamOf(r)
+	serials := req.Serials
+	for _, serial := range serials {
+		if team != "" && !a.teams.Owns(team, serial) {
+			writeErrorCode(w, http.StatusNotFound, codeDeviceNotFound, "device not found: "+serial)
+			return
+		}
+	}
+	if len(serials) == 0 {
+		sel := deviceSelector{Group: req.Group, Tag: req.Tag, Team: team}
+		for _, d := range a.GetDevices() {
+			if d.State.IsOnline() && a.selects(sel, d.Serial) {
+				serials = append(serials, d.Serial)
+			}
+		}
+		if len(serials) == 0 {
+			writeError(w, http.StatusConflict, "no matching online devices")
+			return
+		}
+	}
+
+	id := "exec-" + strconv.FormatUint(a.execSeq.Add(1), 10)
+	a.sse.Broadcast("exec:started", map[string]any{
+		"id":      id,
+		"command": req.Command,
+		"serials": serials,
+	})
+	resp := a.bulkExec(r.Context(), id, req.Command, serials, timeout)
+	a.sse.Broadcast("exec:completed", map[string]any{
+		"id":          id,
+		"succeeded":   resp.Succeeded,
+		"failed":      resp.Failed,
+		"duration_ms": resp.DurationMs,
+	})
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// bulkExec runs command on every serial, at most pool-size at a time.
+// Devices that are unknown or offline fail without being contacted.
+func (a *App) bulkExec(ctx context.Context, id, command string, serials []string, timeout time.Duration) execResponse {
+	start := time.Now()
+	resp := execResponse{ID: id, Command: command, Results: make([]execResult, len(serials))}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+	)
+	finish := func(i int, res execResult) {
+		mu.Lock()
+		resp.Results[i] = res
+		done++
+		n := done
+		mu.Unlock()
+		a.sse.Broadcast("exec:progress", execProgress{ID: id, Done: n, Total: len(serials), Result: res})
+	}
+
+	for i, serial := range serials {
+		a.mu.Lock()
+		dev, known := a.devices[serial]
+		a.mu.Unlock()
+		switch {
+		case !known:
+			finish(i, execResult{Serial: serial, ExitCode: -1, Error: "device not found"})
+			continue
+		case !dev.State.IsOnline():
+			finish(i, execResult{Serial: serial, ExitCode: -1, Error: "device is " + string(dev.State)})
+			continue
+		}
+
+		wg.Add(1)
+		err := a.pool.Submit(ctx, pool.Task{
+			Name:   "exec:" + serial,
+			Serial: serial,
+			Fn: func(ctx context.Context) error {
+				defer wg.Done()
+				finish(i, a.execOne(ctx, serial, command, timeout))
+				return nil
+			},
+		})
+		if err != nil {
+			wg.Done()
+			finish(i, execResult{Serial: serial, ExitCode: -1, Error: err.Error()})
+		}
+	}
+	wg.Wait()
+
+	for _, res := range resp.Results {
+		if res.Error == "" && (res.ExitCode == 0 || res.ExitCode == adb.ShellExitUnknown) {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+	resp.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	return resp
+}
+
+// execOne runs command on one device within timeout.
+func (a *App) execOne(ctx context.Context, serial, command string, timeout time.Duration) execResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	out, err := a.client.ShellV2Limit(ctx, serial, command, maxExecOutput)
+	res := execResult{Serial: serial, DurationMs: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		res.ExitCode = -1
+		res.Error = err.Error()
+		if ctx.Err() == context.DeadlineExceeded {
+			res.Error = "timed out after " + timeout.String()
+		}
+		return res
+	}
+	res.ExitCode = out.ExitCode
+	res.Stdout, res.Stderr, res.Truncated = out.Stdout, out.Stderr, out.Truncated
+	return res
+}
@@ -0,0 +1,211 @@
+package bridge
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/store"
+)
+
+// exportFlushEvery is the number of rows written between explicit flushes,
+// so large exports start arriving at the client immediately.
+const exportFlushEvery = 1000
+
+var packetCSVHeader = []string{
+	"id", "serial", "timestamp", "src_ip", "src_port", "dst_ip", "dst_port",
+	"protocol", "length", "flags", "http_method", "http_path", "http_host",
+	"http_status", "raw",
+}
+
+var connectionCSVHeader = []string{
+	"id", "serial", "local_ip", "local_port", "remote_ip", "remote_port",
+	"state", "protocol", "uid", "first_seen", "last_seen", "hostname", "app_name",
+	"bytes_sent", "bytes_received", "rtt_ms",
+}
+
+// handleExport streams packets or connections as CSV or NDJSON.
+// The {file} path segment selects the dataset and format, e.g.
+// packets.csv, packets.ndjson, connections.csv, connections.ndjson.
+// Query parameters: serial, from, to (RFC 3339 or Unix seconds).
+func (a *App) handleExport(w http.ResponseWriter, r *http.Request) {
+	file := r.PathValue("file")
+
+	filter, err := parseExportFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var contentType string
+	switch file {
+	case "packets.csv", "connections.csv":
+		contentType = "text/csv; charset=utf-8"
+	case "packets.ndjson", "connections.ndjson":
+		contentType = "application/x-ndjson"
+	default:
+		writeError(w, http.StatusNotFound, "unknown export "+strconv.Quote(file))
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file))
+	w.WriteHeader(http.StatusOK)
+
+	ew := newExportWriter(w)
+	switch file {
+	case "packets.csv":
+		err = a.exportPacketsCSV(ew, filter)
+	case "packets.ndjson":
+		err = a.store.ScanPackets(filter, func(p capture.NetworkPacket) error {
+			return ew.json(p)
+		})
+	case "connections.csv":
+		err = a.exportConnectionsCSV(ew, filter)
+	case "connections.ndjson":
+		err = a.store.ScanConnections(filter, func(c capture.Connection) error {
+			return ew.json(c)
+		})
+	}
+	if err == nil {
+		err = ew.flush()
+	}
+	if err != nil {
+		a.log.Debug("export aborted", "file", file, "error", err)
+	}
+}
+
+func (a *App) exportPacketsCSV(ew *exportWriter, filter store.Filter) error {
+	cw := csv.NewWriter(ew.buf)
+	if err := cw.Write(packetCSVHeader); err != nil {
+		return err
+	}
+	err := a.store.ScanPackets(filter, func(p capture.NetworkPacket) error {
+		if err := cw.Write([]string{
+			p.ID, p.Serial, p.Timestamp.Format(time.RFC3339Nano),
+			p.SrcIP, strconv.Itoa(int(p.SrcPort)),
+			p.DstIP, strconv.Itoa(int(p.DstPort)),
+			string(p.Protocol), strconv.Itoa(p.Length), p.Flags,
+			p.HTTPMethod, p.HTTPPath, p.HTTPHost, strconv.Itoa(p.HTTPStatus),
+			p.Raw,
+		}); err != nil {
+			return err
+		}
+		return ew.row(cw)
+	})
+	cw.Flush()
+	if err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func (a *App) exportConnectionsCSV(ew *exportWriter, filter store.Filter) error {
+	cw := csv.NewWriter(ew.buf)
+	if err := cw.Write(connectionCSVHeader); err != nil {
+		return err
+	}
+	err := a.store.ScanConnections(filter, func(c capture.Connection) error {
+		if err := cw.Write([]string{
+			c.ID, c.Serial,
+			c.LocalIP, strconv.Itoa(int(c.LocalPort)),
+			c.RemoteIP, strconv.Itoa(int(c.RemotePort)),
+			string(c.State), string(c.Protocol), strconv.Itoa(c.UID),
+			c.FirstSeen.Format(time.RFC3339Nano), c.LastSeen.Format(time.RFC3339Nano),
+			c.Hostname, c.AppName,
+			strconv.FormatUint(c.BytesSent, 10), strconv.FormatUint(c.BytesReceived, 10),
+			strconv.FormatFloat(c.RTTMs, 'f', -1, 64),
+		}); err != nil {
+			return err
+		}
+		return ew.row(cw)
+	})
+	cw.Flush()
+	if err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// exportWriter buffers rows and flushes them to the client periodically.
+type exportWriter struct {
+	buf     *bufio.Writer
+	enc     *json.Encoder
+	flusher http.Flusher
+	rows    int
+}
+
+func newExportWriter(w http.ResponseWriter) *exportWriter {
+	buf := bufio.NewWriterSize(w, 64*1024)
+	flusher, _ := w.(http.Flusher)
+	return &exportWriter{buf: buf, enc: json.NewEncoder(buf), flusher: flusher}
+}
+
+// json writes v as a single NDJSON line.
+func (ew *exportWriter) json(v interface{}) error {
+	if err := ew.enc.Encode(v); err != nil {
+		return err
+	}
+	return ew.tick()
+}
+
+// row accounts for a CSV row already written to cw.
+func (ew *exportWriter) row(cw *csv.Writer) error {
+	if (ew.rows+1)%exportFlushEvery == 0 {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+	return ew.tick()
+}
+
+func (ew *exportWriter) tick() error {
+	ew.rows++
+	if ew.rows%exportFlushEvery == 0 {
+		return ew.flush()
+	}
+	return nil
+}
+
+func (ew *exportWriter) flush() error {
+	if err := ew.buf.Flush(); err != nil {
+		return err
+	}
+	if ew.flusher != nil {
+		ew.flusher.Flush()
+	}
+	return nil
+}
+
+// parseExportFilter reads serial/from/to query parameters.
+func parseExportFilter(r *http.Request) (store.Filter, error) {
+	q := r.URL.Query()
+	f := store.Filter{Serial: q.Get("serial")}
+
+	var err error
+	if f.From, err = parseTimeParam(q.Get("from")); err != nil {
+		return f, fmt.Errorf("invalid from: %w", err)
+	}
+	if f.To, err = parseTimeParam(q.Get("to")); err != nil {
+		return f, fmt.Errorf("invalid to: %w", err)
+	}
+	return f, nil
+}
+
+// parseTimeParam accepts RFC 3339 timestamps or Unix seconds. Empty input
+// yields the zero time.
+func parseTimeParam(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
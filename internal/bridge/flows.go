@@ -0,0 +1,54 @@
+package bridge
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/store"
+)
+
+// handleListFlows lists the flows merged from the stored connections,
+// packets and logged URLs, newest first.
+// Query parameters: serial, host, app, protocol, source, closed, malicious,
+// from, to, n.
+func (a *App) handleListFlows(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := store.FlowQuery{
+		Filter:    store.Filter{Serial: q.Get("serial")},
+		Host:      q.Get("host"),
+		App:       q.Get("app"),
+		Protocol:  capture.Protocol(strings.ToUpper(q.Get("protocol"))),
+		Source:    q.Get("source"),
+		Closed:    q.Get("closed") == "true",
+		Malicious: q.Get("malicious") == "true",
+	}
+	var err error
+	if query.From, err = parseTimeParam(q.Get("from")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	if query.To, err = parseTimeParam(q.Get("to")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+	n := queryInt(r, "n", 200)
+
+	team := a.teamOf(r)
+	if team == "" {
+		query.Limit = n
+	}
+	flows := a.store.Flows(query)
+
+	// Team tokens see the flows of their devices only.
+	out := flows[:0]
+	for _, f := range flows {
+		if n > 0 && len(out) == n {
+			break
+		}
+		if team == "" || a.teams.Owns(team, f.Serial) {
+			out = append(out, f)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
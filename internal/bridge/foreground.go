@@ -0,0 +1,117 @@
+package bridge
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/monitor"
+)
+
+const (
+	// foregroundPollInterval is how often every online device is asked for
+	// its foreground app.
+	foregroundPollInterval = 5 * time.Second
+	// foregroundPollTimeout bounds a single device poll.
+	foregroundPollTimeout = 5 * time.Second
+)
+
+// foregroundEvent is the payload of app:foreground_changed.
+type foregroundEvent struct {
+	Serial           string    `json:"serial"`
+	Package          string    `json:"package"`
+	Activity         string    `json:"activity,omitempty"`
+	PreviousPackage  string    `json:"previous_package,omitempty"`
+	PreviousActivity string    `json:"previous_activity,omitempty"`
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+// trackForeground periodically records each online device's foreground
+// app and broadcasts app:foreground_changed when it changes.
+func (a *App) trackForeground(ctx context.Context) {
+	ticker := time.NewTicker(foregroundPollInterval)
+	defer ticker.Stop()
+
+	for {
+		a.pollAllForeground(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) pollAllForeground(ctx context.Context) {
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, healthProbeConcurrency)
+	)
+	for _, d := range a.GetDevices() {
+		if !d.State.IsOnline() {
+			continue
+		}
+		wg.Add(1)
+		go func(d adb.Device) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+			a.pollForeground(ctx, d.Serial)
+		}(d)
+	}
+	wg.Wait()
+}
+
+func (a *App) pollForeground(ctx context.Context, serial string) {
+	pollCtx, cancel := context.WithTimeout(ctx, foregroundPollTimeout)
+	defer cancel()
+
+	res, err := a.client.ShellV2(pollCtx, serial, monitor.ForegroundCmd)
+	if err != nil {
+		a.log.Debug("foreground poll failed", "serial", serial, "error", err)
+		return
+	}
+	// No component means the screen is off or locked: the previous app is
+	// no longer in front of the user.
+	fg, _ := monitor.ParseForeground(res.Stdout)
+	a.setForeground(serial, fg, time.Now())
+}
+
+// setForeground records the device's foreground app and broadcasts the
+// change, if any. An empty package ends the current span and is broadcast
+// as such.
+func (a *App) setForeground(serial string, fg monitor.Foreground, now time.Time) {
+	prev, changed := a.store.SetForeground(serial, fg.Package, fg.Activity, now)
+	if !changed {
+		return
+	}
+	a.sse.Broadcast("app:foreground_changed", foregroundEvent{
+		Serial:           serial,
+		Package:          fg.Package,
+		Activity:         fg.Activity,
+		PreviousPackage:  prev.Package,
+		PreviousActivity: prev.Activity,
+		Timestamp:        now,
+	})
+}
+
+func (a *App) handleGetForegroundHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, err := parseTimeParam(q.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	to, err := parseTimeParam(q.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, a.store.ForegroundHistory(r.PathValue("serial"), from, to))
+}
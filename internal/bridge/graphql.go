@@ -0,0 +1,267 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/graphql"
+	"github.com/imcanugur/go-adb-monitor/internal/health"
+	"github.com/imcanugur/go-adb-monitor/internal/store"
+)
+
+const (
+	// graphqlDefaultLimit and graphqlMaxLimit bound list arguments.
+	graphqlDefaultLimit = 100
+	graphqlMaxLimit     = 5000
+	// maxGraphQLBody bounds a POSTed request.
+	maxGraphQLBody = 1 << 20
+)
+
+// handleGraphQL executes a read-only GraphQL query, POSTed as JSON or sent
+// as ?query= (with optional operationName and JSON variables). A GET
+// without a query returns the schema in SDL.
+func (a *App) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	switch r.Method {
+	case http.MethodPost:
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxGraphQLBody)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+			return
+		}
+	default:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		if req.Query == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, a.graphqlSchema().SDL())
+			return
+		}
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid variables: "+err.Error())
+				return
+			}
+		}
+	}
+
+	resp := a.graphqlSchema().Execute(req)
+	status := http.StatusOK
+	if resp.Data == nil {
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, resp)
+}
+
+// graphqlSchema builds the schema. Resolvers read live state on every
+// request, so the schema itself can be built once.
+func (a *App) graphqlSchema() *graphql.Schema {
+	a.graphqlOnce.Do(func() { a.graphql = a.buildGraphQLSchema() })
+	return a.graphql
+}
+
+func (a *App) buildGraphQLSchema() *graphql.Schema {
+	limitArgs := map[string]string{"limit": graphql.Int}
+	trafficArgs := map[string]string{"window": graphql.String, "top": graphql.Int}
+
+	packet := &graphql.Object{Name: "Packet", Fields: graphql.ScalarFields(capture.NetworkPacket{})}
+	connection := &graphql.Object{Name: "Connection", Fields: graphql.ScalarFields(capture.Connection{})}
+
+	dnsAnswer := &graphql.Object{Name: "DNSAnswer", Fields: graphql.ScalarFields(capture.DNSAnswer{})}
+	dnsLookup := &graphql.Object{Name: "DNSLookup", Fields: graphql.ScalarFields(capture.DNSLookup{})}
+	dnsLookup.Fields["answers"] = &graphql.Field{Type: dnsAnswer, List: true}
+
+	battery := &graphql.Object{Name: "Battery", Fields: graphql.ScalarFields(health.Battery{})}
+	healthObj := &graphql.Object{Name: "Health", Fields: graphql.ScalarFields(health.Result{})}
+	healthObj.Fields["battery"] = &graphql.Field{Type: battery}
+
+	counts := &graphql.Object{Name: "TrafficCounts", Fields: graphql.ScalarFields(store.TrafficCounts{})}
+	group := &graphql.Object{Name: "TrafficGroup", Fields: graphql.ScalarFields(store.TrafficGroup{})}
+	rate := &graphql.Object{Name: "RequestRate", Fields: graphql.ScalarFields(store.RequestRate{})}
+	bucket := &graphql.Object{Name: "TrafficBucket", Fields: graphql.ScalarFields(store.TrafficBucket{})}
+	traffic := &graphql.Object{
+		Name:        "Traffic",
+		Description: "Aggregated traffic over a window, as served by /api/stats/traffic.",
+		Fields:      graphql.ScalarFields(store.TrafficStats{}),
+	}
+	traffic.Fields["totals"] = &graphql.Field{Type: counts}
+	traffic.Fields["devices"] = &graphql.Field{Type: group, List: true}
+	traffic.Fields["hosts"] = &graphql.Field{Type: group, List: true}
+	traffic.Fields["apps"] = &graphql.Field{Type: group, List: true}
+	traffic.Fields["rates"] = &graphql.Field{Type: rate, List: true}
+	traffic.Fields["timeline"] = &graphql.Field{Type: bucket, List: true}
+
+	appTraffic := &graphql.Object{Name: "AppTraffic", Fields: graphql.ScalarFields(capture.AppTraffic{})}
+	ifaceTraffic := &graphql.Object{Name: "InterfaceTraffic", Fields: graphql.ScalarFields(capture.InterfaceTraffic{})}
+
+	session := &graphql.Object{
+		Name:        "Session",
+		Description: "An active capture and its statistics.",
+		Fields:      graphql.ScalarFields(capture.CaptureStats{}),
+	}
+	session.Fields["top_hosts"] = &graphql.Field{
+		Type: group, List: true, Args: trafficArgs,
+		Description: "Most active destinations of the device within window (default 15m).",
+		Resolve: func(src any, args graphql.Args) (any, error) {
+			q, err := trafficQuery(src.(capture.CaptureStats).Serial, args)
+			if err != nil {
+				return nil, err
+			}
+			return a.store.TrafficStats(q).Hosts, nil
+		},
+	}
+	session.Fields["apps"] = &graphql.Field{
+		Type: appTraffic, List: true,
+		Description: "Bytes per app (procnet and ss modes).",
+		Resolve: func(src any, _ graphql.Args) (any, error) {
+			snap, _ := a.engineTraffic(src.(capture.CaptureStats).Serial)
+			return snap.Apps, nil
+		},
+	}
+	session.Fields["interfaces"] = &graphql.Field{
+		Type: ifaceTraffic, List: true,
+		Description: "Bytes per network interface (procnet and ss modes).",
+		Resolve: func(src any, _ graphql.Args) (any, error) {
+			snap, _ := a.engineTraffic(src.(capture.CaptureStats).Serial)
+			return snap.Interfaces, nil
+		},
+	}
+
+	device := &graphql.Object{Name: "Device", Fields: graphql.ScalarFields(adb.Device{})}
+	serialOf := func(src any) string { return src.(adb.Device).Serial }
+	device.Fields["health"] = &graphql.Field{
+		Type: healthObj,
+		Resolve: func(src any, _ graphql.Args) (any, error) {
+			if r, ok := a.health.Get(serialOf(src)); ok {
+				return r, nil
+			}
+			return nil, nil
+		},
+	}
+	device.Fields["session"] = &graphql.Field{
+		Type:        session,
+		Description: "The active capture, or null.",
+		Resolve: func(src any, _ graphql.Args) (any, error) {
+			if st, ok := a.GetCaptureStatus()[serialOf(src)]; ok {
+				return st, nil
+			}
+			return nil, nil
+		},
+	}
+	device.Fields["packets"] = &graphql.Field{
+		Type: packet, List: true, Args: limitArgs,
+		Resolve: func(src any, args graphql.Args) (any, error) {
+			return a.store.GetPacketsBySerial(serialOf(src), graphqlLimit(args)), nil
+		},
+	}
+	device.Fields["connections"] = &graphql.Field{
+		Type: connection, List: true, Args: limitArgs,
+		Resolve: func(src any, args graphql.Args) (any, error) {
+			return a.store.GetConnectionsBySerial(serialOf(src), graphqlLimit(args)), nil
+		},
+	}
+	device.Fields["dns"] = &graphql.Field{
+		Type: dnsLookup, List: true, Args: limitArgs,
+		Resolve: func(src any, args graphql.Args) (any, error) {
+			return a.store.GetDNSLookupsBySerial(serialOf(src), graphqlLimit(args)), nil
+		},
+	}
+	device.Fields["traffic"] = &graphql.Field{
+		Type: traffic, Args: trafficArgs,
+		Resolve: func(src any, args graphql.Args) (any, error) {
+			q, err := trafficQuery(serialOf(src), args)
+			if err != nil {
+				return nil, err
+			}
+			return a.store.TrafficStats(q), nil
+		},
+	}
+
+	serialArgs := map[string]string{"serial": graphql.String, "limit": graphql.Int}
+	query := &graphql.Object{Name: "Query", Fields: map[string]*graphql.Field{
+		"devices": {
+			Type: device, List: true,
+			Resolve: func(any, graphql.Args) (any, error) { return a.GetDevices(), nil },
+		},
+		"device": {
+			Type: device, Args: map[string]string{"serial": "String!"},
+			Resolve: func(_ any, args graphql.Args) (any, error) {
+				a.mu.Lock()
+				d, ok := a.devices[args.String("serial", "")]
+				a.mu.Unlock()
+				if !ok {
+					return nil, nil
+				}
+				return d, nil
+			},
+		},
+		"packets": {
+			Type: packet, List: true, Args: serialArgs,
+			Resolve: func(_ any, args graphql.Args) (any, error) {
+				if serial := args.String("serial", ""); serial != "" {
+					return a.store.GetPacketsBySerial(serial, graphqlLimit(args)), nil
+				}
+				return a.store.GetRecentPackets(graphqlLimit(args)), nil
+			},
+		},
+		"connections": {
+			Type: connection, List: true, Args: serialArgs,
+			Resolve: func(_ any, args graphql.Args) (any, error) {
+				if serial := args.String("serial", ""); serial != "" {
+					return a.store.GetConnectionsBySerial(serial, graphqlLimit(args)), nil
+				}
+				return a.store.GetRecentConnections(graphqlLimit(args)), nil
+			},
+		},
+		"traffic": {
+			Type: traffic, Args: map[string]string{"serial": graphql.String, "window": graphql.String, "top": graphql.Int},
+			Resolve: func(_ any, args graphql.Args) (any, error) {
+				q, err := trafficQuery(args.String("serial", ""), args)
+				if err != nil {
+					return nil, err
+				}
+				return a.store.TrafficStats(q), nil
+			},
+		},
+	}}
+
+	return &graphql.Schema{Query: query}
+}
+
+// engineTraffic returns the running capture's traffic snapshot.
+func (a *App) engineTraffic(serial string) (capture.TrafficSnapshot, bool) {
+	a.mu.Lock()
+	dc, ok := a.captures[serial]
+	a.mu.Unlock()
+	if !ok {
+		return capture.TrafficSnapshot{}, false
+	}
+	return dc.engine.Traffic()
+}
+
+func graphqlLimit(args graphql.Args) int {
+	n := args.Int("limit", graphqlDefaultLimit)
+	if n <= 0 {
+		return graphqlDefaultLimit
+	}
+	return min(n, graphqlMaxLimit)
+}
+
+// trafficQuery maps window/top arguments the way /api/stats/traffic parses
+// its query string.
+func trafficQuery(serial string, args graphql.Args) (store.TrafficQuery, error) {
+	q := store.TrafficQuery{Serial: serial, Window: defaultTrafficWindow, TopN: args.Int("top", store.DefaultTopN)}
+	if s := args.String("window", ""); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 || d > maxTrafficWindow {
+			return q, fmt.Errorf("window must be a duration between 0 and %s", maxTrafficWindow)
+		}
+		q.Window = d
+	}
+	return q, nil
+}
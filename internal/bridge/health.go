@@ -0,0 +1,215 @@
+package bridge
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/health"
+	"github.com/imcanugur/go-adb-monitor/internal/labels"
+	"github.com/imcanugur/go-adb-monitor/internal/linkstat"
+	"github.com/imcanugur/go-adb-monitor/internal/netstate"
+	"github.com/imcanugur/go-adb-monitor/internal/store"
+)
+
+const (
+	// healthProbeInterval is how often every online device is probed.
+	healthProbeInterval = 30 * time.Second
+	// healthProbeTimeout bounds a single device probe.
+	healthProbeTimeout = 10 * time.Second
+	// healthProbeConcurrency limits simultaneous probes so a large lab does
+	// not open hundreds of shells at once.
+	healthProbeConcurrency = 16
+	// healthProbeCmd doubles as the latency probe and the battery reading.
+	healthProbeCmd = "dumpsys battery"
+	// thermalProbeCmd reads the thermal status (Android 10 and later).
+	thermalProbeCmd = "dumpsys thermalservice"
+)
+
+// healthChange is the payload of device:health_changed.
+type healthChange struct {
+	Serial   string        `json:"serial"`
+	Status   health.Status `json:"status"`
+	Previous health.Status `json:"previous"`
+	Score    int           `json:"score"`
+	Reasons  []string      `json:"reasons,omitempty"`
+}
+
+// deviceStatus is a device as served by /api/devices: the ADB view plus its
+// label, latest health score, foreground app, network and link quality.
+type deviceStatus struct {
+	adb.Device
+	Label       *labels.Label         `json:"label,omitempty"`
+	Health      *health.Result        `json:"health,omitempty"`
+	Foreground  *store.ForegroundSpan `json:"foreground,omitempty"`
+	Network     *netstate.State       `json:"network,omitempty"`
+	LinkQuality *linkstat.Stats       `json:"link_quality,omitempty"`
+}
+
+// withHealth attaches labels, the latest health results, foreground apps,
+// network states and link quality to devices.
+func (a *App) withHealth(devices []adb.Device) []deviceStatus {
+	out := make([]deviceStatus, len(devices))
+	for i, d := range devices {
+		out[i].Device = d
+		out[i].Label = a.labelOf(d.Serial)
+		if r, ok := a.health.Get(d.Serial); ok {
+			out[i].Health = &r
+		}
+		if f, ok := a.store.Foreground(d.Serial); ok {
+			out[i].Foreground = &f
+		}
+		if n, ok := a.network.Get(d.Serial); ok {
+			out[i].Network = &n
+		}
+		if l, ok := a.links.Get(d.Serial); ok {
+			out[i].LinkQuality = &l
+		}
+	}
+	return out
+}
+
+// probeHealth periodically probes every online device, scores every device
+// and broadcasts device:health with the new scores, and
+// device:health_changed for each device whose status changed.
+func (a *App) probeHealth(ctx context.Context) {
+	ticker := time.NewTicker(healthProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		a.probeAllHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) probeAllHealth(ctx context.Context) {
+	devices := a.GetDevices()
+	if len(devices) == 0 {
+		return
+	}
+	status := a.GetCaptureStatus()
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, healthProbeConcurrency)
+	)
+	results := make(map[string]health.Result, len(devices))
+	for _, d := range devices {
+		captureErrors := int64(-1)
+		var lastActivity time.Time
+		var stats *capture.CaptureStats
+		if st, ok := status[d.Serial]; ok {
+			captureErrors = st.Errors
+			lastActivity = st.LastActivity
+			if lastActivity.IsZero() {
+				lastActivity = st.StartedAt
+			}
+			stats = &st
+		}
+		if !d.State.IsOnline() {
+			// Offline and unauthorized devices cannot be probed; their
+			// state says enough.
+			r, prev := a.health.Update(d.Serial, health.Input{Now: time.Now(), State: string(d.State), CaptureErrors: -1})
+			a.healthChanged(d.Serial, r, prev)
+			mu.Lock()
+			results[d.Serial] = r
+			mu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(d adb.Device) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			in := a.probeDevice(ctx, d)
+			in.CaptureErrors = captureErrors
+			in.LastActivity = lastActivity
+			r, prev := a.health.Update(d.Serial, in)
+			a.healthChanged(d.Serial, r, prev)
+			if in.Battery != nil {
+				a.recordBattery(d.Serial, in.Battery, in.Now)
+			}
+			a.recordMetrics(d.Serial, r, stats)
+
+			mu.Lock()
+			results[d.Serial] = r
+			mu.Unlock()
+		}(d)
+	}
+	wg.Wait()
+
+	if ctx.Err() == nil {
+		a.sse.Broadcast("device:health", results)
+	}
+}
+
+// healthChanged announces a status transition; the first result of a
+// device is not one.
+func (a *App) healthChanged(serial string, r health.Result, prev health.Status) {
+	if prev == "" || prev == r.Status {
+		return
+	}
+	a.log.Info("device health changed", "serial", serial, "from", prev, "to", r.Status, "score", r.Score)
+	a.sse.Broadcast("device:health_changed", healthChange{
+		Serial:   serial,
+		Status:   r.Status,
+		Previous: prev,
+		Score:    r.Score,
+		Reasons:  r.Reasons,
+	})
+}
+
+// probeDevice times a shell round trip that also reads the battery state,
+// then reads the thermal status.
+func (a *App) probeDevice(ctx context.Context, d adb.Device) health.Input {
+	probeCtx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	res, err := a.client.ShellV2(probeCtx, d.Serial, healthProbeCmd)
+	in := health.Input{Now: time.Now(), State: string(d.State), ShellLatency: time.Since(start), ShellErr: err}
+	if err != nil {
+		return in
+	}
+	if d.Class.HasBattery() {
+		if b, ok := health.ParseBattery(res.Stdout); ok {
+			in.Battery = &b
+		}
+	}
+	if res, err := a.client.ShellV2(probeCtx, d.Serial, thermalProbeCmd); err == nil {
+		in.Thermal, _ = health.ParseThermalStatus(res.Stdout)
+	}
+	return in
+}
+
+// handleGetDeviceHealth serves the latest health of a device, which is
+// kept while it is offline.
+func (a *App) handleGetDeviceHealth(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	if res, ok := a.health.Get(serial); ok {
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	a.mu.Lock()
+	_, known := a.devices[serial]
+	a.mu.Unlock()
+	if !known {
+		writeErrorCode(w, http.StatusNotFound, codeDeviceNotFound, "device not found")
+		return
+	}
+	writeErrorCode(w, http.StatusNotFound, codeNotFound, "no health reading yet")
+}
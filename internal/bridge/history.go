@@ -0,0 +1,85 @@
+package bridge
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+	"github.com/imcanugur/go-adb-monitor/internal/store"
+)
+
+// historyEvents are the device events kept in the event history.
+var historyEvents = []event.Type{
+	event.DeviceConnected,
+	event.DeviceDisconnected,
+	event.DeviceStateChanged,
+	event.DeviceProperties,
+	event.DevicePropertiesChanged,
+	event.SecurityPropChanged,
+	event.ADBServerRestarted,
+	event.ADBServerDown,
+	event.ADBServerUp,
+}
+
+// recordDeviceEvent keeps e in the event history if it is one of
+// historyEvents.
+func (a *App) recordDeviceEvent(e event.Event) {
+	if isHistoryEvent(e.Type) {
+		a.store.AddDeviceEvent(e)
+	}
+}
+
+// handleListDeviceEvents lists the device event history, newest first.
+// Query parameters: serial, type (comma-separated), from, to, n.
+func (a *App) handleListDeviceEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var query store.EventQuery
+	var err error
+	if query.From, err = parseTimeParam(q.Get("from")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	if query.To, err = parseTimeParam(q.Get("to")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+	for _, t := range strings.Split(q.Get("type"), ",") {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		if !isHistoryEvent(event.Type(t)) {
+			writeError(w, http.StatusBadRequest, "invalid type: "+t)
+			return
+		}
+		query.Types = append(query.Types, event.Type(t))
+	}
+	query.Serial = q.Get("serial")
+	n := queryInt(r, "n", 500)
+
+	team := a.teamOf(r)
+	if team == "" {
+		query.Limit = n
+	}
+	events := a.store.DeviceEvents(query)
+
+	// Team tokens see the events of their devices only.
+	out := events[:0]
+	for _, e := range events {
+		if len(out) == n {
+			break
+		}
+		if team == "" || a.teams.Owns(team, e.Serial) {
+			out = append(out, e)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func isHistoryEvent(t event.Type) bool {
+	for _, h := range historyEvents {
+		if t == h {
+			return true
+		}
+	}
+	return false
+}
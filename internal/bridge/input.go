@@ -0,0 +1,120 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/input"
+)
+
+const (
+	// inputStepTimeout bounds one input command.
+	inputStepTimeout = 10 * time.Second
+	// maxInputBody bounds the request body.
+	maxInputBody = 256 << 10
+)
+
+// inputRequest is the body of POST /api/devices/{serial}/input: either
+// Actions or a Script in the format of input.ParseScript.
+type inputRequest struct {
+	Actions []input.Action `json:"actions,omitempty"`
+	Script  string         `json:"script,omitempty"`
+}
+
+// inputStep is one action that ran.
+type inputStep struct {
+	Action  input.Action `json:"action"`
+	Command string       `json:"command,omitempty"`
+	Output  string       `json:"output,omitempty"`
+}
+
+// inputResult is the response of the input endpoint. StartedAt and EndedAt
+// bound the traffic the sequence caused. A sequence stops at the first
+// failing action, which Error describes; Steps are those that ran.
+type inputResult struct {
+	Serial    string      `json:"serial"`
+	Steps     []inputStep `json:"steps"`
+	StartedAt time.Time   `json:"started_at"`
+	EndedAt   time.Time   `json:"ended_at"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// runInput performs actions on serial in order, waiting out sleeps on the
+// host. The caller sets EndedAt.
+func (a *App) runInput(ctx context.Context, serial string, actions []input.Action) (inputResult, error) {
+	res := inputResult{Serial: serial, Steps: []inputStep{}, StartedAt: time.Now()}
+
+	for i, act := range actions {
+		step := inputStep{Action: act, Command: act.Command()}
+		if act.Type == input.Sleep {
+			select {
+			case <-time.After(time.Duration(act.DurationMs) * time.Millisecond):
+			case <-ctx.Done():
+				return res, ctx.Err()
+			}
+			res.Steps = append(res.Steps, step)
+			continue
+		}
+
+		stepCtx, cancel := context.WithTimeout(ctx, inputStepTimeout)
+		out, err := a.client.ShellV2(stepCtx, serial, step.Command)
+		cancel()
+		if err == nil {
+			err = out.Err()
+		}
+		if err != nil {
+			return res, fmt.Errorf("action %d (%s): %w", i+1, act.Type, err)
+		}
+		step.Output = out.Stdout
+		res.Steps = append(res.Steps, step)
+	}
+	return res, nil
+}
+
+// ============================================
+// HTTP Handlers
+// ============================================
+
+// handleDeviceInput injects taps, swipes, text and key events, given as
+// JSON actions or a script, and answers once the sequence has run.
+func (a *App) handleDeviceInput(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	var req inputRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxInputBody)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if (len(req.Actions) > 0) == (req.Script != "") {
+		writeError(w, http.StatusBadRequest, "give either actions or script")
+		return
+	}
+	actions := req.Actions
+	var err error
+	if req.Script != "" {
+		actions, err = input.ParseScript(req.Script)
+	} else {
+		err = input.Validate(actions)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, err := a.runInput(r.Context(), serial, actions)
+	res.EndedAt = time.Now()
+	a.log.Info("device input", "serial", serial, "actions", len(actions), "ran", len(res.Steps), "error", err)
+	if err != nil {
+		if len(res.Steps) == 0 {
+			writeADBError(w, http.StatusBadGateway, err)
+			return
+		}
+		res.Error = err.Error()
+		writeJSON(w, http.StatusBadGateway, res)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,143 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+	"github.com/imcanugur/go-adb-monitor/internal/labels"
+)
+
+// maxLabelBody bounds the body of PUT /api/devices/{serial}/label.
+const maxLabelBody = 16 << 10
+
+// labelRequest is the body of PUT /api/devices/{serial}/label. It replaces
+// the device's label; omitted fields are cleared.
+type labelRequest struct {
+	Name  string   `json:"name,omitempty"`
+	Group string   `json:"group,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// deviceEvent is a device event as sent over SSE, with the device's label.
+type deviceEvent struct {
+	event.Event
+	Label *labels.Label `json:"label,omitempty"`
+}
+
+// labelOf returns the label of serial, or nil if it has none.
+func (a *App) labelOf(serial string) *labels.Label {
+	if l, ok := a.labels.Get(serial); ok {
+		return &l
+	}
+	return nil
+}
+
+// labeled attaches the device's label to e.
+func (a *App) labeled(e event.Event) deviceEvent {
+	return deviceEvent{Event: e, Label: a.labelOf(e.Serial)}
+}
+
+// deviceSelector is a group and tag selection of devices from the group and
+// tag query parameters, limited to the caller's team.
+type deviceSelector struct {
+	Group, Tag string
+	// Team, when set, limits the selection to the team's devices.
+	Team string
+}
+
+func (a *App) selectorFromQuery(r *http.Request) deviceSelector {
+	v := r.URL.Query()
+	return deviceSelector{Group: v.Get("group"), Tag: v.Get("tag"), Team: a.teamOf(r)}
+}
+
+// IsZero reports whether the selector selects every device.
+func (s deviceSelector) IsZero() bool {
+	return s.Group == "" && s.Tag == "" && s.Team == ""
+}
+
+// byLabel reports whether the selector chooses by group or tag.
+func (s deviceSelector) byLabel() bool {
+	return s.Group != "" || s.Tag != ""
+}
+
+// selects reports whether serial matches sel.
+func (a *App) selects(sel deviceSelector, serial string) bool {
+	if sel.Team != "" && !a.teams.Owns(sel.Team, serial) {
+		return false
+	}
+	if !sel.byLabel() {
+		return true
+	}
+	l, ok := a.labels.Get(serial)
+	return ok && l.Matches(sel.Group, sel.Tag)
+}
+
+func (a *App) handleListLabels(w http.ResponseWriter, r *http.Request) {
+	all := a.labels.All()
+	if team := a.teamOf(r); team != "" {
+		all = slices.DeleteFunc(all, func(l labels.Label) bool { return !a.teams.Owns(team, l.Serial) })
+	}
+	writeJSON(w, http.StatusOK, all)
+}
+
+func (a *App) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	groups := a.labels.Groups()
+	if team := a.teamOf(r); team != "" {
+		for i := range groups {
+			groups[i].Serials = slices.DeleteFunc(groups[i].Serials, func(s string) bool { return !a.teams.Owns(team, s) })
+		}
+		groups = slices.DeleteFunc(groups, func(g labels.Group) bool { return len(g.Serials) == 0 })
+	}
+	writeJSON(w, http.StatusOK, groups)
+}
+
+func (a *App) handleGetLabel(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	l, ok := a.labels.Get(serial)
+	if !ok {
+		l = labels.Label{Serial: serial}
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+func (a *App) handleSetLabel(w http.ResponseWriter, r *http.Request) {
+	var req labelRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxLabelBody)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	l, err := a.labels.Set(labels.Label{Serial: r.PathValue("serial"), Name: req.Name, Group: req.Group, Tags: req.Tags})
+	if err != nil {
+		writeLabelError(w, err)
+		return
+	}
+	a.sse.Broadcast("device:labeled", l)
+	writeJSON(w, http.StatusOK, l)
+}
+
+func (a *App) handleDeleteLabel(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	ok, err := a.labels.Delete(serial)
+	if err != nil {
+		writeLabelError(w, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "device has no label")
+		return
+	}
+	a.sse.Broadcast("device:labeled", labels.Label{Serial: serial})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func writeLabelError(w http.ResponseWriter, err error) {
+	if errors.Is(err, labels.ErrInvalid) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
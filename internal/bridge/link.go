@@ -0,0 +1,125 @@
+package bridge
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/linkstat"
+)
+
+const (
+	// linkProbeInterval is how often every online device's ADB round trip
+	// is measured.
+	linkProbeInterval = 15 * time.Second
+	// linkProbeTimeout bounds one round trip; a slower one counts as
+	// failed.
+	linkProbeTimeout = 5 * time.Second
+	// linkProbeConcurrency limits simultaneous probes.
+	linkProbeConcurrency = 16
+	// linkProbeCmd does nothing on the device, so the probe times ADB
+	// itself: the transport, adbd and a shell start.
+	linkProbeCmd = "echo"
+)
+
+// probeLinks periodically measures the ADB round trip of every online
+// device and broadcasts device:link with the link quality of each.
+func (a *App) probeLinks(ctx context.Context) {
+	ticker := time.NewTicker(linkProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		a.probeAllLinks(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) probeAllLinks(ctx context.Context) {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, linkProbeConcurrency)
+	)
+	results := make(map[string]linkstat.Stats)
+	for _, d := range a.GetDevices() {
+		if !d.State.IsOnline() {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			st := a.probeLink(ctx, d)
+			mu.Lock()
+			results[d.Serial] = st
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() == nil && len(results) > 0 {
+		a.sse.Broadcast("device:link", results)
+	}
+}
+
+// probeLink times one round trip to d and records it. The device's
+// features are read on its first probe, before the clock starts; the
+// client picks the shell protocol by them.
+func (a *App) probeLink(ctx context.Context, d adb.Device) linkstat.Stats {
+	probeCtx, cancel := context.WithTimeout(ctx, linkProbeTimeout)
+	defer cancel()
+
+	if _, ok := a.links.Features(d.Serial); !ok {
+		features, err := a.client.Features(probeCtx, d.Serial)
+		if err != nil {
+			a.log.Debug("device features unavailable", "serial", d.Serial, "error", err)
+			features = []string{}
+		}
+		a.links.SetLink(d.Serial, d.Link, features)
+	}
+
+	start := time.Now()
+	_, err := a.client.ShellV2(probeCtx, d.Serial, linkProbeCmd)
+	rtt := time.Since(start)
+	st := a.links.Record(d.Serial, rtt, err, time.Now())
+	if err != nil {
+		return st
+	}
+
+	a.mu.Lock()
+	if cur, ok := a.devices[d.Serial]; ok {
+		cur.LatencyMs = st.LatencyMs
+		a.devices[d.Serial] = cur
+	}
+	a.mu.Unlock()
+	return st
+}
+
+// handleGetDeviceLink serves the link type and quality of a device.
+func (a *App) handleGetDeviceLink(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	if st, ok := a.links.Get(serial); ok {
+		writeJSON(w, http.StatusOK, st)
+		return
+	}
+	a.mu.Lock()
+	_, known := a.devices[serial]
+	a.mu.Unlock()
+	if !known {
+		writeErrorCode(w, http.StatusNotFound, codeDeviceNotFound, "device not found")
+		return
+	}
+	writeErrorCode(w, http.StatusNotFound, codeNotFound, "link not probed yet")
+}
@@ -0,0 +1,171 @@
+package bridge
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/imcanugur/go-adb-monitor/internal/anomaly"
+	"github.com/imcanugur/go-adb-monitor/internal/notify"
+)
+
+// handleMetrics serves device and capture counters in the Prometheus text
+// exposition format. `adb-monitor alert-rules` generates alerting rules over
+// these series that mirror the webhook triggers.
+func (a *App) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	a.writeMetrics(bw)
+	bw.Flush()
+}
+
+func (a *App) writeMetrics(w io.Writer) {
+	a.mu.Lock()
+	states := make(map[string]string, len(a.devices))
+	for serial, d := range a.devices {
+		states[serial] = string(d.State)
+	}
+	disconnects := make(map[string]uint64, len(a.disconnects))
+	for serial, n := range a.disconnects {
+		disconnects[serial] = n
+	}
+	a.mu.Unlock()
+	captures := a.GetCaptureStatus()
+
+	header(w, notify.MetricDeviceState, "gauge", "1 for each device known to the ADB server, labelled with its state.")
+	for _, serial := range sortedKeys(states) {
+		fmt.Fprintf(w, "%s{serial=%s,state=%s} 1\n", notify.MetricDeviceState, label(serial), label(states[serial]))
+	}
+
+	header(w, notify.MetricDeviceDisconnects, "counter", "Times a device dropped off the ADB server.")
+	for _, serial := range sortedKeys(disconnects) {
+		fmt.Fprintf(w, "%s{serial=%s} %d\n", notify.MetricDeviceDisconnects, label(serial), disconnects[serial])
+	}
+
+	header(w, notify.MetricCaptureErrors, "counter", "Capture errors since the capture started.")
+	for _, serial := range sortedKeys(captures) {
+		st := captures[serial]
+		fmt.Fprintf(w, "%s{serial=%s,mode=%s} %d\n", notify.MetricCaptureErrors, label(serial), label(st.Mode), st.Errors)
+	}
+
+	header(w, notify.MetricCaptureRestarts, "counter", "Supervisor restarts of the capture stream.")
+	for _, serial := range sortedKeys(captures) {
+		st := captures[serial]
+		fmt.Fprintf(w, "%s{serial=%s,mode=%s} %d\n", notify.MetricCaptureRestarts, label(serial), label(st.Mode), st.Restarts)
+	}
+
+	header(w, notify.MetricDeviceHealth, "gauge", "Device health score from 0 (worst) to 100.")
+	for _, serial := range sortedKeys(states) {
+		if res, ok := a.health.Get(serial); ok {
+			fmt.Fprintf(w, "%s{serial=%s} %d\n", notify.MetricDeviceHealth, label(serial), res.Score)
+		}
+	}
+
+	a.batteryMu.Lock()
+	warnings := make([]batteryWarningKey, 0, len(a.batteryWarnings))
+	counts := make(map[batteryWarningKey]uint64, len(a.batteryWarnings))
+	for k, n := range a.batteryWarnings {
+		warnings = append(warnings, k)
+		counts[k] = n
+	}
+	a.batteryMu.Unlock()
+	sort.Slice(warnings, func(i, j int) bool {
+		if warnings[i].serial != warnings[j].serial {
+			return warnings[i].serial < warnings[j].serial
+		}
+		return warnings[i].kind < warnings[j].kind
+	})
+	header(w, notify.MetricCaptureBatteryWarnings, "counter", "Captures draining their device's battery fast, or paused for a low battery.")
+	for _, k := range warnings {
+		fmt.Fprintf(w, "%s{serial=%s,kind=%s} %d\n", notify.MetricCaptureBatteryWarnings, label(k.serial), label(k.kind), counts[k])
+	}
+
+	bst := a.bus.Stats()
+	header(w, notify.MetricEventsDropped, "counter", "Device events lost to a full subscriber queue.")
+	for _, s := range bst.Subscribers {
+		fmt.Fprintf(w, "%s{subscriber=%s} %d\n", notify.MetricEventsDropped, label(s.Name), s.Dropped)
+	}
+	header(w, notify.MetricEventHandlerErrors, "counter", "Device event handler calls that panicked or timed out.")
+	for _, s := range bst.Subscribers {
+		fmt.Fprintf(w, "%s{subscriber=%s,kind=\"panic\"} %d\n", notify.MetricEventHandlerErrors, label(s.Name), s.Panics)
+		fmt.Fprintf(w, "%s{subscriber=%s,kind=\"timeout\"} %d\n", notify.MetricEventHandlerErrors, label(s.Name), s.Timeouts)
+	}
+
+	pst := a.pool.Stats()
+	header(w, notify.MetricPoolActive, "gauge", "Worker pool tasks running.")
+	fmt.Fprintf(w, "%s %d\n", notify.MetricPoolActive, pst.Active)
+	header(w, notify.MetricPoolPending, "gauge", "Worker pool tasks waiting for a worker.")
+	for _, prio := range sortedKeys(pst.Pending) {
+		fmt.Fprintf(w, "%s{priority=%s} %d\n", notify.MetricPoolPending, label(prio), pst.Pending[prio])
+	}
+
+	if a.sink != nil {
+		sst := a.sink.Stats()
+		header(w, notify.MetricSinkRecords, "counter", "Records sent to the output sink, by outcome.")
+		fmt.Fprintf(w, "%s{outcome=\"published\"} %d\n", notify.MetricSinkRecords, sst.Published)
+		fmt.Fprintf(w, "%s{outcome=\"dropped\"} %d\n", notify.MetricSinkRecords, sst.Dropped)
+		fmt.Fprintf(w, "%s{outcome=\"failed\"} %d\n", notify.MetricSinkRecords, sst.Failed)
+	}
+	if a.elastic != nil {
+		est := a.elastic.Stats()
+		header(w, notify.MetricElasticDocuments, "counter", "Documents sent to Elasticsearch, by outcome.")
+		fmt.Fprintf(w, "%s{outcome=\"indexed\"} %d\n", notify.MetricElasticDocuments, est.Indexed)
+		fmt.Fprintf(w, "%s{outcome=\"dropped\"} %d\n", notify.MetricElasticDocuments, est.Dropped)
+		fmt.Fprintf(w, "%s{outcome=\"failed\"} %d\n", notify.MetricElasticDocuments, est.Failed)
+	}
+
+	if a.processor != nil {
+		prst := a.processor.Stats()
+		header(w, notify.MetricProcessorRecords, "counter", "Records sent to the external processor, by outcome.")
+		fmt.Fprintf(w, "%s{outcome=\"annotated\"} %d\n", notify.MetricProcessorRecords, prst.Annotated)
+		fmt.Fprintf(w, "%s{outcome=\"unchanged\"} %d\n", notify.MetricProcessorRecords, prst.Unchanged)
+		fmt.Fprintf(w, "%s{outcome=\"sent\"} %d\n", notify.MetricProcessorRecords, prst.Sent)
+		fmt.Fprintf(w, "%s{outcome=\"timed_out\"} %d\n", notify.MetricProcessorRecords, prst.TimedOut)
+		fmt.Fprintf(w, "%s{outcome=\"dropped\"} %d\n", notify.MetricProcessorRecords, prst.Dropped)
+		fmt.Fprintf(w, "%s{outcome=\"failed\"} %d\n", notify.MetricProcessorRecords, prst.Failed)
+		header(w, notify.MetricProcessorRestarts, "counter", "Restarts of the external processor command.")
+		fmt.Fprintf(w, "%s %d\n", notify.MetricProcessorRestarts, prst.Restarts)
+	}
+
+	if a.anomalies == nil {
+		return
+	}
+	totals := a.anomalies.Totals()
+	keys := make([]anomaly.Total, 0, len(totals))
+	for t := range totals {
+		keys = append(keys, t)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Serial != keys[j].Serial {
+			return keys[i].Serial < keys[j].Serial
+		}
+		return keys[i].Kind < keys[j].Kind
+	})
+	header(w, notify.MetricTrafficAnomalies, "counter", "Traffic anomalies reported against learned baselines.")
+	for _, t := range keys {
+		fmt.Fprintf(w, "%s{serial=%s,kind=%s} %d\n", notify.MetricTrafficAnomalies, label(t.Serial), label(string(t.Kind)), totals[t])
+	}
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labelEscaper escapes a label value for the text exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func label(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
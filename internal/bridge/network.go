@@ -0,0 +1,101 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/netstate"
+)
+
+const (
+	// networkRefreshInterval is how often every online device's network
+	// state is re-read.
+	networkRefreshInterval = time.Minute
+	// networkRefreshTimeout bounds a single device read.
+	networkRefreshTimeout = 15 * time.Second
+)
+
+// trackNetwork periodically reads the network state of every online
+// device, samples the Wi-Fi metrics and broadcasts device:network with the
+// states that changed.
+func (a *App) trackNetwork(ctx context.Context) {
+	ticker := time.NewTicker(networkRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		a.refreshAllNetwork(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) refreshAllNetwork(ctx context.Context) {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, healthProbeConcurrency)
+	)
+	changed := make(map[string]netstate.State)
+	for _, d := range a.GetDevices() {
+		if !d.State.IsOnline() {
+			continue
+		}
+		wg.Add(1)
+		go func(d adb.Device) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			s, err := a.readNetwork(ctx, d.Serial)
+			if err != nil {
+				if ctx.Err() == nil {
+					a.log.Debug("network state read failed", "serial", d.Serial, "error", err)
+				}
+				return
+			}
+			if s.RSSI != 0 {
+				a.series.Add(d.Serial, metricWifiRSSI, s.UpdatedAt, float64(s.RSSI))
+			}
+			if s.LinkSpeedMbps != 0 {
+				a.series.Add(d.Serial, metricWifiLinkSpeed, s.UpdatedAt, float64(s.LinkSpeedMbps))
+			}
+			if a.network.Update(d.Serial, s) {
+				mu.Lock()
+				changed[d.Serial] = s
+				mu.Unlock()
+			}
+		}(d)
+	}
+	wg.Wait()
+
+	if len(changed) > 0 && ctx.Err() == nil {
+		a.sse.Broadcast("device:network", changed)
+	}
+}
+
+// readNetwork reads the device's network state.
+func (a *App) readNetwork(ctx context.Context, serial string) (netstate.State, error) {
+	ctx, cancel := context.WithTimeout(ctx, networkRefreshTimeout)
+	defer cancel()
+
+	res, err := a.client.ShellV2(ctx, serial, netstate.Cmd)
+	if err != nil {
+		return netstate.State{}, err
+	}
+	s, ok := netstate.Parse(res.Stdout)
+	if !ok {
+		return netstate.State{}, fmt.Errorf("no connectivity or wifi state in dumpsys output")
+	}
+	s.UpdatedAt = time.Now()
+	return s, nil
+}
@@ -0,0 +1,173 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/notify"
+)
+
+// watchCaptureErrors samples capture error counters and fires a
+// capture_error_spike notification when a device's errors grow faster than
+// the configured threshold.
+func (a *App) watchCaptureErrors(ctx context.Context) {
+	ticker := time.NewTicker(notify.ErrorSpikeInterval)
+	defer ticker.Stop()
+
+	last := make(map[string]int64)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		status := a.GetCaptureStatus()
+		for serial, st := range status {
+			delta := st.Errors - last[serial]
+			last[serial] = st.Errors
+			if delta < int64(a.errorSpikeThreshold) {
+				continue
+			}
+			a.notifier.Notify(notify.Notification{
+				Trigger: notify.TriggerCaptureErrorSpike,
+				Serial:  serial,
+				Message: fmt.Sprintf("capture on %s logged %d errors in %s", serial, delta, notify.ErrorSpikeInterval),
+				Details: map[string]string{
+					"errors":   strconv.FormatInt(delta, 10),
+					"interval": notify.ErrorSpikeInterval.String(),
+					"mode":     st.Mode,
+				},
+			})
+		}
+		for serial := range last {
+			if _, ok := status[serial]; !ok {
+				delete(last, serial)
+			}
+		}
+	}
+}
+
+// drainDegraded relays capture supervisor events to the dashboard and to
+// capture_degraded webhooks.
+func (a *App) drainDegraded(ch <-chan capture.DegradedEvent, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			a.sse.Broadcast("capture:degraded", ev)
+
+			msg := fmt.Sprintf("%s capture on %s restarting: %s", ev.Mode, ev.Serial, ev.Reason)
+			if ev.Fallback != "" {
+				msg = fmt.Sprintf("%s capture on %s fell back to %s: %s", ev.Mode, ev.Serial, ev.Fallback, ev.Reason)
+			}
+			a.notifier.Notify(notify.Notification{
+				Trigger: notify.TriggerCaptureDegraded,
+				Serial:  ev.Serial,
+				Message: msg,
+				Details: map[string]string{
+					"mode":     ev.Mode,
+					"reason":   ev.Reason,
+					"restarts": strconv.Itoa(ev.Restarts),
+					"fallback": ev.Fallback,
+				},
+			})
+		}
+	}
+}
+
+// drainBackpressure broadcasts capture:backpressure for a capture whose
+// consumers fall behind.
+func (a *App) drainBackpressure(ch <-chan capture.BackpressureEvent, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case ev := <-ch:
+			a.sse.Broadcast("capture:backpressure", ev)
+		}
+	}
+}
+
+// ============================================
+// HTTP Handlers
+// ============================================
+
+func (a *App) handleListNotifications(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.notifier.List())
+}
+
+func (a *App) handleGetNotification(w http.ResponseWriter, r *http.Request) {
+	hook, err := a.notifier.Get(r.PathValue("id"))
+	if err != nil {
+		writeNotifyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hook)
+}
+
+func (a *App) handleCreateNotification(w http.ResponseWriter, r *http.Request) {
+	var hook notify.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	created, err := a.notifier.Add(hook)
+	if err != nil {
+		writeNotifyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (a *App) handleUpdateNotification(w http.ResponseWriter, r *http.Request) {
+	var hook notify.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	updated, err := a.notifier.Update(r.PathValue("id"), hook)
+	if err != nil {
+		writeNotifyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (a *App) handleDeleteNotification(w http.ResponseWriter, r *http.Request) {
+	if err := a.notifier.Remove(r.PathValue("id")); err != nil {
+		writeNotifyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (a *App) handleTestNotification(w http.ResponseWriter, r *http.Request) {
+	if err := a.notifier.Test(r.PathValue("id")); err != nil {
+		writeNotifyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "queued"})
+}
+
+func writeNotifyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, notify.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, notify.ErrInvalid):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
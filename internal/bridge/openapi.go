@@ -0,0 +1,316 @@
+package bridge
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// openAPIVersion is the version of the API described by /api/openapi.json.
+const openAPIVersion = "1.0.0"
+
+//go:embed swagger.html
+var swaggerHTML []byte
+
+var pathParamRe = regexp.MustCompile(`\{([^}]+)\}`)
+
+// handleOpenAPI serves the OpenAPI 3 document generated from routes().
+func (a *App) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	a.openAPIOnce.Do(func() {
+		a.openAPIDoc = buildOpenAPI(a.routes(), a.readOnly)
+		if a.basePath != "" {
+			a.openAPIDoc["servers"] = []any{map[string]any{"url": a.basePath}}
+		}
+	})
+	writeJSON(w, http.StatusOK, a.openAPIDoc)
+}
+
+// handleSwaggerUI serves a Swagger UI page for /api/openapi.json. The UI
+// itself is loaded from unpkg.com.
+func handleSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(swaggerHTML)
+}
+
+// buildOpenAPI describes routes as an OpenAPI 3.0 document. Response and
+// request schemas are derived from the Go types of route.resp and
+// route.body by their JSON encoding.
+func buildOpenAPI(routes []route, readOnly bool) map[string]any {
+	g := &schemaGen{components: map[string]any{}, names: map[string]reflect.Type{}}
+	g.components["Error"] = map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"error": map[string]any{"type": "string", "description": "Human-readable message"},
+			"code":  map[string]any{"type": "string", "enum": errorCodes, "description": "Machine-readable error code"},
+		},
+		"required": []string{"error", "code"},
+	}
+
+	paths := map[string]any{}
+	for _, rt := range routes {
+		item, _ := paths[rt.path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[rt.path] = item
+		}
+		item[strings.ToLower(rt.method)] = g.operation(rt, readOnly)
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "ADB Monitor API",
+			"version":     openAPIVersion,
+			"description": "Device, capture and traffic API of go-adb-monitor.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": g.components,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+				"token":  map[string]any{"type": "apiKey", "in": "query", "name": "token"},
+			},
+		},
+		// Authentication only applies when the server runs with -token.
+		"security": []any{map[string]any{}, map[string]any{"bearer": []string{}}, map[string]any{"token": []string{}}},
+	}
+}
+
+func (g *schemaGen) operation(rt route, readOnly bool) map[string]any {
+	op := map[string]any{
+		"operationId": operationID(rt.method, rt.path),
+		"summary":     rt.summary,
+		"tags":        []string{routeTag(rt.path)},
+	}
+
+	var params []any
+	for _, m := range pathParamRe.FindAllStringSubmatch(rt.path, -1) {
+		params = append(params, map[string]any{
+			"name": m[1], "in": "path", "required": true,
+			"schema": map[string]any{"type": "string"},
+		})
+	}
+	for _, p := range rt.params {
+		s := map[string]any{"type": "string"}
+		if p.typ != "" {
+			s["type"] = p.typ
+		}
+		if len(p.enum) > 0 {
+			s["enum"] = p.enum
+		}
+		q := map[string]any{"name": p.name, "in": "query", "schema": s}
+		if p.desc != "" {
+			q["description"] = p.desc
+		}
+		params = append(params, q)
+	}
+	if params != nil {
+		op["parameters"] = params
+	}
+
+	if rt.body != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(rt.body))}},
+		}
+	}
+
+	status := rt.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ok := map[string]any{"description": http.StatusText(status)}
+	switch {
+	case rt.content != "":
+		ok["content"] = map[string]any{rt.content: map[string]any{"schema": map[string]any{"type": "string"}}}
+	case rt.resp != nil:
+		ok["content"] = map[string]any{"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(rt.resp))}}
+	}
+	if rt.paged {
+		ok["headers"] = map[string]any{"X-Next-Cursor": map[string]any{
+			"description": "Cursor of the next page; absent on the last page",
+			"schema":      map[string]any{"type": "integer"},
+		}}
+	}
+
+	errResp := map[string]any{
+		"description": "Error",
+		"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}}},
+	}
+	responses := map[string]any{strconv.Itoa(status): ok, "default": errResp}
+	if rt.mutating {
+		responses["403"] = map[string]any{
+			"description": "Server is running in read-only mode",
+			"content":     errResp["content"],
+		}
+		if rt.admin {
+			responses["403"] = map[string]any{
+				"description": "Read-only mode, device control disabled, or admin token missing",
+				"content":     errResp["content"],
+			}
+		}
+		if readOnly {
+			op["description"] = "Disabled: this server is running in read-only mode."
+		}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// operationID derives a stable operationId from the route, e.g.
+// GET /api/devices/{serial}/battery/history → getDevicesBySerialBatteryHistory.
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, seg := range strings.Split(strings.TrimPrefix(path, "/api/"), "/") {
+		if name, ok := strings.CutPrefix(seg, "{"); ok {
+			b.WriteString("By")
+			seg = strings.TrimSuffix(name, "}")
+		}
+		for _, word := range strings.FieldsFunc(seg, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+// routeTag groups routes by their first path segment after /api/.
+func routeTag(path string) string {
+	seg, _, _ := strings.Cut(strings.TrimPrefix(path, "/api/"), "/")
+	return seg
+}
+
+// schemaGen converts Go types to OpenAPI schemas. Exported named structs
+// become shared components referenced by name.
+type schemaGen struct {
+	components map[string]any
+	// names maps a component name to the type that claimed it, so two
+	// packages' types of the same name get package-qualified names.
+	names map[string]reflect.Type
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(time.Duration(0)):
+		return map[string]any{"type": "integer", "format": "int64", "description": "nanoseconds"}
+	case reflect.TypeOf(json.RawMessage(nil)):
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		return g.structSchema(t)
+	default:
+		return map[string]any{} // interfaces: any JSON value
+	}
+}
+
+func (g *schemaGen) structSchema(t reflect.Type) map[string]any {
+	name := g.componentName(t)
+	if name == "" {
+		return g.objectSchema(t)
+	}
+	ref := map[string]any{"$ref": "#/components/schemas/" + name}
+	if _, ok := g.components[name]; !ok {
+		// Claim the name first so recursive types terminate.
+		g.components[name] = nil
+		g.components[name] = g.objectSchema(t)
+	}
+	return ref
+}
+
+// componentName returns the component name of an exported named struct,
+// or "" if t should be inlined.
+func (g *schemaGen) componentName(t reflect.Type) string {
+	name := t.Name()
+	if name == "" || !unicode.IsUpper(rune(name[0])) || strings.Contains(name, "[") {
+		return ""
+	}
+	if prev, ok := g.names[name]; ok && prev != t {
+		pkg := t.PkgPath()
+		pkg = pkg[strings.LastIndex(pkg, "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	g.names[name] = t
+	return name
+}
+
+func (g *schemaGen) objectSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	g.fields(t, props, &required)
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// fields adds t's JSON fields to props, flattening embedded structs the way
+// encoding/json does.
+func (g *schemaGen) fields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, props, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		var s map[string]any
+		if strings.Contains(opts, "string") {
+			s = map[string]any{"type": "string"}
+		} else {
+			s = g.schema(ft)
+		}
+		props[name] = s
+		if !strings.Contains(opts, "omitempty") && ft.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
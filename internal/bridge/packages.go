@@ -0,0 +1,163 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/inventory"
+)
+
+const (
+	// packageRefreshInterval is how often every online device's package
+	// inventory is re-read.
+	packageRefreshInterval = 2 * time.Minute
+	// packageRefreshTimeout bounds a single device refresh; dumpsys package
+	// is slow on devices with many apps.
+	packageRefreshTimeout = 30 * time.Second
+)
+
+// packageEvent is the payload of package:installed, package:removed and
+// package:updated.
+type packageEvent struct {
+	Serial    string             `json:"serial"`
+	Package   inventory.Package  `json:"package"`
+	Previous  *inventory.Package `json:"previous,omitempty"`
+	Timestamp time.Time          `json:"timestamp"`
+}
+
+// trackPackages periodically refreshes the package inventory of every
+// online device and broadcasts what changed.
+func (a *App) trackPackages(ctx context.Context) {
+	ticker := time.NewTicker(packageRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		a.refreshAllPackages(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) refreshAllPackages(ctx context.Context) {
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, healthProbeConcurrency)
+	)
+	for _, d := range a.GetDevices() {
+		if !d.State.IsOnline() {
+			continue
+		}
+		wg.Add(1)
+		go func(d adb.Device) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+			if _, err := a.refreshPackages(ctx, d.Serial); err != nil && ctx.Err() == nil {
+				a.log.Debug("package inventory refresh failed", "serial", d.Serial, "error", err)
+			}
+		}(d)
+	}
+	wg.Wait()
+}
+
+// refreshPackages re-reads the device's packages, broadcasts the changes
+// and returns the new inventory.
+func (a *App) refreshPackages(ctx context.Context, serial string) (inventory.Inventory, error) {
+	ctx, cancel := context.WithTimeout(ctx, packageRefreshTimeout)
+	defer cancel()
+
+	list, err := a.client.ShellV2(ctx, serial, inventory.ListCmd)
+	if err == nil {
+		err = list.Err()
+	}
+	if err != nil {
+		return inventory.Inventory{}, fmt.Errorf("list packages: %w", err)
+	}
+	pkgs := inventory.ParseList(list.Stdout)
+	if len(pkgs) == 0 {
+		// pm answers with nothing while the package manager is still
+		// starting; an empty list would report every app as removed.
+		return inventory.Inventory{}, fmt.Errorf("package manager returned no packages")
+	}
+
+	// Version names and install times are best effort.
+	if det, err := a.client.ShellV2(ctx, serial, inventory.DetailsCmd); err == nil {
+		inventory.Merge(pkgs, det.Stdout)
+	} else {
+		a.log.Debug("package details unavailable", "serial", serial, "error", err)
+	}
+
+	now := time.Now()
+	for _, c := range a.packages.Update(serial, pkgs, now) {
+		a.sse.Broadcast("package:"+string(c.Type), packageEvent{
+			Serial:    serial,
+			Package:   c.Package,
+			Previous:  c.Previous,
+			Timestamp: now,
+		})
+	}
+	inv, _ := a.packages.Get(serial)
+	return inv, nil
+}
+
+// handleGetPackages serves a device's package inventory.
+// Query parameters: q (name substring), system (true or false).
+func (a *App) handleGetPackages(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	inv, ok := a.packages.Get(serial)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no package inventory for "+serial)
+		return
+	}
+	writeInventory(w, r, inv)
+}
+
+// handleRefreshPackages re-reads a device's packages before serving them.
+func (a *App) handleRefreshPackages(w http.ResponseWriter, r *http.Request) {
+	inv, err := a.refreshPackages(r.Context(), r.PathValue("serial"))
+	if err != nil {
+		writeADBError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeInventory(w, r, inv)
+}
+
+func writeInventory(w http.ResponseWriter, r *http.Request, inv inventory.Inventory) {
+	q := r.URL.Query()
+	name := strings.ToLower(q.Get("q"))
+	var system *bool
+	if s := q.Get("system"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "system must be true or false")
+			return
+		}
+		system = &b
+	}
+
+	pkgs := make([]inventory.Package, 0, len(inv.Packages))
+	for _, p := range inv.Packages {
+		if name != "" && !strings.Contains(strings.ToLower(p.Name), name) {
+			continue
+		}
+		if system != nil && p.System != *system {
+			continue
+		}
+		pkgs = append(pkgs, p)
+	}
+	inv.Packages = pkgs
+	writeJSON(w, http.StatusOK, inv)
+}
@@ -0,0 +1,133 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/inventory"
+	"github.com/imcanugur/go-adb-monitor/internal/store"
+)
+
+const (
+	// permissionAuditTimeout bounds the dumpsys runs of one audit.
+	permissionAuditTimeout = time.Minute
+	// permissionAuditChunk is how many packages one shell command dumps.
+	permissionAuditChunk = 20
+	// maxAuditHosts is how many hosts an audit entry lists per app.
+	maxAuditHosts = 10
+)
+
+// permissionAudit is the response of the permission audit endpoint.
+type permissionAudit struct {
+	Serial      string    `json:"serial"`
+	GeneratedAt time.Time `json:"generated_at"`
+	// Flagged counts the apps with at least one finding.
+	Flagged int                    `json:"flagged"`
+	Apps    []inventory.AuditEntry `json:"apps"`
+}
+
+// handlePermissionAudit audits the permissions of the apps with stored
+// connections on a device, or of the app named by ?app=, against their
+// traffic. Query parameters: app, from, to.
+func (a *App) handlePermissionAudit(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	q := r.URL.Query()
+	app := q.Get("app")
+	if app != "" && !adb.ValidPackageName(app) {
+		writeError(w, http.StatusBadRequest, "invalid app package name")
+		return
+	}
+	f := store.Filter{Serial: serial}
+	var err error
+	if f.From, err = parseTimeParam(q.Get("from")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	if f.To, err = parseTimeParam(q.Get("to")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), permissionAuditTimeout)
+	defer cancel()
+	inv, ok := a.packages.Get(serial)
+	if !ok {
+		if inv, err = a.refreshPackages(ctx, serial); err != nil {
+			writeADBError(w, http.StatusBadGateway, err)
+			return
+		}
+	}
+
+	traffic := a.appTraffic(f)
+	var pkgs []string
+	for _, p := range inv.Packages {
+		if app != "" && p.Name == app {
+			pkgs = append(pkgs, p.Name)
+		} else if _, ok := traffic[p.UID]; app == "" && ok {
+			pkgs = append(pkgs, p.Name)
+		}
+	}
+	if app != "" && len(pkgs) == 0 {
+		writeErrorCode(w, http.StatusNotFound, codeNotFound, app+" is not installed on "+serial)
+		return
+	}
+
+	perms, err := a.readPermissions(ctx, serial, pkgs)
+	if err != nil {
+		writeADBError(w, http.StatusBadGateway, err)
+		return
+	}
+	report := permissionAudit{Serial: serial, GeneratedAt: time.Now(), Apps: inventory.Audit(perms, traffic)}
+	for _, e := range report.Apps {
+		if len(e.Findings) > 0 {
+			report.Flagged++
+		}
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// appTraffic sums the stored connections matching f by UID.
+func (a *App) appTraffic(f store.Filter) map[int]inventory.AppTraffic {
+	traffic := make(map[int]inventory.AppTraffic)
+	a.store.ScanConnections(f, func(c capture.Connection) error {
+		if c.UID < 0 {
+			return nil
+		}
+		t := traffic[c.UID]
+		t.Connections++
+		if c.RemotePort == 80 || c.RemotePort == 8080 {
+			t.Cleartext++
+		}
+		if c.Hostname != "" && len(t.Hosts) < maxAuditHosts && !slices.Contains(t.Hosts, c.Hostname) {
+			t.Hosts = append(t.Hosts, c.Hostname)
+		}
+		traffic[c.UID] = t
+		return nil
+	})
+	return traffic
+}
+
+// readPermissions runs dumpsys package for pkgs, permissionAuditChunk at a
+// time.
+func (a *App) readPermissions(ctx context.Context, serial string, pkgs []string) (map[string]inventory.Permissions, error) {
+	perms := make(map[string]inventory.Permissions, len(pkgs))
+	for i := 0; i < len(pkgs); i += permissionAuditChunk {
+		chunk := pkgs[i:min(i+permissionAuditChunk, len(pkgs))]
+		res, err := a.client.ShellV2(ctx, serial, inventory.PermissionsCmd(chunk))
+		if err == nil {
+			err = res.Err()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("dumpsys package: %w", err)
+		}
+		for name, p := range inventory.ParsePermissions(res.Stdout) {
+			perms[name] = p
+		}
+	}
+	return perms, nil
+}
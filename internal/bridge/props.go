@@ -0,0 +1,129 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+	"github.com/imcanugur/go-adb-monitor/internal/monitor"
+)
+
+// maxPropSetBody bounds the body of PUT /api/monitor/props.
+const maxPropSetBody = 64 << 10
+
+// propsChange is the payload of device:properties_changed.
+type propsChange struct {
+	Serial  string                      `json:"serial"`
+	Changes map[string]event.PropChange `json:"changes"`
+}
+
+// securityPropChange is the payload of security:prop_changed: one of the
+// security properties (monitor.SecurityPrefix) of a device changed.
+type securityPropChange struct {
+	Serial string `json:"serial"`
+	// Prop is the key without the prefix, e.g. "selinux".
+	Prop      string    `json:"prop"`
+	Old       string    `json:"old"`
+	New       string    `json:"new"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// broadcastSecurityChanges sends one security:prop_changed per changed
+// security property.
+func (a *App) broadcastSecurityChanges(e event.Event) {
+	keys := make([]string, 0, len(e.Changes))
+	for k := range e.Changes {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		c := e.Changes[k]
+		prop := strings.TrimPrefix(k, monitor.SecurityPrefix)
+		a.log.Warn("security property changed", "serial", e.Serial, "prop", prop, "old", c.Old, "new", c.New)
+		a.sse.Broadcast("security:prop_changed", securityPropChange{
+			Serial: e.Serial, Prop: prop, Old: c.Old, New: c.New, Timestamp: e.Timestamp,
+		})
+	}
+}
+
+// monitorProps is the body of GET /api/monitor/props.
+type monitorProps struct {
+	monitor.PropSet
+	// Enabled is false when the server collects no properties
+	// (-prop-interval 0); the set can still be edited.
+	Enabled bool `json:"enabled"`
+}
+
+func (a *App) handleGetMonitorProps(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, monitorProps{PropSet: a.props.Get(), Enabled: a.monitor != nil})
+}
+
+func (a *App) handleSetMonitorProps(w http.ResponseWriter, r *http.Request) {
+	var req monitor.PropSet
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxPropSetBody)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	set, err := a.props.Set(req)
+	if err != nil {
+		if errors.Is(err, monitor.ErrInvalidProps) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.log.Info("device property set changed", "props", len(set.Props), "dumpsys", len(set.Dumpsys), "probes", len(set.Probes))
+	resp := monitorProps{PropSet: set, Enabled: a.monitor != nil}
+	a.sse.Broadcast("monitor:props_updated", resp)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *App) handleGetDeviceProps(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	if r.URL.Query().Get("all") == "true" {
+		a.writeGetprop(w, r, serial)
+		return
+	}
+	a.mu.Lock()
+	_, known := a.devices[serial]
+	props, ok := a.deviceProps[serial]
+	a.mu.Unlock()
+	switch {
+	case ok:
+		writeJSON(w, http.StatusOK, props)
+	case !known:
+		writeErrorCode(w, http.StatusNotFound, codeDeviceNotFound, "device not found")
+	default:
+		writeErrorCode(w, http.StatusNotFound, codeNotFound, "no properties collected yet")
+	}
+}
+
+// writeGetprop writes every system property of a device: as of its last
+// collection, or read now when properties are not collected.
+func (a *App) writeGetprop(w http.ResponseWriter, r *http.Request, serial string) {
+	if a.monitor != nil {
+		if props, ok := a.monitor.Getprop(serial); ok {
+			writeJSON(w, http.StatusOK, props)
+			return
+		}
+	}
+	a.mu.Lock()
+	_, known := a.devices[serial]
+	a.mu.Unlock()
+	if !known {
+		writeErrorCode(w, http.StatusNotFound, codeDeviceNotFound, "device not found")
+		return
+	}
+	props, err := a.client.GetDeviceProps(r.Context(), serial)
+	if err != nil {
+		writeADBError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, props)
+}
@@ -0,0 +1,90 @@
+package bridge
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+// NormalizeBasePath cleans a path prefix to serve under: "" or "/" serve at
+// the root, anything else becomes "/prefix" without a trailing slash.
+func NormalizeBasePath(p string) (string, error) {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	if strings.ContainsAny(p, "\"'<>\\?#{} ") {
+		return "", fmt.Errorf("invalid base path %q", p)
+	}
+	p = path.Clean(p)
+	if p == "/" {
+		return "", nil
+	}
+	return p, nil
+}
+
+// WithBasePath serves h under base, a path normalized by
+// NormalizeBasePath: h sees paths without base, base itself redirects to
+// base/ and paths outside it are not found. An empty base returns h.
+func WithBasePath(base string, h http.Handler) http.Handler {
+	if base == "" {
+		return h
+	}
+	stripped := http.StripPrefix(base, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == base:
+			http.Redirect(w, r, base+"/", http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, base+"/"):
+			stripped.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// corsMethods and corsHeaders are what preflight requests are allowed.
+const (
+	corsMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsHeaders = "Authorization, Content-Type, Last-Event-ID"
+)
+
+// CORS lets pages from origins call h from a browser. "*" allows any
+// origin. Preflight requests from allowed origins are answered here, before
+// authentication, which browsers do not send them with. Requests from
+// other origins get no CORS headers, so browsers keep them same-origin. No
+// origins returns h.
+func CORS(origins []string, h http.Handler) http.Handler {
+	if len(origins) == 0 {
+		return h
+	}
+	anyOrigin := slices.Contains(origins, "*")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !anyOrigin && !slices.Contains(origins, origin) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		hdr := w.Header()
+		hdr.Add("Vary", "Origin")
+		if anyOrigin {
+			hdr.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			hdr.Set("Access-Control-Allow-Origin", origin)
+		}
+		hdr.Set("Access-Control-Expose-Headers", "X-Next-Cursor")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			hdr.Set("Access-Control-Allow-Methods", corsMethods)
+			hdr.Set("Access-Control-Allow-Headers", corsHeaders)
+			hdr.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
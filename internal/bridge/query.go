@@ -0,0 +1,190 @@
+package bridge
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/store"
+)
+
+// maxPageSize bounds the n parameter of the packet and connection lists.
+const maxPageSize = 5000
+
+// parseStoreQuery reads the paging and filter parameters shared by the
+// packet and connection lists:
+//
+//	n        page size (default 200, max 5000)
+//	cursor   continue after a previous page (its X-Next-Cursor header)
+//	order    desc (newest first, default) or asc
+//	from, to time range, RFC 3339 or Unix seconds
+//	dst_ip, host, port, protocol, app, http_method
+//
+// serial is the path's device, if any; otherwise the serial parameter.
+func parseStoreQuery(r *http.Request, serial string) (store.Query, error) {
+	v := r.URL.Query()
+	if serial == "" {
+		serial = v.Get("serial")
+	}
+	q := store.Query{
+		Filter: store.Filter{Serial: serial},
+		DstIP:  v.Get("dst_ip"),
+		Host:   v.Get("host"),
+		App:    v.Get("app"),
+		Method: v.Get("http_method"),
+		Limit:  min(queryInt(r, "n", store.DefaultPageSize), maxPageSize),
+	}
+
+	var err error
+	if q.From, err = parseTimeParam(v.Get("from")); err != nil {
+		return q, fmt.Errorf("invalid from: %w", err)
+	}
+	if q.To, err = parseTimeParam(v.Get("to")); err != nil {
+		return q, fmt.Errorf("invalid to: %w", err)
+	}
+	if s := v.Get("port"); s != "" {
+		port, err := strconv.ParseUint(s, 10, 16)
+		if err != nil || port == 0 {
+			return q, fmt.Errorf("invalid port %q", s)
+		}
+		q.Port = uint16(port)
+	}
+	if s := v.Get("malicious"); s != "" {
+		if q.Malicious, err = strconv.ParseBool(s); err != nil {
+			return q, fmt.Errorf("invalid malicious %q", s)
+		}
+	}
+	if s := v.Get("closed"); s != "" {
+		if q.Closed, err = strconv.ParseBool(s); err != nil {
+			return q, fmt.Errorf("invalid closed %q", s)
+		}
+	}
+	if s := v.Get("protocol"); s != "" {
+		q.Protocol = capture.Protocol(strings.ToUpper(s))
+	}
+	if s := v.Get("cursor"); s != "" {
+		c, err := strconv.Atoi(s)
+		if err != nil || c <= 0 {
+			return q, fmt.Errorf("invalid cursor %q", s)
+		}
+		q.Cursor = c
+	}
+	switch v.Get("order") {
+	case "", "desc":
+	case "asc":
+		q.Ascending = true
+	default:
+		return q, fmt.Errorf("order must be asc or desc")
+	}
+	return q, nil
+}
+
+// writePage writes a page as a JSON array, keeping the lists' original
+// shape, with the cursor of the next page in X-Next-Cursor.
+func writePage[T any](w http.ResponseWriter, page store.Page[T]) {
+	if page.Next != 0 {
+		w.Header().Set("X-Next-Cursor", strconv.Itoa(page.Next))
+	}
+	items := page.Items
+	if items == nil {
+		items = []T{}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// withSelector limits q to the devices chosen by the group and tag
+// parameters and to the caller's team. It reports false when they choose no
+// device at all.
+func (a *App) withSelector(r *http.Request, q *store.Filter) bool {
+	sel := a.selectorFromQuery(r)
+	if sel.IsZero() {
+		return true
+	}
+	if sel.byLabel() {
+		q.Serials = a.labels.Select(sel.Group, sel.Tag)
+	} else {
+		q.Serials = a.teams.Devices(sel.Team)
+	}
+	if sel.Team != "" {
+		q.Serials = slices.DeleteFunc(q.Serials, func(s string) bool { return !a.teams.Owns(sel.Team, s) })
+	}
+	return len(q.Serials) > 0
+}
+
+func (a *App) handleGetRecentPackets(w http.ResponseWriter, r *http.Request) {
+	a.servePackets(w, r, "")
+}
+
+func (a *App) handleGetDevicePackets(w http.ResponseWriter, r *http.Request) {
+	a.servePackets(w, r, r.PathValue("serial"))
+}
+
+func (a *App) handleGetRecentConnections(w http.ResponseWriter, r *http.Request) {
+	a.serveConnections(w, r, "")
+}
+
+func (a *App) handleGetDeviceConnections(w http.ResponseWriter, r *http.Request) {
+	a.serveConnections(w, r, r.PathValue("serial"))
+}
+
+func (a *App) servePackets(w http.ResponseWriter, r *http.Request, serial string) {
+	q, err := parseStoreQuery(r, serial)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !a.withSelector(r, &q.Filter) {
+		writeJSON(w, http.StatusOK, []any{})
+		return
+	}
+	writePage(w, a.store.QueryPackets(q))
+}
+
+func (a *App) serveConnections(w http.ResponseWriter, r *http.Request, serial string) {
+	q, err := parseStoreQuery(r, serial)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !a.withSelector(r, &q.Filter) {
+		writeJSON(w, http.StatusOK, []any{})
+		return
+	}
+	writePage(w, a.store.QueryConnections(q))
+}
+
+func (a *App) handleSearch(w http.ResponseWriter, r *http.Request) {
+	v := r.URL.Query()
+	q := store.Search{
+		Filter: store.Filter{Serial: v.Get("serial")},
+		Text:   v.Get("q"),
+		Limit:  min(queryInt(r, "n", store.DefaultPageSize), maxPageSize),
+	}
+	if strings.TrimSpace(q.Text) == "" {
+		writeError(w, http.StatusBadRequest, "missing q")
+		return
+	}
+	var err error
+	if q.From, err = parseTimeParam(v.Get("from")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	if q.To, err = parseTimeParam(v.Get("to")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+	res := store.SearchResult{Packets: []capture.NetworkPacket{}, Connections: []capture.Connection{}}
+	if a.withSelector(r, &q.Filter) {
+		found := a.store.Search(q)
+		if found.Packets != nil {
+			res.Packets = found.Packets
+		}
+		if found.Connections != nil {
+			res.Connections = found.Connections
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,32 @@
+package bridge
+
+import "net/http"
+
+// mutating wraps a handler that changes server or device state. In read-only
+// mode the wrapped handler is never reached and the client gets 403, so the
+// dashboard can be put on a shared screen without exposing controls.
+func (a *App) mutating(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.readOnly {
+			writeErrorCode(w, http.StatusForbidden, codeReadOnly, "server is running in read-only mode")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// ReadOnly reports whether mutating endpoints are disabled.
+func (a *App) ReadOnly() bool {
+	return a.readOnly
+}
+
+// serverMode is the response of GET /api/server/mode.
+type serverMode struct {
+	ReadOnly bool `json:"read_only"`
+	// Team is the team of the caller's token, if it is a team's.
+	Team string `json:"team,omitempty"`
+}
+
+func (a *App) handleGetServerMode(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, serverMode{ReadOnly: a.readOnly, Team: a.teamOf(r)})
+}
@@ -0,0 +1,48 @@
+package bridge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/imcanugur/go-adb-monitor/internal/anomaly"
+	"github.com/imcanugur/go-adb-monitor/internal/intel"
+	"github.com/imcanugur/go-adb-monitor/internal/report"
+)
+
+var pathWildcard = regexp.MustCompile(`\{[^}]+\}`)
+
+func TestReadOnlyRefusesMutatingRoutes(t *testing.T) {
+	// The optional subsystems are set so that their routes are listed too;
+	// none of the handlers is reached.
+	a := &App{
+		readOnly:       true,
+		graphqlEnabled: true,
+		anomalies:      &anomaly.Detector{},
+		reports:        &report.Reporter{},
+		threats:        &intel.Matcher{},
+	}
+	mux := http.NewServeMux()
+	a.RegisterRoutes(mux)
+
+	n := 0
+	for _, rt := range a.routes() {
+		if !rt.mutating {
+			continue
+		}
+		n++
+		r := httptest.NewRequest(rt.method, pathWildcard.ReplaceAllString(rt.path, "x"), nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		var body apiError
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if w.Code != http.StatusForbidden || body.Code != codeReadOnly {
+			t.Errorf("%s %s: status %d code %q, want 403 %q", rt.method, rt.path, w.Code, body.Code, codeReadOnly)
+		}
+	}
+	if n == 0 {
+		t.Fatal("no mutating routes")
+	}
+}
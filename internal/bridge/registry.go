@@ -0,0 +1,97 @@
+package bridge
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+	"github.com/imcanugur/go-adb-monitor/internal/registry"
+)
+
+// identifyTimeout bounds reading a network device's hardware serial.
+const identifyTimeout = 10 * time.Second
+
+// hardwareSerialProps are read, in order, for a network device's hardware
+// serial; some builds only set the boot one.
+var hardwareSerialProps = []string{"ro.serialno", "ro.boot.serialno"}
+
+// recordIdentity keeps the device registry up to date: a device coming
+// online starts a session, going away ends it. A network device is then
+// identified by its hardware serial.
+func (a *App) recordIdentity(e event.Event) {
+	var err error
+	switch {
+	case e.Type == event.DeviceDisconnected,
+		e.Type == event.DeviceStateChanged && !e.NewState.IsOnline():
+		err = a.registry.Disconnected(e.Serial, e.Timestamp)
+
+	case e.Type == event.DeviceConnected || e.Type == event.DeviceStateChanged:
+		if !e.NewState.IsOnline() || e.Device == nil {
+			return
+		}
+		_, err = a.registry.Connected(e.Serial, e.Device.Model, e.Timestamp)
+		if e.Device.IsNetwork() {
+			go a.identifyDevice(e.Serial)
+		}
+	}
+	if err != nil {
+		a.log.Warn("failed to save device registry", "serial", e.Serial, "error", err)
+	}
+}
+
+// identifyDevice reads the hardware serial of a network device, so its
+// history continues across addresses.
+func (a *App) identifyDevice(serial string) {
+	ctx, cancel := context.WithTimeout(a.ctx, identifyTimeout)
+	defer cancel()
+
+	var hw string
+	for _, prop := range hardwareSerialProps {
+		v, err := a.client.GetDeviceProp(ctx, serial, prop)
+		if err != nil {
+			a.log.Debug("hardware serial unavailable", "serial", serial, "error", err)
+			return
+		}
+		if v != "" && v != "unknown" {
+			hw = v
+			break
+		}
+	}
+	if hw == "" {
+		return
+	}
+	d, err := a.registry.Identify(serial, hw)
+	if err != nil {
+		a.log.Warn("failed to record hardware serial", "serial", serial, "error", err)
+		return
+	}
+	a.log.Debug("network device identified", "serial", serial, "id", d.ID, "connects", d.Connects)
+}
+
+// ============================================
+// HTTP Handlers
+// ============================================
+
+// handleListRegistry lists every device ever seen, most recently seen
+// first; a team sees the devices it owns under any of their serials.
+func (a *App) handleListRegistry(w http.ResponseWriter, r *http.Request) {
+	all := a.registry.All()
+	if team := a.teamOf(r); team != "" {
+		all = slices.DeleteFunc(all, func(d registry.Device) bool {
+			return !slices.ContainsFunc(d.Serials, func(s string) bool { return a.teams.Owns(team, s) })
+		})
+	}
+	writeJSON(w, http.StatusOK, all)
+}
+
+func (a *App) handleGetIdentity(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	d, ok := a.registry.Get(serial)
+	if !ok {
+		writeErrorCode(w, http.StatusNotFound, codeDeviceNotFound, "device "+serial+" was never seen")
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
@@ -0,0 +1,81 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/imcanugur/go-adb-monitor/internal/report"
+)
+
+// ============================================
+// HTTP Handlers
+// ============================================
+
+func (a *App) handleListReports(w http.ResponseWriter, r *http.Request) {
+	infos, err := a.reports.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := infos[:0]
+	period := r.URL.Query().Get("period")
+	for _, info := range infos {
+		if period == "" || string(info.Period) == period {
+			out = append(out, info)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (a *App) handleGetReport(w http.ResponseWriter, r *http.Request) {
+	rep, err := a.reports.Get(r.PathValue("id"))
+	switch {
+	case errors.Is(err, report.ErrNotFound):
+		writeError(w, http.StatusNotFound, "report not found")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeReport(w, r, rep)
+}
+
+func (a *App) handleGenerateReport(w http.ResponseWriter, r *http.Request) {
+	period := report.Daily
+	if s := r.URL.Query().Get("period"); s != "" {
+		p, err := report.ParsePeriod(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		period = p
+	}
+	rep, err := a.reports.Generate(period)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeReport(w, r, rep)
+}
+
+// writeReport writes rep as JSON, or as an HTML page with ?format=html;
+// ?download=1 makes it an attachment.
+func writeReport(w http.ResponseWriter, r *http.Request, rep *report.Report) {
+	html := r.URL.Query().Get("format") == "html"
+	if r.URL.Query().Get("download") == "1" {
+		ext := ".json"
+		if html {
+			ext = ".html"
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", rep.ID+ext))
+	}
+	if !html {
+		writeJSON(w, http.StatusOK, rep)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Past the first byte the status is sent; a failure can only cut the
+	// page short.
+	rep.WriteHTML(w)
+}
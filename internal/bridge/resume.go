@@ -0,0 +1,135 @@
+package bridge
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// resumeWindow bounds how long an interrupted capture stays eligible for
+	// automatic resumption.
+	resumeWindow = 2 * time.Minute
+
+	// resumePollInterval is how often the device list is re-read while
+	// captures are waiting for their transports to come back.
+	resumePollInterval = 2 * time.Second
+)
+
+// pendingResume is a capture interrupted at since, waiting for its device
+// to come back online.
+type pendingResume struct {
+	since time.Time
+	spec  captureSpec
+}
+
+// handleServerRestart reacts to the tracker reporting an ADB server restart.
+// Every shell stream opened against the old server is dead, so running
+// engines are stopped and their serials queued for resumption with the
+// same settings. The device list is read afresh, and a background loop
+// re-reads it until every queued device is back online (or the resume
+// window expires).
+func (a *App) handleServerRestart() {
+	now := time.Now()
+
+	a.mu.Lock()
+	for serial, dc := range a.captures {
+		dc.cancel()
+		a.resume[serial] = pendingResume{since: now, spec: dc.spec}
+	}
+	a.captures = make(map[string]*deviceCapture)
+	pending := len(a.resume)
+	// The new server may share other features with the devices.
+	for serial := range a.devices {
+		a.forgetFeaturesLocked(serial)
+	}
+	a.mu.Unlock()
+
+	a.log.Warn("ADB server restarted, captures will resume when devices return", "pending", pending)
+	a.sse.Broadcast("adb:server_restarted", map[string]int{"pending_captures": pending})
+	go a.checkADBVersion(a.ctx) // the new server may be a different ADB
+	go a.resyncDevices()
+
+	if pending > 0 {
+		go a.resumeLoop(a.ctx)
+	}
+}
+
+// resumeLoop polls the ADB server for the device list and restarts captures
+// for queued serials that are online again.
+func (a *App) resumeLoop(ctx context.Context) {
+	ticker := time.NewTicker(resumePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		listCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		devices, err := a.client.ListDevices(listCtx)
+		cancel()
+		if err != nil {
+			a.log.Debug("resume: device list unavailable", "error", err)
+			continue
+		}
+
+		for _, d := range devices {
+			if d.State.IsOnline() {
+				a.resumeCapture(d.Serial)
+			}
+		}
+
+		if a.pruneResume() == 0 {
+			return
+		}
+	}
+}
+
+// resyncDevices replaces the device list with the new server's, dropping
+// state kept for transports that no longer exist.
+func (a *App) resyncDevices() {
+	devices, err := a.RefreshDevices()
+	if err != nil {
+		a.log.Warn("device resync after server restart failed", "error", err)
+		return
+	}
+	a.log.Info("device list resynced after server restart", "devices", len(devices))
+}
+
+// resumeCapture restarts the capture for serial if one was interrupted
+// within the resume window, with the settings it ran with. It is a no-op
+// otherwise.
+func (a *App) resumeCapture(serial string) {
+	a.mu.Lock()
+	p, ok := a.resume[serial]
+	if ok {
+		delete(a.resume, serial)
+	}
+	a.mu.Unlock()
+
+	if !ok || time.Since(p.since) > resumeWindow {
+		return
+	}
+
+	if err := a.startCapture(serial, p.spec); err != nil {
+		a.log.Warn("failed to resume capture", "serial", serial, "error", err)
+		return
+	}
+	a.log.Info("capture resumed", "serial", serial, "interrupted_for", time.Since(p.since).Round(time.Second))
+	a.sse.Broadcast("capture:started", map[string]string{"serial": serial, "reason": "resumed"})
+}
+
+// pruneResume drops expired resume entries and returns how many remain.
+func (a *App) pruneResume() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for serial, p := range a.resume {
+		if time.Since(p.since) > resumeWindow {
+			delete(a.resume, serial)
+		}
+	}
+	return len(a.resume)
+}
@@ -0,0 +1,350 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/pool"
+)
+
+// DefaultCaptureRolloutParallel is how many captures a start-all prepares
+// at once unless configured otherwise.
+const DefaultCaptureRolloutParallel = 4
+
+const (
+	// maxCaptureRolloutParallel bounds the parallel parameter.
+	maxCaptureRolloutParallel = 64
+	// maxCaptureRollouts is how many rollouts GET /api/capture/rollouts
+	// keeps, oldest finished ones dropped first.
+	maxCaptureRollouts = 20
+)
+
+// Device states within a rollout.
+const (
+	rolloutPending   = "pending"
+	rolloutPreparing = "preparing"
+	rolloutStarted   = "started"
+	// rolloutRunning is a device that was capturing already and was left
+	// alone.
+	rolloutRunning   = "running"
+	rolloutFailed    = "failed"
+	rolloutCancelled = "cancelled"
+)
+
+// rolloutDevice is the state of one device in a capture rollout. Step and
+// Hint come from the failed start check, as in CAPTURE_START_FAILED.
+type rolloutDevice struct {
+	Serial string `json:"serial"`
+	Status string `json:"status"`
+	Mode   string `json:"mode,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Step   string `json:"step,omitempty"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// captureRollout is a staged start of the captures of many devices: at
+// most Parallel of them are being prepared at a time, each through the
+// worker pool. The counters sum up Devices.
+type captureRollout struct {
+	ID         string          `json:"id"`
+	Group      string          `json:"group,omitempty"`
+	Tag        string          `json:"tag,omitempty"`
+	Parallel   int             `json:"parallel"`
+	Total      int             `json:"total"`
+	Started    int             `json:"started"`
+	Running    int             `json:"running"`
+	Failed     int             `json:"failed"`
+	Cancelled  int             `json:"cancelled"`
+	Pending    int             `json:"pending"`
+	Done       bool            `json:"done"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	Devices    []rolloutDevice `json:"devices"`
+
+	sel    deviceSelector
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// rolloutProgress is the payload of capture:rollout_progress, sent as each
+// device changes state.
+type rolloutProgress struct {
+	ID     string        `json:"id"`
+	Done   int           `json:"done"`
+	Total  int           `json:"total"`
+	Device rolloutDevice `json:"device"`
+}
+
+// StartAllCaptures begins capture on all connected online devices and
+// returns how many are capturing once the rollout is over.
+func (a *App) StartAllCaptures() int {
+	ro := a.startCaptures(deviceSelector{}, a.rolloutParallel)
+	<-ro.done
+	rep := a.rolloutReport(ro)
+	return rep.Started + rep.Running
+}
+
+// startCaptures starts a rollout over the online devices matching sel and
+// returns it; it runs on until its done channel is closed.
+func (a *App) startCaptures(sel deviceSelector, parallel int) *captureRollout {
+	ctx, cancel := context.WithCancel(a.ctx)
+	ro := &captureRollout{
+		ID:        "rollout-" + strconv.FormatUint(a.rolloutSeq.Add(1), 10),
+		Group:     sel.Group,
+		Tag:       sel.Tag,
+		Parallel:  parallel,
+		StartedAt: time.Now(),
+		sel:       sel,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+
+	a.mu.Lock()
+	for serial, dev := range a.devices {
+		if dev.State.IsOnline() && a.selects(sel, serial) {
+			ro.Devices = append(ro.Devices, rolloutDevice{Serial: serial, Status: rolloutPending})
+		}
+	}
+	slices.SortFunc(ro.Devices, func(x, y rolloutDevice) int {
+		return strings.Compare(x.Serial, y.Serial)
+	})
+	a.rollouts = append(a.rollouts, ro)
+	a.pruneRolloutsLocked()
+	a.mu.Unlock()
+
+	a.log.Info("capture rollout started", "id", ro.ID, "devices", len(ro.Devices), "parallel", parallel)
+	a.sse.Broadcast("capture:rollout_started", a.rolloutReport(ro))
+	go a.runRollout(ctx, ro)
+	return ro
+}
+
+// runRollout prepares and starts the captures of ro, Parallel at a time.
+// Devices not reached when ro is cancelled end up cancelled.
+func (a *App) runRollout(ctx context.Context, ro *captureRollout) {
+	defer func() {
+		ro.cancel()
+		a.mu.Lock()
+		now := time.Now()
+		ro.FinishedAt = &now
+		ro.Done = true
+		a.mu.Unlock()
+		close(ro.done)
+
+		rep := a.rolloutReport(ro)
+		a.log.Info("capture rollout finished", "id", ro.ID, "started", rep.Started,
+			"running", rep.Running, "failed", rep.Failed, "cancelled", rep.Cancelled)
+		a.sse.Broadcast("capture:rollout_completed", rep)
+	}()
+
+	slots := make(chan struct{}, ro.Parallel)
+	var finished sync.WaitGroup
+	for i := range ro.Devices {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			a.setRolloutDevice(ro, i, rolloutDevice{Status: rolloutCancelled})
+			continue
+		}
+		finished.Add(1)
+		go func() {
+			defer finished.Done()
+			defer func() { <-slots }()
+			a.setRolloutDevice(ro, i, a.rollOne(ctx, ro, i))
+		}()
+	}
+	finished.Wait()
+}
+
+// rollOne prepares the capture of the i-th device of ro in a pool task
+// and starts it once its checks pass.
+func (a *App) rollOne(ctx context.Context, ro *captureRollout, i int) rolloutDevice {
+	a.mu.Lock()
+	serial := ro.Devices[i].Serial
+	a.mu.Unlock()
+
+	spec := captureSpec{mode: capture.ModeAuto, buffer: a.captureBuffer, sampling: a.captureSampling}
+	engine := a.newCaptureEngine(serial, spec)
+	if engine == nil {
+		return rolloutDevice{Status: rolloutRunning}
+	}
+	a.setRolloutDevice(ro, i, rolloutDevice{Status: rolloutPreparing})
+
+	// The checks run in a task of their own, which gives its worker back
+	// before the capture takes one: with a per-device cap of one, the
+	// capture could otherwise never start.
+	prepared := make(chan error, 1)
+	err := a.pool.Submit(ctx, pool.Task{
+		Name:     "capture-prepare:" + serial,
+		Serial:   serial,
+		Priority: pool.PriorityHigh,
+		Fn: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, captureWarmupTimeout)
+			defer cancel()
+			err := engine.Prepare(ctx)
+			prepared <- err
+			return err
+		},
+	})
+	if err == nil {
+		err = <-prepared
+	}
+	if err == nil {
+		// Cancelled while preparing: leave the device alone.
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = a.runCapture(serial, spec, engine)
+	}
+
+	switch {
+	case err == nil:
+		return rolloutDevice{Status: rolloutStarted, Mode: engine.Mode().String()}
+	case ctx.Err() != nil:
+		return rolloutDevice{Status: rolloutCancelled}
+	}
+	a.log.Warn("capture rollout: device failed", "id", ro.ID, "serial", serial, "error", err)
+	res := rolloutDevice{Status: rolloutFailed, Error: err.Error()}
+	var startErr *capture.StartError
+	if errors.As(err, &startErr) {
+		res.Step, res.Hint = startErr.Step, startErr.Hint
+	}
+	return res
+}
+
+// setRolloutDevice records the new state of the i-th device of ro and
+// reports it over SSE.
+func (a *App) setRolloutDevice(ro *captureRollout, i int, d rolloutDevice) {
+	a.mu.Lock()
+	d.Serial = ro.Devices[i].Serial
+	ro.Devices[i] = d
+	done := 0
+	for _, dev := range ro.Devices {
+		if dev.Status != rolloutPending && dev.Status != rolloutPreparing {
+			done++
+		}
+	}
+	a.mu.Unlock()
+	a.sse.Broadcast("capture:rollout_progress", rolloutProgress{ID: ro.ID, Done: done, Total: len(ro.Devices), Device: d})
+}
+
+// rolloutReport returns a copy of ro with its counters filled in.
+func (a *App) rolloutReport(ro *captureRollout) captureRollout {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	rep := captureRollout{
+		ID: ro.ID, Group: ro.Group, Tag: ro.Tag, Parallel: ro.Parallel,
+		Total: len(ro.Devices), Done: ro.Done, StartedAt: ro.StartedAt, FinishedAt: ro.FinishedAt,
+		Devices: slices.Clone(ro.Devices),
+	}
+	if rep.Devices == nil {
+		rep.Devices = []rolloutDevice{}
+	}
+	for _, d := range ro.Devices {
+		switch d.Status {
+		case rolloutStarted:
+			rep.Started++
+		case rolloutRunning:
+			rep.Running++
+		case rolloutFailed:
+			rep.Failed++
+		case rolloutCancelled:
+			rep.Cancelled++
+		default:
+			rep.Pending++
+		}
+	}
+	return rep
+}
+
+// pruneRolloutsLocked drops the oldest finished rollouts beyond
+// maxCaptureRollouts.
+func (a *App) pruneRolloutsLocked() {
+	for n := len(a.rollouts) - maxCaptureRollouts; n > 0; n-- {
+		i := slices.IndexFunc(a.rollouts, func(ro *captureRollout) bool { return ro.Done })
+		if i < 0 {
+			return
+		}
+		a.rollouts = slices.Delete(a.rollouts, i, i+1)
+	}
+}
+
+// cancelRollouts cancels the unfinished rollouts started with sel, or all
+// of them for the zero selector, so a stop is not undone by devices they
+// have yet to reach.
+func (a *App) cancelRollouts(sel deviceSelector) {
+	a.mu.Lock()
+	for _, ro := range a.rollouts {
+		if !ro.Done && (sel.IsZero() || ro.sel == sel) {
+			ro.cancel()
+		}
+	}
+	a.mu.Unlock()
+}
+
+func (a *App) handleStartAllCaptures(w http.ResponseWriter, r *http.Request) {
+	parallel := a.rolloutParallel
+	if v := r.URL.Query().Get("parallel"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxCaptureRolloutParallel {
+			writeError(w, http.StatusBadRequest, "parallel must be between 1 and "+strconv.Itoa(maxCaptureRolloutParallel))
+			return
+		}
+		parallel = n
+	}
+	ro := a.startCaptures(a.selectorFromQuery(r), parallel)
+	if r.URL.Query().Get("wait") != "true" {
+		writeJSON(w, http.StatusAccepted, a.rolloutReport(ro))
+		return
+	}
+	select {
+	case <-ro.done:
+	case <-r.Context().Done():
+		return
+	}
+	writeJSON(w, http.StatusOK, a.rolloutReport(ro))
+}
+
+// visibleRollout reports whether the caller's team may see ro: team tokens
+// see the rollouts they started.
+func (a *App) visibleRollout(r *http.Request, ro *captureRollout) bool {
+	return ro.sel.Team == a.teamOf(r) || a.teamOf(r) == ""
+}
+
+func (a *App) handleListRollouts(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	rollouts := slices.Clone(a.rollouts)
+	a.mu.Unlock()
+
+	out := []captureRollout{}
+	for i := len(rollouts) - 1; i >= 0; i-- {
+		if ro := rollouts[i]; a.visibleRollout(r, ro) {
+			out = append(out, a.rolloutReport(ro))
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (a *App) handleGetRollout(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	a.mu.Lock()
+	i := slices.IndexFunc(a.rollouts, func(ro *captureRollout) bool { return ro.ID == id })
+	var ro *captureRollout
+	if i >= 0 {
+		ro = a.rollouts[i]
+	}
+	a.mu.Unlock()
+	if ro == nil || !a.visibleRollout(r, ro) {
+		writeErrorCode(w, http.StatusNotFound, codeNotFound, "rollout not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, a.rolloutReport(ro))
+}
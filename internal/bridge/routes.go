@@ -0,0 +1,404 @@
+package bridge
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adbbin"
+	"github.com/imcanugur/go-adb-monitor/internal/anomaly"
+	"github.com/imcanugur/go-adb-monitor/internal/audit"
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/correlate"
+	"github.com/imcanugur/go-adb-monitor/internal/downloads"
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+	"github.com/imcanugur/go-adb-monitor/internal/graphql"
+	"github.com/imcanugur/go-adb-monitor/internal/health"
+	"github.com/imcanugur/go-adb-monitor/internal/intel"
+	"github.com/imcanugur/go-adb-monitor/internal/inventory"
+	"github.com/imcanugur/go-adb-monitor/internal/labels"
+	"github.com/imcanugur/go-adb-monitor/internal/linkstat"
+	"github.com/imcanugur/go-adb-monitor/internal/monitor"
+	"github.com/imcanugur/go-adb-monitor/internal/notify"
+	"github.com/imcanugur/go-adb-monitor/internal/pool"
+	"github.com/imcanugur/go-adb-monitor/internal/registry"
+	"github.com/imcanugur/go-adb-monitor/internal/report"
+	"github.com/imcanugur/go-adb-monitor/internal/schedule"
+	"github.com/imcanugur/go-adb-monitor/internal/store"
+	"github.com/imcanugur/go-adb-monitor/internal/timeseries"
+)
+
+// route is one API endpoint together with the metadata /api/openapi.json is
+// generated from. Path parameters are taken from the pattern.
+type route struct {
+	method, path string
+	handler      http.HandlerFunc
+	// mutating routes are refused with 403 in read-only mode.
+	mutating bool
+	// admin routes control the device itself or run arbitrary commands on
+	// it, and also need the admin token.
+	admin bool
+	// teams routes without a {serial} are open to team tokens; their
+	// handlers limit what they return and change to the team's devices.
+	// Routes with a {serial} are open to a team for its own devices.
+	teams bool
+
+	summary string
+	params  []param
+	// body and resp are zero values of the request and success response
+	// bodies; only their types are used.
+	body any
+	resp any
+	// status is the success status, 200 if zero.
+	status int
+	// content is the response media type when it is not JSON.
+	content string
+	// paged routes return X-Next-Cursor.
+	paged bool
+}
+
+// param is a query parameter.
+type param struct {
+	name string
+	typ  string // OpenAPI primitive type; "string" if empty
+	enum []string
+	desc string
+}
+
+var timeRangeParams = []param{
+	{name: "from", desc: "Start of the time range, RFC 3339 or Unix seconds"},
+	{name: "to", desc: "End of the time range, RFC 3339 or Unix seconds"},
+}
+
+// storeQueryParams are read by parseStoreQuery.
+var storeQueryParams = append([]param{
+	{name: "n", typ: "integer", desc: "Page size (default 200, max 5000)"},
+	{name: "cursor", typ: "integer", desc: "X-Next-Cursor of the previous page"},
+	{name: "order", enum: []string{"desc", "asc"}, desc: "Newest (default) or oldest first"},
+	{name: "dst_ip", desc: "Destination or remote IP"},
+	{name: "host", desc: "HTTP host or resolved hostname, case-insensitive"},
+	{name: "port", typ: "integer", desc: "Either port of a packet, or a connection's remote port"},
+	{name: "protocol", enum: []string{"TCP", "UDP", "QUIC"}},
+	{name: "app", desc: "App package name (connections only)"},
+	{name: "http_method", desc: "HTTP method (packets only)"},
+	{name: "malicious", typ: "boolean", desc: "Only entries flagged by a threat feed"},
+	{name: "closed", typ: "boolean", desc: "Only connections that have closed, with closed_at and duration_ms (connections only)"},
+}, timeRangeParams...)
+
+var serialParam = param{name: "serial", desc: "Limit to one device"}
+
+// selectorParams choose devices by their labels.
+var selectorParams = []param{
+	{name: "group", desc: "Limit to devices in this group"},
+	{name: "tag", desc: "Limit to devices with this tag"},
+}
+
+var packageParams = []param{
+	{name: "q", desc: "Package name substring"},
+	{name: "system", typ: "boolean", desc: "Only system (true) or only user-installed (false) packages"},
+}
+
+// routes lists every API endpoint served by the app.
+func (a *App) routes() []route {
+	rs := []route{
+		{method: "GET", path: "/api/server/mode", handler: a.handleGetServerMode, teams: true,
+			summary: "Server mode", resp: serverMode{}},
+		{method: "GET", path: "/api/ui-config", handler: a.handleGetUIConfig, teams: true,
+			summary: "Settings the dashboard needs before its first request; served without a token", resp: uiConfig{}},
+		{method: "GET", path: "/api/devices", handler: a.handleGetDevices, teams: true,
+			summary: "List connected devices with their labels and latest health", params: selectorParams,
+			resp: []deviceStatus{}},
+		{method: "POST", path: "/api/devices/refresh", handler: a.handleRefreshDevices, mutating: true,
+			summary: "Re-scan devices", resp: []deviceStatus{}},
+		{method: "GET", path: "/api/devices/discovered", handler: a.handleGetDiscovered,
+			summary: "Wireless devices discovered over mDNS that are not connected", resp: []discoveredDevice{}},
+		{method: "POST", path: "/api/devices/connect", handler: a.handleConnect, mutating: true, admin: true,
+			summary: "Connect to a wireless device with adb connect (admin token)", body: connectRequest{}, resp: connectResult{}},
+		{method: "POST", path: "/api/devices/exec", handler: a.handleBulkExec, teams: true, mutating: true, admin: true,
+			summary: "Run a shell command on many devices (admin token)", body: execRequest{}, resp: execResponse{}},
+		{method: "GET", path: "/api/devices/{serial}/label", handler: a.handleGetLabel,
+			summary: "Name, group and tags of a device", resp: labels.Label{}},
+		{method: "PUT", path: "/api/devices/{serial}/label", handler: a.handleSetLabel, mutating: true,
+			summary: "Set the name, group and tags of a device", body: labelRequest{}, resp: labels.Label{}},
+		{method: "DELETE", path: "/api/devices/{serial}/label", handler: a.handleDeleteLabel, mutating: true,
+			summary: "Remove the label of a device", resp: map[string]string{}},
+		{method: "GET", path: "/api/labels", handler: a.handleListLabels, teams: true,
+			summary: "Labels of all devices", resp: []labels.Label{}},
+		{method: "GET", path: "/api/groups", handler: a.handleListGroups, teams: true,
+			summary: "Device groups and their members", resp: []labels.Group{}},
+		{method: "GET", path: "/api/devices/{serial}/identity", handler: a.handleGetIdentity,
+			summary: "First seen, reconnects and uptime of a device across reconnects and restarts", resp: registry.Device{}},
+		{method: "GET", path: "/api/registry", handler: a.handleListRegistry, teams: true,
+			summary: "Every device ever seen, most recently seen first", resp: []registry.Device{}},
+		{method: "GET", path: "/api/devices/{serial}/shell", handler: a.handleDeviceShell, mutating: true, admin: true,
+			summary: "Interactive shell over WebSocket (admin token)", status: http.StatusSwitchingProtocols,
+			params: []param{{name: "rows", typ: "integer"}, {name: "cols", typ: "integer"}}},
+		{method: "GET", path: "/api/devices/{serial}/packages", handler: a.handleGetPackages,
+			summary: "Installed packages with versions, install times and installer", resp: inventory.Inventory{},
+			params: packageParams},
+		{method: "POST", path: "/api/devices/{serial}/packages/refresh", handler: a.handleRefreshPackages, mutating: true,
+			summary: "Re-read installed packages now", resp: inventory.Inventory{}, params: packageParams},
+		{method: "GET", path: "/api/devices/{serial}/permissions/audit", handler: a.handlePermissionAudit,
+			summary: "Audit the permissions and cleartext settings of apps against their traffic", resp: permissionAudit{},
+			params: append([]param{{name: "app", desc: "Audit this app, by package name, instead of the apps with traffic"}}, timeRangeParams...)},
+		{method: "GET", path: "/api/devices/{serial}/health", handler: a.handleGetDeviceHealth,
+			summary: "Latest health score, status and reasons", resp: health.Result{}},
+		{method: "GET", path: "/api/devices/{serial}/link", handler: a.handleGetDeviceLink,
+			summary: "USB or TCP link and ADB round-trip latency, jitter and failed probes", resp: linkstat.Stats{}},
+		{method: "GET", path: "/api/devices/{serial}/props", handler: a.handleGetDeviceProps,
+			summary: "Latest collected system properties, dumpsys values and probe results", resp: map[string]string{},
+			params: []param{{name: "all", typ: "boolean", desc: "Every getprop key of the device instead, published or not"}}},
+		{method: "GET", path: "/api/monitor/props", handler: a.handleGetMonitorProps,
+			summary: "Properties, dumpsys sections and shell probes collected from every device", resp: monitorProps{}},
+		{method: "PUT", path: "/api/monitor/props", handler: a.handleSetMonitorProps, mutating: true, admin: true,
+			summary: "Replace the collected property set (admin token)", body: monitor.PropSet{}, resp: monitorProps{}},
+		{method: "GET", path: "/api/devices/{serial}/battery/history", handler: a.handleGetBatteryHistory,
+			summary: "Battery samples, charge-cycle counters and the drain of a running capture", params: timeRangeParams, resp: batteryHistory{}},
+		{method: "POST", path: "/api/devices/{serial}/reboot", handler: a.handleReboot, mutating: true, admin: true,
+			summary: "Reboot the device (admin token)", resp: controlResult{},
+			params: []param{{name: "target", desc: "What to reboot into", enum: []string{"normal", "bootloader", "recovery"}}}},
+		{method: "POST", path: "/api/devices/{serial}/root", handler: a.handleADBDControl("root", a.client.Root),
+			mutating: true, admin: true, summary: "Restart adbd as root (admin token)", resp: controlResult{}},
+		{method: "POST", path: "/api/devices/{serial}/unroot", handler: a.handleADBDControl("unroot", a.client.Unroot),
+			mutating: true, admin: true, summary: "Restart adbd as the shell user (admin token)", resp: controlResult{}},
+		{method: "POST", path: "/api/devices/{serial}/remount", handler: a.handleADBDControl("remount", a.client.Remount),
+			mutating: true, admin: true, summary: "Remount system partitions read-write (admin token)", resp: controlResult{}},
+		{method: "POST", path: "/api/devices/{serial}/input", handler: a.handleDeviceInput, mutating: true, admin: true,
+			summary: "Inject a sequence of taps, swipes, text and key events (admin token)", body: inputRequest{}, resp: inputResult{}},
+		{method: "POST", path: "/api/devices/{serial}/screenrecord/start", handler: a.handleStartScreenRecord, mutating: true, admin: true,
+			summary: "Start recording the screen (admin token)", resp: screenRecording{},
+			params: []param{{name: "time_limit", typ: "integer", desc: "Stop after this many seconds (1-180, default 180)"}}},
+		{method: "POST", path: "/api/devices/{serial}/screenrecord/stop", handler: a.handleStopScreenRecord, mutating: true, admin: true,
+			summary: "Stop recording the screen and store the MP4 in the downloads (admin token)", resp: screenRecordResult{}},
+		{method: "GET", path: "/api/devices/{serial}/metrics", handler: a.handleGetDeviceMetrics,
+			summary: "History of a device metric, optionally downsampled for charting", resp: timeseries.Series{},
+			params: slices.Concat([]param{
+				{name: "metric", desc: "Metric name", enum: []string{metricHealthScore, metricShellLatency, metricErrorRate,
+					metricBatteryLevel, metricBatteryTemp, metricCapturePackets, metricCaptureErrors,
+					metricWifiRSSI, metricWifiLinkSpeed}},
+			}, timeRangeParams, []param{
+				{name: "step", desc: "Bucket width to downsample into (Go duration, e.g. 5m)"},
+				{name: "points", typ: "integer", desc: "Downsample to about this many buckets when step is not given"},
+			})},
+		{method: "GET", path: "/api/devices/{serial}/foreground", handler: a.handleGetForegroundHistory,
+			summary: "Foreground app history with the traffic seen during each app", params: timeRangeParams,
+			resp: []store.ForegroundUsage{}},
+		{method: "GET", path: "/api/adb/version", handler: a.handleGetADBVersion,
+			summary: "ADB server version", resp: map[string]string{}},
+		{method: "GET", path: "/api/adb/publickey", handler: a.handleGetADBPublicKey,
+			summary: "The host's ADB public key and the fingerprint devices show when asking for authorization",
+			resp:    adbbin.PublicKey{}},
+		{method: "GET", path: "/api/adb/info", handler: a.handleGetADBInfo,
+			summary: "ADB binary and server versions, minimum supported version and feature support", resp: adbInfo{}},
+		{method: "POST", path: "/api/capture/start-all", handler: a.handleStartAllCaptures, teams: true, mutating: true,
+			summary: "Start capture on all online devices, a few at a time through the worker pool",
+			params: slices.Concat(selectorParams, []param{
+				{name: "parallel", typ: "integer", desc: "Captures prepared at once (default -capture-rollout-parallel, max 64)"},
+				{name: "wait", typ: "boolean", desc: "Answer once every device has started or failed"},
+			}),
+			resp: captureRollout{}, status: http.StatusAccepted},
+		{method: "GET", path: "/api/capture/rollouts", handler: a.handleListRollouts, teams: true,
+			summary: "Recent start-all rollouts with per-device progress, newest first", resp: []captureRollout{}},
+		{method: "GET", path: "/api/capture/rollouts/{id}", handler: a.handleGetRollout, teams: true,
+			summary: "One start-all rollout", resp: captureRollout{}},
+		{method: "POST", path: "/api/capture/stop-all", handler: a.handleStopAllCaptures, teams: true, mutating: true,
+			summary: "Stop all captures", params: selectorParams, resp: map[string]string{}},
+		{method: "GET", path: "/api/capture/schedules", handler: a.handleListSchedules,
+			summary: "Capture schedules with their current state", resp: []schedule.Status{}},
+		{method: "POST", path: "/api/capture/schedules", handler: a.handleCreateSchedule, mutating: true,
+			summary: "Add a recurring or one-off capture schedule", body: schedule.Schedule{}, resp: schedule.Status{},
+			status: http.StatusCreated},
+		{method: "GET", path: "/api/capture/schedules/{id}", handler: a.handleGetSchedule,
+			summary: "A capture schedule with its current state", resp: schedule.Status{}},
+		{method: "PUT", path: "/api/capture/schedules/{id}", handler: a.handleUpdateSchedule, mutating: true,
+			summary: "Replace a capture schedule", body: schedule.Schedule{}, resp: schedule.Status{}},
+		{method: "DELETE", path: "/api/capture/schedules/{id}", handler: a.handleDeleteSchedule, mutating: true,
+			summary: "Remove a capture schedule", resp: map[string]string{}},
+		{method: "POST", path: "/api/capture/start/{serial}", handler: a.handleStartCapture, mutating: true,
+			summary: "Check that a device can capture, then start capturing on it", resp: captureStarted{},
+			params: []param{
+				{name: "mode", enum: []string{"auto", "tcpdump", "procnet", "ss", "vpn", "emulator", "iptables"}},
+				{name: "buffer", typ: "integer", desc: "Length of each output channel of the capture"},
+				{name: "drop", desc: "What to do when a channel is full", enum: []string{"drop-newest", "drop-oldest", "block"}},
+				{name: "sample", typ: "integer", desc: "Keep one packet in this many"},
+				{name: "max_pps", typ: "integer", desc: "Packets kept per second at most (0 = no cap)"},
+				{name: "max_bps", typ: "integer", desc: "Bytes of packets kept per second at most (0 = no cap)"},
+				{name: "app", desc: "Capture only this app's traffic, by package name"},
+			}},
+		{method: "POST", path: "/api/capture/stop/{serial}", handler: a.handleStopCapture, mutating: true,
+			summary: "Stop capture on a device", resp: map[string]string{}},
+		{method: "GET", path: "/api/capture/status", handler: a.handleGetCaptureStatus, teams: true,
+			summary: "Capture statistics per device", resp: map[string]capture.CaptureStats{}},
+		{method: "GET", path: "/api/packets/{serial}", handler: a.handleGetDevicePackets,
+			summary: "Packets of a device", params: storeQueryParams, resp: []capture.NetworkPacket{}, paged: true},
+		{method: "GET", path: "/api/packets", handler: a.handleGetRecentPackets, teams: true,
+			summary: "Packets of all devices", params: slices.Concat([]param{serialParam}, selectorParams, storeQueryParams),
+			resp: []capture.NetworkPacket{}, paged: true},
+		{method: "GET", path: "/api/connections/{serial}", handler: a.handleGetDeviceConnections,
+			summary: "Connections of a device", params: storeQueryParams, resp: []capture.Connection{}, paged: true},
+		{method: "GET", path: "/api/connections/{serial}/apps", handler: a.handleGetAppTraffic,
+			summary: "Per-app and per-interface traffic of a running capture", resp: capture.TrafficSnapshot{}},
+		{method: "GET", path: "/api/connections", handler: a.handleGetRecentConnections, teams: true,
+			summary: "Connections of all devices", params: slices.Concat([]param{serialParam}, selectorParams, storeQueryParams),
+			resp: []capture.Connection{}, paged: true},
+		{method: "GET", path: "/api/search", handler: a.handleSearch, teams: true,
+			summary: "Packets and connections whose host, path, raw line or app contain every term, newest first",
+			resp:    store.SearchResult{},
+			params: slices.Concat([]param{
+				{name: "q", desc: "Whitespace-separated terms, each matched on word boundaries, e.g. /v2/token"},
+				serialParam,
+			}, selectorParams, []param{
+				{name: "n", typ: "integer", desc: "Maximum number of packets and of connections (default 200, max 5000)"},
+			}, timeRangeParams)},
+		{method: "GET", path: "/api/flows", handler: a.handleListFlows, teams: true,
+			summary: "Flows merged from connections, captured packets and logged URLs, newest first",
+			resp:    []capture.Flow{},
+			params: slices.Concat([]param{serialParam,
+				{name: "host", desc: "Hostname or request host of the flow, case-insensitive"},
+				{name: "app", desc: "Package of the owning app"},
+				{name: "protocol", desc: "Transport protocol", enum: []string{"TCP", "UDP", "ICMP", "QUIC"}},
+				{name: "source", desc: "Only flows seen by this capture", enum: []string{"tcpdump", "vpn", "emulator", "iptables", "procnet", "ss", "logcat"}},
+				{name: "closed", typ: "boolean", desc: "Only flows that have ended"},
+				{name: "malicious", typ: "boolean", desc: "Only flows to a threat feed entry"},
+				{name: "n", typ: "integer", desc: "Maximum number of flows (default 200)"},
+			}, timeRangeParams)},
+		{method: "GET", path: "/api/dns/{serial}", handler: a.handleGetDeviceDNS,
+			summary: "Recent DNS lookups of a device", resp: []capture.DNSLookup{},
+			params: []param{{name: "n", typ: "integer", desc: "Maximum number of lookups (default 200)"}}},
+		{method: "GET", path: "/api/tls/{serial}", handler: a.handleGetDeviceTLS,
+			summary: "TLS handshakes of a device with version, cipher and leaf certificate (vpn and emulator modes)",
+			resp:    []capture.TLSSession{},
+			params: []param{
+				{name: "server", desc: "Server IP or SNI"},
+				{name: "deprecated", typ: "boolean", desc: "Only handshakes below TLS 1.2"},
+				{name: "n", typ: "integer", desc: "Maximum number of handshakes (default 200)"},
+			}},
+		{method: "GET", path: "/api/traces", handler: a.handleListTraces, teams: true,
+			summary: "Flows linking each request's logcat URL, DNS lookup and connection, newest first",
+			resp:    []correlate.Flow{},
+			params: slices.Concat([]param{serialParam,
+				{name: "host", desc: "Host of the flow, case-insensitive"},
+				{name: "complete", typ: "boolean", desc: "Only flows with a URL, a lookup and a connection"},
+				{name: "record", desc: "ID of a packet, DNS lookup or connection; returns the flow it belongs to"},
+				{name: "n", typ: "integer", desc: "Maximum number of flows (default 200)"},
+			}, timeRangeParams)},
+		{method: "GET", path: "/api/traces/{id}", handler: a.handleGetTrace, teams: true,
+			summary: "One traced flow", resp: correlate.Flow{}},
+		{method: "GET", path: "/api/export/{file}", handler: a.handleExport,
+			summary: "Stream packets.csv, packets.ndjson, connections.csv or connections.ndjson",
+			params:  append([]param{serialParam}, timeRangeParams...), content: "text/csv"},
+		{method: "GET", path: "/api/downloads", handler: a.handleListDownloads, teams: true,
+			summary: "Files pulled from devices, such as screen recordings, newest first", params: []param{serialParam},
+			resp: []downloads.Item{}},
+		{method: "GET", path: "/api/downloads/{name}", handler: a.handleGetDownload, teams: true,
+			summary: "Download a file", content: "application/octet-stream"},
+		{method: "DELETE", path: "/api/downloads/{name}", handler: a.handleDeleteDownload, mutating: true, teams: true,
+			summary: "Delete a download", resp: map[string]string{}},
+		{method: "GET", path: "/api/store/stats", handler: a.handleGetStoreStats,
+			summary: "Ring buffer statistics", resp: store.StoreStats{}},
+		{method: "POST", path: "/api/store/snapshot", handler: a.handleStoreSnapshot, mutating: true,
+			summary: "Write packets, connections, DNS lookups and TLS handshakes to the snapshot file -restore loads",
+			resp:    snapshotResult{}},
+		{method: "GET", path: "/api/stats/traffic", handler: a.handleGetTrafficStats,
+			summary: "Aggregated traffic counters", resp: store.TrafficStats{},
+			params: []param{serialParam, {name: "window", desc: "Go duration up to 24h (default 15m)"},
+				{name: "top", typ: "integer", desc: "Number of top talkers"}}},
+		{method: "GET", path: "/api/pool/stats", handler: a.handleGetPoolStats,
+			summary: "Worker pool usage, queue depth by priority and pending tasks", resp: pool.Stats{}},
+		{method: "DELETE", path: "/api/pool/pending/{id}", handler: a.handleCancelPoolTask, mutating: true,
+			summary: "Cancel a task waiting for a worker", resp: map[string]string{}},
+		{method: "GET", path: "/api/bus/stats", handler: a.handleGetBusStats,
+			summary: "Device event bus queues and drop counters", resp: event.Stats{}},
+		{method: "GET", path: "/api/metrics", handler: a.handleMetrics,
+			summary: "Prometheus metrics", content: "text/plain"},
+		{method: "POST", path: "/api/clear", handler: a.handleClearData, mutating: true,
+			summary: "Clear all stored data", resp: map[string]string{}},
+		{method: "GET", path: "/api/notifications", handler: a.handleListNotifications,
+			summary: "List webhooks", resp: []notify.Webhook{}},
+		{method: "POST", path: "/api/notifications", handler: a.handleCreateNotification, mutating: true,
+			summary: "Create a webhook", body: notify.Webhook{}, resp: notify.Webhook{}, status: http.StatusCreated},
+		{method: "GET", path: "/api/notifications/{id}", handler: a.handleGetNotification,
+			summary: "Get a webhook", resp: notify.Webhook{}},
+		{method: "PUT", path: "/api/notifications/{id}", handler: a.handleUpdateNotification, mutating: true,
+			summary: "Replace a webhook", body: notify.Webhook{}, resp: notify.Webhook{}},
+		{method: "DELETE", path: "/api/notifications/{id}", handler: a.handleDeleteNotification, mutating: true,
+			summary: "Delete a webhook", resp: map[string]string{}},
+		{method: "POST", path: "/api/notifications/{id}/test", handler: a.handleTestNotification, mutating: true,
+			summary: "Send a test notification", resp: map[string]string{}, status: http.StatusAccepted},
+		{method: "GET", path: "/api/events", handler: a.handleEvents, teams: true,
+			summary: "Server-Sent Events stream", content: "text/event-stream",
+			params: []param{
+				{name: "last_event_id", typ: "integer", desc: "Resume after this event (alternative to the Last-Event-ID header)"},
+				{name: "type", desc: "Comma-separated event types to send"},
+				{name: "serial", desc: "Comma-separated devices whose packets, connections and DNS lookups are sent"},
+				{name: "host", desc: "Send packets, connections and DNS lookups whose host contains this"},
+				{name: "port", typ: "integer", desc: "Send packets with this port and connections with this remote port"},
+				{name: "app", desc: "Send connections and packets whose app contains this"},
+			}},
+		{method: "GET", path: "/api/events/history", handler: a.handleListDeviceEvents, teams: true,
+			summary: "Device connect, disconnect, state and property events, newest first", resp: []store.DeviceEvent{},
+			params: slices.Concat([]param{serialParam,
+				{name: "type", desc: "Comma-separated event types (device_connected, device_disconnected, device_state_changed, device_properties, device_properties_changed, security_prop_changed, adb_server_restarted, adb_server_down, adb_server_up)"},
+				{name: "n", typ: "integer", desc: "Maximum number of events (default 500)"},
+			}, timeRangeParams)},
+		{method: "GET", path: "/api/audit", handler: a.handleListAudit, teams: true,
+			summary: "Commands run on devices, with duration, output size and result, newest first", resp: []audit.Entry{},
+			params: slices.Concat([]param{serialParam,
+				{name: "service", desc: "ADB service, such as shell (any shell variant), sync, reverse or root"},
+				{name: "command", desc: "Only commands containing this text"},
+				{name: "failed", typ: "boolean", desc: "Only commands that failed or exited non-zero"},
+				{name: "n", typ: "integer", desc: "Maximum number of entries (default 500)"},
+			}, timeRangeParams)},
+		{method: "GET", path: "/api/openapi.json", handler: a.handleOpenAPI, teams: true,
+			summary: "This document", resp: map[string]any{}},
+		{method: "GET", path: "/api/docs", handler: handleSwaggerUI, teams: true,
+			summary: "Swagger UI", content: "text/html"},
+	}
+
+	if a.graphqlEnabled {
+		rs = append(rs,
+			route{method: "GET", path: "/api/graphql", handler: a.handleGraphQL,
+				summary: "Run a GraphQL query, or get the schema in SDL without one", resp: graphql.Response{},
+				params: []param{{name: "query"}, {name: "operationName"}, {name: "variables", desc: "JSON object"}}},
+			route{method: "POST", path: "/api/graphql", handler: a.handleGraphQL,
+				summary: "Run a GraphQL query", body: graphql.Request{}, resp: graphql.Response{}},
+		)
+	}
+	if a.threats != nil {
+		rs = append(rs,
+			route{method: "GET", path: "/api/threats/feeds", handler: a.handleGetThreatFeeds,
+				summary: "Threat-intelligence feeds with their size and last load", resp: []intel.FeedStatus{}},
+			route{method: "POST", path: "/api/threats/feeds/refresh", handler: a.handleRefreshThreatFeeds, mutating: true,
+				summary: "Reload every threat-intelligence feed now", resp: []intel.FeedStatus{}},
+		)
+	}
+	if a.anomalies != nil {
+		rs = append(rs,
+			route{method: "GET", path: "/api/anomalies", handler: a.handleGetAnomalies,
+				summary: "Recent traffic anomalies, newest first", resp: []anomaly.Anomaly{},
+				params: []param{serialParam, {name: "n", typ: "integer", desc: "Maximum number of anomalies (default 100)"}}},
+			route{method: "GET", path: "/api/anomalies/baselines", handler: a.handleGetBaselines,
+				summary: "Learned traffic baselines per device and app", resp: []anomaly.Baseline{},
+				params: []param{serialParam}},
+			route{method: "DELETE", path: "/api/anomalies/baselines/{serial}", handler: a.handleResetBaseline, mutating: true,
+				summary: "Forget a device's baselines and learn them again", resp: map[string]string{}},
+		)
+	}
+	if a.reports != nil {
+		reportParams := []param{
+			{name: "format", enum: []string{"json", "html"}, desc: "Report format (default json)"},
+			{name: "download", enum: []string{"1"}, desc: "Send as an attachment"},
+		}
+		rs = append(rs,
+			route{method: "GET", path: "/api/reports", handler: a.handleListReports,
+				summary: "Kept traffic reports, newest first", resp: []report.Info{},
+				params: []param{{name: "period", enum: []string{"daily", "weekly"}}}},
+			route{method: "GET", path: "/api/reports/{id}", handler: a.handleGetReport,
+				summary: "A traffic report with per-device and per-app summaries", resp: report.Report{},
+				params: reportParams},
+			route{method: "POST", path: "/api/reports", handler: a.handleGenerateReport, mutating: true,
+				summary: "Generate and keep a report of the current period so far", resp: report.Report{},
+				params: append([]param{{name: "period", enum: []string{"daily", "weekly"}, desc: "Period (default daily)"}}, reportParams...)},
+		)
+	}
+	return rs
+}
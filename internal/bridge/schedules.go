@@ -0,0 +1,182 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/schedule"
+)
+
+const (
+	// scheduleInterval is how often capture schedules are re-evaluated;
+	// windows open and close within this much of their set time.
+	scheduleInterval = 15 * time.Second
+	// maxScheduleBody bounds the body of schedule create and update.
+	maxScheduleBody = 64 << 10
+)
+
+// runSchedules applies capture schedules every scheduleInterval until ctx
+// is done.
+func (a *App) runSchedules(ctx context.Context) {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		a.applySchedules(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applySchedules keeps every online device covered by an open window
+// capturing, and stops the captures schedules started once no window covers
+// their device any more. Captures started by hand are never stopped here.
+func (a *App) applySchedules(now time.Time) {
+	a.scheduleMu.Lock()
+	defer a.scheduleMu.Unlock()
+
+	due, finished, err := a.schedules.Due(now)
+	if err != nil {
+		a.log.Warn("failed to save schedules", "error", err)
+	}
+	for _, sch := range finished {
+		a.log.Info("one-off capture schedule finished", "id", sch.ID)
+		a.sse.Broadcast("schedule:finished", sch)
+	}
+
+	want := make(map[string]schedule.Due)
+	for _, dev := range a.GetDevices() {
+		if !dev.State.IsOnline() {
+			continue
+		}
+		for _, d := range due {
+			if a.scheduleCovers(d.Schedule, dev.Serial) {
+				want[dev.Serial] = d
+				break
+			}
+		}
+	}
+
+	a.mu.Lock()
+	var stop []string
+	for serial := range a.scheduled {
+		if _, ok := want[serial]; !ok {
+			stop = append(stop, serial)
+			delete(a.scheduled, serial)
+		}
+	}
+	for serial := range want {
+		if _, running := a.captures[serial]; running {
+			delete(want, serial)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, serial := range stop {
+		a.log.Info("capture window closed", "serial", serial)
+		a.StopCapture(serial)
+	}
+	for serial, d := range want {
+		if err := a.StartCaptureMode(serial, d.CaptureMode); err != nil {
+			a.log.Warn("scheduled capture failed to start", "serial", serial, "schedule", d.ID, "error", err)
+			continue
+		}
+		a.log.Info("capture window opened", "serial", serial, "schedule", d.ID)
+		a.mu.Lock()
+		a.scheduled[serial] = d.ID
+		a.mu.Unlock()
+	}
+}
+
+// scheduleCovers reports whether sch captures on serial.
+func (a *App) scheduleCovers(sch schedule.Schedule, serial string) bool {
+	if len(sch.Serials) > 0 {
+		return slices.Contains(sch.Serials, serial)
+	}
+	return a.selects(deviceSelector{Group: sch.Group, Tag: sch.Tag}, serial)
+}
+
+// ============================================
+// HTTP Handlers
+// ============================================
+
+func (a *App) handleListSchedules(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.schedules.List(time.Now()))
+}
+
+func (a *App) handleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	st, err := a.schedules.Get(r.PathValue("id"), time.Now())
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (a *App) handleCreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var sch schedule.Schedule
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxScheduleBody)).Decode(&sch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	created, err := a.schedules.Add(sch, time.Now())
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	a.writeScheduleStatus(w, http.StatusCreated, created.ID)
+}
+
+func (a *App) handleUpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	var sch schedule.Schedule
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxScheduleBody)).Decode(&sch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	updated, err := a.schedules.Update(r.PathValue("id"), sch, time.Now())
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	a.writeScheduleStatus(w, http.StatusOK, updated.ID)
+}
+
+func (a *App) handleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	if err := a.schedules.Remove(r.PathValue("id")); err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	a.applySchedules(time.Now())
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// writeScheduleStatus applies the changed schedule id right away and
+// answers with its state.
+func (a *App) writeScheduleStatus(w http.ResponseWriter, status int, id string) {
+	st, err := a.schedules.Get(id, time.Now())
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	a.applySchedules(time.Now())
+	writeJSON(w, status, st)
+}
+
+func writeScheduleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, schedule.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, schedule.ErrInvalid):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,315 @@
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/downloads"
+)
+
+const (
+	// screenrecordMaxSeconds is the longest recording screenrecord makes.
+	screenrecordMaxSeconds = 180
+	// screenrecordStartTimeout bounds starting screenrecord.
+	screenrecordStartTimeout = 10 * time.Second
+	// screenrecordPullTimeout bounds pulling one recording off the device.
+	screenrecordPullTimeout = 2 * time.Minute
+	// screenrecordOutputLimit bounds the screenrecord output kept for
+	// error messages.
+	screenrecordOutputLimit = 4 << 10
+)
+
+// screenRecording is a screenrecord running on a device.
+type screenRecording struct {
+	Serial string `json:"serial"`
+	// RemotePath is where the device writes the MP4 until it is pulled.
+	RemotePath string    `json:"remote_path"`
+	TimeLimit  int       `json:"time_limit_s"`
+	StartedAt  time.Time `json:"started_at"`
+
+	pid    string // of screenrecord on the device
+	stream *adb.ShellStream
+	out    io.Reader // the rest of the stream, after the pid
+	// done is closed once the recording is pulled (or failed) and result
+	// is set.
+	done   chan struct{}
+	result screenRecordResult
+}
+
+// screenRecordResult is the response of the stop endpoint and the payload
+// of screenrecord:stopped. StartedAt and EndedAt bound the traffic that
+// went with the recording.
+type screenRecordResult struct {
+	Serial    string          `json:"serial"`
+	StartedAt time.Time       `json:"started_at"`
+	EndedAt   time.Time       `json:"ended_at"`
+	Download  *downloads.Item `json:"download,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// startScreenRecord starts screenrecord on serial. The shell prints its pid
+// first so that stopping can interrupt screenrecord, which then finishes
+// the MP4. The caller runs finishScreenRecord.
+func (a *App) startScreenRecord(serial string, limit int) (*screenRecording, error) {
+	now := time.Now()
+	rec := &screenRecording{
+		Serial:     serial,
+		RemotePath: fmt.Sprintf("/sdcard/adb-monitor-%d.mp4", now.UnixMilli()),
+		TimeLimit:  limit,
+		StartedAt:  now,
+		done:       make(chan struct{}),
+	}
+
+	stream, err := a.client.OpenShellStream(a.ctx, serial,
+		fmt.Sprintf("echo $$; exec screenrecord --time-limit %d %s", limit, rec.RemotePath))
+	if err != nil {
+		return nil, err
+	}
+	rec.stream = stream
+
+	br := bufio.NewReader(stream)
+	pid := make(chan string, 1)
+	go func() {
+		line, _ := br.ReadString('\n')
+		pid <- strings.TrimSpace(line)
+	}()
+	select {
+	case rec.pid = <-pid:
+	case <-time.After(screenrecordStartTimeout):
+		stream.Close()
+		return nil, errors.New("screenrecord did not start")
+	}
+	if _, err := strconv.Atoi(rec.pid); err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("screenrecord did not start: %q", rec.pid)
+	}
+	rec.out = br
+	return rec, nil
+}
+
+// finishScreenRecord waits for screenrecord to exit, stopped or at its
+// time limit, then moves the recording to the downloads and announces it.
+func (a *App) finishScreenRecord(rec *screenRecording) {
+	msg, _ := io.ReadAll(io.LimitReader(rec.out, screenrecordOutputLimit))
+	io.Copy(io.Discard, rec.out)
+	rec.stream.Close()
+
+	res := screenRecordResult{Serial: rec.Serial, StartedAt: rec.StartedAt, EndedAt: time.Now()}
+	ctx, cancel := context.WithTimeout(a.ctx, screenrecordPullTimeout)
+	defer cancel()
+	item, err := a.downloads.Save(downloads.Item{
+		Name:        rec.Serial + "_" + rec.StartedAt.Format("20060102-150405") + ".mp4",
+		Kind:        "screenrecord",
+		Serial:      rec.Serial,
+		ContentType: "video/mp4",
+		StartedAt:   res.StartedAt,
+		EndedAt:     res.EndedAt,
+	}, func(w io.Writer) (int64, error) {
+		return a.client.Pull(ctx, rec.Serial, rec.RemotePath, w)
+	})
+	if _, rmErr := a.client.Shell(ctx, rec.Serial, "rm -f "+rec.RemotePath); rmErr != nil {
+		a.log.Debug("failed to remove screen recording from device", "serial", rec.Serial, "path", rec.RemotePath, "error", rmErr)
+	}
+
+	if err != nil {
+		if s := strings.TrimSpace(string(msg)); s != "" {
+			err = fmt.Errorf("%w (screenrecord: %s)", err, s)
+		}
+		res.Error = err.Error()
+		a.log.Warn("screen recording failed", "serial", rec.Serial, "error", err)
+	} else {
+		res.Download = &item
+		a.log.Info("screen recording saved", "serial", rec.Serial, "name", item.Name, "size", item.Size)
+	}
+
+	a.mu.Lock()
+	delete(a.recordings, rec.Serial)
+	rec.result = res
+	a.mu.Unlock()
+	close(rec.done)
+	a.sse.Broadcast("screenrecord:stopped", res)
+}
+
+// interruptScreenRecord sends screenrecord SIGINT, which makes it finish
+// the file and exit.
+func (a *App) interruptScreenRecord(ctx context.Context, rec *screenRecording) error {
+	_, err := a.client.Shell(ctx, rec.Serial, "kill -2 "+rec.pid)
+	return err
+}
+
+// stopScreenRecords interrupts every recording and waits up to timeout
+// for them to be pulled.
+func (a *App) stopScreenRecords(timeout time.Duration) {
+	a.mu.Lock()
+	recs := make([]*screenRecording, 0, len(a.recordings))
+	for _, rec := range a.recordings {
+		if rec != nil {
+			recs = append(recs, rec)
+		}
+	}
+	a.mu.Unlock()
+	if len(recs) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, timeout)
+	defer cancel()
+	for _, rec := range recs {
+		a.interruptScreenRecord(ctx, rec)
+	}
+	for _, rec := range recs {
+		select {
+		case <-rec.done:
+		case <-ctx.Done():
+			a.log.Warn("screen recordings not saved before shutdown", "serial", rec.Serial)
+			return
+		}
+	}
+}
+
+// ============================================
+// HTTP Handlers
+// ============================================
+
+// handleStartScreenRecord starts recording the screen of a device.
+// Query parameters: time_limit (seconds, up to 180).
+func (a *App) handleStartScreenRecord(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	limit := queryInt(r, "time_limit", screenrecordMaxSeconds)
+	if limit <= 0 || limit > screenrecordMaxSeconds {
+		writeError(w, http.StatusBadRequest, "time_limit must be between 1 and "+strconv.Itoa(screenrecordMaxSeconds))
+		return
+	}
+	if a.downloads.Dir() == "" {
+		writeError(w, http.StatusForbidden, "screen recording is disabled; start the server with -downloads-dir")
+		return
+	}
+	if a.writeDeviceError(w, serial) {
+		return
+	}
+
+	a.mu.Lock()
+	_, running := a.recordings[serial]
+	if !running {
+		// Reserve the device while screenrecord starts.
+		a.recordings[serial] = nil
+	}
+	a.mu.Unlock()
+	if running {
+		writeError(w, http.StatusConflict, "screen recording already running on "+serial)
+		return
+	}
+
+	rec, err := a.startScreenRecord(serial, limit)
+	a.mu.Lock()
+	if err != nil {
+		delete(a.recordings, serial)
+	} else {
+		a.recordings[serial] = rec
+	}
+	a.mu.Unlock()
+	if err != nil {
+		writeADBError(w, http.StatusBadGateway, err)
+		return
+	}
+	go a.finishScreenRecord(rec)
+	a.log.Info("screen recording started", "serial", serial, "time_limit", limit)
+	a.sse.Broadcast("screenrecord:started", rec)
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// handleStopScreenRecord stops the recording of a device and answers once
+// it is in the downloads.
+func (a *App) handleStopScreenRecord(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	a.mu.Lock()
+	rec := a.recordings[serial]
+	a.mu.Unlock()
+	if rec == nil {
+		writeError(w, http.StatusConflict, "no screen recording running on "+serial)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), deviceControlTimeout)
+	defer cancel()
+	if err := a.interruptScreenRecord(ctx, rec); err != nil {
+		writeADBError(w, http.StatusBadGateway, err)
+		return
+	}
+	select {
+	case <-rec.done:
+	case <-r.Context().Done():
+		return
+	}
+	if rec.result.Error != "" {
+		writeError(w, http.StatusBadGateway, rec.result.Error)
+		return
+	}
+	writeJSON(w, http.StatusOK, rec.result)
+}
+
+func (a *App) handleListDownloads(w http.ResponseWriter, r *http.Request) {
+	items, err := a.downloads.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := items[:0]
+	team, serial := a.teamOf(r), r.URL.Query().Get("serial")
+	for _, it := range items {
+		if (team == "" || a.teams.Owns(team, it.Serial)) && (serial == "" || it.Serial == serial) {
+			out = append(out, it)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// download returns the download named in the path, writing the error if
+// there is none the caller may see.
+func (a *App) download(w http.ResponseWriter, r *http.Request) (downloads.Item, string, bool) {
+	it, path, err := a.downloads.Get(r.PathValue("name"))
+	if err == nil {
+		if team := a.teamOf(r); team != "" && !a.teams.Owns(team, it.Serial) {
+			err = downloads.ErrNotFound
+		}
+	}
+	switch {
+	case errors.Is(err, downloads.ErrNotFound), errors.Is(err, downloads.ErrDisabled):
+		writeError(w, http.StatusNotFound, "download not found")
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		return it, path, true
+	}
+	return it, path, false
+}
+
+func (a *App) handleGetDownload(w http.ResponseWriter, r *http.Request) {
+	it, path, ok := a.download(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", it.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", it.Name))
+	http.ServeFile(w, r, path)
+}
+
+func (a *App) handleDeleteDownload(w http.ResponseWriter, r *http.Request) {
+	it, _, ok := a.download(w, r)
+	if !ok {
+		return
+	}
+	if err := a.downloads.Delete(it.Name); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted", "name": it.Name})
+}
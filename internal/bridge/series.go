@@ -0,0 +1,129 @@
+package bridge
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/health"
+	"github.com/imcanugur/go-adb-monitor/internal/timeseries"
+)
+
+const (
+	// metricsSaveInterval is how often changed metric histories are
+	// written to their file.
+	metricsSaveInterval = time.Minute
+	// maxMetricPoints bounds ?points= so a chart cannot ask for more
+	// buckets than the history holds.
+	maxMetricPoints = timeseries.DefaultCapacity
+)
+
+// Device metrics sampled at every health probe.
+const (
+	metricHealthScore    = "health.score"
+	metricShellLatency   = "health.shell_latency_ms"
+	metricErrorRate      = "health.error_rate"
+	metricBatteryLevel   = "battery.level"
+	metricBatteryTemp    = "battery.temperature_c"
+	metricCapturePackets = "capture.packets"
+	metricCaptureErrors  = "capture.errors"
+)
+
+// Wi-Fi metrics sampled at every network state read while Wi-Fi is
+// associated.
+const (
+	metricWifiRSSI      = "wifi.rssi_dbm"
+	metricWifiLinkSpeed = "wifi.link_speed_mbps"
+)
+
+// recordMetrics samples a device's health result and, when it is being
+// captured, its capture counters.
+func (a *App) recordMetrics(serial string, r health.Result, stats *capture.CaptureStats) {
+	now := r.UpdatedAt
+	a.series.Add(serial, metricHealthScore, now, float64(r.Score))
+	a.series.Add(serial, metricShellLatency, now, float64(r.LatencyMs))
+	a.series.Add(serial, metricErrorRate, now, r.ErrorRate)
+	if b := r.Battery; b != nil {
+		a.series.Add(serial, metricBatteryLevel, now, float64(b.Level))
+		a.series.Add(serial, metricBatteryTemp, now, b.TemperatureC)
+	}
+	if stats != nil {
+		a.series.Add(serial, metricCapturePackets, now, float64(stats.PacketCount))
+		a.series.Add(serial, metricCaptureErrors, now, float64(stats.Errors))
+	}
+}
+
+// saveMetrics writes changed metric histories every metricsSaveInterval
+// until ctx is done; Shutdown saves the last ones.
+func (a *App) saveMetrics(ctx context.Context) {
+	if a.series.Path() == "" {
+		return
+	}
+	ticker := time.NewTicker(metricsSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.series.Save(); err != nil {
+				a.log.Warn("failed to save device metrics", "error", err)
+			}
+		}
+	}
+}
+
+// ============================================
+// HTTP Handlers
+// ============================================
+
+func (a *App) handleGetDeviceMetrics(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	q := r.URL.Query()
+	metric := q.Get("metric")
+	if metric == "" {
+		known := a.series.Metrics(serial)
+		if len(known) == 0 {
+			writeError(w, http.StatusNotFound, "no metrics for "+serial)
+			return
+		}
+		writeError(w, http.StatusBadRequest, "metric is required, one of: "+strings.Join(known, ", "))
+		return
+	}
+
+	from, err := parseTimeParam(q.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	to, err := parseTimeParam(q.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+	var step time.Duration
+	if s := q.Get("step"); s != "" {
+		step, err = time.ParseDuration(s)
+		if err != nil || step < time.Second {
+			writeError(w, http.StatusBadRequest, "step must be a duration of at least 1s")
+			return
+		}
+	}
+	points := queryInt(r, "points", 0)
+	if points < 0 || points > maxMetricPoints {
+		writeError(w, http.StatusBadRequest, "points out of range")
+		return
+	}
+
+	series, ok := a.series.Query(timeseries.Query{
+		Serial: serial, Metric: metric, From: from, To: to, Step: step, MaxPoints: points,
+	})
+	if !ok {
+		writeError(w, http.StatusNotFound, "no "+metric+" samples for "+serial)
+		return
+	}
+	writeJSON(w, http.StatusOK, series)
+}
@@ -0,0 +1,186 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/ws"
+)
+
+const (
+	// shellTerm is the $TERM advertised to PTY sessions.
+	shellTerm = "xterm-256color"
+	// maxShellInput bounds a single WebSocket message from the browser.
+	maxShellInput = 64 << 10
+)
+
+// shellControl is a JSON control message exchanged as a WebSocket text
+// frame. Raw terminal bytes travel as binary frames in both directions.
+type shellControl struct {
+	Type    string `json:"type"` // resize, exit, error
+	Rows    int    `json:"rows,omitempty"`
+	Cols    int    `json:"cols,omitempty"`
+	Code    *int   `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// terminal is an interactive shell on a device, either shell v2 or the
+// legacy shell: service for devices that lack the shell_v2 feature.
+type terminal interface {
+	io.Writer
+	Resize(rows, cols int) error
+	// pump copies device output to emit until the shell ends and returns
+	// its exit code, or adb.ShellExitUnknown if the protocol has none.
+	pump(emit func([]byte) error) (int, error)
+	Close() error
+}
+
+// handleDeviceShell upgrades to a WebSocket and attaches it to an
+// interactive shell on the device. Query parameters: rows, cols.
+func (a *App) handleDeviceShell(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	if a.writeDeviceError(w, serial) {
+		return
+	}
+	rows := queryInt(r, "rows", 24)
+	cols := queryInt(r, "cols", 80)
+
+	conn, err := ws.Upgrade(w, r)
+	if err != nil {
+		a.log.Debug("shell upgrade failed", "serial", serial, "error", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxShellInput)
+
+	ctx, cancel := context.WithCancel(a.ctx)
+	defer cancel()
+
+	term, err := a.openTerminal(ctx, serial, rows, cols)
+	if err != nil {
+		writeShellControl(conn, shellControl{Type: "error", Message: err.Error()})
+		return
+	}
+	defer term.Close()
+
+	log := a.log.With("serial", serial, "remote", conn.RemoteAddr().String())
+	log.Info("shell session opened")
+
+	go func() {
+		defer cancel()
+		code, err := term.pump(func(p []byte) error {
+			return conn.WriteMessage(ws.BinaryMessage, p)
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Debug("shell output ended", "error", err)
+		}
+		writeShellControl(conn, shellControl{Type: "exit", Code: &code})
+		conn.Close()
+	}()
+
+	for {
+		typ, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if typ == ws.BinaryMessage {
+			if _, err := term.Write(data); err != nil {
+				break
+			}
+			continue
+		}
+
+		var msg shellControl
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		if msg.Type == "resize" && msg.Rows > 0 && msg.Cols > 0 {
+			term.Resize(msg.Rows, msg.Cols)
+		}
+	}
+
+	log.Info("shell session closed")
+}
+
+// openTerminal starts a PTY shell using shell v2, falling back to the
+// legacy shell: service when the device rejects it.
+func (a *App) openTerminal(ctx context.Context, serial string, rows, cols int) (terminal, error) {
+	sess, err := a.client.OpenShellV2(ctx, serial, "", adb.ShellV2Options{PTY: true, Term: shellTerm})
+	if err == nil {
+		sess.Resize(rows, cols)
+		return v2Terminal{sess}, nil
+	}
+	if !errors.Is(err, adb.ErrShellV2Unsupported) {
+		return nil, err
+	}
+
+	a.log.Debug("shell v2 unavailable, using legacy shell", "serial", serial, "error", err)
+	stream, err := a.client.OpenShellStream(ctx, serial, "")
+	if err != nil {
+		return nil, err
+	}
+	return legacyTerminal{stream}, nil
+}
+
+type v2Terminal struct {
+	*adb.ShellSession
+}
+
+func (t v2Terminal) pump(emit func([]byte) error) (int, error) {
+	for {
+		pkt, err := t.ReadPacket()
+		if err != nil {
+			return adb.ShellExitUnknown, err
+		}
+		switch pkt.ID {
+		case adb.ShellStdout, adb.ShellStderr:
+			if err := emit(pkt.Data); err != nil {
+				return adb.ShellExitUnknown, err
+			}
+		case adb.ShellExit:
+			if len(pkt.Data) == 0 {
+				return adb.ShellExitUnknown, nil
+			}
+			return int(pkt.Data[0]), nil
+		}
+	}
+}
+
+type legacyTerminal struct {
+	*adb.ShellStream
+}
+
+// Resize is a no-op: the legacy protocol has no window-size message.
+func (legacyTerminal) Resize(rows, cols int) error {
+	return nil
+}
+
+func (t legacyTerminal) pump(emit func([]byte) error) (int, error) {
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := t.Read(buf)
+		if n > 0 {
+			if err := emit(buf[:n]); err != nil {
+				return adb.ShellExitUnknown, err
+			}
+		}
+		if err == io.EOF {
+			return adb.ShellExitUnknown, nil
+		}
+		if err != nil {
+			return adb.ShellExitUnknown, err
+		}
+	}
+}
+
+func writeShellControl(conn *ws.Conn, msg shellControl) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(ws.TextMessage, data)
+}
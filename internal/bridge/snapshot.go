@@ -0,0 +1,78 @@
+package bridge
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/atomicfile"
+	"github.com/imcanugur/go-adb-monitor/internal/store"
+)
+
+// snapshotResult is the response of POST /api/store/snapshot.
+type snapshotResult struct {
+	Path      string    `json:"path"`
+	Bytes     int64     `json:"bytes"`
+	CreatedAt time.Time `json:"created_at"`
+	store.SnapshotStats
+}
+
+// saveSnapshot writes the store to the snapshot file, replacing it only
+// once the new one is complete.
+func (a *App) saveSnapshot() (snapshotResult, error) {
+	res := snapshotResult{Path: a.snapshotFile, CreatedAt: time.Now()}
+	err := atomicfile.Write(a.snapshotFile, func(w io.Writer) error {
+		var err error
+		res.SnapshotStats, err = a.store.WriteSnapshot(w)
+		return err
+	})
+	if err != nil {
+		return res, fmt.Errorf("save snapshot: %w", err)
+	}
+	if info, err := os.Stat(a.snapshotFile); err == nil {
+		res.Bytes = info.Size()
+	}
+	return res, nil
+}
+
+// RestoreSnapshot loads the snapshot file written by POST
+// /api/store/snapshot into the store. Call it before Startup, so the
+// restored entries precede live ones and are not streamed to clients.
+func (a *App) RestoreSnapshot() (store.SnapshotStats, error) {
+	if a.snapshotFile == "" {
+		return store.SnapshotStats{}, fmt.Errorf("no snapshot file configured")
+	}
+	f, err := os.Open(a.snapshotFile)
+	if err != nil {
+		return store.SnapshotStats{}, err
+	}
+	defer f.Close()
+	stats, err := a.store.RestoreSnapshot(f)
+	if err != nil {
+		return stats, fmt.Errorf("restore %s: %w", a.snapshotFile, err)
+	}
+	a.log.Info("store snapshot restored", "path", a.snapshotFile,
+		"packets", stats.Packets, "connections", stats.Connections,
+		"dns_lookups", stats.DNSLookups, "tls_sessions", stats.TLSSessions)
+	return stats, nil
+}
+
+// handleStoreSnapshot writes the packets, connections, DNS lookups and TLS
+// handshakes held in memory to the snapshot file, which -restore loads at
+// the next start.
+func (a *App) handleStoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	if a.snapshotFile == "" {
+		writeError(w, http.StatusForbidden, "snapshots are disabled; start the server with -snapshot-file")
+		return
+	}
+	res, err := a.saveSnapshot()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.log.Info("store snapshot saved", "path", res.Path, "bytes", res.Bytes,
+		"packets", res.Packets, "connections", res.Connections)
+	writeJSON(w, http.StatusOK, res)
+}
@@ -4,35 +4,149 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// sseReplaySize is how many recent events the hub keeps for clients
+	// that reconnect with Last-Event-ID.
+	sseReplaySize = 1024
+
+	// DefaultSSEClientRate is the default number of events per second each
+	// SSE client is sent; bursts of twice as many pass.
+	DefaultSSEClientRate = 100
 )
 
 // sseClient represents a single SSE subscriber.
 type sseClient struct {
 	ch chan []byte
+	// team is the team the client's token belongs to; it is sent only
+	// what concerns that team's devices. Empty for unscoped clients.
+	team string
+	// filter is what the client asked to be sent; nil for everything.
+	filter *streamFilter
+	// key is the same for clients sent the same messages: "" for those
+	// sent every event unchanged.
+	key string
+
+	// tokens and last are the client's rate-limit bucket, guarded by the
+	// hub's mu.
+	tokens float64
+	last   time.Time
+	// dropped counts events not delivered since the last one that was.
+	dropped atomic.Int64
 }
 
 // SSEHub manages Server-Sent Event connections.
-// It fans out events to all connected browser clients.
+// It fans out events to all connected browser clients. Every event carries
+// a monotonically increasing id, and the most recent ones are kept so a
+// client reconnecting with Last-Event-ID gets what it missed. Clients of a
+// team get events scoped to the team's devices (see scopeEvent), and
+// clients with a filter only what passes it (see streamFilter).
 type SSEHub struct {
 	mu      sync.RWMutex
 	clients map[*sseClient]struct{}
+
+	// lastID starts at the hub's creation time in microseconds, so ids
+	// from before a server restart are always older than anything kept.
+	lastID uint64
+	// replay is a ring of the last replayLen events; the event with id n
+	// sits at n % sseReplaySize.
+	replay    []sseEvent
+	replayLen int
+
+	// rate is the events per second sent to each client; zero means no
+	// limit.
+	rate float64
+
+	// owns reports whether a team owns a device; nil when there are no
+	// teams.
+	owns func(team, serial string) bool
+}
+
+// sseEvent is one broadcast event.
+type sseEvent struct {
+	id   uint64
+	typ  string
+	data []byte
+	// msg is the event formatted for unscoped clients.
+	msg []byte
 }
 
-// NewSSEHub creates a new SSE hub.
-func NewSSEHub() *SSEHub {
+func formatEvent(id uint64, typ string, data []byte) []byte {
+	return []byte(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", id, typ, data))
+}
+
+// message returns ev formatted for a client of team with filter f, or nil
+// if the client is not sent it: it concerns none of the team's devices or
+// does not pass f.
+func (h *SSEHub) message(ev sseEvent, team string, f *streamFilter) []byte {
+	if team == "" && f == nil {
+		return ev.msg
+	}
+	if !f.matchType(ev.typ) {
+		return nil
+	}
+	data, ok := ev.data, true
+	if team != "" {
+		data, ok = scopeEvent(ev.typ, data, func(serial string) bool {
+			return h.owns != nil && h.owns(team, serial)
+		})
+	}
+	if ok && f.traffic() {
+		data, ok = f.filterTraffic(ev.typ, data)
+	}
+	if !ok {
+		return nil
+	}
+	return formatEvent(ev.id, ev.typ, data)
+}
+
+// NewSSEHub creates a new SSE hub that sends each client at most
+// clientRate events per second (bursts of twice that), dropping the rest
+// for that client. Zero disables the limit.
+func NewSSEHub(clientRate float64) *SSEHub {
 	return &SSEHub{
 		clients: make(map[*sseClient]struct{}),
+		lastID:  uint64(time.Now().UnixMicro()),
+		replay:  make([]sseEvent, sseReplaySize),
+		rate:    clientRate,
 	}
 }
 
-// register adds a new client.
-func (h *SSEHub) register() *sseClient {
-	c := &sseClient{ch: make(chan []byte, 256)}
+// register adds a new client of team ("" for unscoped) with filter f (nil
+// for none). If lastID is non-zero the events after it are returned for
+// replay; gap reports that some of them are no longer kept (or that lastID
+// is from before a server restart).
+func (h *SSEHub) register(lastID uint64, team string, f *streamFilter) (c *sseClient, missed [][]byte, gap bool) {
+	c = &sseClient{ch: make(chan []byte, 256), team: team, filter: f, tokens: 2 * h.rate, last: time.Now()}
+	if team != "" || f != nil {
+		c.key = team
+		if f != nil {
+			c.key += "\x00" + f.key
+		}
+	}
 	h.mu.Lock()
+	defer h.mu.Unlock()
 	h.clients[c] = struct{}{}
-	h.mu.Unlock()
-	return c
+
+	if lastID == 0 || lastID == h.lastID {
+		return c, nil, false
+	}
+	if lastID > h.lastID {
+		return c, nil, true
+	}
+	oldest := h.lastID - uint64(h.replayLen) + 1
+	gap = lastID+1 < oldest
+	for id := max(lastID+1, oldest); id <= h.lastID; id++ {
+		if msg := h.message(h.replay[id%sseReplaySize], team, f); msg != nil {
+			missed = append(missed, msg)
+		}
+	}
+	return c, missed, gap
 }
 
 // unregister removes a client.
@@ -49,44 +163,111 @@ func (h *SSEHub) ClientCount() int {
 	return len(h.clients)
 }
 
-// Broadcast sends an event to all connected clients.
-// Non-blocking: if a client's buffer is full, the message is dropped for that client.
+// Broadcast sends an event to all connected clients, scoped for the
+// clients of a team and filtered for those with a filter. Non-blocking: if
+// a client's buffer is full or it is over its rate limit, the message is
+// dropped for that client.
 func (h *SSEHub) Broadcast(eventType string, data interface{}) {
 	payload, err := json.Marshal(data)
 	if err != nil {
 		return
 	}
-	msg := []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, payload))
 
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID++
+	ev := sseEvent{id: h.lastID, typ: eventType, data: payload}
+	ev.msg = formatEvent(ev.id, eventType, payload)
+	h.replay[h.lastID%sseReplaySize] = ev
+	h.replayLen = min(h.replayLen+1, sseReplaySize)
+	now := time.Now()
+	var msgs map[string][]byte // client key -> its message, nil if none
 	for c := range h.clients {
+		msg := ev.msg
+		if c.key != "" {
+			m, ok := msgs[c.key]
+			if !ok {
+				if msgs == nil {
+					msgs = make(map[string][]byte)
+				}
+				m = h.message(ev, c.team, c.filter)
+				msgs[c.key] = m
+			}
+			if m == nil {
+				continue
+			}
+			msg = m
+		}
+		if !h.allow(c, now) {
+			c.dropped.Add(1)
+			continue
+		}
 		select {
 		case c.ch <- msg:
 		default:
 			// drop — client can't keep up
+			c.dropped.Add(1)
 		}
 	}
 }
 
+// allow takes a token from c's bucket. The caller holds h.mu.
+func (h *SSEHub) allow(c *sseClient, now time.Time) bool {
+	if h.rate <= 0 {
+		return true
+	}
+	c.tokens = min(2*h.rate, c.tokens+now.Sub(c.last).Seconds()*h.rate)
+	c.last = now
+	if c.tokens < 1 {
+		return false
+	}
+	c.tokens--
+	return true
+}
+
 // ServeHTTP implements the SSE endpoint handler.
 func (h *SSEHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, "")
+}
+
+// serve streams events to a client of team, or every event if team is "",
+// narrowed by the filter in the query.
+func (h *SSEHub) serve(w http.ResponseWriter, r *http.Request, team string) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "streaming not supported", http.StatusInternalServerError)
 		return
 	}
+	filter, err := parseStreamFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	c := h.register()
+	// Browsers send Last-Event-ID when EventSource reconnects by itself;
+	// a page that re-creates its EventSource passes last_event_id instead.
+	lastIDStr := r.Header.Get("Last-Event-ID")
+	if lastIDStr == "" {
+		lastIDStr = r.URL.Query().Get("last_event_id")
+	}
+	lastID, _ := strconv.ParseUint(lastIDStr, 10, 64)
+
+	c, missed, gap := h.register(lastID, team, filter)
 	defer h.unregister(c)
 
 	// Initial ping so the client knows the connection is alive.
 	fmt.Fprint(w, "event: ping\ndata: {}\n\n")
+	if gap {
+		// Some events are gone; the client should refetch state.
+		fmt.Fprintf(w, "event: stream:gap\ndata: {\"last_event_id\":%d}\n\n", lastID)
+	}
+	for _, msg := range missed {
+		w.Write(msg)
+	}
 	flusher.Flush()
 
 	for {
@@ -94,6 +275,10 @@ func (h *SSEHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case <-r.Context().Done():
 			return
 		case msg := <-c.ch:
+			if n := c.dropped.Swap(0); n > 0 {
+				// Tell the client it missed events, so it can refetch.
+				fmt.Fprintf(w, "event: stream:dropped\ndata: {\"dropped\":%d}\n\n", n)
+			}
 			w.Write(msg)
 			flusher.Flush()
 		}
@@ -0,0 +1,159 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+// streamFilter narrows the SSE stream of one client, so a client watching
+// one device of a large lab is not sent the traffic of all of them. It is
+// read from the query of /api/events:
+//
+//	type    comma-separated event types
+//	serial  comma-separated devices
+//	host    substring of a packet's host, a connection's hostname or a
+//	        DNS lookup's name, case-insensitively
+//	port    either port of a packet, or a connection's remote port
+//	app     substring of the app of a connection, or of a packet whose
+//	        sender the capture knows, case-insensitively
+//
+// serial, host, port and app apply to the traffic events — packets:batch,
+// connection:new, connection:closed, dns:lookup and store:delta — so a
+// dashboard still learns of every device; what they cannot be matched
+// against (packets without an app, DNS lookups for port and app) is not
+// sent. A nil filter passes everything.
+type streamFilter struct {
+	serials []string
+	types   []string
+	host    string // lower case
+	port    uint16
+	app     string // lower case
+
+	// key identifies the filter among the hub's clients, which share the
+	// formatted event when their filters are equal.
+	key string
+}
+
+// parseStreamFilter returns the filter of the query, or nil if it has none.
+func parseStreamFilter(q url.Values) (*streamFilter, error) {
+	f := &streamFilter{
+		serials: splitList(q.Get("serial")),
+		types:   splitList(q.Get("type")),
+		host:    strings.ToLower(strings.TrimSpace(q.Get("host"))),
+		app:     strings.ToLower(strings.TrimSpace(q.Get("app"))),
+	}
+	if s := q.Get("port"); s != "" {
+		port, err := strconv.ParseUint(s, 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("invalid port %q", s)
+		}
+		f.port = uint16(port)
+	}
+	if len(f.types) == 0 && !f.traffic() {
+		return nil, nil
+	}
+	slices.Sort(f.serials)
+	slices.Sort(f.types)
+	f.key = fmt.Sprintf("%q %q %q %d %q", f.serials, f.types, f.host, f.port, f.app)
+	return f, nil
+}
+
+// splitList splits a comma-separated parameter, dropping empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// traffic reports whether f filters packets, connections and lookups.
+func (f *streamFilter) traffic() bool {
+	return f != nil && (len(f.serials) > 0 || f.host != "" || f.port != 0 || f.app != "")
+}
+
+func (f *streamFilter) matchType(typ string) bool {
+	return f == nil || len(f.types) == 0 || slices.Contains(f.types, typ)
+}
+
+func (f *streamFilter) matchSerial(serial string) bool {
+	return len(f.serials) == 0 || slices.Contains(f.serials, serial)
+}
+
+func (f *streamFilter) matchPacket(p *capture.NetworkPacket) bool {
+	return f.matchSerial(p.Serial) &&
+		(f.host == "" || strings.Contains(strings.ToLower(p.HTTPHost), f.host)) &&
+		(f.port == 0 || p.SrcPort == f.port || p.DstPort == f.port) &&
+		(f.app == "" || strings.Contains(strings.ToLower(p.App), f.app))
+}
+
+func (f *streamFilter) matchConnection(c *capture.Connection) bool {
+	return f.matchSerial(c.Serial) &&
+		(f.host == "" || strings.Contains(strings.ToLower(c.Hostname), f.host)) &&
+		(f.port == 0 || c.RemotePort == f.port) &&
+		(f.app == "" || strings.Contains(strings.ToLower(c.AppName), f.app))
+}
+
+func (f *streamFilter) matchLookup(l *capture.DNSLookup) bool {
+	return f.matchSerial(l.Serial) &&
+		(f.host == "" || strings.Contains(strings.ToLower(l.Query), f.host)) &&
+		f.port == 0 && f.app == ""
+}
+
+// filterTraffic returns the data of a traffic event with what f rejects
+// removed; ok is false when nothing is left. Other events pass unchanged.
+func (f *streamFilter) filterTraffic(typ string, data []byte) (out []byte, ok bool) {
+	switch typ {
+	case "packets:batch":
+		var batch packetBatch
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, false
+		}
+		kept := slices.DeleteFunc(batch.Packets, func(p capture.NetworkPacket) bool {
+			return !f.matchPacket(&p)
+		})
+		switch len(kept) {
+		case 0:
+			return nil, false
+		case len(batch.Packets):
+			return data, true
+		}
+		out, err := json.Marshal(packetBatch{Packets: kept})
+		return out, err == nil
+	case "store:delta":
+		var d storeDelta
+		if err := json.Unmarshal(data, &d); err != nil {
+			return nil, false
+		}
+		d.Packets = slices.DeleteFunc(d.Packets, func(p capture.NetworkPacket) bool { return !f.matchPacket(&p) })
+		d.Connections = slices.DeleteFunc(d.Connections, func(c capture.Connection) bool { return !f.matchConnection(&c) })
+		d.UpdatedConnections = slices.DeleteFunc(d.UpdatedConnections, func(c capture.Connection) bool { return !f.matchConnection(&c) })
+		d.DNSLookups = slices.DeleteFunc(d.DNSLookups, func(l capture.DNSLookup) bool { return !f.matchLookup(&l) })
+		if len(d.Packets)+len(d.Connections)+len(d.UpdatedConnections)+len(d.DNSLookups) == 0 && d.Dropped == 0 {
+			return nil, false
+		}
+		out, err := json.Marshal(d)
+		return out, err == nil
+	case "connection:new", "connection:closed":
+		var c capture.Connection
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, false
+		}
+		return data, f.matchConnection(&c)
+	case "dns:lookup":
+		var l capture.DNSLookup
+		if err := json.Unmarshal(data, &l); err != nil {
+			return nil, false
+		}
+		return data, f.matchLookup(&l)
+	}
+	return data, true
+}
@@ -0,0 +1,157 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// teamOf returns the team of the caller's token, or "" for the server's
+// own tokens (and when there are no teams), which see every device.
+func (a *App) teamOf(r *http.Request) string {
+	return a.teams.TeamOf(requestToken(r))
+}
+
+// teamScoped wraps the handler of rt for team tokens. On routes naming a
+// device the device must be the team's: others are reported as not found,
+// so a team cannot even learn they exist. Other routes are refused unless
+// they are marked for teams, whose handlers limit what they list and
+// change to the caller's devices.
+func (a *App) teamScoped(rt route, h http.HandlerFunc) http.HandlerFunc {
+	bySerial := strings.Contains(rt.path, "{serial}")
+	return func(w http.ResponseWriter, r *http.Request) {
+		team := a.teamOf(r)
+		switch {
+		case team == "":
+		case bySerial:
+			if !a.teams.Owns(team, r.PathValue("serial")) {
+				writeErrorCode(w, http.StatusNotFound, codeDeviceNotFound, "device not found")
+				return
+			}
+		case !rt.teams:
+			writeError(w, http.StatusForbidden, "not available to team tokens")
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (a *App) handleEvents(w http.ResponseWriter, r *http.Request) {
+	a.sse.serve(w, r, a.teamOf(r))
+}
+
+// serverEvents concern the server rather than any device; every client
+// gets them.
+var serverEvents = map[string]bool{
+	"adb:outdated":         true,
+	"adb:server_restarted": true,
+	"adb:server_down":      true,
+	"adb:server_up":        true,
+	"store:cleared":        true,
+}
+
+// serialKeyedEvents carry an object keyed by device serial.
+var serialKeyedEvents = map[string]bool{
+	"device:health":  true,
+	"device:network": true,
+}
+
+// eventScope says whom a part of an event concerns.
+type eventScope int
+
+const (
+	scopeNone  eventScope = iota // no device
+	scopeOther                   // only devices of others
+	scopeOwn                     // some device of the team
+)
+
+// scopeEvent returns the data of an event as a team sees it, with what
+// concerns other devices removed: objects with the "serial" of another
+// device, such entries of lists, and the other serials of "serials" lists.
+// ok is false when nothing in the event concerns the team's devices, as
+// for aggregates over all devices, unless it is one of serverEvents.
+func scopeEvent(typ string, data []byte, owns func(serial string) bool) ([]byte, bool) {
+	if serverEvents[typ] {
+		return data, true
+	}
+	// Numbers are kept as written: ids and timestamps may not survive a
+	// float64.
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, false
+	}
+	if m, ok := v.(map[string]any); ok && serialKeyedEvents[typ] {
+		for serial := range m {
+			if !owns(serial) {
+				delete(m, serial)
+			}
+		}
+		if len(m) == 0 {
+			return nil, false
+		}
+	} else {
+		var scope eventScope
+		if v, scope = scrubEvent(v, owns); scope != scopeOwn {
+			return nil, false
+		}
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// scrubEvent removes from v, in place, what concerns devices that owns
+// rejects, and reports whom v concerns.
+func scrubEvent(v any, owns func(serial string) bool) (any, eventScope) {
+	switch v := v.(type) {
+	case map[string]any:
+		if serial, ok := v["serial"].(string); ok {
+			if owns(serial) {
+				return v, scopeOwn
+			}
+			return v, scopeOther
+		}
+		scope := scopeNone
+		for k, x := range v {
+			if serials, ok := x.([]any); ok && k == "serials" {
+				kept := serials[:0]
+				for _, s := range serials {
+					if s, ok := s.(string); ok && owns(s) {
+						kept = append(kept, s)
+						scope = scopeOwn
+					} else {
+						scope = max(scope, scopeOther)
+					}
+				}
+				v[k] = kept
+				continue
+			}
+			x, xs := scrubEvent(x, owns)
+			if _, isMap := x.(map[string]any); isMap && xs == scopeOther {
+				delete(v, k)
+			} else {
+				v[k] = x
+			}
+			scope = max(scope, xs)
+		}
+		return v, scope
+	case []any:
+		kept := v[:0]
+		scope := scopeNone
+		for _, x := range v {
+			x, xs := scrubEvent(x, owns)
+			if xs != scopeOther {
+				kept = append(kept, x)
+			}
+			scope = max(scope, xs)
+		}
+		return kept, scope
+	default:
+		return v, scopeNone
+	}
+}
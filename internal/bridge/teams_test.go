@@ -0,0 +1,96 @@
+package bridge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/imcanugur/go-adb-monitor/internal/teams"
+)
+
+func TestScopeEvent(t *testing.T) {
+	owns := func(serial string) bool { return serial == "dev1" }
+	tests := []struct {
+		name, typ, data string
+		want            string // "" when the event is not sent
+	}{
+		{"own device", "capture:started", `{"serial":"dev1","mode":"tcpdump"}`, `{"mode":"tcpdump","serial":"dev1"}`},
+		{"other device", "capture:started", `{"serial":"dev2","mode":"tcpdump"}`, ""},
+		{"unowned device", "device:connected", `{"serial":"dev3"}`, ""},
+		{"own nested object", "exec:progress", `{"id":"exec-1","result":{"serial":"dev1","exit_code":0}}`,
+			`{"id":"exec-1","result":{"exit_code":0,"serial":"dev1"}}`},
+		{"other nested object", "exec:progress", `{"id":"exec-1","result":{"serial":"dev2","exit_code":0}}`, ""},
+		{"nested objects of both", "pair", `{"a":{"serial":"dev1"},"b":{"serial":"dev2"},"n":1}`,
+			`{"a":{"serial":"dev1"},"n":1}`},
+		{"list entries", "packets:batch", `{"packets":[{"id":"p1","serial":"dev1"},{"id":"p2","serial":"dev2"}]}`,
+			`{"packets":[{"id":"p1","serial":"dev1"}]}`},
+		{"list of others", "packets:batch", `{"packets":[{"id":"p2","serial":"dev2"}]}`, ""},
+		{"top-level list", "connections:batch", `[{"serial":"dev2"},{"serial":"dev1"}]`, `[{"serial":"dev1"}]`},
+		{"deeply nested", "capture:rollout_completed", `{"id":"r1","devices":[{"serial":"dev1","status":"started"},{"serial":"dev2","status":"failed"}]}`,
+			`{"devices":[{"serial":"dev1","status":"started"}],"id":"r1"}`},
+		{"serials list", "exec:started", `{"id":"exec-1","serials":["dev1","dev2","dev3"]}`, `{"id":"exec-1","serials":["dev1"]}`},
+		{"serials of others", "exec:started", `{"id":"exec-1","serials":["dev2"]}`, ""},
+		{"serial-keyed", "device:health", `{"dev1":{"score":90},"dev2":{"score":40}}`, `{"dev1":{"score":90}}`},
+		{"serial-keyed others", "device:health", `{"dev2":{"score":40}}`, ""},
+		{"server event", "adb:server_restarted", `{"at":"2024-01-01T00:00:00Z"}`, `{"at":"2024-01-01T00:00:00Z"}`},
+		{"server event kept verbatim", "store:cleared", `{ "serial": "dev2" }`, `{ "serial": "dev2" }`},
+		{"aggregate", "stats:traffic", `{"total_bytes":1024,"packets":12}`, ""},
+		{"large number", "capture:stats", `{"serial":"dev1","bytes":12345678901234567890}`, `{"bytes":12345678901234567890,"serial":"dev1"}`},
+		{"invalid JSON", "capture:started", `{"serial":`, ""},
+	}
+	for _, tt := range tests {
+		out, ok := scopeEvent(tt.typ, []byte(tt.data), owns)
+		switch {
+		case tt.want == "" && ok:
+			t.Errorf("%s: sent %s, want dropped", tt.name, out)
+		case tt.want != "" && !ok:
+			t.Errorf("%s: dropped, want %s", tt.name, tt.want)
+		case ok && string(out) != tt.want:
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, out, tt.want)
+		}
+	}
+}
+
+func TestTeamScoped(t *testing.T) {
+	ts, err := teams.New([]teams.Team{
+		{Name: "payments", Tokens: []string{"pay"}, Devices: []string{"dev1"}},
+		{Name: "maps", Tokens: []string{"map"}, Devices: []string{"dev2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &App{teams: ts}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	bySerial := route{method: "GET", path: "/api/devices/{serial}/health"}
+	listed := route{method: "GET", path: "/api/devices", teams: true}
+	serverWide := route{method: "POST", path: "/api/devices/refresh"}
+	tests := []struct {
+		name   string
+		rt     route
+		serial string
+		token  string
+		want   int
+	}{
+		{"own device", bySerial, "dev1", "pay", http.StatusOK},
+		{"other team's device", bySerial, "dev2", "pay", http.StatusNotFound},
+		{"unowned device", bySerial, "dev3", "pay", http.StatusNotFound},
+		{"server token on any device", bySerial, "dev3", "server", http.StatusOK},
+		{"team route", listed, "", "map", http.StatusOK},
+		{"server-wide route", serverWide, "", "map", http.StatusForbidden},
+		{"server token on server-wide route", serverWide, "", "server", http.StatusOK},
+		{"serial route not marked for teams", route{method: "GET", path: "/api/packets/{serial}"}, "dev2", "map", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.rt.method, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+tt.token)
+		if tt.serial != "" {
+			r.SetPathValue("serial", tt.serial)
+		}
+		w := httptest.NewRecorder()
+		a.teamScoped(tt.rt, ok)(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
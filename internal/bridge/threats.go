@@ -0,0 +1,102 @@
+package bridge
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+const (
+	// threatAlertInterval is how long threat:detected stays quiet for a
+	// device and feed entry after alerting on it, so one malicious flow
+	// does not raise an alert per packet.
+	threatAlertInterval = 5 * time.Minute
+	// maxThreatAlerts is the number of remembered alerts past which
+	// expired ones are swept.
+	maxThreatAlerts = 10000
+)
+
+// threatAlert is the payload of threat:detected.
+type threatAlert struct {
+	Serial string `json:"serial"`
+	App    string `json:"app,omitempty"`
+	IP     string `json:"ip,omitempty"`
+	Host   string `json:"host,omitempty"`
+	// Threat names the feed and entry that matched.
+	Threat string `json:"threat"`
+	// Source is what matched: a "packet", a "connection", or a "hostname"
+	// learned after its IP was first seen.
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (a *App) checkPacketThreat(pkt capture.NetworkPacket) {
+	if !pkt.Malicious {
+		return
+	}
+	a.alertThreat(threatAlert{Serial: pkt.Serial, IP: pkt.DstIP, Host: pkt.HTTPHost,
+		Threat: pkt.Threat, Source: "packet", Timestamp: pkt.Timestamp})
+}
+
+func (a *App) checkConnectionThreat(conn capture.Connection) {
+	if !conn.Malicious {
+		return
+	}
+	a.alertThreat(threatAlert{Serial: conn.Serial, App: conn.AppName, IP: conn.RemoteIP, Host: conn.Hostname,
+		Threat: conn.Threat, Source: "connection", Timestamp: conn.LastSeen})
+}
+
+// checkHostnameThreat alerts when a hostname learned late is listed, since
+// the traffic to its IP was matched without it.
+func (a *App) checkHostnameThreat(u capture.HostnameUpdate) {
+	if a.threats == nil {
+		return
+	}
+	if hit, ok := a.threats.Match(u.IP, u.Hostname); ok {
+		a.alertThreat(threatAlert{Serial: u.Serial, IP: u.IP, Host: u.Hostname,
+			Threat: hit.String(), Source: "hostname", Timestamp: time.Now()})
+	}
+}
+
+// alertThreat broadcasts threat:detected unless the same device and entry
+// alerted within threatAlertInterval.
+func (a *App) alertThreat(t threatAlert) {
+	now := time.Now()
+	if t.Timestamp.IsZero() {
+		t.Timestamp = now
+	}
+	key := t.Serial + "\x00" + t.Threat
+
+	a.threatMu.Lock()
+	if last, ok := a.threatAlerts[key]; ok && now.Sub(last) < threatAlertInterval {
+		a.threatMu.Unlock()
+		return
+	}
+	a.threatAlerts[key] = now
+	if len(a.threatAlerts) > maxThreatAlerts {
+		for k, last := range a.threatAlerts {
+			if now.Sub(last) >= threatAlertInterval {
+				delete(a.threatAlerts, k)
+			}
+		}
+	}
+	a.threatMu.Unlock()
+
+	a.log.Warn("traffic matched threat feed", "serial", t.Serial, "ip", t.IP, "host", t.Host, "threat", t.Threat)
+	a.sse.Broadcast("threat:detected", t)
+}
+
+// ============================================
+// HTTP Handlers
+// ============================================
+
+func (a *App) handleGetThreatFeeds(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.threats.Status())
+}
+
+func (a *App) handleRefreshThreatFeeds(w http.ResponseWriter, r *http.Request) {
+	// Failures are reported per feed in the status.
+	a.threats.Load(r.Context())
+	writeJSON(w, http.StatusOK, a.threats.Status())
+}
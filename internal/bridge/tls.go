@@ -0,0 +1,118 @@
+package bridge
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/store"
+)
+
+const (
+	// tlsExpiryWarning is how close to expiry a server certificate raises
+	// tls:weak.
+	tlsExpiryWarning = 30 * 24 * time.Hour
+	// tlsAlertInterval is how long tls:weak stays quiet for a device,
+	// server and issue after alerting on it.
+	tlsAlertInterval = time.Hour
+	// maxTLSAlerts is the number of remembered alerts past which expired
+	// ones are swept.
+	maxTLSAlerts = 10000
+)
+
+// tlsAlert is the payload of tls:weak.
+type tlsAlert struct {
+	Serial string `json:"serial"`
+	// Issue is "deprecated_version", "certificate_expiring" or
+	// "certificate_expired".
+	Issue     string             `json:"issue"`
+	Detail    string             `json:"detail"`
+	Session   capture.TLSSession `json:"session"`
+	Timestamp time.Time          `json:"timestamp"`
+}
+
+func (a *App) drainTLSSessions(ch <-chan capture.TLSSession, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case s, ok := <-ch:
+			if !ok {
+				return
+			}
+			a.store.AddTLSSession(s)
+			a.checkTLSSession(s)
+		}
+	}
+}
+
+// checkTLSSession alerts on a handshake below TLS 1.2 and on a certificate
+// that expired or expires within tlsExpiryWarning.
+func (a *App) checkTLSSession(s capture.TLSSession) {
+	if s.Deprecated {
+		a.alertTLS(tlsAlert{Serial: s.Serial, Issue: "deprecated_version",
+			Detail: s.Version + " negotiated with " + tlsServerName(s), Session: s, Timestamp: s.Timestamp})
+	}
+	if c := s.Certificate; c != nil && !c.NotAfter.IsZero() {
+		left := c.NotAfter.Sub(s.Timestamp)
+		switch {
+		case left <= 0:
+			a.alertTLS(tlsAlert{Serial: s.Serial, Issue: "certificate_expired",
+				Detail:  fmt.Sprintf("certificate of %s expired on %s", tlsServerName(s), c.NotAfter.Format(time.DateOnly)),
+				Session: s, Timestamp: s.Timestamp})
+		case left < tlsExpiryWarning:
+			a.alertTLS(tlsAlert{Serial: s.Serial, Issue: "certificate_expiring",
+				Detail:  fmt.Sprintf("certificate of %s expires on %s", tlsServerName(s), c.NotAfter.Format(time.DateOnly)),
+				Session: s, Timestamp: s.Timestamp})
+		}
+	}
+}
+
+func tlsServerName(s capture.TLSSession) string {
+	if s.SNI != "" {
+		return s.SNI
+	}
+	return s.ServerIP
+}
+
+// alertTLS broadcasts tls:weak unless the same device, server and issue
+// alerted within tlsAlertInterval.
+func (a *App) alertTLS(t tlsAlert) {
+	now := time.Now()
+	key := t.Serial + "\x00" + tlsServerName(t.Session) + "\x00" + t.Issue
+
+	a.tlsMu.Lock()
+	if last, ok := a.tlsAlerts[key]; ok && now.Sub(last) < tlsAlertInterval {
+		a.tlsMu.Unlock()
+		return
+	}
+	a.tlsAlerts[key] = now
+	if len(a.tlsAlerts) > maxTLSAlerts {
+		for k, last := range a.tlsAlerts {
+			if now.Sub(last) >= tlsAlertInterval {
+				delete(a.tlsAlerts, k)
+			}
+		}
+	}
+	a.tlsMu.Unlock()
+
+	a.log.Warn("weak TLS", "serial", t.Serial, "issue", t.Issue, "detail", t.Detail)
+	a.sse.Broadcast("tls:weak", t)
+}
+
+// ============================================
+// HTTP Handlers
+// ============================================
+
+// handleGetDeviceTLS lists a device's observed TLS handshakes, newest
+// first. Query parameters: server, deprecated, n.
+func (a *App) handleGetDeviceTLS(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	writeJSON(w, http.StatusOK, a.store.TLSSessions(store.TLSQuery{
+		Serial:     r.PathValue("serial"),
+		Server:     q.Get("server"),
+		Deprecated: q.Get("deprecated") == "true",
+		Limit:      queryInt(r, "n", 200),
+	}))
+}
@@ -0,0 +1,67 @@
+package bridge
+
+import (
+	"net/http"
+
+	"github.com/imcanugur/go-adb-monitor/internal/correlate"
+)
+
+// handleListTraces lists the traced flows, newest first.
+// Query parameters: serial, host, from, to, complete, record (the ID of a
+// packet, DNS lookup or connection, to find its flow), n.
+func (a *App) handleListTraces(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var query correlate.Query
+	var err error
+	if query.From, err = parseTimeParam(q.Get("from")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	if query.To, err = parseTimeParam(q.Get("to")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+	query.Serial = q.Get("serial")
+	query.Host = q.Get("host")
+	query.Complete = q.Get("complete") == "true"
+	n := queryInt(r, "n", 200)
+
+	team := a.teamOf(r)
+
+	var flows []correlate.Flow
+	if record := q.Get("record"); record != "" {
+		flows = []correlate.Flow{}
+		if f, ok := a.traces.FlowOf(record); ok {
+			flows = append(flows, f)
+		}
+	} else {
+		if team == "" {
+			query.Limit = n
+		}
+		flows = a.traces.List(query)
+	}
+
+	// Team tokens see the flows of their devices only.
+	out := flows[:0]
+	for _, f := range flows {
+		if n > 0 && len(out) == n {
+			break
+		}
+		if team == "" || a.teams.Owns(team, f.Serial) {
+			out = append(out, f)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (a *App) handleGetTrace(w http.ResponseWriter, r *http.Request) {
+	f, ok := a.traces.Get(r.PathValue("id"))
+	if team := a.teamOf(r); ok && team != "" && !a.teams.Owns(team, f.Serial) {
+		ok = false
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "trace not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, f)
+}
@@ -0,0 +1,82 @@
+package bridge
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/store"
+)
+
+const (
+	// defaultTrafficWindow is the aggregation window when none is requested.
+	defaultTrafficWindow = 15 * time.Minute
+	// maxTrafficWindow bounds ?window= so a request cannot ask for more
+	// history than the ring buffer plausibly holds.
+	maxTrafficWindow = 24 * time.Hour
+	// trafficBroadcastInterval is how often stats:traffic is pushed over SSE.
+	trafficBroadcastInterval = 5 * time.Second
+)
+
+// handleGetTrafficStats serves aggregated traffic counters.
+// Query parameters: serial, window (Go duration, e.g. 5m), top.
+func (a *App) handleGetTrafficStats(w http.ResponseWriter, r *http.Request) {
+	window := defaultTrafficWindow
+	if s := r.URL.Query().Get("window"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 || d > maxTrafficWindow {
+			writeError(w, http.StatusBadRequest, "window must be a duration between 0 and 24h")
+			return
+		}
+		window = d
+	}
+
+	writeJSON(w, http.StatusOK, a.store.TrafficStats(store.TrafficQuery{
+		Serial: r.URL.Query().Get("serial"),
+		Window: window,
+		TopN:   queryInt(r, "top", store.DefaultTopN),
+	}))
+}
+
+// handleGetAppTraffic serves per-app and per-interface byte totals of a
+// running capture.
+func (a *App) handleGetAppTraffic(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+
+	a.mu.Lock()
+	dc, ok := a.captures[serial]
+	a.mu.Unlock()
+	if !ok {
+		writeErrorCode(w, http.StatusNotFound, codeCaptureNotRunning, "no active capture for "+serial)
+		return
+	}
+
+	snap, ok := dc.engine.Traffic()
+	if !ok {
+		// Nothing polled yet, or a tcpdump capture that has no socket view.
+		snap = capture.TrafficSnapshot{Serial: serial, Apps: []capture.AppTraffic{}, Interfaces: []capture.InterfaceTraffic{}}
+	}
+	writeJSON(w, http.StatusOK, snap)
+}
+
+// broadcastTraffic periodically pushes stats:traffic to dashboard clients.
+// Nothing is computed while no SSE client is connected.
+func (a *App) broadcastTraffic(ctx context.Context) {
+	ticker := time.NewTicker(trafficBroadcastInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if a.sse.ClientCount() == 0 {
+				continue
+			}
+			a.sse.Broadcast("stats:traffic", a.store.TrafficStats(store.TrafficQuery{
+				Window: defaultTrafficWindow,
+			}))
+		}
+	}
+}
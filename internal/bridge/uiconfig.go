@@ -0,0 +1,142 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// uiStatusInterval is how often the dashboard polls the status bar
+	// counters.
+	uiStatusInterval = 2 * time.Second
+	// uiMaxTableRows caps the rows the dashboard keeps per table.
+	uiMaxTableRows = 2000
+
+	// uiConfigPlaceholder marks where index.html gets the config. Without
+	// it the config goes right after <head>.
+	uiConfigPlaceholder = "<!-- ui-config -->"
+)
+
+// uiConfig is what the dashboard needs to know about the server before its
+// first request. It is served by GET /api/ui-config and injected into
+// index.html as window.ADB_MONITOR_CONFIG.
+type uiConfig struct {
+	// BasePath is the path prefix the dashboard is served under ("" at
+	// the root), and APIBase the prefix of every API request.
+	BasePath string `json:"base_path"`
+	APIBase  string `json:"api_base"`
+	Auth     uiAuth `json:"auth"`
+	ReadOnly bool   `json:"read_only"`
+	// Features says which optional parts of the server are enabled.
+	Features map[string]bool `json:"features"`
+	Polling  uiPolling       `json:"polling"`
+}
+
+// uiAuth describes how the dashboard authenticates.
+type uiAuth struct {
+	// Mode is "token" when the API needs a token, otherwise "none".
+	Mode string `json:"mode"`
+	// Teams is set when team tokens exist, which see a subset of devices.
+	Teams bool `json:"teams"`
+	// Admin is set when device control accepts an admin token.
+	Admin bool `json:"admin"`
+}
+
+// uiPolling holds hints on how often the dashboard refreshes what SSE does
+// not push.
+type uiPolling struct {
+	StatusIntervalMs int64 `json:"status_interval_ms"`
+	HealthIntervalMs int64 `json:"health_interval_ms"`
+	// PacketBatchMs is how often packets:batch arrives.
+	PacketBatchMs int64 `json:"packet_batch_ms"`
+	MaxTableRows  int   `json:"max_table_rows"`
+}
+
+// uiConfigFor builds the config for a request: the base path is the
+// server's own, under the prefix a reverse proxy strips, which
+// X-Forwarded-Prefix names.
+func (a *App) uiConfigFor(r *http.Request) uiConfig {
+	base := forwardedPrefix(r) + a.basePath
+	auth := "none"
+	if a.authRequired {
+		auth = "token"
+	}
+	return uiConfig{
+		BasePath: base,
+		APIBase:  base + "/api",
+		Auth:     uiAuth{Mode: auth, Teams: len(a.teams.Names()) > 0, Admin: a.adminToken != ""},
+		ReadOnly: a.readOnly,
+		Features: map[string]bool{
+			"graphql":          a.graphqlEnabled,
+			"screen_recording": a.downloads.Dir() != "",
+			"device_control":   a.adminToken != "",
+			"anomalies":        a.anomalies != nil,
+			"threats":          a.threats != nil,
+		},
+		Polling: uiPolling{
+			StatusIntervalMs: uiStatusInterval.Milliseconds(),
+			HealthIntervalMs: healthProbeInterval.Milliseconds(),
+			PacketBatchMs:    a.batcher.interval.Milliseconds(),
+			MaxTableRows:     uiMaxTableRows,
+		},
+	}
+}
+
+// forwardedPrefix returns the cleaned X-Forwarded-Prefix of r, without a
+// trailing slash, or "" if there is none or it is not a plain path.
+func forwardedPrefix(r *http.Request) string {
+	p := r.Header.Get("X-Forwarded-Prefix")
+	if p == "" || !strings.HasPrefix(p, "/") || strings.ContainsAny(p, "\"'<>\\?#") {
+		return ""
+	}
+	p = path.Clean(p)
+	if p == "/" {
+		return ""
+	}
+	return p
+}
+
+func (a *App) handleGetUIConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.uiConfigFor(r))
+}
+
+// FrontendHandler serves the dashboard files of ui. index.html gets the
+// config of the request injected, with a <base> for its path prefix, so
+// the same files work at the root and behind a reverse proxy.
+func (a *App) FrontendHandler(ui fs.FS) http.Handler {
+	files := http.FileServer(http.FS(ui))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" && r.URL.Path != "/index.html" {
+			files.ServeHTTP(w, r)
+			return
+		}
+		page, err := fs.ReadFile(ui, "index.html")
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		cfg := a.uiConfigFor(r)
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		// json.Marshal escapes <, > and &, so data cannot end the script.
+		inject := []byte(`<base href="` + html.EscapeString(cfg.BasePath) + `/">` +
+			"\n    <script>window.ADB_MONITOR_CONFIG = " + string(data) + ";</script>")
+		if bytes.Contains(page, []byte(uiConfigPlaceholder)) {
+			page = bytes.Replace(page, []byte(uiConfigPlaceholder), inject, 1)
+		} else {
+			page = bytes.Replace(page, []byte("<head>"), append([]byte("<head>\n    "), inject...), 1)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(page)
+	})
+}
@@ -0,0 +1,56 @@
+package capture
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// NormalizeIP returns the canonical text form of an IP address, so that the
+// same address reported by /proc/net, ss, netstat, tcpdump and logcat is
+// stored, filtered and deduplicated under one key: IPv4-mapped IPv6
+// addresses become plain IPv4, IPv6 is compressed and lower-case (RFC 5952),
+// and brackets and zones are dropped. Anything that is not an address is
+// returned unchanged.
+func NormalizeIP(s string) string {
+	if a, ok := parseIP(s); ok {
+		return a.String()
+	}
+	return s
+}
+
+// parseIP parses an address in any of the spellings the capture sources
+// use, unmapped and without zone.
+func parseIP(s string) (netip.Addr, bool) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return a.Unmap().WithZone(""), true
+}
+
+// isLoopback reports whether ip is a loopback address (127.0.0.0/8, ::1,
+// or either mapped into IPv6).
+func isLoopback(ip string) bool {
+	a, ok := parseIP(ip)
+	return ok && a.IsLoopback()
+}
+
+// isUnspecified reports whether ip is 0.0.0.0 or ::.
+func isUnspecified(ip string) bool {
+	a, ok := parseIP(ip)
+	return ok && a.IsUnspecified()
+}
+
+// isPrivateIP reports whether ip is private (RFC 1918, fc00::/7), loopback
+// or link-local, i.e. not worth resolving to a public hostname.
+func isPrivateIP(ip string) bool {
+	a, ok := parseIP(ip)
+	return ok && (a.IsPrivate() || a.IsLoopback() || a.IsLinkLocalUnicast())
+}
+
+// isIP reports whether s parses as an IP address.
+func isIP(s string) bool {
+	_, ok := parseIP(s)
+	return ok
+}
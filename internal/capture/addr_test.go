@@ -0,0 +1,51 @@
+package capture
+
+import "testing"
+
+func TestNormalizeIP(t *testing.T) {
+	tests := map[string]string{
+		"10.0.2.15":                "10.0.2.15",
+		"::ffff:10.0.2.15":         "10.0.2.15",
+		"2001:DB8:0:0:0:0:0:15":    "2001:db8::15",
+		"[2607:f8b0:4004:c07::6a]": "2607:f8b0:4004:c07::6a",
+		"fe80::1%wlan0":            "fe80::1",
+		"not-an-ip":                "not-an-ip",
+		"":                         "",
+	}
+	for in, want := range tests {
+		if got := NormalizeIP(in); got != want {
+			t.Errorf("NormalizeIP(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAddressClasses(t *testing.T) {
+	tests := []struct {
+		ip                             string
+		loopback, private, unspecified bool
+	}{
+		{"127.0.0.1", true, true, false},
+		{"::ffff:127.0.0.1", true, true, false},
+		{"::1", true, true, false},
+		{"192.168.1.10", false, true, false},
+		{"::ffff:10.1.2.3", false, true, false},
+		{"fd00::1", false, true, false},
+		{"fe80::1%wlan0", false, true, false},
+		{"8.8.8.8", false, false, false},
+		{"2001:4860:4860::8888", false, false, false},
+		{"0.0.0.0", false, false, true},
+		{"::", false, false, true},
+		{"garbage", false, false, false},
+	}
+	for _, tt := range tests {
+		if got := isLoopback(tt.ip); got != tt.loopback {
+			t.Errorf("isLoopback(%q) = %v", tt.ip, got)
+		}
+		if got := isPrivateIP(tt.ip); got != tt.private {
+			t.Errorf("isPrivateIP(%q) = %v", tt.ip, got)
+		}
+		if got := isUnspecified(tt.ip); got != tt.unspecified {
+			t.Errorf("isUnspecified(%q) = %v", tt.ip, got)
+		}
+	}
+}
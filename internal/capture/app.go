@@ -0,0 +1,223 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/inventory"
+)
+
+const (
+	// appTrackInterval is how often an app capture re-reads the app's
+	// sockets and processes.
+	appTrackInterval = 2 * time.Second
+
+	// appFilterRefresh is how long tcpdump runs on once the app has a
+	// socket its filter misses, before it restarts with a new filter, so a
+	// burst of new sockets costs one restart.
+	appFilterRefresh = 5 * time.Second
+
+	// appNoPorts is the tcpdump filter while the app has no sockets: port
+	// 0 is never used, so it matches nothing.
+	appNoPorts = "port 0"
+)
+
+// appScope restricts a capture to one app: its connections by UID, its
+// packets by the local ports of its sockets and its logged URLs by the
+// PIDs of its processes.
+type appScope struct {
+	pkg string
+
+	mu    sync.RWMutex
+	uid   int
+	ports map[uint16]struct{}
+	pids  map[int]struct{}
+	// filtered are the ports the running tcpdump filter covers; grown is
+	// closed when the app opens a socket on another port.
+	filtered map[uint16]struct{}
+	grown    chan struct{}
+}
+
+func newAppScope(pkg string) *appScope {
+	return &appScope{pkg: pkg, uid: -1, grown: make(chan struct{})}
+}
+
+// SetApp restricts the capture to the app with package name pkg; "" lifts
+// the restriction. Call before Run.
+func (e *Engine) SetApp(pkg string) {
+	e.app = nil
+	if pkg != "" {
+		e.app = newAppScope(pkg)
+	}
+	e.updateStats(func(s *CaptureStats) { s.App = pkg })
+}
+
+// resolveApp looks up the UID of the captured app.
+func (e *Engine) resolveApp(ctx context.Context) error {
+	shellCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	// pm filters by substring, so pick the exact name out of the list.
+	out, err := e.shell(shellCtx, "pm list packages -U "+e.app.pkg+" 2>/dev/null")
+	if err != nil {
+		return fmt.Errorf("looking up %s: %w", e.app.pkg, err)
+	}
+	for _, p := range inventory.ParseList(out) {
+		if p.Name == e.app.pkg && p.UID >= 0 {
+			e.app.mu.Lock()
+			e.app.uid = p.UID
+			e.app.mu.Unlock()
+			e.updateStats(func(s *CaptureStats) { s.AppUID = p.UID })
+			return nil
+		}
+	}
+	return fmt.Errorf("app %s is not installed", e.app.pkg)
+}
+
+// trackApp refreshes the app's ports and processes every
+// appTrackInterval until ctx is done.
+func (e *Engine) trackApp(ctx context.Context, parser *ProcNetParser, ports bool) {
+	ticker := time.NewTicker(appTrackInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.refreshApp(ctx, parser, ports)
+		}
+	}
+}
+
+// refreshApp reads the app's processes and, when ports is set (for packet
+// captures), the local ports of its sockets.
+func (e *Engine) refreshApp(ctx context.Context, parser *ProcNetParser, ports bool) {
+	readCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if ports {
+		if conns, ok := e.readProcNet(readCtx, parser); ok {
+			e.app.setPorts(conns)
+		}
+	}
+	if out, err := e.shell(readCtx, "ps -A -o PID,NAME 2>/dev/null || ps"); err == nil {
+		e.app.setPIDs(parseAppPIDs(out, e.app.pkg))
+	}
+}
+
+// parseAppPIDs returns the PIDs of pkg's processes, named pkg or
+// pkg:<name>, in ps output with or without -o PID,NAME.
+func parseAppPIDs(out, pkg string) map[int]struct{} {
+	pids := make(map[int]struct{})
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Fields(line)
+		if len(f) < 2 {
+			continue
+		}
+		name := f[len(f)-1]
+		if name != pkg && !strings.HasPrefix(name, pkg+":") {
+			continue
+		}
+		// The PID is the first number: before the name with -o, after the
+		// user without.
+		for _, tok := range f[:len(f)-1] {
+			if pid, err := strconv.Atoi(tok); err == nil && pid > 0 {
+				pids[pid] = struct{}{}
+				break
+			}
+		}
+	}
+	return pids
+}
+
+// setPorts sets the app's ports to the local ports of its sockets among
+// conns.
+func (a *appScope) setPorts(conns []Connection) {
+	ports := make(map[uint16]struct{})
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, c := range conns {
+		if c.UID == a.uid && c.LocalPort != 0 {
+			ports[c.LocalPort] = struct{}{}
+		}
+	}
+	a.ports = ports
+	for p := range ports {
+		if _, ok := a.filtered[p]; !ok {
+			select {
+			case <-a.grown:
+			default:
+				close(a.grown)
+			}
+			return
+		}
+	}
+}
+
+func (a *appScope) setPIDs(pids map[int]struct{}) {
+	a.mu.Lock()
+	a.pids = pids
+	a.mu.Unlock()
+}
+
+// filter returns a tcpdump filter for the app's current ports, and a
+// channel closed once the app has a socket on a port it doesn't cover.
+func (a *appScope) filter() (string, <-chan struct{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.filtered = make(map[uint16]struct{}, len(a.ports))
+	for p := range a.ports {
+		a.filtered[p] = struct{}{}
+	}
+	a.grown = make(chan struct{})
+	return appPortFilter(a.ports), a.grown
+}
+
+// appPortFilter returns a tcpdump filter matching TCP and UDP packets on
+// any of ports.
+func appPortFilter(ports map[uint16]struct{}) string {
+	if len(ports) == 0 {
+		return appNoPorts
+	}
+	sorted := make([]int, 0, len(ports))
+	for p := range ports {
+		sorted = append(sorted, int(p))
+	}
+	slices.Sort(sorted)
+	terms := make([]string, len(sorted))
+	for i, p := range sorted {
+		terms[i] = "port " + strconv.Itoa(p)
+	}
+	return "(tcp or udp) and (" + strings.Join(terms, " or ") + ")"
+}
+
+// ownsConnection reports whether c is a socket of the app.
+func (a *appScope) ownsConnection(c *Connection) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return c.UID == a.uid
+}
+
+// ownsPacket reports whether pkt was sent by the app, if the capture knows
+// its UID, or else sent or received on one of the app's ports.
+func (a *appScope) ownsPacket(pkt *NetworkPacket) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if pkt.UID > 0 {
+		return pkt.UID == a.uid
+	}
+	_, src := a.ports[pkt.SrcPort]
+	_, dst := a.ports[pkt.DstPort]
+	return src || dst
+}
+
+// ownsPID reports whether pid is one of the app's processes.
+func (a *appScope) ownsPID(pid int) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	_, ok := a.pids[pid]
+	return ok
+}
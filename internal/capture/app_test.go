@@ -0,0 +1,79 @@
+package capture
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestParseAppPIDs(t *testing.T) {
+	withO := `  PID NAME
+ 1234 com.example.app
+ 1240 com.example.app:push
+ 1250 com.example.application
+`
+	legacy := `USER     PID   PPID  VSIZE  RSS     WCHAN    PC         NAME
+u0_a61    1234  190   1000   100   ffffffff 00000000 S com.example.app
+u0_a62    1300  190   1000   100   ffffffff 00000000 S com.other
+`
+	if got := parseAppPIDs(withO, "com.example.app"); len(got) != 2 {
+		t.Errorf("ps -o: got %v", got)
+	}
+	if got := parseAppPIDs(legacy, "com.example.app"); len(got) != 1 {
+		t.Errorf("legacy ps: got %v", got)
+	} else if _, ok := got[1234]; !ok {
+		t.Errorf("legacy ps: got %v, want 1234", got)
+	}
+}
+
+func TestAppScope(t *testing.T) {
+	a := newAppScope("com.example.app")
+	a.uid = 10061
+
+	if f, _ := a.filter(); f != appNoPorts {
+		t.Errorf("filter without sockets: %q", f)
+	}
+	conns := []Connection{
+		{UID: 10061, LocalPort: 40002},
+		{UID: 10061, LocalPort: 40001},
+		{UID: 10062, LocalPort: 50000},
+	}
+	a.setPorts(conns)
+	f, grown := a.filter()
+	if f != "(tcp or udp) and (port 40001 or port 40002)" {
+		t.Errorf("filter: %q", f)
+	}
+
+	// Ports the filter covers don't call for a restart; a new one does.
+	a.setPorts(conns[:1])
+	select {
+	case <-grown:
+		t.Error("filter grown without new ports")
+	default:
+	}
+	a.setPorts(append(conns, Connection{UID: 10061, LocalPort: 40003}))
+	select {
+	case <-grown:
+	default:
+		t.Error("filter not grown for a new port")
+	}
+
+	if !a.ownsPacket(&NetworkPacket{SrcPort: 443, DstPort: 40003}) || a.ownsPacket(&NetworkPacket{SrcPort: 50000, DstPort: 443}) {
+		t.Error("packets matched to the wrong app")
+	}
+	if !a.ownsConnection(&conns[0]) || a.ownsConnection(&conns[2]) {
+		t.Error("connections matched to the wrong app")
+	}
+}
+
+func TestLogcatSnooper_URLPID(t *testing.T) {
+	s := NewLogcatSnooper(nil, slog.Default(), "dev1")
+	s.parseLine("D/OkHttp( 1234): --> GET https://api.example.com/v1/items")
+	select {
+	case cap := <-s.URLs():
+		if cap.PID != 1234 || cap.URL != "https://api.example.com/v1/items" {
+			t.Errorf("capture: %+v", cap)
+		}
+	default:
+		t.Fatal("no URL captured")
+	}
+}
@@ -0,0 +1,227 @@
+package capture
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DropPolicy says what the engine does with an item when the channel it
+// goes to is full because the consumer fell behind.
+type DropPolicy int
+
+const (
+	// DropNewest discards the item being sent.
+	DropNewest DropPolicy = iota
+	// DropOldest discards the oldest queued item to make room.
+	DropOldest
+	// Block waits up to blockTimeout for room, slowing the capture stream
+	// down, then discards the item being sent.
+	Block
+)
+
+// String returns the name accepted by ParseDropPolicy.
+func (p DropPolicy) String() string {
+	switch p {
+	case DropOldest:
+		return "drop-oldest"
+	case Block:
+		return "block"
+	default:
+		return "drop-newest"
+	}
+}
+
+// ParseDropPolicy converts "drop-newest", "drop-oldest" or "block" to a
+// DropPolicy. The empty string means DropNewest.
+func ParseDropPolicy(s string) (DropPolicy, error) {
+	switch s {
+	case "", "drop-newest":
+		return DropNewest, nil
+	case "drop-oldest":
+		return DropOldest, nil
+	case "block":
+		return Block, nil
+	default:
+		return DropNewest, fmt.Errorf("unknown drop policy %q (want drop-newest, drop-oldest or block)", s)
+	}
+}
+
+const (
+	// DefaultBufferSize is the length of each output channel of an engine.
+	DefaultBufferSize = 512
+	// MaxBufferSize bounds BufferConfig.Size; a packet channel this long
+	// holds a few hundred megabytes at worst.
+	MaxBufferSize = 1 << 20
+
+	// blockTimeout bounds the wait of the Block policy.
+	blockTimeout = 100 * time.Millisecond
+	// backpressureInterval is the least time between two
+	// capture:backpressure events of one channel.
+	backpressureInterval = 5 * time.Second
+)
+
+// BufferConfig sizes the output channels of an engine and says what
+// happens when one is full.
+type BufferConfig struct {
+	// Size is the length of each channel; DefaultBufferSize if zero.
+	Size   int
+	Policy DropPolicy
+}
+
+// Output channels of an engine, as named in DropStats and
+// BackpressureEvent.
+const (
+	outPackets           = "packets"
+	outConnections       = "connections"
+	outClosedConnections = "closed_connections"
+	outDNSLookups        = "dns_lookups"
+)
+
+// DropStats counts the items each output channel lost to the drop policy.
+type DropStats struct {
+	Packets           int64 `json:"packets"`
+	Connections       int64 `json:"connections"`
+	ClosedConnections int64 `json:"closed_connections"`
+	DNSLookups        int64 `json:"dns_lookups"`
+}
+
+func (d *DropStats) add(out string, n int64) {
+	switch out {
+	case outPackets:
+		d.Packets += n
+	case outConnections:
+		d.Connections += n
+	case outClosedConnections:
+		d.ClosedConnections += n
+	case outDNSLookups:
+		d.DNSLookups += n
+	}
+}
+
+// BackpressureEvent reports that an output channel of a capture was full.
+// It is sent at most every backpressureInterval per channel and counts
+// what happened since the previous one.
+type BackpressureEvent struct {
+	Serial string `json:"serial"`
+	// Channel is "packets", "connections", "closed_connections" or
+	// "dns_lookups".
+	Channel  string `json:"channel"`
+	Policy   string `json:"policy"`
+	Capacity int    `json:"capacity"`
+	// Full counts the sends that found the channel full, Dropped the items
+	// lost to them. With DropOldest the lost items are older ones; with
+	// Block a send that found room in time loses nothing.
+	Full      int64     `json:"full"`
+	Dropped   int64     `json:"dropped"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Backpressure returns the channel announcing full output channels.
+func (e *Engine) Backpressure() <-chan BackpressureEvent {
+	return e.backpressureCh
+}
+
+// SetBuffer sizes the output channels and sets the drop policy. Call
+// before Run and before taking any of the channels.
+func (e *Engine) SetBuffer(cfg BufferConfig) {
+	size := cfg.Size
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	size = min(size, MaxBufferSize)
+	e.policy = cfg.Policy
+	e.packetCh = make(chan NetworkPacket, size)
+	e.connCh = make(chan Connection, size)
+	e.closedCh = make(chan Connection, size)
+	e.dnsCh = make(chan DNSLookup, size)
+	e.updateStats(func(s *CaptureStats) { s.BufferSize, s.DropPolicy = size, cfg.Policy.String() })
+}
+
+// pressure accumulates the counts of the next BackpressureEvent of one
+// channel.
+type pressure struct {
+	full, dropped int64
+	last          time.Time
+}
+
+// backpressure tracks full channels between BackpressureEvents.
+type backpressure struct {
+	mu  sync.Mutex
+	out map[string]*pressure
+}
+
+// send hands v to ch under the engine's drop policy, counting what it
+// drops in the drops of out.
+func send[T any](e *Engine, ch chan T, v T, out string) {
+	select {
+	case ch <- v:
+		return
+	default:
+	}
+
+	dropped := int64(1)
+	switch e.policy {
+	case DropOldest:
+		dropped = 0
+		for sent := false; !sent; {
+			select {
+			case <-ch:
+				dropped++
+			default:
+			}
+			select {
+			case ch <- v:
+				sent = true
+			default:
+			}
+		}
+	case Block:
+		t := time.NewTimer(blockTimeout)
+		select {
+		case ch <- v:
+			dropped = 0
+		case <-t.C:
+		}
+		t.Stop()
+	}
+	e.full(out, cap(ch), dropped)
+}
+
+// full records a send that found out full and sends a BackpressureEvent
+// when the previous one of out is old enough.
+func (e *Engine) full(out string, capacity int, dropped int64) {
+	if dropped > 0 {
+		e.updateStats(func(s *CaptureStats) { s.Drops.add(out, dropped) })
+	}
+
+	now := time.Now()
+	e.pressure.mu.Lock()
+	p := e.pressure.out[out]
+	if p == nil {
+		p = &pressure{}
+		e.pressure.out[out] = p
+	}
+	p.full++
+	p.dropped += dropped
+	if now.Sub(p.last) < backpressureInterval {
+		e.pressure.mu.Unlock()
+		return
+	}
+	ev := BackpressureEvent{
+		Serial:    e.serial,
+		Channel:   out,
+		Policy:    e.policy.String(),
+		Capacity:  capacity,
+		Full:      p.full,
+		Dropped:   p.dropped,
+		Timestamp: now,
+	}
+	p.full, p.dropped, p.last = 0, 0, now
+	e.pressure.mu.Unlock()
+
+	select {
+	case e.backpressureCh <- ev:
+	default:
+	}
+}
@@ -0,0 +1,82 @@
+package capture
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSend_DropPolicies(t *testing.T) {
+	tests := []struct {
+		policy      DropPolicy
+		wantQueued  []int
+		wantDropped int64
+	}{
+		{DropNewest, []int{0, 1}, 3},
+		{DropOldest, []int{3, 4}, 3},
+		{Block, []int{0, 1}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			e := newTestEngine()
+			e.SetBuffer(BufferConfig{Size: 2, Policy: tt.policy})
+			for i := range 5 {
+				send(e, e.connCh, Connection{LocalPort: uint16(i)}, outConnections)
+			}
+
+			var got []int
+			for len(e.connCh) > 0 {
+				got = append(got, int((<-e.connCh).LocalPort))
+			}
+			if len(got) != len(tt.wantQueued) || got[0] != tt.wantQueued[0] || got[1] != tt.wantQueued[1] {
+				t.Errorf("queued = %v, want %v", got, tt.wantQueued)
+			}
+			st := e.Stats()
+			if st.Drops.Connections != tt.wantDropped || st.BufferSize != 2 || st.DropPolicy != tt.policy.String() {
+				t.Errorf("stats = %+v", st)
+			}
+
+			// Only the first full send announces itself within the interval,
+			// with the drops of that send.
+			select {
+			case ev := <-e.Backpressure():
+				if ev.Channel != outConnections || ev.Capacity != 2 || ev.Full != 1 || ev.Dropped != 1 {
+					t.Errorf("event = %+v", ev)
+				}
+			default:
+				t.Fatal("no backpressure event")
+			}
+			if len(e.Backpressure()) != 0 {
+				t.Error("backpressure events not throttled")
+			}
+		})
+	}
+}
+
+func TestSend_BlockWaitsForRoom(t *testing.T) {
+	e := newTestEngine()
+	e.SetBuffer(BufferConfig{Size: 1, Policy: Block})
+	send(e, e.packetCh, NetworkPacket{ID: "a"}, outPackets)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-e.packetCh
+	}()
+	send(e, e.packetCh, NetworkPacket{ID: "b"}, outPackets)
+	if p := <-e.packetCh; p.ID != "b" {
+		t.Errorf("queued %q, want b", p.ID)
+	}
+	if st := e.Stats(); st.Drops.Packets != 0 {
+		t.Errorf("dropped %d packets", st.Drops.Packets)
+	}
+}
+
+func TestParseDropPolicy(t *testing.T) {
+	for _, p := range []DropPolicy{DropNewest, DropOldest, Block} {
+		if got, err := ParseDropPolicy(p.String()); err != nil || got != p {
+			t.Errorf("ParseDropPolicy(%q) = %v, %v", p, got, err)
+		}
+	}
+	if _, err := ParseDropPolicy("drop-all"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
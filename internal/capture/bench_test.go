@@ -0,0 +1,56 @@
+package capture
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+)
+
+func loadCorpus(tb testing.TB, name string) string {
+	tb.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return string(data)
+}
+
+func BenchmarkTcpdumpParser_ParseLine(b *testing.B) {
+	lines := strings.Split(loadCorpus(b, "tcpdump.txt"), "\n")
+	p := NewTcpdumpParser("emulator-5554")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.ParseLine(lines[i%len(lines)])
+	}
+}
+
+func BenchmarkTcpdumpParser_ParseStream(b *testing.B) {
+	corpus := loadCorpus(b, "tcpdump.txt")
+	p := NewTcpdumpParser("emulator-5554")
+	done := make(chan struct{})
+
+	b.SetBytes(int64(len(corpus)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out := make(chan NetworkPacket, 1024)
+		p.ParseStream(bufio.NewScanner(strings.NewReader(corpus)), out, done)
+	}
+}
+
+func BenchmarkProcNetParser_ParseProcNet(b *testing.B) {
+	tcp := loadCorpus(b, "proc_net_tcp.txt")
+	tcp6 := loadCorpus(b, "proc_net_tcp6.txt")
+	p := NewProcNetParser("emulator-5554")
+
+	b.SetBytes(int64(len(tcp) + len(tcp6)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.ParseProcNet(tcp, ProtoTCP)
+		p.ParseProcNet(tcp6, ProtoTCP)
+	}
+}
@@ -0,0 +1,52 @@
+package capture
+
+import (
+	"fmt"
+	"time"
+)
+
+// EndpointKey identifies a connection by its endpoints rather than its ID,
+// so a restarted capture, which assigns new IDs, is still recognized.
+func (c Connection) EndpointKey() string {
+	return fmt.Sprintf("%s|%s|%s:%d|%s:%d", c.Serial, c.Protocol, c.LocalIP, c.LocalPort, c.RemoteIP, c.RemotePort)
+}
+
+// ConnCounters turns the running byte counters captures report on
+// connections into the traffic since the previous report. The zero value is
+// ready to use; it is not safe for concurrent use.
+type ConnCounters struct {
+	conns map[string]connCounter // EndpointKey -> counters
+}
+
+// connCounter is the last byte counter seen on a connection.
+type connCounter struct {
+	bytes    uint64
+	lastSeen time.Time
+}
+
+// Observe records the counters of c, seen at now. It returns how many bytes
+// they grew by since c was last observed, and whether it was observed
+// before. A counter that went backwards counts no bytes.
+func (cc *ConnCounters) Observe(c Connection, now time.Time) (bytes int64, known bool) {
+	if cc.conns == nil {
+		cc.conns = make(map[string]connCounter)
+	}
+	total := c.BytesSent + c.BytesReceived
+	k := c.EndpointKey()
+	prev, known := cc.conns[k]
+	cc.conns[k] = connCounter{bytes: total, lastSeen: now}
+	if total > prev.bytes {
+		bytes = int64(total - prev.bytes)
+	}
+	return bytes, known
+}
+
+// Forget drops the connections not observed for longer than idle before
+// now, so that the counters of closed connections do not pile up.
+func (cc *ConnCounters) Forget(now time.Time, idle time.Duration) {
+	for k, c := range cc.conns {
+		if now.Sub(c.lastSeen) > idle {
+			delete(cc.conns, k)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package capture
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnCounters(t *testing.T) {
+	var cc ConnCounters
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := Connection{ID: "a", Serial: "dev1", Protocol: ProtoTCP, LocalIP: "10.0.0.2", LocalPort: 40000,
+		RemoteIP: "1.1.1.1", RemotePort: 443, BytesSent: 100, BytesReceived: 50}
+
+	if bytes, known := cc.Observe(c, t0); bytes != 150 || known {
+		t.Errorf("first sighting: %d bytes, known %v; want 150, false", bytes, known)
+	}
+	c.BytesReceived = 250
+	if bytes, known := cc.Observe(c, t0.Add(time.Second)); bytes != 200 || !known {
+		t.Errorf("growth: %d bytes, known %v; want 200, true", bytes, known)
+	}
+	// A restarted capture reports the same connection under a new ID.
+	c.ID = "b"
+	if bytes, known := cc.Observe(c, t0.Add(2*time.Second)); bytes != 0 || !known {
+		t.Errorf("new ID: %d bytes, known %v; want 0, true", bytes, known)
+	}
+	c.BytesSent, c.BytesReceived = 10, 0
+	if bytes, _ := cc.Observe(c, t0.Add(3*time.Second)); bytes != 0 {
+		t.Errorf("counter reset: %d bytes, want 0", bytes)
+	}
+
+	cc.Forget(t0.Add(time.Hour), time.Minute)
+	if _, known := cc.Observe(c, t0.Add(time.Hour)); known {
+		t.Error("idle connection was not forgotten")
+	}
+}
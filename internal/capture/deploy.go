@@ -0,0 +1,281 @@
+package capture
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+// tcpdumpKillTimeout bounds killing a tcpdump process when its stream is
+// closed.
+const tcpdumpKillTimeout = 5 * time.Second
+
+// deployedTcpdumpPath is where a bundled tcpdump is pushed. /data/local/tmp
+// is writable and executable for the shell user on every Android release.
+const deployedTcpdumpPath = "/data/local/tmp/tcpdump"
+
+// rootAccess is how the engine can run a command as root.
+type rootAccess int
+
+const (
+	// rootNone: neither adbd nor su gives root.
+	rootNone rootAccess = iota
+	// rootShell: adbd already runs as root (`adb root`, many emulators).
+	rootShell
+	// rootSuC: su -c "command" (Magisk, SuperSU).
+	rootSuC
+	// rootSu0: su 0 command (AOSP userdebug su).
+	rootSu0
+)
+
+func (r rootAccess) String() string {
+	switch r {
+	case rootShell:
+		return "adbd"
+	case rootSuC:
+		return "su -c"
+	case rootSu0:
+		return "su 0"
+	default:
+		return "none"
+	}
+}
+
+// wrap returns command as it must be run to get root.
+func (r rootAccess) wrap(command string) string {
+	switch r {
+	case rootSuC:
+		return "su -c " + adb.ShellQuote(command)
+	case rootSu0:
+		return "su 0 sh -c " + adb.ShellQuote(command)
+	default:
+		return command
+	}
+}
+
+// TcpdumpBinaryName returns the file name under which a static tcpdump for
+// the given ABI (ro.product.cpu.abi) is bundled, or "" for unknown ABIs.
+func TcpdumpBinaryName(abi string) string {
+	switch abi {
+	case "arm64-v8a":
+		return "tcpdump-arm64"
+	case "armeabi-v7a", "armeabi":
+		return "tcpdump-arm"
+	case "x86_64":
+		return "tcpdump-x86_64"
+	case "x86":
+		return "tcpdump-x86"
+	default:
+		return ""
+	}
+}
+
+// detectRoot finds out how commands can be run as root, trying the adbd
+// user first and then both su dialects.
+func (e *Engine) detectRoot(ctx context.Context) rootAccess {
+	for _, r := range []rootAccess{rootShell, rootSuC, rootSu0} {
+		out, err := e.client.Shell(ctx, e.serial, r.wrap("id -u")+" 2>/dev/null")
+		if err == nil && strings.TrimSpace(out) == "0" {
+			return r
+		}
+	}
+	return rootNone
+}
+
+// prepareTcpdump works out how to run tcpdump on the device: an installed
+// binary, or the bundled one pushed to /data/local/tmp, under su when the
+// shell user is not root. It reports false when tcpdump cannot be run.
+func (e *Engine) prepareTcpdump(ctx context.Context) bool {
+	checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := e.client.ShellV2(checkCtx, e.serial, "which tcpdump 2>/dev/null || command -v tcpdump 2>/dev/null")
+	installed := err == nil && res.Err() == nil && res.Stdout != ""
+	root := e.detectRoot(checkCtx)
+
+	if installed {
+		// An installed tcpdump may carry file capabilities, so it is used
+		// even without root; su is only added when it is there.
+		e.log.Info("tcpdump available on device", "path", strings.TrimSpace(res.Stdout), "root", root)
+		e.tcpdumpPath, e.root = "tcpdump", root
+		return true
+	}
+	if root == rootNone {
+		return false
+	}
+	if e.tcpdumpBins == nil {
+		e.log.Info("device has root but no tcpdump, and no bundled binaries are configured", "root", root)
+		return false
+	}
+
+	deployCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	if err := e.deployTcpdump(deployCtx, root); err != nil {
+		e.log.Warn("deploying bundled tcpdump failed", "error", err)
+		return false
+	}
+	e.tcpdumpPath, e.root = deployedTcpdumpPath, root
+	return true
+}
+
+// deployTcpdump pushes the bundled tcpdump matching the device's ABI,
+// unless an identical-sized copy is already there, and checks that it runs.
+func (e *Engine) deployTcpdump(ctx context.Context, root rootAccess) error {
+	abi, err := e.client.GetDeviceProp(ctx, e.serial, "ro.product.cpu.abi")
+	if err != nil {
+		return err
+	}
+	name := TcpdumpBinaryName(abi)
+	if name == "" {
+		return fmt.Errorf("no bundled tcpdump for ABI %q", abi)
+	}
+	info, err := fs.Stat(e.tcpdumpBins, name)
+	if err != nil {
+		return fmt.Errorf("bundled tcpdump for %s: %w", abi, err)
+	}
+
+	out, _ := e.client.Shell(ctx, e.serial, "stat -c %s "+deployedTcpdumpPath+" 2>/dev/null")
+	if size, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64); err != nil || size != info.Size() {
+		f, err := e.tcpdumpBins.Open(name)
+		if err != nil {
+			return err
+		}
+		err = e.client.Push(ctx, e.serial, f, deployedTcpdumpPath, 0o755)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("pushing %s: %w", name, err)
+		}
+		e.log.Info("pushed bundled tcpdump", "binary", name, "bytes", info.Size(), "path", deployedTcpdumpPath)
+	}
+
+	res, err := e.client.ShellV2(ctx, e.serial, "chmod 755 "+deployedTcpdumpPath)
+	if err == nil {
+		err = res.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("chmod %s: %w", deployedTcpdumpPath, err)
+	}
+
+	res, err = e.client.ShellV2(ctx, e.serial, root.wrap(deployedTcpdumpPath+" --version"))
+	if err == nil {
+		err = res.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("running %s: %w", deployedTcpdumpPath, err)
+	}
+	return nil
+}
+
+// tcpdumpProcessCommand turns one of the tcpdump command constants into
+// the command line for this device: the resolved binary, run as root if
+// needed. The first line of output is the PID of the tcpdump process; the
+// shell prints its own and execs into tcpdump.
+func (e *Engine) tcpdumpProcessCommand(command string) string {
+	return e.root.wrap("echo $$; exec " + e.tcpdumpBinary(command))
+}
+
+// readPID reads the PID line tcpdumpProcessCommand prints.
+func readPID(r *bufio.Reader) (int, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, fmt.Errorf("reading tcpdump pid: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("reading tcpdump pid: unexpected %q", strings.TrimSpace(line))
+	}
+	return pid, nil
+}
+
+// tcpdumpProcess is the output of a tcpdump process on the device.
+// Closing it also kills the process, which closing the ADB stream alone
+// can leave running on some Android builds.
+type tcpdumpProcess struct {
+	*bufio.Reader
+	stream io.Closer
+	pid    int
+	e      *Engine
+	// packets marks the packet stream, whose PID is in the stats.
+	packets bool
+}
+
+func (e *Engine) startTcpdumpProcess(stream io.ReadCloser, packets bool) (*tcpdumpProcess, error) {
+	r := bufio.NewReader(stream)
+	pid, err := readPID(r)
+	if err != nil {
+		return nil, err
+	}
+	e.log.Debug("tcpdump started", "pid", pid)
+	e.tcpdumpMu.Lock()
+	if e.tcpdumpPIDs == nil {
+		e.tcpdumpPIDs = make(map[int]struct{})
+	}
+	e.tcpdumpPIDs[pid] = struct{}{}
+	e.tcpdumpMu.Unlock()
+	if packets {
+		e.updateStats(func(s *CaptureStats) { s.TcpdumpPID = pid })
+	}
+	return &tcpdumpProcess{Reader: r, stream: stream, pid: pid, e: e, packets: packets}, nil
+}
+
+func (p *tcpdumpProcess) Close() error {
+	err := p.stream.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), tcpdumpKillTimeout)
+	defer cancel()
+	if kerr := p.e.killTcpdump(ctx, p.pid); kerr != nil {
+		// Left recorded for Cleanup to try again.
+		p.e.log.Debug("failed to kill tcpdump", "pid", p.pid, "error", kerr)
+	}
+	if p.packets {
+		p.e.updateStats(func(s *CaptureStats) {
+			if s.TcpdumpPID == p.pid {
+				s.TcpdumpPID = 0
+			}
+		})
+	}
+	return err
+}
+
+// killTcpdump kills those of pids that are still tcpdump processes, so a
+// recycled PID is left alone, and forgets them.
+func (e *Engine) killTcpdump(ctx context.Context, pids ...int) error {
+	res, err := e.client.ShellV2(ctx, e.serial, e.root.wrap(tcpdumpKillCommand(pids)))
+	// kill exits 1 when the process exited in the meantime.
+	if err == nil && res.ExitCode > 1 {
+		err = res.Err()
+	}
+	if err != nil {
+		return err
+	}
+	e.tcpdumpMu.Lock()
+	for _, pid := range pids {
+		delete(e.tcpdumpPIDs, pid)
+	}
+	e.tcpdumpMu.Unlock()
+	return nil
+}
+
+// tcpdumpKillCommand returns the shell command killing those of pids whose
+// command line still names tcpdump.
+func tcpdumpKillCommand(pids []int) string {
+	cmds := make([]string, len(pids))
+	for i, pid := range pids {
+		cmds[i] = fmt.Sprintf("if grep -q tcpdump /proc/%d/cmdline 2>/dev/null; then kill %d; fi", pid, pid)
+	}
+	return strings.Join(cmds, "; ")
+}
+
+// tcpdumpBinary points command at the resolved tcpdump binary.
+func (e *Engine) tcpdumpBinary(command string) string {
+	if e.tcpdumpPath != "" {
+		command = e.tcpdumpPath + strings.TrimPrefix(command, "tcpdump")
+	}
+	return command
+}
@@ -0,0 +1,75 @@
+package capture
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestTcpdumpProcessCommand(t *testing.T) {
+	tests := []struct {
+		path string
+		root rootAccess
+		want string
+	}{
+		{"", rootNone, "echo $$; exec " + tcpdumpDNSCmd},
+		{"tcpdump", rootShell, "echo $$; exec " + tcpdumpDNSCmd},
+		{deployedTcpdumpPath, rootSuC, `su -c 'echo $$; exec /data/local/tmp/tcpdump -i any -n -l -s 0 -x udp port 53'`},
+		{deployedTcpdumpPath, rootSu0, `su 0 sh -c 'echo $$; exec /data/local/tmp/tcpdump -i any -n -l -s 0 -x udp port 53'`},
+	}
+	for _, tt := range tests {
+		e := &Engine{tcpdumpPath: tt.path, root: tt.root}
+		if got := e.tcpdumpProcessCommand(tcpdumpDNSCmd); got != tt.want {
+			t.Errorf("path=%q root=%s:\n got %s\nwant %s", tt.path, tt.root, got, tt.want)
+		}
+	}
+}
+
+func TestRootAccessWrap_Quoting(t *testing.T) {
+	got := rootSuC.wrap(tcpdumpHTTPCmd)
+	want := `su -c 'tcpdump -i any -n -l -s 512 -A '\''port 80 or port 443 or port 8080 or port 8443'\'''`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestTcpdumpBinaryName(t *testing.T) {
+	tests := map[string]string{
+		"arm64-v8a":   "tcpdump-arm64",
+		"armeabi-v7a": "tcpdump-arm",
+		"x86_64":      "tcpdump-x86_64",
+		"x86":         "tcpdump-x86",
+		"riscv64":     "",
+	}
+	for abi, want := range tests {
+		if got := TcpdumpBinaryName(abi); got != want {
+			t.Errorf("TcpdumpBinaryName(%q) = %q, want %q", abi, got, want)
+		}
+	}
+}
+
+func TestReadPID(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("4242\r\n12:00:00.000000 IP 10.0.0.1.1 > 10.0.0.2.2: tcp 0\n"))
+	pid, err := readPID(r)
+	if err != nil || pid != 4242 {
+		t.Fatalf("readPID = %d, %v", pid, err)
+	}
+	if rest, _ := r.ReadString('\n'); !strings.HasPrefix(rest, "12:00:00") {
+		t.Errorf("output after pid = %q", rest)
+	}
+
+	for _, bad := range []string{"", "tcpdump: not found\n", "0\n"} {
+		if _, err := readPID(bufio.NewReader(strings.NewReader(bad))); err == nil {
+			t.Errorf("readPID(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestTcpdumpKillCommand(t *testing.T) {
+	got := tcpdumpKillCommand([]int{4242, 4250})
+	want := "if grep -q tcpdump /proc/4242/cmdline 2>/dev/null; then kill 4242; fi; " +
+		"if grep -q tcpdump /proc/4250/cmdline 2>/dev/null; then kill 4250; fi"
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,142 @@
+package capture
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// deviceDNSPollInterval is how often the device's own DNS state is read.
+const deviceDNSPollInterval = 30 * time.Second
+
+// deviceDNSCmds dump what the device itself resolved: netd's per-network
+// resolver cache, and the netstats detail, which some builds annotate with
+// the hostnames behind the addresses they count.
+var deviceDNSCmds = []string{
+	"dumpsys dnsresolver 2>/dev/null",
+	"dumpsys netstats detail 2>/dev/null",
+}
+
+// reverseDomainLabels are first labels of Java package names, which look
+// like hostnames in dumpsys output but are not.
+var reverseDomainLabels = map[string]bool{"com": true, "org": true, "android": true, "androidx": true}
+
+// ParseDeviceDNS extracts address → hostname mappings from a dump of the
+// device's DNS state. Any line naming a hostname followed by the addresses
+// it resolved to counts, whatever the layout:
+//
+//	www.example.com A 93.184.216.34 ttl=300
+//	hostname=www.example.com addrs=[93.184.216.34, 2606:2800:220:1::]
+//	www.example.com -> 93.184.216.34
+//
+// Private and loopback addresses are skipped. Where an address appears
+// under several names, the last one wins.
+func ParseDeviceDNS(out string) map[string]string {
+	fields := strings.NewReplacer(
+		"->", " ", "=", " ", "[", " ", "]", " ", "(", " ", ")", " ", "{", " ", "}", " ",
+		",", " ", ";", " ", `"`, " ", "'", " ",
+	)
+	m := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		host := ""
+		for _, tok := range strings.Fields(fields.Replace(line)) {
+			if ip := net.ParseIP(tok); ip != nil {
+				if host == "" || ip.IsUnspecified() || isPrivateIP(tok) {
+					continue
+				}
+				m[NormalizeIP(tok)] = host
+				continue
+			}
+			if h, ok := deviceDNSHost(tok); ok {
+				host = h
+			}
+		}
+	}
+	return m
+}
+
+// deviceDNSHost reports whether tok is a hostname, returning it lowercased
+// without a trailing dot.
+func deviceDNSHost(tok string) (string, bool) {
+	h := strings.ToLower(strings.TrimSuffix(tok, "."))
+	if len(h) < 4 || len(h) > 253 || !strings.Contains(h, ".") {
+		return "", false
+	}
+	labels := strings.Split(h, ".")
+	if reverseDomainLabels[labels[0]] {
+		return "", false
+	}
+	for _, l := range labels {
+		if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+			return "", false
+		}
+		for _, c := range l {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return "", false
+			}
+		}
+	}
+	// The top-level label is alphabetic, which rules out version numbers
+	// and the like.
+	tld := labels[len(labels)-1]
+	if len(tld) < 2 || strings.ContainsAny(tld, "0123456789-") {
+		return "", false
+	}
+	return h, true
+}
+
+// pollDeviceDNS reads the device's DNS state now and every
+// deviceDNSPollInterval, and learns the hostnames it resolved.
+func (r *Resolver) pollDeviceDNS(ctx context.Context) {
+	ticker := time.NewTicker(deviceDNSPollInterval)
+	defer ticker.Stop()
+	for {
+		r.readDeviceDNS(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Resolver) readDeviceDNS(ctx context.Context) {
+	for _, cmd := range deviceDNSCmds {
+		shellCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		out, err := r.client.Shell(shellCtx, r.serial, cmd)
+		cancel()
+		if err != nil {
+			r.log.Debug("failed to read device DNS state", "cmd", cmd, "error", err)
+			continue
+		}
+		learned := 0
+		for ip, host := range ParseDeviceDNS(out) {
+			if r.learnDevice(ip, host) {
+				learned++
+			}
+		}
+		if learned > 0 {
+			r.log.Debug("learned hostnames from device", "cmd", cmd, "count", learned)
+		}
+	}
+}
+
+// learnDevice records a hostname the device resolved ip for. It replaces
+// a reverse-DNS guess, but not a name seen in a DNS answer or handshake
+// on the wire, which is fresher. It reports whether the mapping was new.
+func (r *Resolver) learnDevice(ip, host string) bool {
+	r.dnsMu.RLock()
+	_, observed := r.observed[ip]
+	cur := r.dnsCache[ip]
+	r.dnsMu.RUnlock()
+	if observed || cur == host {
+		return false
+	}
+	r.deviceHits.Add(1)
+	r.learn(ip, host)
+	if r.snooper != nil {
+		r.snooper.addDNSMapping(host, ip)
+	}
+	return true
+}
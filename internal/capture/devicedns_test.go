@@ -0,0 +1,56 @@
+package capture
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestParseDeviceDNS(t *testing.T) {
+	out := `DnsResolver:
+  NetId: 100
+    Cache:
+      www.example.com. A 93.184.216.34 ttl=300
+      hostname=cdn.example.net addrs=[151.101.1.69, 2a04:4e42::69]
+      api.example.org -> 104.16.1.1, 104.16.2.1
+      printer.lan A 192.168.1.20
+  Servers: 8.8.8.8 8.8.4.4
+Dev stats:
+  uid=10100 set=DEFAULT com.google.android.gms 172.217.1.1
+  version 1.2.3 build 2.2.2.2
+`
+	got := ParseDeviceDNS(out)
+	want := map[string]string{
+		"93.184.216.34": "www.example.com",
+		"151.101.1.69":  "cdn.example.net",
+		"2a04:4e42::69": "cdn.example.net",
+		"104.16.1.1":    "api.example.org",
+		"104.16.2.1":    "api.example.org",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for ip, host := range want {
+		if got[ip] != host {
+			t.Errorf("%s: got %q, want %q", ip, got[ip], host)
+		}
+	}
+}
+
+func TestResolver_LearnDevice(t *testing.T) {
+	r := NewResolver(nil, slog.Default(), "dev1")
+
+	// A reverse-DNS guess gives way to the name the device resolved.
+	r.learn("142.250.1.1", "lhr25s34-in-f1.1e100.net")
+	if !r.learnDevice("142.250.1.1", "www.google.com") || r.ResolveHostname("142.250.1.1") != "www.google.com" {
+		t.Errorf("device name not learned: %q", r.ResolveHostname("142.250.1.1"))
+	}
+	if r.learnDevice("142.250.1.1", "www.google.com") {
+		t.Error("same mapping learned twice")
+	}
+
+	// A name from a DNS answer on the wire stays.
+	r.LearnSNI("151.101.1.69", "cdn.example.net")
+	if r.learnDevice("151.101.1.69", "other.example.net") || r.ResolveHostname("151.101.1.69") != "cdn.example.net" {
+		t.Errorf("wire name replaced: %q", r.ResolveHostname("151.101.1.69"))
+	}
+}
@@ -0,0 +1,262 @@
+package capture
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tcpdump -x output for DNS traffic: a header line followed by the IP
+// packet (without link-layer header) as hex words:
+// 12:34:56.789012 IP 10.0.2.15.43512 > 10.0.2.3.53: 4660+ A? example.com. (29)
+// 	0x0000:  4500 0039 1234 4000 4011 0000 0a00 020f
+// 	0x0010:  0a00 0203 a9f8 0035 0025 0000 1234 0100
+
+// DNS record types decoded into answer data.
+const (
+	DNSTypeA     uint16 = 1
+	DNSTypeNS    uint16 = 2
+	DNSTypeCNAME uint16 = 5
+	DNSTypePTR   uint16 = 12
+	DNSTypeMX    uint16 = 15
+	DNSTypeTXT   uint16 = 16
+	DNSTypeAAAA  uint16 = 28
+	DNSTypeSRV   uint16 = 33
+	DNSTypeHTTPS uint16 = 65
+)
+
+const (
+	// maxDNSNameLen is the wire limit for a fully expanded name.
+	maxDNSNameLen = 255
+	// maxDNSPointers bounds compression pointer chasing (loop protection).
+	maxDNSPointers = 32
+	// dnsPendingTTL is how long a query waits for its response before it is
+	// forgotten.
+	dnsPendingTTL = 10 * time.Second
+)
+
+var errDNSTruncated = errors.New("dns: message truncated")
+
+// DNSQuestion is one entry of a DNS question section.
+type DNSQuestion struct {
+	Name string
+	Type uint16
+}
+
+// DNSAnswer is a decoded resource record from the answer section. Data holds
+// the address for A/AAAA records and the target name for CNAME/NS/PTR; it is
+// empty for other types.
+type DNSAnswer struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	TTL  uint32 `json:"ttl"`
+	Data string `json:"data,omitempty"`
+}
+
+// DNSMessage is a decoded DNS query or response.
+type DNSMessage struct {
+	ID        uint16
+	Response  bool
+	RCode     int
+	Questions []DNSQuestion
+	Answers   []DNSAnswer
+}
+
+// DNSLookup is a completed lookup observed on the wire.
+type DNSLookup struct {
+	ID        string      `json:"id"`
+	Serial    string      `json:"serial"`
+	Timestamp time.Time   `json:"timestamp"`
+	Client    string      `json:"client"`
+	Server    string      `json:"server"`
+	Query     string      `json:"query"`
+	Type      string      `json:"type"`
+	RCode     string      `json:"rcode"`
+	Answers   []DNSAnswer `json:"answers,omitempty"`
+	LatencyMs float64     `json:"latency_ms,omitempty"`
+}
+
+// Addresses returns the A/AAAA answer addresses of the lookup.
+func (l *DNSLookup) Addresses() []string {
+	var ips []string
+	for _, a := range l.Answers {
+		if a.Type == "A" || a.Type == "AAAA" {
+			ips = append(ips, a.Data)
+		}
+	}
+	return ips
+}
+
+// DNSTypeName returns the mnemonic for a record type, e.g. "AAAA".
+func DNSTypeName(t uint16) string {
+	switch t {
+	case DNSTypeA:
+		return "A"
+	case DNSTypeNS:
+		return "NS"
+	case DNSTypeCNAME:
+		return "CNAME"
+	case DNSTypePTR:
+		return "PTR"
+	case DNSTypeMX:
+		return "MX"
+	case DNSTypeTXT:
+		return "TXT"
+	case DNSTypeAAAA:
+		return "AAAA"
+	case DNSTypeSRV:
+		return "SRV"
+	case DNSTypeHTTPS:
+		return "HTTPS"
+	default:
+		return "TYPE" + strconv.Itoa(int(t))
+	}
+}
+
+// DNSRCodeName returns the mnemonic for a response code, e.g. "NXDOMAIN".
+func DNSRCodeName(rcode int) string {
+	switch rcode {
+	case 0:
+		return "NOERROR"
+	case 1:
+		return "FORMERR"
+	case 2:
+		return "SERVFAIL"
+	case 3:
+		return "NXDOMAIN"
+	case 4:
+		return "NOTIMP"
+	case 5:
+		return "REFUSED"
+	default:
+		return "RCODE" + strconv.Itoa(rcode)
+	}
+}
+
+// dnsQueryKey matches a response to its query.
+type dnsQueryKey struct {
+	id     uint16
+	client netip.AddrPort
+}
+
+// DNSSniffer turns tcpdump -x output for port 53 into DNSLookups. Feed it
+// every line of the stream; a lookup is produced when a response completes.
+type DNSSniffer struct {
+	serial string
+	nextID uint64
+
+	ts      time.Time
+	buf     []byte
+	inPkt   bool
+	pending map[dnsQueryKey]time.Time
+}
+
+// NewDNSSniffer creates a sniffer for the given device serial.
+func NewDNSSniffer(serial string) *DNSSniffer {
+	return &DNSSniffer{
+		serial:  serial,
+		pending: make(map[dnsQueryKey]time.Time),
+	}
+}
+
+// Feed consumes one line of tcpdump output. It returns a lookup when the
+// line completes a DNS response (i.e. a new packet header follows it).
+func (s *DNSSniffer) Feed(line string) *DNSLookup {
+	trimmed := trimLeftSpace(line)
+	if strings.HasPrefix(trimmed, "0x") {
+		if s.inPkt {
+			s.buf = appendHexDump(s.buf, trimmed)
+		}
+		return nil
+	}
+
+	lookup := s.Flush()
+	field, _ := nextField(trimmed)
+	if isClockTime(field) {
+		s.inPkt = true
+		s.ts = parseClockTime(field)
+	}
+	return lookup
+}
+
+// Flush decodes the packet accumulated so far, if any.
+func (s *DNSSniffer) Flush() *DNSLookup {
+	if !s.inPkt {
+		return nil
+	}
+	s.inPkt = false
+	pkt := s.buf
+	s.buf = s.buf[:0]
+	return s.decode(pkt, s.ts)
+}
+
+func (s *DNSSniffer) decode(pkt []byte, ts time.Time) *DNSLookup {
+	src, dst, payload, ok := decodeUDP(pkt)
+	if !ok {
+		return nil
+	}
+	msg, err := DecodeDNS(payload)
+	if err != nil || len(msg.Questions) == 0 {
+		return nil
+	}
+
+	if !msg.Response {
+		s.expire(ts)
+		s.pending[dnsQueryKey{msg.ID, src}] = ts
+		return nil
+	}
+
+	key := dnsQueryKey{msg.ID, dst}
+	q := msg.Questions[0]
+	s.nextID++
+	lookup := &DNSLookup{
+		ID:        s.serial + "-dns-" + strconv.FormatUint(s.nextID, 10),
+		Serial:    s.serial,
+		Timestamp: ts,
+		Client:    dst.String(),
+		Server:    src.String(),
+		Query:     strings.TrimSuffix(q.Name, "."),
+		Type:      DNSTypeName(q.Type),
+		RCode:     DNSRCodeName(msg.RCode),
+		Answers:   msg.Answers,
+	}
+	if sent, ok := s.pending[key]; ok {
+		delete(s.pending, key)
+		if d := ts.Sub(sent); d >= 0 {
+			lookup.LatencyMs = float64(d.Microseconds()) / 1000
+		}
+	}
+	return lookup
+}
+
+// expire drops queries that never got an answer.
+func (s *DNSSniffer) expire(now time.Time) {
+	for k, sent := range s.pending {
+		if now.Sub(sent) > dnsPendingTTL {
+			delete(s.pending, k)
+		}
+	}
+}
+
+// appendHexDump decodes one "0x0010:  4500 0039 ..." line onto buf.
+func appendHexDump(buf []byte, line string) []byte {
+	_, rest, ok := strings.Cut(line, ":")
+	if !ok {
+		return buf
+	}
+	for {
+		var group string
+		group, rest = nextField(rest)
+		if group == "" || len(group)%2 != 0 || len(group) > 4 {
+			return buf
+		}
+		b, err := hex.DecodeString(group)
+		if err != nil {
+			return buf
+		}
+		buf = append(buf, b...)
+	}
+}
@@ -0,0 +1,180 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// dnsName encodes a name as uncompressed labels.
+func dnsName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(name, ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// buildDNS builds a message for name with a CNAME and an A record; the
+// answers use compression pointers back to the question (offset 12).
+func buildDNS(id uint16, response bool) []byte {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[4:], 1) // qdcount
+	msg = append(msg, dnsName("api.example.com")...)
+	msg = append(msg, 0, 1, 0, 1) // A, IN
+	if !response {
+		msg[2] = 0x01 // RD
+		return msg
+	}
+	msg[2] = 0x81
+	msg[3] = 0x80
+	binary.BigEndian.PutUint16(msg[6:], 2) // ancount
+
+	// api.example.com CNAME edge.example.net
+	target := dnsName("edge.example.net")
+	msg = append(msg, 0xC0, 12, 0, 5, 0, 1, 0, 0, 0x0E, 0x10)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(target)))
+	cnameOff := len(msg)
+	msg = append(msg, target...)
+
+	// edge.example.net A 93.184.216.34 (pointer to the CNAME target)
+	msg = append(msg, 0xC0, byte(cnameOff), 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 93, 184, 216, 34)
+	return msg
+}
+
+// ipv4UDP wraps payload in IPv4 and UDP headers.
+func ipv4UDP(src, dst [4]byte, sport, dport uint16, payload []byte) []byte {
+	pkt := make([]byte, 28, 28+len(payload))
+	pkt[0] = 0x45
+	binary.BigEndian.PutUint16(pkt[2:], uint16(28+len(payload)))
+	pkt[8] = 64
+	pkt[9] = 17
+	copy(pkt[12:], src[:])
+	copy(pkt[16:], dst[:])
+	binary.BigEndian.PutUint16(pkt[20:], sport)
+	binary.BigEndian.PutUint16(pkt[22:], dport)
+	binary.BigEndian.PutUint16(pkt[24:], uint16(8+len(payload)))
+	return append(pkt, payload...)
+}
+
+// hexDumpLines renders pkt the way tcpdump -x does.
+func hexDumpLines(pkt []byte) []string {
+	var lines []string
+	for off := 0; off < len(pkt); off += 16 {
+		end := off + 16
+		if end > len(pkt) {
+			end = len(pkt)
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "\t0x%04x:  ", off)
+		for i := off; i < end; i += 2 {
+			if i > off {
+				sb.WriteByte(' ')
+			}
+			if i+1 < end {
+				fmt.Fprintf(&sb, "%02x%02x", pkt[i], pkt[i+1])
+			} else {
+				fmt.Fprintf(&sb, "%02x", pkt[i])
+			}
+		}
+		lines = append(lines, sb.String())
+	}
+	return lines
+}
+
+func TestDecodeDNS_Response(t *testing.T) {
+	msg, err := DecodeDNS(buildDNS(0x1234, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !msg.Response || msg.ID != 0x1234 || msg.RCode != 0 {
+		t.Errorf("header: %+v", msg)
+	}
+	if len(msg.Questions) != 1 || msg.Questions[0].Name != "api.example.com" || msg.Questions[0].Type != DNSTypeA {
+		t.Errorf("questions: %+v", msg.Questions)
+	}
+	want := []DNSAnswer{
+		{Name: "api.example.com", Type: "CNAME", TTL: 3600, Data: "edge.example.net"},
+		{Name: "edge.example.net", Type: "A", TTL: 60, Data: "93.184.216.34"},
+	}
+	if len(msg.Answers) != len(want) {
+		t.Fatalf("answers: %+v", msg.Answers)
+	}
+	for i := range want {
+		if msg.Answers[i] != want[i] {
+			t.Errorf("answer %d: got %+v, want %+v", i, msg.Answers[i], want[i])
+		}
+	}
+}
+
+func TestDecodeDNS_Malformed(t *testing.T) {
+	full := buildDNS(1, true)
+	loop := append([]byte(nil), full[:12]...)
+	loop = append(loop, 0xC0, 12) // pointer to itself
+
+	tests := map[string][]byte{
+		"short header":    full[:8],
+		"truncated":       full[:len(full)-3],
+		"pointer loop":    loop,
+		"bad label type":  append(append([]byte(nil), full[:12]...), 0x80, 0),
+		"question no end": append(append([]byte(nil), full[:12]...), 3, 'a', 'b'),
+	}
+	for name, msg := range tests {
+		if _, err := DecodeDNS(msg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestDNSSniffer(t *testing.T) {
+	client := [4]byte{10, 0, 2, 15}
+	server := [4]byte{10, 0, 2, 3}
+
+	var lines []string
+	lines = append(lines, "12:00:00.100000 IP 10.0.2.15.43512 > 10.0.2.3.53: 4660+ A? api.example.com. (33)")
+	lines = append(lines, hexDumpLines(ipv4UDP(client, server, 43512, 53, buildDNS(0x1234, false)))...)
+	lines = append(lines, "12:00:00.125000 IP 10.0.2.3.53 > 10.0.2.15.43512: 4660 2/0/0 CNAME edge.example.net., A 93.184.216.34 (83)")
+	lines = append(lines, hexDumpLines(ipv4UDP(server, client, 53, 43512, buildDNS(0x1234, true)))...)
+
+	s := NewDNSSniffer("dev1")
+	var got []*DNSLookup
+	for _, line := range lines {
+		if l := s.Feed(line); l != nil {
+			got = append(got, l)
+		}
+	}
+	if l := s.Flush(); l != nil {
+		got = append(got, l)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("expected 1 lookup, got %d", len(got))
+	}
+	l := got[0]
+	if l.Query != "api.example.com" || l.Type != "A" || l.RCode != "NOERROR" {
+		t.Errorf("lookup: %+v", l)
+	}
+	if l.Client != "10.0.2.15:43512" || l.Server != "10.0.2.3:53" {
+		t.Errorf("endpoints: client %s server %s", l.Client, l.Server)
+	}
+	if l.LatencyMs != 25 {
+		t.Errorf("latency: got %vms, want 25", l.LatencyMs)
+	}
+	if ips := l.Addresses(); len(ips) != 1 || ips[0] != "93.184.216.34" {
+		t.Errorf("addresses: %v", ips)
+	}
+}
+
+func TestResolver_LearnDNS(t *testing.T) {
+	r := &Resolver{dnsCache: map[string]string{"93.184.216.34": "ptr.example.org"}, dnsPend: map[string]struct{}{}}
+	r.LearnDNS(&DNSLookup{
+		Query:   "api.example.com",
+		Answers: []DNSAnswer{{Type: "A", Data: "93.184.216.34"}},
+	})
+	if got := r.ResolveHostname("93.184.216.34"); got != "api.example.com" {
+		t.Errorf("ResolveHostname: got %q, want api.example.com", got)
+	}
+}
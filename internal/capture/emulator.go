@@ -0,0 +1,288 @@
+package capture
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ModeEmulator captures an emulator's traffic on the host instead of on
+// the device. Emulators route their network through the host, and their
+// console (port N for the serial emulator-N) can record it: the engine
+// asks for `network capture start <file>` with a temporary pcap file,
+// follows the file as it grows and decodes the frames as vpn mode does.
+// The emulator must run on the same host as the engine.
+const (
+	emulatorSerialPrefix = "emulator-"
+	// emulatorConsoleTimeout bounds connecting to the console and each
+	// command.
+	emulatorConsoleTimeout = 5 * time.Second
+	// emulatorStartTimeout is how long the emulator has to write the pcap
+	// header after accepting the capture command.
+	emulatorStartTimeout = 10 * time.Second
+	// emulatorPoll is how often the pcap file is checked for new frames.
+	emulatorPoll = 100 * time.Millisecond
+	// emulatorAuthTokenFile is where the emulator keeps the console token,
+	// relative to the home directory, unless its banner names another.
+	emulatorAuthTokenFile = ".emulator_console_auth_token"
+
+	pcapHeaderLen = 24
+	pcapRecordLen = 16
+	// pcapMaxFrame bounds one captured frame; larger lengths mean the file
+	// is not what it claims to be.
+	pcapMaxFrame = 1 << 18
+
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLinuxSLL = 113
+)
+
+// emulatorConsolePort returns the console port of an emulator-N serial.
+func emulatorConsolePort(serial string) (int, bool) {
+	port, err := strconv.Atoi(strings.TrimPrefix(serial, emulatorSerialPrefix))
+	if !strings.HasPrefix(serial, emulatorSerialPrefix) || err != nil || port <= 0 || port > 65535 {
+		return 0, false
+	}
+	return port, true
+}
+
+// emulatorConsoleReachable reports whether the console of the emulator
+// accepts connections on this host.
+func emulatorConsoleReachable(serial string) bool {
+	port, ok := emulatorConsolePort(serial)
+	if !ok {
+		return false
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// runEmulator runs one session of host capture: it ends when the pcap
+// file cannot be read any more or ctx is done.
+func (e *Engine) runEmulator(ctx context.Context) error {
+	port, ok := emulatorConsolePort(e.serial)
+	if !ok {
+		return fmt.Errorf("%s is not an emulator serial", e.serial)
+	}
+	console, err := dialEmulatorConsole(ctx, port)
+	if err != nil {
+		return err
+	}
+	defer console.Close()
+
+	f, err := os.CreateTemp("", "adb-monitor-"+e.serial+"-*.pcap")
+	if err != nil {
+		return fmt.Errorf("creating pcap file: %w", err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	defer f.Close()
+
+	if err := console.command("network capture start " + path); err != nil {
+		return fmt.Errorf("starting emulator capture: %w", err)
+	}
+	defer console.command("network capture stop")
+
+	e.log.Info("emulator host capture started", "console", port, "file", path)
+	tail := &tailReader{r: countingReader{f, e}, done: ctx.Done(), deadline: time.Now().Add(emulatorStartTimeout)}
+	err = e.readPcap(tail)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// readPcap decodes a pcap stream of Ethernet, Linux cooked or raw IP
+// frames until it ends. The deadline of a tailReader is lifted once the
+// file header has been read.
+func (e *Engine) readPcap(r io.Reader) error {
+	br := bufio.NewReaderSize(r, 64<<10)
+	var hdr [pcapHeaderLen]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return fmt.Errorf("reading pcap header: %w", err)
+	}
+	var (
+		order binary.ByteOrder
+		nanos bool
+	)
+	switch magic := binary.LittleEndian.Uint32(hdr[0:4]); magic {
+	case 0xa1b2c3d4, 0xa1b23c4d:
+		order, nanos = binary.LittleEndian, magic == 0xa1b23c4d
+	case 0xd4c3b2a1, 0x4d3cb2a1:
+		order, nanos = binary.BigEndian, magic == 0x4d3cb2a1
+	default:
+		return fmt.Errorf("not a pcap file (magic %#x)", magic)
+	}
+	linkType := order.Uint32(hdr[20:24])
+	switch linkType {
+	case linkTypeEthernet, linkTypeRaw, linkTypeLinuxSLL:
+	default:
+		return fmt.Errorf("unsupported pcap link type %d", linkType)
+	}
+	if t, ok := r.(*tailReader); ok {
+		t.deadline = time.Time{}
+	}
+
+	ip := e.newIPReader()
+	for {
+		var rec [pcapRecordLen]byte
+		if _, err := io.ReadFull(br, rec[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("emulator capture ended")
+			}
+			return fmt.Errorf("reading pcap: %w", err)
+		}
+		sec, frac := int64(order.Uint32(rec[0:4])), int64(order.Uint32(rec[4:8]))
+		if !nanos {
+			frac *= 1000
+		}
+		n := order.Uint32(rec[8:12])
+		if n > pcapMaxFrame {
+			return fmt.Errorf("bad pcap frame length %d", n)
+		}
+		// Freshly allocated: the QUIC sniffer keeps references into it.
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(br, frame); err != nil {
+			return fmt.Errorf("reading pcap: %w", err)
+		}
+		if pkt := linkPayload(linkType, frame); pkt != nil {
+			ip.handle(pkt, time.Unix(sec, frac))
+		}
+	}
+}
+
+// tailReader reads a file that is still being written, waiting for more
+// instead of returning io.EOF until done is closed or the deadline, if
+// set, has passed.
+type tailReader struct {
+	r        io.Reader
+	done     <-chan struct{}
+	deadline time.Time
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for {
+		n, err := t.r.Read(p)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if !t.deadline.IsZero() && time.Now().After(t.deadline) {
+			return 0, errors.New("emulator wrote no capture; is it running on this host?")
+		}
+		select {
+		case <-t.done:
+			return 0, io.EOF
+		case <-time.After(emulatorPoll):
+		}
+	}
+}
+
+// emulatorConsole is a connection to an emulator's telnet console.
+type emulatorConsole struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialEmulatorConsole connects to the console on port and authenticates
+// with the token of the user running the emulator if it asks for one.
+func dialEmulatorConsole(ctx context.Context, port int) (*emulatorConsole, error) {
+	dialer := net.Dialer{Timeout: emulatorConsoleTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to emulator console: %w", err)
+	}
+	c := &emulatorConsole{conn: conn, r: bufio.NewReader(conn)}
+
+	banner, err := c.reply()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading emulator console banner: %w", err)
+	}
+	if !strings.Contains(banner, "Authentication required") {
+		return c, nil
+	}
+	token, err := readConsoleToken(banner)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := c.command("auth " + token); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("emulator console auth: %w", err)
+	}
+	return c, nil
+}
+
+// readConsoleToken reads the auth token from the file the banner names,
+// or the default one.
+func readConsoleToken(banner string) (string, error) {
+	path := ""
+	if i := strings.Index(banner, "'/"); i >= 0 {
+		if j := strings.Index(banner[i+1:], "'"); j >= 0 {
+			path = banner[i+1 : i+1+j]
+		}
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("locating emulator console token: %w", err)
+		}
+		path = filepath.Join(home, emulatorAuthTokenFile)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading emulator console token: %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// command sends a console command and waits for its OK.
+func (c *emulatorConsole) command(cmd string) error {
+	c.conn.SetDeadline(time.Now().Add(emulatorConsoleTimeout))
+	if _, err := io.WriteString(c.conn, cmd+"\r\n"); err != nil {
+		return err
+	}
+	_, err := c.reply()
+	return err
+}
+
+// reply reads lines up to OK, returning the lines before it, or up to a
+// "KO: message" line, returned as an error.
+func (c *emulatorConsole) reply() (string, error) {
+	c.conn.SetDeadline(time.Now().Add(emulatorConsoleTimeout))
+	var b strings.Builder
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return b.String(), err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "OK":
+			return b.String(), nil
+		case strings.HasPrefix(line, "KO"):
+			return b.String(), errors.New(strings.TrimSpace(strings.TrimLeft(strings.TrimPrefix(line, "KO"), ":")))
+		}
+		b.WriteString(line + "\n")
+	}
+}
+
+func (c *emulatorConsole) Close() error {
+	return c.conn.Close()
+}
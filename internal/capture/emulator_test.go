@@ -0,0 +1,137 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pcapFile builds a little-endian microsecond pcap of Ethernet frames.
+func pcapFile(ts time.Time, pkts ...[]byte) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, 0xa1b2c3d4)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, 4)
+	b = append(b, make([]byte, 8)...)
+	b = binary.LittleEndian.AppendUint32(b, 65535)
+	b = binary.LittleEndian.AppendUint32(b, linkTypeEthernet)
+	for i, pkt := range pkts {
+		frame := append(make([]byte, 12), 0x08, 0x00)
+		frame = append(frame, pkt...)
+		t := ts.Add(time.Duration(i) * time.Millisecond)
+		b = binary.LittleEndian.AppendUint32(b, uint32(t.Unix()))
+		b = binary.LittleEndian.AppendUint32(b, uint32(t.Nanosecond()/1000))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(frame)))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(frame)))
+		b = append(b, frame...)
+	}
+	return b
+}
+
+func TestReadPcap(t *testing.T) {
+	e := newTestEngine()
+	ts := time.UnixMicro(1700000000000000)
+	client, resolver := [4]byte{10, 0, 2, 15}, [4]byte{10, 0, 2, 3}
+
+	arp := append(make([]byte, 12), 0x08, 0x06)
+	file := pcapFile(ts,
+		ipv4UDP(client, resolver, 5353, 53, buildDNS(7, false)),
+		ipv4UDP(resolver, client, 53, 5353, buildDNS(7, true)))
+	// A trailing ARP frame is skipped.
+	rec := binary.LittleEndian.AppendUint32(nil, uint32(ts.Unix()))
+	rec = binary.LittleEndian.AppendUint32(rec, 0)
+	rec = binary.LittleEndian.AppendUint32(rec, uint32(len(arp)))
+	rec = binary.LittleEndian.AppendUint32(rec, uint32(len(arp)))
+	file = append(append(file, rec...), arp...)
+
+	err := e.readPcap(bytes.NewReader(file))
+	if err == nil || !strings.Contains(err.Error(), "ended") {
+		t.Errorf("err = %v, want ended", err)
+	}
+	if n := len(e.packetCh); n != 2 {
+		t.Fatalf("packets = %d, want 2", n)
+	}
+	if p := <-e.packetCh; p.SrcIP != "10.0.2.15" || p.DstPort != 53 || !p.Timestamp.Equal(ts) {
+		t.Errorf("first packet = %+v", p)
+	}
+	select {
+	case l := <-e.dnsCh:
+		if l.Query != "api.example.com" || l.LatencyMs != 1 {
+			t.Errorf("lookup = %+v", l)
+		}
+	default:
+		t.Error("no DNS lookup")
+	}
+
+	if err := e.readPcap(strings.NewReader(strings.Repeat("x", pcapHeaderLen))); err == nil || !strings.Contains(err.Error(), "not a pcap") {
+		t.Errorf("bad magic err = %v", err)
+	}
+}
+
+func TestEmulatorConsolePort(t *testing.T) {
+	for serial, want := range map[string]int{"emulator-5554": 5554, "emulator-x": 0, "R58M123": 0, "emulator-99999": 0} {
+		if got, _ := emulatorConsolePort(serial); got != want {
+			t.Errorf("emulatorConsolePort(%q) = %d, want %d", serial, got, want)
+		}
+	}
+}
+
+func TestEmulatorConsole_Auth(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	got := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "Android Console: Authentication required\r\n"+
+			"Android Console: you can find your <auth_token> in\r\n'%s'\r\nOK\r\n", tokenFile)
+		var cmds []string
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				got <- cmds
+				return
+			}
+			cmd := strings.TrimSpace(line)
+			cmds = append(cmds, cmd)
+			if strings.HasPrefix(cmd, "network") {
+				fmt.Fprint(conn, "KO: network capture unavailable\r\n")
+			} else {
+				fmt.Fprint(conn, "OK\r\n")
+			}
+		}
+	}()
+
+	c, err := dialEmulatorConsole(context.Background(), ln.Addr().(*net.TCPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.command("network capture start /tmp/x.pcap"); err == nil || err.Error() != "network capture unavailable" {
+		t.Errorf("command err = %v", err)
+	}
+	c.Close()
+
+	cmds := <-got
+	if len(cmds) != 2 || cmds[0] != "auth s3cret" {
+		t.Errorf("commands = %q", cmds)
+	}
+}
@@ -3,8 +3,12 @@ package capture
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -15,31 +19,106 @@ import (
 
 const (
 	// tcpdumpCmd is the command to stream network packets in text mode with ASCII dump.
-	tcpdumpCmd = "tcpdump -i any -n -l -s 256 -q 2>/dev/null"
+	// Its stderr is kept (shell v2) so a failing tcpdump can be reported.
+	tcpdumpCmd = "tcpdump -i any -n -l -s 256 -q"
 
 	// tcpdumpHTTPCmd captures with ASCII dump for HTTP header inspection.
-	tcpdumpHTTPCmd = "tcpdump -i any -n -l -s 512 -A 'port 80 or port 443 or port 8080 or port 8443' 2>/dev/null"
+	tcpdumpHTTPCmd = "tcpdump -i any -n -l -s 512 -A 'port 80 or port 443 or port 8080 or port 8443'"
+
+	// tcpdumpDNSCmd dumps DNS datagrams as hex for wire-level decoding.
+	tcpdumpDNSCmd = "tcpdump -i any -n -l -s 0 -x udp port 53"
+
+	// tcpdumpQUICCmd dumps client QUIC Initial packets as hex: long header
+	// with the fixed bit and packet type Initial in the first payload byte.
+	// IPv6 packets are matched assuming no extension headers.
+	tcpdumpQUICCmd = "tcpdump -i any -n -l -s 0 -x 'udp dst port 443 and " +
+		"((ip and udp[8] & 0xf0 = 0xc0) or (ip6 and ip6[48] & 0xf0 = 0xc0))'"
 
 	// procNetPollInterval is the interval for polling /proc/net/tcp.
 	procNetPollInterval = 2 * time.Second
 
-	// packetChannelBuffer is the buffer size for the per-device packet channel.
-	packetChannelBuffer = 512
+	// trafficEmitInterval throttles re-emitting a connection whose byte
+	// counters changed, so busy sockets do not flood the event stream.
+	trafficEmitInterval = 10 * time.Second
+
+	// trafficPollEvery is how many /proc/net polls pass between reads of the
+	// per-app and per-interface counters.
+	trafficPollEvery = 15
 )
 
 // Engine manages network capture for a single device.
-// It selects the best capture mode (tcpdump vs procnet) and streams data.
+// It selects the best capture mode (tcpdump, ss or procnet) and streams data.
 type Engine struct {
 	client   *adb.Client
 	log      *slog.Logger
 	serial   string
 	mode     Mode
+	class    adb.DeviceClass
 	resolver *Resolver
 
+	// active is the mode Prepare settled on; it names the Source of what
+	// the capture emits.
+	active Mode
+	// prepared is set once Prepare succeeded.
+	prepared bool
+	// app, when set, restricts the capture to one app; see SetApp.
+	app *appScope
+
+	// tcpdumpBins holds static tcpdump builds to push to rooted devices
+	// that lack one; see TcpdumpBinaryName. tcpdumpPath and root say how
+	// tcpdump is run once prepareTcpdump has resolved it.
+	tcpdumpBins fs.FS
+	tcpdumpPath string
+	root        rootAccess
+	// tcpdumpPIDs holds the tcpdump processes the engine started and has
+	// not killed yet, for Cleanup. Other captures' tcpdumps on the device
+	// are never touched.
+	tcpdumpMu   sync.Mutex
+	tcpdumpPIDs map[int]struct{}
+	// iptablesRules is set once ModeIPTables added its logging rules, so
+	// Cleanup removes them should the capture not have.
+	iptablesRules atomic.Bool
+
+	// vpnAPK is the companion app installed for ModeVPN when the device
+	// lacks it; see SetVPNCompanion.
+	vpnAPK string
+
 	packetCh chan NetworkPacket
 	connCh   chan Connection
+	closedCh chan Connection
+	dnsCh    chan DNSLookup
+
+	// quic tags tcpdump packets of flows whose server name the QUIC
+	// sniffer has read.
+	quic *quicFlows
+
+	// enrichers add hostnames, app names, threat matches and the like to
+	// what the capture emits; see Enricher.
+	enrichers []Enricher
+
+	degradedCh chan DegradedEvent
+
+	// tlsCh delivers the TLS handshakes of the vpn and emulator modes.
+	tlsCh chan TLSSession
+
+	// policy applies when one of the channels above is full; see send.
+	policy         DropPolicy
+	backpressureCh chan BackpressureEvent
+	pressure       backpressure
+
+	// stats is updated from every stream and poller of the capture, so
+	// changes go through updateStats.
+	statsMu sync.Mutex
+	stats   CaptureStats
+
+	// sampling thins out packets; sampleSeq and window track it. They
+	// are guarded by statsMu, like the counters they update.
+	sampling  SamplingConfig
+	sampleSeq uint64
+	window    rateWindow
 
-	stats atomic.Pointer[CaptureStats]
+	trafficMu sync.Mutex
+	traffic   *TrafficSnapshot
 
 	mu      sync.Mutex
 	stopped bool
@@ -53,43 +132,165 @@ func NewEngine(client *adb.Client, log *slog.Logger, serial string, mode Mode) *
 		serial:   serial,
 		mode:     mode,
 		resolver: NewResolver(client, log, serial),
-		packetCh: make(chan NetworkPacket, packetChannelBuffer),
-		connCh:   make(chan Connection, packetChannelBuffer),
+		packetCh: make(chan NetworkPacket, DefaultBufferSize),
+		connCh:   make(chan Connection, DefaultBufferSize),
+		closedCh: make(chan Connection, DefaultBufferSize),
+		dnsCh:    make(chan DNSLookup, DefaultBufferSize),
+		quic:     newQUICFlows(),
+
+		degradedCh:     make(chan DegradedEvent, 16),
+		tlsCh:          make(chan TLSSession, 64),
+		backpressureCh: make(chan BackpressureEvent, 16),
+		pressure:       backpressure{out: make(map[string]*pressure)},
 	}
-	initialStats := &CaptureStats{Serial: serial, Mode: mode.String()}
-	e.stats.Store(initialStats)
+	e.enrichers = []Enricher{DNSEnricher(e.resolver), UIDEnricher(e.resolver)}
+	e.stats = CaptureStats{Serial: serial, Mode: mode.String(), BufferSize: DefaultBufferSize, DropPolicy: DropNewest.String()}
 	return e
 }
 
-// Packets returns the channel that delivers captured packets (tcpdump mode).
+// SetDeviceClass tells the engine the device's form factor so Run does not
+// have to probe for it. Call before Run.
+func (e *Engine) SetDeviceClass(class adb.DeviceClass) {
+	e.class = class
+}
+
+// SetTcpdumpBinaries provides static tcpdump builds, named as returned by
+// TcpdumpBinaryName, to deploy to rooted devices without tcpdump. Call
+// before Run.
+func (e *Engine) SetTcpdumpBinaries(bins fs.FS) {
+	e.tcpdumpBins = bins
+}
+
+// SetVPNCompanion gives the path of the VpnService companion APK to
+// install on devices that lack it when capturing in ModeVPN. Call before
+// Run.
+func (e *Engine) SetVPNCompanion(apkPath string) {
+	e.vpnAPK = apkPath
+}
+
+// Packets returns the channel that delivers captured packets (tcpdump and
+// vpn modes).
 func (e *Engine) Packets() <-chan NetworkPacket {
 	return e.packetCh
 }
 
-// Connections returns the channel that delivers connection snapshots (procnet mode).
+// Connections returns the channel that delivers connection snapshots (procnet and ss modes).
 func (e *Engine) Connections() <-chan Connection {
 	return e.connCh
 }
 
+// ClosedConnections returns the channel that delivers connections once
+// they are gone from the socket table, with ClosedAt and DurationMs set
+// (procnet and ss modes).
+func (e *Engine) ClosedConnections() <-chan Connection {
+	return e.closedCh
+}
+
+// DNSLookups returns the channel that delivers DNS lookups decoded from the
+// wire (tcpdump, vpn and emulator modes).
+func (e *Engine) DNSLookups() <-chan DNSLookup {
+	return e.dnsCh
+}
+
+// TLSSessions returns the channel that delivers the TLS handshakes read
+// from raw packets (vpn and emulator modes). Sessions are dropped while it
+// is full.
+func (e *Engine) TLSSessions() <-chan TLSSession {
+	return e.tlsCh
+}
+
+// Hostnames returns the channel announcing hostnames learned after the
+// fact, for backfilling data that was emitted unresolved.
+func (e *Engine) Hostnames() <-chan HostnameUpdate {
+	return e.resolver.Hostnames()
+}
+
 // Stats returns current capture statistics.
 func (e *Engine) Stats() CaptureStats {
-	return *e.stats.Load()
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
+	s := e.stats
+	s.Sampling.ratios()
+	return s
+}
+
+// source returns the Source of what the capture emits, "" before Run.
+func (e *Engine) source() string {
+	if e.active == ModeAuto {
+		return ""
+	}
+	return e.active.String()
+}
+
+// updateStats applies fn to the statistics under their lock.
+func (e *Engine) updateStats(fn func(s *CaptureStats)) {
+	e.statsMu.Lock()
+	fn(&e.stats)
+	e.statsMu.Unlock()
+}
+
+// addBytesRead counts n bytes of device output read by the capture.
+func (e *Engine) addBytesRead(n int) {
+	if n > 0 {
+		e.updateStats(func(s *CaptureStats) { s.BytesRead += int64(n) })
+	}
 }
 
-// Run starts the capture engine. Blocks until ctx is cancelled.
+// countingReader counts what is read through it into BytesRead.
+type countingReader struct {
+	io.ReadCloser
+	e *Engine
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.e.addBytesRead(n)
+	return n, err
+}
+
+// shell runs a one-shot command for a poller, counting its output.
+func (e *Engine) shell(ctx context.Context, command string) (string, error) {
+	out, err := e.client.Shell(ctx, e.serial, command)
+	e.addBytesRead(len(out))
+	return out, err
+}
+
+// Run starts the capture engine, preparing it first unless Prepare was
+// called. Blocks until ctx is cancelled.
 func (e *Engine) Run(ctx context.Context) error {
-	mode := e.mode
-	if mode == ModeAuto {
-		mode = e.detectMode(ctx)
+	if err := e.Prepare(ctx); err != nil {
+		return err
 	}
+	mode := e.active
+
+	e.updateStats(func(s *CaptureStats) {
+		*s = CaptureStats{
+			Serial:     e.serial,
+			Mode:       mode.String(),
+			StartedAt:  time.Now(),
+			BufferSize: s.BufferSize,
+			DropPolicy: s.DropPolicy,
+			App:        s.App,
+			AppUID:     s.AppUID,
+		}
+	})
+	e.log.Info("capture engine starting", "mode", mode, "enrichers", e.Enrichers())
 
-	s := &CaptureStats{
-		Serial:    e.serial,
-		Mode:      mode.String(),
-		StartedAt: time.Now(),
+	if e.class == adb.ClassUnknown {
+		classCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		e.class, _ = e.client.DetectDeviceClass(classCtx, e.serial)
+		cancel()
+	}
+	e.resolver.Snooper().SetDeviceClass(e.class)
+
+	if e.app != nil {
+		// Prepare has looked the app up. Packet captures need its ports;
+		// socket table polls filter by UID themselves.
+		ports := mode != ModeProcNet && mode != ModeSS
+		parser := NewProcNetParser(e.serial)
+		e.refreshApp(ctx, parser, ports)
+		go e.trackApp(ctx, parser, ports)
 	}
-	e.stats.Store(s)
-	e.log.Info("capture engine starting", "mode", mode)
 
 	// Start the resolver for DNS + UID lookups (also starts logcat snooper).
 	e.resolver.Start(ctx)
@@ -99,32 +300,175 @@ func (e *Engine) Run(ctx context.Context) error {
 
 	switch mode {
 	case ModeTcpdump:
-		return e.runTcpdump(ctx)
+		go e.runDNSSniffer(ctx)
+		go e.runQUICSniffer(ctx)
+		return e.superviseStream(ctx, ModeTcpdump, e.runTcpdump)
 	case ModeProcNet:
 		return e.runProcNet(ctx)
+	case ModeSS:
+		return e.runSS(ctx)
+	case ModeVPN:
+		return e.superviseStream(ctx, ModeVPN, e.runVPN)
+	case ModeEmulator:
+		return e.superviseStream(ctx, ModeEmulator, e.runEmulator)
+	case ModeIPTables:
+		return e.superviseStream(ctx, ModeIPTables, e.runIPTables)
 	default:
 		return e.runProcNet(ctx) // safe fallback
 	}
 }
 
-// detectMode checks if tcpdump is available on the device.
+// detectMode picks the richest capture mode the device supports, in order:
+// tcpdump (packets; installed, or deployed on rooted devices), host capture
+// of an emulator whose console is on this host, ss with process names,
+// /proc/net, then ss or netstat without process names for devices where
+// /proc/net is restricted.
 func (e *Engine) detectMode(ctx context.Context) Mode {
+	if e.prepareTcpdump(ctx) {
+		return ModeTcpdump
+	}
+	if emulatorConsoleReachable(e.serial) {
+		e.log.Info("tcpdump not available, capturing emulator traffic on the host")
+		return ModeEmulator
+	}
+
 	checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	out, err := e.client.Shell(checkCtx, e.serial, "which tcpdump 2>/dev/null || command -v tcpdump 2>/dev/null")
-	if err == nil && strings.TrimSpace(out) != "" {
-		e.log.Info("tcpdump available on device", "path", strings.TrimSpace(out))
-		return ModeTcpdump
+	ssOut, ssErr := e.client.Shell(checkCtx, e.serial, ssConnCmd)
+	ssWorks := ssErr == nil && strings.TrimSpace(ssOut) != ""
+	if ssWorks && strings.Contains(ssOut, "users:(") {
+		e.log.Info("tcpdump not available, using ss (process names visible)")
+		return ModeSS
 	}
 
-	e.log.Info("tcpdump not available, falling back to /proc/net/tcp")
+	procOut, err := e.client.Shell(checkCtx, e.serial, "cat /proc/net/tcp 2>/dev/null")
+	if err == nil && strings.Contains(procOut, "local_address") {
+		e.log.Info("tcpdump not available, falling back to /proc/net/tcp")
+		return ModeProcNet
+	}
+
+	if !ssWorks {
+		nsOut, err := e.client.Shell(checkCtx, e.serial, netstatConnCmd)
+		ssWorks = err == nil && strings.TrimSpace(nsOut) != ""
+	}
+	if ssWorks {
+		e.log.Info("/proc/net/tcp not readable, using ss/netstat")
+		return ModeSS
+	}
+
+	e.log.Info("no socket source detected, trying /proc/net/tcp anyway")
 	return ModeProcNet
 }
 
-// runTcpdump streams tcpdump output from the device.
+// openCommandStream starts a long-running command with shell v2 so its exit
+// status survives, falling back to the legacy shell (stderr discarded) on
+// devices without it. exitErr reports an *adb.ExitError once the stream has
+// ended with a non-zero status.
+func (e *Engine) openCommandStream(ctx context.Context, command string) (stream io.ReadCloser, exitErr func() error, err error) {
+	sess, err := e.client.OpenShellV2(ctx, e.serial, command, adb.ShellV2Options{})
+	if err == nil {
+		return countingReader{sess, e}, func() error {
+			code := sess.ExitCode()
+			if code == 0 || code == adb.ShellExitUnknown {
+				return nil
+			}
+			return &adb.ExitError{Command: command, ExitCode: code, Stderr: strings.TrimSpace(sess.Stderr())}
+		}, nil
+	}
+	if !errors.Is(err, adb.ErrShellV2Unsupported) {
+		return nil, nil, err
+	}
+
+	legacy, err := e.client.OpenShellStream(ctx, e.serial, command+" 2>/dev/null")
+	if err != nil {
+		return nil, nil, err
+	}
+	return countingReader{legacy, e}, func() error { return nil }, nil
+}
+
+// openTcpdump starts one of the tcpdump command constants on the device.
+// The process announces its PID first, so closing the stream can kill it
+// explicitly; see tcpdumpProcess. The PID of the packet stream is shown in
+// CaptureStats.
+func (e *Engine) openTcpdump(ctx context.Context, command string) (io.ReadCloser, func() error, error) {
+	stream, exitErr, err := e.openCommandStream(ctx, e.tcpdumpProcessCommand(command))
+	if err != nil {
+		return nil, nil, err
+	}
+	proc, err := e.startTcpdumpProcess(stream, strings.HasPrefix(command, tcpdumpCmd))
+	if err != nil {
+		stream.Close()
+		if xerr := exitErr(); xerr != nil {
+			return nil, nil, xerr
+		}
+		return nil, nil, err
+	}
+	return proc, exitErr, nil
+}
+
+// Cleanup kills the tcpdump processes the capture started that are still
+// running: adbd does not always signal a command whose shell went away,
+// least of all one run through su. Only the PIDs the engine recorded are
+// killed, so a capture started on the device since is left alone. It also
+// removes the iptables log rules of ModeIPTables if the capture could not.
+// Call it after Run has returned.
+func (e *Engine) Cleanup(ctx context.Context) error {
+	if e.iptablesRules.Load() {
+		if err := e.removeIPTablesRules(ctx); err != nil {
+			return err
+		}
+	}
+	e.tcpdumpMu.Lock()
+	pids := make([]int, 0, len(e.tcpdumpPIDs))
+	for pid := range e.tcpdumpPIDs {
+		pids = append(pids, pid)
+	}
+	e.tcpdumpMu.Unlock()
+	if len(pids) == 0 {
+		return nil
+	}
+	if err := e.killTcpdump(ctx, pids...); err != nil {
+		return fmt.Errorf("killing tcpdump: %w", err)
+	}
+	return nil
+}
+
+// runTcpdump streams tcpdump output from the device. An app capture
+// filters it down to the app's ports, and restarts it with a new filter
+// when the app opens sockets on others.
 func (e *Engine) runTcpdump(ctx context.Context) error {
-	stream, err := e.client.OpenShellStream(ctx, e.serial, tcpdumpCmd)
+	if e.app == nil {
+		return e.streamTcpdump(ctx, tcpdumpCmd)
+	}
+	for {
+		filter, grown := e.app.filter()
+		streamCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-grown:
+				// Let a burst of new sockets settle into one restart.
+				select {
+				case <-time.After(appFilterRefresh):
+				case <-streamCtx.Done():
+				}
+				cancel()
+			case <-streamCtx.Done():
+			}
+		}()
+		err := e.streamTcpdump(streamCtx, tcpdumpCmd+" "+adb.ShellQuote(filter))
+		restart := streamCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+		if !restart {
+			return err
+		}
+		e.log.Debug("restarting tcpdump for new app ports", "app", e.app.pkg)
+	}
+}
+
+// streamTcpdump runs tcpdump command and emits the packets it prints.
+func (e *Engine) streamTcpdump(ctx context.Context, command string) error {
+	stream, exitErr, err := e.openTcpdump(ctx, command)
 	if err != nil {
 		return fmt.Errorf("opening tcpdump stream: %w", err)
 	}
@@ -148,21 +492,7 @@ func (e *Engine) runTcpdump(ctx context.Context) error {
 		if pkt == nil {
 			continue
 		}
-
-		// Update stats.
-		s := e.Stats()
-		s.PacketCount++
-		s.LastActivity = time.Now()
-		e.stats.Store(&s)
-
-		select {
-		case e.packetCh <- *pkt:
-		default:
-			// Channel full, drop packet to avoid blocking.
-			s2 := e.Stats()
-			s2.Errors++
-			e.stats.Store(&s2)
-		}
+		e.emitPacket(pkt)
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -171,64 +501,215 @@ func (e *Engine) runTcpdump(ctx context.Context) error {
 		}
 		return fmt.Errorf("reading tcpdump: %w", err)
 	}
+	if err := exitErr(); err != nil {
+		return fmt.Errorf("tcpdump failed: %w", err)
+	}
 
 	return nil
 }
 
+// emitPacket counts pkt and, unless sampling skips it, tags and enriches
+// it and hands it to Packets.
+func (e *Engine) emitPacket(pkt *NetworkPacket) {
+	if e.app != nil && !e.app.ownsPacket(pkt) {
+		return
+	}
+	if !e.sample(pkt) {
+		return
+	}
+	pkt.Source = e.source()
+	e.quic.tag(pkt)
+	e.enrichPacket(pkt)
+
+	send(e, e.packetCh, *pkt, outPackets)
+}
+
+// runDNSSniffer decodes DNS traffic from a second tcpdump stream and feeds
+// the answers to the resolver. Failures only cost the DNS table, so they are
+// logged rather than ending the capture.
+func (e *Engine) runDNSSniffer(ctx context.Context) {
+	stream, exitErr, err := e.openTcpdump(ctx, tcpdumpDNSCmd)
+	if err != nil {
+		e.log.Debug("dns sniffer unavailable", "error", err)
+		return
+	}
+	defer stream.Close()
+
+	sniffer := NewDNSSniffer(e.serial)
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 4096), 64*1024)
+
+	emit := func(l *DNSLookup) {
+		if l == nil {
+			return
+		}
+		e.resolver.LearnDNS(l)
+		send(e, e.dnsCh, *l, outDNSLookups)
+	}
+
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return
+		}
+		emit(sniffer.Feed(scanner.Text()))
+	}
+	emit(sniffer.Flush())
+	if err := exitErr(); err != nil {
+		e.log.Debug("dns sniffer stopped", "error", err)
+	}
+}
+
+// runQUICSniffer reads the server names of QUIC connections from a third
+// tcpdump stream of client Initial packets, so the flows' packets are
+// tagged as QUIC and their server addresses get a hostname. Like the DNS
+// sniffer, it only logs failures.
+func (e *Engine) runQUICSniffer(ctx context.Context) {
+	stream, exitErr, err := e.openTcpdump(ctx, tcpdumpQUICCmd)
+	if err != nil {
+		e.log.Debug("quic sniffer unavailable", "error", err)
+		return
+	}
+	defer stream.Close()
+
+	sniffer := NewQUICSniffer()
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 4096), 64*1024)
+
+	emit := func(h *QUICHello) {
+		if h == nil {
+			return
+		}
+		e.quic.add(h)
+		e.resolver.LearnSNI(h.Server.Addr().String(), h.SNI)
+	}
+
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return
+		}
+		emit(sniffer.Feed(scanner.Text()))
+	}
+	emit(sniffer.Flush())
+	if err := exitErr(); err != nil {
+		e.log.Debug("quic sniffer stopped", "error", err)
+	}
+}
+
 // runProcNet periodically reads /proc/net/tcp to track connections.
 func (e *Engine) runProcNet(ctx context.Context) error {
 	parser := NewProcNetParser(e.serial)
+	return e.pollConnections(ctx, ModeProcNet, func(readCtx context.Context) ([]Connection, bool) {
+		return e.readProcNet(readCtx, parser)
+	})
+}
+
+// runSS periodically lists sockets with ss, or netstat where ss is
+// missing, to track connections together with their owning processes.
+func (e *Engine) runSS(ctx context.Context) error {
+	parser := NewSSParser(e.serial)
+	useNetstat := false
+	return e.pollConnections(ctx, ModeSS, func(readCtx context.Context) ([]Connection, bool) {
+		if !useNetstat {
+			out, err := e.shell(readCtx, ssConnCmd)
+			if err != nil {
+				e.log.Debug("failed to run ss", "error", err)
+				return nil, false
+			}
+			if strings.TrimSpace(out) != "" {
+				return parser.ParseSockets(out), true
+			}
+			e.log.Info("ss produced no output, switching to netstat")
+			useNetstat = true
+		}
+		out, err := e.shell(readCtx, netstatConnCmd)
+		if err != nil {
+			e.log.Debug("failed to run netstat", "error", err)
+			return nil, false
+		}
+		return parser.ParseNetstat(out), true
+	})
+}
+
+// pollConnections reads the connection table with read, immediately and
+// then on every tick, and emits what changed. read reports false when the
+// table could not be read, so the previous state is kept. mode names the
+// Source of the connections.
+func (e *Engine) pollConnections(ctx context.Context, mode Mode, read func(context.Context) ([]Connection, bool)) error {
 	ticker := time.NewTicker(procNetPollInterval)
 	defer ticker.Stop()
 
-	// Known connections for diffing.
+	// Known connections for diffing, and when each was last re-emitted
+	// for a byte counter change.
 	known := make(map[string]Connection)
+	emitted := make(map[string]time.Time)
 
 	// Read immediately, then on interval.
-	e.readAndDiffProcNet(ctx, parser, known)
+	for polls := 0; ; polls++ {
+		readCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		conns, ok := read(readCtx)
+		cancel()
+		if ok {
+			if e.app != nil {
+				conns = slices.DeleteFunc(conns, func(c Connection) bool { return !e.app.ownsConnection(&c) })
+			}
+			for i := range conns {
+				conns[i].Source = mode.String()
+			}
+			e.diffConnections(conns, known, emitted)
+		}
+		if polls%trafficPollEvery == 0 {
+			e.pollTraffic(ctx, known)
+		}
 
-	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-ticker.C:
-			e.readAndDiffProcNet(ctx, parser, known)
 		}
 	}
 }
 
-func (e *Engine) readAndDiffProcNet(ctx context.Context, parser *ProcNetParser, known map[string]Connection) {
-	readCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-
+// readProcNet reads the /proc/net socket tables.
+func (e *Engine) readProcNet(readCtx context.Context, parser *ProcNetParser) ([]Connection, bool) {
 	var conns []Connection
 
 	// Read TCP connections.
-	tcpOut, err := e.client.Shell(readCtx, e.serial, "cat /proc/net/tcp 2>/dev/null")
+	tcpOut, err := e.shell(readCtx, "cat /proc/net/tcp 2>/dev/null")
 	if err != nil {
 		e.log.Debug("failed to read /proc/net/tcp", "error", err)
-		return
+		return nil, false
 	}
 	conns = append(conns, parser.ParseProcNet(tcpOut, ProtoTCP)...)
 
 	// Read TCP6 connections.
-	tcp6Out, err := e.client.Shell(readCtx, e.serial, "cat /proc/net/tcp6 2>/dev/null")
+	tcp6Out, err := e.shell(readCtx, "cat /proc/net/tcp6 2>/dev/null")
 	if err == nil {
 		conns = append(conns, parser.ParseProcNet(tcp6Out, ProtoTCP)...)
 	}
 
 	// Read UDP connections.
-	udpOut, err := e.client.Shell(readCtx, e.serial, "cat /proc/net/udp 2>/dev/null")
+	udpOut, err := e.shell(readCtx, "cat /proc/net/udp 2>/dev/null")
 	if err == nil {
 		conns = append(conns, parser.ParseProcNet(udpOut, ProtoUDP)...)
 	}
 
 	// Read UDP6 connections.
-	udp6Out, err := e.client.Shell(readCtx, e.serial, "cat /proc/net/udp6 2>/dev/null")
+	udp6Out, err := e.shell(readCtx, "cat /proc/net/udp6 2>/dev/null")
 	if err == nil {
 		conns = append(conns, parser.ParseProcNet(udp6Out, ProtoUDP)...)
 	}
 
+	// Attach byte counters and RTT from ss. Not every build ships ss, and
+	// it only covers TCP; without it connections simply carry no volume.
+	if ssOut, err := e.shell(readCtx, ssCmd); err == nil {
+		attachSocketInfo(conns, ParseSS(ssOut))
+	}
+	return conns, true
+}
+
+// diffConnections emits new connections and updates of known ones, and
+// reports connections that are gone as closed.
+func (e *Engine) diffConnections(conns []Connection, known map[string]Connection, emitted map[string]time.Time) {
 	// Diff to find new/changed connections.
 	now := time.Now()
 	seen := make(map[string]struct{}, len(conns))
@@ -238,21 +719,29 @@ func (e *Engine) readAndDiffProcNet(ctx context.Context, parser *ProcNetParser,
 		seen[key] = struct{}{}
 
 		if prev, exists := known[key]; exists {
+			// Keep the first ID so re-emitted updates replace the earlier entry.
+			c.ID = prev.ID
 			c.FirstSeen = prev.FirstSeen
 			c.LastSeen = now
 			// Re-enrich if hostname was missing (snooper may have learned it).
 			if prev.Hostname == "" {
-				e.resolver.EnrichConnection(&c)
-				if c.Hostname != "" {
+				e.enrichConnection(&c)
+				if c.Hostname != "" || c.State != prev.State {
 					// Emit updated connection.
-					select {
-					case e.connCh <- c:
-					default:
-					}
+					send(e, e.connCh, c, outConnections)
 				}
 			} else {
 				c.Hostname = prev.Hostname
 				c.AppName = prev.AppName
+				c.Malicious, c.Threat = prev.Malicious, prev.Threat
+				c.Tags = prev.Tags
+				if c.State != prev.State {
+					emitted[key] = now
+					send(e, e.connCh, c, outConnections)
+				} else if trafficChanged(prev, c) && now.Sub(emitted[key]) >= trafficEmitInterval {
+					emitted[key] = now
+					send(e, e.connCh, c, outConnections)
+				}
 			}
 			known[key] = c
 			continue
@@ -261,39 +750,43 @@ func (e *Engine) readAndDiffProcNet(ctx context.Context, parser *ProcNetParser,
 		// New connection — enrich and emit on both channels.
 		c.FirstSeen = now
 		c.LastSeen = now
-		e.resolver.EnrichConnection(&c)
+		e.enrichConnection(&c)
 		known[key] = c
+		emitted[key] = now
 
-		s := e.Stats()
-		s.ConnCount++
-		s.PacketCount++
-		s.LastActivity = now
-		e.stats.Store(&s)
+		e.updateStats(func(s *CaptureStats) {
+			s.ConnCount++
+			s.PacketCount++
+			s.LastActivity = now
+		})
 
-		select {
-		case e.connCh <- c:
-		default:
-		}
+		send(e, e.connCh, c, outConnections)
 
 		// Also emit as a NetworkPacket so the Packets tab has data.
 		pkt := connToPacket(c)
-		select {
-		case e.packetCh <- pkt:
-		default:
-		}
+		send(e, e.packetCh, pkt, outPackets)
 	}
 
-	// Remove stale connections.
-	for key := range known {
-		if _, ok := seen[key]; !ok {
-			delete(known, key)
+	// Connections that are gone have closed.
+	for key, c := range known {
+		if _, ok := seen[key]; ok {
+			continue
 		}
+		delete(known, key)
+		delete(emitted, key)
+
+		closedAt := now
+		c.ClosedAt = &closedAt
+		c.DurationMs = float64(now.Sub(c.FirstSeen).Milliseconds())
+		send(e, e.closedCh, c, outClosedConnections)
 	}
 }
 
+// connKey identifies a socket across polls; a state change is an update of
+// the same connection.
 func connKey(c Connection) string {
 	return fmt.Sprintf("%s:%d->%s:%d/%s",
-		c.LocalIP, c.LocalPort, c.RemoteIP, c.RemotePort, c.State)
+		c.LocalIP, c.LocalPort, c.RemoteIP, c.RemotePort, c.Protocol)
 }
 
 // drainURLCaptures reads URL events from logcat snooper and emits as network packets.
@@ -311,6 +804,9 @@ func (e *Engine) drainURLCaptures(ctx context.Context) {
 			if !ok {
 				return
 			}
+			if e.app != nil && !e.app.ownsPID(cap.PID) {
+				continue
+			}
 
 			host := extractHostFromURL(cap.URL)
 			path := extractPathFromURL(cap.URL)
@@ -329,6 +825,7 @@ func (e *Engine) drainURLCaptures(ctx context.Context) {
 				HTTPPath:   path,
 				HTTPHost:   host,
 				Flags:      "logcat:" + cap.Tag,
+				Source:     SourceLogcat,
 				Raw:        fmt.Sprintf("%s %s [%s]", method, cap.URL, cap.Tag),
 			}
 
@@ -336,16 +833,14 @@ func (e *Engine) drainURLCaptures(ctx context.Context) {
 			if ip := snooper.LookupDomain(host); ip != "" {
 				pkt.DstIP = ip
 			}
+			e.enrichPacket(&pkt)
 
-			s := e.Stats()
-			s.PacketCount++
-			s.LastActivity = time.Now()
-			e.stats.Store(&s)
+			e.updateStats(func(s *CaptureStats) {
+				s.PacketCount++
+				s.LastActivity = time.Now()
+			})
 
-			select {
-			case e.packetCh <- pkt:
-			default:
-			}
+			send(e, e.packetCh, pkt, outPackets)
 		}
 	}
 }
@@ -383,6 +878,9 @@ func connToPacket(c Connection) NetworkPacket {
 		Protocol:  c.Protocol,
 		Flags:     string(c.State),
 		HTTPHost:  host,
+		Malicious: c.Malicious,
+		Threat:    c.Threat,
+		Source:    c.Source,
 		Raw:       fmt.Sprintf("%s %s:%d -> %s:%d [%s]", c.Protocol, c.LocalIP, c.LocalPort, c.RemoteIP, c.RemotePort, c.State),
 	}
 }
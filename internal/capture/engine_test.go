@@ -0,0 +1,50 @@
+package capture
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEngine_StatsConcurrentUpdates(t *testing.T) {
+	e := newTestEngine()
+	const writers, each = 8, 500
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				e.emitPacket(&NetworkPacket{Serial: "dev1"})
+				e.addBytesRead(10)
+			}
+		}()
+	}
+	wg.Wait()
+
+	st := e.Stats()
+	// Packets beyond the channel buffer are dropped and counted as drops,
+	// but every one is counted.
+	if st.PacketCount != writers*each {
+		t.Errorf("packets = %d, want %d", st.PacketCount, writers*each)
+	}
+	if want := int64(writers*each - DefaultBufferSize); st.Drops.Packets != max(want, 0) {
+		t.Errorf("dropped packets = %d, want %d", st.Drops.Packets, max(want, 0))
+	}
+	if st.BytesRead != writers*each*10 {
+		t.Errorf("bytes read = %d, want %d", st.BytesRead, writers*each*10)
+	}
+}
+
+func TestCountingReader(t *testing.T) {
+	e := newTestEngine()
+	r := countingReader{io.NopCloser(strings.NewReader("0123456789abcdef")), e}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Stats().BytesRead; got != 16 {
+		t.Errorf("bytes read = %d, want 16", got)
+	}
+}
@@ -0,0 +1,122 @@
+package capture
+
+// Enricher adds information to the packets and connections of a capture
+// before the engine emits them: hostnames, app names, threat matches, or
+// whatever an outside lookup knows about an address, such as its owner in
+// an asset database. The engine runs its enrichers in order, so an
+// enricher sees what the ones before it set. They run on the capture's
+// goroutines and must be quick; one shared by several engines must be safe
+// for concurrent use.
+type Enricher interface {
+	// Name identifies the enricher in logs.
+	Name() string
+	EnrichPacket(pkt *NetworkPacket)
+	EnrichConnection(c *Connection)
+}
+
+// DNSEnricher sets the hostnames the resolver knows: packets get the one
+// of their destination, if already learned, connections the one of their
+// remote address, which is looked up in the background if not.
+func DNSEnricher(r *Resolver) Enricher {
+	return dnsEnricher{r}
+}
+
+type dnsEnricher struct{ r *Resolver }
+
+func (dnsEnricher) Name() string { return "dns" }
+
+func (d dnsEnricher) EnrichPacket(pkt *NetworkPacket) {
+	if pkt.HTTPHost == "" {
+		pkt.HTTPHost = d.r.cachedHostname(pkt.DstIP)
+	}
+}
+
+func (d dnsEnricher) EnrichConnection(c *Connection) {
+	if host := d.r.ResolveHostname(c.RemoteIP); host != "" {
+		c.Hostname = host
+	}
+}
+
+// UIDEnricher names the app owning a connection from its UID, or after
+// the process ss reported when the UID has no package, and the app of a
+// packet whose UID the capture knows.
+func UIDEnricher(r *Resolver) Enricher {
+	return uidEnricher{r}
+}
+
+type uidEnricher struct{ r *Resolver }
+
+func (uidEnricher) Name() string { return "uid" }
+
+func (u uidEnricher) EnrichPacket(pkt *NetworkPacket) {
+	if pkt.UID > 0 && pkt.App == "" {
+		pkt.App = u.r.ResolvePackageName(pkt.UID)
+	}
+}
+
+func (u uidEnricher) EnrichConnection(c *Connection) {
+	if pkg := u.r.ResolvePackageName(c.UID); pkg != "" {
+		c.AppName = pkg
+	} else if c.AppName == "" {
+		c.AppName = c.Process
+	}
+}
+
+// ThreatEnricher marks traffic that m matches as malicious. Put it after
+// the DNS enricher so hostnames are matched too.
+func ThreatEnricher(m ThreatMatcher) Enricher {
+	return threatEnricher{m}
+}
+
+type threatEnricher struct{ m ThreatMatcher }
+
+func (threatEnricher) Name() string { return "threat" }
+
+// EnrichPacket matches the destination and host, then the source address.
+func (t threatEnricher) EnrichPacket(pkt *NetworkPacket) {
+	if threat, ok := t.m.MatchThreat(pkt.DstIP, pkt.HTTPHost); ok {
+		pkt.Malicious, pkt.Threat = true, threat
+	} else if threat, ok := t.m.MatchThreat(pkt.SrcIP, ""); ok {
+		pkt.Malicious, pkt.Threat = true, threat
+	}
+}
+
+func (t threatEnricher) EnrichConnection(c *Connection) {
+	c.Threat, c.Malicious = t.m.MatchThreat(c.RemoteIP, c.Hostname)
+}
+
+// SetEnrichers replaces the engine's enrichers, which are DNSEnricher and
+// UIDEnricher of its resolver by default, followed by the threat matcher
+// and added enrichers. Call before Run.
+func (e *Engine) SetEnrichers(enrichers ...Enricher) {
+	e.enrichers = enrichers
+}
+
+// AddEnricher appends en to the engine's enrichers. Call before Run.
+func (e *Engine) AddEnricher(en Enricher) {
+	e.enrichers = append(e.enrichers, en)
+}
+
+// Enrichers returns the names of the engine's enrichers, in the order
+// they run.
+func (e *Engine) Enrichers() []string {
+	names := make([]string, len(e.enrichers))
+	for i, en := range e.enrichers {
+		names[i] = en.Name()
+	}
+	return names
+}
+
+// enrichPacket runs pkt through the enrichers.
+func (e *Engine) enrichPacket(pkt *NetworkPacket) {
+	for _, en := range e.enrichers {
+		en.EnrichPacket(pkt)
+	}
+}
+
+// enrichConnection runs c through the enrichers.
+func (e *Engine) enrichConnection(c *Connection) {
+	for _, en := range e.enrichers {
+		en.EnrichConnection(c)
+	}
+}
@@ -0,0 +1,68 @@
+package capture
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// cmdbEnricher stands in for an outside lookup, tagging addresses it owns.
+type cmdbEnricher struct{ owners map[string]string }
+
+func (cmdbEnricher) Name() string { return "cmdb" }
+
+func (c cmdbEnricher) EnrichPacket(pkt *NetworkPacket) {
+	if owner, ok := c.owners[pkt.DstIP]; ok {
+		pkt.Tags = map[string]string{"owner": owner}
+	}
+}
+
+func (c cmdbEnricher) EnrichConnection(conn *Connection) {
+	if owner, ok := c.owners[conn.RemoteIP]; ok {
+		conn.Tags = map[string]string{"owner": owner, "app": conn.AppName}
+	}
+}
+
+type listMatcher map[string]string
+
+func (l listMatcher) MatchThreat(ip, host string) (string, bool) {
+	if t, ok := l[host]; ok {
+		return t, true
+	}
+	t, ok := l[ip]
+	return t, ok
+}
+
+func TestEngine_Enrichers(t *testing.T) {
+	e := newTestEngine()
+	e.resolver.uidCache[10123] = "com.example.app"
+	e.resolver.LearnSNI("93.184.216.34", "example.com")
+	e.SetThreatMatcher(listMatcher{"example.com": "feed:example.com"})
+	e.AddEnricher(cmdbEnricher{owners: map[string]string{"93.184.216.34": "payments"}})
+
+	if got, want := e.Enrichers(), []string{"dns", "uid", "threat", "cmdb"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("enrichers = %v, want %v", got, want)
+	}
+
+	e.diffConnections([]Connection{{ID: "c1", Serial: "dev1", RemoteIP: "93.184.216.34", RemotePort: 443,
+		State: ConnEstablished, Protocol: ProtoTCP, UID: 10123}}, map[string]Connection{}, map[string]time.Time{})
+	c := <-e.connCh
+	if c.Hostname != "example.com" || c.AppName != "com.example.app" || !c.Malicious {
+		t.Errorf("connection = %+v", c)
+	}
+	// Later enrichers see what earlier ones set.
+	if c.Tags["owner"] != "payments" || c.Tags["app"] != "com.example.app" {
+		t.Errorf("tags = %v", c.Tags)
+	}
+
+	pkt := NetworkPacket{Serial: "dev1", SrcIP: "10.0.0.2", DstIP: "93.184.216.34", Protocol: ProtoTCP}
+	e.enrichPacket(&pkt)
+	if pkt.HTTPHost != "example.com" || pkt.Threat != "feed:example.com" || pkt.Tags["owner"] != "payments" {
+		t.Errorf("packet = %+v", pkt)
+	}
+
+	e.SetEnrichers(UIDEnricher(e.resolver))
+	if got := e.Enrichers(); !reflect.DeepEqual(got, []string{"uid"}) {
+		t.Errorf("replaced enrichers = %v", got)
+	}
+}
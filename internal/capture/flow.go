@@ -0,0 +1,74 @@
+package capture
+
+import "time"
+
+// SourceLogcat is the Source of packets made up from URLs apps logged.
+// The other sources are capture mode names (Mode.String).
+const SourceLogcat = "logcat"
+
+// MaxFlowRequests bounds the HTTP requests listed in a Flow; the latest
+// are kept.
+const MaxFlowRequests = 50
+
+// Flow is one conversation of a device with a remote endpoint, merged from
+// every record of it: the connection read from the socket table, the
+// packets captured on the wire and the URLs apps logged. It unifies the
+// packet and connection views of the same traffic.
+type Flow struct {
+	ID         string   `json:"id"`
+	Serial     string   `json:"serial"`
+	Protocol   Protocol `json:"protocol"`
+	LocalIP    string   `json:"local_ip,omitempty"`
+	LocalPort  uint16   `json:"local_port,omitempty"`
+	RemoteIP   string   `json:"remote_ip,omitempty"`
+	RemotePort uint16   `json:"remote_port,omitempty"`
+	// Sources lists the captures the flow was seen by, as in
+	// NetworkPacket.Source: tcpdump, vpn, emulator, procnet, ss, logcat.
+	Sources []string `json:"sources"`
+
+	// State is the last TCP state of the socket, when it was read from
+	// the socket table. ClosedAt is set once the socket is gone, or a
+	// FIN or RST was captured.
+	State      ConnState  `json:"state,omitempty"`
+	FirstSeen  time.Time  `json:"first_seen"`
+	LastSeen   time.Time  `json:"last_seen"`
+	ClosedAt   *time.Time `json:"closed_at,omitempty"`
+	DurationMs float64    `json:"duration_ms"`
+
+	Hostname string `json:"hostname,omitempty"`
+	AppName  string `json:"app_name,omitempty"`
+	// UID is the owning app's UID, -1 when unknown.
+	UID     int    `json:"uid"`
+	PID     int    `json:"pid,omitempty"`
+	Process string `json:"process,omitempty"`
+
+	// Packets and Bytes count the packets captured on the wire and their
+	// length; BytesSent, BytesReceived and RTTMs are the socket's own
+	// counters.
+	Packets       int     `json:"packets"`
+	Bytes         int64   `json:"bytes"`
+	BytesSent     uint64  `json:"bytes_sent,omitempty"`
+	BytesReceived uint64  `json:"bytes_received,omitempty"`
+	RTTMs         float64 `json:"rtt_ms,omitempty"`
+
+	// ProtocolHint is "h2" or "grpc" when a packet looked like cleartext
+	// HTTP/2 or gRPC; Requests are the HTTP requests and responses seen.
+	ProtocolHint string        `json:"protocol_hint,omitempty"`
+	Requests     []FlowRequest `json:"requests,omitempty"`
+
+	Malicious bool   `json:"malicious,omitempty"`
+	Threat    string `json:"threat,omitempty"`
+
+	// ConnectionID is the ID of the flow's connection record, if any.
+	ConnectionID string `json:"connection_id,omitempty"`
+}
+
+// FlowRequest is an HTTP request or response of a flow.
+type FlowRequest struct {
+	Timestamp time.Time `json:"timestamp"`
+	Source    string    `json:"source,omitempty"`
+	Method    string    `json:"method,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	Status    int       `json:"status,omitempty"`
+}
@@ -0,0 +1,141 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// HTTP/2 and gRPC detection. Cleartext HTTP/2 (h2c, as gRPC often runs on
+// internal and emulator networks) starts with the connection preface and
+// is a sequence of length-prefixed frames after it; gRPC is HTTP/2 whose
+// headers carry content-type application/grpc and whose DATA frames hold
+// length-prefixed messages. TLS-wrapped HTTP/2 is opaque and not detected.
+
+// Protocol hints of NetworkPacket.ProtocolHint.
+const (
+	HintH2   = "h2"
+	HintGRPC = "grpc"
+)
+
+const (
+	// h2Preface opens every HTTP/2 connection.
+	h2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	// h2MaxFrame is the largest frame a peer may send without raising
+	// SETTINGS_MAX_FRAME_SIZE, which mobile clients rarely do.
+	h2MaxFrame = 16384
+	// h2MaxFrames caps the frame types reported per packet.
+	h2MaxFrames = 8
+)
+
+// h2FrameTypes names the frame types of RFC 9113, by type code.
+var h2FrameTypes = []string{
+	"DATA", "HEADERS", "PRIORITY", "RST_STREAM", "SETTINGS",
+	"PUSH_PROMISE", "PING", "GOAWAY", "WINDOW_UPDATE", "CONTINUATION",
+}
+
+// DetectH2 looks for HTTP/2 frames at the start of a TCP payload. It
+// returns the protocol hint ("" if the payload is not HTTP/2) and the types
+// of the frames it holds, in order. A frame cut off by the capture still
+// counts once its header is valid.
+func DetectH2(payload []byte) (hint string, frames []string) {
+	p := payload
+	preface := bytes.HasPrefix(p, []byte(h2Preface))
+	if preface {
+		p = p[len(h2Preface):]
+	}
+
+	grpc := false
+	for len(p) >= 9 && len(frames) < h2MaxFrames {
+		length := int(p[0])<<16 | int(p[1])<<8 | int(p[2])
+		typ, flags := p[3], p[4]
+		stream := binary.BigEndian.Uint32(p[5:9])
+		if length > h2MaxFrame || int(typ) >= len(h2FrameTypes) || stream&0x80000000 != 0 || !h2StreamValid(typ, stream) {
+			break
+		}
+		body := p[9:min(len(p), 9+length)]
+		switch typ {
+		case 0x0: // DATA
+			grpc = grpc || grpcMessage(h2Unpad(body, flags), length)
+		case 0x1: // HEADERS
+			// Header names and values are HPACK literals unless indexed
+			// or Huffman-coded, which leaves plain text to match often
+			// enough, and always for grpc-* names on first use.
+			grpc = grpc || bytes.Contains(body, []byte("application/grpc")) || bytes.Contains(body, []byte("grpc-"))
+		}
+		frames = append(frames, h2FrameTypes[typ])
+		p = p[len(body)+9:]
+	}
+
+	if len(frames) == 0 {
+		if preface {
+			return HintH2, nil
+		}
+		return "", nil
+	}
+	// Without the preface one frame header is weak evidence: require a
+	// second frame, or one that runs to the end of the payload.
+	if !preface && len(frames) == 1 && len(p) != 0 {
+		return "", nil
+	}
+	if grpc {
+		return HintGRPC, frames
+	}
+	return HintH2, frames
+}
+
+// h2StreamValid checks the stream identifier rules of each frame type:
+// connection-level frames use stream 0, stream-level frames do not.
+func h2StreamValid(typ byte, stream uint32) bool {
+	switch typ {
+	case 0x4, 0x6, 0x7: // SETTINGS, PING, GOAWAY
+		return stream == 0
+	case 0x8: // WINDOW_UPDATE
+		return true
+	default:
+		return stream != 0
+	}
+}
+
+// h2Unpad strips the padding length of a padded DATA frame (flag 0x8).
+func h2Unpad(body []byte, flags byte) []byte {
+	if flags&0x8 == 0 || len(body) == 0 {
+		return body
+	}
+	return body[1:]
+}
+
+// grpcMessage reports whether a DATA frame of length bytes starts with a
+// gRPC length-prefixed message: a compressed flag of 0 or 1 and a length
+// that fits the frame.
+func grpcMessage(body []byte, length int) bool {
+	if len(body) < 5 || body[0] > 1 {
+		return false
+	}
+	n := int(binary.BigEndian.Uint32(body[1:5]))
+	// A message fills the frame, or continues in the next DATA frames.
+	return n+5 == length || n+5 > length && n < 4<<20
+}
+
+// detectH2Text finds HTTP/2 and gRPC in a tcpdump -A line, where bytes
+// outside printable ASCII show as dots: the preface, an h2c upgrade and
+// gRPC content types survive that.
+func detectH2Text(line string) string {
+	switch {
+	case strings.Contains(line, "PRI * HTTP/2.0"):
+		return HintH2
+	case containsFold(line, "application/grpc"):
+		return HintGRPC
+	case len(line) > 8 && strings.EqualFold(line[:8], "upgrade:") && containsFold(line, "h2c"):
+		return HintH2
+	}
+	return ""
+}
+
+// setProtocolHint records hint on pkt; gRPC is the more specific hint and
+// is never downgraded.
+func setProtocolHint(pkt *NetworkPacket, hint string) {
+	if hint != "" && pkt.ProtocolHint != HintGRPC {
+		pkt.ProtocolHint = hint
+	}
+}
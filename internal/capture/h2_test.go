@@ -0,0 +1,77 @@
+package capture
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+	"time"
+)
+
+// h2Frame encodes one HTTP/2 frame.
+func h2Frame(typ, flags byte, stream uint32, body []byte) []byte {
+	b := []byte{byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body)), typ, flags}
+	b = binary.BigEndian.AppendUint32(b, stream)
+	return append(b, body...)
+}
+
+// grpcMsg frames msg as a gRPC length-prefixed message.
+func grpcMsg(msg string) []byte {
+	b := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(msg)))
+	return append(b, msg...)
+}
+
+func TestDetectH2(t *testing.T) {
+	concat := func(parts ...[]byte) []byte { return slices.Concat(parts...) }
+	settings := h2Frame(0x4, 0, 0, make([]byte, 12))
+	// A literal content-type header, as HPACK sends it unindexed and
+	// without Huffman coding.
+	headers := h2Frame(0x1, 0x4, 1, []byte("\x40\x0ccontent-type\x10application/grpc"))
+	data := grpcMsg("\x0a\x05hello")
+
+	tests := []struct {
+		name       string
+		payload    []byte
+		wantHint   string
+		wantFrames []string
+	}{
+		{"preface", concat([]byte(h2Preface), settings), HintH2, []string{"SETTINGS"}},
+		{"preface only", []byte(h2Preface), HintH2, nil},
+		{"grpc request", concat(headers, h2Frame(0x0, 0x1, 1, data)), HintGRPC, []string{"HEADERS", "DATA"}},
+		{"grpc data alone", h2Frame(0x0, 0, 3, data), HintGRPC, []string{"DATA"}},
+		{"plain h2 response", concat(h2Frame(0x1, 0x4, 1, []byte{0x88}), h2Frame(0x0, 0x1, 1, []byte("<html>"))), HintH2, []string{"HEADERS", "DATA"}},
+		{"truncated frame", h2Frame(0x0, 0, 5, make([]byte, 4000))[:300], HintH2, []string{"DATA"}},
+		{"tls record", []byte{0x17, 0x03, 0x03, 0x00, 0x40, 1, 2, 3, 4, 5, 6}, "", nil},
+		{"http/1.1", []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), "", nil},
+		{"settings on a stream", concat(h2Frame(0x4, 0, 1, nil), settings), "", nil},
+		{"one frame then garbage", concat(h2Frame(0x6, 0, 0, make([]byte, 8)), []byte{0xff, 0xff, 0xff}), "", nil},
+	}
+	for _, tt := range tests {
+		hint, frames := DetectH2(tt.payload)
+		if hint != tt.wantHint || !slices.Equal(frames, tt.wantFrames) {
+			t.Errorf("%s: got %q %v, want %q %v", tt.name, hint, frames, tt.wantHint, tt.wantFrames)
+		}
+	}
+}
+
+func TestTcpdumpParser_H2Hints(t *testing.T) {
+	p := NewTcpdumpParser("dev1")
+	pkt := p.ParseLine("12:34:56.789012 IP 10.0.0.2.40000 > 10.0.2.2.8080: tcp 24")
+	p.EnrichWithHTTP(pkt, "E..L..@.@.....PRI * HTTP/2.0")
+	if pkt.ProtocolHint != HintH2 || pkt.HTTPMethod != "" {
+		t.Errorf("preface: %+v", pkt)
+	}
+	p.EnrichWithHTTP(pkt, "..content-type..application/grpc+proto")
+	p.EnrichWithHTTP(pkt, "Upgrade: h2c")
+	if pkt.ProtocolHint != HintGRPC {
+		t.Errorf("grpc: hint %q", pkt.ProtocolHint)
+	}
+}
+
+func TestVPNDecoder_H2(t *testing.T) {
+	d := newVPNDecoder("dev1")
+	payload := slices.Concat([]byte(h2Preface), h2Frame(0x4, 0, 0, nil), h2Frame(0x1, 0x4, 1, []byte("\x00\x0bgrpc-timeout\x021S")))
+	pkt := d.decode(ipv4TCP([4]byte{10, 0, 0, 2}, [4]byte{10, 0, 2, 2}, 40000, 50051, 0x18, payload), time.Now())
+	if pkt == nil || pkt.ProtocolHint != HintGRPC || !slices.Equal(pkt.H2Frames, []string{"SETTINGS", "HEADERS"}) {
+		t.Fatalf("got %+v", pkt)
+	}
+}
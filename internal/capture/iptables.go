@@ -0,0 +1,305 @@
+package capture
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+// ModeIPTables has the device's firewall log new connections to the kernel
+// log and reads them back, which gives the UID of every outgoing flow, and
+// whether the firewall let it out, on rooted devices where tcpdump is not
+// allowed or not wanted. NFLOG would hand the packets to a netlink
+// listener, which a shell session cannot be; the LOG target writes the
+// same metadata to the kernel log instead.
+//
+// Per chain (OUTPUT, INPUT) and family (iptables, ip6tables) two rules are
+// added, both logging packets that open a connection: one inserted at the
+// top of the chain, one appended at its end. A packet logged by both made
+// it through the chain, one logged only at the top was dropped by a rule
+// in between, like the per-app rules of Android's firewall. The log prefix
+// carries a per-capture tag, so lines of earlier captures still in the
+// kernel log are ignored:
+//
+//	adbm<tag>>o   top of OUTPUT     adbm<tag>=o   end of OUTPUT
+//	adbm<tag>>i   top of INPUT      adbm<tag>=i   end of INPUT
+const (
+	iptablesPrefix = "adbm"
+	// iptablesVerdictWait is how long a packet logged at the top of a
+	// chain waits for the log line of its end before it counts as dropped.
+	// Both lines are written on the same path through the kernel, so the
+	// second follows within microseconds when there is one.
+	iptablesVerdictWait = time.Second
+	// iptablesLogCmd follows the kernel log. It is run as root because
+	// dmesg_restrict hides the log from the shell user.
+	iptablesLogCmd = "dmesg -w"
+)
+
+// Verdicts of the packets ModeIPTables reports.
+const (
+	VerdictAccept = "accept"
+	VerdictDrop   = "drop"
+)
+
+// iptablesChains are the chains ModeIPTables logs, with the letter naming
+// them in the log prefix.
+var iptablesChains = []struct{ name, dir string }{{"OUTPUT", "o"}, {"INPUT", "i"}}
+
+// newIPTablesTag returns a random tag for the log prefix of one capture.
+func newIPTablesTag() string {
+	b := make([]byte, 2)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// iptablesAddScript returns the commands adding the logging rules of tag.
+func iptablesAddScript(tag string) string {
+	var cmds []string
+	for _, t := range []string{"iptables", "ip6tables"} {
+		for _, c := range iptablesChains {
+			rule := func(mark string) string {
+				return fmt.Sprintf("-m state --state NEW -j LOG --log-uid --log-prefix %s",
+					adb.ShellQuote(iptablesPrefix+tag+mark+c.dir+" "))
+			}
+			cmds = append(cmds,
+				fmt.Sprintf("%s -w -I %s 1 %s", t, c.name, rule(">")),
+				fmt.Sprintf("%s -w -A %s %s", t, c.name, rule("=")))
+		}
+	}
+	return strings.Join(cmds, " && ")
+}
+
+// iptablesRemoveScript deletes every logging rule ModeIPTables added, of
+// this capture or of one that never got to clean up: each rule iptables -S
+// lists with the prefix is deleted by its spec.
+const iptablesRemoveScript = `for t in iptables ip6tables; do for c in OUTPUT INPUT; do ` +
+	`$t -w -S $c 2>/dev/null | grep -- '--log-prefix "` + iptablesPrefix + `' | sed 's/^-A /-D /' | ` +
+	`while read -r r; do eval "$t -w $r"; done; done; done`
+
+// runIPTables adds the logging rules, follows the kernel log until ctx is
+// cancelled or the log ends, and removes the rules again.
+func (e *Engine) runIPTables(ctx context.Context) error {
+	if e.root == rootNone {
+		return errors.New("iptables capture needs root")
+	}
+	tag := newIPTablesTag()
+	e.iptablesRules.Store(true)
+	// The rules must go when ctx is cancelled too.
+	cleanupCtx := context.WithoutCancel(ctx)
+	defer func() {
+		cctx, cancel := context.WithTimeout(cleanupCtx, 10*time.Second)
+		defer cancel()
+		if err := e.removeIPTablesRules(cctx); err != nil {
+			e.log.Warn("failed to remove iptables log rules", "error", err)
+		}
+	}()
+	if err := e.removeIPTablesRules(ctx); err != nil {
+		return err
+	}
+	res, err := e.client.ShellV2(ctx, e.serial, e.root.wrap(iptablesAddScript(tag)))
+	if err == nil {
+		err = res.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("adding iptables log rules: %w", err)
+	}
+
+	stream, exitErr, err := e.openCommandStream(ctx, e.root.wrap(iptablesLogCmd))
+	if err != nil {
+		return fmt.Errorf("following kernel log: %w", err)
+	}
+	defer stream.Close()
+	e.log.Info("iptables log rules added", "tag", tag, "root", e.root)
+
+	parser := NewIPTablesParser(e.serial, tag)
+	lines := make(chan string)
+	scanErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(stream)
+		sc.Buffer(make([]byte, 4096), 64*1024)
+		for sc.Scan() {
+			select {
+			case lines <- sc.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		scanErr <- sc.Err()
+	}()
+
+	// Packets dropped in a chain only show up once their wait is over.
+	ticker := time.NewTicker(iptablesVerdictWait / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			for _, pkt := range parser.Expire(now) {
+				e.emitPacket(pkt)
+			}
+		case line, ok := <-lines:
+			if !ok {
+				if err := <-scanErr; err != nil {
+					return fmt.Errorf("reading kernel log: %w", err)
+				}
+				if err := exitErr(); err != nil {
+					return fmt.Errorf("dmesg failed: %w", err)
+				}
+				return nil
+			}
+			for _, pkt := range parser.ParseLine(line, time.Now()) {
+				e.emitPacket(pkt)
+			}
+		}
+	}
+}
+
+// removeIPTablesRules deletes the logging rules of ModeIPTables.
+func (e *Engine) removeIPTablesRules(ctx context.Context) error {
+	res, err := e.client.ShellV2(ctx, e.serial, e.root.wrap(iptablesRemoveScript))
+	if err == nil {
+		err = res.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("removing iptables log rules: %w", err)
+	}
+	return nil
+}
+
+// IPTablesParser turns the kernel log lines of ModeIPTables into packets.
+// Their Length is the IP packet length the log reports, headers included.
+type IPTablesParser struct {
+	serial string
+	// prefix is the log prefix of the capture, without the mark.
+	prefix string
+	nextID uint64
+	// pending holds the packets logged at the top of a chain, by flow,
+	// until the end of the chain logs them too or their wait is over.
+	pending map[string]*pendingVerdict
+}
+
+type pendingVerdict struct {
+	pkt   *NetworkPacket
+	since time.Time
+}
+
+// NewIPTablesParser returns a parser for the log lines of the capture with
+// the given tag.
+func NewIPTablesParser(serial, tag string) *IPTablesParser {
+	return &IPTablesParser{serial: serial, prefix: iptablesPrefix + tag, pending: make(map[string]*pendingVerdict)}
+}
+
+// ParseLine reads one kernel log line and returns the packets whose
+// verdict is now known, among them those whose wait ended before now.
+func (p *IPTablesParser) ParseLine(line string, now time.Time) []*NetworkPacket {
+	out := p.Expire(now)
+	i := strings.Index(line, p.prefix)
+	if i < 0 || len(line) < i+len(p.prefix)+2 {
+		return out
+	}
+	mark, dir := line[i+len(p.prefix)], line[i+len(p.prefix)+1]
+	fields := logFields(line[i+len(p.prefix)+2:])
+	pkt := p.packet(fields, now)
+	if pkt == nil {
+		return out
+	}
+	key := string(dir) + " " + pkt.SrcIP + " " + strconv.Itoa(int(pkt.SrcPort)) + " " +
+		pkt.DstIP + " " + strconv.Itoa(int(pkt.DstPort)) + " " + string(pkt.Protocol) + " " + fields["ID"]
+	switch mark {
+	case '>':
+		if prev, ok := p.pending[key]; ok {
+			// A retransmission before the first made it through.
+			prev.pkt.Verdict = VerdictDrop
+			out = append(out, p.finish(prev.pkt))
+		}
+		p.pending[key] = &pendingVerdict{pkt: pkt, since: now}
+	case '=':
+		if prev, ok := p.pending[key]; ok {
+			delete(p.pending, key)
+			pkt = prev.pkt
+		}
+		pkt.Verdict = VerdictAccept
+		out = append(out, p.finish(pkt))
+	}
+	return out
+}
+
+// Expire returns the packets that waited for the end of their chain
+// longer than iptablesVerdictWait, as dropped.
+func (p *IPTablesParser) Expire(now time.Time) []*NetworkPacket {
+	var out []*NetworkPacket
+	for key, v := range p.pending {
+		if now.Sub(v.since) >= iptablesVerdictWait {
+			delete(p.pending, key)
+			v.pkt.Verdict = VerdictDrop
+			out = append(out, p.finish(v.pkt))
+		}
+	}
+	return out
+}
+
+func (p *IPTablesParser) finish(pkt *NetworkPacket) *NetworkPacket {
+	p.nextID++
+	pkt.ID = p.serial + "-" + strconv.FormatUint(p.nextID, 10)
+	return pkt
+}
+
+// packet builds a packet from the fields of a LOG line, or returns nil if
+// they lack the addresses.
+func (p *IPTablesParser) packet(f map[string]string, now time.Time) *NetworkPacket {
+	if f["SRC"] == "" || f["DST"] == "" {
+		return nil
+	}
+	pkt := &NetworkPacket{
+		Serial:    p.serial,
+		Timestamp: now,
+		SrcIP:     NormalizeIP(f["SRC"]),
+		DstIP:     NormalizeIP(f["DST"]),
+		Protocol:  Protocol(f["PROTO"]),
+	}
+	pkt.Length, _ = strconv.Atoi(f["LEN"])
+	pkt.UID, _ = strconv.Atoi(f["UID"])
+	if port, err := strconv.ParseUint(f["SPT"], 10, 16); err == nil {
+		pkt.SrcPort = uint16(port)
+	}
+	if port, err := strconv.ParseUint(f["DPT"], 10, 16); err == nil {
+		pkt.DstPort = uint16(port)
+	}
+	switch pkt.Protocol {
+	case ProtoTCP:
+		// In tcpdump's notation, as the other modes report them.
+		var bits byte
+		for i, flag := range []string{"FIN", "SYN", "RST", "PSH", "ACK", "URG", "ECE", "CWR"} {
+			if _, ok := f[flag]; ok {
+				bits |= 1 << i
+			}
+		}
+		pkt.Flags = tcpFlags(bits)
+	case "ICMP", "ICMPv6":
+		pkt.Protocol = ProtoICMP
+	}
+	return pkt
+}
+
+// logFields splits the KEY=value and bare flag words of a LOG line. The
+// first of repeated keys is kept: LEN is the IP length, then the UDP one.
+func logFields(s string) map[string]string {
+	fields := make(map[string]string)
+	for _, word := range strings.Fields(s) {
+		k, v, _ := strings.Cut(word, "=")
+		if _, ok := fields[k]; !ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
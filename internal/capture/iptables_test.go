@@ -0,0 +1,64 @@
+package capture
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIPTablesParser(t *testing.T) {
+	p := NewIPTablesParser("dev1", "1f2e")
+	now := time.Unix(1700000000, 0)
+	out := `[ 4242.123456] adbm1f2e>o IN= OUT=wlan0 SRC=10.0.0.2 DST=93.184.216.34 LEN=60 TOS=0x00 PREC=0x00 TTL=64 ID=4711 DF PROTO=TCP SPT=40000 DPT=443 WINDOW=65535 RES=0x00 SYN URGP=0 UID=10123 GID=10123 `
+	blocked := `[ 4242.200000] adbm1f2e>o IN= OUT=wlan0 SRC=2001:0db8:0000:0000:0000:0000:0000:0002 DST=2606:4700::1111 LEN=76 TC=0 HOPLIMIT=64 FLOWLBL=0 PROTO=UDP SPT=5000 DPT=53 LEN=36 UID=10200 GID=10200 `
+
+	if got := p.ParseLine(out, now); len(got) != 0 {
+		t.Fatalf("top of chain alone emitted %+v", got)
+	}
+	if got := p.ParseLine(blocked, now); len(got) != 0 {
+		t.Fatalf("top of chain alone emitted %+v", got)
+	}
+	// An earlier capture's line is ignored.
+	if got := p.ParseLine(strings.Replace(out, "1f2e", "0000", 1), now); len(got) != 0 {
+		t.Fatalf("stale line emitted %+v", got)
+	}
+
+	got := p.ParseLine(strings.Replace(out, "adbm1f2e>o", "adbm1f2e=o", 1), now.Add(time.Millisecond))
+	if len(got) != 1 {
+		t.Fatalf("accepted = %+v", got)
+	}
+	pkt := got[0]
+	if pkt.Verdict != VerdictAccept || pkt.UID != 10123 || pkt.Protocol != ProtoTCP || pkt.Flags != "S" ||
+		pkt.SrcIP != "10.0.0.2" || pkt.SrcPort != 40000 || pkt.DstIP != "93.184.216.34" || pkt.DstPort != 443 ||
+		pkt.Length != 60 || pkt.ID != "dev1-1" || !pkt.Timestamp.Equal(now) {
+		t.Errorf("accepted packet = %+v", pkt)
+	}
+
+	if got := p.Expire(now.Add(iptablesVerdictWait / 2)); len(got) != 0 {
+		t.Fatalf("expired early: %+v", got)
+	}
+	got = p.Expire(now.Add(iptablesVerdictWait))
+	if len(got) != 1 {
+		t.Fatalf("dropped = %+v", got)
+	}
+	pkt = got[0]
+	if pkt.Verdict != VerdictDrop || pkt.UID != 10200 || pkt.Protocol != ProtoUDP || pkt.DstPort != 53 || pkt.Length != 76 ||
+		pkt.SrcIP != NormalizeIP("2001:db8::2") {
+		t.Errorf("dropped packet = %+v", pkt)
+	}
+}
+
+func TestIPTablesScripts(t *testing.T) {
+	add := iptablesAddScript("1f2e")
+	for _, want := range []string{
+		`iptables -w -I OUTPUT 1 -m state --state NEW -j LOG --log-uid --log-prefix 'adbm1f2e>o '`,
+		`ip6tables -w -A INPUT -m state --state NEW -j LOG --log-uid --log-prefix 'adbm1f2e=i '`,
+	} {
+		if !strings.Contains(add, want) {
+			t.Errorf("add script lacks %q:\n%s", want, add)
+		}
+	}
+	if !strings.Contains(iptablesRemoveScript, `--log-prefix "adbm`) {
+		t.Errorf("remove script = %s", iptablesRemoveScript)
+	}
+}
@@ -0,0 +1,266 @@
+//go:build !gopacket
+
+package capture
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"strings"
+)
+
+// The link, IP, UDP and DNS layers of the packets the host sees whole
+// (emulator and vpn captures, tcpdump -x hex dumps) are decoded here by
+// hand. Building with -tags gopacket decodes them with gopacket instead;
+// see layers_gopacket.go.
+
+// linkPayload strips the link-layer header of a frame, returning nil for
+// frames that carry no IP packet.
+func linkPayload(linkType uint32, frame []byte) []byte {
+	var etherType uint16
+	switch linkType {
+	case linkTypeRaw:
+		return frame
+	case linkTypeEthernet:
+		if len(frame) < 14 {
+			return nil
+		}
+		etherType, frame = binary.BigEndian.Uint16(frame[12:14]), frame[14:]
+		if etherType == 0x8100 && len(frame) >= 4 { // 802.1Q tag
+			etherType, frame = binary.BigEndian.Uint16(frame[2:4]), frame[4:]
+		}
+	case linkTypeLinuxSLL:
+		if len(frame) < 16 {
+			return nil
+		}
+		etherType, frame = binary.BigEndian.Uint16(frame[14:16]), frame[16:]
+	}
+	if etherType != 0x0800 && etherType != 0x86DD {
+		return nil
+	}
+	return frame
+}
+
+// decodeIP returns the addresses, transport protocol and transport segment
+// of an IPv4 or IPv6 packet. IPv6 extension headers are skipped; fragments
+// other than the first carry no transport header and are rejected.
+func decodeIP(b []byte) (src, dst netip.Addr, proto byte, l4 []byte, ok bool) {
+	if len(b) < 1 {
+		return src, dst, 0, nil, false
+	}
+	switch b[0] >> 4 {
+	case 4:
+		ihl := int(b[0]&0x0F) * 4
+		if ihl < 20 || len(b) < ihl {
+			return src, dst, 0, nil, false
+		}
+		if binary.BigEndian.Uint16(b[6:8])&0x1FFF != 0 {
+			return src, dst, 0, nil, false
+		}
+		end := int(binary.BigEndian.Uint16(b[2:4]))
+		if end < ihl || end > len(b) {
+			end = len(b)
+		}
+		src = netip.AddrFrom4([4]byte(b[12:16]))
+		dst = netip.AddrFrom4([4]byte(b[16:20]))
+		return src, dst, b[9], b[ihl:end], true
+	case 6:
+		if len(b) < 40 {
+			return src, dst, 0, nil, false
+		}
+		end := 40 + int(binary.BigEndian.Uint16(b[4:6]))
+		if end > len(b) {
+			end = len(b)
+		}
+		src = netip.AddrFrom16([16]byte(b[8:24])).Unmap()
+		dst = netip.AddrFrom16([16]byte(b[24:40])).Unmap()
+		next, rest := b[6], b[40:end]
+		for {
+			switch next {
+			case 0, 43, 60: // hop-by-hop, routing, destination options
+				if len(rest) < 8 {
+					return src, dst, 0, nil, false
+				}
+				n := (int(rest[1]) + 1) * 8
+				if n > len(rest) {
+					return src, dst, 0, nil, false
+				}
+				next, rest = rest[0], rest[n:]
+			case 44: // fragment
+				if len(rest) < 8 || binary.BigEndian.Uint16(rest[2:4])&0xFFF8 != 0 {
+					return src, dst, 0, nil, false
+				}
+				next, rest = rest[0], rest[8:]
+			default:
+				return src, dst, next, rest, true
+			}
+		}
+	default:
+		return src, dst, 0, nil, false
+	}
+}
+
+// DecodeDNS parses a DNS message in wire format (RFC 1035), following name
+// compression pointers. Only the header, question and answer sections are
+// decoded.
+func DecodeDNS(msg []byte) (*DNSMessage, error) {
+	if len(msg) < 12 {
+		return nil, errDNSTruncated
+	}
+	flags := binary.BigEndian.Uint16(msg[2:4])
+	m := &DNSMessage{
+		ID:       binary.BigEndian.Uint16(msg[0:2]),
+		Response: flags&0x8000 != 0,
+		RCode:    int(flags & 0x000F),
+	}
+	qd := int(binary.BigEndian.Uint16(msg[4:6]))
+	an := int(binary.BigEndian.Uint16(msg[6:8]))
+
+	off := 12
+	for i := 0; i < qd; i++ {
+		name, next, err := readDNSName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(msg) {
+			return nil, errDNSTruncated
+		}
+		m.Questions = append(m.Questions, DNSQuestion{
+			Name: name,
+			Type: binary.BigEndian.Uint16(msg[next : next+2]),
+		})
+		off = next + 4
+	}
+
+	for i := 0; i < an; i++ {
+		name, next, err := readDNSName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(msg) {
+			return nil, errDNSTruncated
+		}
+		typ := binary.BigEndian.Uint16(msg[next : next+2])
+		ttl := binary.BigEndian.Uint32(msg[next+4 : next+8])
+		rdlen := int(binary.BigEndian.Uint16(msg[next+8 : next+10]))
+		rdata := next + 10
+		if rdata+rdlen > len(msg) {
+			return nil, errDNSTruncated
+		}
+
+		ans := DNSAnswer{Name: name, Type: DNSTypeName(typ), TTL: ttl}
+		switch typ {
+		case DNSTypeA:
+			if rdlen == 4 {
+				ans.Data = netip.AddrFrom4([4]byte(msg[rdata : rdata+4])).String()
+			}
+		case DNSTypeAAAA:
+			if rdlen == 16 {
+				ans.Data = netip.AddrFrom16([16]byte(msg[rdata : rdata+16])).Unmap().String()
+			}
+		case DNSTypeCNAME, DNSTypeNS, DNSTypePTR:
+			if target, _, err := readDNSName(msg, rdata); err == nil {
+				ans.Data = target
+			}
+		}
+		m.Answers = append(m.Answers, ans)
+		off = rdata + rdlen
+	}
+
+	return m, nil
+}
+
+// readDNSName reads a possibly compressed name at off and returns it with the
+// offset just past it in the original (uncompressed) position.
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var sb strings.Builder
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errDNSTruncated
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			name := sb.String()
+			if name == "" {
+				name = "."
+			}
+			return name, end, nil
+
+		case n&0xC0 == 0xC0:
+			if off+1 >= len(msg) {
+				return "", 0, errDNSTruncated
+			}
+			if jumps++; jumps > maxDNSPointers {
+				return "", 0, errors.New("dns: too many compression pointers")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:off+2]) & 0x3FFF)
+
+		case n&0xC0 != 0:
+			return "", 0, errors.New("dns: unsupported label type")
+
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errDNSTruncated
+			}
+			if sb.Len() > 0 {
+				sb.WriteByte('.')
+			}
+			sb.Write(msg[off+1 : off+1+n])
+			if sb.Len() > maxDNSNameLen {
+				return "", 0, errors.New("dns: name too long")
+			}
+			off += 1 + n
+		}
+	}
+}
+
+// decodeUDP extracts the endpoints and payload of a UDP datagram carried in
+// an IPv4 or IPv6 packet. IPv4 fragments and IPv6 extension headers are not
+// handled.
+func decodeUDP(pkt []byte) (src, dst netip.AddrPort, payload []byte, ok bool) {
+	if len(pkt) < 1 {
+		return src, dst, nil, false
+	}
+
+	var srcIP, dstIP netip.Addr
+	var udp []byte
+	switch pkt[0] >> 4 {
+	case 4:
+		ihl := int(pkt[0]&0x0F) * 4
+		if ihl < 20 || len(pkt) < ihl+8 || pkt[9] != 17 {
+			return src, dst, nil, false
+		}
+		if binary.BigEndian.Uint16(pkt[6:8])&0x1FFF != 0 {
+			return src, dst, nil, false // non-first fragment
+		}
+		srcIP = netip.AddrFrom4([4]byte(pkt[12:16]))
+		dstIP = netip.AddrFrom4([4]byte(pkt[16:20]))
+		udp = pkt[ihl:]
+	case 6:
+		if len(pkt) < 48 || pkt[6] != 17 {
+			return src, dst, nil, false
+		}
+		srcIP = netip.AddrFrom16([16]byte(pkt[8:24])).Unmap()
+		dstIP = netip.AddrFrom16([16]byte(pkt[24:40])).Unmap()
+		udp = pkt[40:]
+	default:
+		return src, dst, nil, false
+	}
+
+	src = netip.AddrPortFrom(srcIP, binary.BigEndian.Uint16(udp[0:2]))
+	dst = netip.AddrPortFrom(dstIP, binary.BigEndian.Uint16(udp[2:4]))
+	end := int(binary.BigEndian.Uint16(udp[4:6]))
+	if end < 8 || end > len(udp) {
+		// Snap length may have cut the datagram; decode what we have.
+		end = len(udp)
+	}
+	return src, dst, udp[8:end], true
+}
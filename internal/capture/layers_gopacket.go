@@ -0,0 +1,162 @@
+//go:build gopacket
+
+package capture
+
+import (
+	"net/netip"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// The link, IP, UDP and DNS layers of the packets the host sees whole
+// (emulator and vpn captures, tcpdump -x hex dumps) are decoded with
+// gopacket in builds with -tags gopacket; layers.go decodes them by hand
+// otherwise. TLS handshakes are parsed by tls.go either way: gopacket's
+// TLS layer stops at the record headers.
+
+// linkPayload strips the link-layer header of a frame, returning nil for
+// frames that carry no IP packet.
+func linkPayload(linkType uint32, frame []byte) []byte {
+	var typ layers.EthernetType
+	switch linkType {
+	case linkTypeRaw:
+		return frame
+	case linkTypeEthernet:
+		var eth layers.Ethernet
+		if eth.DecodeFromBytes(frame, gopacket.NilDecodeFeedback) != nil {
+			return nil
+		}
+		typ, frame = eth.EthernetType, eth.Payload
+		if typ == layers.EthernetTypeDot1Q {
+			var tag layers.Dot1Q
+			if tag.DecodeFromBytes(frame, gopacket.NilDecodeFeedback) != nil {
+				return nil
+			}
+			typ, frame = tag.Type, tag.Payload
+		}
+	case linkTypeLinuxSLL:
+		var sll layers.LinuxSLL
+		if sll.DecodeFromBytes(frame, gopacket.NilDecodeFeedback) != nil {
+			return nil
+		}
+		typ, frame = sll.EthernetType, sll.Payload
+	}
+	if typ != layers.EthernetTypeIPv4 && typ != layers.EthernetTypeIPv6 {
+		return nil
+	}
+	return frame
+}
+
+// decodeIP returns the addresses, transport protocol and transport segment
+// of an IPv4 or IPv6 packet. IPv6 extension headers are skipped; fragments
+// other than the first carry no transport header and are rejected.
+func decodeIP(b []byte) (src, dst netip.Addr, proto byte, l4 []byte, ok bool) {
+	if len(b) < 1 {
+		return src, dst, 0, nil, false
+	}
+	switch b[0] >> 4 {
+	case 4:
+		var ip layers.IPv4
+		if ip.DecodeFromBytes(b, gopacket.NilDecodeFeedback) != nil || ip.FragOffset != 0 {
+			return src, dst, 0, nil, false
+		}
+		src, _ = netip.AddrFromSlice(ip.SrcIP.To4())
+		dst, _ = netip.AddrFromSlice(ip.DstIP.To4())
+		return src, dst, byte(ip.Protocol), ip.Payload, true
+	case 6:
+		var ip layers.IPv6
+		if ip.DecodeFromBytes(b, gopacket.NilDecodeFeedback) != nil {
+			return src, dst, 0, nil, false
+		}
+		src, _ = netip.AddrFromSlice(ip.SrcIP)
+		dst, _ = netip.AddrFromSlice(ip.DstIP)
+		src, dst = src.Unmap(), dst.Unmap()
+		// A hop-by-hop header is decoded as part of the IPv6 layer.
+		next, rest := ip.NextHeader, ip.Payload
+		if ip.HopByHop != nil {
+			next = ip.HopByHop.NextHeader
+		}
+		for {
+			switch next {
+			case layers.IPProtocolIPv6HopByHop, layers.IPProtocolIPv6Routing, layers.IPProtocolIPv6Destination:
+				var ext layers.IPv6ExtensionSkipper
+				if ext.DecodeFromBytes(rest, gopacket.NilDecodeFeedback) != nil {
+					return src, dst, 0, nil, false
+				}
+				next, rest = ext.NextHeader, ext.Payload
+			case layers.IPProtocolIPv6Fragment:
+				p := gopacket.NewPacket(rest, layers.LayerTypeIPv6Fragment, gopacket.NoCopy)
+				frag, _ := p.Layer(layers.LayerTypeIPv6Fragment).(*layers.IPv6Fragment)
+				if frag == nil || frag.FragmentOffset != 0 {
+					return src, dst, 0, nil, false
+				}
+				next, rest = frag.NextHeader, frag.Payload
+			default:
+				return src, dst, byte(next), rest, true
+			}
+		}
+	default:
+		return src, dst, 0, nil, false
+	}
+}
+
+// decodeUDP extracts the endpoints and payload of a UDP datagram carried in
+// an IPv4 or IPv6 packet.
+func decodeUDP(pkt []byte) (src, dst netip.AddrPort, payload []byte, ok bool) {
+	srcIP, dstIP, proto, l4, ok := decodeIP(pkt)
+	if !ok || proto != byte(layers.IPProtocolUDP) {
+		return src, dst, nil, false
+	}
+	var udp layers.UDP
+	if udp.DecodeFromBytes(l4, gopacket.NilDecodeFeedback) != nil {
+		return src, dst, nil, false
+	}
+	src = netip.AddrPortFrom(srcIP, uint16(udp.SrcPort))
+	dst = netip.AddrPortFrom(dstIP, uint16(udp.DstPort))
+	return src, dst, udp.Payload, true
+}
+
+// DecodeDNS parses a DNS message in wire format (RFC 1035), following name
+// compression pointers. Only the header, question and answer sections are
+// kept.
+func DecodeDNS(msg []byte) (*DNSMessage, error) {
+	var d layers.DNS
+	if err := d.DecodeFromBytes(msg, gopacket.NilDecodeFeedback); err != nil {
+		return nil, err
+	}
+	m := &DNSMessage{
+		ID:       d.ID,
+		Response: d.QR,
+		RCode:    int(d.ResponseCode),
+	}
+	for _, q := range d.Questions {
+		m.Questions = append(m.Questions, DNSQuestion{Name: wireName(q.Name), Type: uint16(q.Type)})
+	}
+	for _, a := range d.Answers {
+		ans := DNSAnswer{Name: wireName(a.Name), Type: DNSTypeName(uint16(a.Type)), TTL: a.TTL}
+		switch a.Type {
+		case layers.DNSTypeA, layers.DNSTypeAAAA:
+			if addr, ok := netip.AddrFromSlice(a.IP); ok {
+				ans.Data = addr.Unmap().String()
+			}
+		case layers.DNSTypeCNAME:
+			ans.Data = wireName(a.CNAME)
+		case layers.DNSTypeNS:
+			ans.Data = wireName(a.NS)
+		case layers.DNSTypePTR:
+			ans.Data = wireName(a.PTR)
+		}
+		m.Answers = append(m.Answers, ans)
+	}
+	return m, nil
+}
+
+// wireName renders a name the way the hand-written decoder does: without
+// the trailing dot, the root as ".".
+func wireName(b []byte) string {
+	if len(b) == 0 {
+		return "."
+	}
+	return string(b)
+}
@@ -0,0 +1,62 @@
+package capture
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Run with and without -tags gopacket: both decoders must agree.
+
+func TestLinkPayload(t *testing.T) {
+	ip := []byte{0x45, 0, 0, 20, 0, 0, 0, 0, 64, 17, 0, 0, 10, 0, 0, 1, 10, 0, 0, 2}
+	mac := bytes.Repeat([]byte{0xaa}, 12)
+	cases := []struct {
+		name     string
+		linkType uint32
+		frame    []byte
+		want     []byte
+	}{
+		{"raw", linkTypeRaw, ip, ip},
+		{"ethernet", linkTypeEthernet, concat(mac, []byte{0x08, 0x00}, ip), ip},
+		{"802.1q", linkTypeEthernet, concat(mac, []byte{0x81, 0x00, 0x00, 0x05, 0x08, 0x00}, ip), ip},
+		{"arp", linkTypeEthernet, concat(mac, []byte{0x08, 0x06}, make([]byte, 28)), nil},
+		{"sll", linkTypeLinuxSLL, concat(make([]byte, 14), []byte{0x08, 0x00}, ip), ip},
+		{"short", linkTypeEthernet, mac, nil},
+	}
+	for _, c := range cases {
+		if got := linkPayload(c.linkType, c.frame); !bytes.Equal(got, c.want) {
+			t.Errorf("%s: payload = %x, want %x", c.name, got, c.want)
+		}
+	}
+}
+
+func TestDecodeIP_IPv6Extensions(t *testing.T) {
+	udp := []byte{0x30, 0x39, 0x00, 0x35, 0x00, 0x08, 0x00, 0x00}
+	hdr := func(next byte, n int) []byte {
+		b := make([]byte, 40)
+		b[0] = 0x60
+		b[4], b[5] = byte(n>>8), byte(n)
+		b[6], b[7] = next, 64
+		b[23], b[39] = 1, 2
+		return b
+	}
+	dest := []byte{17, 0, 1, 4, 0, 0, 0, 0} // destination options, then UDP
+	pkt := concat(hdr(60, len(dest)+len(udp)), dest, udp)
+	src, dst, proto, l4, ok := decodeIP(pkt)
+	if !ok || proto != 17 || !bytes.Equal(l4, udp) || src.String() != "::1" || dst.String() != "::2" {
+		t.Errorf("destination options: %v %v %d %x %v", src, dst, proto, l4, ok)
+	}
+
+	first := []byte{17, 0, 0x00, 0x01, 0, 0, 0, 1} // offset 0, more fragments
+	if _, _, proto, l4, ok := decodeIP(concat(hdr(44, len(first)+len(udp)), first, udp)); !ok || proto != 17 || !bytes.Equal(l4, udp) {
+		t.Errorf("first fragment: %d %x %v", proto, l4, ok)
+	}
+	later := []byte{17, 0, 0x00, 0x08, 0, 0, 0, 1} // offset 1
+	if _, _, _, _, ok := decodeIP(concat(hdr(44, len(later)+len(udp)), later, udp)); ok {
+		t.Error("later fragment decoded")
+	}
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
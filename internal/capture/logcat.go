@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"net"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -20,6 +21,7 @@ type LogcatSnooper struct {
 	client *adb.Client
 	log    *slog.Logger
 	serial string
+	class  adb.DeviceClass
 
 	// DNS domain→IP map (populated from logcat DNS events)
 	dnsMu    sync.RWMutex
@@ -42,6 +44,7 @@ type URLCapture struct {
 	Method    string // GET, POST, etc.
 	URL       string // full URL
 	AppPkg    string // package name if available
+	PID       int    // process that logged it, 0 if unknown
 }
 
 // logcat command: stream all tags that commonly log network/DNS/HTTP activity.
@@ -63,6 +66,18 @@ conscrypt:* \
 HttpURLConnection:* \
 2>/dev/null`
 
+// wearLogcatTags are added on Wear OS, where most app traffic is proxied
+// through the paired phone and only shows up in the proxy's logs.
+const wearLogcatTags = `WearableService:* NetworkScheduler:* ProxyConnectionService:* `
+
+// logcatCommand returns the logcat invocation for the device class.
+func logcatCommand(class adb.DeviceClass) string {
+	if class == adb.ClassWatch {
+		return strings.Replace(logcatCmd, "2>/dev/null", wearLogcatTags+"2>/dev/null", 1)
+	}
+	return logcatCmd
+}
+
 // Regex patterns for extracting DNS and URL information.
 var (
 	// DNS resolution patterns (varies by Android version)
@@ -99,6 +114,11 @@ func NewLogcatSnooper(client *adb.Client, log *slog.Logger, serial string) *Logc
 	}
 }
 
+// SetDeviceClass selects class-specific logcat tags. Call before Run.
+func (s *LogcatSnooper) SetDeviceClass(class adb.DeviceClass) {
+	s.class = class
+}
+
 // URLs returns the channel that delivers captured URLs from logcat.
 func (s *LogcatSnooper) URLs() <-chan URLCapture {
 	return s.urlCh
@@ -106,6 +126,7 @@ func (s *LogcatSnooper) URLs() <-chan URLCapture {
 
 // LookupIP returns the domain name for an IP address from the DNS cache.
 func (s *LogcatSnooper) LookupIP(ip string) string {
+	ip = NormalizeIP(ip)
 	s.dnsMu.RLock()
 	defer s.dnsMu.RUnlock()
 	return s.ipMap[ip]
@@ -130,10 +151,7 @@ func (s *LogcatSnooper) Run(ctx context.Context) error {
 	_, _ = s.client.Shell(flushCtx, s.serial, "logcat -c 2>/dev/null")
 	flushCancel()
 
-	// Also do an initial DNS cache dump from the device.
-	go s.loadDeviceDNSCache(ctx)
-
-	stream, err := s.client.OpenShellStream(ctx, s.serial, logcatCmd)
+	stream, err := s.client.OpenShellStream(ctx, s.serial, logcatCommand(s.class))
 	if err != nil {
 		return fmt.Errorf("opening logcat stream: %w", err)
 	}
@@ -172,8 +190,9 @@ func (s *LogcatSnooper) parseLine(line string) {
 		return
 	}
 
-	// Extract tag from logcat brief format: "I/TagName( 1234): message"
+	// Extract tag and PID from logcat brief format: "I/TagName( 1234): message"
 	tag := ""
+	pid := 0
 	msgStart := strings.Index(line, "): ")
 	if msgStart > 0 {
 		tagStart := strings.Index(line, "/")
@@ -181,6 +200,7 @@ func (s *LogcatSnooper) parseLine(line string) {
 			parenIdx := strings.Index(line[tagStart:], "(")
 			if parenIdx > 0 {
 				tag = strings.TrimSpace(line[tagStart+1 : tagStart+parenIdx])
+				pid, _ = strconv.Atoi(strings.TrimSpace(line[tagStart+parenIdx+1 : msgStart]))
 			}
 		}
 		line = line[msgStart+3:]
@@ -190,7 +210,7 @@ func (s *LogcatSnooper) parseLine(line string) {
 	s.parseDNS(line, tag)
 
 	// Try to parse HTTP URLs.
-	s.parseURLs(line, tag)
+	s.parseURLs(line, tag, pid)
 }
 
 // parseDNS extracts domain→IP mappings from DNS-related log lines.
@@ -222,17 +242,17 @@ func (s *LogcatSnooper) parseDNS(line, tag string) {
 
 	if ipMatch != nil {
 		ip := ipMatch[1]
-		if net.ParseIP(ip) != nil && !isPrivateIP(ip) {
+		if isIP(ip) && !isPrivateIP(ip) {
 			s.addDNSMapping(domain, ip)
 		}
 	}
 }
 
 // parseURLs extracts HTTP/HTTPS URLs from logcat lines.
-func (s *LogcatSnooper) parseURLs(line, tag string) {
+func (s *LogcatSnooper) parseURLs(line, tag string, pid int) {
 	// OkHttp specific format: "--> POST https://..."
 	if matches := reOkHTTP.FindStringSubmatch(line); matches != nil {
-		s.emitURL(tag, matches[1], matches[2])
+		s.emitURL(tag, matches[1], matches[2], pid)
 		return
 	}
 
@@ -247,7 +267,7 @@ func (s *LogcatSnooper) parseURLs(line, tag string) {
 			strings.Contains(url, "xmlns") {
 			return
 		}
-		s.emitURL(tag, method, url)
+		s.emitURL(tag, method, url, pid)
 		return
 	}
 
@@ -270,6 +290,8 @@ func (s *LogcatSnooper) addDNSMapping(domain, ip string) {
 		return
 	}
 
+	ip = NormalizeIP(ip)
+
 	s.dnsMu.Lock()
 	defer s.dnsMu.Unlock()
 
@@ -301,7 +323,8 @@ func (s *LogcatSnooper) forwardResolve(domain string) {
 	defer s.dnsMu.Unlock()
 
 	for _, ip := range ips {
-		if net.ParseIP(ip) != nil && !isPrivateIP(ip) {
+		if isIP(ip) && !isPrivateIP(ip) {
+			ip = NormalizeIP(ip)
 			s.dnsMap[domain] = ip
 			if _, exists := s.ipMap[ip]; !exists {
 				s.ipMap[ip] = domain
@@ -313,7 +336,7 @@ func (s *LogcatSnooper) forwardResolve(domain string) {
 }
 
 // emitURL sends a captured URL to the channel.
-func (s *LogcatSnooper) emitURL(tag, method, rawURL string) {
+func (s *LogcatSnooper) emitURL(tag, method, rawURL string, pid int) {
 	s.urlHits.Add(1)
 
 	// Also extract domain→IP mapping from URL.
@@ -327,6 +350,7 @@ func (s *LogcatSnooper) emitURL(tag, method, rawURL string) {
 		Tag:       tag,
 		Method:    method,
 		URL:       rawURL,
+		PID:       pid,
 	}
 
 	select {
@@ -336,44 +360,6 @@ func (s *LogcatSnooper) emitURL(tag, method, rawURL string) {
 	}
 }
 
-// loadDeviceDNSCache reads the device's dumpsys DNS cache and netd cache.
-func (s *LogcatSnooper) loadDeviceDNSCache(ctx context.Context) {
-	shellCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	// Try dumpsys dnsresolver (Android 10+).
-	out, err := s.client.Shell(shellCtx, s.serial, "dumpsys dnsresolver 2>/dev/null")
-	if err == nil && len(out) > 100 {
-		s.parseDumpsysDNS(out)
-	}
-
-	// Also try getprop to find the device's DNS servers.
-	out2, err := s.client.Shell(shellCtx, s.serial, "getprop net.dns1 2>/dev/null && getprop net.dns2 2>/dev/null")
-	if err == nil {
-		s.log.Debug("device DNS servers", "output", strings.TrimSpace(out2))
-	}
-}
-
-// parseDumpsysDNS parses `dumpsys dnsresolver` output for cached DNS entries.
-func (s *LogcatSnooper) parseDumpsysDNS(output string) {
-	// Look for cache entries like:
-	// "example.com IN A 1.2.3.4 TTL=300"
-	// or hostname-to-IP mappings in the cache dump.
-	reEntry := regexp.MustCompile(`([a-zA-Z0-9][-a-zA-Z0-9.]*\.[a-zA-Z]{2,})\s+.*?(?:IN\s+A|AAAA?)\s+((?:\d{1,3}\.){3}\d{1,3})`)
-
-	for _, line := range strings.Split(output, "\n") {
-		if matches := reEntry.FindStringSubmatch(line); matches != nil {
-			domain := strings.ToLower(matches[1])
-			ip := matches[2]
-			if net.ParseIP(ip) != nil && !isPrivateIP(ip) {
-				s.addDNSMapping(domain, ip)
-			}
-		}
-	}
-
-	s.log.Debug("parsed dumpsys dnsresolver", "dns_entries", s.dnsHits.Load())
-}
-
 // DeviceNslookup runs nslookup on the device for an IP that failed reverse DNS.
 func (s *LogcatSnooper) DeviceNslookup(ctx context.Context, ip string) string {
 	shellCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
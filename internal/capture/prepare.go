@@ -0,0 +1,98 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Steps of Prepare a StartError names.
+const (
+	StepShell = "shell"
+	StepMode  = "mode"
+	StepApp   = "app"
+)
+
+// StartError is why Prepare found that a capture cannot run.
+type StartError struct {
+	// Step is the check that failed: StepShell, StepMode or StepApp.
+	Step string
+	// Mode is the mode asked for, or the one settled on when the app
+	// could not be found.
+	Mode Mode
+	Err  error
+	// Hint says what to do about it.
+	Hint string
+}
+
+func (e *StartError) Error() string {
+	return fmt.Sprintf("capture %s check failed: %v", e.Step, e.Err)
+}
+
+func (e *StartError) Unwrap() error { return e.Err }
+
+// Prepare checks, before anything is captured, that the device answers a
+// shell, settles the capture mode and, with SetApp, looks the app up. It
+// returns a *StartError when the capture cannot run. Run prepares the
+// engine itself unless Prepare succeeded before.
+func (e *Engine) Prepare(ctx context.Context) error {
+	if e.prepared {
+		return nil
+	}
+
+	shellCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	out, err := e.client.Shell(shellCtx, e.serial, "echo ok")
+	cancel()
+	if err == nil && strings.TrimSpace(out) != "ok" {
+		err = fmt.Errorf("unexpected shell output %q", strings.TrimSpace(out))
+	}
+	if err != nil {
+		return &StartError{Step: StepShell, Mode: e.mode, Err: err,
+			Hint: "check that the device is online and authorized (adb devices) and that its USB or Wi-Fi link is stable"}
+	}
+
+	mode := e.mode
+	switch mode {
+	case ModeAuto:
+		mode = e.detectMode(ctx)
+	case ModeTcpdump:
+		if !e.prepareTcpdump(ctx) {
+			return &StartError{Step: StepMode, Mode: mode, Err: errors.New("tcpdump is not on the device and could not be deployed"),
+				Hint: "tcpdump needs a device that has it installed, or root to deploy the bundled one; mode=auto picks what the device supports"}
+		}
+	case ModeIPTables:
+		rootCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		e.root = e.detectRoot(rootCtx)
+		cancel()
+		if e.root == rootNone {
+			return &StartError{Step: StepMode, Mode: mode, Err: errors.New("iptables capture needs root"),
+				Hint: "use a rooted device, or mode=auto"}
+		}
+	case ModeEmulator:
+		if !emulatorConsoleReachable(e.serial) {
+			return &StartError{Step: StepMode, Mode: mode, Err: fmt.Errorf("no emulator console for %s on this host", e.serial),
+				Hint: "emulator mode captures on the host an emulator runs on; use mode=auto for other devices"}
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if e.app != nil {
+		if err := e.resolveApp(ctx); err != nil {
+			return &StartError{Step: StepApp, Mode: mode, Err: err,
+				Hint: "check the package name against GET /api/devices/{serial}/packages"}
+		}
+	}
+
+	e.active = mode
+	e.prepared = true
+	return nil
+}
+
+// Mode returns the mode Prepare settled on, ModeAuto before it.
+func (e *Engine) Mode() Mode {
+	return e.active
+}
@@ -0,0 +1,31 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+func TestEngine_Prepare_Unreachable(t *testing.T) {
+	e := newTestEngine()
+	err := e.Prepare(context.Background())
+	var startErr *StartError
+	if !errors.As(err, &startErr) {
+		t.Fatalf("err = %v, want a *StartError", err)
+	}
+	if startErr.Step != StepShell || startErr.Mode != ModeTcpdump || startErr.Hint == "" {
+		t.Errorf("start error = %+v", startErr)
+	}
+	if !errors.Is(err, adb.ErrServerNotRunning) {
+		t.Errorf("err = %v, want it to wrap the ADB error", err)
+	}
+	if e.Mode() != ModeAuto {
+		t.Errorf("mode = %v after a failed Prepare", e.Mode())
+	}
+	// Run fails the same way instead of capturing.
+	if err := e.Run(context.Background()); !errors.As(err, &startErr) {
+		t.Errorf("Run err = %v, want a *StartError", err)
+	}
+}
@@ -1,8 +1,10 @@
 package capture
 
 import (
-	"encoding/hex"
+	"encoding/binary"
 	"fmt"
+	"math/bits"
+	"net/netip"
 	"strconv"
 	"strings"
 	"time"
@@ -28,8 +30,9 @@ func (p *ProcNetParser) ParseProcNet(output string, proto Protocol) []Connection
 	var conns []Connection
 	now := time.Now()
 
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
+	for output != "" {
+		var line string
+		line, output, _ = strings.Cut(output, "\n")
 		line = strings.TrimSpace(line)
 		if line == "" || strings.HasPrefix(line, "sl") {
 			continue // skip header
@@ -73,16 +76,13 @@ func (p *ProcNetParser) parseLine(line string, proto Protocol, now time.Time) *C
 	if isLoopback(localIP) && isLoopback(remoteIP) {
 		return nil
 	}
-	if (remoteIP == "0.0.0.0" || remoteIP == "::" || remoteIP == "::1") && state == ConnListen {
-		return nil
-	}
 	if state == ConnListen {
 		return nil
 	}
 
 	p.nextID++
 	return &Connection{
-		ID:         fmt.Sprintf("%s-conn-%d", p.serial, p.nextID),
+		ID:         p.serial + "-conn-" + strconv.FormatUint(p.nextID, 10),
 		Serial:     p.serial,
 		LocalIP:    localIP,
 		LocalPort:  localPort,
@@ -98,79 +98,58 @@ func (p *ProcNetParser) parseLine(line string, proto Protocol, now time.Time) *C
 
 // parseHexAddr parses "AABBCCDD:PORT" where IP is little-endian hex.
 func parseHexAddr(addr string) (string, uint16, error) {
-	parts := strings.SplitN(addr, ":", 2)
-	if len(parts) != 2 {
+	ipHex, portHex, ok := strings.Cut(addr, ":")
+	if !ok {
 		return "", 0, fmt.Errorf("invalid addr format: %s", addr)
 	}
 
-	ip, err := parseHexIP(parts[0])
+	ip, err := parseHexIP(ipHex)
 	if err != nil {
 		return "", 0, err
 	}
 
-	port, err := strconv.ParseUint(parts[1], 16, 16)
+	port, err := strconv.ParseUint(portHex, 16, 16)
 	if err != nil {
-		return "", 0, fmt.Errorf("invalid port: %s", parts[1])
+		return "", 0, fmt.Errorf("invalid port: %s", portHex)
 	}
 
 	return ip, uint16(port), nil
 }
 
-// parseHexIP converts a hex-encoded IP to dotted notation.
-// /proc/net/tcp uses little-endian 32-bit for IPv4.
+// parseHexIP converts a hex-encoded /proc/net address to its canonical
+// text form (see NormalizeIP). /proc/net/tcp prints IPv4 as one
+// little-endian 32-bit word, /proc/net/tcp6 prints IPv6 as four.
 func parseHexIP(h string) (string, error) {
-	if len(h) == 8 {
-		// IPv4: little-endian 32-bit
-		b, err := hex.DecodeString(h)
-		if err != nil {
-			return "", err
-		}
-		return fmt.Sprintf("%d.%d.%d.%d", b[3], b[2], b[1], b[0]), nil
-	}
-
-	if len(h) == 32 {
-		// IPv6: four 32-bit words, each little-endian
-		b, err := hex.DecodeString(h)
+	var b [16]byte
+	switch len(h) {
+	case 8:
+		w, err := parseHexWord(h)
 		if err != nil {
 			return "", err
 		}
-		// Convert each 4-byte group from little-endian to network order.
-		words := make([]uint32, 4)
+		binary.BigEndian.PutUint32(b[:4], w)
+		return netip.AddrFrom4([4]byte(b[:4])).String(), nil
+	case 32:
 		for i := 0; i < 4; i++ {
-			off := i * 4
-			words[i] = uint32(b[off+3])<<24 | uint32(b[off+2])<<16 | uint32(b[off+1])<<8 | uint32(b[off])
+			w, err := parseHexWord(h[i*8 : i*8+8])
+			if err != nil {
+				return "", err
+			}
+			binary.BigEndian.PutUint32(b[i*4:], w)
 		}
-
-		// Detect IPv4-mapped IPv6 (::ffff:X.X.X.X) and convert to plain IPv4.
-		if words[0] == 0 && words[1] == 0 && words[2] == 0x0000FFFF {
-			w := words[3]
-			return fmt.Sprintf("%d.%d.%d.%d", w>>24, (w>>16)&0xFF, (w>>8)&0xFF, w&0xFF), nil
-		}
-
-		// Detect IPv6 loopback (::1).
-		if words[0] == 0 && words[1] == 0 && words[2] == 0 && words[3] == 1 {
-			return "::1", nil
-		}
-
-		// Detect all-zeros (::).
-		if words[0] == 0 && words[1] == 0 && words[2] == 0 && words[3] == 0 {
-			return "::", nil
-		}
-
-		parts := make([]string, 8)
-		for i := 0; i < 4; i++ {
-			parts[i*2] = fmt.Sprintf("%x", words[i]>>16)
-			parts[i*2+1] = fmt.Sprintf("%x", words[i]&0xFFFF)
-		}
-		return strings.Join(parts, ":"), nil
+		return netip.AddrFrom16(b).Unmap().String(), nil
 	}
-
 	return "", fmt.Errorf("unknown IP hex length: %d", len(h))
 }
 
-// isLoopback returns true for loopback addresses.
-func isLoopback(ip string) bool {
-	return ip == "127.0.0.1" || ip == "::1" || strings.HasPrefix(ip, "127.")
+// parseHexWord decodes 8 hex digits holding a little-endian 32-bit word and
+// returns it in host order.
+func parseHexWord(h string) (uint32, error) {
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hex IP %q", h)
+	}
+	return bits.ReverseBytes32(uint32(v)), nil
 }
 
 func parseConnState(hexState string) ConnState {
@@ -2,6 +2,7 @@ package capture
 
 import (
 	"testing"
+	"time"
 )
 
 func TestProcNetParser_ParseProcNet_TCP(t *testing.T) {
@@ -86,6 +87,36 @@ func TestParseHexIP_IPv4(t *testing.T) {
 	}
 }
 
+func TestParseHexIP_IPv6(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"0000000000000000FFFF00000F02000A", "10.0.2.15"},
+		{"00000000000000000000000001000000", "::1"},
+		{"00000000000000000000000000000000", "::"},
+		{"B80D0120000000000000000015000000", "2001:db8::15"},
+		{"B0F80726070C0440000000006A000000", "2607:f8b0:4004:c07::6a"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseHexIP(tt.input)
+		if err != nil {
+			t.Errorf("parseHexIP(%q): %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseHexIP(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"ZZ000000", "0000000000000000FFFF0000ZZ02000A", "123"} {
+		if _, err := parseHexIP(bad); err == nil {
+			t.Errorf("parseHexIP(%q): expected error", bad)
+		}
+	}
+}
+
 func TestParseHexAddr(t *testing.T) {
 	ip, port, err := parseHexAddr("0101A8C0:01BB")
 	if err != nil {
@@ -130,3 +161,41 @@ func TestIsHTTPPort(t *testing.T) {
 		t.Error("22 should not be HTTP port")
 	}
 }
+
+func TestDiffConnections_Lifetime(t *testing.T) {
+	e := newTestEngine()
+	known := make(map[string]Connection)
+	emitted := make(map[string]time.Time)
+	conn := func(state ConnState) Connection {
+		return Connection{ID: "c1", Serial: "dev1", LocalIP: "10.0.0.2", LocalPort: 40000,
+			RemoteIP: "93.184.216.34", RemotePort: 443, State: state, Protocol: ProtoTCP, UID: -1}
+	}
+
+	e.diffConnections([]Connection{conn(ConnSynSent)}, known, emitted)
+	if c := <-e.connCh; c.State != ConnSynSent {
+		t.Fatalf("new connection = %+v", c)
+	}
+	<-e.packetCh
+
+	// A state change updates the same connection rather than closing it.
+	e.diffConnections([]Connection{conn(ConnEstablished)}, known, emitted)
+	if c := <-e.connCh; c.State != ConnEstablished || c.ID != "c1" {
+		t.Errorf("update = %+v", c)
+	}
+	if len(e.closedCh) != 0 {
+		t.Error("state change reported as close")
+	}
+
+	e.diffConnections(nil, known, emitted)
+	select {
+	case c := <-e.closedCh:
+		if c.ClosedAt == nil || c.State != ConnEstablished || c.DurationMs < 0 || c.ID != "c1" {
+			t.Errorf("closed = %+v", c)
+		}
+	default:
+		t.Fatal("no closed connection")
+	}
+	if len(known) != 0 {
+		t.Errorf("known = %v", known)
+	}
+}
@@ -0,0 +1,514 @@
+package capture
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QUIC Initial packets are encrypted, but with keys derived from the
+// client's Destination Connection ID and a salt published in RFC 9001, so
+// any observer can read the TLS ClientHello they carry. The sniffer decodes
+// client Initials from a dedicated tcpdump -x stream (see dns.go for the
+// dump format), reassembles the CRYPTO frames of each connection attempt,
+// and reports the server name from the ClientHello.
+
+const (
+	quicVersion1 = 0x00000001
+	// quicMaxCrypto bounds the handshake bytes buffered per connection
+	// attempt; post-quantum key shares push ClientHellos past 1.5 KiB.
+	quicMaxCrypto = 16 << 10
+	// quicPendingTTL is how long a partial ClientHello waits for the rest.
+	quicPendingTTL = 10 * time.Second
+	// quicFlowIdle is how long a flow stays tagged after its last packet.
+	quicFlowIdle = 5 * time.Minute
+)
+
+// quicV1Salt is the initial_salt of QUIC version 1 (RFC 9001, section 5.2).
+var quicV1Salt = []byte{
+	0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+	0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+}
+
+var (
+	errQUICNotInitial = errors.New("quic: not a version 1 Initial packet")
+	errQUICTruncated  = errors.New("quic: packet truncated")
+	errQUICDecrypt    = errors.New("quic: cannot decrypt Initial")
+)
+
+// QUICHello is a QUIC connection attempt whose server name was read from
+// the client's Initial packets.
+type QUICHello struct {
+	Timestamp time.Time
+	Client    netip.AddrPort
+	Server    netip.AddrPort
+	SNI       string
+}
+
+// quicKeys are the client Initial packet protection keys.
+type quicKeys struct {
+	key, iv, hp []byte
+}
+
+// quicClientKeys derives the client Initial keys for a Destination
+// Connection ID (RFC 9001, section 5.2).
+func quicClientKeys(dcid []byte) quicKeys {
+	initial := hkdfExtract(quicV1Salt, dcid)
+	secret := hkdfExpandLabel(initial, "client in", sha256.Size)
+	return quicKeys{
+		key: hkdfExpandLabel(secret, "quic key", 16),
+		iv:  hkdfExpandLabel(secret, "quic iv", 12),
+		hp:  hkdfExpandLabel(secret, "quic hp", 16),
+	}
+}
+
+func hkdfExtract(salt, ikm []byte) []byte {
+	m := hmac.New(sha256.New, salt)
+	m.Write(ikm)
+	return m.Sum(nil)
+}
+
+// hkdfExpandLabel is TLS 1.3 HKDF-Expand-Label with an empty context, for
+// outputs of at most one SHA-256 block.
+func hkdfExpandLabel(secret []byte, label string, n int) []byte {
+	label = "tls13 " + label
+	info := make([]byte, 0, 4+len(label))
+	info = append(info, byte(n>>8), byte(n), byte(len(label)))
+	info = append(info, label...)
+	info = append(info, 0)
+
+	m := hmac.New(sha256.New, secret)
+	m.Write(info)
+	m.Write([]byte{1})
+	return m.Sum(nil)[:n]
+}
+
+// quicVarint decodes a variable-length integer (RFC 9000, section 16). n
+// is 0 when b is too short.
+func quicVarint(b []byte) (v uint64, n int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	n = 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, 0
+	}
+	v = uint64(b[0] & 0x3f)
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, n
+}
+
+// decryptQUICInitial removes header and packet protection from the first
+// packet of a datagram, which must be a version 1 client Initial. It
+// returns the Destination Connection ID and the decrypted frames. The
+// datagram is not modified.
+func decryptQUICInitial(d []byte) (dcid, payload []byte, err error) {
+	// Long header with the fixed bit set and packet type Initial; the type
+	// bits are not covered by header protection.
+	if len(d) < 7 || d[0]&0xf0 != 0xc0 || binary.BigEndian.Uint32(d[1:5]) != quicVersion1 {
+		return nil, nil, errQUICNotInitial
+	}
+	off := 5
+	dcidLen := int(d[off])
+	off++
+	if dcidLen > 20 || off+dcidLen >= len(d) {
+		return nil, nil, errQUICTruncated
+	}
+	dcid = d[off : off+dcidLen]
+	off += dcidLen
+	scidLen := int(d[off])
+	off++
+	if scidLen > 20 || off+scidLen > len(d) {
+		return nil, nil, errQUICTruncated
+	}
+	off += scidLen
+	tokenLen, n := quicVarint(d[off:])
+	if n == 0 || tokenLen > uint64(len(d)-off-n) {
+		return nil, nil, errQUICTruncated
+	}
+	off += n + int(tokenLen)
+	length, n := quicVarint(d[off:])
+	if n == 0 {
+		return nil, nil, errQUICTruncated
+	}
+	pnOff := off + n
+	// The header protection sample starts 4 bytes past the packet number.
+	if length < 20 || length > uint64(len(d)-pnOff) {
+		return nil, nil, errQUICTruncated
+	}
+	end := pnOff + int(length)
+
+	keys := quicClientKeys(dcid)
+	hp, err := aes.NewCipher(keys.hp)
+	if err != nil {
+		return nil, nil, err
+	}
+	var mask [aes.BlockSize]byte
+	hp.Encrypt(mask[:], d[pnOff+4:pnOff+4+aes.BlockSize])
+
+	header := append([]byte(nil), d[:pnOff+4]...)
+	header[0] ^= mask[0] & 0x0f
+	pnLen := int(header[0]&0x03) + 1
+	var pn uint64
+	for i := 0; i < pnLen; i++ {
+		header[pnOff+i] ^= mask[1+i]
+		pn = pn<<8 | uint64(header[pnOff+i])
+	}
+	header = header[:pnOff+pnLen]
+
+	// Client Initials number from zero, so the truncated packet number is
+	// the full one.
+	nonce := append([]byte(nil), keys.iv...)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	block, err := aes.NewCipher(keys.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	payload, err = aead.Open(nil, nonce, d[pnOff+pnLen:end], header)
+	if err != nil {
+		return nil, nil, errQUICDecrypt
+	}
+	return dcid, payload, nil
+}
+
+// quicCrypto is the data of one CRYPTO frame.
+type quicCrypto struct {
+	offset uint64
+	data   []byte
+}
+
+// quicCryptoFrames returns the CRYPTO frames of a decrypted Initial.
+// Parsing stops at the first frame type a client Initial does not carry.
+func quicCryptoFrames(p []byte) []quicCrypto {
+	var frames []quicCrypto
+	for len(p) > 0 {
+		typ, n := quicVarint(p)
+		if n == 0 {
+			return frames
+		}
+		p = p[n:]
+		switch typ {
+		case 0x00, 0x01: // PADDING, PING
+		case 0x02, 0x03: // ACK, ACK with ECN counts
+			// Largest acknowledged, delay, range count, first range.
+			var fields [4]uint64
+			for i := range fields {
+				if fields[i], n = quicVarint(p); n == 0 {
+					return frames
+				}
+				p = p[n:]
+			}
+			skip := 2 * fields[2]
+			if typ == 0x03 {
+				skip += 3
+			}
+			for ; skip > 0; skip-- {
+				if _, n = quicVarint(p); n == 0 {
+					return frames
+				}
+				p = p[n:]
+			}
+		case 0x06: // CRYPTO
+			offset, n := quicVarint(p)
+			if n == 0 {
+				return frames
+			}
+			p = p[n:]
+			length, n := quicVarint(p)
+			if n == 0 || length > uint64(len(p)-n) {
+				return frames
+			}
+			p = p[n:]
+			frames = append(frames, quicCrypto{offset: offset, data: p[:length]})
+			p = p[length:]
+		default:
+			return frames
+		}
+	}
+	return frames
+}
+
+// assembleCrypto joins frames into the contiguous handshake stream that
+// starts at offset 0, as far as it is known.
+func assembleCrypto(frames []quicCrypto) []byte {
+	sort.Slice(frames, func(i, j int) bool { return frames[i].offset < frames[j].offset })
+	var out []byte
+	for _, f := range frames {
+		if f.offset > uint64(len(out)) {
+			break
+		}
+		if end := f.offset + uint64(len(f.data)); end > uint64(len(out)) {
+			out = append(out, f.data[uint64(len(out))-f.offset:]...)
+		}
+	}
+	return out
+}
+
+// clientHelloSNI reads the server name from the start of a TLS handshake
+// stream. done is false while the ClientHello is incomplete and the
+// server_name extension has not been seen yet, i.e. more data could still
+// produce a name.
+func clientHelloSNI(hs []byte) (sni string, done bool) {
+	if len(hs) < 4 {
+		return "", false
+	}
+	if hs[0] != 1 { // not a ClientHello
+		return "", true
+	}
+	n := int(hs[1])<<16 | int(hs[2])<<8 | int(hs[3])
+	complete := len(hs) >= 4+n
+	b := hs[4:min(len(hs), 4+n)]
+
+	// legacy_version and random, then session ID, cipher suites and
+	// compression methods.
+	if len(b) < 34 {
+		return "", complete
+	}
+	b = b[34:]
+	for _, width := range []int{1, 2, 1} {
+		var ok bool
+		if b, ok = skipTLSVector(b, width); !ok {
+			return "", complete
+		}
+	}
+	if len(b) < 2 {
+		return "", complete
+	}
+	b = b[2:] // extensions length; the hello length bounds them anyway
+
+	for len(b) >= 4 {
+		typ := binary.BigEndian.Uint16(b)
+		l := int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+l {
+			break
+		}
+		if typ == 0 { // server_name
+			return parseServerName(b[4 : 4+l]), true
+		}
+		b = b[4+l:]
+	}
+	return "", complete
+}
+
+// skipTLSVector skips a vector with a width-byte length prefix.
+func skipTLSVector(b []byte, width int) ([]byte, bool) {
+	if len(b) < width {
+		return nil, false
+	}
+	n := 0
+	for _, c := range b[:width] {
+		n = n<<8 | int(c)
+	}
+	if len(b) < width+n {
+		return nil, false
+	}
+	return b[width+n:], true
+}
+
+// parseServerName returns the host_name entry of a server_name extension.
+func parseServerName(ext []byte) string {
+	if len(ext) < 2 {
+		return ""
+	}
+	list := ext[2:]
+	for len(list) >= 3 {
+		l := int(binary.BigEndian.Uint16(list[1:]))
+		if len(list) < 3+l {
+			return ""
+		}
+		if list[0] == 0 { // host_name
+			return strings.ToLower(strings.TrimSuffix(string(list[3:3+l]), "."))
+		}
+		list = list[3+l:]
+	}
+	return ""
+}
+
+// quicAttempt identifies a connection attempt: the client's Destination
+// Connection ID stays the same across its Initial packets until the server
+// answers.
+type quicAttempt struct {
+	client netip.AddrPort
+	dcid   string
+}
+
+// quicPending is a ClientHello being reassembled.
+type quicPending struct {
+	first  time.Time
+	frames []quicCrypto
+	size   int
+	done   bool
+}
+
+// QUICSniffer turns tcpdump -x output for client QUIC Initial packets into
+// QUICHellos. Feed it every line of the stream; a hello is produced once
+// the server name of a connection attempt is known.
+type QUICSniffer struct {
+	ts      time.Time
+	buf     []byte
+	inPkt   bool
+	pending map[quicAttempt]*quicPending
+}
+
+// NewQUICSniffer creates an empty sniffer.
+func NewQUICSniffer() *QUICSniffer {
+	return &QUICSniffer{pending: make(map[quicAttempt]*quicPending)}
+}
+
+// Feed consumes one line of tcpdump output. It returns a hello when the
+// line completes a packet that reveals a server name.
+func (s *QUICSniffer) Feed(line string) *QUICHello {
+	trimmed := trimLeftSpace(line)
+	if strings.HasPrefix(trimmed, "0x") {
+		if s.inPkt {
+			s.buf = appendHexDump(s.buf, trimmed)
+		}
+		return nil
+	}
+
+	hello := s.Flush()
+	field, _ := nextField(trimmed)
+	if isClockTime(field) {
+		s.inPkt = true
+		s.ts = parseClockTime(field)
+	}
+	return hello
+}
+
+// Flush decodes the packet accumulated so far, if any.
+func (s *QUICSniffer) Flush() *QUICHello {
+	if !s.inPkt {
+		return nil
+	}
+	s.inPkt = false
+	pkt := s.buf
+	s.buf = s.buf[:0]
+	return s.decode(pkt, s.ts)
+}
+
+func (s *QUICSniffer) decode(pkt []byte, ts time.Time) *QUICHello {
+	src, dst, datagram, ok := decodeUDP(pkt)
+	if !ok {
+		return nil
+	}
+	dcid, payload, err := decryptQUICInitial(datagram)
+	if err != nil {
+		return nil
+	}
+	frames := quicCryptoFrames(payload)
+	if len(frames) == 0 {
+		return nil
+	}
+
+	key := quicAttempt{client: src, dcid: string(dcid)}
+	p := s.pending[key]
+	if p == nil {
+		s.expire(ts)
+		p = &quicPending{first: ts}
+		s.pending[key] = p
+	}
+	if p.done {
+		return nil // retransmission
+	}
+	for _, f := range frames {
+		if p.size+len(f.data) > quicMaxCrypto {
+			break
+		}
+		// The payload buffer is not reused, so frames can point into it.
+		p.frames = append(p.frames, f)
+		p.size += len(f.data)
+	}
+
+	sni, done := clientHelloSNI(assembleCrypto(p.frames))
+	if !done && p.size < quicMaxCrypto {
+		return nil
+	}
+	p.done, p.frames = true, nil
+	if sni == "" {
+		return nil
+	}
+	return &QUICHello{Timestamp: ts, Client: src, Server: dst, SNI: sni}
+}
+
+// expire forgets connection attempts older than quicPendingTTL.
+func (s *QUICSniffer) expire(now time.Time) {
+	for k, p := range s.pending {
+		if now.Sub(p.first) > quicPendingTTL {
+			delete(s.pending, k)
+		}
+	}
+}
+
+// quicFlows remembers the server name of QUIC flows seen starting, so that
+// their packets in the main tcpdump stream can be tagged. It is shared by
+// the sniffer and the packet goroutine.
+type quicFlows struct {
+	mu    sync.Mutex
+	flows map[[2]netip.AddrPort]*quicFlow
+}
+
+type quicFlow struct {
+	sni  string
+	last time.Time
+}
+
+func newQUICFlows() *quicFlows {
+	return &quicFlows{flows: make(map[[2]netip.AddrPort]*quicFlow)}
+}
+
+// add records the flow of h, dropping flows idle for quicFlowIdle.
+func (f *quicFlows) add(h *QUICHello) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for k, fl := range f.flows {
+		if h.Timestamp.Sub(fl.last) > quicFlowIdle {
+			delete(f.flows, k)
+		}
+	}
+	f.flows[[2]netip.AddrPort{h.Client, h.Server}] = &quicFlow{sni: h.SNI, last: h.Timestamp}
+}
+
+// tag marks pkt as QUIC, with the flow's server name as host, when it
+// belongs to a known flow.
+func (f *quicFlows) tag(pkt *NetworkPacket) {
+	if pkt.Protocol != ProtoUDP || (pkt.DstPort != 443 && pkt.SrcPort != 443) {
+		return
+	}
+	src, err1 := netip.ParseAddr(pkt.SrcIP)
+	dst, err2 := netip.ParseAddr(pkt.DstIP)
+	if err1 != nil || err2 != nil {
+		return
+	}
+	key := [2]netip.AddrPort{netip.AddrPortFrom(src, pkt.SrcPort), netip.AddrPortFrom(dst, pkt.DstPort)}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fl, ok := f.flows[key]
+	if !ok {
+		fl, ok = f.flows[[2]netip.AddrPort{key[1], key[0]}]
+	}
+	if !ok {
+		return
+	}
+	if pkt.Timestamp.After(fl.last) {
+		fl.last = pkt.Timestamp
+	}
+	pkt.Protocol = ProtoQUIC
+	pkt.HTTPHost = fl.sni
+}
@@ -0,0 +1,187 @@
+package capture
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestQUICClientKeys_RFC9001(t *testing.T) {
+	// RFC 9001, Appendix A.1.
+	dcid, _ := hex.DecodeString("8394c8f03e515708")
+	keys := quicClientKeys(dcid)
+	for name, c := range map[string]struct {
+		got  []byte
+		want string
+	}{
+		"key": {keys.key, "1f369613dd76d5467730efcbe3b1a22d"},
+		"iv":  {keys.iv, "fa044b2f42a3fd3b46fb255c"},
+		"hp":  {keys.hp, "9f50449e04a0e810283a1e9933adedd2"},
+	} {
+		if got := hex.EncodeToString(c.got); got != c.want {
+			t.Errorf("%s = %s, want %s", name, got, c.want)
+		}
+	}
+}
+
+// buildClientHello returns a TLS ClientHello handshake message with the
+// given server name and padding extension size.
+func buildClientHello(sni string, padding int) []byte {
+	var ext []byte
+	ext = binary.BigEndian.AppendUint16(ext, 0x002b) // supported_versions
+	ext = append(ext, 0, 3, 2, 0x03, 0x04)
+	ext = binary.BigEndian.AppendUint16(ext, 0x0015) // padding
+	ext = binary.BigEndian.AppendUint16(ext, uint16(padding))
+	ext = append(ext, make([]byte, padding)...)
+	ext = binary.BigEndian.AppendUint16(ext, 0) // server_name
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(sni)+5))
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(sni)+3))
+	ext = append(ext, 0)
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(sni)))
+	ext = append(ext, sni...)
+
+	body := []byte{0x03, 0x03}
+	body = append(body, make([]byte, 32)...) // random
+	body = append(body, 0)                   // session ID
+	body = append(body, 0, 2, 0x13, 0x01)    // cipher suites
+	body = append(body, 1, 0)                // compression methods
+	body = binary.BigEndian.AppendUint16(body, uint16(len(ext)))
+	body = append(body, ext...)
+
+	msg := []byte{1, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	return append(msg, body...)
+}
+
+// cryptoFrame encodes a CRYPTO frame with 2-byte varints.
+func cryptoFrame(offset int, data []byte) []byte {
+	f := []byte{0x06, 0x40 | byte(offset>>8), byte(offset), 0x40 | byte(len(data)>>8), byte(len(data))}
+	return append(f, data...)
+}
+
+// sealQUICInitial builds a protected client Initial packet carrying frames,
+// padded to 1200 bytes as clients do.
+func sealQUICInitial(t *testing.T, dcid []byte, pn byte, frames []byte) []byte {
+	t.Helper()
+	keys := quicClientKeys(dcid)
+	block, _ := aes.NewCipher(keys.key)
+	aead, _ := cipher.NewGCM(block)
+
+	header := []byte{0xc1, 0, 0, 0, 1, byte(len(dcid))} // 2-byte packet number
+	header = append(header, dcid...)
+	header = append(header, 0, 0) // no source connection ID, no token
+	pnOff := len(header) + 2
+	if pad := 1200 - (pnOff + 2 + len(frames) + aead.Overhead()); pad > 0 {
+		frames = append(frames, make([]byte, pad)...)
+	}
+	length := 2 + len(frames) + aead.Overhead()
+	header = append(header, 0x40|byte(length>>8), byte(length), 0, pn)
+
+	nonce := append([]byte(nil), keys.iv...)
+	nonce[len(nonce)-1] ^= pn
+	pkt := aead.Seal(append([]byte(nil), header...), nonce, frames, header)
+
+	hp, _ := aes.NewCipher(keys.hp)
+	var mask [16]byte
+	hp.Encrypt(mask[:], pkt[pnOff+4:pnOff+20])
+	pkt[0] ^= mask[0] & 0x0f
+	pkt[pnOff] ^= mask[1]
+	pkt[pnOff+1] ^= mask[2]
+	return pkt
+}
+
+func TestDecryptQUICInitial(t *testing.T) {
+	dcid := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	hello := buildClientHello("www.example.com", 100)
+	pkt := sealQUICInitial(t, dcid, 0, cryptoFrame(0, hello))
+	orig := append([]byte(nil), pkt...)
+
+	gotDCID, payload, err := decryptQUICInitial(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotDCID, dcid) || !bytes.Equal(pkt, orig) {
+		t.Errorf("dcid %x, datagram modified: %v", gotDCID, !bytes.Equal(pkt, orig))
+	}
+	frames := quicCryptoFrames(payload)
+	if len(frames) != 1 || !bytes.Equal(frames[0].data, hello) {
+		t.Fatalf("frames = %+v", frames)
+	}
+	if sni, done := clientHelloSNI(frames[0].data); sni != "www.example.com" || !done {
+		t.Errorf("sni = %q, %v", sni, done)
+	}
+
+	pkt[len(pkt)-1] ^= 1
+	if _, _, err := decryptQUICInitial(pkt); err != errQUICDecrypt {
+		t.Errorf("tampered packet: err = %v", err)
+	}
+	if _, _, err := decryptQUICInitial([]byte{0x40, 1, 2, 3, 4, 5, 6, 7}); err != errQUICNotInitial {
+		t.Errorf("short header: err = %v", err)
+	}
+}
+
+func TestQUICSniffer_SplitClientHello(t *testing.T) {
+	client := [4]byte{10, 0, 2, 15}
+	server := [4]byte{142, 250, 74, 100}
+	dcid := []byte{0xde, 0xad, 0xbe, 0xef, 0, 1, 2, 3}
+
+	// A ClientHello too large for one packet, with server_name last: the
+	// second packet carries the start, the first the rest.
+	hello := buildClientHello("Play.GoogleApis.com", 1500)
+	half := 1000
+	first := sealQUICInitial(t, dcid, 0, append(append([]byte{0x01}, cryptoFrame(half, hello[half:])...), 0x00))
+	second := sealQUICInitial(t, dcid, 1, cryptoFrame(0, hello[:half]))
+
+	var lines []string
+	for i, d := range [][]byte{first, second, second} {
+		lines = append(lines, "12:00:00.10000"+string(rune('0'+i))+" IP 10.0.2.15.50000 > 142.250.74.100.443: UDP, length 1200")
+		lines = append(lines, hexDumpLines(ipv4UDP(client, server, 50000, 443, d))...)
+	}
+
+	s := NewQUICSniffer()
+	var got []*QUICHello
+	for _, line := range lines {
+		if h := s.Feed(line); h != nil {
+			got = append(got, h)
+		}
+	}
+	if h := s.Flush(); h != nil {
+		got = append(got, h)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d hellos, want 1", len(got))
+	}
+	h := got[0]
+	if h.SNI != "play.googleapis.com" || h.Client.String() != "10.0.2.15:50000" || h.Server.String() != "142.250.74.100:443" {
+		t.Errorf("hello = %+v", h)
+	}
+}
+
+func TestQUICFlows_Tag(t *testing.T) {
+	now := time.Now()
+	flows := newQUICFlows()
+	flows.add(&QUICHello{
+		Timestamp: now,
+		Client:    netip.MustParseAddrPort("10.0.2.15:50000"),
+		Server:    netip.MustParseAddrPort("142.250.74.100:443"),
+		SNI:       "www.google.com",
+	})
+
+	reply := &NetworkPacket{Timestamp: now, Protocol: ProtoUDP,
+		SrcIP: "142.250.74.100", SrcPort: 443, DstIP: "10.0.2.15", DstPort: 50000}
+	flows.tag(reply)
+	if reply.Protocol != ProtoQUIC || reply.HTTPHost != "www.google.com" {
+		t.Errorf("reply = %s %q", reply.Protocol, reply.HTTPHost)
+	}
+
+	other := &NetworkPacket{Timestamp: now, Protocol: ProtoUDP,
+		SrcIP: "10.0.2.15", SrcPort: 50001, DstIP: "142.250.74.100", DstPort: 443}
+	flows.tag(other)
+	if other.Protocol != ProtoUDP || other.HTTPHost != "" {
+		t.Errorf("unknown flow tagged: %s %q", other.Protocol, other.HTTPHost)
+	}
+}
@@ -5,14 +5,23 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/inventory"
 )
 
+// HostnameUpdate announces that the resolver learned a hostname for an IP
+// after data for it may already have been emitted unresolved.
+type HostnameUpdate struct {
+	Serial   string `json:"serial"`
+	IP       string `json:"ip"`
+	Hostname string `json:"hostname"`
+}
+
 type Resolver struct {
 	client *adb.Client
 	log    *slog.Logger
@@ -22,6 +31,11 @@ type Resolver struct {
 	dnsMu    sync.RWMutex
 	dnsCache map[string]string
 	dnsPend  map[string]struct{} // IPs currently being resolved
+	// observed holds the IPs whose hostname came from a DNS answer or
+	// handshake on the wire, which the device's DNS state doesn't replace.
+	observed map[string]struct{}
+	// deviceHits counts the hostnames learned from the device's DNS state.
+	deviceHits atomic.Int64
 
 	// UID→package cache
 	uidMu    sync.RWMutex
@@ -31,6 +45,9 @@ type Resolver struct {
 	// Background resolver
 	dnsQueue chan string
 
+	// hostCh announces newly learned IP → hostname mappings.
+	hostCh chan HostnameUpdate
+
 	// Logcat snooper for DNS/URL intelligence.
 	snooper *LogcatSnooper
 }
@@ -45,10 +62,17 @@ func NewResolver(client *adb.Client, log *slog.Logger, serial string) *Resolver
 		dnsPend:  make(map[string]struct{}),
 		uidCache: make(map[int]string),
 		dnsQueue: make(chan string, 256),
+		hostCh:   make(chan HostnameUpdate, 256),
 		snooper:  NewLogcatSnooper(client, log, serial),
 	}
 }
 
+// Hostnames returns the channel announcing newly learned IP → hostname
+// mappings, so earlier packets and connections can be backfilled.
+func (r *Resolver) Hostnames() <-chan HostnameUpdate {
+	return r.hostCh
+}
+
 // Snooper returns the logcat snooper instance (used by engine for URL captures).
 func (r *Resolver) Snooper() *LogcatSnooper {
 	return r.snooper
@@ -64,6 +88,10 @@ func (r *Resolver) Start(ctx context.Context) {
 		go r.dnsWorker(ctx)
 	}
 
+	// Read the hostnames the device resolved itself, which reverse DNS
+	// rarely finds for CDN addresses.
+	go r.pollDeviceDNS(ctx)
+
 	// Start logcat snooper for passive DNS + URL capture.
 	go func() {
 		if err := r.snooper.Run(ctx); err != nil && ctx.Err() == nil {
@@ -87,13 +115,11 @@ func (r *Resolver) Start(ctx context.Context) {
 }
 
 // ResolveHostname returns cached hostname for an IP, or empty string.
-// It checks: 1) local cache, 2) logcat DNS snooper, then queues async resolution.
+// It checks: 1) local cache (including what the device's DNS state and
+// wire DNS taught it), 2) logcat DNS snooper, then queues async resolution.
 func (r *Resolver) ResolveHostname(ip string) string {
-	if ip == "" || ip == "0.0.0.0" || ip == "::" {
-		return ""
-	}
-	// Skip private/local IPs.
-	if isPrivateIP(ip) {
+	// Skip unspecified, private and local IPs.
+	if ip == "" || isUnspecified(ip) || isPrivateIP(ip) {
 		return ""
 	}
 
@@ -109,9 +135,7 @@ func (r *Resolver) ResolveHostname(ip string) string {
 	if r.snooper != nil {
 		if snoopHost := r.snooper.LookupIP(ip); snoopHost != "" {
 			// Cache it locally too.
-			r.dnsMu.Lock()
-			r.dnsCache[ip] = snoopHost
-			r.dnsMu.Unlock()
+			r.learn(ip, snoopHost)
 			return snoopHost
 		}
 	}
@@ -133,6 +157,49 @@ func (r *Resolver) ResolveHostname(ip string) string {
 	return ""
 }
 
+// LearnDNS records the addresses answered for an observed DNS lookup. Wire
+// answers are authoritative, so they replace any reverse-DNS guess for the
+// same IP.
+func (r *Resolver) LearnDNS(l *DNSLookup) {
+	ips := l.Addresses()
+	if len(ips) == 0 || l.Query == "" {
+		return
+	}
+
+	for _, ip := range ips {
+		r.observe(ip)
+		r.learn(ip, l.Query)
+	}
+
+	if r.snooper != nil {
+		for _, ip := range ips {
+			r.snooper.addDNSMapping(l.Query, ip)
+		}
+	}
+}
+
+// LearnSNI records the server name a client asked for in a TLS or QUIC
+// handshake with ip. Like wire DNS answers, it replaces any reverse-DNS
+// guess.
+func (r *Resolver) LearnSNI(ip, host string) {
+	if host == "" || isPrivateIP(ip) {
+		return
+	}
+	ip = NormalizeIP(ip)
+	r.observe(ip)
+	r.learn(ip, host)
+}
+
+// observe marks ip's hostname as seen on the wire.
+func (r *Resolver) observe(ip string) {
+	r.dnsMu.Lock()
+	if r.observed == nil {
+		r.observed = make(map[string]struct{})
+	}
+	r.observed[ip] = struct{}{}
+	r.dnsMu.Unlock()
+}
+
 // ResolvePackageName returns the app package name for a UID, or empty string.
 func (r *Resolver) ResolvePackageName(uid int) string {
 	if uid <= 0 {
@@ -153,16 +220,30 @@ func (r *Resolver) dnsWorker(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case ip := <-r.dnsQueue:
-			host := r.doReverseDNS(ip)
-
-			r.dnsMu.Lock()
-			r.dnsCache[ip] = host
-			delete(r.dnsPend, ip)
-			r.dnsMu.Unlock()
+			r.learn(ip, r.doReverseDNS(ip))
 		}
 	}
 }
 
+// learn caches host for ip and clears its pending flag. An empty host is
+// cached too, so failed lookups are not retried. A new non-empty mapping is
+// announced on the Hostnames channel (dropped if nobody keeps up).
+func (r *Resolver) learn(ip, host string) {
+	r.dnsMu.Lock()
+	prev := r.dnsCache[ip]
+	r.dnsCache[ip] = host
+	delete(r.dnsPend, ip)
+	r.dnsMu.Unlock()
+
+	if host == "" || host == prev {
+		return
+	}
+	select {
+	case r.hostCh <- HostnameUpdate{Serial: r.serial, IP: ip, Hostname: host}:
+	default:
+	}
+}
+
 // doReverseDNS performs the actual DNS lookup with multiple fallbacks:
 // 1. Check logcat snooper cache (again, may have been populated since queueing)
 // 2. Go net.LookupAddr (standard reverse DNS)
@@ -212,26 +293,10 @@ func (r *Resolver) loadUIDMap(ctx context.Context) {
 	}
 
 	newMap := make(map[int]string)
-	for _, line := range strings.Split(out, "\n") {
-		line = strings.TrimSpace(line)
-		if !strings.HasPrefix(line, "package:") {
-			continue
+	for _, p := range inventory.ParseList(out) {
+		if p.UID >= 0 {
+			newMap[p.UID] = p.Name
 		}
-
-		// Format: "package:com.example.app uid:10123"
-		uidIdx := strings.LastIndex(line, " uid:")
-		if uidIdx < 0 {
-			continue
-		}
-
-		pkg := strings.TrimPrefix(line[:uidIdx], "package:")
-		uidStr := strings.TrimPrefix(line[uidIdx:], " uid:")
-		uid, err := strconv.Atoi(strings.TrimSpace(uidStr))
-		if err != nil {
-			continue
-		}
-
-		newMap[uid] = pkg
 	}
 
 	if len(newMap) > 0 {
@@ -250,52 +315,15 @@ func (r *Resolver) GetDNSCacheSize() int {
 	return len(r.dnsCache)
 }
 
-// isPrivateIP checks if an IP is in a private/reserved range.
-func isPrivateIP(ip string) bool {
-	parsed := net.ParseIP(ip)
-	if parsed == nil {
-		return false
-	}
-	// RFC1918 + loopback + link-local
-	privateRanges := []string{
-		"10.0.0.0/8",
-		"172.16.0.0/12",
-		"192.168.0.0/16",
-		"127.0.0.0/8",
-		"169.254.0.0/16",
-		"::1/128",
-		"fe80::/10",
-		"fc00::/7",
-	}
-	for _, cidr := range privateRanges {
-		_, network, _ := net.ParseCIDR(cidr)
-		if network.Contains(parsed) {
-			return true
-		}
-	}
-	return false
-}
-
-// EnrichPacket adds resolved hostname to a packet (in-place modification not safe, returns copy).
-func (r *Resolver) EnrichPacket(pkt *NetworkPacket) {
-	if pkt.HTTPHost == "" {
-		host := r.ResolveHostname(pkt.DstIP)
-		if host != "" {
-			pkt.HTTPHost = host
-		}
-	}
-}
-
-// EnrichConnection adds resolved hostname and package name to a connection.
-func (r *Resolver) EnrichConnection(conn *Connection) {
-	host := r.ResolveHostname(conn.RemoteIP)
-	if host != "" {
-		conn.Hostname = host
-	}
-	pkg := r.ResolvePackageName(conn.UID)
-	if pkg != "" {
-		conn.AppName = pkg
+// cachedHostname returns the hostname already learned for ip, without
+// queueing a lookup.
+func (r *Resolver) cachedHostname(ip string) string {
+	if ip == "" || isPrivateIP(ip) {
+		return ""
 	}
+	r.dnsMu.RLock()
+	defer r.dnsMu.RUnlock()
+	return r.dnsCache[ip]
 }
 
 // Snapshot returns current DNS + UID cache stats as a formatted string.
@@ -308,5 +336,5 @@ func (r *Resolver) Snapshot() string {
 	uidSize := len(r.uidCache)
 	r.uidMu.RUnlock()
 
-	return fmt.Sprintf("DNS: %d cached, UID: %d packages", dnsSize, uidSize)
+	return fmt.Sprintf("DNS: %d cached (%d from device), UID: %d packages", dnsSize, r.deviceHits.Load(), uidSize)
 }
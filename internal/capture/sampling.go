@@ -0,0 +1,130 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxSampleRate bounds SamplingConfig.Rate.
+const MaxSampleRate = 1_000_000
+
+// SamplingConfig thins out the packets of a chatty capture before they
+// reach the server. Connections and DNS lookups are not sampled.
+type SamplingConfig struct {
+	// Rate keeps one packet in Rate, the first of every Rate packets; 0
+	// and 1 keep them all.
+	Rate int
+	// MaxPPS caps the packets kept per second; 0 leaves them uncapped.
+	MaxPPS int
+	// MaxBPS caps the bytes of the packets kept per second, by their
+	// captured length; 0 leaves them uncapped.
+	MaxBPS int64
+}
+
+// Validate reports a setting out of range.
+func (c SamplingConfig) Validate() error {
+	switch {
+	case c.Rate < 0 || c.Rate > MaxSampleRate:
+		return fmt.Errorf("sample rate must be between 1 and %d", MaxSampleRate)
+	case c.MaxPPS < 0:
+		return errors.New("packet rate cap must not be negative")
+	case c.MaxBPS < 0:
+		return errors.New("byte rate cap must not be negative")
+	}
+	return nil
+}
+
+// SamplingStats reports the sampling of a capture and what it skipped.
+type SamplingStats struct {
+	Rate   int   `json:"rate,omitempty"`
+	MaxPPS int   `json:"max_pps,omitempty"`
+	MaxBPS int64 `json:"max_bps,omitempty"`
+
+	// Seen counts the packets the capture decoded and SeenBytes their
+	// length; Sampled counts those skipped by Rate, Throttled those
+	// skipped by the rate caps, and Kept and KeptBytes the rest. Packets
+	// made up from the socket table or logcat are not sampled and not
+	// counted here.
+	Seen      int64 `json:"seen"`
+	SeenBytes int64 `json:"seen_bytes"`
+	Sampled   int64 `json:"sampled"`
+	Throttled int64 `json:"throttled"`
+	Kept      int64 `json:"kept"`
+	KeptBytes int64 `json:"kept_bytes"`
+
+	// PacketRatio and ByteRatio are Seen over Kept and SeenBytes over
+	// KeptBytes: multiply packet and byte aggregates of the capture by
+	// them to estimate the real traffic. They are 1 when nothing was
+	// skipped and 0 while nothing was kept.
+	PacketRatio float64 `json:"packet_ratio"`
+	ByteRatio   float64 `json:"byte_ratio"`
+}
+
+// rateWindow counts the packets kept in the current second for the rate
+// caps.
+type rateWindow struct {
+	start   time.Time
+	packets int
+	bytes   int64
+}
+
+// SetSampling sets the packet sampling and rate caps. Call before Run.
+func (e *Engine) SetSampling(cfg SamplingConfig) {
+	e.updateStats(func(s *CaptureStats) {
+		e.sampling = cfg
+		s.Sampling.Rate, s.Sampling.MaxPPS, s.Sampling.MaxBPS = cfg.Rate, cfg.MaxPPS, cfg.MaxBPS
+	})
+}
+
+// sample counts pkt and reports whether it is kept under the sampling
+// config.
+func (e *Engine) sample(pkt *NetworkPacket) bool {
+	now := time.Now()
+	size := int64(pkt.Length)
+
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
+	s := &e.stats
+	s.LastActivity = now
+	s.Sampling.Seen++
+	s.Sampling.SeenBytes += size
+
+	if rate := e.sampling.Rate; rate > 1 {
+		e.sampleSeq++
+		if (e.sampleSeq-1)%uint64(rate) != 0 {
+			s.Sampling.Sampled++
+			return false
+		}
+	}
+	if cfg := e.sampling; cfg.MaxPPS > 0 || cfg.MaxBPS > 0 {
+		w := &e.window
+		if now.Sub(w.start) >= time.Second {
+			*w = rateWindow{start: now}
+		}
+		if (cfg.MaxPPS > 0 && w.packets >= cfg.MaxPPS) || (cfg.MaxBPS > 0 && w.bytes+size > cfg.MaxBPS) {
+			s.Sampling.Throttled++
+			return false
+		}
+		w.packets++
+		w.bytes += size
+	}
+	s.PacketCount++
+	s.Sampling.Kept++
+	s.Sampling.KeptBytes += size
+	return true
+}
+
+// ratios fills in the scaling ratios of s.
+func (s *SamplingStats) ratios() {
+	s.PacketRatio, s.ByteRatio = 0, 0
+	if s.Kept > 0 {
+		s.PacketRatio = float64(s.Seen) / float64(s.Kept)
+	}
+	switch {
+	case s.KeptBytes > 0:
+		s.ByteRatio = float64(s.SeenBytes) / float64(s.KeptBytes)
+	case s.SeenBytes == 0 && s.Kept > 0:
+		s.ByteRatio = 1 // packets without a length
+	}
+}
@@ -0,0 +1,82 @@
+package capture
+
+import "testing"
+
+func TestEmitPacket_Sampling(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       SamplingConfig
+		wantKept  []string
+		wantStats SamplingStats
+	}{
+		{
+			name:     "all",
+			wantKept: []string{"0", "1", "2", "3", "4", "5"},
+			wantStats: SamplingStats{
+				Seen: 6, SeenBytes: 600, Kept: 6, KeptBytes: 600, PacketRatio: 1, ByteRatio: 1,
+			},
+		},
+		{
+			name:     "one in three",
+			cfg:      SamplingConfig{Rate: 3},
+			wantKept: []string{"0", "3"},
+			wantStats: SamplingStats{
+				Rate: 3, Seen: 6, SeenBytes: 600, Sampled: 4, Kept: 2, KeptBytes: 200, PacketRatio: 3, ByteRatio: 3,
+			},
+		},
+		{
+			name:     "packet cap",
+			cfg:      SamplingConfig{MaxPPS: 4},
+			wantKept: []string{"0", "1", "2", "3"},
+			wantStats: SamplingStats{
+				MaxPPS: 4, Seen: 6, SeenBytes: 600, Throttled: 2, Kept: 4, KeptBytes: 400, PacketRatio: 1.5, ByteRatio: 1.5,
+			},
+		},
+		{
+			name:     "byte cap after sampling",
+			cfg:      SamplingConfig{Rate: 2, MaxBPS: 250},
+			wantKept: []string{"0", "2"},
+			wantStats: SamplingStats{
+				Rate: 2, MaxBPS: 250, Seen: 6, SeenBytes: 600, Sampled: 3, Throttled: 1, Kept: 2, KeptBytes: 200, PacketRatio: 3, ByteRatio: 3,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine()
+			e.SetBuffer(BufferConfig{Size: 16})
+			e.SetSampling(tt.cfg)
+			for i := range 6 {
+				e.emitPacket(&NetworkPacket{ID: string(rune('0' + i)), Length: 100})
+			}
+
+			var kept []string
+			for len(e.packetCh) > 0 {
+				kept = append(kept, (<-e.packetCh).ID)
+			}
+			if len(kept) != len(tt.wantKept) {
+				t.Fatalf("kept %v, want %v", kept, tt.wantKept)
+			}
+			for i := range kept {
+				if kept[i] != tt.wantKept[i] {
+					t.Fatalf("kept %v, want %v", kept, tt.wantKept)
+				}
+			}
+			st := e.Stats()
+			if st.Sampling != tt.wantStats || st.PacketCount != int64(len(tt.wantKept)) {
+				t.Errorf("stats = %d packets, %+v\nwant %+v", st.PacketCount, st.Sampling, tt.wantStats)
+			}
+		})
+	}
+}
+
+func TestSamplingConfig_Validate(t *testing.T) {
+	for _, cfg := range []SamplingConfig{{Rate: -1}, {Rate: MaxSampleRate + 1}, {MaxPPS: -1}, {MaxBPS: -1}} {
+		if cfg.Validate() == nil {
+			t.Errorf("%+v: no error", cfg)
+		}
+	}
+	if err := (SamplingConfig{Rate: 10, MaxPPS: 1000, MaxBPS: 1 << 20}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,318 @@
+package capture
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ssCmd dumps TCP sockets with kernel info (RTT, byte counters).
+	ssCmd = "ss -tin 2>/dev/null"
+	// qtaguidCmd reads per-UID interface counters (Android 9 and older; newer
+	// releases account in eBPF maps that are not readable from the shell).
+	qtaguidCmd = "cat /proc/net/xt_qtaguid/stats 2>/dev/null"
+	// netDevCmd reads per-interface totals.
+	netDevCmd = "cat /proc/net/dev 2>/dev/null"
+)
+
+// SocketInfo is the per-socket data `ss -ti` adds to a /proc/net entry.
+type SocketInfo struct {
+	BytesSent     uint64
+	BytesReceived uint64
+	RTTMs         float64
+}
+
+// AppTraffic is the traffic volume attributed to one UID.
+type AppTraffic struct {
+	UID     int    `json:"uid"`
+	AppName string `json:"app_name,omitempty"`
+	RxBytes uint64 `json:"rx_bytes"`
+	TxBytes uint64 `json:"tx_bytes"`
+}
+
+// InterfaceTraffic is the traffic volume of one network interface.
+type InterfaceTraffic struct {
+	Name      string `json:"name"`
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+}
+
+// TrafficSnapshot is the latest volume accounting of a capture.
+type TrafficSnapshot struct {
+	Serial string `json:"serial"`
+	// Source says where per-app numbers come from: "xt_qtaguid" (kernel
+	// per-UID counters, covers closed sockets too) or "ss" (sum over the
+	// currently open TCP sockets).
+	Source     string             `json:"source"`
+	Apps       []AppTraffic       `json:"apps"`
+	Interfaces []InterfaceTraffic `json:"interfaces"`
+}
+
+// endpointKey identifies a socket by its endpoints, with addresses in
+// canonical form so /proc/net and ss spellings of the same socket match.
+func endpointKey(localIP string, localPort uint16, remoteIP string, remotePort uint16) string {
+	return NormalizeIP(localIP) + ":" + strconv.FormatUint(uint64(localPort), 10) +
+		"->" + NormalizeIP(remoteIP) + ":" + strconv.FormatUint(uint64(remotePort), 10)
+}
+
+// ParseSS parses `ss -tin` output into socket info keyed by endpointKey.
+// Each socket is a summary line followed by an indented line of
+// "key:value" info fields.
+func ParseSS(out string) map[string]SocketInfo {
+	sockets := make(map[string]SocketInfo)
+	var key string
+
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			key = ""
+			f := strings.Fields(line)
+			if len(f) < 5 || f[0] == "State" {
+				continue
+			}
+			lip, lport, ok1 := splitSSAddr(f[3])
+			rip, rport, ok2 := splitSSAddr(f[4])
+			if ok1 && ok2 {
+				key = endpointKey(lip, lport, rip, rport)
+			}
+			continue
+		}
+		if key == "" {
+			continue
+		}
+
+		sockets[key] = parseSSInfo(line)
+		key = ""
+	}
+	return sockets
+}
+
+// parseSSInfo reads the counters of an indented ss info line.
+func parseSSInfo(line string) SocketInfo {
+	var info SocketInfo
+	var acked uint64
+	for _, field := range strings.Fields(line) {
+		name, value, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		switch name {
+		case "rtt":
+			// "rtt:18.5/7.25" is smoothed RTT / variance in ms.
+			rtt, _, _ := strings.Cut(value, "/")
+			info.RTTMs, _ = strconv.ParseFloat(rtt, 64)
+		case "bytes_sent":
+			info.BytesSent, _ = strconv.ParseUint(value, 10, 64)
+		case "bytes_acked":
+			acked, _ = strconv.ParseUint(value, 10, 64)
+		case "bytes_received":
+			info.BytesReceived, _ = strconv.ParseUint(value, 10, 64)
+		}
+	}
+	// Older kernels only report bytes_acked.
+	if info.BytesSent == 0 {
+		info.BytesSent = acked
+	}
+	return info
+}
+
+// splitSSAddr splits an ss address such as "10.0.2.16:443",
+// "[::ffff:1.2.3.4]:443", "::ffff:1.2.3.4:443" or "10.0.2.16%wlan0:5353".
+func splitSSAddr(s string) (string, uint16, bool) {
+	i := strings.LastIndexByte(s, ':')
+	if i <= 0 {
+		return "", 0, false
+	}
+	port, err := strconv.ParseUint(s[i+1:], 10, 16)
+	if err != nil {
+		return "", 0, false
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(s[:i], "["), "]")
+	if pct := strings.IndexByte(host, '%'); pct >= 0 {
+		host = host[:pct]
+	}
+	return host, uint16(port), true
+}
+
+// ParseQtaguidStats sums /proc/net/xt_qtaguid/stats per UID over all
+// interfaces. Only untagged rows (acct_tag_hex 0x0) are counted, since
+// tagged rows are a breakdown of the same bytes.
+//
+//	idx iface acct_tag_hex uid_tag_int cnt_set rx_bytes rx_packets tx_bytes tx_packets ...
+func ParseQtaguidStats(out string) map[int]AppTraffic {
+	apps := make(map[int]AppTraffic)
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Fields(line)
+		if len(f) < 9 || f[0] == "idx" || f[2] != "0x0" {
+			continue
+		}
+		uid, err := strconv.Atoi(f[3])
+		if err != nil {
+			continue
+		}
+		rx, err1 := strconv.ParseUint(f[5], 10, 64)
+		tx, err2 := strconv.ParseUint(f[7], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		a := apps[uid]
+		a.UID = uid
+		a.RxBytes += rx
+		a.TxBytes += tx
+		apps[uid] = a
+	}
+	return apps
+}
+
+// ParseNetDev parses /proc/net/dev, skipping the loopback interface.
+//
+//	face |bytes packets errs drop fifo frame compressed multicast|bytes packets ...
+//	wlan0: 123456 789 0 0 0 0 0 0 654321 456 0 0 0 0 0 0
+func ParseNetDev(out string) []InterfaceTraffic {
+	var ifaces []InterfaceTraffic
+	for _, line := range strings.Split(out, "\n") {
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		f := strings.Fields(rest)
+		if name == "lo" || len(f) < 10 {
+			continue
+		}
+		var nums [10]uint64
+		valid := true
+		for i := range nums {
+			n, err := strconv.ParseUint(f[i], 10, 64)
+			if err != nil {
+				valid = false
+				break
+			}
+			nums[i] = n
+		}
+		if !valid {
+			continue
+		}
+		ifaces = append(ifaces, InterfaceTraffic{
+			Name:      name,
+			RxBytes:   nums[0],
+			RxPackets: nums[1],
+			TxBytes:   nums[8],
+			TxPackets: nums[9],
+		})
+	}
+	return ifaces
+}
+
+// sumConnTraffic attributes open-socket byte counters to their UIDs. Used
+// when the kernel has no per-UID counters to read.
+func sumConnTraffic(conns []Connection) map[int]AppTraffic {
+	apps := make(map[int]AppTraffic)
+	for _, c := range conns {
+		if c.BytesSent == 0 && c.BytesReceived == 0 {
+			continue
+		}
+		a := apps[c.UID]
+		a.UID = c.UID
+		a.RxBytes += c.BytesReceived
+		a.TxBytes += c.BytesSent
+		apps[c.UID] = a
+	}
+	return apps
+}
+
+// sortedApps returns apps by total volume, largest first.
+func sortedApps(apps map[int]AppTraffic) []AppTraffic {
+	out := make([]AppTraffic, 0, len(apps))
+	for _, a := range apps {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		ti, tj := out[i].RxBytes+out[i].TxBytes, out[j].RxBytes+out[j].TxBytes
+		if ti != tj {
+			return ti > tj
+		}
+		return out[i].UID < out[j].UID
+	})
+	return out
+}
+
+// attachSocketInfo copies ss counters onto the matching TCP connections.
+func attachSocketInfo(conns []Connection, sockets map[string]SocketInfo) {
+	if len(sockets) == 0 {
+		return
+	}
+	for i := range conns {
+		c := &conns[i]
+		if c.Protocol != ProtoTCP {
+			continue
+		}
+		info, ok := sockets[endpointKey(c.LocalIP, c.LocalPort, c.RemoteIP, c.RemotePort)]
+		if !ok {
+			continue
+		}
+		c.BytesSent = info.BytesSent
+		c.BytesReceived = info.BytesReceived
+		c.RTTMs = info.RTTMs
+	}
+}
+
+// trafficChanged reports whether a connection moved any bytes since prev.
+func trafficChanged(prev, cur Connection) bool {
+	return prev.BytesSent != cur.BytesSent || prev.BytesReceived != cur.BytesReceived
+}
+
+// pollTraffic refreshes the per-app and per-interface totals. Per-UID kernel
+// counters are preferred; without them the open TCP sockets are summed.
+func (e *Engine) pollTraffic(ctx context.Context, known map[string]Connection) {
+	readCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	snap := &TrafficSnapshot{Serial: e.serial}
+
+	var apps map[int]AppTraffic
+	if out, err := e.shell(readCtx, qtaguidCmd); err == nil {
+		apps = ParseQtaguidStats(out)
+	}
+	if len(apps) > 0 {
+		snap.Source = "xt_qtaguid"
+	} else {
+		conns := make([]Connection, 0, len(known))
+		for _, c := range known {
+			conns = append(conns, c)
+		}
+		apps = sumConnTraffic(conns)
+		snap.Source = "ss"
+	}
+	snap.Apps = sortedApps(apps)
+	for i := range snap.Apps {
+		snap.Apps[i].AppName = e.resolver.ResolvePackageName(snap.Apps[i].UID)
+	}
+
+	if out, err := e.shell(readCtx, netDevCmd); err == nil {
+		snap.Interfaces = ParseNetDev(out)
+	}
+
+	e.trafficMu.Lock()
+	e.traffic = snap
+	e.trafficMu.Unlock()
+}
+
+// Traffic returns the latest per-app and per-interface volume accounting.
+// ok is false until the first poll has completed; only the /proc/net
+// capture mode polls.
+func (e *Engine) Traffic() (snap TrafficSnapshot, ok bool) {
+	e.trafficMu.Lock()
+	defer e.trafficMu.Unlock()
+	if e.traffic == nil {
+		return TrafficSnapshot{}, false
+	}
+	return *e.traffic, true
+}
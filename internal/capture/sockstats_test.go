@@ -0,0 +1,94 @@
+package capture
+
+import (
+	"testing"
+)
+
+func TestParseSS(t *testing.T) {
+	input := `State      Recv-Q Send-Q Local Address:Port               Peer Address:Port
+ESTAB      0      0      192.168.1.1:54514                174.216.14.34:443
+	 cubic wscale:8,7 rto:236 rtt:33.5/12.25 ato:40 mss:1400 bytes_sent:1520 bytes_acked:1521 bytes_received:48213 segs_out:40 segs_in:52
+ESTAB      0      0      [::ffff:10.0.2.16]:41234         [::ffff:142.250.74.36]:443
+	 cubic rtt:18/9 bytes_acked:900 bytes_received:2048
+ESTAB      0      0      2001:db8::1:50000                2606:4700::1111:443
+	 cubic rtt:7.1/3`
+
+	got := ParseSS(input)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 sockets, got %d: %v", len(got), got)
+	}
+
+	v4 := got[endpointKey("192.168.1.1", 54514, "174.216.14.34", 443)]
+	if v4.BytesSent != 1520 || v4.BytesReceived != 48213 || v4.RTTMs != 33.5 {
+		t.Errorf("v4 socket: %+v", v4)
+	}
+
+	// Mapped addresses match the plain IPv4 spelling /proc/net uses, and
+	// bytes_acked stands in for a missing bytes_sent.
+	mapped, ok := got[endpointKey("10.0.2.16", 41234, "142.250.74.36", 443)]
+	if !ok || mapped.BytesSent != 900 || mapped.BytesReceived != 2048 || mapped.RTTMs != 18 {
+		t.Errorf("mapped socket: %+v (found %v)", mapped, ok)
+	}
+
+	v6 := got[endpointKey("2001:db8::1", 50000, "2606:4700::1111", 443)]
+	if v6.RTTMs != 7.1 || v6.BytesSent != 0 {
+		t.Errorf("v6 socket: %+v", v6)
+	}
+}
+
+func TestAttachSocketInfo(t *testing.T) {
+	conns := []Connection{
+		{LocalIP: "192.168.1.1", LocalPort: 54514, RemoteIP: "174.216.14.34", RemotePort: 443, Protocol: ProtoTCP},
+		{LocalIP: "192.168.1.1", LocalPort: 54514, RemoteIP: "174.216.14.34", RemotePort: 443, Protocol: ProtoUDP},
+	}
+	attachSocketInfo(conns, map[string]SocketInfo{
+		endpointKey("192.168.1.1", 54514, "174.216.14.34", 443): {BytesSent: 10, BytesReceived: 20, RTTMs: 1.5},
+	})
+	if c := conns[0]; c.BytesSent != 10 || c.BytesReceived != 20 || c.RTTMs != 1.5 {
+		t.Errorf("tcp: %+v", c)
+	}
+	if c := conns[1]; c.BytesSent != 0 || c.RTTMs != 0 {
+		t.Errorf("udp should not match a TCP socket: %+v", c)
+	}
+}
+
+func TestParseQtaguidStats(t *testing.T) {
+	input := `idx iface acct_tag_hex uid_tag_int cnt_set rx_bytes rx_packets tx_bytes tx_packets rx_tcp_bytes
+2 wlan0 0x0 10061 0 1000 10 200 2 0
+3 wlan0 0x0 10061 1 500 5 100 1 0
+4 rmnet0 0x0 10061 0 250 3 50 1 0
+5 wlan0 0x3e800000000 10061 0 999 9 999 9 0
+6 wlan0 0x0 1000 0 42 1 24 1 0`
+
+	got := ParseQtaguidStats(input)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 uids, got %d", len(got))
+	}
+	if a := got[10061]; a.RxBytes != 1750 || a.TxBytes != 350 {
+		t.Errorf("uid 10061: %+v", a)
+	}
+	if a := got[1000]; a.RxBytes != 42 || a.TxBytes != 24 {
+		t.Errorf("uid 1000: %+v", a)
+	}
+
+	apps := sortedApps(got)
+	if apps[0].UID != 10061 {
+		t.Errorf("sorted: %+v", apps)
+	}
+}
+
+func TestParseNetDev(t *testing.T) {
+	input := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:   12345      67    0    0    0     0          0         0    12345      67    0    0    0     0       0          0
+ wlan0: 9876543    8123    0    0    0     0          0         0  1234567    4567    0    0    0     0       0          0`
+
+	got := ParseNetDev(input)
+	if len(got) != 1 {
+		t.Fatalf("expected 1 interface, got %d: %+v", len(got), got)
+	}
+	want := InterfaceTraffic{Name: "wlan0", RxBytes: 9876543, RxPackets: 8123, TxBytes: 1234567, TxPackets: 4567}
+	if got[0] != want {
+		t.Errorf("got %+v, want %+v", got[0], want)
+	}
+}
@@ -0,0 +1,269 @@
+package capture
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ssConnCmd lists TCP and UDP sockets with owning process (-p), UID (-e)
+	// and kernel info (-i). Without root, -p only reveals the shell's own
+	// processes on some builds; the UID is always present.
+	ssConnCmd = "ss -tunaepi 2>/dev/null"
+	// netstatConnCmd is the fallback for builds without ss (toybox netstat).
+	netstatConnCmd = "netstat -tunaep 2>/dev/null"
+)
+
+// ss output (-tunaepi), one summary line per socket followed by an
+// indented info line:
+//   Netid State Recv-Q Send-Q Local Address:Port Peer Address:Port Process
+//   tcp   ESTAB 0      0      10.0.2.16:41234    142.250.74.36:443 users:(("com.android.chrome",pid=4211,fd=88)) uid:10061 ino:91234 sk:1 <->
+//   	 cubic rtt:18.5/7.25 bytes_sent:1024 bytes_received:8192
+//
+// netstat output (-tunaep); UDP rows may leave State empty:
+//   Proto Recv-Q Send-Q Local Address   Foreign Address   State       User  Inode  PID/Program Name
+//   tcp        0      0 10.0.2.16:41234 142.250.74.36:443 ESTABLISHED 10061 91234  4211/com.android.chrome
+
+// SSParser parses `ss -tunaepi` and `netstat -tunaep` output into
+// connections carrying the owning process.
+type SSParser struct {
+	serial string
+	nextID uint64
+}
+
+// NewSSParser creates a new parser for the given device serial.
+func NewSSParser(serial string) *SSParser {
+	return &SSParser{serial: serial}
+}
+
+// ParseSockets parses `ss -tunaepi` output. Info lines are folded into the
+// preceding socket's byte counters and RTT.
+func (p *SSParser) ParseSockets(output string) []Connection {
+	var conns []Connection
+	now := time.Now()
+	// last is the index of the connection an info line belongs to, or -1
+	// when the preceding summary line was skipped.
+	last := -1
+
+	for output != "" {
+		var line string
+		line, output, _ = strings.Cut(output, "\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if last >= 0 {
+				applySocketInfo(&conns[last], parseSSInfo(line))
+			}
+			continue
+		}
+
+		last = -1
+		f := strings.Fields(line)
+		if len(f) < 6 || f[0] == "Netid" {
+			continue
+		}
+		conn := p.connection(f[0], parseSSState(f[1]), f[4], f[5], now)
+		if conn == nil {
+			continue
+		}
+		for _, tok := range f[6:] {
+			switch {
+			case strings.HasPrefix(tok, "users:"):
+				conn.Process, conn.PID = parseSSUsers(tok)
+			case strings.HasPrefix(tok, "uid:"):
+				conn.UID, _ = strconv.Atoi(tok[len("uid:"):])
+			}
+		}
+		conns = append(conns, *conn)
+		last = len(conns) - 1
+	}
+
+	return conns
+}
+
+// ParseNetstat parses `netstat -tunaep` output.
+func (p *SSParser) ParseNetstat(output string) []Connection {
+	var conns []Connection
+	now := time.Now()
+
+	for output != "" {
+		var line string
+		line, output, _ = strings.Cut(output, "\n")
+		f := strings.Fields(line)
+		if len(f) < 5 || !strings.HasPrefix(f[0], "tcp") && !strings.HasPrefix(f[0], "udp") {
+			continue // headers and "Active Internet connections"
+		}
+
+		rest := f[5:]
+		state := ConnClose // unconnected UDP sockets have no state column
+		if len(rest) > 0 {
+			if st := parseSSState(rest[0]); !strings.HasPrefix(string(st), "UNKNOWN_") {
+				state = st
+				rest = rest[1:]
+			}
+		}
+		conn := p.connection(f[0], state, f[3], f[4], now)
+		if conn == nil {
+			continue
+		}
+		if len(rest) > 0 {
+			conn.UID = parseAndroidUser(rest[0])
+		}
+		if len(rest) > 2 {
+			if pid, name, ok := strings.Cut(rest[2], "/"); ok {
+				conn.PID, _ = strconv.Atoi(pid)
+				conn.Process = name
+			}
+		}
+		conns = append(conns, *conn)
+	}
+
+	return conns
+}
+
+// connection builds a connection from the columns both tools share,
+// applying the same filtering as the /proc/net parser: loopback and
+// listening sockets are dropped.
+func (p *SSParser) connection(netid string, state ConnState, local, peer string, now time.Time) *Connection {
+	var proto Protocol
+	switch {
+	case strings.HasPrefix(netid, "tcp"):
+		proto = ProtoTCP
+	case strings.HasPrefix(netid, "udp"):
+		proto = ProtoUDP
+	default:
+		return nil
+	}
+
+	localIP, localPort, ok1 := parseSSEndpoint(local)
+	remoteIP, remotePort, ok2 := parseSSEndpoint(peer)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	if state == ConnListen || isLoopback(localIP) && isLoopback(remoteIP) {
+		return nil
+	}
+
+	p.nextID++
+	return &Connection{
+		ID:         p.serial + "-conn-" + strconv.FormatUint(p.nextID, 10),
+		Serial:     p.serial,
+		LocalIP:    localIP,
+		LocalPort:  localPort,
+		RemoteIP:   remoteIP,
+		RemotePort: remotePort,
+		State:      state,
+		Protocol:   proto,
+		FirstSeen:  now,
+		LastSeen:   now,
+	}
+}
+
+// parseSSEndpoint parses an ss or netstat address. Wildcards ("*:*",
+// "0.0.0.0:*") become the unspecified address and port 0, as in
+// /proc/net, and IPv4-mapped addresses are unmapped.
+func parseSSEndpoint(s string) (string, uint16, bool) {
+	if s == "*" || s == "*:*" {
+		return "0.0.0.0", 0, true
+	}
+	if strings.HasSuffix(s, ":*") {
+		s = strings.TrimSuffix(s, "*") + "0"
+	}
+	host, port, ok := splitSSAddr(s)
+	if !ok {
+		return "", 0, false
+	}
+	if host == "*" {
+		host = "0.0.0.0"
+	}
+	return NormalizeIP(host), port, true
+}
+
+// parseSSState maps ss ("ESTAB", "SYN-SENT", "UNCONN") and netstat
+// ("ESTABLISHED", "FIN_WAIT1") state names to ConnState.
+func parseSSState(s string) ConnState {
+	switch strings.ReplaceAll(strings.ToUpper(s), "-", "_") {
+	case "ESTAB", "ESTABLISHED":
+		return ConnEstablished
+	case "SYN_SENT":
+		return ConnSynSent
+	case "SYN_RECV":
+		return ConnSynRecv
+	case "FIN_WAIT_1", "FIN_WAIT1":
+		return ConnFinWait1
+	case "FIN_WAIT_2", "FIN_WAIT2":
+		return ConnFinWait2
+	case "TIME_WAIT":
+		return ConnTimeWait
+	case "UNCONN", "CLOSE":
+		return ConnClose
+	case "CLOSE_WAIT":
+		return ConnCloseWait
+	case "LAST_ACK":
+		return ConnLastAck
+	case "LISTEN":
+		return ConnListen
+	case "CLOSING":
+		return ConnClosing
+	default:
+		return ConnState("UNKNOWN_" + s)
+	}
+}
+
+// parseSSUsers extracts the first process from
+// users:(("name",pid=123,fd=4),("other",pid=456,fd=7)).
+func parseSSUsers(tok string) (string, int) {
+	_, rest, ok := strings.Cut(tok, `(("`)
+	if !ok {
+		return "", 0
+	}
+	name, rest, ok := strings.Cut(rest, `"`)
+	if !ok {
+		return "", 0
+	}
+	var pid int
+	if _, after, ok := strings.Cut(rest, "pid="); ok {
+		end := strings.IndexAny(after, ",)")
+		if end < 0 {
+			end = len(after)
+		}
+		pid, _ = strconv.Atoi(after[:end])
+	}
+	return name, pid
+}
+
+func applySocketInfo(c *Connection, info SocketInfo) {
+	c.BytesSent = info.BytesSent
+	c.BytesReceived = info.BytesReceived
+	c.RTTMs = info.RTTMs
+}
+
+// parseAndroidUser converts netstat's User column, numeric or an Android
+// user name such as "u0_a61", "system" or "root", to a UID. Unknown names
+// map to -1.
+func parseAndroidUser(s string) int {
+	if uid, err := strconv.Atoi(s); err == nil {
+		return uid
+	}
+	switch s {
+	case "root":
+		return 0
+	case "system":
+		return 1000
+	case "radio":
+		return 1001
+	case "shell":
+		return 2000
+	}
+	// u<user>_a<app> is UID user*100000 + 10000 + app.
+	if user, app, ok := strings.Cut(strings.TrimPrefix(s, "u"), "_a"); ok && s[0] == 'u' {
+		u, err1 := strconv.Atoi(user)
+		a, err2 := strconv.Atoi(app)
+		if err1 == nil && err2 == nil {
+			return u*100000 + 10000 + a
+		}
+	}
+	return -1
+}
@@ -0,0 +1,129 @@
+package capture
+
+import (
+	"testing"
+)
+
+func TestSSParser_ParseSockets(t *testing.T) {
+	input := `Netid State  Recv-Q Send-Q Local Address:Port  Peer Address:Port Process
+tcp   ESTAB  0      0      10.0.2.16:41234     142.250.74.36:443  users:(("com.android.chrome",pid=4211,fd=88)) uid:10061 ino:91234 sk:1 <->
+	 cubic rtt:18.5/7.25 bytes_sent:1024 bytes_received:8192
+tcp   LISTEN 0      50     *:5555              *:*                users:(("adbd",pid=512,fd=9)) ino:1000 sk:2 <->
+tcp   ESTAB  0      0      127.0.0.1:5037      127.0.0.1:40000    ino:1001 sk:3 <->
+	 cubic rtt:0.1/0.05
+tcp   SYN-SENT 0    1      [::ffff:10.0.2.16]:41300 [::ffff:1.1.1.1]:853 uid:1051 ino:1002 sk:4 <->
+udp   UNCONN 0      0      0.0.0.0:5353        0.0.0.0:*          users:(("mdnsd",pid=777,fd=5)) uid:1020 ino:1003 sk:5 <->`
+
+	p := NewSSParser("dev1")
+	conns := p.ParseSockets(input)
+	if len(conns) != 3 {
+		t.Fatalf("expected 3 connections, got %d: %+v", len(conns), conns)
+	}
+
+	c := conns[0]
+	if c.Protocol != ProtoTCP || c.State != ConnEstablished || c.RemoteIP != "142.250.74.36" || c.RemotePort != 443 {
+		t.Errorf("conn[0] endpoints: %+v", c)
+	}
+	if c.Process != "com.android.chrome" || c.PID != 4211 || c.UID != 10061 {
+		t.Errorf("conn[0] owner: process=%q pid=%d uid=%d", c.Process, c.PID, c.UID)
+	}
+	if c.BytesSent != 1024 || c.BytesReceived != 8192 || c.RTTMs != 18.5 {
+		t.Errorf("conn[0] counters: %+v", c)
+	}
+	if c.ID != "dev1-conn-1" || c.Serial != "dev1" {
+		t.Errorf("conn[0] id/serial: %q %q", c.ID, c.Serial)
+	}
+
+	// Mapped addresses are unmapped; the info line of the skipped loopback
+	// socket must not land on it.
+	c = conns[1]
+	if c.LocalIP != "10.0.2.16" || c.RemoteIP != "1.1.1.1" || c.State != ConnSynSent || c.UID != 1051 {
+		t.Errorf("conn[1]: %+v", c)
+	}
+	if c.RTTMs != 0 || c.Process != "" {
+		t.Errorf("conn[1] picked up foreign data: %+v", c)
+	}
+
+	c = conns[2]
+	if c.Protocol != ProtoUDP || c.State != ConnClose || c.RemotePort != 0 || c.Process != "mdnsd" || c.PID != 777 {
+		t.Errorf("conn[2]: %+v", c)
+	}
+}
+
+func TestSSParser_ParseNetstat(t *testing.T) {
+	input := `Active Internet connections (servers and established)
+Proto Recv-Q Send-Q Local Address           Foreign Address         State       User       Inode      PID/Program Name
+tcp        0      0 0.0.0.0:5555            0.0.0.0:*               LISTEN      0          1000       512/adbd
+tcp        0      0 10.0.2.16:41234         142.250.74.36:443       ESTABLISHED u0_a61     91234      4211/com.android.chrome
+tcp6       0      0 ::ffff:10.0.2.16:41300  ::ffff:1.1.1.1:853      TIME_WAIT   0          0          -
+udp        0      0 0.0.0.0:5353            0.0.0.0:*                           1020       1003       777/mdnsd`
+
+	p := NewSSParser("dev1")
+	conns := p.ParseNetstat(input)
+	if len(conns) != 3 {
+		t.Fatalf("expected 3 connections, got %d: %+v", len(conns), conns)
+	}
+
+	c := conns[0]
+	if c.State != ConnEstablished || c.UID != 10061 || c.PID != 4211 || c.Process != "com.android.chrome" {
+		t.Errorf("conn[0]: %+v", c)
+	}
+
+	c = conns[1]
+	if c.Protocol != ProtoTCP || c.LocalIP != "10.0.2.16" || c.State != ConnTimeWait || c.PID != 0 || c.Process != "" {
+		t.Errorf("conn[1]: %+v", c)
+	}
+
+	c = conns[2]
+	if c.Protocol != ProtoUDP || c.State != ConnClose || c.UID != 1020 || c.Process != "mdnsd" {
+		t.Errorf("conn[2]: %+v", c)
+	}
+}
+
+func TestParseSSState(t *testing.T) {
+	tests := map[string]ConnState{
+		"ESTAB":       ConnEstablished,
+		"ESTABLISHED": ConnEstablished,
+		"SYN-SENT":    ConnSynSent,
+		"FIN-WAIT-1":  ConnFinWait1,
+		"FIN_WAIT2":   ConnFinWait2,
+		"TIME-WAIT":   ConnTimeWait,
+		"CLOSE-WAIT":  ConnCloseWait,
+		"UNCONN":      ConnClose,
+		"LISTEN":      ConnListen,
+		"BOGUS":       "UNKNOWN_BOGUS",
+	}
+	for in, want := range tests {
+		if got := parseSSState(in); got != want {
+			t.Errorf("parseSSState(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseAndroidUser(t *testing.T) {
+	tests := map[string]int{
+		"10061":   10061,
+		"u0_a61":  10061,
+		"u10_a5":  1010005,
+		"system":  1000,
+		"root":    0,
+		"unknown": -1,
+	}
+	for in, want := range tests {
+		if got := parseAndroidUser(in); got != want {
+			t.Errorf("parseAndroidUser(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for _, m := range []Mode{ModeAuto, ModeTcpdump, ModeProcNet, ModeSS} {
+		got, err := ParseMode(m.String())
+		if err != nil || got != m {
+			t.Errorf("ParseMode(%q) = %v, %v", m.String(), got, err)
+		}
+	}
+	if _, err := ParseMode("pcap"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
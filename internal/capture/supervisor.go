@@ -0,0 +1,119 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+const (
+	// restartBackoffMin is the delay before the first restart of a stream.
+	restartBackoffMin = 1 * time.Second
+	// restartBackoffMax caps the exponential restart delay.
+	restartBackoffMax = 30 * time.Second
+	// healthyRunTime is how long a stream must stay up for its failure
+	// counter and backoff to reset.
+	healthyRunTime = time.Minute
+	// maxConsecutiveFailures is how many quick stream failures in a row are
+	// tolerated before the engine falls back to /proc/net polling.
+	maxConsecutiveFailures = 5
+)
+
+// DegradedEvent reports that a capture stream ended unexpectedly and is being
+// restarted, or that the engine fell back to a weaker capture mode.
+type DegradedEvent struct {
+	Serial    string    `json:"serial"`
+	Mode      string    `json:"mode"`
+	Reason    string    `json:"reason"`
+	Restarts  int       `json:"restarts"`
+	RetryInMs int64     `json:"retry_in_ms,omitempty"`
+	Fallback  string    `json:"fallback,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Degraded returns the channel announcing stream restarts and fallbacks.
+func (e *Engine) Degraded() <-chan DegradedEvent {
+	return e.degradedCh
+}
+
+// superviseStream keeps run (the packet stream of mode, tcpdump, vpn or
+// emulator) going, restarting it with exponential backoff whenever it ends.
+// After maxConsecutiveFailures quick failures it gives up on the stream and
+// runs /proc/net polling instead.
+func (e *Engine) superviseStream(ctx context.Context, mode Mode, run func(context.Context) error) error {
+	backoff := restartBackoffMin
+	failures := 0
+
+	for {
+		started := time.Now()
+		err := run(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Without a server there is nothing to restart against; let the
+		// caller's resume logic take over once it is back.
+		if errors.Is(err, adb.ErrServerNotRunning) {
+			return err
+		}
+
+		if time.Since(started) >= healthyRunTime {
+			backoff = restartBackoffMin
+			failures = 0
+		}
+		failures++
+
+		reason := mode.String() + " stream ended"
+		if err != nil {
+			reason = err.Error()
+		}
+
+		if failures >= maxConsecutiveFailures {
+			e.log.Warn("packet stream keeps failing, falling back to /proc/net", "mode", mode, "failures", failures, "error", err)
+			e.recordRestart(ModeProcNet, reason)
+			e.degraded(DegradedEvent{
+				Mode:     mode.String(),
+				Reason:   reason,
+				Fallback: ModeProcNet.String(),
+			})
+			return e.runProcNet(ctx)
+		}
+
+		e.log.Warn("packet stream ended, restarting", "mode", mode, "error", err, "retry_in", backoff)
+		e.recordRestart(mode, reason)
+		e.degraded(DegradedEvent{
+			Mode:      mode.String(),
+			Reason:    reason,
+			RetryInMs: backoff.Milliseconds(),
+		})
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, restartBackoffMax)
+	}
+}
+
+// recordRestart bumps the restart counter and notes why.
+func (e *Engine) recordRestart(mode Mode, reason string) {
+	e.updateStats(func(s *CaptureStats) {
+		s.Mode = mode.String()
+		s.Restarts++
+		s.LastRestart = time.Now()
+		s.LastError = reason
+	})
+}
+
+// degraded fills in the common fields and publishes ev without blocking.
+func (e *Engine) degraded(ev DegradedEvent) {
+	ev.Serial = e.serial
+	ev.Restarts = e.Stats().Restarts
+	ev.Timestamp = time.Now()
+	select {
+	case e.degradedCh <- ev:
+	default:
+	}
+}
@@ -0,0 +1,72 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+func newTestEngine() *Engine {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewEngine(adb.NewClient("127.0.0.1:1"), log, "dev1", ModeTcpdump)
+}
+
+func TestSuperviseTcpdump_Restart(t *testing.T) {
+	e := newTestEngine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- e.superviseStream(ctx, ModeTcpdump, func(context.Context) error {
+			runs++
+			return fmt.Errorf("tcpdump failed: %w", &adb.ExitError{Command: "tcpdump", ExitCode: 1})
+		})
+	}()
+
+	select {
+	case ev := <-e.Degraded():
+		if ev.Serial != "dev1" || ev.Mode != "tcpdump" || ev.Restarts != 1 || ev.RetryInMs != restartBackoffMin.Milliseconds() {
+			t.Errorf("event: %+v", ev)
+		}
+		if ev.Fallback != "" {
+			t.Errorf("unexpected fallback on first failure: %q", ev.Fallback)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no degraded event")
+	}
+
+	st := e.Stats()
+	if st.Restarts != 1 || st.LastError == "" || st.LastRestart.IsZero() {
+		t.Errorf("stats: %+v", st)
+	}
+
+	// Cancelling during the backoff stops the supervisor.
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("supervisor returned %v", err)
+	}
+	if runs != 1 {
+		t.Errorf("runs: got %d, want 1", runs)
+	}
+}
+
+func TestSuperviseTcpdump_ServerGone(t *testing.T) {
+	e := newTestEngine()
+	err := e.superviseStream(context.Background(), ModeTcpdump, func(context.Context) error {
+		return fmt.Errorf("opening tcpdump stream: %w", adb.ErrServerNotRunning)
+	})
+	if !errors.Is(err, adb.ErrServerNotRunning) {
+		t.Errorf("got %v, want ErrServerNotRunning", err)
+	}
+	if e.Stats().Restarts != 0 {
+		t.Errorf("restarts: %d", e.Stats().Restarts)
+	}
+}
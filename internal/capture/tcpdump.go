@@ -2,8 +2,6 @@ package capture
 
 import (
 	"bufio"
-	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -18,20 +16,6 @@ import (
 // GET /api/users HTTP/1.1
 // Host: example.com
 
-var (
-	// Matches: HH:MM:SS.ffffff IP src.port > dst.port: proto info
-	rePacketLine = regexp.MustCompile(
-		`^(\d{2}:\d{2}:\d{2}\.\d+)\s+` + // timestamp
-			`(IP6?)\s+` + // IP version
-			`(\S+)\.(\d+)\s+>\s+` + // src.port
-			`(\S+)\.(\d+):\s+` + // dst.port:
-			`(.+)$`) // rest (protocol, flags, length)
-
-	reHTTPRequest  = regexp.MustCompile(`^(GET|POST|PUT|DELETE|PATCH|HEAD|OPTIONS|CONNECT)\s+(\S+)\s+HTTP/`)
-	reHTTPResponse = regexp.MustCompile(`^HTTP/[\d.]+\s+(\d{3})`)
-	reHTTPHost     = regexp.MustCompile(`(?i)^Host:\s*(\S+)`)
-)
-
 // TcpdumpParser parses tcpdump text output into NetworkPacket structs.
 type TcpdumpParser struct {
 	serial string
@@ -51,17 +35,48 @@ func (p *TcpdumpParser) ParseLine(line string) *NetworkPacket {
 		return nil
 	}
 
-	m := rePacketLine.FindStringSubmatch(line)
-	if m == nil {
+	// Header lines are tokenized by hand rather than with a regexp: this is
+	// the hottest path in tcpdump mode and most lines are rejected on the
+	// first field.
+	tsField, rest := nextField(line)
+	if !isClockTime(tsField) {
+		return nil
+	}
+	ipVer, rest := nextField(rest)
+	if ipVer != "IP" && ipVer != "IP6" {
+		return nil
+	}
+	src, rest := nextField(rest)
+	srcIP, srcPortStr, ok := splitHostPort(src)
+	if !ok {
+		return nil
+	}
+	arrow, rest := nextField(rest)
+	if arrow != ">" {
 		return nil
 	}
+	dst, rest := nextField(rest)
+	if !strings.HasSuffix(dst, ":") {
+		return nil
+	}
+	dstIP, dstPortStr, ok := splitHostPort(dst[:len(dst)-1])
+	if !ok {
+		return nil
+	}
+	rest = trimLeftSpace(rest)
+	if rest == "" {
+		return nil
+	}
+
+	if ipVer == "IP6" {
+		// tcpdump compresses IPv6 already, but mapped IPv4 must match the
+		// plain IPv4 reported by the socket-table modes.
+		srcIP, dstIP = NormalizeIP(srcIP), NormalizeIP(dstIP)
+	}
 
-	ts := p.parseTimestamp(m[1])
-	srcIP := m[3]
-	srcPort := p.parsePort(m[4])
-	dstIP := m[5]
-	dstPort := p.parsePort(m[6])
-	rest := m[7]
+	ts := parseClockTime(tsField)
+	srcPort := p.parsePort(srcPortStr)
+	dstPort := p.parsePort(dstPortStr)
 
 	proto := p.parseProtocol(rest)
 	length := p.parseLength(rest)
@@ -69,7 +84,7 @@ func (p *TcpdumpParser) ParseLine(line string) *NetworkPacket {
 
 	p.nextID++
 	pkt := &NetworkPacket{
-		ID:        fmt.Sprintf("%s-%d", p.serial, p.nextID),
+		ID:        p.serial + "-" + strconv.FormatUint(p.nextID, 10),
 		Serial:    p.serial,
 		Timestamp: ts,
 		SrcIP:     srcIP,
@@ -92,21 +107,23 @@ func (p *TcpdumpParser) EnrichWithHTTP(pkt *NetworkPacket, line string) {
 		return
 	}
 	line = strings.TrimSpace(line)
+	setProtocolHint(pkt, detectH2Text(line))
 
-	if m := reHTTPRequest.FindStringSubmatch(line); m != nil {
-		pkt.HTTPMethod = m[1]
-		pkt.HTTPPath = m[2]
+	if method, path, ok := parseHTTPRequestLine(line); ok {
+		pkt.HTTPMethod = method
+		pkt.HTTPPath = path
 		return
 	}
 
-	if m := reHTTPResponse.FindStringSubmatch(line); m != nil {
-		status, _ := strconv.Atoi(m[1])
+	if status, ok := parseHTTPStatusLine(line); ok {
 		pkt.HTTPStatus = status
 		return
 	}
 
-	if m := reHTTPHost.FindStringSubmatch(line); m != nil {
-		pkt.HTTPHost = m[1]
+	if len(line) > 5 && strings.EqualFold(line[:5], "host:") {
+		if host, _ := nextField(line[5:]); host != "" {
+			pkt.HTTPHost = host
+		}
 		return
 	}
 }
@@ -151,18 +168,28 @@ func (p *TcpdumpParser) ParseStream(scanner *bufio.Scanner, out chan<- NetworkPa
 	}
 }
 
-func (p *TcpdumpParser) parseTimestamp(s string) time.Time {
+// parseClockTime converts tcpdump's HH:MM:SS.frac clock time (already
+// validated by isClockTime) to a time today.
+func parseClockTime(s string) time.Time {
 	now := time.Now()
-	t, err := time.Parse("15:04:05.000000", s)
-	if err != nil {
-		// Try shorter format.
-		t, err = time.Parse("15:04:05.000", s)
-		if err != nil {
-			return now
+	hour := int(s[0]-'0')*10 + int(s[1]-'0')
+	min := int(s[3]-'0')*10 + int(s[4]-'0')
+	sec := int(s[6]-'0')*10 + int(s[7]-'0')
+	if hour > 23 || min > 59 || sec > 59 {
+		return now
+	}
+
+	// Scale the fraction to nanoseconds; digits beyond 9 are dropped.
+	nsec := 0
+	frac := s[9:]
+	for i := 0; i < 9; i++ {
+		nsec *= 10
+		if i < len(frac) {
+			nsec += int(frac[i] - '0')
 		}
 	}
 	return time.Date(now.Year(), now.Month(), now.Day(),
-		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), now.Location())
+		hour, min, sec, nsec, now.Location())
 }
 
 func (p *TcpdumpParser) parsePort(s string) uint16 {
@@ -171,11 +198,10 @@ func (p *TcpdumpParser) parsePort(s string) uint16 {
 }
 
 func (p *TcpdumpParser) parseProtocol(rest string) Protocol {
-	lower := strings.ToLower(rest)
-	if strings.Contains(lower, "udp") {
+	if containsFold(rest, "udp") {
 		return ProtoUDP
 	}
-	if strings.Contains(lower, "icmp") {
+	if containsFold(rest, "icmp") {
 		return ProtoICMP
 	}
 	return ProtoTCP
@@ -212,3 +238,121 @@ func (p *TcpdumpParser) parseFlags(rest string) string {
 	}
 	return rest[idx+7 : idx+end]
 }
+
+// httpMethods are the request methods recognised in ASCII dumps.
+var httpMethods = map[string]bool{
+	"GET": true, "POST": true, "PUT": true, "DELETE": true, "PATCH": true,
+	"HEAD": true, "OPTIONS": true, "CONNECT": true,
+}
+
+// parseHTTPRequestLine matches "METHOD path HTTP/...".
+func parseHTTPRequestLine(line string) (method, path string, ok bool) {
+	method, rest := nextField(line)
+	if !httpMethods[method] || rest == "" {
+		return "", "", false
+	}
+	path, rest = nextField(rest)
+	if path == "" || rest == "" || !strings.HasPrefix(trimLeftSpace(rest), "HTTP/") {
+		return "", "", false
+	}
+	return method, path, true
+}
+
+// parseHTTPStatusLine matches "HTTP/x.y NNN..." and returns NNN.
+func parseHTTPStatusLine(line string) (int, bool) {
+	version, rest := nextField(line)
+	if len(version) <= len("HTTP/") || !strings.HasPrefix(version, "HTTP/") || rest == "" {
+		return 0, false
+	}
+	for i := len("HTTP/"); i < len(version); i++ {
+		if c := version[i]; c != '.' && !isDigit(c) {
+			return 0, false
+		}
+	}
+	rest = trimLeftSpace(rest)
+	if len(rest) < 3 || !isDigit(rest[0]) || !isDigit(rest[1]) || !isDigit(rest[2]) {
+		return 0, false
+	}
+	return int(rest[0]-'0')*100 + int(rest[1]-'0')*10 + int(rest[2]-'0'), true
+}
+
+// isClockTime reports whether s has the form HH:MM:SS.f+ (digits only).
+func isClockTime(s string) bool {
+	if len(s) < 10 || s[2] != ':' || s[5] != ':' || s[8] != '.' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if i == 2 || i == 5 || i == 8 {
+			continue
+		}
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitHostPort splits tcpdump's "host.port" at the last dot. The port must
+// be all digits and the host non-empty.
+func splitHostPort(s string) (host, port string, ok bool) {
+	i := strings.LastIndexByte(s, '.')
+	if i <= 0 || i == len(s)-1 {
+		return "", "", false
+	}
+	for j := i + 1; j < len(s); j++ {
+		if !isDigit(s[j]) {
+			return "", "", false
+		}
+	}
+	return s[:i], s[i+1:], true
+}
+
+// nextField returns the first whitespace-delimited field of s and whatever
+// follows it (including the separating whitespace).
+func nextField(s string) (field, rest string) {
+	s = trimLeftSpace(s)
+	for i := 0; i < len(s); i++ {
+		if isSpace(s[i]) {
+			return s[:i], s[i:]
+		}
+	}
+	return s, ""
+}
+
+func trimLeftSpace(s string) string {
+	for len(s) > 0 && isSpace(s[0]) {
+		s = s[1:]
+	}
+	return s
+}
+
+// isSpace matches the ASCII whitespace tcpdump emits (regexp \s).
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// containsFold reports whether s contains substr, ignoring ASCII case.
+// substr must be lower case.
+func containsFold(s, substr string) bool {
+	n := len(substr)
+	for i := 0; i+n <= len(s); i++ {
+		j := 0
+		for ; j < n; j++ {
+			c := s[i+j]
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			if c != substr[j] {
+				break
+			}
+		}
+		if j == n {
+			return true
+		}
+	}
+	return false
+}
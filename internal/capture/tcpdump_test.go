@@ -1,6 +1,8 @@
 package capture
 
 import (
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -156,3 +158,80 @@ func TestTcpdumpParser_IDIncrement(t *testing.T) {
 		t.Error("packets should have different IDs")
 	}
 }
+
+// reLegacyPacketLine is the regexp ParseLine used before it was replaced by a
+// tokenizer; the corpus test checks both accept exactly the same lines.
+var reLegacyPacketLine = regexp.MustCompile(
+	`^(\d{2}:\d{2}:\d{2}\.\d+)\s+(IP6?)\s+(\S+)\.(\d+)\s+>\s+(\S+)\.(\d+):\s+(.+)$`)
+
+func TestTcpdumpParser_ParseLineMatchesRegexp(t *testing.T) {
+	lines := strings.Split(loadCorpus(t, "tcpdump.txt"), "\n")
+	lines = append(lines,
+		"12:34:56.789 IP 10.0.0.1.abc > 1.2.3.4.80: tcp 1",
+		"12:34:56.789 IP 10.0.0.1.1 > 1.2.3.4.80 tcp 1",
+		"12:34:56.789 IP 10.0.0.1.1 > 1.2.3.4.80:",
+		"12:34:56.789 IPX 10.0.0.1.1 > 1.2.3.4.80: tcp 1",
+		"1:34:56.789 IP 10.0.0.1.1 > 1.2.3.4.80: tcp 1",
+		"12:34:56 IP 10.0.0.1.1 > 1.2.3.4.80: tcp 1",
+		"12:34:56.789\tIP  10.0.0.1.1  >\t1.2.3.4.80:   UDP, length 7",
+		"12:34:56.789 IP 10.0.0.1.1 >> 1.2.3.4.80: tcp 1",
+		"12:34:56.789 IP .1 > 1.2.3.4.80: tcp 1",
+	)
+
+	p := NewTcpdumpParser("dev1")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		m := reLegacyPacketLine.FindStringSubmatch(line)
+		pkt := p.ParseLine(line)
+		if (m == nil) != (pkt == nil) {
+			t.Errorf("%q: regexp match=%v, ParseLine=%v", line, m != nil, pkt != nil)
+			continue
+		}
+		if m == nil {
+			continue
+		}
+		if pkt.SrcIP != m[3] || pkt.SrcPort != p.parsePort(m[4]) ||
+			pkt.DstIP != m[5] || pkt.DstPort != p.parsePort(m[6]) ||
+			pkt.Protocol != p.parseProtocol(m[7]) || pkt.Length != p.parseLength(m[7]) ||
+			pkt.Flags != p.parseFlags(m[7]) {
+			t.Errorf("%q: got %+v", line, pkt)
+		}
+	}
+}
+
+func TestParseClockTime(t *testing.T) {
+	for _, s := range []string{"12:34:56.789012", "12:34:56.789"} {
+		ts := parseClockTime(s)
+		if ts.Hour() != 12 || ts.Minute() != 34 || ts.Second() != 56 {
+			t.Errorf("parseClockTime(%q) = %v", s, ts)
+		}
+		if ms := ts.Nanosecond() / 1e6; ms != 789 {
+			t.Errorf("parseClockTime(%q): got %dms, want 789", s, ms)
+		}
+	}
+}
+
+func TestTcpdumpParser_EnrichWithHTTP_NonMatching(t *testing.T) {
+	p := NewTcpdumpParser("dev1")
+	for _, line := range []string{
+		"FETCH /x HTTP/1.1",
+		"GET /x SPDY/3",
+		"GET /x",
+		"HTTP/1.1 OK",
+		"HTTP/x 200 OK",
+		"Host:",
+		"E....@.@.......  GET /api HTTP/1.1",
+	} {
+		pkt := &NetworkPacket{}
+		p.EnrichWithHTTP(pkt, line)
+		if pkt.HTTPMethod != "" || pkt.HTTPStatus != 0 || pkt.HTTPHost != "" {
+			t.Errorf("%q: unexpected enrichment %+v", line, pkt)
+		}
+	}
+
+	pkt := &NetworkPacket{}
+	p.EnrichWithHTTP(pkt, "host:\tapi.example.com:8080 extra")
+	if pkt.HTTPHost != "api.example.com:8080" {
+		t.Errorf("case-insensitive Host: got %q", pkt.HTTPHost)
+	}
+}
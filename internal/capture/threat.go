@@ -0,0 +1,14 @@
+package capture
+
+// ThreatMatcher flags traffic to addresses and hostnames listed in
+// threat-intelligence feeds. MatchThreat returns a description of the
+// entry that matched ip or host.
+type ThreatMatcher interface {
+	MatchThreat(ip, host string) (string, bool)
+}
+
+// SetThreatMatcher makes the engine mark matching packets and connections
+// as malicious, adding a ThreatEnricher. Call before Run.
+func (e *Engine) SetThreatMatcher(m ThreatMatcher) {
+	e.AddEnricher(ThreatEnricher(m))
+}
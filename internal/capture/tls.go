@@ -0,0 +1,277 @@
+package capture
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"net/netip"
+	"time"
+)
+
+// The server's first flight of a TLS handshake is sent in the clear: the
+// ServerHello names the negotiated version and cipher suite and, up to TLS
+// 1.2, the Certificate message carries the server's chain. TLS 1.3 encrypts
+// the certificate, so only the version and cipher are known for it. The
+// observer reassembles the start of each server stream from the raw
+// packets of the vpn and emulator modes.
+
+const (
+	// tlsMaxFlight bounds the bytes buffered per server stream; a leaf
+	// certificate comes first in its chain, well within it.
+	tlsMaxFlight = 32 << 10
+	// tlsPendingTTL is how long a partial server flight waits for the
+	// rest.
+	tlsPendingTTL = 10 * time.Second
+	// tlsMaxPending bounds the handshakes tracked at once.
+	tlsMaxPending = 1024
+
+	tlsRecordHandshake   = 0x16
+	tlsHandshakeClient   = 1
+	tlsHandshakeServer   = 2
+	tlsHandshakeCert     = 11
+	tlsHandshakeDone     = 14
+	tlsExtSupportedVers  = 43
+	tlsRecordHeaderBytes = 5
+)
+
+// TLSCertificate is the leaf certificate a server presented.
+type TLSCertificate struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	DNSNames  []string  `json:"dns_names,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+// TLSSession is a TLS handshake observed on the wire.
+type TLSSession struct {
+	Serial     string    `json:"serial"`
+	Timestamp  time.Time `json:"timestamp"`
+	ClientIP   string    `json:"client_ip"`
+	ClientPort uint16    `json:"client_port"`
+	ServerIP   string    `json:"server_ip"`
+	ServerPort uint16    `json:"server_port"`
+	// SNI is the server name the client asked for.
+	SNI string `json:"sni,omitempty"`
+	// Version and Cipher are the negotiated protocol version, e.g.
+	// "TLS 1.3", and cipher suite.
+	Version string `json:"version"`
+	Cipher  string `json:"cipher"`
+	// Deprecated is set for versions below TLS 1.2.
+	Deprecated bool `json:"deprecated,omitempty"`
+	// Certificate is the leaf certificate, sent in the clear up to TLS
+	// 1.2 only.
+	Certificate *TLSCertificate `json:"certificate,omitempty"`
+}
+
+// tlsFlow is the server stream of one handshake being reassembled.
+type tlsFlow struct {
+	first time.Time
+	next  uint32
+	buf   []byte
+}
+
+// tlsObserver turns the TCP segments of TLS handshakes into TLSSessions.
+type tlsObserver struct {
+	serial string
+	// sni holds the server names of ClientHellos, by client and server.
+	sni     map[[2]netip.AddrPort]string
+	pending map[[2]netip.AddrPort]*tlsFlow
+}
+
+func newTLSObserver(serial string) *tlsObserver {
+	return &tlsObserver{
+		serial:  serial,
+		sni:     make(map[[2]netip.AddrPort]string),
+		pending: make(map[[2]netip.AddrPort]*tlsFlow),
+	}
+}
+
+// decode feeds the TCP segment in an IP packet to the observer. It returns
+// a session once a server flight reveals the negotiated parameters.
+func (o *tlsObserver) decode(b []byte, ts time.Time) *TLSSession {
+	srcIP, dstIP, proto, l4, ok := decodeIP(b)
+	if !ok || proto != 6 || len(l4) < 20 {
+		return nil
+	}
+	off := int(l4[12]>>4) * 4
+	if off < 20 || off > len(l4) {
+		return nil
+	}
+	src := netip.AddrPortFrom(srcIP, binary.BigEndian.Uint16(l4[0:2]))
+	dst := netip.AddrPortFrom(dstIP, binary.BigEndian.Uint16(l4[2:4]))
+	return o.segment(src, dst, binary.BigEndian.Uint32(l4[4:8]), l4[off:], ts)
+}
+
+func (o *tlsObserver) segment(src, dst netip.AddrPort, seq uint32, payload []byte, ts time.Time) *TLSSession {
+	if len(payload) == 0 {
+		return nil
+	}
+	key := [2]netip.AddrPort{dst, src} // client, server
+	f := o.pending[key]
+	if f == nil {
+		if len(payload) <= tlsRecordHeaderBytes || payload[0] != tlsRecordHandshake || payload[1] != 3 {
+			return nil
+		}
+		switch payload[tlsRecordHeaderBytes] {
+		case tlsHandshakeClient:
+			o.expire(ts)
+			if sni, _ := clientHelloSNI(payload[tlsRecordHeaderBytes:]); sni != "" && len(o.sni) < tlsMaxPending {
+				o.sni[[2]netip.AddrPort{src, dst}] = sni
+			}
+			return nil
+		case tlsHandshakeServer:
+			o.expire(ts)
+			if len(o.pending) >= tlsMaxPending {
+				return nil
+			}
+			f = &tlsFlow{first: ts, next: seq}
+			o.pending[key] = f
+		default:
+			return nil
+		}
+	}
+	if seq != f.next {
+		return nil // retransmission or out of order; the flight is lost
+	}
+	f.buf = append(f.buf, payload[:min(len(payload), tlsMaxFlight-len(f.buf))]...)
+	f.next += uint32(len(payload))
+
+	s, done := parseServerFlight(f.buf)
+	if !done && len(f.buf) < tlsMaxFlight {
+		return nil
+	}
+	delete(o.pending, key)
+	sni := o.sni[key]
+	delete(o.sni, key)
+	if s == nil {
+		return nil
+	}
+	s.Serial, s.Timestamp, s.SNI = o.serial, ts, sni
+	s.ClientIP, s.ClientPort = key[0].Addr().String(), key[0].Port()
+	s.ServerIP, s.ServerPort = key[1].Addr().String(), key[1].Port()
+	return s
+}
+
+// expire forgets handshakes older than tlsPendingTTL.
+func (o *tlsObserver) expire(now time.Time) {
+	for k, f := range o.pending {
+		if now.Sub(f.first) > tlsPendingTTL {
+			delete(o.pending, k)
+			delete(o.sni, k)
+		}
+	}
+	if len(o.sni) >= tlsMaxPending {
+		clear(o.sni)
+	}
+}
+
+// parseServerFlight reads the ServerHello and, before TLS 1.3, the leaf
+// certificate from the start of a server stream. done is false while more
+// of the flight is needed; s is nil when no ServerHello could be read.
+func parseServerFlight(b []byte) (s *TLSSession, done bool) {
+	// Join the handshake records; the first other record (a
+	// ChangeCipherSpec or encrypted data) ends the clear part.
+	var hs []byte
+	complete := false
+	for len(b) >= tlsRecordHeaderBytes {
+		n := int(binary.BigEndian.Uint16(b[3:5]))
+		if b[0] != tlsRecordHandshake {
+			complete = true
+			break
+		}
+		if len(b) < tlsRecordHeaderBytes+n {
+			hs = append(hs, b[tlsRecordHeaderBytes:]...)
+			break
+		}
+		hs = append(hs, b[tlsRecordHeaderBytes:tlsRecordHeaderBytes+n]...)
+		b = b[tlsRecordHeaderBytes+n:]
+	}
+
+	for len(hs) >= 4 {
+		typ := hs[0]
+		n := int(hs[1])<<16 | int(hs[2])<<8 | int(hs[3])
+		if len(hs) < 4+n {
+			break
+		}
+		msg := hs[4 : 4+n]
+		hs = hs[4+n:]
+		switch typ {
+		case tlsHandshakeServer:
+			if s = parseServerHello(msg); s == nil {
+				return nil, true
+			}
+			if s.Version == tls.VersionName(tls.VersionTLS13) {
+				return s, true
+			}
+		case tlsHandshakeCert:
+			if s != nil {
+				s.Certificate = parseLeafCertificate(msg)
+			}
+			return s, true
+		case tlsHandshakeDone:
+			return s, true
+		}
+	}
+	return s, complete
+}
+
+// parseServerHello reads the version and cipher suite of a ServerHello
+// body.
+func parseServerHello(b []byte) *TLSSession {
+	if len(b) < 2+32+1 {
+		return nil
+	}
+	version := binary.BigEndian.Uint16(b[0:2])
+	b = b[2+32:]
+	b, ok := skipTLSVector(b, 1) // session ID
+	if !ok || len(b) < 3 {
+		return nil
+	}
+	cipher := binary.BigEndian.Uint16(b[0:2])
+	b = b[3:] // cipher suite, compression method
+
+	// supported_versions carries the real version from TLS 1.3 on.
+	if len(b) >= 2 {
+		exts := b[2:min(len(b), 2+int(binary.BigEndian.Uint16(b[0:2])))]
+		for len(exts) >= 4 {
+			typ := binary.BigEndian.Uint16(exts[0:2])
+			n := int(binary.BigEndian.Uint16(exts[2:4]))
+			if len(exts) < 4+n {
+				break
+			}
+			if typ == tlsExtSupportedVers && n == 2 {
+				version = binary.BigEndian.Uint16(exts[4:6])
+			}
+			exts = exts[4+n:]
+		}
+	}
+	return &TLSSession{
+		Version:    tls.VersionName(version),
+		Cipher:     tls.CipherSuiteName(cipher),
+		Deprecated: version < tls.VersionTLS12,
+	}
+}
+
+// parseLeafCertificate reads the first certificate of a Certificate
+// message body.
+func parseLeafCertificate(b []byte) *TLSCertificate {
+	if len(b) < 6 {
+		return nil
+	}
+	n := int(b[3])<<16 | int(b[4])<<8 | int(b[5])
+	if len(b) < 6+n {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(b[6 : 6+n])
+	if err != nil {
+		return nil
+	}
+	return &TLSCertificate{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		DNSNames:  cert.DNSNames,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+}
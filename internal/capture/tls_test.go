@@ -0,0 +1,129 @@
+package capture
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// tlsRecord wraps handshake messages in one handshake record.
+func tlsRecord(msgs ...[]byte) []byte {
+	var body []byte
+	for _, m := range msgs {
+		body = append(body, m...)
+	}
+	rec := []byte{tlsRecordHandshake, 3, 3}
+	rec = binary.BigEndian.AppendUint16(rec, uint16(len(body)))
+	return append(rec, body...)
+}
+
+func handshakeMsg(typ byte, body []byte) []byte {
+	return append([]byte{typ, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+func serverHello(version, cipher uint16, tls13 bool) []byte {
+	body := []byte{3, 3}
+	body = append(body, make([]byte, 32)...)
+	body = append(body, 0) // session ID
+	body = binary.BigEndian.AppendUint16(body, cipher)
+	body = append(body, 0)
+	var ext []byte
+	if tls13 {
+		ext = append(ext, 0, tlsExtSupportedVers, 0, 2)
+		ext = binary.BigEndian.AppendUint16(ext, version)
+	}
+	body = binary.BigEndian.AppendUint16(body, uint16(len(ext)))
+	body = append(body, ext...)
+	if !tls13 {
+		binary.BigEndian.PutUint16(body[0:2], version)
+	}
+	return handshakeMsg(tlsHandshakeServer, body)
+}
+
+func certificateMsg(t *testing.T, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "api.example.com"},
+		DNSNames:     []string{"api.example.com"},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := append([]byte{byte(len(der) >> 16), byte(len(der) >> 8), byte(len(der))}, der...)
+	entry = append(entry, 0, 0) // no extensions
+	list := append([]byte{byte(len(entry) >> 16), byte(len(entry) >> 8), byte(len(entry))}, entry...)
+	return handshakeMsg(tlsHandshakeCert, list)
+}
+
+func tcpSeq(pkt []byte, seq uint32) []byte {
+	binary.BigEndian.PutUint32(pkt[24:], seq)
+	return pkt
+}
+
+func TestTLSObserver_TLS12(t *testing.T) {
+	o := newTLSObserver("dev1")
+	ts := time.Unix(1700000000, 0)
+	client, server := [4]byte{10, 0, 0, 2}, [4]byte{93, 184, 216, 34}
+	notAfter := ts.Add(10 * 24 * time.Hour).Truncate(time.Second)
+
+	hello := tlsRecord(buildClientHello("api.example.com", 0))
+	if s := o.decode(ipv4TCP(client, server, 40000, 443, 0x18, hello), ts); s != nil {
+		t.Fatalf("session from a ClientHello: %+v", s)
+	}
+
+	flight := tlsRecord(
+		serverHello(tls.VersionTLS11, tls.TLS_RSA_WITH_AES_128_CBC_SHA, false),
+		certificateMsg(t, notAfter),
+		handshakeMsg(tlsHandshakeDone, nil),
+	)
+	cut := len(flight) / 2
+	if s := o.decode(tcpSeq(ipv4TCP(server, client, 443, 40000, 0x10, flight[:cut]), 1000), ts); s != nil {
+		t.Fatalf("session from half a flight: %+v", s)
+	}
+	// A retransmission of the first segment is ignored.
+	if s := o.decode(tcpSeq(ipv4TCP(server, client, 443, 40000, 0x10, flight[:cut]), 1000), ts); s != nil {
+		t.Fatalf("session from a retransmission: %+v", s)
+	}
+	s := o.decode(tcpSeq(ipv4TCP(server, client, 443, 40000, 0x18, flight[cut:]), 1000+uint32(cut)), ts)
+	if s == nil {
+		t.Fatal("no session")
+	}
+	if s.Version != "TLS 1.1" || !s.Deprecated || s.Cipher != "TLS_RSA_WITH_AES_128_CBC_SHA" || s.SNI != "api.example.com" {
+		t.Errorf("session = %+v", s)
+	}
+	if s.ServerIP != "93.184.216.34" || s.ClientPort != 40000 || s.Serial != "dev1" {
+		t.Errorf("endpoints = %+v", s)
+	}
+	if s.Certificate == nil || s.Certificate.Subject != "CN=api.example.com" || !s.Certificate.NotAfter.Equal(notAfter) {
+		t.Errorf("certificate = %+v", s.Certificate)
+	}
+	if len(o.pending) != 0 || len(o.sni) != 0 {
+		t.Errorf("handshake state left behind: %d pending, %d names", len(o.pending), len(o.sni))
+	}
+}
+
+func TestTLSObserver_TLS13(t *testing.T) {
+	o := newTLSObserver("dev1")
+	client, server := [4]byte{10, 0, 0, 2}, [4]byte{93, 184, 216, 34}
+	flight := tlsRecord(serverHello(tls.VersionTLS13, tls.TLS_AES_128_GCM_SHA256, true))
+	flight = append(flight, 0x14, 3, 3, 0, 1, 1) // ChangeCipherSpec
+	s := o.decode(ipv4TCP(server, client, 443, 40001, 0x18, flight), time.Now())
+	if s == nil || s.Version != "TLS 1.3" || s.Deprecated || s.Cipher != "TLS_AES_128_GCM_SHA256" || s.Certificate != nil {
+		t.Errorf("session = %+v", s)
+	}
+}
@@ -1,6 +1,7 @@
 package capture
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -14,6 +15,19 @@ const (
 	ModeTcpdump
 	// ModeProcNet polls /proc/net/tcp for connection tracking (no root needed).
 	ModeProcNet
+	// ModeSS polls `ss -tunaepi` (or `netstat -tunaep`), which names the
+	// owning process of each socket and works where /proc/net is restricted.
+	ModeSS
+	// ModeVPN tunnels device traffic through the VpnService companion app
+	// over adb reverse: full packets without root. Never auto-selected.
+	ModeVPN
+	// ModeEmulator records an emulator's traffic on the host through its
+	// console: full packets without root.
+	ModeEmulator
+	// ModeIPTables logs new connections with iptables rules on a rooted
+	// device and reads them from the kernel log, with the sending UID and
+	// the firewall's verdict. Never auto-selected.
+	ModeIPTables
 )
 
 func (m Mode) String() string {
@@ -22,11 +36,42 @@ func (m Mode) String() string {
 		return "tcpdump"
 	case ModeProcNet:
 		return "procnet"
+	case ModeSS:
+		return "ss"
+	case ModeVPN:
+		return "vpn"
+	case ModeEmulator:
+		return "emulator"
+	case ModeIPTables:
+		return "iptables"
 	default:
 		return "auto"
 	}
 }
 
+// ParseMode parses a mode name as returned by Mode.String. The empty
+// string means ModeAuto.
+func ParseMode(s string) (Mode, error) {
+	switch s {
+	case "", "auto":
+		return ModeAuto, nil
+	case "tcpdump":
+		return ModeTcpdump, nil
+	case "procnet":
+		return ModeProcNet, nil
+	case "ss":
+		return ModeSS, nil
+	case "vpn":
+		return ModeVPN, nil
+	case "emulator":
+		return ModeEmulator, nil
+	case "iptables":
+		return ModeIPTables, nil
+	default:
+		return ModeAuto, fmt.Errorf("unknown capture mode %q", s)
+	}
+}
+
 // Protocol represents a network protocol.
 type Protocol string
 
@@ -34,6 +79,9 @@ const (
 	ProtoTCP  Protocol = "TCP"
 	ProtoUDP  Protocol = "UDP"
 	ProtoICMP Protocol = "ICMP"
+	// ProtoQUIC marks UDP packets of a QUIC flow whose server name was read
+	// from its Initial packets (tcpdump mode).
+	ProtoQUIC Protocol = "QUIC"
 )
 
 // ConnState represents a TCP connection state.
@@ -72,6 +120,34 @@ type NetworkPacket struct {
 	HTTPHost   string `json:"http_host,omitempty"`
 	HTTPStatus int    `json:"http_status,omitempty"`
 
+	// ProtocolHint is "h2" or "grpc" when the payload looks like
+	// cleartext HTTP/2 or gRPC; H2Frames lists the HTTP/2 frame types
+	// decoded from it (HEADERS, DATA, ...), when the payload was captured.
+	ProtocolHint string   `json:"protocol_hint,omitempty"`
+	H2Frames     []string `json:"h2_frames,omitempty"`
+
+	// UID owns the socket that sent the packet, and App is its package;
+	// iptables mode knows them for outgoing packets. Verdict is what the
+	// device's firewall did with the packet there: accept or drop.
+	UID     int    `json:"uid,omitempty"`
+	App     string `json:"app,omitempty"`
+	Verdict string `json:"verdict,omitempty"`
+
+	// Malicious is set when a threat feed lists an address or the host;
+	// Threat names the feed and entry.
+	Malicious bool   `json:"malicious,omitempty"`
+	Threat    string `json:"threat,omitempty"`
+
+	// Tags holds what enrichers added with Engine.AddEnricher found out,
+	// such as the owner of an address in an asset database.
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Source is the capture the packet came from: tcpdump, vpn or
+	// emulator for traffic on the wire, iptables for new connections the
+	// device's firewall logged, procnet or ss for packets made up from new
+	// sockets, logcat for URLs apps logged.
+	Source string `json:"source,omitempty"`
+
 	Raw string `json:"raw,omitempty"`
 }
 
@@ -90,6 +166,41 @@ type Connection struct {
 	LastSeen  time.Time `json:"last_seen"`
 	Hostname  string    `json:"hostname,omitempty"`
 	AppName   string    `json:"app_name,omitempty"`
+	// Traffic counters from `ss -ti`; zero when ss is unavailable or for
+	// UDP sockets.
+	BytesSent     uint64  `json:"bytes_sent,omitempty"`
+	BytesReceived uint64  `json:"bytes_received,omitempty"`
+	RTTMs         float64 `json:"rtt_ms,omitempty"`
+	// Owning process, known in ss mode only.
+	PID     int    `json:"pid,omitempty"`
+	Process string `json:"process,omitempty"`
+	// Malicious is set when a threat feed lists the remote address or
+	// hostname; Threat names the feed and entry.
+	Malicious bool   `json:"malicious,omitempty"`
+	Threat    string `json:"threat,omitempty"`
+	// ClosedAt is set once the connection has disappeared from the socket
+	// table; State is then the last state seen and DurationMs how long
+	// the connection was observed.
+	ClosedAt   *time.Time `json:"closed_at,omitempty"`
+	DurationMs float64    `json:"duration_ms,omitempty"`
+	// History lists the states the connection went through, oldest
+	// first; the store keeps the last MaxStateHistory.
+	History []StateChange `json:"history,omitempty"`
+	// Tags holds what enrichers added with Engine.AddEnricher found out.
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Source is the socket table the connection was read from: procnet
+	// or ss.
+	Source string `json:"source,omitempty"`
+}
+
+// MaxStateHistory bounds Connection.History.
+const MaxStateHistory = 16
+
+// StateChange is a state a connection was seen entering.
+type StateChange struct {
+	State ConnState `json:"state"`
+	At    time.Time `json:"at"`
 }
 
 // IsHTTPPort returns true if the port typically serves HTTP(S) traffic.
@@ -112,4 +223,25 @@ type CaptureStats struct {
 	StartedAt    time.Time `json:"started_at"`
 	LastActivity time.Time `json:"last_activity"`
 	Errors       int64     `json:"errors"`
+	// Restarts counts unexpected stream terminations the supervisor
+	// recovered from (or fell back after).
+	Restarts     int       `json:"restarts"`
+	LastRestart  time.Time `json:"last_restart,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+	// TcpdumpPID is the device PID of the running tcpdump packet stream.
+	TcpdumpPID int `json:"tcpdump_pid,omitempty"`
+	// BufferSize and DropPolicy are the engine's BufferConfig; Drops
+	// counts what each output channel lost to the policy.
+	BufferSize int       `json:"buffer_size"`
+	DropPolicy string    `json:"drop_policy"`
+	Drops      DropStats `json:"drops"`
+
+	// Sampling is the packet sampling of the capture and what it kept
+	// and skipped.
+	Sampling SamplingStats `json:"sampling"`
+
+	// App is the package the capture is restricted to, and AppUID its
+	// UID once looked up; see Engine.SetApp.
+	App    string `json:"app,omitempty"`
+	AppUID int    `json:"app_uid,omitempty"`
 }
@@ -0,0 +1,344 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ModeVPN uses a companion app built on Android's VpnService. The engine
+// listens on a host port, maps the same port on the device to it with
+// `adb reverse`, and starts the companion with that port. The companion
+// routes all device traffic through its tun interface, forwards it, and
+// copies every packet over the tunnel as:
+//
+//	"ADBMVPN1"                       once, on connect
+//	uint32 length, int64 unix µs     big-endian, per packet
+//	length bytes of IPv4/IPv6 packet
+//
+// so packets arrive whole, payload included, without root.
+const (
+	// VPNPackage is the application id of the companion app.
+	VPNPackage = "io.github.imcanugur.adbmonitor.vpn"
+	// vpnActivity asks for VPN consent (first run only) and starts the
+	// service; the port is passed as the "port" int extra.
+	vpnActivity    = VPNPackage + "/.CaptureActivity"
+	vpnStartAction = VPNPackage + ".START"
+	// vpnRemoteAPK is where the companion APK is pushed before install.
+	vpnRemoteAPK = "/data/local/tmp/adb-monitor-vpn.apk"
+
+	vpnMagic       = "ADBMVPN1"
+	vpnFrameHeader = 12
+	// vpnMaxFrame bounds one packet; tun MTUs are far below it.
+	vpnMaxFrame = 1 << 16
+	// vpnConnectTimeout is how long the companion has to connect after
+	// being started, which includes the user accepting the VPN dialog.
+	vpnConnectTimeout = 2 * time.Minute
+	// vpnHTTPScan is how much of a TCP payload is searched for HTTP
+	// request or status lines and the Host header.
+	vpnHTTPScan = 1024
+)
+
+// ErrVPNCompanionMissing is returned by ModeVPN when the companion app is
+// not installed and no APK was given to install it from.
+var ErrVPNCompanionMissing = errors.New("vpn companion app not installed")
+
+// runVPN runs one session of the companion tunnel: it ends when the
+// companion disconnects, e.g. because the user revoked the VPN.
+func (e *Engine) runVPN(ctx context.Context) error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("listening for vpn companion: %w", err)
+	}
+	defer ln.Close()
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	forward := "tcp:" + strconv.Itoa(port)
+	if err := e.client.Reverse(ctx, e.serial, forward, forward); err != nil {
+		return fmt.Errorf("adb reverse %s: %w", forward, err)
+	}
+	// Cleanup must run after ctx is cancelled too.
+	cleanupCtx := context.WithoutCancel(ctx)
+	defer func() {
+		cctx, cancel := context.WithTimeout(cleanupCtx, 5*time.Second)
+		defer cancel()
+		e.client.Shell(cctx, e.serial, "am force-stop "+VPNPackage)
+		e.client.KillReverse(cctx, e.serial, forward)
+	}()
+
+	if err := e.installVPNCompanion(ctx); err != nil {
+		return err
+	}
+	out, err := e.client.Shell(ctx, e.serial,
+		fmt.Sprintf("am start -n %s -a %s --ei port %d", vpnActivity, vpnStartAction, port))
+	if err != nil {
+		return fmt.Errorf("starting vpn companion: %w", err)
+	}
+	if strings.Contains(out, "Error") {
+		return fmt.Errorf("starting vpn companion: %s", strings.TrimSpace(out))
+	}
+
+	ln.(*net.TCPListener).SetDeadline(time.Now().Add(vpnConnectTimeout))
+	conn, err := ln.Accept()
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("vpn companion did not connect: %w", err)
+	}
+	defer conn.Close()
+	stopConn := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stopConn()
+
+	e.log.Info("vpn companion connected", "port", port)
+	err = e.readVPN(countingReader{conn, e})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// installVPNCompanion installs the companion app from vpnAPK unless the
+// device already has it.
+func (e *Engine) installVPNCompanion(ctx context.Context) error {
+	out, err := e.client.Shell(ctx, e.serial, "pm path "+VPNPackage)
+	if err == nil && strings.HasPrefix(strings.TrimSpace(out), "package:") {
+		return nil
+	}
+	if e.vpnAPK == "" {
+		return fmt.Errorf("%w: install %s or pass its APK", ErrVPNCompanionMissing, VPNPackage)
+	}
+
+	f, err := os.Open(e.vpnAPK)
+	if err != nil {
+		return fmt.Errorf("opening vpn companion apk: %w", err)
+	}
+	defer f.Close()
+	if err := e.client.Push(ctx, e.serial, f, vpnRemoteAPK, 0o644); err != nil {
+		return fmt.Errorf("pushing vpn companion apk: %w", err)
+	}
+	out, err = e.client.Shell(ctx, e.serial, "pm install -r "+vpnRemoteAPK+"; rm -f "+vpnRemoteAPK)
+	if err != nil {
+		return fmt.Errorf("installing vpn companion: %w", err)
+	}
+	if !strings.Contains(out, "Success") {
+		return fmt.Errorf("installing vpn companion: %s", strings.TrimSpace(out))
+	}
+	e.log.Info("vpn companion installed", "apk", e.vpnAPK)
+	return nil
+}
+
+// readVPN decodes the companion's packet stream until it ends. Packets are
+// emitted like tcpdump's; DNS answers and QUIC server names are read from
+// them as the tcpdump-mode sniffers do.
+func (e *Engine) readVPN(r io.Reader) error {
+	br := bufio.NewReaderSize(r, 64<<10)
+	magic := make([]byte, len(vpnMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return fmt.Errorf("reading vpn handshake: %w", err)
+	}
+	if string(magic) != vpnMagic {
+		return fmt.Errorf("vpn companion: bad handshake %q", magic)
+	}
+
+	ip := e.newIPReader()
+	for {
+		frame, ts, err := readVPNFrame(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("vpn companion disconnected")
+			}
+			return fmt.Errorf("reading vpn stream: %w", err)
+		}
+		ip.handle(frame, ts)
+	}
+}
+
+// ipReader handles the whole IP packets of the modes that see them on the
+// host, vpn and emulator.
+type ipReader struct {
+	e       *Engine
+	decoder *vpnDecoder
+	dns     *DNSSniffer
+	quic    *QUICSniffer
+	tls     *tlsObserver
+}
+
+func (e *Engine) newIPReader() *ipReader {
+	return &ipReader{
+		e:       e,
+		decoder: newVPNDecoder(e.serial),
+		dns:     NewDNSSniffer(e.serial),
+		quic:    NewQUICSniffer(),
+		tls:     newTLSObserver(e.serial),
+	}
+}
+
+// handle emits the packet in frame, which it may keep references into.
+func (r *ipReader) handle(frame []byte, ts time.Time) {
+	e := r.e
+	pkt := r.decoder.decode(frame, ts)
+	if pkt == nil {
+		return
+	}
+
+	if pkt.Protocol == ProtoUDP && (pkt.SrcPort == 53 || pkt.DstPort == 53) {
+		if l := r.dns.decode(frame, ts); l != nil {
+			e.resolver.LearnDNS(l)
+			send(e, e.dnsCh, *l, outDNSLookups)
+		}
+	}
+	if pkt.Protocol == ProtoUDP && pkt.DstPort == 443 {
+		if h := r.quic.decode(frame, ts); h != nil {
+			e.quic.add(h)
+			e.resolver.LearnSNI(h.Server.Addr().String(), h.SNI)
+		}
+	}
+	if pkt.Protocol == ProtoTCP && pkt.Length > 0 {
+		if s := r.tls.decode(frame, ts); s != nil && (e.app == nil || e.app.ownsPacket(pkt)) {
+			e.resolver.LearnSNI(s.ServerIP, s.SNI)
+			select {
+			case e.tlsCh <- *s:
+			default:
+			}
+		}
+	}
+	e.emitPacket(pkt)
+}
+
+// readVPNFrame reads one framed packet. The frame is freshly allocated, as
+// the QUIC sniffer keeps references into it.
+func readVPNFrame(r io.Reader) ([]byte, time.Time, error) {
+	var hdr [vpnFrameHeader]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, time.Time{}, err
+	}
+	n := binary.BigEndian.Uint32(hdr[0:4])
+	if n == 0 || n > vpnMaxFrame {
+		return nil, time.Time{}, fmt.Errorf("bad frame length %d", n)
+	}
+	ts := time.UnixMicro(int64(binary.BigEndian.Uint64(hdr[4:12])))
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, time.Time{}, err
+	}
+	return frame, ts, nil
+}
+
+// vpnDecoder turns raw IP packets into NetworkPackets.
+type vpnDecoder struct {
+	serial string
+	nextID uint64
+	http   TcpdumpParser
+}
+
+func newVPNDecoder(serial string) *vpnDecoder {
+	return &vpnDecoder{serial: serial}
+}
+
+// decode parses an IPv4 or IPv6 packet carrying TCP, UDP or ICMP. Length is
+// the transport payload size, as tcpdump reports it. It returns nil for
+// anything else.
+func (d *vpnDecoder) decode(b []byte, ts time.Time) *NetworkPacket {
+	src, dst, proto, l4, ok := decodeIP(b)
+	if !ok {
+		return nil
+	}
+
+	pkt := &NetworkPacket{
+		Serial:    d.serial,
+		Timestamp: ts,
+		SrcIP:     src.String(),
+		DstIP:     dst.String(),
+	}
+	switch proto {
+	case 6:
+		if len(l4) < 20 {
+			return nil
+		}
+		off := int(l4[12]>>4) * 4
+		if off < 20 || off > len(l4) {
+			return nil
+		}
+		pkt.Protocol = ProtoTCP
+		pkt.SrcPort = binary.BigEndian.Uint16(l4[0:2])
+		pkt.DstPort = binary.BigEndian.Uint16(l4[2:4])
+		pkt.Flags = tcpFlags(l4[13])
+		payload := l4[off:]
+		pkt.Length = len(payload)
+		d.enrichHTTP(pkt, payload)
+		if hint, frames := DetectH2(payload); hint != "" {
+			pkt.ProtocolHint, pkt.H2Frames = hint, frames
+		}
+	case 17:
+		if len(l4) < 8 {
+			return nil
+		}
+		pkt.Protocol = ProtoUDP
+		pkt.SrcPort = binary.BigEndian.Uint16(l4[0:2])
+		pkt.DstPort = binary.BigEndian.Uint16(l4[2:4])
+		pkt.Length = len(l4) - 8
+	case 1, 58:
+		pkt.Protocol = ProtoICMP
+		pkt.Length = len(l4)
+	default:
+		return nil
+	}
+
+	d.nextID++
+	pkt.ID = d.serial + "-" + strconv.FormatUint(d.nextID, 10)
+	return pkt
+}
+
+// enrichHTTP fills the HTTP fields from the request or status line and
+// headers at the start of payload.
+func (d *vpnDecoder) enrichHTTP(pkt *NetworkPacket, payload []byte) {
+	if len(payload) < 16 || payload[0] < 'A' || payload[0] > 'Z' {
+		return // TLS records and continuation segments
+	}
+	head := payload[:min(len(payload), vpnHTTPScan)]
+	if i := bytes.Index(head, []byte("\r\n\r\n")); i >= 0 {
+		head = head[:i]
+	}
+	for i, line := range strings.Split(string(head), "\r\n") {
+		if i == 0 {
+			_, _, isReq := parseHTTPRequestLine(line)
+			_, isResp := parseHTTPStatusLine(line)
+			if !isReq && !isResp {
+				return
+			}
+		}
+		d.http.EnrichWithHTTP(pkt, line)
+	}
+}
+
+// tcpFlags renders TCP flags the way tcpdump does, e.g. "S", "S.", "P.".
+func tcpFlags(f byte) string {
+	var sb strings.Builder
+	for _, fl := range []struct {
+		bit  byte
+		name byte
+	}{{0x01, 'F'}, {0x02, 'S'}, {0x04, 'R'}, {0x08, 'P'}, {0x10, '.'}, {0x20, 'U'}, {0x40, 'E'}, {0x80, 'W'}} {
+		if f&fl.bit != 0 {
+			sb.WriteByte(fl.name)
+		}
+	}
+	if sb.Len() == 0 {
+		return "none"
+	}
+	return sb.String()
+}
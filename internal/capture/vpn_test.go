@@ -0,0 +1,116 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ipv4TCP wraps payload in IPv4 and TCP headers with the given flags.
+func ipv4TCP(src, dst [4]byte, sport, dport uint16, flags byte, payload []byte) []byte {
+	pkt := make([]byte, 40, 40+len(payload))
+	pkt[0] = 0x45
+	binary.BigEndian.PutUint16(pkt[2:], uint16(40+len(payload)))
+	pkt[8] = 64
+	pkt[9] = 6
+	copy(pkt[12:], src[:])
+	copy(pkt[16:], dst[:])
+	binary.BigEndian.PutUint16(pkt[20:], sport)
+	binary.BigEndian.PutUint16(pkt[22:], dport)
+	pkt[32] = 5 << 4
+	pkt[33] = flags
+	return append(pkt, payload...)
+}
+
+// vpnFrame frames pkt as the companion sends it.
+func vpnFrame(ts time.Time, pkt []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(pkt)))
+	b = binary.BigEndian.AppendUint64(b, uint64(ts.UnixMicro()))
+	return append(b, pkt...)
+}
+
+func TestVPNDecoder(t *testing.T) {
+	d := newVPNDecoder("dev1")
+	ts := time.UnixMicro(1700000000123456)
+	client, server := [4]byte{10, 0, 0, 2}, [4]byte{93, 184, 216, 34}
+
+	syn := d.decode(ipv4TCP(client, server, 40000, 80, 0x02, nil), ts)
+	if syn == nil || syn.Flags != "S" || syn.Length != 0 || syn.Protocol != ProtoTCP {
+		t.Fatalf("syn = %+v", syn)
+	}
+
+	req := "GET /index.html HTTP/1.1\r\nHost: example.com\r\nAccept: */*\r\n\r\n"
+	pkt := d.decode(ipv4TCP(client, server, 40000, 80, 0x18, []byte(req)), ts)
+	if pkt == nil {
+		t.Fatal("request not decoded")
+	}
+	if pkt.ID != "dev1-2" || pkt.SrcIP != "10.0.0.2" || pkt.DstIP != "93.184.216.34" ||
+		pkt.SrcPort != 40000 || pkt.DstPort != 80 || pkt.Flags != "P." || pkt.Length != len(req) ||
+		!pkt.Timestamp.Equal(ts) {
+		t.Errorf("request = %+v", pkt)
+	}
+	if pkt.HTTPMethod != "GET" || pkt.HTTPPath != "/index.html" || pkt.HTTPHost != "example.com" {
+		t.Errorf("http = %q %q %q", pkt.HTTPMethod, pkt.HTTPPath, pkt.HTTPHost)
+	}
+
+	resp := d.decode(ipv4TCP(server, client, 80, 40000, 0x18, []byte("HTTP/1.1 404 Not Found\r\n\r\n")), ts)
+	if resp == nil || resp.HTTPStatus != 404 {
+		t.Errorf("response = %+v", resp)
+	}
+
+	// IPv6 UDP behind a destination options header.
+	v6 := make([]byte, 40, 64)
+	v6[0] = 0x60
+	binary.BigEndian.PutUint16(v6[4:], 8+8+4)
+	v6[6] = 60
+	v6[23], v6[39] = 1, 2
+	v6 = append(v6, 17, 0, 0, 0, 0, 0, 0, 0)        // dest options, next UDP
+	v6 = append(v6, 0x13, 0x88, 0, 53, 0, 12, 0, 0) // 5000 -> 53
+	v6 = append(v6, "abcd"...)
+	udp := d.decode(v6, ts)
+	if udp == nil || udp.Protocol != ProtoUDP || udp.SrcIP != "::1" || udp.DstIP != "::2" ||
+		udp.SrcPort != 5000 || udp.DstPort != 53 || udp.Length != 4 {
+		t.Errorf("udp = %+v", udp)
+	}
+
+	if d.decode([]byte{0x45, 0, 0}, ts) != nil {
+		t.Error("truncated packet decoded")
+	}
+}
+
+func TestReadVPN(t *testing.T) {
+	e := newTestEngine()
+	ts := time.UnixMicro(1700000000000000)
+	client, resolver := [4]byte{10, 0, 0, 2}, [4]byte{8, 8, 8, 8}
+
+	var stream bytes.Buffer
+	stream.WriteString(vpnMagic)
+	stream.Write(vpnFrame(ts, ipv4UDP(client, resolver, 5353, 53, buildDNS(7, false))))
+	stream.Write(vpnFrame(ts.Add(time.Millisecond), ipv4UDP(resolver, client, 53, 5353, buildDNS(7, true))))
+
+	err := e.readVPN(&stream)
+	if err == nil || !strings.Contains(err.Error(), "disconnected") {
+		t.Errorf("err = %v, want disconnected", err)
+	}
+	if n := len(e.packetCh); n != 2 {
+		t.Errorf("packets = %d, want 2", n)
+	}
+	select {
+	case l := <-e.dnsCh:
+		if l.Query != "api.example.com" || l.LatencyMs != 1 {
+			t.Errorf("lookup = %+v", l)
+		}
+	default:
+		t.Error("no DNS lookup")
+	}
+
+	if err := e.readVPN(strings.NewReader("NOTMAGIC")); err == nil || !strings.Contains(err.Error(), "handshake") {
+		t.Errorf("bad handshake err = %v", err)
+	}
+	bad := vpnMagic + string(vpnFrame(ts, nil))
+	if err := e.readVPN(strings.NewReader(bad)); err == nil || !strings.Contains(err.Error(), "frame length") {
+		t.Errorf("empty frame err = %v", err)
+	}
+}
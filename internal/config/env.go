@@ -0,0 +1,105 @@
+// Package config loads server settings from command-line flags and
+// environment variables, so the binary can run unmodified in containers.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EnvPrefix is prepended to every flag-derived environment variable name.
+const EnvPrefix = "ADB_MONITOR_"
+
+// EnvName returns the environment variable bound to a flag:
+// "max-packets" becomes "ADB_MONITOR_MAX_PACKETS".
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ApplyEnv fills every flag in fs that was not set on the command line from
+// its environment variable (see EnvName). Explicit flags always win over the
+// environment. lookup is typically os.LookupEnv. It must be called after
+// fs.Parse.
+func ApplyEnv(fs *flag.FlagSet, lookup func(string) (string, bool)) error {
+	explicit := make(map[string]struct{})
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = struct{}{}
+	})
+
+	var errs []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := explicit[f.Name]; ok {
+			return
+		}
+		name := EnvName(f.Name)
+		val, ok := lookup(name)
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, val); err != nil {
+			errs = append(errs, fmt.Sprintf("%s=%q: %v", name, val, err))
+		}
+	})
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment configuration: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// EnvUsage returns a sorted "ENV_NAME  (flag -name)  usage" listing for fs,
+// suitable for appending to -help output.
+func EnvUsage(fs *flag.FlagSet) string {
+	var lines []string
+	fs.VisitAll(func(f *flag.Flag) {
+		lines = append(lines, fmt.Sprintf("  %-36s -%s: %s", EnvName(f.Name), f.Name, f.Usage))
+	})
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// USBInfo describes host USB visibility, which decides whether the local
+// ADB server can see physically attached devices.
+type USBInfo struct {
+	// Available is true when /dev/bus/usb exists and is readable.
+	Available bool
+	// Buses is the number of USB bus directories found.
+	Buses int
+	// Container is true when the process appears to run inside a container.
+	Container bool
+}
+
+// usbRoot is the Linux USB device tree; a variable for tests.
+var usbRoot = "/dev/bus/usb"
+
+// DetectUSB inspects /dev/bus/usb to report whether USB devices were passed
+// through to this process (e.g. `docker run --device /dev/bus/usb`).
+func DetectUSB() USBInfo {
+	info := USBInfo{Container: inContainer()}
+
+	entries, err := os.ReadDir(usbRoot)
+	if err != nil {
+		return info
+	}
+	info.Available = true
+	for _, e := range entries {
+		if e.IsDir() {
+			info.Buses++
+		}
+	}
+	return info
+}
+
+// inContainer uses the conventional marker files left by Docker and Podman.
+func inContainer() bool {
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(filepath.Clean(marker)); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"addr":        "ADB_MONITOR_ADDR",
+		"max-packets": "ADB_MONITOR_MAX_PACKETS",
+		"read-only":   "ADB_MONITOR_READ_ONLY",
+	}
+	for in, want := range tests {
+		if got := EnvName(in); got != want {
+			t.Errorf("EnvName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "")
+	maxPkts := fs.Int("max-packets", 50000, "")
+	readOnly := fs.Bool("read-only", false, "")
+	token := fs.String("auth-token", "", "")
+
+	if err := fs.Parse([]string{"-addr", ":9000"}); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"ADB_MONITOR_ADDR":        ":7000", // ignored: set on command line
+		"ADB_MONITOR_MAX_PACKETS": "1234",
+		"ADB_MONITOR_READ_ONLY":   "true",
+	}
+	lookup := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+
+	if err := ApplyEnv(fs, lookup); err != nil {
+		t.Fatal(err)
+	}
+	if *addr != ":9000" {
+		t.Errorf("addr: got %q, want flag value :9000", *addr)
+	}
+	if *maxPkts != 1234 {
+		t.Errorf("max-packets: got %d, want 1234", *maxPkts)
+	}
+	if !*readOnly {
+		t.Error("read-only: expected true from env")
+	}
+	if *token != "" {
+		t.Errorf("auth-token: got %q, want default", *token)
+	}
+}
+
+func TestApplyEnv_InvalidValue(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("max-packets", 50000, "")
+	fs.Parse(nil)
+
+	err := ApplyEnv(fs, func(k string) (string, bool) {
+		if k == "ADB_MONITOR_MAX_PACKETS" {
+			return "lots", true
+		}
+		return "", false
+	})
+	if err == nil {
+		t.Fatal("expected error for non-numeric value")
+	}
+}
+
+func TestDetectUSB(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "001"), 0755)
+	os.Mkdir(filepath.Join(dir, "002"), 0755)
+
+	old := usbRoot
+	usbRoot = dir
+	defer func() { usbRoot = old }()
+
+	info := DetectUSB()
+	if !info.Available || info.Buses != 2 {
+		t.Errorf("DetectUSB() = %+v, want 2 buses available", info)
+	}
+
+	usbRoot = filepath.Join(dir, "missing")
+	if DetectUSB().Available {
+		t.Error("expected unavailable for missing USB root")
+	}
+}
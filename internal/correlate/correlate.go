@@ -0,0 +1,366 @@
+// Package correlate links the records one request leaves behind — the URL
+// an HTTP client logged to logcat (or plaintext HTTP seen on the wire), the
+// DNS lookup of its host and the TCP connection to the answer — into a
+// Flow, by device, host and time window. Each Flow has an ID that traces
+// the request end to end.
+package correlate
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+const (
+	// DefaultWindow is how far apart in time records of one host may be
+	// and still belong to one flow.
+	DefaultWindow = 30 * time.Second
+	// DefaultMaxFlows is how many flows are kept; the oldest go first.
+	DefaultMaxFlows = 5000
+
+	// maxRecords bounds each record list of a flow, so a host polled all
+	// day does not grow one flow without bound.
+	maxRecords = 100
+)
+
+// URL is a request seen in logcat or in plaintext HTTP.
+type URL struct {
+	PacketID  string    `json:"packet_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Method    string    `json:"method,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	// Source is the logcat tag ("logcat:OkHttp") or "http".
+	Source string `json:"source"`
+}
+
+// Lookup is a DNS lookup of the flow's host.
+type Lookup struct {
+	LookupID  string    `json:"lookup_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Addresses []string  `json:"addresses,omitempty"`
+	RCode     string    `json:"rcode,omitempty"`
+}
+
+// Conn is a connection to one of the flow's addresses.
+type Conn struct {
+	ConnectionID string           `json:"connection_id"`
+	FirstSeen    time.Time        `json:"first_seen"`
+	RemoteIP     string           `json:"remote_ip"`
+	RemotePort   uint16           `json:"remote_port"`
+	Protocol     capture.Protocol `json:"protocol"`
+	AppName      string           `json:"app_name,omitempty"`
+}
+
+// Flow is one request (or burst of requests) to a host, end to end.
+type Flow struct {
+	ID     string `json:"id"`
+	Serial string `json:"serial"`
+	Host   string `json:"host"`
+	// Start and End span the records of the flow.
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	URLs        []URL     `json:"urls"`
+	Lookups     []Lookup  `json:"lookups"`
+	Connections []Conn    `json:"connections"`
+}
+
+// Complete reports whether the flow has a URL, a lookup and a connection.
+func (f *Flow) Complete() bool {
+	return len(f.URLs) > 0 && len(f.Lookups) > 0 && len(f.Connections) > 0
+}
+
+// Config configures a Correlator.
+type Config struct {
+	// Window is DefaultWindow if zero.
+	Window time.Duration
+	// MaxFlows is DefaultMaxFlows if zero.
+	MaxFlows int
+}
+
+// Query selects flows. Zero fields match everything.
+type Query struct {
+	Serial string
+	// Host matches the flow's host, case-insensitively.
+	Host     string
+	From, To time.Time
+	// Complete keeps only flows with a URL, a lookup and a connection.
+	Complete bool
+	// Limit caps the result, newest first.
+	Limit int
+}
+
+// Correlator builds flows from the records fed to it. It is safe for
+// concurrent use.
+type Correlator struct {
+	window   time.Duration
+	maxFlows int
+
+	mu     sync.Mutex
+	seq    uint64
+	flows  map[string]*Flow   // id -> flow
+	order  []string           // ids, oldest first
+	latest map[string]*Flow   // serial and host -> newest flow
+	addrs  map[string]addrUse // serial and IP -> host it was resolved for
+	record map[string]string  // record id -> flow id
+}
+
+// addrUse is the host an address was resolved for, and when.
+type addrUse struct {
+	host string
+	at   time.Time
+}
+
+// New returns an empty Correlator.
+func New(cfg Config) *Correlator {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	if cfg.MaxFlows <= 0 {
+		cfg.MaxFlows = DefaultMaxFlows
+	}
+	c := &Correlator{window: cfg.Window, maxFlows: cfg.MaxFlows}
+	c.resetLocked()
+	return c
+}
+
+func (c *Correlator) resetLocked() {
+	c.flows = make(map[string]*Flow)
+	c.order = nil
+	c.latest = make(map[string]*Flow)
+	c.addrs = make(map[string]addrUse)
+	c.record = make(map[string]string)
+}
+
+// AddPacket links a packet that names its host: a URL from logcat or a
+// plaintext HTTP request. Other packets are ignored.
+func (c *Correlator) AddPacket(p capture.NetworkPacket) {
+	host := normalizeHost(p.HTTPHost)
+	if host == "" || p.HTTPMethod == "" {
+		return
+	}
+	source := "http"
+	if strings.HasPrefix(p.Flags, "logcat:") {
+		source = p.Flags
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.record[p.ID]; ok {
+		return
+	}
+	f := c.flowLocked(p.Serial, host, p.Timestamp)
+	if len(f.URLs) < maxRecords {
+		f.URLs = append(f.URLs, URL{PacketID: p.ID, Timestamp: p.Timestamp, Method: p.HTTPMethod, Path: p.HTTPPath, Source: source})
+	}
+	c.record[p.ID] = f.ID
+	if p.DstIP != "" {
+		c.addrs[addrKey(p.Serial, capture.NormalizeIP(p.DstIP))] = addrUse{host: host, at: p.Timestamp}
+	}
+}
+
+// AddDNSLookup links a lookup to the flow of its query name and remembers
+// its answers, so connections to them join that flow.
+func (c *Correlator) AddDNSLookup(l capture.DNSLookup) {
+	host := normalizeHost(l.Query)
+	if host == "" {
+		return
+	}
+	addrs := l.Addresses()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.record[l.ID]; ok {
+		return
+	}
+	f := c.flowLocked(l.Serial, host, l.Timestamp)
+	if len(f.Lookups) < maxRecords {
+		f.Lookups = append(f.Lookups, Lookup{LookupID: l.ID, Timestamp: l.Timestamp, Addresses: addrs, RCode: l.RCode})
+	}
+	c.record[l.ID] = f.ID
+	for _, ip := range addrs {
+		c.addrs[addrKey(l.Serial, capture.NormalizeIP(ip))] = addrUse{host: host, at: l.Timestamp}
+	}
+	if len(c.addrs) > 4*c.maxFlows {
+		c.pruneAddrsLocked(l.Timestamp)
+	}
+}
+
+// pruneAddrsLocked forgets addresses resolved over a window before now.
+func (c *Correlator) pruneAddrsLocked(now time.Time) {
+	for k, use := range c.addrs {
+		if now.Sub(use.at) > c.window {
+			delete(c.addrs, k)
+		}
+	}
+}
+
+// AddConnection links a connection to the flow of its hostname, or of the
+// host its remote address was recently resolved for. Connections to
+// addresses of no known host are ignored.
+func (c *Correlator) AddConnection(conn capture.Connection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.record[conn.ID]; ok {
+		return
+	}
+	host := normalizeHost(conn.Hostname)
+	if use, ok := c.addrs[addrKey(conn.Serial, capture.NormalizeIP(conn.RemoteIP))]; ok && absDuration(conn.FirstSeen.Sub(use.at)) <= c.window {
+		// The name the app asked for beats the reverse lookup.
+		host = use.host
+	}
+	if host == "" {
+		return
+	}
+	f := c.flowLocked(conn.Serial, host, conn.FirstSeen)
+	if len(f.Connections) < maxRecords {
+		f.Connections = append(f.Connections, Conn{
+			ConnectionID: conn.ID,
+			FirstSeen:    conn.FirstSeen,
+			RemoteIP:     conn.RemoteIP,
+			RemotePort:   conn.RemotePort,
+			Protocol:     conn.Protocol,
+			AppName:      conn.AppName,
+		})
+	}
+	c.record[conn.ID] = f.ID
+}
+
+// flowLocked returns the flow of serial and host that at falls within the
+// window of, creating one if there is none, and stretches it to cover at.
+func (c *Correlator) flowLocked(serial, host string, at time.Time) *Flow {
+	key := serial + "\x00" + host
+	if f, ok := c.latest[key]; ok && !at.Before(f.Start.Add(-c.window)) && !at.After(f.End.Add(c.window)) {
+		if at.Before(f.Start) {
+			f.Start = at
+		}
+		if at.After(f.End) {
+			f.End = at
+		}
+		return f
+	}
+
+	c.seq++
+	f := &Flow{
+		ID:          "flow-" + strconv.FormatUint(c.seq, 10),
+		Serial:      serial,
+		Host:        host,
+		Start:       at,
+		End:         at,
+		URLs:        []URL{},
+		Lookups:     []Lookup{},
+		Connections: []Conn{},
+	}
+	c.flows[f.ID] = f
+	c.order = append(c.order, f.ID)
+	c.latest[key] = f
+	for len(c.order) > c.maxFlows {
+		c.evictLocked(c.order[0])
+		c.order = c.order[1:]
+	}
+	return f
+}
+
+// evictLocked forgets flow id and its records.
+func (c *Correlator) evictLocked(id string) {
+	f, ok := c.flows[id]
+	if !ok {
+		return
+	}
+	delete(c.flows, id)
+	key := f.Serial + "\x00" + f.Host
+	if c.latest[key] == f {
+		delete(c.latest, key)
+	}
+	for _, u := range f.URLs {
+		delete(c.record, u.PacketID)
+	}
+	for _, l := range f.Lookups {
+		delete(c.record, l.LookupID)
+	}
+	for _, conn := range f.Connections {
+		delete(c.record, conn.ConnectionID)
+	}
+}
+
+// Get returns a copy of flow id.
+func (c *Correlator) Get(id string) (Flow, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.flows[id]
+	if !ok {
+		return Flow{}, false
+	}
+	return f.clone(), true
+}
+
+// FlowOf returns the flow a packet, lookup or connection was linked to.
+func (c *Correlator) FlowOf(recordID string) (Flow, bool) {
+	c.mu.Lock()
+	id, ok := c.record[recordID]
+	c.mu.Unlock()
+	if !ok {
+		return Flow{}, false
+	}
+	return c.Get(id)
+}
+
+// List returns the flows matching q, newest first.
+func (c *Correlator) List(q Query) []Flow {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := []Flow{}
+	for i := len(c.order) - 1; i >= 0; i-- {
+		f := c.flows[c.order[i]]
+		if q.Serial != "" && f.Serial != q.Serial ||
+			q.Host != "" && !strings.EqualFold(f.Host, q.Host) ||
+			!q.From.IsZero() && f.End.Before(q.From) ||
+			!q.To.IsZero() && f.Start.After(q.To) ||
+			q.Complete && !f.Complete() {
+			continue
+		}
+		out = append(out, f.clone())
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+	}
+	return out
+}
+
+// Clear forgets every flow.
+func (c *Correlator) Clear() {
+	c.mu.Lock()
+	c.resetLocked()
+	c.mu.Unlock()
+}
+
+func (f *Flow) clone() Flow {
+	out := *f
+	out.URLs = append([]URL{}, f.URLs...)
+	out.Lookups = append([]Lookup{}, f.Lookups...)
+	out.Connections = append([]Conn{}, f.Connections...)
+	return out
+}
+
+func addrKey(serial, ip string) string {
+	return serial + "\x00" + ip
+}
+
+// normalizeHost lower-cases host and drops a port and a trailing dot.
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, ok := strings.Cut(host, ":"); ok && !strings.Contains(host, "]") && strings.Count(host, ":") == 1 {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
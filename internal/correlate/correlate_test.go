@@ -0,0 +1,77 @@
+package correlate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+func TestCorrelator_LinksURLLookupAndConnection(t *testing.T) {
+	c := New(Config{})
+	t0 := time.Unix(1700000000, 0)
+
+	c.AddDNSLookup(capture.DNSLookup{ID: "dns-1", Serial: "S1", Timestamp: t0, Query: "API.example.com.", RCode: "NOERROR",
+		Answers: []capture.DNSAnswer{{Type: "CNAME", Data: "edge.example.net"}, {Type: "A", Data: "93.184.216.34"}}})
+	c.AddConnection(capture.Connection{ID: "conn-1", Serial: "S1", RemoteIP: "::ffff:93.184.216.34", RemotePort: 443,
+		Protocol: capture.ProtoTCP, FirstSeen: t0.Add(200 * time.Millisecond), Hostname: "a23-1.deploy.static.akamaitechnologies.com"})
+	c.AddPacket(capture.NetworkPacket{ID: "logcat-1", Serial: "S1", Timestamp: t0.Add(time.Second),
+		HTTPMethod: "POST", HTTPHost: "api.example.com", HTTPPath: "/v2/token", Flags: "logcat:OkHttp"})
+	// The same host on another device, and a packet without a host.
+	c.AddPacket(capture.NetworkPacket{ID: "logcat-2", Serial: "S2", Timestamp: t0, HTTPMethod: "GET", HTTPHost: "api.example.com"})
+	c.AddPacket(capture.NetworkPacket{ID: "pkt-3", Serial: "S1", Timestamp: t0, DstIP: "93.184.216.34"})
+
+	flows := c.List(Query{Serial: "S1"})
+	if len(flows) != 1 {
+		t.Fatalf("flows = %+v", flows)
+	}
+	f := flows[0]
+	if f.Host != "api.example.com" || !f.Complete() || f.Connections[0].ConnectionID != "conn-1" || f.URLs[0].Source != "logcat:OkHttp" {
+		t.Errorf("flow = %+v", f)
+	}
+	if !f.Start.Equal(t0) || !f.End.Equal(t0.Add(time.Second)) {
+		t.Errorf("span = %v - %v", f.Start, f.End)
+	}
+	for _, id := range []string{"dns-1", "conn-1", "logcat-1"} {
+		if got, ok := c.FlowOf(id); !ok || got.ID != f.ID {
+			t.Errorf("FlowOf(%s) = %v, %v", id, got.ID, ok)
+		}
+	}
+	if _, ok := c.FlowOf("pkt-3"); ok {
+		t.Error("packet without a host was linked")
+	}
+	if got := c.List(Query{Complete: true}); len(got) != 1 {
+		t.Errorf("complete flows = %d, want 1", len(got))
+	}
+}
+
+func TestCorrelator_Window(t *testing.T) {
+	c := New(Config{Window: 10 * time.Second, MaxFlows: 2})
+	t0 := time.Unix(1700000000, 0)
+	pkt := func(id string, at time.Time) capture.NetworkPacket {
+		return capture.NetworkPacket{ID: id, Serial: "S1", Timestamp: at, HTTPMethod: "GET", HTTPHost: "example.com:8080"}
+	}
+
+	c.AddPacket(pkt("p1", t0))
+	c.AddPacket(pkt("p2", t0.Add(5*time.Second)))
+	c.AddPacket(pkt("p3", t0.Add(30*time.Second)))
+	c.AddPacket(pkt("p4", t0.Add(60*time.Second)))
+
+	flows := c.List(Query{})
+	if len(flows) != 2 {
+		t.Fatalf("flows = %d, want 2 (the oldest evicted)", len(flows))
+	}
+	if flows[0].URLs[0].PacketID != "p4" || flows[1].URLs[0].PacketID != "p3" || flows[0].Host != "example.com" {
+		t.Errorf("flows = %+v", flows)
+	}
+	if _, ok := c.FlowOf("p1"); ok {
+		t.Error("record of an evicted flow still linked")
+	}
+	if got := c.List(Query{From: t0.Add(50 * time.Second)}); len(got) != 1 {
+		t.Errorf("flows from +50s = %d, want 1", len(got))
+	}
+	c.Clear()
+	if got := c.List(Query{}); len(got) != 0 {
+		t.Errorf("after Clear: %d flows", len(got))
+	}
+}
@@ -0,0 +1,196 @@
+// Package downloads keeps files fetched from devices, such as screen
+// recordings, in a directory on the host. Each file has a JSON sidecar
+// describing it, so the list survives restarts.
+package downloads
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metaSuffix is appended to a file's name to name its sidecar.
+const metaSuffix = ".json"
+
+var (
+	// ErrDisabled is returned when the store has no directory.
+	ErrDisabled = errors.New("downloads are disabled")
+	// ErrNotFound is returned for names the store does not hold.
+	ErrNotFound = errors.New("download not found")
+)
+
+// Item describes one stored file.
+type Item struct {
+	Name string `json:"name"`
+	// Kind says what the file is, e.g. "screenrecord".
+	Kind        string `json:"kind"`
+	Serial      string `json:"serial"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// StartedAt and EndedAt bound the time the file covers, so it can be
+	// matched with the traffic captured meanwhile.
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store is a directory of downloads. It is safe for concurrent use.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Open returns the store kept in dir, creating it on first save. An empty
+// dir disables the store.
+func Open(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Dir returns the directory of the store, or "" if it is disabled.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Save writes a new file with the metadata of it, its content coming from
+// write, which returns the number of bytes written. The file is named
+// after it.Name, made unique and safe for a file name; the stored Item is
+// returned. On failure nothing is kept.
+func (s *Store) Save(it Item, write func(io.Writer) (int64, error)) (Item, error) {
+	if s.dir == "" {
+		return Item{}, ErrDisabled
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return Item{}, fmt.Errorf("create downloads dir: %w", err)
+	}
+
+	s.mu.Lock()
+	it.Name = s.uniqueLocked(sanitize(it.Name))
+	f, err := os.OpenFile(filepath.Join(s.dir, it.Name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	s.mu.Unlock()
+	if err != nil {
+		return Item{}, fmt.Errorf("create download: %w", err)
+	}
+
+	n, err := write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return Item{}, err
+	}
+	it.Size = n
+	it.CreatedAt = time.Now()
+
+	data, err := json.MarshalIndent(it, "", "  ")
+	if err == nil {
+		err = os.WriteFile(f.Name()+metaSuffix, data, 0o644)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return Item{}, fmt.Errorf("write download metadata: %w", err)
+	}
+	return it, nil
+}
+
+// uniqueLocked returns name, or name with a counter before its extension
+// if a file of that name exists.
+func (s *Store) uniqueLocked(name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filepath.Join(s.dir, name)); errors.Is(err, os.ErrNotExist) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
+
+// sanitize keeps letters, digits, dots, dashes and underscores.
+func sanitize(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		name = "download"
+	}
+	return name
+}
+
+// List returns every download, newest first.
+func (s *Store) List() ([]Item, error) {
+	items := []Item{}
+	if s.dir == "" {
+		return items, nil
+	}
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read downloads: %w", err)
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), metaSuffix)
+		if !ok {
+			continue
+		}
+		if it, _, err := s.Get(name); err == nil {
+			items = append(items, it)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].CreatedAt.After(items[j].CreatedAt) })
+	return items, nil
+}
+
+// Get returns the metadata and the path of the download called name.
+func (s *Store) Get(name string) (Item, string, error) {
+	if s.dir == "" {
+		return Item{}, "", ErrDisabled
+	}
+	if name != sanitize(name) {
+		return Item{}, "", ErrNotFound
+	}
+	path := filepath.Join(s.dir, name)
+	data, err := os.ReadFile(path + metaSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return Item{}, "", ErrNotFound
+	}
+	if err != nil {
+		return Item{}, "", fmt.Errorf("read download metadata: %w", err)
+	}
+	var it Item
+	if err := json.Unmarshal(data, &it); err != nil {
+		return Item{}, "", fmt.Errorf("parse download metadata %s: %w", name, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return Item{}, "", ErrNotFound
+	}
+	return it, path, nil
+}
+
+// Delete removes the download called name.
+func (s *Store) Delete(name string) error {
+	_, path, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("delete download: %w", err)
+	}
+	os.Remove(path + metaSuffix)
+	return nil
+}
@@ -0,0 +1,89 @@
+package downloads
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeString(s string) func(io.Writer) (int64, error) {
+	return func(w io.Writer) (int64, error) {
+		n, err := io.WriteString(w, s)
+		return int64(n), err
+	}
+}
+
+func TestStore_SaveListGet(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "downloads")
+	s := Open(dir)
+
+	start := time.Unix(1700000000, 0).UTC()
+	first, err := s.Save(Item{Name: "R58M:5555_rec.mp4", Kind: "screenrecord", Serial: "R58M:5555", StartedAt: start}, writeString("mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Name != "R58M_5555_rec.mp4" || first.Size != 3 {
+		t.Errorf("first = %+v", first)
+	}
+	second, err := s.Save(Item{Name: "R58M:5555_rec.mp4"}, writeString("more"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Name != "R58M_5555_rec-1.mp4" {
+		t.Errorf("second name = %q", second.Name)
+	}
+
+	items, err := Open(dir).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Name != second.Name {
+		t.Fatalf("List = %+v", items)
+	}
+	it, path, err := s.Get(first.Name)
+	if err != nil || it.Serial != "R58M:5555" || !it.StartedAt.Equal(start) {
+		t.Fatalf("Get = %+v, %v", it, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "mp4" {
+		t.Errorf("content = %q", data)
+	}
+
+	if _, _, err := s.Get("../labels.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get outside the store: %v", err)
+	}
+	if err := s.Delete(first.Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Get(first.Name); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: %v", err)
+	}
+}
+
+func TestStore_SaveFailureKeepsNothing(t *testing.T) {
+	dir := t.TempDir()
+	s := Open(dir)
+	_, err := s.Save(Item{Name: "x.mp4"}, func(w io.Writer) (int64, error) {
+		io.WriteString(w, "partial")
+		return 0, errors.New("device went away")
+	})
+	if err == nil || !strings.Contains(err.Error(), "went away") {
+		t.Fatalf("err = %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("left %d files behind", len(entries))
+	}
+}
+
+func TestStore_Disabled(t *testing.T) {
+	s := Open("")
+	if _, err := s.Save(Item{Name: "x"}, writeString("")); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Save err = %v", err)
+	}
+	if items, err := s.List(); err != nil || len(items) != 0 {
+		t.Errorf("List = %v, %v", items, err)
+	}
+}
@@ -0,0 +1,503 @@
+// Package elastic bulk-indexes captured packets and connections into
+// Elasticsearch or OpenSearch, one index per record kind and day, so long
+// traffic histories can be searched and charted in Kibana or OpenSearch
+// Dashboards.
+package elastic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+const (
+	// DefaultIndex is the index name template used when none is set.
+	DefaultIndex = "adbmonitor-{kind}-{date}"
+	// DefaultBatchSize is how many documents a bulk request carries at most.
+	DefaultBatchSize = 500
+	// DefaultFlushInterval is how long a document waits for its batch to
+	// fill.
+	DefaultFlushInterval = 5 * time.Second
+	// DefaultBuffer is how many documents are kept while the cluster is
+	// slow or down; the oldest are dropped beyond it.
+	DefaultBuffer = 20000
+
+	// requestTimeout bounds one bulk or template request.
+	requestTimeout = 30 * time.Second
+	// flushTimeout bounds the final flush when the exporter stops.
+	flushTimeout = 10 * time.Second
+	// minBackoff and maxBackoff bound the wait after a failed request.
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+	// dateLayout formats {date} in index names.
+	dateLayout = "2006.01.02"
+)
+
+// Config configures an Exporter.
+type Config struct {
+	// URL is the cluster, http(s)://[user:pass@]host:9200. Credentials in
+	// the URL are sent as basic auth.
+	URL string
+	// APIKey, if set, is sent as "Authorization: ApiKey <APIKey>" instead.
+	APIKey string
+	// Index names the index of each document. {kind} becomes packets or
+	// connections and {date} the UTC day of the record (2006.01.02).
+	// DefaultIndex if empty.
+	Index string
+	// Template installs an index template for the indices at startup,
+	// mapping timestamps as dates, addresses as IPs and strings as
+	// keywords.
+	Template bool
+	// BatchSize, FlushInterval and Buffer are their defaults if zero.
+	BatchSize     int
+	FlushInterval time.Duration
+	Buffer        int
+	// Client sends the requests; http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Stats counts documents by outcome.
+type Stats struct {
+	// Indexed documents were accepted by the cluster.
+	Indexed uint64 `json:"indexed"`
+	// Dropped documents were discarded while the cluster was failing and
+	// the buffer was full.
+	Dropped uint64 `json:"dropped"`
+	// Failed documents were rejected by the cluster, such as for a
+	// mapping conflict, and are not retried.
+	Failed uint64 `json:"failed"`
+}
+
+// record is a document waiting in the queue, not yet serialized.
+type record struct {
+	packet *capture.NetworkPacket
+	conn   *capture.Connection
+}
+
+// doc is a serialized document and the index it goes to.
+type doc struct {
+	index string
+	body  []byte
+}
+
+// packetDoc and connDoc add the @timestamp Kibana sorts and filters by.
+type packetDoc struct {
+	Timestamp time.Time `json:"@timestamp"`
+	capture.NetworkPacket
+}
+
+type connDoc struct {
+	Timestamp time.Time `json:"@timestamp"`
+	capture.Connection
+}
+
+// Exporter queues packets and connections and bulk-indexes them. Packet
+// and Connection never block; Run does the indexing.
+type Exporter struct {
+	log      *slog.Logger
+	client   *http.Client
+	endpoint string // cluster URL without credentials or trailing slash
+	auth     string // Authorization header
+	index    string
+	template bool
+	size     int
+	every    time.Duration
+	buffer   int
+	queue    chan record
+
+	indexed, dropped, failed atomic.Uint64
+}
+
+// New returns an exporter indexing into the cluster at cfg.URL. It does
+// not contact the cluster; an unreachable one is retried by Run.
+func New(log *slog.Logger, cfg Config) (*Exporter, error) {
+	if cfg.Index == "" {
+		cfg.Index = DefaultIndex
+	}
+	if err := validIndex(cfg.Index); err != nil {
+		return nil, err
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = DefaultBuffer
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("elasticsearch url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("elasticsearch url %q: want http(s)://host[:port]", cfg.URL)
+	}
+	var auth string
+	switch {
+	case cfg.APIKey != "":
+		auth = "ApiKey " + cfg.APIKey
+	case u.User != nil:
+		pass, _ := u.User.Password()
+		req := http.Request{Header: http.Header{}}
+		req.SetBasicAuth(u.User.Username(), pass)
+		auth = req.Header.Get("Authorization")
+	}
+	u.User = nil
+	u.RawQuery, u.Fragment = "", ""
+	endpoint := strings.TrimSuffix(u.String(), "/")
+
+	return &Exporter{
+		log:      log.With("component", "elastic", "url", endpoint),
+		client:   cfg.Client,
+		endpoint: endpoint,
+		auth:     auth,
+		index:    cfg.Index,
+		template: cfg.Template,
+		size:     cfg.BatchSize,
+		every:    cfg.FlushInterval,
+		buffer:   cfg.Buffer,
+		queue:    make(chan record, cfg.BatchSize*2),
+	}, nil
+}
+
+// Endpoint returns the cluster URL, without credentials.
+func (e *Exporter) Endpoint() string {
+	return e.endpoint
+}
+
+// Packet queues a packet. Its raw capture line is left out.
+func (e *Exporter) Packet(p capture.NetworkPacket) {
+	p.Raw = ""
+	e.enqueue(record{packet: &p})
+}
+
+// Connection queues a connection snapshot, new or closed; each becomes a
+// document of its own.
+func (e *Exporter) Connection(c capture.Connection) {
+	e.enqueue(record{conn: &c})
+}
+
+func (e *Exporter) enqueue(r record) {
+	select {
+	case e.queue <- r:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// Stats returns the document counters.
+func (e *Exporter) Stats() Stats {
+	return Stats{Indexed: e.indexed.Load(), Dropped: e.dropped.Load(), Failed: e.failed.Load()}
+}
+
+// Run indexes queued documents until ctx is cancelled, then flushes what is
+// left, for up to ten seconds. Failed requests are retried with
+// exponential backoff, keeping up to Buffer documents meanwhile.
+func (e *Exporter) Run(ctx context.Context) {
+	var (
+		pending []doc
+		bo      backoff
+	)
+	templated := !e.template
+	// A request in flight when ctx is cancelled completes: cut short, the
+	// cluster may still index its documents, which would then be sent
+	// twice by the final flush.
+	reqCtx := context.WithoutCancel(ctx)
+
+	flush := func(ctx context.Context, all bool) {
+		if !templated {
+			err := e.putTemplate(ctx)
+			var perm permanentError
+			if err != nil && !errors.As(err, &perm) {
+				bo.failed()
+				e.log.Warn("cluster unavailable, retrying", "retry_in", bo.delay, "error", err)
+				return
+			}
+			if err != nil {
+				// Indexing goes on without it, on dynamic mappings.
+				e.log.Warn("failed to install index template", "error", err)
+			}
+			templated = true
+		}
+		for len(pending) > 0 && (all || len(pending) >= e.size) {
+			n := min(len(pending), e.size)
+			retry, err := e.bulk(ctx, pending[:n])
+			if err != nil {
+				var perm permanentError
+				if !errors.As(err, &perm) {
+					bo.failed()
+					e.log.Warn("bulk request failed, retrying", "documents", n, "retry_in", bo.delay, "error", err)
+					return
+				}
+				// The cluster will refuse these again.
+				e.failed.Add(uint64(n))
+				e.log.Warn("bulk request rejected", "documents", n, "error", err)
+			}
+			pending = append(retry, pending[n:]...)
+			if len(retry) > 0 {
+				bo.failed()
+				e.log.Warn("documents rejected by an overloaded cluster, retrying", "documents", len(retry), "retry_in", bo.delay)
+				return
+			}
+			bo.reset()
+		}
+	}
+	add := func(r record) {
+		pending = append(pending, e.doc(r))
+		if over := len(pending) - e.buffer; over > 0 {
+			pending = pending[over:]
+			e.dropped.Add(uint64(over))
+		}
+	}
+
+	ticker := time.NewTicker(e.every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+		drain:
+			for {
+				select {
+				case r := <-e.queue:
+					add(r)
+				default:
+					break drain
+				}
+			}
+			fctx, cancel := context.WithTimeout(reqCtx, flushTimeout)
+			flush(fctx, true)
+			cancel()
+			if len(pending) > 0 {
+				e.dropped.Add(uint64(len(pending)))
+				e.log.Warn("documents not indexed before shutdown", "documents", len(pending))
+			}
+			return
+		case r := <-e.queue:
+			add(r)
+			if len(pending) >= e.size && bo.ready() {
+				flush(reqCtx, false)
+			}
+		case <-ticker.C:
+			if bo.ready() {
+				flush(reqCtx, true)
+			}
+		}
+	}
+}
+
+// doc serializes r for its index.
+func (e *Exporter) doc(r record) doc {
+	var (
+		kind string
+		at   time.Time
+		v    any
+	)
+	switch {
+	case r.packet != nil:
+		kind, at = "packets", r.packet.Timestamp
+		v = packetDoc{Timestamp: at, NetworkPacket: *r.packet}
+	default:
+		kind, at = "connections", r.conn.LastSeen
+		if r.conn.ClosedAt != nil {
+			at = *r.conn.ClosedAt
+		}
+		v = connDoc{Timestamp: at, Connection: *r.conn}
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+	body, _ := json.Marshal(v) // plain structs, no error
+	return doc{index: indexName(e.index, kind, at), body: body}
+}
+
+// permanentError is a request the cluster refused for good, such as for
+// bad credentials; its documents are not retried.
+type permanentError struct{ error }
+
+// bulkResponse is the part of a _bulk response read back.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// bulk indexes docs in one _bulk request and returns the ones to retry:
+// those the cluster turned away for load (429) or an internal error.
+func (e *Exporter) bulk(ctx context.Context, docs []doc) (retry []doc, err error) {
+	var body bytes.Buffer
+	for _, d := range docs {
+		// create works for data streams as well as plain indices.
+		fmt.Fprintf(&body, "{\"create\":{\"_index\":%q}}\n", d.index)
+		body.Write(d.body)
+		body.WriteByte('\n')
+	}
+	resp, err := e.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", &body)
+	if err != nil {
+		return nil, err
+	}
+	var br bulkResponse
+	if err := json.Unmarshal(resp, &br); err != nil {
+		return nil, fmt.Errorf("bulk response: %w", err)
+	}
+	if len(br.Items) != len(docs) {
+		return nil, fmt.Errorf("bulk response has %d items for %d documents", len(br.Items), len(docs))
+	}
+
+	var failed, indexed uint64
+	var firstErr string
+	for i, item := range br.Items {
+		for _, res := range item {
+			switch {
+			case res.Status >= 200 && res.Status < 300:
+				indexed++
+			case res.Status == http.StatusTooManyRequests || res.Status >= 500:
+				retry = append(retry, docs[i])
+			default:
+				failed++
+				if firstErr == "" && res.Error != nil {
+					firstErr = res.Error.Type + ": " + res.Error.Reason
+				}
+			}
+		}
+	}
+	e.indexed.Add(indexed)
+	if failed > 0 {
+		e.failed.Add(failed)
+		e.log.Warn("documents rejected", "documents", failed, "error", firstErr)
+	}
+	return retry, nil
+}
+
+// putTemplate installs the index template of the exporter's indices.
+func (e *Exporter) putTemplate(ctx context.Context) error {
+	pattern := strings.NewReplacer("{kind}", "*", "{date}", "*").Replace(e.index)
+	name := strings.Trim(strings.NewReplacer("{kind}", "", "{date}", "", "*", "").Replace(e.index), "-_.")
+	if name == "" {
+		name = "adbmonitor"
+	}
+	ip := map[string]any{"type": "ip", "ignore_malformed": true}
+	date := map[string]any{"type": "date"}
+	tmpl := map[string]any{
+		"index_patterns": []string{pattern},
+		"priority":       100,
+		"template": map[string]any{
+			"mappings": map[string]any{
+				"dynamic_templates": []any{
+					map[string]any{"strings": map[string]any{
+						"match_mapping_type": "string",
+						"mapping":            map[string]any{"type": "keyword", "ignore_above": 1024},
+					}},
+				},
+				"properties": map[string]any{
+					"@timestamp": date,
+					"timestamp":  date,
+					"first_seen": date,
+					"last_seen":  date,
+					"closed_at":  date,
+					"src_ip":     ip,
+					"dst_ip":     ip,
+					"local_ip":   ip,
+					"remote_ip":  ip,
+				},
+			},
+		},
+	}
+	body, err := json.Marshal(tmpl)
+	if err != nil {
+		return err
+	}
+	_, err = e.do(ctx, http.MethodPut, "/_index_template/"+url.PathEscape(name), "application/json", bytes.NewReader(body))
+	return err
+}
+
+// do sends a request and returns the response body of a 2xx reply.
+func (e *Exporter) do(ctx context.Context, method, path, contentType string, body io.Reader) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, e.endpoint+path, body)
+	if err != nil {
+		return nil, permanentError{err}
+	}
+	req.Header.Set("Content-Type", contentType)
+	if e.auth != "" {
+		req.Header.Set("Authorization", e.auth)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return data, nil
+	}
+	err = fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(data[:min(len(data), 512)]))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, err
+	}
+	return nil, permanentError{err}
+}
+
+// indexName fills in the template for a record of kind at t.
+func indexName(template, kind string, t time.Time) string {
+	return strings.NewReplacer("{kind}", kind, "{date}", t.UTC().Format(dateLayout)).Replace(template)
+}
+
+// validIndex checks that template yields valid index names.
+func validIndex(template string) error {
+	name := indexName(template, "packets", time.Unix(0, 0))
+	switch {
+	case name != strings.ToLower(name):
+		return fmt.Errorf("elasticsearch index %q: must be lowercase", template)
+	case strings.ContainsAny(name, `\/*?"<>| ,#:`):
+		return fmt.Errorf("elasticsearch index %q: must not contain \\ / * ? \" < > | , # : or spaces", template)
+	case strings.HasPrefix(name, "-") || strings.HasPrefix(name, "_") || strings.HasPrefix(name, "+"):
+		return fmt.Errorf("elasticsearch index %q: must not start with -, _ or +", template)
+	case len(name) > 255:
+		return fmt.Errorf("elasticsearch index %q: too long", template)
+	}
+	return nil
+}
+
+// backoff spaces out retries against a failing cluster.
+type backoff struct {
+	delay time.Duration
+	until time.Time
+}
+
+func (b *backoff) ready() bool {
+	return !time.Now().Before(b.until)
+}
+
+func (b *backoff) failed() {
+	b.delay = min(max(b.delay*2, minBackoff), maxBackoff)
+	b.until = time.Now().Add(b.delay)
+}
+
+func (b *backoff) reset() {
+	b.delay, b.until = 0, time.Time{}
+}
@@ -1,40 +1,240 @@
 package event
 
 import (
+	"fmt"
+	"hash/maphash"
+	"log/slog"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Handler is a function that processes events.
 type Handler func(Event)
 
+// Overflow says what Publish does when a subscriber's queue is full.
+type Overflow int
+
+const (
+	// DropNewest discards the event being published.
+	DropNewest Overflow = iota
+	// DropOldest discards the oldest queued event to make room.
+	DropOldest
+	// Block waits up to Config.BlockTimeout for room, then discards the
+	// event being published.
+	Block
+)
+
+// String returns the name accepted by ParseOverflow.
+func (o Overflow) String() string {
+	switch o {
+	case DropOldest:
+		return "drop-oldest"
+	case Block:
+		return "block"
+	default:
+		return "drop-newest"
+	}
+}
+
+// ParseOverflow converts a name such as "drop-oldest" to an Overflow.
+func ParseOverflow(s string) (Overflow, error) {
+	switch s {
+	case "", "drop-newest":
+		return DropNewest, nil
+	case "drop-oldest":
+		return DropOldest, nil
+	case "block":
+		return Block, nil
+	default:
+		return DropNewest, fmt.Errorf("unknown overflow strategy %q", s)
+	}
+}
+
+// DefaultBlockTimeout is how long Block waits for room in a queue.
+const DefaultBlockTimeout = 100 * time.Millisecond
+
+// Config configures a Bus.
+type Config struct {
+	// BufferSize is the queue length of each subscriber worker; 256 if
+	// zero.
+	BufferSize int
+	// Workers is how many goroutines run each subscriber's handler; 1 if
+	// zero. Events are spread over them by serial, so the events of one
+	// device are handled in publish order while different devices are
+	// handled concurrently. Events without a serial go to the first, so
+	// with more than one worker they are not ordered against device
+	// events.
+	Workers int
+	// Overflow is applied per subscriber when its queue is full.
+	Overflow Overflow
+	// BlockTimeout bounds the wait of the Block strategy;
+	// DefaultBlockTimeout if zero.
+	BlockTimeout time.Duration
+	// HandlerTimeout bounds one handler call; zero leaves it unbounded. A
+	// handler that overruns it is counted and left running, and its
+	// subscriber moves on to the next event.
+	HandlerTimeout time.Duration
+	// Log receives handler panics and timeouts; slog.Default() if nil.
+	Log *slog.Logger
+}
+
+// Stats counts the events a bus published and dropped.
+type Stats struct {
+	Overflow  string `json:"overflow"`
+	Published uint64 `json:"published"`
+	// Dropped counts events lost to full queues, summed over subscribers,
+	// including ones that have since unsubscribed.
+	Dropped uint64 `json:"dropped"`
+	// Panics and Timeouts count handler calls that panicked or overran
+	// Config.HandlerTimeout, likewise summed.
+	Panics      uint64            `json:"panics"`
+	Timeouts    uint64            `json:"timeouts"`
+	Subscribers []SubscriberStats `json:"subscribers"`
+}
+
+// SubscriberStats describes the queues of one subscriber, summed over its
+// workers.
+type SubscriberStats struct {
+	Name      string `json:"name"`
+	Workers   int    `json:"workers"`
+	Queued    int    `json:"queued"`
+	Capacity  int    `json:"capacity"`
+	Delivered uint64 `json:"delivered"`
+	Dropped   uint64 `json:"dropped"`
+	Panics    uint64 `json:"panics"`
+	Timeouts  uint64 `json:"timeouts"`
+}
+
+// subscriber owns queues drained by its own goroutines, one per worker,
+// so a slow handler only loses its own events and a panicking one only its
+// current event.
+type subscriber struct {
+	bus    *Bus
+	name   string
+	h      Handler
+	queues []chan Event
+	done   chan struct{}
+
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	panics    atomic.Uint64
+	timeouts  atomic.Uint64
+}
+
+// queueFor returns the worker queue of e's serial.
+func (s *subscriber) queueFor(e Event) chan Event {
+	if len(s.queues) == 1 || e.Serial == "" {
+		return s.queues[0]
+	}
+	return s.queues[maphash.String(s.bus.seed, e.Serial)%uint64(len(s.queues))]
+}
+
+func (s *subscriber) run(queue chan Event) {
+	for {
+		select {
+		case <-s.done:
+			return
+		case e := <-queue:
+			s.dispatch(e)
+			s.delivered.Add(1)
+		}
+	}
+}
+
+// dispatch calls the handler, waiting at most the handler timeout.
+func (s *subscriber) dispatch(e Event) {
+	timeout := s.bus.cfg.HandlerTimeout
+	if timeout <= 0 {
+		s.call(e)
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.call(e)
+	}()
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-done:
+	case <-t.C:
+		s.timeouts.Add(1)
+		s.bus.timeouts.Add(1)
+		s.bus.log.Warn("event handler timed out", "subscriber", s.name,
+			"event", e.Type, "serial", e.Serial, "timeout", timeout)
+	case <-s.done:
+	}
+}
+
+// call runs the handler, recovering a panic so the subscriber keeps
+// receiving events.
+func (s *subscriber) call(e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.panics.Add(1)
+			s.bus.panics.Add(1)
+			s.bus.log.Error("event handler panicked", "subscriber", s.name,
+				"event", e.Type, "serial", e.Serial, "panic", r, "stack", string(debug.Stack()))
+		}
+	}()
+	s.h(e)
+}
+
 // Bus is a publish-subscribe event bus for device events.
 // It is safe for concurrent use.
 type Bus struct {
-	mu       sync.RWMutex
-	subs     map[string]Handler
-	nextID   int
-	bufSize  int
-	eventCh  chan Event
-	done     chan struct{}
-	stopOnce sync.Once
+	cfg  Config
+	log  *slog.Logger
+	seed maphash.Seed // spreads serials over subscriber workers
+
+	mu     sync.RWMutex
+	subs   map[string]*subscriber
+	nextID int
+	closed bool
+
+	published atomic.Uint64
+	dropped   atomic.Uint64
+	panics    atomic.Uint64
+	timeouts  atomic.Uint64
 }
 
-// NewBus creates a new event bus with the given internal buffer size.
+// NewBus creates a new event bus with the given per-subscriber buffer
+// size, dropping the newest events when a subscriber falls behind.
 func NewBus(bufSize int) *Bus {
-	if bufSize <= 0 {
-		bufSize = 256
+	return NewBusWithConfig(Config{BufferSize: bufSize})
+}
+
+// NewBusWithConfig creates a new event bus configured by cfg.
+func NewBusWithConfig(cfg Config) *Bus {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 256
+	}
+	if cfg.BlockTimeout <= 0 {
+		cfg.BlockTimeout = DefaultBlockTimeout
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
 	}
-	b := &Bus{
-		subs:    make(map[string]Handler),
-		bufSize: bufSize,
-		eventCh: make(chan Event, bufSize),
-		done:    make(chan struct{}),
+	log := cfg.Log
+	if log == nil {
+		log = slog.Default()
+	}
+	return &Bus{
+		cfg:  cfg,
+		log:  log.With("component", "event_bus"),
+		seed: maphash.MakeSeed(),
+		subs: make(map[string]*subscriber),
 	}
-	go b.dispatch()
-	return b
 }
 
 // Subscribe registers a handler and returns an unsubscribe function.
+// Handlers of one subscriber run in publish order per serial, unless one
+// overruns the handler timeout; different subscribers run concurrently. A
+// handler panic is recovered, logged and counted.
 func (b *Bus) Subscribe(name string, h Handler) func() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -42,50 +242,146 @@ func (b *Bus) Subscribe(name string, h Handler) func() {
 	b.nextID++
 	key := name
 	if _, exists := b.subs[key]; exists {
-		key = name + "_" + string(rune(b.nextID))
+		key = name + "_" + strconv.Itoa(b.nextID)
+	}
+	s := &subscriber{
+		bus:    b,
+		name:   key,
+		h:      h,
+		queues: make([]chan Event, b.cfg.Workers),
+		done:   make(chan struct{}),
+	}
+	for i := range s.queues {
+		s.queues[i] = make(chan Event, b.cfg.BufferSize)
+	}
+	if !b.closed {
+		b.subs[key] = s
+		for _, q := range s.queues {
+			go s.run(q)
+		}
 	}
-	b.subs[key] = h
 
+	var once sync.Once
 	return func() {
-		b.mu.Lock()
-		defer b.mu.Unlock()
-		delete(b.subs, key)
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if b.subs[key] == s {
+				delete(b.subs, key)
+				close(s.done)
+			}
+		})
 	}
 }
 
-// Publish sends an event to all subscribers asynchronously.
-// It does not block if the buffer is full; the event is dropped.
+// Publish queues an event for every subscriber. A subscriber whose queue
+// is full loses an event as the overflow strategy says; see Stats.
 func (b *Bus) Publish(e Event) {
-	select {
-	case b.eventCh <- e:
-	default:
-		// Buffer full, drop event. In production, increment a counter.
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return
 	}
-}
+	subs := make([]*subscriber, 0, len(b.subs))
+	for _, s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mu.RUnlock()
 
-// Close shuts down the event bus dispatcher.
-func (b *Bus) Close() {
-	b.stopOnce.Do(func() {
-		close(b.done)
-	})
+	b.published.Add(1)
+	for _, s := range subs {
+		b.enqueue(s, e)
+	}
 }
 
-func (b *Bus) dispatch() {
-	for {
+func (b *Bus) enqueue(s *subscriber, e Event) {
+	queue := s.queueFor(e)
+	select {
+	case queue <- e:
+		return
+	default:
+	}
+
+	switch b.cfg.Overflow {
+	case DropOldest:
+		for {
+			select {
+			case <-queue:
+				b.drop(s)
+			default:
+			}
+			select {
+			case queue <- e:
+				return
+			case <-s.done:
+				b.drop(s)
+				return
+			default:
+			}
+		}
+	case Block:
+		t := time.NewTimer(b.cfg.BlockTimeout)
+		defer t.Stop()
 		select {
-		case <-b.done:
+		case queue <- e:
 			return
-		case e := <-b.eventCh:
-			b.mu.RLock()
-			handlers := make([]Handler, 0, len(b.subs))
-			for _, h := range b.subs {
-				handlers = append(handlers, h)
-			}
-			b.mu.RUnlock()
+		case <-t.C:
+		case <-s.done:
+		}
+	}
+	b.drop(s)
+}
 
-			for _, h := range handlers {
-				h(e)
-			}
+func (b *Bus) drop(s *subscriber) {
+	s.dropped.Add(1)
+	b.dropped.Add(1)
+}
+
+// Stats returns the bus counters, subscribers sorted by name.
+func (b *Bus) Stats() Stats {
+	b.mu.RLock()
+	st := Stats{
+		Overflow:    b.cfg.Overflow.String(),
+		Subscribers: make([]SubscriberStats, 0, len(b.subs)),
+	}
+	for _, s := range b.subs {
+		var queued, capacity int
+		for _, q := range s.queues {
+			queued += len(q)
+			capacity += cap(q)
 		}
+		st.Subscribers = append(st.Subscribers, SubscriberStats{
+			Name:      s.name,
+			Workers:   len(s.queues),
+			Queued:    queued,
+			Capacity:  capacity,
+			Delivered: s.delivered.Load(),
+			Dropped:   s.dropped.Load(),
+			Panics:    s.panics.Load(),
+			Timeouts:  s.timeouts.Load(),
+		})
+	}
+	b.mu.RUnlock()
+
+	st.Published = b.published.Load()
+	st.Dropped = b.dropped.Load()
+	st.Panics = b.panics.Load()
+	st.Timeouts = b.timeouts.Load()
+	sort.Slice(st.Subscribers, func(i, j int) bool { return st.Subscribers[i].Name < st.Subscribers[j].Name })
+	return st
+}
+
+// Close shuts down the event bus: subscribers stop, and later events are
+// discarded. Events still queued are not delivered.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for key, s := range b.subs {
+		close(s.done)
+		delete(b.subs, key)
 	}
 }
@@ -1,6 +1,10 @@
 package event
 
 import (
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -103,3 +107,247 @@ func TestBus_Close(t *testing.T) {
 	// Double close should not panic.
 	bus.Close()
 }
+
+// stalled subscribes a handler that blocks until release is closed, and
+// waits until it holds the first event so the queue is empty again.
+func stalled(t *testing.T, bus *Bus, name string, release chan struct{}, got *[]string, mu *sync.Mutex) {
+	t.Helper()
+	started := make(chan struct{}, 1)
+	bus.Subscribe(name, func(e Event) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		mu.Lock()
+		*got = append(*got, e.Serial)
+		mu.Unlock()
+	})
+	bus.Publish(Event{Serial: "first"})
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("handler not started")
+	}
+}
+
+func TestBus_Overflow(t *testing.T) {
+	tests := []struct {
+		overflow Overflow
+		want     []string
+	}{
+		{DropNewest, []string{"first", "a", "b"}},
+		{DropOldest, []string{"first", "c", "d"}},
+		{Block, []string{"first", "a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.overflow.String(), func(t *testing.T) {
+			bus := NewBusWithConfig(Config{BufferSize: 2, Overflow: tt.overflow, BlockTimeout: 10 * time.Millisecond})
+			defer bus.Close()
+
+			var mu sync.Mutex
+			var got []string
+			release := make(chan struct{})
+			stalled(t, bus, "slow", release, &got, &mu)
+
+			for _, s := range []string{"a", "b", "c", "d"} {
+				bus.Publish(Event{Serial: s})
+			}
+			st := bus.Stats()
+			if st.Published != 5 || st.Dropped != 2 || len(st.Subscribers) != 1 || st.Subscribers[0].Dropped != 2 {
+				t.Errorf("stats = %+v", st)
+			}
+			close(release)
+			time.Sleep(50 * time.Millisecond)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("delivered %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBus_SlowSubscriberIsolated(t *testing.T) {
+	bus := NewBus(2)
+	defer bus.Close()
+
+	var mu sync.Mutex
+	var slow, fast []string
+	release := make(chan struct{})
+	defer close(release)
+	bus.Subscribe("fast", func(e Event) {
+		mu.Lock()
+		fast = append(fast, e.Serial)
+		mu.Unlock()
+	})
+	stalled(t, bus, "slow", release, &slow, &mu)
+
+	for i := 0; i < 10; i++ {
+		bus.Publish(Event{Serial: "x"})
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	n := len(fast)
+	mu.Unlock()
+	if n != 11 {
+		t.Errorf("fast subscriber got %d events, want 11", n)
+	}
+	for _, s := range bus.Stats().Subscribers {
+		if s.Name == "fast" && s.Dropped != 0 || s.Name == "slow" && s.Dropped != 8 {
+			t.Errorf("subscriber %s dropped %d", s.Name, s.Dropped)
+		}
+	}
+}
+
+func TestParseOverflow(t *testing.T) {
+	for _, o := range []Overflow{DropNewest, DropOldest, Block} {
+		if got, err := ParseOverflow(o.String()); err != nil || got != o {
+			t.Errorf("ParseOverflow(%q) = %v, %v", o, got, err)
+		}
+	}
+	if _, err := ParseOverflow("spill"); err == nil {
+		t.Error("unknown strategy accepted")
+	}
+}
+
+func TestBus_HandlerPanic(t *testing.T) {
+	bus := NewBusWithConfig(Config{BufferSize: 4, Log: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	defer bus.Close()
+
+	var mu sync.Mutex
+	var got []string
+	bus.Subscribe("flaky", func(e Event) {
+		if e.Serial == "boom" {
+			panic("handler bug")
+		}
+		mu.Lock()
+		got = append(got, e.Serial)
+		mu.Unlock()
+	})
+
+	for _, serial := range []string{"a", "boom", "b"} {
+		bus.Publish(Event{Serial: serial})
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(got, ",") != "a,b" {
+		t.Errorf("delivered %v after a panic, want a,b", got)
+	}
+	st := bus.Stats()
+	if st.Panics != 1 || len(st.Subscribers) != 1 || st.Subscribers[0].Panics != 1 {
+		t.Errorf("stats: %+v", st)
+	}
+}
+
+func TestBus_HandlerTimeout(t *testing.T) {
+	bus := NewBusWithConfig(Config{BufferSize: 4, HandlerTimeout: 10 * time.Millisecond,
+		Log: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	defer bus.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	var mu sync.Mutex
+	var got []string
+	bus.Subscribe("slow", func(e Event) {
+		if e.Serial == "stuck" {
+			<-release
+			return
+		}
+		mu.Lock()
+		got = append(got, e.Serial)
+		mu.Unlock()
+	})
+
+	bus.Publish(Event{Serial: "stuck"})
+	bus.Publish(Event{Serial: "next"})
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 1 || got[0] != "next" {
+		t.Errorf("events after a stuck handler: %v", got)
+	}
+	if st := bus.Stats(); st.Timeouts != 1 || st.Subscribers[0].Timeouts != 1 {
+		t.Errorf("stats: %+v", st)
+	}
+}
+
+func TestBus_WorkersOrderPerSerial(t *testing.T) {
+	bus := NewBusWithConfig(Config{BufferSize: 64, Workers: 4})
+	defer bus.Close()
+
+	var mu sync.Mutex
+	seen := make(map[string][]string)
+	bus.Subscribe("sub", func(e Event) {
+		mu.Lock()
+		seen[e.Serial] = append(seen[e.Serial], e.Reason)
+		mu.Unlock()
+	})
+	serials := []string{"a", "b", "c", "d", "e"}
+	for i := 0; i < 20; i++ {
+		for _, serial := range serials {
+			bus.Publish(Event{Serial: serial, Reason: strings.Repeat("x", i)})
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, serial := range serials {
+		got := seen[serial]
+		if len(got) != 20 {
+			t.Fatalf("%s: %d events, want 20", serial, len(got))
+		}
+		for i, r := range got {
+			if len(r) != i {
+				t.Errorf("%s: event %d out of order", serial, i)
+				break
+			}
+		}
+	}
+	if st := bus.Stats().Subscribers[0]; st.Workers != 4 || st.Capacity != 4*64 {
+		t.Errorf("stats: %+v", st)
+	}
+}
+
+func TestBus_WorkersIsolateSerials(t *testing.T) {
+	bus := NewBusWithConfig(Config{BufferSize: 16, Workers: 2})
+	defer bus.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	other := make(chan string, 1)
+	bus.Subscribe("sub", func(e Event) {
+		if e.Serial == "slow" {
+			<-release
+			return
+		}
+		other <- e.Serial
+	})
+
+	// Find a serial handled by the other worker.
+	sub := bus.subs["sub"]
+	fast := ""
+	for i := 0; fast == ""; i++ {
+		if s := "dev" + strconv.Itoa(i); sub.queueFor(Event{Serial: s}) != sub.queueFor(Event{Serial: "slow"}) {
+			fast = s
+		}
+	}
+
+	bus.Publish(Event{Serial: "slow"})
+	bus.Publish(Event{Serial: fast})
+	select {
+	case got := <-other:
+		if got != fast {
+			t.Errorf("got %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a slow handler for one device held up another")
+	}
+}
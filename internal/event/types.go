@@ -14,15 +14,72 @@ const (
 	DeviceDisconnected Type = "device_disconnected"
 	DeviceStateChanged Type = "device_state_changed"
 	DeviceProperties   Type = "device_properties"
+
+	// DevicePropertiesChanged carries, in Changes, only the properties that
+	// differ from the previous collection of the same device.
+	DevicePropertiesChanged Type = "device_properties_changed"
+
+	// SecurityPropChanged carries, in Changes, the changes of a
+	// DevicePropertiesChanged to security-relevant properties — developer
+	// options, ADB over the network, SELinux, verified boot, VPN — which
+	// are also part of it.
+	SecurityPropChanged Type = "security_prop_changed"
+
+	// ADBServerRestarted is published by the tracker when it reconnects to an
+	// ADB server that lost all previous transports (the server process was
+	// restarted). Serial is empty. It is followed by DeviceConnected for
+	// every device the new server lists, with OldState set for those known
+	// before, and DeviceDisconnected for the others.
+	ADBServerRestarted Type = "adb_server_restarted"
+
+	// ADBServerDown and ADBServerUp are published by the ADB server
+	// supervisor when a health check fails, with the error in Reason, and
+	// when the server answers again. Serial is empty.
+	ADBServerDown Type = "adb_server_down"
+	ADBServerUp   Type = "adb_server_up"
 )
 
 // Event represents a device lifecycle or property event.
 type Event struct {
-	Type      Type            `json:"type"`
-	Serial    string          `json:"serial"`
-	Device    *adb.Device     `json:"device,omitempty"`
-	OldState  adb.DeviceState `json:"old_state,omitempty"`
-	NewState  adb.DeviceState `json:"new_state,omitempty"`
-	Props     map[string]string `json:"props,omitempty"`
-	Timestamp time.Time       `json:"timestamp"`
+	Type      Type                  `json:"type"`
+	Serial    string                `json:"serial"`
+	Device    *adb.Device           `json:"device,omitempty"`
+	OldState  adb.DeviceState       `json:"old_state,omitempty"`
+	NewState  adb.DeviceState       `json:"new_state,omitempty"`
+	Props     map[string]string     `json:"props,omitempty"`
+	Changes   map[string]PropChange `json:"changes,omitempty"`
+	Timestamp time.Time             `json:"timestamp"`
+
+	// Reason says why, for ADBServerDown.
+	Reason string `json:"reason,omitempty"`
+}
+
+// PropChange is the old and new value of a device property. An empty
+// value means the property was absent.
+type PropChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// DiffProps returns the properties whose value differs between old and
+// cur, or nil if none does.
+func DiffProps(old, cur map[string]string) map[string]PropChange {
+	var changes map[string]PropChange
+	add := func(key, o, n string) {
+		if changes == nil {
+			changes = make(map[string]PropChange)
+		}
+		changes[key] = PropChange{Old: o, New: n}
+	}
+	for k, v := range cur {
+		if o := old[k]; o != v {
+			add(k, o, v)
+		}
+	}
+	for k, o := range old {
+		if _, ok := cur[k]; !ok && o != "" {
+			add(k, o, "")
+		}
+	}
+	return changes
 }
@@ -0,0 +1,577 @@
+// Package graphql is a small, dependency-free GraphQL executor for
+// read-only queries. It supports the query language a dashboard needs —
+// nested selections, aliases, arguments, variables, named and inline
+// fragments, @skip/@include — over a schema of objects whose fields are
+// resolved by Go functions. Mutations, subscriptions and introspection
+// queries are not supported; Schema.SDL describes the schema instead.
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxDepth bounds selection nesting so a query cannot fan out without
+	// limit through cyclic object types.
+	maxDepth = 12
+	// maxErrors caps the errors reported for one request.
+	maxErrors = 50
+)
+
+// Scalar type names.
+const (
+	String  = "String"
+	Int     = "Int"
+	Float   = "Float"
+	Boolean = "Boolean"
+)
+
+// Object is a GraphQL object type.
+type Object struct {
+	Name        string
+	Description string
+	Fields      map[string]*Field
+}
+
+// Field is a field of an object type. Exactly one of Type (object) or
+// Scalar is set.
+type Field struct {
+	Type   *Object
+	Scalar string
+	List   bool
+	// Args declares accepted arguments and their types, e.g. "String!".
+	Args        map[string]string
+	Description string
+	// Resolve computes the value from the parent value. When nil, the
+	// field is read from the parent: a map key, or the struct field whose
+	// json tag matches the field name.
+	Resolve func(source any, args Args) (any, error)
+}
+
+// Args are a field's coerced argument values.
+type Args map[string]any
+
+// String returns a string argument, or def if it was not given.
+func (a Args) String(name, def string) string {
+	if s, ok := a[name].(string); ok {
+		return s
+	}
+	return def
+}
+
+// Int returns an integer argument, or def if it was not given.
+func (a Args) Int(name string, def int) int {
+	switch v := a[name].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return def
+}
+
+// Schema is an executable schema.
+type Schema struct {
+	Query *Object
+}
+
+// Request is a GraphQL-over-HTTP request body.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Response is the result of executing a request.
+type Response struct {
+	Data   any     `json:"data"`
+	Errors []Error `json:"errors,omitempty"`
+}
+
+// Error is a request or field error.
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// Execute runs the request against the schema. Request errors (syntax,
+// unknown operation, invalid variables) yield a nil Data; field errors
+// null the failing field and are reported alongside the data.
+func (s *Schema) Execute(req Request) Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	vars, err := coerceVariables(op, req.Variables)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	ex := &executor{doc: doc, vars: vars}
+	data := ex.selectionSet(s.Query, nil, op.selection, nil, 0)
+	return Response{Data: data, Errors: ex.errs}
+}
+
+func (d *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(d.operations) > 1 {
+			return nil, fmt.Errorf("operationName is required when the document has several operations")
+		}
+		return d.operations[0], nil
+	}
+	for _, op := range d.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+func coerceVariables(op *operation, in map[string]any) (map[string]any, error) {
+	vars := make(map[string]any, len(op.variables))
+	for _, v := range op.variables {
+		val, ok := in[v.name]
+		switch {
+		case ok && val != nil:
+			vars[v.name] = val
+		case ok:
+			if v.required {
+				return nil, fmt.Errorf("variable $%s of type %s must not be null", v.name, v.typ)
+			}
+			vars[v.name] = nil
+		case v.hasDef:
+			vars[v.name] = resolveValue(v.def, nil)
+		case v.required:
+			return nil, fmt.Errorf("variable $%s of type %s was not provided", v.name, v.typ)
+		}
+	}
+	return vars, nil
+}
+
+// resolveValue substitutes variables in an input value.
+func resolveValue(v value, vars map[string]any) any {
+	switch v := v.(type) {
+	case varRef:
+		return vars[string(v)]
+	case enumValue:
+		return string(v)
+	case []value:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = resolveValue(e, vars)
+		}
+		return out
+	case map[string]value:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[k] = resolveValue(e, vars)
+		}
+		return out
+	}
+	return v
+}
+
+type executor struct {
+	doc  *document
+	vars map[string]any
+	errs []Error
+}
+
+func (ex *executor) fail(path []any, format string, args ...any) {
+	if len(ex.errs) < maxErrors {
+		ex.errs = append(ex.errs, Error{Message: fmt.Sprintf(format, args...), Path: append([]any(nil), path...)})
+	}
+}
+
+// selectionSet resolves sels against obj with source as the parent value.
+func (ex *executor) selectionSet(obj *Object, source any, sels []selection, path []any, depth int) any {
+	if depth >= maxDepth {
+		ex.fail(path, "query exceeds the maximum depth of %d", maxDepth)
+		return nil
+	}
+	out := &orderedObject{}
+	ex.collect(obj, source, sels, path, depth, out, map[string]bool{})
+	return out
+}
+
+func (ex *executor) collect(obj *Object, source any, sels []selection, path []any, depth int, out *orderedObject, visited map[string]bool) {
+	for _, sel := range sels {
+		if !ex.included(sel.directives) {
+			continue
+		}
+
+		switch {
+		case sel.spread != "":
+			f, ok := ex.doc.fragments[sel.spread]
+			if !ok {
+				ex.fail(path, "unknown fragment %q", sel.spread)
+				continue
+			}
+			if visited[f.name] {
+				ex.fail(path, "fragment %q spreads itself", f.name)
+				continue
+			}
+			if f.on != obj.Name {
+				continue
+			}
+			visited[f.name] = true
+			ex.collect(obj, source, f.selection, path, depth, out, visited)
+			delete(visited, f.name)
+			continue
+		case sel.inline != nil:
+			if sel.inline.on == "" || sel.inline.on == obj.Name {
+				ex.collect(obj, source, sel.inline.selection, path, depth, out, visited)
+			}
+			continue
+		}
+
+		key := sel.name
+		if sel.alias != "" {
+			key = sel.alias
+		}
+		if out.has(key) {
+			// The spec merges identical selections; dashboards rarely send
+			// them, so the first one wins.
+			continue
+		}
+		fieldPath := append(path, key)
+
+		if sel.name == "__typename" {
+			out.set(key, obj.Name)
+			continue
+		}
+		f, ok := obj.Fields[sel.name]
+		if !ok {
+			ex.fail(fieldPath, "type %s has no field %q", obj.Name, sel.name)
+			continue
+		}
+		out.set(key, ex.field(f, source, sel, fieldPath, depth))
+	}
+}
+
+func (ex *executor) included(ds []directive) bool {
+	for _, d := range ds {
+		var cond bool
+		for _, a := range d.args {
+			if a.name == "if" {
+				cond, _ = resolveValue(a.val, ex.vars).(bool)
+			}
+		}
+		switch d.name {
+		case "skip":
+			if cond {
+				return false
+			}
+		case "include":
+			if !cond {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (ex *executor) field(f *Field, source any, sel selection, path []any, depth int) any {
+	if f.Type != nil && sel.children == nil {
+		ex.fail(path, "field %q of type %s must have a selection", sel.name, f.Type.Name)
+		return nil
+	}
+	if f.Type == nil && sel.children != nil {
+		ex.fail(path, "field %q is a scalar and cannot have a selection", sel.name)
+		return nil
+	}
+
+	args := make(Args, len(sel.args))
+	for _, a := range sel.args {
+		if _, ok := f.Args[a.name]; !ok {
+			ex.fail(path, "unknown argument %q on field %q", a.name, sel.name)
+			return nil
+		}
+		args[a.name] = resolveValue(a.val, ex.vars)
+	}
+	for name, typ := range f.Args {
+		if strings.HasSuffix(typ, "!") && args[name] == nil {
+			ex.fail(path, "argument %q of type %s is required", name, typ)
+			return nil
+		}
+	}
+
+	var val any
+	if f.Resolve != nil {
+		var err error
+		if val, err = f.Resolve(source, args); err != nil {
+			ex.fail(path, "%v", err)
+			return nil
+		}
+	} else {
+		val = fieldValue(source, sel.name)
+	}
+	return ex.complete(f, val, sel, path, depth)
+}
+
+func (ex *executor) complete(f *Field, val any, sel selection, path []any, depth int) any {
+	if isNil(val) {
+		return nil
+	}
+	if f.List {
+		rv := reflect.ValueOf(val)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			ex.fail(path, "field %q: expected a list, got %T", sel.name, val)
+			return nil
+		}
+		items := make([]any, rv.Len())
+		for i := range items {
+			items[i] = ex.completeItem(f, rv.Index(i).Interface(), sel, append(path, i), depth)
+		}
+		return items
+	}
+	return ex.completeItem(f, val, sel, path, depth)
+}
+
+func (ex *executor) completeItem(f *Field, val any, sel selection, path []any, depth int) any {
+	if isNil(val) {
+		return nil
+	}
+	if f.Type == nil {
+		return val
+	}
+	return ex.selectionSet(f.Type, val, sel.children, path, depth+1)
+}
+
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// fieldValue is the default resolver.
+func fieldValue(source any, name string) any {
+	if m, ok := source.(map[string]any); ok {
+		return m[name]
+	}
+	rv := reflect.ValueOf(source)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	idx, ok := jsonFields(rv.Type())[name]
+	if !ok {
+		return nil
+	}
+	return rv.FieldByIndex(idx).Interface()
+}
+
+var jsonFieldCache sync.Map // reflect.Type -> map[string][]int
+
+// jsonFields maps json names to field indexes, including fields promoted
+// from embedded structs.
+func jsonFields(t reflect.Type) map[string][]int {
+	if m, ok := jsonFieldCache.Load(t); ok {
+		return m.(map[string][]int)
+	}
+	m := make(map[string][]int)
+	walkJSONFields(t, nil, func(name string, sf reflect.StructField, index []int) {
+		if _, dup := m[name]; !dup {
+			m[name] = index
+		}
+	})
+	jsonFieldCache.Store(t, m)
+	return m
+}
+
+func walkJSONFields(t reflect.Type, prefix []int, fn func(name string, sf reflect.StructField, index []int)) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		index := append(append([]int(nil), prefix...), i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			walkJSONFields(sf.Type, index, fn)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fn(name, sf, index)
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// ScalarFields derives scalar fields from the json tags of a struct type,
+// so an object can expose the same names as the REST API. Fields of
+// non-scalar type are skipped; declare those explicitly.
+func ScalarFields(v any) map[string]*Field {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	fields := make(map[string]*Field)
+	walkJSONFields(t, nil, func(name string, sf reflect.StructField, _ []int) {
+		ft, list := sf.Type, false
+		if ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.Uint8 {
+			ft, list = ft.Elem(), true
+		}
+		if scalar := scalarName(ft); scalar != "" {
+			fields[name] = &Field{Scalar: scalar, List: list}
+		}
+	})
+	return fields
+}
+
+func scalarName(t reflect.Type) string {
+	if t == timeType {
+		return String
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return String
+	case reflect.Bool:
+		return Boolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Int
+	case reflect.Float32, reflect.Float64:
+		return Float
+	}
+	return ""
+}
+
+// SDL renders the schema in GraphQL schema definition language.
+func (s *Schema) SDL() string {
+	objects := map[string]*Object{}
+	var walk func(o *Object)
+	walk = func(o *Object) {
+		if _, seen := objects[o.Name]; seen {
+			return
+		}
+		objects[o.Name] = o
+		for _, f := range o.Fields {
+			if f.Type != nil {
+				walk(f.Type)
+			}
+		}
+	}
+	walk(s.Query)
+
+	names := make([]string, 0, len(objects))
+	for n := range objects {
+		if n != s.Query.Name {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	names = append([]string{s.Query.Name}, names...)
+
+	var b strings.Builder
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		o := objects[n]
+		if o.Description != "" {
+			fmt.Fprintf(&b, "# %s\n", o.Description)
+		}
+		fmt.Fprintf(&b, "type %s {\n", o.Name)
+		for _, fn := range sortedNames(o.Fields) {
+			f := o.Fields[fn]
+			if f.Description != "" {
+				fmt.Fprintf(&b, "  # %s\n", f.Description)
+			}
+			b.WriteString("  " + fn)
+			if len(f.Args) > 0 {
+				var args []string
+				for _, an := range sortedNames(f.Args) {
+					args = append(args, an+": "+f.Args[an])
+				}
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			typ := f.Scalar
+			if f.Type != nil {
+				typ = f.Type.Name
+			}
+			if f.List {
+				typ = "[" + typ + "]"
+			}
+			b.WriteString(": " + typ + "\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// orderedObject is a JSON object that keeps the query's field order.
+type orderedObject struct {
+	keys   []string
+	values []any
+}
+
+func (o *orderedObject) has(key string) bool {
+	for _, k := range o.keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *orderedObject) set(key string, v any) {
+	o.keys = append(o.keys, key)
+	o.values = append(o.values, v)
+}
+
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		kb, _ := json.Marshal(k)
+		b.Write(kb)
+		b.WriteByte(':')
+		vb, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(vb)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
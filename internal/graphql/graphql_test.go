@@ -0,0 +1,114 @@
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testItem struct {
+	ID    string   `json:"id"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+func testSchema() *Schema {
+	item := &Object{Name: "Item", Fields: ScalarFields(testItem{})}
+	parent := &Object{Name: "Parent", Fields: map[string]*Field{
+		"name": {Scalar: String},
+		"items": {Type: item, List: true, Args: map[string]string{"limit": Int},
+			Resolve: func(_ any, args Args) (any, error) {
+				items := []testItem{{ID: "a", Count: 1, Tags: []string{"x"}}, {ID: "b", Count: 2}}
+				return items[:min(args.Int("limit", 2), 2)], nil
+			}},
+	}}
+	parent.Fields["self"] = &Field{Type: parent, Resolve: func(src any, _ Args) (any, error) { return src, nil }}
+
+	return &Schema{Query: &Object{Name: "Query", Fields: map[string]*Field{
+		"parent": {Type: parent, Args: map[string]string{"name": "String!"},
+			Resolve: func(_ any, args Args) (any, error) {
+				return map[string]any{"name": args.String("name", "")}, nil
+			}},
+		"broken": {Scalar: String, Resolve: func(any, Args) (any, error) {
+			return nil, errors.New("boom")
+		}},
+	}}}
+}
+
+func run(t *testing.T, req Request) string {
+	t.Helper()
+	b, err := json.Marshal(testSchema().Execute(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestExecute(t *testing.T) {
+	got := run(t, Request{
+		Query: `query Q($n: String!, $lim: Int = 1) {
+			parent(name: $n) {
+				__typename
+				name
+				first: items(limit: $lim) { id count tags }
+				all: items { ...ItemID }
+			}
+		}
+		fragment ItemID on Item { id }`,
+		Variables: map[string]any{"n": "p1"},
+	})
+	want := `{"data":{"parent":{"__typename":"Parent","name":"p1",` +
+		`"first":[{"id":"a","count":1,"tags":["x"]}],"all":[{"id":"a"},{"id":"b"}]}}}`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestExecute_Directives(t *testing.T) {
+	got := run(t, Request{
+		Query:     `query($skip: Boolean!) { parent(name: "x") { name @skip(if: $skip) ... on Parent { items @include(if: false) { id } } } }`,
+		Variables: map[string]any{"skip": true},
+	})
+	if want := `{"data":{"parent":{}}}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestExecute_Errors(t *testing.T) {
+	tests := []struct {
+		name, query string
+		want        string
+	}{
+		{"syntax", `{ parent(name: "x") { name }`, "syntax error"},
+		{"mutation", `mutation { x }`, "not supported"},
+		{"unknown field", `{ parent(name: "x") { nope } }`, "has no field"},
+		{"missing arg", `{ parent { name } }`, "is required"},
+		{"missing selection", `{ parent(name: "x") }`, "must have a selection"},
+		{"scalar selection", `{ broken { x } }`, "cannot have a selection"},
+		{"resolver", `{ broken }`, "boom"},
+		{"missing variable", `query($n: String!) { parent(name: $n) { name } }`, "was not provided"},
+		{"depth", `{ parent(name: "x") { self { self { self { self { self { self { self { self { self { self { self { self { name } } } } } } } } } } } } } }`, "maximum depth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := run(t, Request{Query: tt.query})
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got %s, want error containing %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchema_SDL(t *testing.T) {
+	sdl := testSchema().SDL()
+	for _, want := range []string{
+		"type Query {\n  broken: String\n  parent(name: String!): Parent\n}",
+		"  items(limit: Int): [Item]",
+		"  tags: [String]",
+	} {
+		if !strings.Contains(sdl, want) {
+			t.Errorf("SDL missing %q:\n%s", want, sdl)
+		}
+	}
+}
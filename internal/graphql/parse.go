@@ -0,0 +1,513 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxQueryLength bounds the query text accepted by Parse.
+const maxQueryLength = 64 << 10
+
+// document is a parsed GraphQL request document.
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	name      string
+	variables []variableDef
+	selection []selection
+}
+
+type variableDef struct {
+	name     string
+	typ      string
+	def      value
+	hasDef   bool
+	required bool
+}
+
+type fragment struct {
+	name      string
+	on        string
+	selection []selection
+}
+
+// selection is a field, a fragment spread (spread != "") or an inline
+// fragment (inline != nil).
+type selection struct {
+	alias      string
+	name       string
+	args       []argument
+	directives []directive
+	children   []selection
+
+	spread string
+	inline *fragment
+}
+
+type argument struct {
+	name string
+	val  value
+}
+
+type directive struct {
+	name string
+	args []argument
+}
+
+// value is an unresolved input value: literals are stored as their Go
+// equivalents, variables as varRef.
+type value any
+
+type varRef string
+
+type enumValue string
+
+// syntaxError is a query parse failure.
+type syntaxError struct {
+	pos int
+	msg string
+}
+
+func (e *syntaxError) Error() string {
+	return fmt.Sprintf("syntax error at offset %d: %s", e.pos, e.msg)
+}
+
+// parse parses a query document. Only query operations are accepted.
+func parse(src string) (doc *document, err error) {
+	if len(src) > maxQueryLength {
+		return nil, fmt.Errorf("query exceeds %d bytes", maxQueryLength)
+	}
+	if !utf8.ValidString(src) {
+		return nil, &syntaxError{0, "query is not valid UTF-8"}
+	}
+	p := &parser{src: src}
+	defer func() {
+		if r := recover(); r != nil {
+			se, ok := r.(*syntaxError)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, se
+		}
+	}()
+	p.next()
+	return p.document(), nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type parser struct {
+	src string
+	pos int
+
+	kind tokenKind
+	text string
+	at   int
+}
+
+func (p *parser) fail(format string, args ...any) {
+	panic(&syntaxError{p.at, fmt.Sprintf(format, args...)})
+}
+
+// next advances to the next token, skipping whitespace, commas and comments.
+func (p *parser) next() {
+skip:
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			break skip
+		}
+	}
+	p.at = p.pos
+	if p.pos >= len(p.src) {
+		p.kind, p.text = tokEOF, ""
+		return
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case strings.IndexByte("{}()[]:!$=@", c) >= 0:
+		p.kind, p.text = tokPunct, string(c)
+		p.pos++
+	case c == '.':
+		if !strings.HasPrefix(p.src[p.pos:], "...") {
+			p.fail("unexpected %q", ".")
+		}
+		p.kind, p.text = tokPunct, "..."
+		p.pos += 3
+	case c == '_' || isLetter(c):
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.kind, p.text = tokName, p.src[start:p.pos]
+	case c == '-' || isDigit(c):
+		p.number()
+	case c == '"':
+		p.string()
+	default:
+		p.fail("unexpected character %q", c)
+	}
+}
+
+func (p *parser) number() {
+	start := p.pos
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits := func() {
+		begin := p.pos
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+		if p.pos == begin {
+			p.fail("malformed number")
+		}
+	}
+	digits()
+	p.kind = tokInt
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		p.pos++
+		digits()
+		p.kind = tokFloat
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		digits()
+		p.kind = tokFloat
+	}
+	p.text = p.src[start:p.pos]
+}
+
+func (p *parser) string() {
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		if end < 0 {
+			p.fail("unterminated block string")
+		}
+		p.kind, p.text = tokString, p.src[p.pos+3:p.pos+3+end]
+		p.pos += end + 6
+		return
+	}
+
+	var b strings.Builder
+	p.pos++
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			p.fail("unterminated string")
+		}
+		c := p.src[p.pos]
+		if c == '"' {
+			p.pos++
+			break
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			p.pos++
+			continue
+		}
+		if p.pos+1 >= len(p.src) {
+			p.fail("unterminated string")
+		}
+		esc := p.src[p.pos+1]
+		p.pos += 2
+		switch esc {
+		case '"', '\\', '/':
+			b.WriteByte(esc)
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			if p.pos+4 > len(p.src) {
+				p.fail("bad unicode escape")
+			}
+			r, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+			if err != nil {
+				p.fail("bad unicode escape")
+			}
+			b.WriteRune(rune(r))
+			p.pos += 4
+		default:
+			p.fail("bad escape \\%c", esc)
+		}
+	}
+	p.kind, p.text = tokString, b.String()
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+func (p *parser) peek(punct string) bool {
+	return p.kind == tokPunct && p.text == punct
+}
+
+func (p *parser) expect(punct string) {
+	if !p.peek(punct) {
+		p.fail("expected %q, got %q", punct, p.text)
+	}
+	p.next()
+}
+
+func (p *parser) name() string {
+	if p.kind != tokName {
+		p.fail("expected name, got %q", p.text)
+	}
+	n := p.text
+	p.next()
+	return n
+}
+
+func (p *parser) document() *document {
+	doc := &document{fragments: make(map[string]*fragment)}
+	for p.kind != tokEOF {
+		switch {
+		case p.peek("{"):
+			doc.operations = append(doc.operations, &operation{selection: p.selectionSet()})
+		case p.kind == tokName && p.text == "query":
+			p.next()
+			doc.operations = append(doc.operations, p.operation())
+		case p.kind == tokName && p.text == "fragment":
+			p.next()
+			f := p.fragmentDef()
+			if _, dup := doc.fragments[f.name]; dup {
+				p.fail("duplicate fragment %q", f.name)
+			}
+			doc.fragments[f.name] = f
+		case p.kind == tokName && (p.text == "mutation" || p.text == "subscription"):
+			p.fail("%s operations are not supported", p.text)
+		default:
+			p.fail("unexpected %q", p.text)
+		}
+	}
+	if len(doc.operations) == 0 {
+		p.fail("document has no operation")
+	}
+	return doc
+}
+
+func (p *parser) operation() *operation {
+	op := &operation{}
+	if p.kind == tokName {
+		op.name = p.name()
+	}
+	if p.peek("(") {
+		p.next()
+		for !p.peek(")") {
+			p.expect("$")
+			v := variableDef{name: p.name()}
+			p.expect(":")
+			v.typ = p.typeRef()
+			v.required = strings.HasSuffix(v.typ, "!")
+			if p.peek("=") {
+				p.next()
+				v.def, v.hasDef = p.value(true), true
+			}
+			op.variables = append(op.variables, v)
+		}
+		p.next()
+	}
+	p.directives() // Operation directives are accepted and ignored.
+	op.selection = p.selectionSet()
+	return op
+}
+
+func (p *parser) typeRef() string {
+	var t string
+	if p.peek("[") {
+		p.next()
+		t = "[" + p.typeRef() + "]"
+		p.expect("]")
+	} else {
+		t = p.name()
+	}
+	if p.peek("!") {
+		p.next()
+		t += "!"
+	}
+	return t
+}
+
+func (p *parser) fragmentDef() *fragment {
+	f := &fragment{name: p.name()}
+	if f.name == "on" {
+		p.fail("fragment cannot be named \"on\"")
+	}
+	if p.kind != tokName || p.text != "on" {
+		p.fail("expected \"on\"")
+	}
+	p.next()
+	f.on = p.name()
+	p.directives()
+	f.selection = p.selectionSet()
+	return f
+}
+
+func (p *parser) selectionSet() []selection {
+	p.expect("{")
+	var sels []selection
+	for !p.peek("}") {
+		if p.kind == tokEOF {
+			p.fail("unterminated selection set")
+		}
+		sels = append(sels, p.selection())
+	}
+	p.next()
+	if len(sels) == 0 {
+		p.fail("empty selection set")
+	}
+	return sels
+}
+
+func (p *parser) selection() selection {
+	if p.peek("...") {
+		p.next()
+		if p.kind == tokName && p.text != "on" {
+			s := selection{spread: p.name()}
+			s.directives = p.directives()
+			return s
+		}
+		f := &fragment{}
+		if p.kind == tokName && p.text == "on" {
+			p.next()
+			f.on = p.name()
+		}
+		s := selection{inline: f}
+		s.directives = p.directives()
+		f.selection = p.selectionSet()
+		return s
+	}
+
+	s := selection{name: p.name()}
+	if p.peek(":") {
+		p.next()
+		s.alias, s.name = s.name, p.name()
+	}
+	s.args = p.arguments()
+	s.directives = p.directives()
+	if p.peek("{") {
+		s.children = p.selectionSet()
+	}
+	return s
+}
+
+func (p *parser) arguments() []argument {
+	if !p.peek("(") {
+		return nil
+	}
+	p.next()
+	var args []argument
+	for !p.peek(")") {
+		a := argument{name: p.name()}
+		p.expect(":")
+		a.val = p.value(false)
+		args = append(args, a)
+	}
+	p.next()
+	return args
+}
+
+func (p *parser) directives() []directive {
+	var ds []directive
+	for p.peek("@") {
+		p.next()
+		ds = append(ds, directive{name: p.name(), args: p.arguments()})
+	}
+	return ds
+}
+
+func (p *parser) value(constant bool) value {
+	switch p.kind {
+	case tokPunct:
+		switch p.text {
+		case "$":
+			if constant {
+				p.fail("variable not allowed here")
+			}
+			p.next()
+			return varRef(p.name())
+		case "[":
+			p.next()
+			list := []value{}
+			for !p.peek("]") {
+				if p.kind == tokEOF {
+					p.fail("unterminated list")
+				}
+				list = append(list, p.value(constant))
+			}
+			p.next()
+			return list
+		case "{":
+			p.next()
+			obj := map[string]value{}
+			for !p.peek("}") {
+				k := p.name()
+				p.expect(":")
+				obj[k] = p.value(constant)
+			}
+			p.next()
+			return obj
+		}
+	case tokInt:
+		n, err := strconv.Atoi(p.text)
+		if err != nil {
+			p.fail("integer out of range")
+		}
+		p.next()
+		return n
+	case tokFloat:
+		f, err := strconv.ParseFloat(p.text, 64)
+		if err != nil {
+			p.fail("malformed float")
+		}
+		p.next()
+		return f
+	case tokString:
+		s := p.text
+		p.next()
+		return s
+	case tokName:
+		n := p.text
+		p.next()
+		switch n {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return enumValue(n)
+	}
+	p.fail("expected value, got %q", p.text)
+	return nil
+}
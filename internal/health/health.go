@@ -0,0 +1,315 @@
+// Package health turns recent device signals (ADB state, connection flaps,
+// capture errors and idleness, shell latency, battery, temperature and
+// thermal throttling) into a 0–100 score and status with human-readable
+// reasons, so the worst devices in a large lab stand out.
+package health
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FlapWindow is how far back connection flaps are counted.
+	FlapWindow = 10 * time.Minute
+
+	// MaxScore is the score of a device with nothing to report.
+	MaxScore = 100
+
+	// IdleAfter is how long a capture may see no traffic before the device
+	// loses points for it.
+	IdleAfter = 5 * time.Minute
+)
+
+// Status buckets a score.
+type Status string
+
+const (
+	Healthy   Status = "healthy"
+	Degraded  Status = "degraded"
+	Unhealthy Status = "unhealthy"
+)
+
+// StatusOf returns the status of score: healthy from 80, degraded from 50,
+// unhealthy below.
+func StatusOf(score int) Status {
+	switch {
+	case score >= 80:
+		return Healthy
+	case score >= 50:
+		return Degraded
+	default:
+		return Unhealthy
+	}
+}
+
+// Battery is the subset of `dumpsys battery` the score looks at.
+type Battery struct {
+	Level        int     `json:"level"`
+	TemperatureC float64 `json:"temperature_c"`
+	Plugged      bool    `json:"plugged"`
+	// Status is "charging", "discharging", "not_charging", "full" or
+	// "unknown".
+	Status string `json:"status,omitempty"`
+}
+
+// batteryStatus names the BatteryManager.BATTERY_STATUS_* codes that
+// `dumpsys battery` prints.
+var batteryStatus = map[string]string{
+	"1": "unknown",
+	"2": "charging",
+	"3": "discharging",
+	"4": "not_charging",
+	"5": "full",
+}
+
+// ParseBattery extracts level, temperature, plug state and charging status
+// from `dumpsys battery` output. ok is false if no level was found.
+func ParseBattery(out string) (b Battery, ok bool) {
+	for _, line := range strings.Split(out, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		switch key {
+		case "level":
+			if n, err := strconv.Atoi(value); err == nil {
+				b.Level = n
+				ok = true
+			}
+		case "temperature":
+			// Reported in tenths of a degree Celsius.
+			if n, err := strconv.Atoi(value); err == nil {
+				b.TemperatureC = float64(n) / 10
+			}
+		case "status":
+			b.Status = batteryStatus[value]
+		case "AC powered", "USB powered", "Wireless powered":
+			if value == "true" {
+				b.Plugged = true
+			}
+		}
+	}
+	return b, ok
+}
+
+// thermalStatus names the PowerManager.THERMAL_STATUS_* levels that
+// `dumpsys thermalservice` prints.
+var thermalStatus = []string{"none", "light", "moderate", "severe", "critical", "emergency", "shutdown"}
+
+// ParseThermalStatus extracts the current thermal status ("none" to
+// "shutdown") from `dumpsys thermalservice` output. ok is false if none was
+// found.
+func ParseThermalStatus(out string) (status string, ok bool) {
+	for _, line := range strings.Split(out, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found || strings.TrimSpace(key) != "Thermal Status" {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 0 || n >= len(thermalStatus) {
+			return "", false
+		}
+		return thermalStatus[n], true
+	}
+	return "", false
+}
+
+// Input is one observation of a device.
+type Input struct {
+	Now time.Time
+	// State is the ADB state of the device; devices that are not "device"
+	// are not probed, and only lose points for their state and flaps.
+	State string
+	// CaptureErrors is the cumulative capture error counter, or -1 if the
+	// device is not being captured.
+	CaptureErrors int64
+	// LastActivity is when the running capture last saw traffic; zero if
+	// the device is not being captured.
+	LastActivity time.Time
+	// ShellLatency is the round-trip time of the health probe; ShellErr is
+	// set if the probe failed.
+	ShellLatency time.Duration
+	ShellErr     error
+	// Battery is nil when unknown or not applicable (TV boxes, cars).
+	Battery *Battery
+	// Thermal is the thermal status, empty when unknown.
+	Thermal string
+}
+
+// Result is a device's computed health.
+type Result struct {
+	Score        int       `json:"score"`
+	Status       Status    `json:"status"`
+	Reasons      []string  `json:"reasons,omitempty"`
+	State        string    `json:"state,omitempty"`
+	LastActivity time.Time `json:"last_activity,omitempty"`
+	Flaps        int       `json:"flaps"`
+	ErrorRate    float64   `json:"error_rate_per_min"`
+	LatencyMs    int64     `json:"shell_latency_ms"`
+	Battery      *Battery  `json:"battery,omitempty"`
+	Thermal      string    `json:"thermal,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Score computes the health of a device from its signals. Each problem
+// subtracts a bounded penalty and adds a reason.
+func Score(flaps int, errorRate float64, in Input) Result {
+	r := Result{
+		Score:        MaxScore,
+		State:        in.State,
+		LastActivity: in.LastActivity,
+		Flaps:        flaps,
+		ErrorRate:    errorRate,
+		LatencyMs:    in.ShellLatency.Milliseconds(),
+		Battery:      in.Battery,
+		Thermal:      in.Thermal,
+		UpdatedAt:    in.Now,
+	}
+	penalize := func(points int, format string, args ...any) {
+		r.Score -= points
+		r.Reasons = append(r.Reasons, fmt.Sprintf(format, args...))
+	}
+
+	if in.State != "" && in.State != "device" {
+		penalize(60, "device is %s", in.State)
+	}
+
+	if flaps > 0 {
+		penalize(min(flaps*10, 40), "%d connection flaps in the last %s", flaps, FlapWindow)
+	}
+
+	if errorRate >= 1 {
+		penalize(min(int(errorRate)*2, 30), "%.0f capture errors/min", errorRate)
+	}
+	if !in.LastActivity.IsZero() {
+		if idle := in.Now.Sub(in.LastActivity); idle >= IdleAfter {
+			penalize(10, "no captured traffic for %s", idle.Round(time.Minute))
+		}
+	}
+
+	switch {
+	case in.ShellErr != nil:
+		penalize(40, "shell probe failed: %v", in.ShellErr)
+	case in.ShellLatency >= 2*time.Second:
+		penalize(25, "slow shell (%s)", in.ShellLatency.Round(time.Millisecond))
+	case in.ShellLatency >= 500*time.Millisecond:
+		penalize(10, "slow shell (%s)", in.ShellLatency.Round(time.Millisecond))
+	}
+
+	if b := in.Battery; b != nil {
+		switch {
+		case b.Level < 5 && !b.Plugged:
+			penalize(25, "battery critical (%d%%)", b.Level)
+		case b.Level < 15 && !b.Plugged:
+			penalize(15, "battery low (%d%%)", b.Level)
+		}
+		switch {
+		case b.TemperatureC >= 50:
+			penalize(30, "overheating (%.1f°C)", b.TemperatureC)
+		case b.TemperatureC >= 45:
+			penalize(15, "running hot (%.1f°C)", b.TemperatureC)
+		}
+	}
+
+	switch in.Thermal {
+	case "moderate":
+		penalize(10, "thermal throttling (%s)", in.Thermal)
+	case "severe":
+		penalize(25, "thermal throttling (%s)", in.Thermal)
+	case "critical", "emergency", "shutdown":
+		penalize(40, "thermal throttling (%s)", in.Thermal)
+	}
+
+	r.Score = max(r.Score, 0)
+	r.Status = StatusOf(r.Score)
+	return r
+}
+
+// Tracker keeps the per-device history the score needs (flap timestamps,
+// the previous error counter) and the latest result. It is safe for
+// concurrent use.
+type Tracker struct {
+	mu      sync.Mutex
+	devices map[string]*deviceState
+}
+
+type deviceState struct {
+	flaps      []time.Time
+	lastErrors int64
+	lastAt     time.Time
+	result     *Result
+}
+
+// NewTracker creates an empty tracker.
+func NewTracker() *Tracker {
+	return &Tracker{devices: make(map[string]*deviceState)}
+}
+
+func (t *Tracker) state(serial string) *deviceState {
+	d, ok := t.devices[serial]
+	if !ok {
+		d = &deviceState{lastErrors: -1}
+		t.devices[serial] = d
+	}
+	return d
+}
+
+// RecordFlap notes a disconnect or state change of the device at ts.
+func (t *Tracker) RecordFlap(serial string, ts time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := t.state(serial)
+	d.flaps = append(d.flaps, ts)
+}
+
+// Update scores a new observation and stores the result. prev is the
+// status of the previous result, empty for the first.
+func (t *Tracker) Update(serial string, in Input) (r Result, prev Status) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := t.state(serial)
+
+	cutoff := in.Now.Add(-FlapWindow)
+	kept := d.flaps[:0]
+	for _, ts := range d.flaps {
+		if ts.After(cutoff) {
+			kept = append(kept, ts)
+		}
+	}
+	d.flaps = kept
+
+	// Error rate over the interval since the previous observation. A reset
+	// counter (new capture) or a stopped capture yields no rate.
+	var rate float64
+	if in.CaptureErrors >= 0 && d.lastErrors >= 0 && in.CaptureErrors >= d.lastErrors {
+		if mins := in.Now.Sub(d.lastAt).Minutes(); mins > 0 {
+			rate = float64(in.CaptureErrors-d.lastErrors) / mins
+		}
+	}
+	d.lastErrors = in.CaptureErrors
+	d.lastAt = in.Now
+
+	if d.result != nil {
+		prev = d.result.Status
+	}
+	r = Score(len(d.flaps), rate, in)
+	d.result = &r
+	return r, prev
+}
+
+// Get returns the latest result for the device.
+func (t *Tracker) Get(serial string) (Result, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, ok := t.devices[serial]
+	if !ok || d.result == nil {
+		return Result{}, false
+	}
+	return *d.result, true
+}
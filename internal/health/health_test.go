@@ -0,0 +1,122 @@
+package health
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBattery(t *testing.T) {
+	out := `Current Battery Service state:
+  AC powered: false
+  USB powered: true
+  Wireless powered: false
+  status: 2
+  level: 12
+  temperature: 463
+`
+	b, ok := ParseBattery(out)
+	if !ok {
+		t.Fatal("no level parsed")
+	}
+	if b.Level != 12 || b.TemperatureC != 46.3 || !b.Plugged || b.Status != "charging" {
+		t.Errorf("got %+v", b)
+	}
+	if _, ok := ParseBattery("Can't find service: battery"); ok {
+		t.Error("expected ok=false without a level")
+	}
+}
+
+func TestScore(t *testing.T) {
+	now := time.Now()
+	healthy := Score(0, 0, Input{Now: now, ShellLatency: 40 * time.Millisecond, Battery: &Battery{Level: 80, TemperatureC: 30}})
+	if healthy.Score != MaxScore || len(healthy.Reasons) != 0 {
+		t.Errorf("healthy device: %+v", healthy)
+	}
+
+	sick := Score(2, 10, Input{
+		Now:          now,
+		ShellLatency: 3 * time.Second,
+		Battery:      &Battery{Level: 3, TemperatureC: 51},
+	})
+	// 20 (flaps) + 20 (errors) + 25 (latency) + 25 (battery) + 30 (heat) > 100
+	if sick.Score != 0 {
+		t.Errorf("score: got %d, want 0", sick.Score)
+	}
+	if len(sick.Reasons) != 5 {
+		t.Errorf("reasons: %v", sick.Reasons)
+	}
+
+	failed := Score(0, 0, Input{Now: now, ShellErr: errors.New("device offline")})
+	if failed.Score != 60 || !strings.Contains(failed.Reasons[0], "device offline") {
+		t.Errorf("probe failure: %+v", failed)
+	}
+}
+
+func TestParseThermalStatus(t *testing.T) {
+	out := `IsStatusOverride: false
+ThermalEventListeners:
+	callbacks: 1
+Thermal Status: 3
+Cached temperatures:
+`
+	if got, ok := ParseThermalStatus(out); !ok || got != "severe" {
+		t.Errorf("got %q, %v", got, ok)
+	}
+	if _, ok := ParseThermalStatus("Can't find service: thermalservice"); ok {
+		t.Error("expected ok=false without a status")
+	}
+}
+
+func TestScore_StateIdleThermal(t *testing.T) {
+	now := time.Now()
+	offline := Score(0, 0, Input{Now: now, State: "offline"})
+	if offline.Score != 40 || offline.Status != Unhealthy || offline.Reasons[0] != "device is offline" {
+		t.Errorf("offline: %+v", offline)
+	}
+
+	idle := Score(0, 0, Input{Now: now, State: "device", LastActivity: now.Add(-12 * time.Minute), Thermal: "moderate"})
+	if idle.Score != 80 || idle.Status != Healthy || len(idle.Reasons) != 2 {
+		t.Errorf("idle and warm: %+v", idle)
+	}
+
+	hot := Score(0, 0, Input{Now: now, Thermal: "critical"})
+	if hot.Score != 60 || hot.Status != Degraded {
+		t.Errorf("critical thermal: %+v", hot)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker()
+	start := time.Now()
+
+	tr.RecordFlap("dev1", start.Add(-2*FlapWindow)) // too old to count
+	tr.RecordFlap("dev1", start.Add(-time.Minute))
+
+	r, prev := tr.Update("dev1", Input{Now: start, CaptureErrors: 100})
+	if r.Flaps != 1 || r.ErrorRate != 0 || r.Status != Healthy || prev != "" {
+		t.Errorf("first update: %+v, prev %q", r, prev)
+	}
+
+	r, prev = tr.Update("dev1", Input{Now: start.Add(30 * time.Second), CaptureErrors: 130})
+	if r.ErrorRate != 60 {
+		t.Errorf("error rate: got %v, want 60/min", r.ErrorRate)
+	}
+	if r.Status != Degraded || prev != Healthy {
+		t.Errorf("transition: %q -> %q", prev, r.Status)
+	}
+
+	// A restarted capture resets its counter; that is not a negative rate.
+	r, _ = tr.Update("dev1", Input{Now: start.Add(time.Minute), CaptureErrors: 0})
+	if r.ErrorRate != 0 {
+		t.Errorf("after reset: got %v", r.ErrorRate)
+	}
+
+	if got, ok := tr.Get("dev1"); !ok || got.Score != r.Score {
+		t.Errorf("Get: %+v, %v", got, ok)
+	}
+	if _, ok := tr.Get("dev2"); ok {
+		t.Error("unknown device should have no result")
+	}
+}
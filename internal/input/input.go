@@ -0,0 +1,247 @@
+// Package input turns tap, swipe, text and key actions, given as JSON or as
+// a small line-based script, into `input` commands for a device, so the
+// same interaction can be replayed during every capture.
+package input
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+const (
+	// MaxActions bounds one sequence.
+	MaxActions = 500
+	// MaxSleep bounds the sleeps of one sequence together.
+	MaxSleep = 5 * time.Minute
+	// MaxTextLen bounds the text typed by one action.
+	MaxTextLen = 1000
+)
+
+// Kind names an action.
+type Kind string
+
+const (
+	Tap   Kind = "tap"
+	Swipe Kind = "swipe"
+	Text  Kind = "text"
+	Key   Kind = "keyevent"
+	Sleep Kind = "sleep"
+)
+
+// Action is one step of a sequence. Tap uses X and Y; Swipe goes from X, Y
+// to X2, Y2 in DurationMs; Text types Text; Key sends Key, a key code
+// number or name such as ENTER or KEYCODE_BACK; Sleep waits DurationMs on
+// the host.
+type Action struct {
+	Type       Kind   `json:"type"`
+	X          int    `json:"x,omitempty"`
+	Y          int    `json:"y,omitempty"`
+	X2         int    `json:"x2,omitempty"`
+	Y2         int    `json:"y2,omitempty"`
+	DurationMs int    `json:"duration_ms,omitempty"`
+	Text       string `json:"text,omitempty"`
+	Key        string `json:"key,omitempty"`
+}
+
+// Validate checks the fields the action's type needs.
+func (a Action) Validate() error {
+	switch a.Type {
+	case Tap:
+		if a.X < 0 || a.Y < 0 {
+			return errors.New("tap coordinates must not be negative")
+		}
+	case Swipe:
+		if a.X < 0 || a.Y < 0 || a.X2 < 0 || a.Y2 < 0 {
+			return errors.New("swipe coordinates must not be negative")
+		}
+		if a.DurationMs < 0 {
+			return errors.New("swipe duration must not be negative")
+		}
+	case Text:
+		if a.Text == "" {
+			return errors.New("text is empty")
+		}
+		if len(a.Text) > MaxTextLen {
+			return fmt.Errorf("text is longer than %d bytes", MaxTextLen)
+		}
+		if strings.ContainsAny(a.Text, "\n\r\x00") {
+			return errors.New("text must be a single line")
+		}
+	case Key:
+		if _, err := keyCode(a.Key); err != nil {
+			return err
+		}
+	case Sleep:
+		if a.DurationMs <= 0 {
+			return errors.New("sleep needs a positive duration")
+		}
+	default:
+		return fmt.Errorf("unknown action %q", a.Type)
+	}
+	return nil
+}
+
+// Command returns the shell command performing the action, or "" for
+// Sleep, which the caller waits out itself. The action must be valid.
+func (a Action) Command() string {
+	switch a.Type {
+	case Tap:
+		return fmt.Sprintf("input tap %d %d", a.X, a.Y)
+	case Swipe:
+		if a.DurationMs > 0 {
+			return fmt.Sprintf("input swipe %d %d %d %d %d", a.X, a.Y, a.X2, a.Y2, a.DurationMs)
+		}
+		return fmt.Sprintf("input swipe %d %d %d %d", a.X, a.Y, a.X2, a.Y2)
+	case Text:
+		// input text reads %s as a space and stops at a literal one.
+		return "input text " + adb.ShellQuote(strings.ReplaceAll(a.Text, " ", "%s"))
+	case Key:
+		code, _ := keyCode(a.Key)
+		return "input keyevent " + code
+	}
+	return ""
+}
+
+// keyCode normalises a key code number or name: ENTER and KEYCODE_ENTER
+// both give KEYCODE_ENTER.
+func keyCode(key string) (string, error) {
+	if key == "" {
+		return "", errors.New("key is empty")
+	}
+	if n, err := strconv.Atoi(key); err == nil {
+		if n < 0 {
+			return "", fmt.Errorf("invalid key code %d", n)
+		}
+		return key, nil
+	}
+	name := strings.ToUpper(key)
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return "", fmt.Errorf("invalid key name %q", key)
+		}
+	}
+	if !strings.HasPrefix(name, "KEYCODE_") {
+		name = "KEYCODE_" + name
+	}
+	return name, nil
+}
+
+// Validate checks a sequence as a whole: its length, every action, and the
+// total time it sleeps.
+func Validate(actions []Action) error {
+	if len(actions) == 0 {
+		return errors.New("no actions")
+	}
+	if len(actions) > MaxActions {
+		return fmt.Errorf("more than %d actions", MaxActions)
+	}
+	var sleep time.Duration
+	for i, a := range actions {
+		if err := a.Validate(); err != nil {
+			return fmt.Errorf("action %d: %w", i+1, err)
+		}
+		if a.Type == Sleep {
+			sleep += time.Duration(a.DurationMs) * time.Millisecond
+		}
+	}
+	if sleep > MaxSleep {
+		return fmt.Errorf("sleeps add up to more than %s", MaxSleep)
+	}
+	return nil
+}
+
+// ParseScript parses a script of one action per line:
+//
+//	# log in
+//	tap 540 1200
+//	text user@example.com
+//	key TAB
+//	text "correct horse battery staple"
+//	key ENTER
+//	sleep 2000
+//	swipe 540 1600 540 400 300
+//
+// keyevent is accepted for key and wait for sleep. Text runs to the end of
+// the line; surrounding double quotes are dropped, so leading and trailing
+// spaces can be typed. Blank lines and lines starting with # are skipped.
+// The sequence is validated.
+func ParseScript(script string) ([]Action, error) {
+	var actions []Action
+	for n, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		a, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		if err := a.Validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		actions = append(actions, a)
+	}
+	return actions, Validate(actions)
+}
+
+func parseLine(line string) (Action, error) {
+	verb, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	switch strings.ToLower(verb) {
+	case "tap":
+		n, err := ints(rest, 2, 2)
+		if err != nil {
+			return Action{}, err
+		}
+		return Action{Type: Tap, X: n[0], Y: n[1]}, nil
+	case "swipe":
+		n, err := ints(rest, 4, 5)
+		if err != nil {
+			return Action{}, err
+		}
+		a := Action{Type: Swipe, X: n[0], Y: n[1], X2: n[2], Y2: n[3]}
+		if len(n) == 5 {
+			a.DurationMs = n[4]
+		}
+		return a, nil
+	case "text":
+		if len(rest) >= 2 && strings.HasPrefix(rest, `"`) && strings.HasSuffix(rest, `"`) {
+			rest = rest[1 : len(rest)-1]
+		}
+		return Action{Type: Text, Text: rest}, nil
+	case "key", "keyevent":
+		return Action{Type: Key, Key: rest}, nil
+	case "sleep", "wait":
+		n, err := ints(rest, 1, 1)
+		if err != nil {
+			return Action{}, err
+		}
+		return Action{Type: Sleep, DurationMs: n[0]}, nil
+	}
+	return Action{}, fmt.Errorf("unknown command %q", verb)
+}
+
+// ints parses between lo and hi space-separated integers.
+func ints(s string, lo, hi int) ([]int, error) {
+	fields := strings.Fields(s)
+	if len(fields) < lo || len(fields) > hi {
+		if lo == hi {
+			return nil, fmt.Errorf("want %d numbers, got %d", lo, len(fields))
+		}
+		return nil, fmt.Errorf("want %d to %d numbers, got %d", lo, hi, len(fields))
+	}
+	n := make([]int, len(fields))
+	for i, f := range fields {
+		v, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", f)
+		}
+		n[i] = v
+	}
+	return n, nil
+}
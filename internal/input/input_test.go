@@ -0,0 +1,69 @@
+package input
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseScript(t *testing.T) {
+	actions, err := ParseScript(`
+# log in
+tap 540 1200
+text user@example.com
+KEY tab
+text "it's a  secret "
+keyevent 66
+wait 1500
+swipe 540 1600 540 400 300
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"input tap 540 1200",
+		"input text 'user@example.com'",
+		"input keyevent KEYCODE_TAB",
+		`input text 'it'\''s%sa%s%ssecret%s'`,
+		"input keyevent 66",
+		"",
+		"input swipe 540 1600 540 400 300",
+	}
+	if len(actions) != len(want) {
+		t.Fatalf("got %d actions: %+v", len(actions), actions)
+	}
+	for i, a := range actions {
+		if got := a.Command(); got != want[i] {
+			t.Errorf("action %d: got %q, want %q", i+1, got, want[i])
+		}
+	}
+	if actions[5].Type != Sleep || actions[5].DurationMs != 1500 {
+		t.Errorf("wait = %+v", actions[5])
+	}
+}
+
+func TestParseScript_Errors(t *testing.T) {
+	for script, want := range map[string]string{
+		"tap 1":             "line 1: want 2 numbers",
+		"\nswipe 1 2 3":     "line 2: want 4 to 5 numbers",
+		"tap x 2":           `"x" is not a number`,
+		"key ENTER; reboot": "invalid key name",
+		"launch com.app":    `unknown command "launch"`,
+		"# nothing":         "no actions",
+		"sleep 400000":      "sleeps add up to more than",
+		"text":              "text is empty",
+	} {
+		_, err := ParseScript(script)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got %v, want %q", script, err, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate([]Action{{Type: Tap, X: 1, Y: 2}, {Type: "drag"}}); err == nil || !strings.Contains(err.Error(), "action 2") {
+		t.Errorf("got %v", err)
+	}
+	if err := Validate([]Action{{Type: Text, Text: "a\nb"}}); err == nil {
+		t.Error("multi-line text accepted")
+	}
+}
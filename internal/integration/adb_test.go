@@ -0,0 +1,250 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/bridge"
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/store"
+)
+
+func TestListDevices(t *testing.T) {
+	requireDevice(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	devices, err := testClient.ListDevices(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range devices {
+		if d.Serial == testSerial {
+			if !d.State.IsOnline() {
+				t.Fatalf("%s listed but state is %q", testSerial, d.State)
+			}
+			if d.Transport == "" {
+				t.Error("expected transport_id from devices-l")
+			}
+			return
+		}
+	}
+	t.Fatalf("%s not in device list %v", testSerial, devices)
+}
+
+func TestTrackDevices(t *testing.T) {
+	requireDevice(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := testClient.TrackDevices(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// The server pushes the current list immediately after OKAY.
+	payload, err := adb.ReadLengthPrefixed(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, d := range adb.ParseDeviceList(payload) {
+		if d.Serial == testSerial {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("initial track-devices payload does not include %s: %q", testSerial, payload)
+	}
+}
+
+func TestShell(t *testing.T) {
+	requireDevice(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out, err := testClient.Shell(ctx, testSerial, "echo integration-ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "integration-ok" {
+		t.Errorf("shell output: got %q", out)
+	}
+
+	sdk, err := testClient.GetDeviceProp(ctx, testSerial, "ro.build.version.sdk")
+	if err != nil || sdk == "" {
+		t.Errorf("getprop ro.build.version.sdk: %q, %v", sdk, err)
+	}
+}
+
+func TestShellV2(t *testing.T) {
+	requireDevice(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := testClient.ShellV2(ctx, testSerial, "echo out; echo err >&2; exit 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stdout != "out" || res.Stderr != "err" || res.ExitCode != 3 {
+		t.Errorf("result: %+v", res)
+	}
+	if !errors.Is(res.Err(), adb.ErrCommandFailed) {
+		t.Errorf("Err: %v", res.Err())
+	}
+}
+
+func TestShellStream(t *testing.T) {
+	requireDevice(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := testClient.OpenShellStream(ctx, testSerial, "for i in 1 2 3; do echo line$i; done")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	buf := make([]byte, 256)
+	var out strings.Builder
+	for {
+		n, err := stream.Read(buf)
+		out.Write(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+	if got := strings.Fields(out.String()); len(got) != 3 || got[2] != "line3" {
+		t.Errorf("stream output: %q", out.String())
+	}
+}
+
+func TestProcNetCapture(t *testing.T) {
+	requireDevice(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	engine := capture.NewEngine(testClient, testLogger(), testSerial, capture.ModeProcNet)
+	go engine.Run(ctx)
+
+	generateTraffic(ctx, t)
+
+	select {
+	case c := <-engine.Connections():
+		if c.Serial != testSerial || c.RemoteIP == "" || c.RemotePort == 0 {
+			t.Errorf("unexpected connection: %+v", c)
+		}
+	case <-ctx.Done():
+		t.Fatal("no connection observed via /proc/net")
+	}
+}
+
+func TestLogcatURLCapture(t *testing.T) {
+	requireDevice(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	engine := capture.NewEngine(testClient, testLogger(), testSerial, capture.ModeProcNet)
+	go engine.Run(ctx)
+
+	// Give the snooper time to clear logcat and open its stream.
+	time.Sleep(3 * time.Second)
+	if _, err := testClient.Shell(ctx, testSerial, `log -t OkHttp "--> POST https://integration.example.com/v2/token"`); err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		select {
+		case pkt := <-engine.Packets():
+			if pkt.HTTPHost != "integration.example.com" {
+				continue
+			}
+			if pkt.HTTPMethod != "POST" || pkt.HTTPPath != "/v2/token" {
+				t.Errorf("unexpected logcat packet: %+v", pkt)
+			}
+			if !strings.HasPrefix(pkt.Flags, "logcat:") {
+				t.Errorf("flags: got %q, want logcat: prefix", pkt.Flags)
+			}
+			return
+		case <-ctx.Done():
+			t.Fatal("logcat URL was not captured")
+		}
+	}
+}
+
+// TestAPICapture drives a capture through the HTTP API and validates what
+// ends up in the store and the JSON endpoints.
+func TestAPICapture(t *testing.T) {
+	requireDevice(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+
+	app := bridge.NewApp(testLogger(), bridge.Config{
+		ADBAddr:     testClient.Addr(),
+		StoreConfig: store.Config{MaxPackets: 1000, MaxConnections: 1000},
+	})
+	app.Startup(ctx)
+	defer app.Shutdown()
+
+	mux := http.NewServeMux()
+	app.RegisterRoutes(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	eventually(t, 20*time.Second, "device to appear in /api/devices", func() bool {
+		var devices []adb.Device
+		getJSON(t, srv.URL+"/api/devices", &devices)
+		for _, d := range devices {
+			if d.Serial == testSerial {
+				return true
+			}
+		}
+		return false
+	})
+
+	resp, err := http.Post(srv.URL+"/api/capture/start/"+testSerial, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("start capture: status %d", resp.StatusCode)
+	}
+
+	generateTraffic(ctx, t)
+
+	eventually(t, 60*time.Second, "connections in /api/connections/{serial}", func() bool {
+		var conns []capture.Connection
+		getJSON(t, srv.URL+"/api/connections/"+testSerial, &conns)
+		return len(conns) > 0
+	})
+
+	var status map[string]capture.CaptureStats
+	getJSON(t, srv.URL+"/api/capture/status", &status)
+	if st, ok := status[testSerial]; !ok || st.ConnCount == 0 {
+		t.Errorf("capture status for %s: %+v", testSerial, status)
+	}
+}
+
+func getJSON(t *testing.T, url string, v interface{}) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("decoding %s: %v", url, err)
+	}
+}
@@ -0,0 +1,9 @@
+// Package integration exercises the ADB client, capture engine and HTTP API
+// against a real ADB server and Android emulator. It is opt-in:
+//
+//	ADB_MONITOR_TEST_AVD=Pixel_API_34 go test -tags integration -v ./internal/integration/
+//
+// Set ADB_MONITOR_TEST_SERIAL instead to run against an already-booted
+// device or emulator. ADB_MONITOR_TEST_ADB_ADDR overrides the ADB server
+// address. Without either variable every test is skipped.
+package integration
@@ -0,0 +1,185 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+const (
+	// emulatorPort is the console port of the emulator we boot; its ADB
+	// serial is "emulator-<port>".
+	emulatorPort = 5580
+
+	bootTimeout = 5 * time.Minute
+)
+
+var (
+	// testSerial is the device every test runs against.
+	testSerial string
+	// testClient talks to the ADB server the device is attached to.
+	testClient *adb.Client
+	// skipReason is set when no device is configured.
+	skipReason string
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	testClient = adb.NewClient(os.Getenv("ADB_MONITOR_TEST_ADB_ADDR"))
+
+	serial := os.Getenv("ADB_MONITOR_TEST_SERIAL")
+	avd := os.Getenv("ADB_MONITOR_TEST_AVD")
+
+	switch {
+	case serial != "":
+		testSerial = serial
+	case avd != "":
+		stop, err := bootEmulator(avd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "integration: %v\n", err)
+			return 1
+		}
+		defer stop()
+		testSerial = fmt.Sprintf("emulator-%d", emulatorPort)
+	default:
+		skipReason = "set ADB_MONITOR_TEST_SERIAL or ADB_MONITOR_TEST_AVD to run integration tests"
+		return m.Run()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), bootTimeout)
+	defer cancel()
+	if err := waitForBoot(ctx, testSerial); err != nil {
+		fmt.Fprintf(os.Stderr, "integration: %s did not boot: %v\n", testSerial, err)
+		return 1
+	}
+	return m.Run()
+}
+
+// requireDevice skips the calling test when no device is configured.
+func requireDevice(t *testing.T) {
+	t.Helper()
+	if skipReason != "" {
+		t.Skip(skipReason)
+	}
+}
+
+// bootEmulator launches a headless emulator for avd and returns a function
+// that shuts it down.
+func bootEmulator(avd string) (func(), error) {
+	bin, err := emulatorBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(bin,
+		"-avd", avd,
+		"-port", fmt.Sprint(emulatorPort),
+		"-no-window", "-no-audio", "-no-boot-anim", "-no-snapshot",
+		"-gpu", "swiftshader_indirect",
+	)
+	cmd.Stdout = io.Discard
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting emulator: %w", err)
+	}
+
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		serial := fmt.Sprintf("emulator-%d", emulatorPort)
+		_, _ = testClient.Shell(ctx, serial, "reboot -p")
+		done := make(chan struct{})
+		go func() {
+			cmd.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(15 * time.Second):
+			cmd.Process.Kill()
+		}
+	}
+	return stop, nil
+}
+
+func emulatorBinary() (string, error) {
+	for _, env := range []string{"ANDROID_HOME", "ANDROID_SDK_ROOT"} {
+		if home := os.Getenv(env); home != "" {
+			p := filepath.Join(home, "emulator", "emulator")
+			if _, err := os.Stat(p); err == nil {
+				return p, nil
+			}
+		}
+	}
+	p, err := exec.LookPath("emulator")
+	if err != nil {
+		return "", fmt.Errorf("emulator binary not found in $ANDROID_HOME/emulator or PATH")
+	}
+	return p, nil
+}
+
+// waitForBoot polls until the device is online and sys.boot_completed=1.
+func waitForBoot(ctx context.Context, serial string) error {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		shellCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		val, err := testClient.GetDeviceProp(shellCtx, serial, "sys.boot_completed")
+		cancel()
+		if err == nil && val == "1" {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// generateTraffic opens a short-lived outbound TCP connection from the
+// device so procnet has something to report.
+func generateTraffic(ctx context.Context, t *testing.T) {
+	t.Helper()
+	cmd := "toybox nc -w 3 8.8.8.8 53 </dev/null >/dev/null 2>&1 &" +
+		" toybox nc -w 3 1.1.1.1 443 </dev/null >/dev/null 2>&1 &"
+	if _, err := testClient.Shell(ctx, testSerial, cmd); err != nil {
+		t.Logf("generating traffic: %v", err)
+	}
+}
+
+// eventually polls cond until it returns true or the timeout expires.
+func eventually(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	t.Fatalf("timed out after %s waiting for %s", timeout, what)
+}
+
+func testLogger() *slog.Logger {
+	if testing.Verbose() && strings.Contains(os.Getenv("ADB_MONITOR_TEST_LOG"), "debug") {
+		return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
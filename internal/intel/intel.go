@@ -0,0 +1,393 @@
+// Package intel matches traffic against threat-intelligence feeds: lists of
+// IPs, CIDR ranges and domains loaded from local files or URLs and
+// refreshed periodically. Blocklists flag traffic as malicious; allowlists
+// exempt it.
+package intel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRefresh is how often feeds are reloaded.
+	DefaultRefresh = time.Hour
+	// maxFeedSize bounds the size of one feed.
+	maxFeedSize = 64 << 20
+	// fetchTimeout bounds the download of one URL feed.
+	fetchTimeout = 2 * time.Minute
+)
+
+// Feed is one list of indicators.
+type Feed struct {
+	// Name identifies the feed in matches; the source if empty.
+	Name string `json:"name"`
+	// Source is a file path or an http(s) URL.
+	Source string `json:"source"`
+	// Allow marks an allowlist: traffic it matches is never malicious.
+	Allow bool `json:"allow,omitempty"`
+}
+
+// IsURL reports whether the feed is downloaded rather than read from disk.
+func (f Feed) IsURL() bool {
+	return strings.HasPrefix(f.Source, "http://") || strings.HasPrefix(f.Source, "https://")
+}
+
+// List is a parsed set of indicators.
+type List struct {
+	ips      map[netip.Addr]struct{}
+	prefixes map[int]map[netip.Prefix]struct{} // prefix length -> prefixes
+	domains  map[string]struct{}
+}
+
+// Len returns the number of indicators in l.
+func (l *List) Len() int {
+	n := len(l.ips) + len(l.domains)
+	for _, ps := range l.prefixes {
+		n += len(ps)
+	}
+	return n
+}
+
+// hostsSinks are names hosts-format lists map to themselves; they are not
+// indicators.
+var hostsSinks = map[string]bool{
+	"localhost": true, "localhost.localdomain": true, "local": true,
+	"broadcasthost": true, "ip6-localhost": true, "ip6-loopback": true,
+}
+
+// ParseList reads one indicator per line: an IP, a CIDR range, or a domain,
+// which also matches its subdomains ("*." and "." prefixes are accepted).
+// Blank lines and comments starting with # or ; are skipped, as are
+// trailing comments. Hosts-file lines ("0.0.0.0 ads.example") list the
+// domains after the address.
+func ParseList(r io.Reader) (*List, error) {
+	l := &List{
+		ips:      make(map[netip.Addr]struct{}),
+		prefixes: make(map[int]map[netip.Prefix]struct{}),
+		domains:  make(map[string]struct{}),
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if _, err := netip.ParseAddr(fields[0]); err == nil && len(fields) > 1 {
+			// Hosts format: the address is where the names are sunk.
+			for _, name := range fields[1:] {
+				l.add(name)
+			}
+			continue
+		}
+		l.add(fields[0])
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *List) add(s string) {
+	if ip, err := netip.ParseAddr(s); err == nil {
+		l.ips[ip.Unmap()] = struct{}{}
+		return
+	}
+	if p, err := netip.ParsePrefix(s); err == nil {
+		p = p.Masked()
+		if p.Addr().Is4In6() {
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96).Masked()
+		}
+		if l.prefixes[p.Bits()] == nil {
+			l.prefixes[p.Bits()] = make(map[netip.Prefix]struct{})
+		}
+		l.prefixes[p.Bits()][p] = struct{}{}
+		return
+	}
+	d := normalizeHost(strings.TrimPrefix(s, "*"))
+	if hostsSinks[d] || !isDomain(d) {
+		return
+	}
+	l.domains[d] = struct{}{}
+}
+
+// isDomain reports whether s looks like a domain of two labels or more.
+func isDomain(s string) bool {
+	if !strings.Contains(s, ".") {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '.' || r == '-' || r == '_' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeHost(h string) string {
+	return strings.Trim(strings.ToLower(strings.TrimSpace(h)), ".")
+}
+
+// matchIP returns the indicator ip matches.
+func (l *List) matchIP(s string) (string, bool) {
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return "", false
+	}
+	ip = ip.Unmap()
+	if _, ok := l.ips[ip]; ok {
+		return ip.String(), true
+	}
+	for bits, ps := range l.prefixes {
+		p, err := ip.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if _, ok := ps[p]; ok {
+			return p.String(), true
+		}
+	}
+	return "", false
+}
+
+// matchHost returns the indicator host or one of its parent domains
+// matches.
+func (l *List) matchHost(host string) (string, bool) {
+	h := normalizeHost(host)
+	for h != "" {
+		if _, ok := l.domains[h]; ok {
+			return h, true
+		}
+		_, parent, found := strings.Cut(h, ".")
+		if !found {
+			break
+		}
+		h = parent
+	}
+	return "", false
+}
+
+// Match returns the indicator that ip or host matches; empty arguments
+// match nothing.
+func (l *List) Match(ip, host string) (string, bool) {
+	if host != "" {
+		if ind, ok := l.matchHost(host); ok {
+			return ind, true
+		}
+	}
+	if ip != "" {
+		return l.matchIP(ip)
+	}
+	return "", false
+}
+
+// Match is a blocklist hit.
+type Match struct {
+	Feed      string `json:"feed"`
+	Indicator string `json:"indicator"`
+}
+
+func (m Match) String() string {
+	return m.Feed + ": " + m.Indicator
+}
+
+// FeedStatus describes the state of one feed.
+type FeedStatus struct {
+	Feed
+	Entries int `json:"entries"`
+	// LoadedAt is when the feed last loaded successfully.
+	LoadedAt *time.Time `json:"loaded_at,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+type loadedFeed struct {
+	Feed
+	list     *List
+	loadedAt time.Time
+	err      error
+}
+
+// Config configures a Matcher.
+type Config struct {
+	Feeds []Feed
+	// Refresh is how often feeds are reloaded; DefaultRefresh if zero.
+	Refresh time.Duration
+	// Client downloads URL feeds; http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Matcher matches traffic against a set of feeds. It is safe for
+// concurrent use.
+type Matcher struct {
+	log     *slog.Logger
+	client  *http.Client
+	refresh time.Duration
+
+	mu    sync.RWMutex
+	feeds []*loadedFeed
+}
+
+// New creates a matcher over cfg.Feeds. Nothing matches until Load.
+func New(log *slog.Logger, cfg Config) *Matcher {
+	if cfg.Refresh <= 0 {
+		cfg.Refresh = DefaultRefresh
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	m := &Matcher{log: log.With("component", "intel"), client: cfg.Client, refresh: cfg.Refresh}
+	for _, f := range cfg.Feeds {
+		if f.Name == "" {
+			f.Name = f.Source
+		}
+		m.feeds = append(m.feeds, &loadedFeed{Feed: f})
+	}
+	return m
+}
+
+// Load reloads every feed. A feed that fails keeps its previous list; the
+// errors are joined in the result.
+func (m *Matcher) Load(ctx context.Context) error {
+	m.mu.RLock()
+	feeds := make([]Feed, len(m.feeds))
+	for i, lf := range m.feeds {
+		feeds[i] = lf.Feed
+	}
+	m.mu.RUnlock()
+
+	var errs []error
+	for i, f := range feeds {
+		list, err := m.fetch(ctx, f)
+		m.mu.Lock()
+		lf := m.feeds[i]
+		lf.err = err
+		if err == nil {
+			lf.list = list
+			lf.loadedAt = time.Now()
+		}
+		m.mu.Unlock()
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("feed %s: %w", f.Name, err))
+			m.log.Warn("threat feed failed to load", "feed", f.Name, "error", err)
+			continue
+		}
+		m.log.Info("threat feed loaded", "feed", f.Name, "entries", list.Len(), "allow", f.Allow)
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Matcher) fetch(ctx context.Context, f Feed) (*List, error) {
+	if !f.IsURL() {
+		file, err := os.Open(f.Source)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return ParseList(io.LimitReader(file, maxFeedSize))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.Source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", f.Source, resp.Status)
+	}
+	return ParseList(io.LimitReader(resp.Body, maxFeedSize))
+}
+
+// Run reloads the feeds every refresh interval until ctx is done. It does
+// not load them first; call Load for that.
+func (m *Matcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Load(ctx)
+		}
+	}
+}
+
+// Match reports the blocklist entry ip or host matches, unless an
+// allowlist matches either of them.
+func (m *Matcher) Match(ip, host string) (Match, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var hit Match
+	var blocked bool
+	for _, lf := range m.feeds {
+		if lf.list == nil {
+			continue
+		}
+		ind, ok := lf.list.Match(ip, host)
+		if !ok {
+			continue
+		}
+		if lf.Allow {
+			return Match{}, false
+		}
+		if !blocked {
+			hit, blocked = Match{Feed: lf.Name, Indicator: ind}, true
+		}
+	}
+	return hit, blocked
+}
+
+// MatchThreat implements capture.ThreatMatcher.
+func (m *Matcher) MatchThreat(ip, host string) (string, bool) {
+	hit, ok := m.Match(ip, host)
+	if !ok {
+		return "", false
+	}
+	return hit.String(), true
+}
+
+// Status returns the state of every feed, blocklists first.
+func (m *Matcher) Status() []FeedStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]FeedStatus, 0, len(m.feeds))
+	for _, lf := range m.feeds {
+		st := FeedStatus{Feed: lf.Feed}
+		if lf.list != nil {
+			st.Entries = lf.list.Len()
+			loadedAt := lf.loadedAt
+			st.LoadedAt = &loadedAt
+		}
+		if lf.err != nil {
+			st.Error = lf.err.Error()
+		}
+		out = append(out, st)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return !out[i].Allow && out[j].Allow })
+	return out
+}
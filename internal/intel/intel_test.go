@@ -0,0 +1,103 @@
+package intel
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseList(t *testing.T) {
+	l, err := ParseList(strings.NewReader(`# comment
+203.0.113.7
+198.51.100.0/24   ; trailing comment
+2001:db8:bad::/48
+evil.example
+*.tracker.example
+0.0.0.0 ads.example more.example
+127.0.0.1 localhost
+not-a-domain
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Len() != 7 {
+		t.Errorf("Len = %d, want 7", l.Len())
+	}
+
+	tests := []struct {
+		ip, host string
+		want     string
+	}{
+		{ip: "203.0.113.7", want: "203.0.113.7"},
+		{ip: "::ffff:203.0.113.7", want: "203.0.113.7"},
+		{ip: "198.51.100.99", want: "198.51.100.0/24"},
+		{ip: "2001:db8:bad:1::5", want: "2001:db8:bad::/48"},
+		{host: "EVIL.example.", want: "evil.example"},
+		{host: "cdn.evil.example", want: "evil.example"},
+		{host: "a.b.tracker.example", want: "tracker.example"},
+		{host: "more.example", want: "more.example"},
+		{ip: "198.51.101.1"},
+		{host: "notevil.example"},
+		{host: "localhost"},
+		{ip: "0.0.0.0"},
+	}
+	for _, tt := range tests {
+		got, ok := l.Match(tt.ip, tt.host)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("Match(%q, %q) = %q, %v; want %q", tt.ip, tt.host, got, ok, tt.want)
+		}
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	dir := t.TempDir()
+	allow := filepath.Join(dir, "allow.txt")
+	if err := os.WriteFile(allow, []byte("good.evil.example\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	body := "evil.example\n203.0.113.0/24\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	m := New(slog.New(slog.NewTextHandler(io.Discard, nil)), Config{Feeds: []Feed{
+		{Name: "feed", Source: srv.URL},
+		{Source: allow, Allow: true},
+		{Name: "missing", Source: filepath.Join(dir, "missing.txt")},
+	}})
+	if _, ok := m.Match("203.0.113.1", ""); ok {
+		t.Error("matched before Load")
+	}
+	if err := m.Load(context.Background()); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Load error = %v, want the missing feed", err)
+	}
+
+	if hit, ok := m.Match("203.0.113.1", "x.evil.example"); !ok || hit.String() != "feed: evil.example" {
+		t.Errorf("Match = %v, %v", hit, ok)
+	}
+	// Allowlists win over blocklists, for the host and the IP alike.
+	if hit, ok := m.Match("203.0.113.1", "good.evil.example"); ok {
+		t.Errorf("allowlisted host matched %v", hit)
+	}
+
+	// A failed reload keeps the previous list.
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusInternalServerError)
+	})
+	m.Load(context.Background())
+	if _, ok := m.MatchThreat("203.0.113.1", ""); !ok {
+		t.Error("failed reload dropped the list")
+	}
+
+	st := m.Status()
+	if len(st) != 3 || st[0].Name != "feed" || st[0].Entries != 2 || st[0].Error == "" || st[2].Name != allow || !st[2].Allow {
+		t.Errorf("Status = %+v", st)
+	}
+}
@@ -0,0 +1,247 @@
+// Package inventory keeps the list of packages installed on each device,
+// with version, install and update times and installer, and reports what
+// changed between refreshes.
+package inventory
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ListCmd lists the packages installed for the current user with their
+	// UID, version code and installer.
+	ListCmd = "pm list packages -U -i --show-versioncode 2>/dev/null"
+
+	// DetailsCmd prints the device's UTC offset, then the per-package
+	// fields of `dumpsys package` that ListCmd does not cover. Hidden
+	// system packages (the factory copies of updated system apps) are
+	// marked so they can be skipped.
+	DetailsCmd = "date +%z; dumpsys package packages | grep -E " +
+		`'^  Package \[|^    (versionName|firstInstallTime|lastUpdateTime|pkgFlags)=|^Hidden system packages'`
+)
+
+// Package is one installed app.
+type Package struct {
+	Name        string `json:"name"`
+	UID         int    `json:"uid"`
+	VersionCode int64  `json:"version_code"`
+	VersionName string `json:"version_name,omitempty"`
+	// Installer is the package that installed the app, e.g.
+	// com.android.vending; empty for preinstalled and adb-installed apps.
+	Installer    string    `json:"installer,omitempty"`
+	System       bool      `json:"system"`
+	FirstInstall time.Time `json:"first_install"`
+	LastUpdate   time.Time `json:"last_update"`
+}
+
+// ParseList parses ListCmd output. Lines look like
+//
+//	package:com.example versionCode:42 installer=com.android.vending uid:10123
+//
+// with the fields in any order; plain `pm list packages` lines yield just
+// the name. Packages are returned sorted by name.
+func ParseList(out string) []Package {
+	var pkgs []Package
+	for _, line := range strings.Split(out, "\n") {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), "package:")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		p := Package{Name: fields[0], UID: -1}
+		for _, f := range fields[1:] {
+			if v, ok := strings.CutPrefix(f, "uid:"); ok {
+				// Shared UIDs print as "uid:1000,10123" on some builds.
+				v, _, _ = strings.Cut(v, ",")
+				if n, err := strconv.Atoi(v); err == nil {
+					p.UID = n
+				}
+			} else if v, ok := strings.CutPrefix(f, "versionCode:"); ok {
+				p.VersionCode, _ = strconv.ParseInt(v, 10, 64)
+			} else if v, ok := strings.CutPrefix(f, "installer="); ok && v != "null" {
+				p.Installer = v
+			}
+		}
+		pkgs = append(pkgs, p)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+	return pkgs
+}
+
+// details is what DetailsCmd adds to a listed package.
+type details struct {
+	versionName  string
+	firstInstall time.Time
+	lastUpdate   time.Time
+	system       bool
+}
+
+// dumpsysTimeLayout is how `dumpsys package` prints install times, in the
+// device's local time.
+const dumpsysTimeLayout = "2006-01-02 15:04:05"
+
+// parseDetails parses DetailsCmd output into per-package details.
+func parseDetails(out string) map[string]details {
+	loc := time.UTC
+	m := make(map[string]details)
+	var (
+		cur  string
+		d    details
+		read bool // first line is the UTC offset
+	)
+	flush := func() {
+		if cur != "" {
+			m[cur] = d
+		}
+		cur, d = "", details{}
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !read && strings.TrimSpace(line) != "" {
+			read = true
+			if t, err := time.Parse("-0700", strings.TrimSpace(line)); err == nil {
+				_, offset := t.Zone()
+				loc = time.FixedZone("device", offset)
+				continue
+			}
+		}
+		if strings.HasPrefix(line, "Hidden system packages") {
+			break
+		}
+		if rest, ok := strings.CutPrefix(line, "  Package ["); ok {
+			flush()
+			cur, _, _ = strings.Cut(rest, "]")
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || cur == "" {
+			continue
+		}
+		switch key {
+		case "versionName":
+			d.versionName = value
+		case "firstInstallTime":
+			d.firstInstall, _ = time.ParseInLocation(dumpsysTimeLayout, value, loc)
+		case "lastUpdateTime":
+			d.lastUpdate, _ = time.ParseInLocation(dumpsysTimeLayout, value, loc)
+		case "pkgFlags":
+			d.system = strings.Contains(value, " SYSTEM ")
+		}
+	}
+	flush()
+	return m
+}
+
+// Merge adds the details from DetailsCmd output to packages from ParseList.
+func Merge(pkgs []Package, detailsOut string) {
+	det := parseDetails(detailsOut)
+	for i := range pkgs {
+		d, ok := det[pkgs[i].Name]
+		if !ok {
+			continue
+		}
+		pkgs[i].VersionName = d.versionName
+		pkgs[i].FirstInstall = d.firstInstall
+		pkgs[i].LastUpdate = d.lastUpdate
+		pkgs[i].System = d.system
+	}
+}
+
+// ChangeType classifies a difference between two inventories.
+type ChangeType string
+
+const (
+	Installed ChangeType = "installed"
+	Removed   ChangeType = "removed"
+	Updated   ChangeType = "updated"
+)
+
+// Change is one package that differs between two inventories.
+type Change struct {
+	Type    ChangeType `json:"type"`
+	Package Package    `json:"package"`
+	// Previous is the package before an update.
+	Previous *Package `json:"previous,omitempty"`
+}
+
+// Diff compares two inventories sorted by name. A package counts as updated
+// when its version code or update time changed; update times are only
+// compared when both lists have them.
+func Diff(old, cur []Package) []Change {
+	var changes []Change
+	i, j := 0, 0
+	for i < len(old) || j < len(cur) {
+		switch {
+		case j == len(cur) || (i < len(old) && old[i].Name < cur[j].Name):
+			changes = append(changes, Change{Type: Removed, Package: old[i]})
+			i++
+		case i == len(old) || cur[j].Name < old[i].Name:
+			changes = append(changes, Change{Type: Installed, Package: cur[j]})
+			j++
+		default:
+			if prev := old[i]; updated(prev, cur[j]) {
+				changes = append(changes, Change{Type: Updated, Package: cur[j], Previous: &prev})
+			}
+			i++
+			j++
+		}
+	}
+	return changes
+}
+
+func updated(prev, cur Package) bool {
+	if prev.VersionCode != cur.VersionCode {
+		return true
+	}
+	return !prev.LastUpdate.IsZero() && !cur.LastUpdate.IsZero() && !prev.LastUpdate.Equal(cur.LastUpdate)
+}
+
+// Inventory is the package list of one device.
+type Inventory struct {
+	Serial    string    `json:"serial"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Packages  []Package `json:"packages"`
+}
+
+// Tracker holds the latest inventory of every device. It is safe for
+// concurrent use.
+type Tracker struct {
+	mu      sync.Mutex
+	devices map[string]Inventory
+}
+
+// NewTracker creates an empty tracker.
+func NewTracker() *Tracker {
+	return &Tracker{devices: make(map[string]Inventory)}
+}
+
+// Update stores a fresh package list for the device and returns what
+// changed since the previous one. The first list of a device is a baseline
+// and reports no changes.
+func (t *Tracker) Update(serial string, pkgs []Package, now time.Time) []Change {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prev, ok := t.devices[serial]
+	t.devices[serial] = Inventory{Serial: serial, UpdatedAt: now, Packages: pkgs}
+	if !ok {
+		return nil
+	}
+	return Diff(prev.Packages, pkgs)
+}
+
+// Get returns the device's latest inventory.
+func (t *Tracker) Get(serial string) (Inventory, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	inv, ok := t.devices[serial]
+	return inv, ok
+}
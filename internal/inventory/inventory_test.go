@@ -0,0 +1,99 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+)
+
+const listOutput = `package:com.example versionCode:42 installer=com.android.vending uid:10123
+package:android versionCode:34  installer=null uid:1000
+package:com.android.shell versionCode:34 uid:2000
+not a package line
+`
+
+const detailsOutput = `+0300
+  Package [com.example] (a1b2c3):
+    versionName=1.2.3
+    pkgFlags=[ HAS_CODE ALLOW_CLEAR_USER_DATA ]
+    firstInstallTime=2024-01-02 10:00:00
+    lastUpdateTime=2024-03-04 12:30:00
+  Package [android] (d4e5f6):
+    versionName=14
+    pkgFlags=[ SYSTEM HAS_CODE PERSISTENT ]
+    firstInstallTime=2008-12-31 21:00:00
+    lastUpdateTime=2008-12-31 21:00:00
+Hidden system packages:
+  Package [com.example] (0f0f0f):
+    versionName=0.1
+`
+
+func TestParseListAndMerge(t *testing.T) {
+	pkgs := ParseList(listOutput)
+	if len(pkgs) != 3 {
+		t.Fatalf("got %d packages: %+v", len(pkgs), pkgs)
+	}
+	Merge(pkgs, detailsOutput)
+
+	android, example, shell := pkgs[0], pkgs[2], pkgs[1]
+	if android.Name != "android" || !android.System || android.Installer != "" || android.UID != 1000 {
+		t.Errorf("android = %+v", android)
+	}
+	if shell.Name != "com.android.shell" || shell.UID != 2000 || shell.VersionCode != 34 || shell.VersionName != "" {
+		t.Errorf("shell = %+v", shell)
+	}
+
+	zone := time.FixedZone("", 3*3600)
+	want := Package{
+		Name: "com.example", UID: 10123, VersionCode: 42, VersionName: "1.2.3",
+		Installer:    "com.android.vending",
+		FirstInstall: time.Date(2024, 1, 2, 10, 0, 0, 0, zone),
+		LastUpdate:   time.Date(2024, 3, 4, 12, 30, 0, 0, zone),
+	}
+	if example.Name != want.Name || example.UID != want.UID || example.VersionCode != want.VersionCode ||
+		example.VersionName != want.VersionName || example.Installer != want.Installer || example.System ||
+		!example.FirstInstall.Equal(want.FirstInstall) || !example.LastUpdate.Equal(want.LastUpdate) {
+		t.Errorf("com.example = %+v, want %+v", example, want)
+	}
+}
+
+func TestTrackerDiff(t *testing.T) {
+	tr := NewTracker()
+	now := time.Now()
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	base := []Package{
+		{Name: "a", VersionCode: 1, LastUpdate: t0},
+		{Name: "b", VersionCode: 1, LastUpdate: t0},
+		{Name: "c", VersionCode: 1, LastUpdate: t0},
+	}
+	if changes := tr.Update("dev1", base, now); changes != nil {
+		t.Errorf("baseline reported changes: %+v", changes)
+	}
+
+	next := []Package{
+		{Name: "a", VersionCode: 1}, // details missing this time: not an update
+		{Name: "c", VersionCode: 2, LastUpdate: t0.Add(time.Hour)},
+		{Name: "d", VersionCode: 1},
+	}
+	changes := tr.Update("dev1", next, now.Add(time.Minute))
+	want := []struct {
+		typ  ChangeType
+		name string
+	}{{Removed, "b"}, {Updated, "c"}, {Installed, "d"}}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %+v", changes)
+	}
+	for i, w := range want {
+		if changes[i].Type != w.typ || changes[i].Package.Name != w.name {
+			t.Errorf("change %d = %s %s, want %s %s", i, changes[i].Type, changes[i].Package.Name, w.typ, w.name)
+		}
+	}
+	if prev := changes[1].Previous; prev == nil || prev.VersionCode != 1 {
+		t.Errorf("update previous = %+v", prev)
+	}
+
+	inv, ok := tr.Get("dev1")
+	if !ok || len(inv.Packages) != 3 || !inv.UpdatedAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("inventory = %+v, %v", inv, ok)
+	}
+}
@@ -0,0 +1,334 @@
+package inventory
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+const (
+	// PermInternet is the permission an app needs to open sockets.
+	PermInternet = "android.permission.INTERNET"
+
+	// cleartextDefaultSDK is the first target SDK (Android 9) whose apps
+	// may not send cleartext traffic unless they opt in.
+	cleartextDefaultSDK = 28
+
+	// firstAppUID is the first UID Android gives an app; lower UIDs are
+	// shared by system packages.
+	firstAppUID = 10000
+)
+
+// SensitivePermissions are the permissions that give an app data worth
+// sending off the device.
+var SensitivePermissions = []string{
+	"android.permission.ACCESS_BACKGROUND_LOCATION",
+	"android.permission.ACCESS_COARSE_LOCATION",
+	"android.permission.ACCESS_FINE_LOCATION",
+	"android.permission.BODY_SENSORS",
+	"android.permission.CAMERA",
+	"android.permission.GET_ACCOUNTS",
+	"android.permission.MANAGE_EXTERNAL_STORAGE",
+	"android.permission.PACKAGE_USAGE_STATS",
+	"android.permission.QUERY_ALL_PACKAGES",
+	"android.permission.READ_CALENDAR",
+	"android.permission.READ_CALL_LOG",
+	"android.permission.READ_CONTACTS",
+	"android.permission.READ_EXTERNAL_STORAGE",
+	"android.permission.READ_MEDIA_IMAGES",
+	"android.permission.READ_MEDIA_VIDEO",
+	"android.permission.READ_PHONE_NUMBERS",
+	"android.permission.READ_PHONE_STATE",
+	"android.permission.READ_SMS",
+	"android.permission.RECEIVE_SMS",
+	"android.permission.RECORD_AUDIO",
+}
+
+// Permissions is what `dumpsys package <pkg>` says about an app's
+// permissions and network security.
+type Permissions struct {
+	Package   string   `json:"package"`
+	UID       int      `json:"uid"`
+	TargetSDK int      `json:"target_sdk,omitempty"`
+	Requested []string `json:"requested,omitempty"`
+	// Granted are the requested install and runtime permissions the app
+	// holds.
+	Granted []string `json:"granted,omitempty"`
+	// Cleartext is set when the app may send cleartext traffic: it opts
+	// in with usesCleartextTraffic, or targets an SDK below 28 where that
+	// is the default. A network security config can still allow or forbid
+	// cleartext per domain; dumpsys does not show its rules.
+	Cleartext bool `json:"cleartext"`
+	// NetworkSecurityConfig is set when the app ships a network security
+	// config (only shown by some Android versions).
+	NetworkSecurityConfig bool `json:"network_security_config,omitempty"`
+}
+
+// Holds reports whether the app was granted perm.
+func (p Permissions) Holds(perm string) bool {
+	for _, g := range p.Granted {
+		if g == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionsCmd returns the command printing `dumpsys package` for each
+// of pkgs. Names that are not valid package names are left out.
+func PermissionsCmd(pkgs []string) string {
+	var cmds []string
+	for _, p := range pkgs {
+		if adb.ValidPackageName(p) {
+			cmds = append(cmds, "dumpsys package "+p)
+		}
+	}
+	return strings.Join(cmds, "; ")
+}
+
+// ParsePermissions parses PermissionsCmd output into the permissions of
+// each package. Packages look like
+//
+//	Package [com.example] (a1b2c3):
+//	  userId=10123
+//	  versionCode=42 minSdk=24 targetSdk=33
+//	  flags=[ HAS_CODE ALLOW_CLEAR_USER_DATA USES_CLEARTEXT_TRAFFIC ]
+//	  requested permissions:
+//	    android.permission.INTERNET
+//	  install permissions:
+//	    android.permission.INTERNET: granted=true
+//	  User 0: ceDataInode=1234 installed=true
+//	    runtime permissions:
+//	      android.permission.CAMERA: granted=false, flags=[ USER_SET ]
+//
+// Hidden system packages (the factory copies of updated system apps) are
+// skipped.
+func ParsePermissions(out string) map[string]Permissions {
+	m := make(map[string]Permissions)
+	var (
+		cur       *Permissions
+		section   string
+		granted   map[string]bool
+		cleartext bool
+		hidden    bool
+	)
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		for _, r := range cur.Requested {
+			if granted[r] {
+				cur.Granted = append(cur.Granted, r)
+			}
+		}
+		cur.Cleartext = cleartext || cur.TargetSDK > 0 && cur.TargetSDK < cleartextDefaultSDK
+		if _, seen := m[cur.Package]; !seen {
+			m[cur.Package] = *cur
+		}
+		cur = nil
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(line, " ") {
+			// A top-level header ends the package; each dumpsys run lists
+			// its package under Packages: and the hidden copy after it.
+			flush()
+			hidden = strings.HasPrefix(line, "Hidden system packages")
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "  Package ["); ok {
+			flush()
+			if hidden {
+				continue
+			}
+			name, _, _ := strings.Cut(rest, "]")
+			cur = &Permissions{Package: name, UID: -1}
+			section, granted, cleartext = "", make(map[string]bool), false
+			continue
+		}
+		if cur == nil || trimmed == "" {
+			continue
+		}
+
+		if strings.HasSuffix(trimmed, "permissions:") {
+			section = trimmed
+			continue
+		}
+		if section != "" {
+			if perm, state, ok := permissionLine(trimmed); ok {
+				switch {
+				case section == "requested permissions:":
+					cur.Requested = append(cur.Requested, perm)
+				case strings.Contains(state, "granted=true"):
+					granted[perm] = true
+				}
+				continue
+			}
+			section = ""
+		}
+
+		for _, f := range strings.Fields(trimmed) {
+			key, value, _ := strings.Cut(f, "=")
+			switch key {
+			case "userId":
+				if n, err := strconv.Atoi(value); err == nil {
+					cur.UID = n
+				}
+			case "targetSdk":
+				cur.TargetSDK, _ = strconv.Atoi(value)
+			case "networkSecurityConfigRes":
+				cur.NetworkSecurityConfig = true
+			}
+		}
+		if strings.HasPrefix(trimmed, "flags=[") || strings.HasPrefix(trimmed, "pkgFlags=[") ||
+			strings.HasPrefix(trimmed, "privateFlags=[") {
+			cleartext = cleartext || slices.Contains(strings.Fields(trimmed), "USES_CLEARTEXT_TRAFFIC")
+		}
+	}
+	flush()
+	return m
+}
+
+// permissionLine splits a line of a permission list, e.g.
+// "android.permission.CAMERA: granted=false, flags=[ USER_SET ]", into the
+// permission and its state.
+func permissionLine(line string) (perm, state string, ok bool) {
+	perm, state, _ = strings.Cut(line, ":")
+	perm, _, _ = strings.Cut(perm, ",")
+	perm = strings.TrimSpace(perm)
+	if !strings.Contains(perm, ".") || strings.ContainsAny(perm, "= ") {
+		return "", "", false
+	}
+	return perm, state, true
+}
+
+// AppTraffic is the traffic observed for one UID.
+type AppTraffic struct {
+	Connections int `json:"connections"`
+	// Cleartext counts connections to plain HTTP ports.
+	Cleartext int      `json:"cleartext"`
+	Hosts     []string `json:"hosts,omitempty"`
+}
+
+// Severity ranks an audit finding.
+type Severity string
+
+const (
+	SeverityHigh   Severity = "high"
+	SeverityMedium Severity = "medium"
+	SeverityLow    Severity = "low"
+)
+
+func (s Severity) rank() int {
+	switch s {
+	case SeverityHigh:
+		return 3
+	case SeverityMedium:
+		return 2
+	case SeverityLow:
+		return 1
+	}
+	return 0
+}
+
+// Finding kinds.
+const (
+	// FindingNoInternet: the app has traffic but was not granted
+	// INTERNET, so it goes through another app or a shared UID.
+	FindingNoInternet = "no_internet_permission"
+	// FindingCleartextTraffic: the app was seen talking plain HTTP.
+	FindingCleartextTraffic = "cleartext_traffic"
+	// FindingCleartextPermitted: the app has traffic and may send it in
+	// cleartext.
+	FindingCleartextPermitted = "cleartext_permitted"
+	// FindingSensitive: the app has traffic and holds sensitive
+	// permissions.
+	FindingSensitive = "sensitive_permissions"
+)
+
+// Finding is one issue the audit found with an app.
+type Finding struct {
+	Kind     string   `json:"kind"`
+	Severity Severity `json:"severity"`
+	Detail   string   `json:"detail"`
+}
+
+// AuditEntry is the audit of one app.
+type AuditEntry struct {
+	Permissions
+	// Sensitive are the granted SensitivePermissions.
+	Sensitive []string   `json:"sensitive,omitempty"`
+	Traffic   AppTraffic `json:"traffic"`
+	// Severity is that of the gravest finding, empty without findings.
+	Severity Severity  `json:"severity,omitempty"`
+	Findings []Finding `json:"findings"`
+}
+
+// Audit checks each app's permissions against its traffic, keyed by UID.
+// Entries are sorted by severity, then package name.
+func Audit(perms map[string]Permissions, traffic map[int]AppTraffic) []AuditEntry {
+	entries := make([]AuditEntry, 0, len(perms))
+	for _, p := range perms {
+		e := AuditEntry{Permissions: p, Traffic: traffic[p.UID], Findings: []Finding{}}
+		for _, s := range SensitivePermissions {
+			if p.Holds(s) {
+				e.Sensitive = append(e.Sensitive, s)
+			}
+		}
+
+		if e.Traffic.Connections > 0 {
+			// Apps below firstAppUID share their UID with system packages,
+			// any of which may own the traffic.
+			if !p.Holds(PermInternet) && p.UID >= firstAppUID {
+				e.add(FindingNoInternet, SeverityHigh,
+					strconv.Itoa(e.Traffic.Connections)+" connections without the INTERNET permission")
+			}
+			if e.Traffic.Cleartext > 0 {
+				e.add(FindingCleartextTraffic, SeverityMedium,
+					strconv.Itoa(e.Traffic.Cleartext)+" plain HTTP connections")
+			} else if p.Cleartext {
+				e.add(FindingCleartextPermitted, SeverityLow, cleartextDetail(p))
+			}
+			if len(e.Sensitive) > 0 {
+				e.add(FindingSensitive, SeverityMedium,
+					"network traffic with "+strings.Join(shortNames(e.Sensitive), ", "))
+			}
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if a, b := entries[i].Severity.rank(), entries[j].Severity.rank(); a != b {
+			return a > b
+		}
+		return entries[i].Package < entries[j].Package
+	})
+	return entries
+}
+
+func (e *AuditEntry) add(kind string, sev Severity, detail string) {
+	e.Findings = append(e.Findings, Finding{Kind: kind, Severity: sev, Detail: detail})
+	if sev.rank() > e.Severity.rank() {
+		e.Severity = sev
+	}
+}
+
+func cleartextDetail(p Permissions) string {
+	if p.TargetSDK > 0 && p.TargetSDK < cleartextDefaultSDK {
+		return "targets SDK " + strconv.Itoa(p.TargetSDK) + ", which allows cleartext traffic by default"
+	}
+	return "usesCleartextTraffic is set"
+}
+
+// shortNames drops the android.permission. prefix.
+func shortNames(perms []string) []string {
+	out := make([]string, len(perms))
+	for i, p := range perms {
+		out[i] = strings.TrimPrefix(p, "android.permission.")
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package inventory
+
+import (
+	"slices"
+	"testing"
+)
+
+const permissionsOutput = `Activity Resolver Table:
+  Non-Data Actions:
+      android.intent.action.MAIN:
+        a1b2c3 com.example/.MainActivity filter 0f0f0f
+
+Packages:
+  Package [com.example] (a1b2c3):
+    userId=10123
+    versionCode=42 minSdk=21 targetSdk=26
+    flags=[ HAS_CODE ALLOW_CLEAR_USER_DATA ALLOW_BACKUP ]
+    requested permissions:
+      android.permission.INTERNET
+      android.permission.ACCESS_FINE_LOCATION
+      android.permission.READ_EXTERNAL_STORAGE: restricted=true
+    install permissions:
+      android.permission.INTERNET: granted=true
+    User 0: ceDataInode=1234 installed=true hidden=false
+      gids=[3003]
+      runtime permissions:
+        android.permission.ACCESS_FINE_LOCATION: granted=true, flags=[ USER_SET ]
+        android.permission.READ_EXTERNAL_STORAGE: granted=false, flags=[ RESTRICTION_INSTALLER_EXEMPT ]
+
+Hidden system packages:
+  Package [com.example] (0f0f0f):
+    userId=10999
+Dexopt state:
+  [com.example]
+    path: /data/app/com.example/base.apk
+Packages:
+  Package [com.offline] (d4e5f6):
+    userId=10200
+    versionCode=1 minSdk=29 targetSdk=34
+    flags=[ HAS_CODE USES_CLEARTEXT_TRAFFIC ]
+    requested permissions:
+      android.permission.CAMERA
+    User 0: ceDataInode=5678 installed=true
+      runtime permissions:
+        android.permission.CAMERA: granted=true
+`
+
+func TestParsePermissions(t *testing.T) {
+	perms := ParsePermissions(permissionsOutput)
+	if len(perms) != 2 {
+		t.Fatalf("got %d packages: %+v", len(perms), perms)
+	}
+	ex := perms["com.example"]
+	if ex.UID != 10123 || ex.TargetSDK != 26 || !ex.Cleartext {
+		t.Errorf("com.example = %+v", ex)
+	}
+	if len(ex.Requested) != 3 || !slices.Equal(ex.Granted, []string{PermInternet, "android.permission.ACCESS_FINE_LOCATION"}) {
+		t.Errorf("com.example permissions: requested %v, granted %v", ex.Requested, ex.Granted)
+	}
+	off := perms["com.offline"]
+	if off.UID != 10200 || !off.Cleartext || off.Holds(PermInternet) || !off.Holds("android.permission.CAMERA") {
+		t.Errorf("com.offline = %+v", off)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	perms := ParsePermissions(permissionsOutput)
+	perms["com.quiet"] = Permissions{Package: "com.quiet", UID: 10300, Granted: []string{PermInternet}}
+	entries := Audit(perms, map[int]AppTraffic{
+		10123: {Connections: 5, Cleartext: 2},
+		10200: {Connections: 1},
+	})
+
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Package
+	}
+	if !slices.Equal(names, []string{"com.offline", "com.example", "com.quiet"}) {
+		t.Fatalf("order = %v", names)
+	}
+	kinds := func(e AuditEntry) []string {
+		var k []string
+		for _, f := range e.Findings {
+			k = append(k, f.Kind)
+		}
+		return k
+	}
+	if got := kinds(entries[0]); entries[0].Severity != SeverityHigh ||
+		!slices.Equal(got, []string{FindingNoInternet, FindingCleartextPermitted, FindingSensitive}) {
+		t.Errorf("com.offline: %s %v", entries[0].Severity, got)
+	}
+	if got := kinds(entries[1]); !slices.Equal(got, []string{FindingCleartextTraffic, FindingSensitive}) {
+		t.Errorf("com.example: %v", got)
+	}
+	if len(entries[2].Findings) != 0 || entries[2].Severity != "" {
+		t.Errorf("com.quiet without traffic: %+v", entries[2])
+	}
+}
+
+func TestPermissionsCmd(t *testing.T) {
+	if got := PermissionsCmd([]string{"com.a", "com.b; reboot", "com.c"}); got != "dumpsys package com.a; dumpsys package com.c" {
+		t.Errorf("got %q", got)
+	}
+}
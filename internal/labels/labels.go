@@ -0,0 +1,263 @@
+// Package labels keeps operator-assigned metadata for devices — a display
+// name, a group and free-form tags per serial — persisted to a JSON file so
+// it survives restarts.
+package labels
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/imcanugur/go-adb-monitor/internal/atomicfile"
+)
+
+const (
+	// maxNameLen, maxGroupLen and maxTagLen bound label fields.
+	maxNameLen  = 128
+	maxGroupLen = 64
+	maxTagLen   = 64
+	// maxTags bounds the tags of one device.
+	maxTags = 32
+)
+
+// ErrInvalid indicates a label failed validation.
+var ErrInvalid = errors.New("invalid label")
+
+// Label is the metadata of one device.
+type Label struct {
+	Serial string   `json:"serial"`
+	Name   string   `json:"name,omitempty"`
+	Group  string   `json:"group,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// IsZero reports whether l carries no metadata.
+func (l Label) IsZero() bool {
+	return l.Name == "" && l.Group == "" && len(l.Tags) == 0
+}
+
+// HasTag reports whether l carries tag, ignoring case.
+func (l Label) HasTag(tag string) bool {
+	for _, t := range l.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether l is in group and carries tag; empty arguments
+// match anything.
+func (l Label) Matches(group, tag string) bool {
+	return (group == "" || strings.EqualFold(l.Group, group)) && (tag == "" || l.HasTag(tag))
+}
+
+// Group summarizes one group.
+type Group struct {
+	Name    string   `json:"name"`
+	Serials []string `json:"serials"`
+}
+
+// Store holds the labels of all devices. It is safe for concurrent use.
+type Store struct {
+	path string
+
+	mu     sync.RWMutex
+	labels map[string]Label
+}
+
+// Open loads the labels kept at path. A missing file is an empty store;
+// an empty path keeps the labels in memory only.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, labels: make(map[string]Label)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read labels: %w", err)
+	}
+	var list []Label
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse labels %s: %w", path, err)
+	}
+	for _, l := range list {
+		if l, err := normalize(l); err == nil && !l.IsZero() {
+			s.labels[l.Serial] = l
+		}
+	}
+	return s, nil
+}
+
+// Path returns the file the labels are saved to, or "" if in memory.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Get returns the label of serial.
+func (s *Store) Get(serial string) (Label, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	l, ok := s.labels[serial]
+	return l, ok
+}
+
+// All returns every label, sorted by serial.
+func (s *Store) All() []Label {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Label, 0, len(s.labels))
+	for _, l := range s.labels {
+		out = append(out, l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Serial < out[j].Serial })
+	return out
+}
+
+// Set replaces the label of l.Serial and saves the store. Names, groups and
+// tags are trimmed and tags deduplicated; a label left empty removes the
+// device's entry. It returns the label as stored.
+func (s *Store) Set(l Label) (Label, error) {
+	l, err := normalize(l)
+	if err != nil {
+		return Label{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, had := s.labels[l.Serial]
+	if l.IsZero() {
+		delete(s.labels, l.Serial)
+	} else {
+		s.labels[l.Serial] = l
+	}
+	if err := s.saveLocked(); err != nil {
+		if had {
+			s.labels[l.Serial] = prev
+		} else {
+			delete(s.labels, l.Serial)
+		}
+		return Label{}, err
+	}
+	return l, nil
+}
+
+// Delete removes the label of serial and saves the store. It reports
+// whether there was one.
+func (s *Store) Delete(serial string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.labels[serial]
+	if !ok {
+		return false, nil
+	}
+	delete(s.labels, serial)
+	if err := s.saveLocked(); err != nil {
+		s.labels[serial] = prev
+		return false, err
+	}
+	return true, nil
+}
+
+// Groups returns every group with its serials, sorted by name. Group names
+// differing only in case are one group, named as on its first serial.
+func (s *Store) Groups() []Group {
+	var groups []Group
+	index := make(map[string]int) // lower-cased name -> position in groups
+	for _, l := range s.All() {
+		if l.Group == "" {
+			continue
+		}
+		key := strings.ToLower(l.Group)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, Group{Name: l.Group})
+		}
+		groups[i].Serials = append(groups[i].Serials, l.Serial)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// Select returns the serials whose label is in group and carries tag,
+// sorted. Empty arguments match every labeled device; group and tag are
+// compared ignoring case.
+func (s *Store) Select(group, tag string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []string
+	for serial, l := range s.labels {
+		if l.Matches(group, tag) {
+			out = append(out, serial)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// saveLocked writes the labels to path; see atomicfile.Write.
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	list := make([]Label, 0, len(s.labels))
+	for _, l := range s.labels {
+		list = append(list, l)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Serial < list[j].Serial })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := atomicfile.WriteFile(s.path, append(data, '\n')); err != nil {
+		return fmt.Errorf("save labels: %w", err)
+	}
+	return nil
+}
+
+// normalize trims and validates a label.
+func normalize(l Label) (Label, error) {
+	l.Serial = strings.TrimSpace(l.Serial)
+	l.Name = strings.TrimSpace(l.Name)
+	l.Group = strings.TrimSpace(l.Group)
+	if l.Serial == "" {
+		return l, fmt.Errorf("%w: serial is required", ErrInvalid)
+	}
+	if len(l.Name) > maxNameLen {
+		return l, fmt.Errorf("%w: name longer than %d bytes", ErrInvalid, maxNameLen)
+	}
+	if len(l.Group) > maxGroupLen {
+		return l, fmt.Errorf("%w: group longer than %d bytes", ErrInvalid, maxGroupLen)
+	}
+
+	var tags []string
+	for _, t := range l.Tags {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if len(t) > maxTagLen {
+			return l, fmt.Errorf("%w: tag longer than %d bytes", ErrInvalid, maxTagLen)
+		}
+		if !(Label{Tags: tags}).HasTag(t) {
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) > maxTags {
+		return l, fmt.Errorf("%w: more than %d tags", ErrInvalid, maxTags)
+	}
+	l.Tags = tags
+	return l, nil
+}
@@ -0,0 +1,89 @@
+package labels
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStore_PersistsAcrossOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "labels.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Set(Label{Serial: " A1 ", Name: " Pixel 7 #3 ", Group: "rack-1", Tags: []string{"beta", " ", "Beta", "android14"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Label{Serial: "A1", Name: "Pixel 7 #3", Group: "rack-1", Tags: []string{"beta", "android14"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Set = %+v, want %+v", got, want)
+	}
+	if _, err := s.Set(Label{Serial: "B2", Group: "rack-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Set(Label{Serial: "C3", Group: "RACK-1", Tags: []string{"android14"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	s2, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, ok := s2.Get("A1"); !ok || !reflect.DeepEqual(l, want) {
+		t.Errorf("reloaded A1 = %+v, %v", l, ok)
+	}
+	if groups := s2.Groups(); len(groups) != 2 || !reflect.DeepEqual(groups[0], Group{Name: "rack-1", Serials: []string{"A1", "C3"}}) {
+		t.Errorf("groups = %+v", groups)
+	}
+	if got := s2.Select("rack-1", ""); !reflect.DeepEqual(got, []string{"A1", "C3"}) {
+		t.Errorf("Select(rack-1) = %v", got)
+	}
+	if got := s2.Select("", "ANDROID14"); !reflect.DeepEqual(got, []string{"A1", "C3"}) {
+		t.Errorf("Select(tag) = %v", got)
+	}
+	if got := s2.Select("rack-2", "beta"); len(got) != 0 {
+		t.Errorf("Select(rack-2, beta) = %v", got)
+	}
+
+	// Clearing every field removes the entry.
+	if _, err := s2.Set(Label{Serial: "B2"}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s2.Delete("C3"); !ok || err != nil {
+		t.Errorf("Delete = %v, %v", ok, err)
+	}
+	s3, _ := Open(path)
+	if all := s3.All(); len(all) != 1 || all[0].Serial != "A1" {
+		t.Errorf("after removals: %+v", all)
+	}
+	if groups := s3.Groups(); len(groups) != 1 || groups[0].Name != "rack-1" {
+		t.Errorf("groups = %+v", groups)
+	}
+}
+
+func TestStore_Validation(t *testing.T) {
+	s, _ := Open("")
+	if _, err := s.Set(Label{Name: "no serial"}); !errors.Is(err, ErrInvalid) {
+		t.Error("expected error without serial")
+	}
+	tags := make([]string, maxTags+1)
+	for i := range tags {
+		tags[i] = string(rune('a'+i%26)) + string(rune('a'+i/26))
+	}
+	if _, err := s.Set(Label{Serial: "X", Tags: tags}); !errors.Is(err, ErrInvalid) {
+		t.Error("expected error with too many tags")
+	}
+}
+
+func TestOpen_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "labels.json")
+	os.WriteFile(path, []byte("{not json"), 0644)
+	if _, err := Open(path); err == nil {
+		t.Error("expected error for a corrupt file")
+	}
+}
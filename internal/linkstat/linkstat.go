@@ -0,0 +1,178 @@
+// Package linkstat keeps the recent ADB round trips to each device and
+// sums them up as link quality — latency, jitter and failed probes — so
+// devices on a slow or lossy wireless link stand out from USB ones.
+package linkstat
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+// Window is how many recent probes a device's stats cover.
+const Window = 20
+
+// Stats is the link quality of one device over its last Window probes.
+type Stats struct {
+	Serial string   `json:"serial"`
+	Link   adb.Link `json:"link"`
+	// Features are the device's ADB features, read once per connection.
+	Features []string `json:"features,omitempty"`
+
+	// LatencyMs is the latest successful round trip; the others cover the
+	// successful probes in the window. JitterMs is the mean difference
+	// between consecutive round trips.
+	LatencyMs float64 `json:"latency_ms"`
+	AvgMs     float64 `json:"avg_ms"`
+	MinMs     float64 `json:"min_ms"`
+	MaxMs     float64 `json:"max_ms"`
+	JitterMs  float64 `json:"jitter_ms"`
+	// Probes and Failures count the probes in the window and those that
+	// failed; LossPct is their ratio.
+	Probes    int       `json:"probes"`
+	Failures  int       `json:"failures"`
+	LossPct   float64   `json:"loss_pct"`
+	LastProbe time.Time `json:"last_probe"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+type sample struct {
+	rtt time.Duration
+	ok  bool
+}
+
+type deviceState struct {
+	link      adb.Link
+	features  []string
+	samples   []sample // oldest first, at most Window
+	lastProbe time.Time
+	lastError string
+}
+
+// Tracker keeps the probes of every device. It is safe for concurrent use.
+type Tracker struct {
+	mu      sync.Mutex
+	devices map[string]*deviceState
+}
+
+// NewTracker creates an empty tracker.
+func NewTracker() *Tracker {
+	return &Tracker{devices: make(map[string]*deviceState)}
+}
+
+func (t *Tracker) state(serial string) *deviceState {
+	d, ok := t.devices[serial]
+	if !ok {
+		d = &deviceState{}
+		t.devices[serial] = d
+	}
+	return d
+}
+
+// SetLink records how the device is attached and its features.
+func (t *Tracker) SetLink(serial string, link adb.Link, features []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := t.state(serial)
+	d.link = link
+	d.features = features
+}
+
+// Features returns the features recorded by SetLink; ok is false if none
+// were.
+func (t *Tracker) Features(serial string) (features []string, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, ok := t.devices[serial]
+	if !ok || d.features == nil {
+		return nil, false
+	}
+	return d.features, true
+}
+
+// Record adds a probe of the device taken at at: its round trip, or the
+// error it failed with.
+func (t *Tracker) Record(serial string, rtt time.Duration, err error, at time.Time) Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := t.state(serial)
+	d.samples = append(d.samples, sample{rtt: rtt, ok: err == nil})
+	if len(d.samples) > Window {
+		d.samples = d.samples[len(d.samples)-Window:]
+	}
+	d.lastProbe = at
+	d.lastError = ""
+	if err != nil {
+		d.lastError = err.Error()
+	}
+	return d.stats(serial)
+}
+
+// Get returns the stats of the device; ok is false if it was never probed.
+func (t *Tracker) Get(serial string) (Stats, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, ok := t.devices[serial]
+	if !ok || len(d.samples) == 0 {
+		return Stats{}, false
+	}
+	return d.stats(serial), true
+}
+
+// Forget drops a device, whose next connection starts a fresh window.
+func (t *Tracker) Forget(serial string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.devices, serial)
+}
+
+func (d *deviceState) stats(serial string) Stats {
+	st := Stats{
+		Serial:    serial,
+		Link:      d.link,
+		Features:  d.features,
+		Probes:    len(d.samples),
+		LastProbe: d.lastProbe,
+		LastError: d.lastError,
+	}
+	var (
+		n         int
+		sum, diff float64
+		prev      = -1.0
+	)
+	for _, s := range d.samples {
+		if !s.ok {
+			st.Failures++
+			continue
+		}
+		ms := float64(s.rtt.Microseconds()) / 1000
+		if n == 0 || ms < st.MinMs {
+			st.MinMs = ms
+		}
+		st.MaxMs = max(st.MaxMs, ms)
+		if prev >= 0 {
+			diff += math.Abs(ms - prev)
+		}
+		prev = ms
+		sum += ms
+		n++
+		st.LatencyMs = ms
+	}
+	if n > 0 {
+		st.AvgMs = round(sum / float64(n))
+	}
+	if n > 1 {
+		st.JitterMs = round(diff / float64(n-1))
+	}
+	if st.Probes > 0 {
+		st.LossPct = round(100 * float64(st.Failures) / float64(st.Probes))
+	}
+	return st
+}
+
+// round rounds to hundredths.
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
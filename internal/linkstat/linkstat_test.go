@@ -0,0 +1,54 @@
+package linkstat
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+)
+
+func TestTracker_Stats(t *testing.T) {
+	tr := NewTracker()
+	if _, ok := tr.Get("dev"); ok {
+		t.Fatal("unprobed device has stats")
+	}
+	tr.SetLink("dev", adb.LinkTCP, []string{"shell_v2"})
+
+	now := time.Now()
+	tr.Record("dev", 10*time.Millisecond, nil, now)
+	tr.Record("dev", 30*time.Millisecond, nil, now)
+	tr.Record("dev", 0, errors.New("timeout"), now)
+	st := tr.Record("dev", 20*time.Millisecond, nil, now)
+
+	if st.Link != adb.LinkTCP || st.Probes != 4 || st.Failures != 1 || st.LossPct != 25 {
+		t.Errorf("stats = %+v", st)
+	}
+	if st.LatencyMs != 20 || st.MinMs != 10 || st.MaxMs != 30 || st.AvgMs != 20 {
+		t.Errorf("latency = %v (min %v max %v avg %v)", st.LatencyMs, st.MinMs, st.MaxMs, st.AvgMs)
+	}
+	// |30-10| and |20-30| over two intervals.
+	if st.JitterMs != 15 {
+		t.Errorf("jitter = %v, want 15", st.JitterMs)
+	}
+	if st.LastError != "" {
+		t.Errorf("last error = %q after a successful probe", st.LastError)
+	}
+}
+
+func TestTracker_Window(t *testing.T) {
+	tr := NewTracker()
+	now := time.Now()
+	for range Window {
+		tr.Record("dev", 0, errors.New("offline"), now)
+	}
+	st := tr.Record("dev", 5*time.Millisecond, nil, now)
+	if st.Probes != Window || st.Failures != Window-1 {
+		t.Errorf("probes = %d, failures = %d", st.Probes, st.Failures)
+	}
+
+	tr.Forget("dev")
+	if _, ok := tr.Get("dev"); ok {
+		t.Error("forgotten device has stats")
+	}
+}
@@ -3,27 +3,21 @@ package monitor
 import (
 	"context"
 	"log/slog"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/imcanugur/go-adb-monitor/internal/adb"
 	"github.com/imcanugur/go-adb-monitor/internal/event"
 )
 
-// properties to collect from each online device.
-var defaultProps = []string{
-	"ro.product.model",
-	"ro.product.manufacturer",
-	"ro.build.version.release",
-	"ro.build.version.sdk",
-	"ro.build.display.id",
-	"ro.serialno",
-	"ro.hardware",
-	"persist.sys.timezone",
-}
-
 // batteryProps are collected via dumpsys battery.
 const batteryCmd = "dumpsys battery"
 
+// maxParallelShells is how many shell commands of one collection run at
+// once. The ADB server multiplexes them over the device's transport.
+const maxParallelShells = 4
+
 // DeviceMonitor collects properties from a single online device on an interval.
 type DeviceMonitor struct {
 	client   *adb.Client
@@ -31,16 +25,38 @@ type DeviceMonitor struct {
 	log      *slog.Logger
 	serial   string
 	interval time.Duration
+	// props is the set to collect, read anew on every collection.
+	props *PropStore
+
+	// class is detected on the first successful collection; the form
+	// factor does not change while the device stays connected.
+	class adb.DeviceClass
+
+	// prev is the last collected property set, nil before the first.
+	prev map[string]string
+
+	mu sync.Mutex
+	// getprop is every system property read by the last successful
+	// collection, published or not.
+	getprop map[string]string
+	// suppressUnchanged skips the full DeviceProperties event when nothing
+	// changed since the previous collection.
+	suppressUnchanged bool
 }
 
 // NewDeviceMonitor creates a monitor for a specific device.
-func NewDeviceMonitor(client *adb.Client, bus *event.Bus, log *slog.Logger, serial string, interval time.Duration) *DeviceMonitor {
+// It collects props, or DefaultPropSet if props is nil.
+func NewDeviceMonitor(client *adb.Client, bus *event.Bus, log *slog.Logger, serial string, interval time.Duration, props *PropStore) *DeviceMonitor {
+	if props == nil {
+		props, _ = OpenProps("")
+	}
 	return &DeviceMonitor{
 		client:   client,
 		bus:      bus,
 		log:      log.With("component", "device_monitor", "serial", serial),
 		serial:   serial,
 		interval: interval,
+		props:    props,
 	}
 }
 
@@ -66,43 +82,159 @@ func (dm *DeviceMonitor) Run(ctx context.Context) {
 }
 
 func (dm *DeviceMonitor) collect(ctx context.Context) {
-	props := make(map[string]string, len(defaultProps)+5)
-
-	// Collect system properties.
-	for _, prop := range defaultProps {
-		val, err := dm.client.GetDeviceProp(ctx, dm.serial, prop)
-		if err != nil {
-			dm.log.Debug("failed to get property",
-				"prop", prop,
-				"error", err,
-			)
-			continue
-		}
-		if val != "" {
-			props[prop] = val
-		}
-	}
+	set := dm.props.Get()
+	props := make(map[string]string, len(set.Props)+5)
 
-	// Collect battery info.
-	batteryOut, err := dm.client.Shell(ctx, dm.serial, batteryCmd)
+	// Collect system properties, and the device class, from one getprop.
+	all, err := dm.client.GetDeviceProps(ctx, dm.serial)
 	if err != nil {
-		dm.log.Debug("failed to get battery info", "error", err)
+		dm.log.Debug("failed to get properties", "error", err)
+		// A failed read is not a change; keep the last values.
+		all = dm.Getprop()
 	} else {
-		parseBattery(batteryOut, props)
+		dm.mu.Lock()
+		dm.getprop = all
+		dm.mu.Unlock()
+	}
+	for k, v := range all {
+		if v != "" && set.publishes(k) {
+			props[k] = v
+		}
+	}
+
+	if dm.class == adb.ClassUnknown && all != nil {
+		dm.class = adb.ClassifyDevice(all)
+	}
+	if dm.class != adb.ClassUnknown {
+		props["device.class"] = string(dm.class)
 	}
 
+	// The rest are shell commands of their own, run side by side.
+	var sections []section
+	// TV boxes and cars report a fake battery.
+	if dm.class.HasBattery() {
+		sections = append(sections, section{name: "battery", cmd: batteryCmd, prefix: "battery.", parse: parseBattery})
+	}
+	sections = append(sections, section{name: "security", cmd: securityCmd, prefix: SecurityPrefix, parse: parseSecurity})
+	for _, d := range set.Dumpsys {
+		sections = append(sections, section{name: "dumpsys " + d.Service, cmd: "dumpsys " + d.Service, prefix: d.Service + ".", parse: d.parse})
+	}
+	for _, p := range set.Probes {
+		sections = append(sections, section{name: "probe " + p.Name, cmd: p.Command, prefix: p.Name, parse: p.parse})
+	}
+	dm.collectSections(ctx, sections, props)
+
 	if len(props) == 0 {
 		return
 	}
+	dm.publish(props, time.Now())
+}
+
+// Getprop returns every system property read by the last successful
+// collection, nil before it. The map must not be modified.
+func (dm *DeviceMonitor) Getprop() map[string]string {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	return dm.getprop
+}
+
+// section is one shell command of a collection and how its output turns
+// into properties.
+type section struct {
+	name, cmd string
+	// prefix starts the keys the section sets; they keep their previous
+	// values when the command fails.
+	prefix string
+	parse  func(out string, props map[string]string)
+}
+
+// collectSections runs the sections' commands, maxParallelShells at a
+// time, and adds what they parse to props.
+func (dm *DeviceMonitor) collectSections(ctx context.Context, sections []section, props map[string]string) {
+	outs := make([]map[string]string, len(sections))
+	sem := make(chan struct{}, maxParallelShells)
+	var wg sync.WaitGroup
+	for i, s := range sections {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			out := make(map[string]string)
+			res, err := dm.shell(ctx, s.cmd)
+			if err != nil {
+				dm.log.Debug("failed to collect section", "section", s.name, "error", err)
+				dm.keepPrev(out, s.prefix)
+			} else {
+				s.parse(res, out)
+			}
+			outs[i] = out
+		}()
+	}
+	wg.Wait()
+	for _, out := range outs {
+		for k, v := range out {
+			props[k] = v
+		}
+	}
+}
+
+// publish announces props, the changes since the previous collection as
+// DevicePropertiesChanged, those of security properties once more as
+// SecurityPropChanged and, unless suppressed for want of changes, the full
+// set as DeviceProperties.
+func (dm *DeviceMonitor) publish(props map[string]string, now time.Time) {
+	first := dm.prev == nil
+	changes := event.DiffProps(dm.prev, props)
+	dm.prev = props
+
+	if !first && changes != nil {
+		dm.bus.Publish(event.Event{
+			Type:      event.DevicePropertiesChanged,
+			Serial:    dm.serial,
+			Changes:   changes,
+			Timestamp: now,
+		})
+		if sec := securityChanges(changes); sec != nil {
+			dm.bus.Publish(event.Event{
+				Type:      event.SecurityPropChanged,
+				Serial:    dm.serial,
+				Changes:   sec,
+				Timestamp: now,
+			})
+		}
+	}
+	if first || changes != nil || !dm.suppressUnchanged {
+		dm.bus.Publish(event.Event{
+			Type:      event.DeviceProperties,
+			Serial:    dm.serial,
+			Props:     props,
+			Timestamp: now,
+		})
+	}
 
-	dm.bus.Publish(event.Event{
-		Type:      event.DeviceProperties,
-		Serial:    dm.serial,
-		Props:     props,
-		Timestamp: time.Now(),
-	})
+	dm.log.Debug("properties collected", "count", len(props), "changed", len(changes))
+}
 
-	dm.log.Debug("properties collected", "count", len(props))
+// shell runs cmd on the device and returns its standard output.
+func (dm *DeviceMonitor) shell(ctx context.Context, cmd string) (string, error) {
+	res, err := dm.client.ShellV2(ctx, dm.serial, cmd)
+	if err == nil {
+		err = res.Err()
+	}
+	if err != nil {
+		return "", err
+	}
+	return res.Stdout, nil
+}
+
+// keepPrev copies the previous values of the keys starting with prefix
+// into props: a failed read is not a change.
+func (dm *DeviceMonitor) keepPrev(props map[string]string, prefix string) {
+	for k, v := range dm.prev {
+		if strings.HasPrefix(k, prefix) {
+			props[k] = v
+		}
+	}
 }
 
 // parseBattery extracts key battery metrics from dumpsys battery output.
@@ -1,7 +1,12 @@
 package monitor
 
 import (
+	"io"
+	"log/slog"
 	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/event"
 )
 
 func TestParseBattery(t *testing.T) {
@@ -112,3 +117,55 @@ func TestTrimSpace(t *testing.T) {
 		}
 	}
 }
+
+func TestDeviceMonitor_PublishChanges(t *testing.T) {
+	for _, suppress := range []bool{false, true} {
+		bus := event.NewBus(16)
+		events := make(chan event.Event, 16)
+		bus.Subscribe("test", func(e event.Event) { events <- e })
+
+		dm := NewDeviceMonitor(nil, bus, slog.New(slog.NewTextHandler(io.Discard, nil)), "dev1", time.Minute, nil)
+		dm.suppressUnchanged = suppress
+		now := time.Now()
+		dm.publish(map[string]string{"battery.level": "80", "ro.product.model": "Pixel"}, now)
+		dm.publish(map[string]string{"battery.level": "80", "ro.product.model": "Pixel"}, now)
+		dm.publish(map[string]string{"battery.level": "79", "battery.status": "3"}, now)
+
+		var got []event.Type
+		var changes map[string]event.PropChange
+		timeout := time.After(time.Second)
+		want := 4
+		if suppress {
+			want = 3
+		}
+		for len(got) < want {
+			select {
+			case e := <-events:
+				got = append(got, e.Type)
+				if e.Type == event.DevicePropertiesChanged {
+					changes = e.Changes
+				}
+			case <-timeout:
+				t.Fatalf("suppress=%v: got %v, want %d events", suppress, got, want)
+			}
+		}
+		bus.Close()
+
+		if got[0] != event.DeviceProperties || got[len(got)-2] != event.DevicePropertiesChanged {
+			t.Errorf("suppress=%v: events %v", suppress, got)
+		}
+		wantChanges := map[string]event.PropChange{
+			"battery.level":    {Old: "80", New: "79"},
+			"battery.status":   {Old: "", New: "3"},
+			"ro.product.model": {Old: "Pixel", New: ""},
+		}
+		if len(changes) != len(wantChanges) {
+			t.Errorf("suppress=%v: changes %v", suppress, changes)
+		}
+		for k, c := range wantChanges {
+			if changes[k] != c {
+				t.Errorf("suppress=%v: %s = %+v, want %+v", suppress, k, changes[k], c)
+			}
+		}
+	}
+}
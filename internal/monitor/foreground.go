@@ -0,0 +1,80 @@
+package monitor
+
+import "strings"
+
+// ForegroundCmd reads the resumed activity and the focused window. Only the
+// matching lines are sent back; grep's exit status is meaningless here.
+const ForegroundCmd = "dumpsys activity activities | grep -E 'ResumedActivity'; " +
+	"dumpsys window | grep -E 'mCurrentFocus|mFocusedApp'"
+
+// Foreground is the app and activity the user is looking at.
+type Foreground struct {
+	Package  string `json:"package"`
+	Activity string `json:"activity,omitempty"`
+}
+
+// foregroundKeys are the dumpsys fields naming the foreground activity,
+// most reliable first. mCurrentFocus can be a system window (status bar,
+// notification shade) that names no component, so it comes last.
+var foregroundKeys = []string{
+	"topResumedActivity",
+	"mResumedActivity",
+	"ResumedActivity",
+	"mFocusedApp",
+	"mCurrentFocus",
+}
+
+// ParseForeground extracts the foreground component from the output of
+// ForegroundCmd, or of `dumpsys activity top`, whose last ACTIVITY line is
+// the top activity.
+func ParseForeground(output string) (Foreground, bool) {
+	found := make(map[string]Foreground)
+	var top Foreground
+
+	for _, line := range splitLines(output) {
+		line = trimSpace(line)
+		if rest, ok := strings.CutPrefix(line, "ACTIVITY "); ok {
+			if f, ok := parseComponent(strings.Fields(rest)); ok {
+				top = f
+			}
+			continue
+		}
+		for _, key := range foregroundKeys {
+			if !strings.HasPrefix(line, key) {
+				continue
+			}
+			if _, seen := found[key]; seen {
+				break
+			}
+			if f, ok := parseComponent(strings.Fields(line[len(key):])); ok {
+				found[key] = f
+			}
+			break
+		}
+	}
+
+	for _, key := range foregroundKeys {
+		if f, ok := found[key]; ok {
+			return f, true
+		}
+	}
+	return top, top.Package != ""
+}
+
+// parseComponent finds the first "package/activity" field, as printed in
+// ActivityRecord{… u0 com.example/.MainActivity t12} or
+// Window{… u0 com.example/com.example.MainActivity}.
+func parseComponent(fields []string) (Foreground, bool) {
+	for _, f := range fields {
+		f = strings.TrimRight(f, "}")
+		pkg, act, ok := strings.Cut(f, "/")
+		if !ok || pkg == "" || act == "" || !strings.Contains(pkg, ".") || strings.ContainsAny(pkg, "{=:") {
+			continue
+		}
+		if strings.HasPrefix(act, ".") {
+			act = pkg + act
+		}
+		return Foreground{Package: pkg, Activity: act}, true
+	}
+	return Foreground{}, false
+}
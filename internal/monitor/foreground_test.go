@@ -0,0 +1,55 @@
+package monitor
+
+import "testing"
+
+func TestParseForeground(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   Foreground
+		ok     bool
+	}{
+		{
+			name: "android 10+ resumed activity",
+			output: "    topResumedActivity=ActivityRecord{5d1c8f1 u0 com.android.chrome/org.chromium.chrome.browser.ChromeTabbedActivity t12}\n" +
+				"    ResumedActivity: ActivityRecord{5d1c8f1 u0 com.android.chrome/org.chromium.chrome.browser.ChromeTabbedActivity t12}\n" +
+				"  mCurrentFocus=Window{a1b2c3 u0 NotificationShade}\n",
+			want: Foreground{Package: "com.android.chrome", Activity: "org.chromium.chrome.browser.ChromeTabbedActivity"},
+			ok:   true,
+		},
+		{
+			name:   "older devices with relative activity",
+			output: "    mResumedActivity: ActivityRecord{41e1f0 u0 com.google.android.youtube/.HomeActivity t45}\n",
+			want:   Foreground{Package: "com.google.android.youtube", Activity: "com.google.android.youtube.HomeActivity"},
+			ok:     true,
+		},
+		{
+			name: "focused app wins over focused window",
+			output: "  mCurrentFocus=Window{9f8e u0 com.example.popup/com.example.popup.Overlay}\n" +
+				"  mFocusedApp=AppWindowToken{11 token=Token{22 ActivityRecord{33 u0 com.example/.MainActivity t5}}}\n",
+			want: Foreground{Package: "com.example", Activity: "com.example.MainActivity"},
+			ok:   true,
+		},
+		{
+			name: "dumpsys activity top",
+			output: "TASK 10 id=3 userId=0\n" +
+				"  ACTIVITY com.android.launcher3/.uioverrides.QuickstepLauncher 2b1 pid=1200\n" +
+				"TASK 10 id=7 userId=0\n" +
+				"  ACTIVITY com.whatsapp/.HomeActivity 4c2 pid=3301\n",
+			want: Foreground{Package: "com.whatsapp", Activity: "com.whatsapp.HomeActivity"},
+			ok:   true,
+		},
+		{
+			name:   "only a system window",
+			output: "  mCurrentFocus=Window{a1b2c3 u0 StatusBar}\n  mFocusedApp=null\n",
+			ok:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseForeground(tt.output)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%s: got %+v, %v; want %+v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -23,15 +23,26 @@ type Monitor struct {
 	bus          *event.Bus
 	log          *slog.Logger
 	propInterval time.Duration
+	// suppressUnchanged and props are passed on to every DeviceMonitor.
+	suppressUnchanged bool
+	props             *PropStore
 
 	mu          sync.Mutex
 	devices     map[string]context.CancelFunc // serial → cancel per-device monitor
+	monitors    map[string]*DeviceMonitor
 	unsub       func()
 }
 
 // Config holds Monitor configuration.
 type Config struct {
 	PropInterval time.Duration
+	// SuppressUnchanged skips the full DeviceProperties event of a device
+	// when no property changed since its previous collection. Changes are
+	// always published as DevicePropertiesChanged.
+	SuppressUnchanged bool
+	// Props is the set of properties, dumpsys sections and probes to
+	// collect. Nil collects DefaultPropSet.
+	Props *PropStore
 }
 
 // New creates a new Monitor orchestrator.
@@ -40,19 +51,37 @@ func New(client *adb.Client, bus *event.Bus, log *slog.Logger, cfg Config) *Moni
 	if interval <= 0 {
 		interval = DefaultPropInterval
 	}
+	if cfg.Props == nil {
+		cfg.Props, _ = OpenProps("")
+	}
 
 	return &Monitor{
-		client:       client,
-		bus:          bus,
-		log:          log.With("component", "monitor"),
-		propInterval: interval,
-		devices:      make(map[string]context.CancelFunc),
+		client:            client,
+		bus:               bus,
+		log:               log.With("component", "monitor"),
+		propInterval:      interval,
+		suppressUnchanged: cfg.SuppressUnchanged,
+		props:             cfg.Props,
+		devices:           make(map[string]context.CancelFunc),
+		monitors:          make(map[string]*DeviceMonitor),
 	}
 }
 
 // Run starts the monitor orchestrator. It listens for device events and
 // manages per-device monitors. Blocks until ctx is cancelled.
 func (m *Monitor) Run(ctx context.Context) error {
+	m.Start(ctx)
+
+	<-ctx.Done()
+
+	m.shutdown()
+	return ctx.Err()
+}
+
+// Start subscribes to device events and returns; per-device monitors run
+// until ctx is cancelled. Unlike Run, it is subscribed by the time it
+// returns, so a tracker started after it cannot announce devices unseen.
+func (m *Monitor) Start(ctx context.Context) {
 	m.unsub = m.bus.Subscribe("monitor", func(e event.Event) {
 		switch e.Type {
 		case event.DeviceConnected:
@@ -71,11 +100,6 @@ func (m *Monitor) Run(ctx context.Context) error {
 	})
 
 	m.log.Info("monitor orchestrator started")
-
-	<-ctx.Done()
-
-	m.shutdown()
-	return ctx.Err()
 }
 
 // startDevice launches a DeviceMonitor goroutine for the given serial,
@@ -91,7 +115,9 @@ func (m *Monitor) startDevice(parentCtx context.Context, serial string) {
 	ctx, cancel := context.WithCancel(parentCtx)
 	m.devices[serial] = cancel
 
-	dm := NewDeviceMonitor(m.client, m.bus, m.log, serial, m.propInterval)
+	dm := NewDeviceMonitor(m.client, m.bus, m.log, serial, m.propInterval, m.props)
+	dm.suppressUnchanged = m.suppressUnchanged
+	m.monitors[serial] = dm
 	go dm.Run(ctx)
 
 	m.log.Info("started per-device monitor", "serial", serial)
@@ -105,10 +131,25 @@ func (m *Monitor) stopDevice(serial string) {
 	if cancel, ok := m.devices[serial]; ok {
 		cancel()
 		delete(m.devices, serial)
+		delete(m.monitors, serial)
 		m.log.Info("stopped per-device monitor", "serial", serial)
 	}
 }
 
+// Getprop returns every system property of an online device as of its
+// last collection, whether published or not. ok is false when the device
+// is not monitored or none has succeeded yet.
+func (m *Monitor) Getprop(serial string) (props map[string]string, ok bool) {
+	m.mu.Lock()
+	dm := m.monitors[serial]
+	m.mu.Unlock()
+	if dm == nil {
+		return nil, false
+	}
+	props = dm.Getprop()
+	return props, props != nil
+}
+
 // shutdown stops all running device monitors.
 func (m *Monitor) shutdown() {
 	m.mu.Lock()
@@ -119,6 +160,7 @@ func (m *Monitor) shutdown() {
 		m.log.Debug("shutdown: stopped device monitor", "serial", serial)
 	}
 	m.devices = make(map[string]context.CancelFunc)
+	m.monitors = make(map[string]*DeviceMonitor)
 
 	if m.unsub != nil {
 		m.unsub()
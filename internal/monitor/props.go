@@ -0,0 +1,298 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/imcanugur/go-adb-monitor/internal/atomicfile"
+)
+
+const (
+	// maxPropKeys, maxDumpsys and maxProbes bound a PropSet.
+	maxPropKeys = 256
+	maxDumpsys  = 16
+	maxProbes   = 32
+	// maxProbeValue bounds the value a probe yields.
+	maxProbeValue = 256
+)
+
+// ErrInvalidProps indicates a PropSet failed validation.
+var ErrInvalidProps = errors.New("invalid property set")
+
+// propNameRe matches getprop keys, dumpsys services and probe names: they
+// end up on a device shell command line or as property keys.
+var propNameRe = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+
+// PropSet is what each DeviceMonitor collects besides the device class and
+// battery: system properties, "key: value" lines of dumpsys sections and
+// the output of shell probes.
+type PropSet struct {
+	// Props are the getprop keys published, under their own name. A key
+	// ending in "*" publishes every key it prefixes; "*" alone publishes
+	// them all. Whatever is published, the complete getprop map of each
+	// device is kept (see Monitor.Getprop).
+	Props []string `json:"props"`
+	// Dumpsys sections are published as "<service>.<key>", the key
+	// lower-cased with spaces turned into underscores.
+	Dumpsys []DumpsysSection `json:"dumpsys,omitempty"`
+	// Probes are shell commands run on the device.
+	Probes []Probe `json:"probes,omitempty"`
+}
+
+// DumpsysSection selects lines of one dumpsys service.
+type DumpsysSection struct {
+	Service string `json:"service"`
+	// Keys are the keys to keep, as dumpsys prints them; empty keeps
+	// every "key: value" line.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// Probe runs Command on the device and publishes what Parse extracts from
+// its output.
+type Probe struct {
+	// Name is the property key, or its prefix for named groups.
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	// Parse is a regular expression. Each named group is published as
+	// "<name>.<group>"; otherwise the first group, or the whole match,
+	// is published as the name. Empty publishes the trimmed output.
+	// Nothing is published when it does not match.
+	Parse string `json:"parse,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// DefaultPropSet returns the properties collected when none are configured.
+func DefaultPropSet() PropSet {
+	return PropSet{Props: []string{
+		"ro.product.model",
+		"ro.product.manufacturer",
+		"ro.build.version.release",
+		"ro.build.version.sdk",
+		"ro.build.display.id",
+		"ro.serialno",
+		"ro.hardware",
+		"persist.sys.timezone",
+	}}
+}
+
+// publishes reports whether the getprop key is in ps.Props.
+func (ps PropSet) publishes(key string) bool {
+	for _, p := range ps.Props {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok && strings.HasPrefix(key, prefix) || p == key {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize trims ps, drops duplicate keys and compiles the probes.
+func (ps PropSet) normalize() (PropSet, error) {
+	out := PropSet{Props: []string{}}
+	seen := make(map[string]bool)
+	for _, p := range ps.Props {
+		p = strings.TrimSpace(p)
+		if p != "*" && !propNameRe.MatchString(strings.TrimSuffix(p, "*")) {
+			return PropSet{}, fmt.Errorf("%w: property %q", ErrInvalidProps, p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			out.Props = append(out.Props, p)
+		}
+	}
+	for _, d := range ps.Dumpsys {
+		d.Service = strings.TrimSpace(d.Service)
+		if !propNameRe.MatchString(d.Service) {
+			return PropSet{}, fmt.Errorf("%w: dumpsys service %q", ErrInvalidProps, d.Service)
+		}
+		keys := d.Keys
+		d.Keys = nil
+		for _, k := range keys {
+			if k = strings.TrimSpace(k); k != "" {
+				d.Keys = append(d.Keys, k)
+			}
+		}
+		out.Dumpsys = append(out.Dumpsys, d)
+	}
+	names := make(map[string]bool)
+	for _, p := range ps.Probes {
+		p.Name = strings.TrimSpace(p.Name)
+		p.Command = strings.TrimSpace(p.Command)
+		if !propNameRe.MatchString(p.Name) {
+			return PropSet{}, fmt.Errorf("%w: probe name %q", ErrInvalidProps, p.Name)
+		}
+		if names[p.Name] {
+			return PropSet{}, fmt.Errorf("%w: duplicate probe %q", ErrInvalidProps, p.Name)
+		}
+		names[p.Name] = true
+		if p.Command == "" {
+			return PropSet{}, fmt.Errorf("%w: probe %q has no command", ErrInvalidProps, p.Name)
+		}
+		if p.Parse != "" {
+			re, err := regexp.Compile(p.Parse)
+			if err != nil {
+				return PropSet{}, fmt.Errorf("%w: probe %q: %v", ErrInvalidProps, p.Name, err)
+			}
+			p.re = re
+		}
+		out.Probes = append(out.Probes, p)
+	}
+	switch {
+	case len(out.Props) > maxPropKeys:
+		return PropSet{}, fmt.Errorf("%w: more than %d properties", ErrInvalidProps, maxPropKeys)
+	case len(out.Dumpsys) > maxDumpsys:
+		return PropSet{}, fmt.Errorf("%w: more than %d dumpsys sections", ErrInvalidProps, maxDumpsys)
+	case len(out.Probes) > maxProbes:
+		return PropSet{}, fmt.Errorf("%w: more than %d probes", ErrInvalidProps, maxProbes)
+	}
+	return out, nil
+}
+
+// parse adds the selected "key: value" lines of output to props.
+func (d DumpsysSection) parse(output string, props map[string]string) {
+	for _, line := range splitLines(output) {
+		key, value, ok := parseKeyValue(line)
+		if !ok || value == "" {
+			continue
+		}
+		if len(d.Keys) > 0 && !containsFold(d.Keys, key) {
+			continue
+		}
+		props[d.Service+"."+propKey(key)] = value
+	}
+}
+
+// parse adds what p extracts from output to props.
+func (p Probe) parse(output string, props map[string]string) {
+	if p.re == nil {
+		if v := strings.TrimSpace(output); v != "" {
+			props[p.Name] = truncate(v, maxProbeValue)
+		}
+		return
+	}
+	m := p.re.FindStringSubmatch(output)
+	if m == nil {
+		return
+	}
+	named := false
+	for i, group := range p.re.SubexpNames() {
+		if i > 0 && group != "" {
+			named = true
+			if m[i] != "" {
+				props[p.Name+"."+group] = truncate(strings.TrimSpace(m[i]), maxProbeValue)
+			}
+		}
+	}
+	if named {
+		return
+	}
+	v := m[0]
+	if len(m) > 1 {
+		v = m[1]
+	}
+	if v = strings.TrimSpace(v); v != "" {
+		props[p.Name] = truncate(v, maxProbeValue)
+	}
+}
+
+// PropStore holds the PropSet of a deployment, persisted to a JSON file so
+// changes made over the API survive restarts. It is safe for concurrent use.
+type PropStore struct {
+	path string
+
+	mu  sync.RWMutex
+	set PropSet
+}
+
+// OpenProps loads the PropSet kept at path. A missing file, or an empty
+// path, gives DefaultPropSet; an empty path keeps changes in memory only.
+func OpenProps(path string) (*PropStore, error) {
+	s := &PropStore{path: path, set: DefaultPropSet()}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read property set: %w", err)
+	}
+	var ps PropSet
+	if err := json.Unmarshal(data, &ps); err != nil {
+		return nil, fmt.Errorf("parse property set %s: %w", path, err)
+	}
+	if s.set, err = ps.normalize(); err != nil {
+		return nil, fmt.Errorf("property set %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Path returns the file the PropSet is saved to, or "" if in memory.
+func (s *PropStore) Path() string {
+	return s.path
+}
+
+// Get returns the current PropSet.
+func (s *PropStore) Get() PropSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.set
+}
+
+// Set validates ps, saves it and makes it the set collected from the next
+// collection of each device on. It returns the set as stored.
+func (s *PropStore) Set(ps PropSet) (PropSet, error) {
+	ps, err := ps.normalize()
+	if err != nil {
+		return PropSet{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.save(ps); err != nil {
+		return PropSet{}, err
+	}
+	s.set = ps
+	return ps, nil
+}
+
+func (s *PropStore) save(ps PropSet) error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(ps, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := atomicfile.WriteFile(s.path, append(data, '\n')); err != nil {
+		return fmt.Errorf("save property set: %w", err)
+	}
+	return nil
+}
+
+// propKey turns a dumpsys key into a property key segment.
+func propKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), " ", "_")
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,140 @@
+package monitor
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestPropSet_Validate(t *testing.T) {
+	bad := []PropSet{
+		{Props: []string{"ro.product.model; reboot"}},
+		{Props: []string{"ro.*.model"}},
+		{Dumpsys: []DumpsysSection{{Service: "battery && id"}}},
+		{Probes: []Probe{{Name: "fan", Command: ""}}},
+		{Probes: []Probe{{Name: "fan", Command: "cat /sys/fan", Parse: "("}}},
+		{Probes: []Probe{{Name: "fan", Command: "a"}, {Name: "fan", Command: "b"}}},
+	}
+	for _, ps := range bad {
+		if _, err := ps.normalize(); !errors.Is(err, ErrInvalidProps) {
+			t.Errorf("%+v: err = %v, want ErrInvalidProps", ps, err)
+		}
+	}
+
+	ps, err := PropSet{Props: []string{" ro.hardware ", "ro.hardware", "vendor.oem.sku"}}.normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps.Props) != 2 || ps.Props[0] != "ro.hardware" || ps.Props[1] != "vendor.oem.sku" {
+		t.Errorf("props = %v", ps.Props)
+	}
+}
+
+func TestPropSet_Publishes(t *testing.T) {
+	ps, err := PropSet{Props: []string{"ro.hardware", "ro.build.*"}}.normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{
+		"ro.hardware":          true,
+		"ro.hardware.egl":      false,
+		"ro.build.version.sdk": true,
+		"ro.build":             false,
+		"persist.sys.timezone": false,
+	} {
+		if got := ps.publishes(key); got != want {
+			t.Errorf("publishes(%q) = %v, want %v", key, got, want)
+		}
+	}
+
+	all, err := PropSet{Props: []string{"*"}}.normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !all.publishes("persist.sys.timezone") {
+		t.Error(`"*" does not publish every key`)
+	}
+}
+
+func TestDumpsysSection_Parse(t *testing.T) {
+	out := `Thermal Status: 2
+Cached temperatures:
+  Temperature{mValue=38.1, mType=0, mName=CPU}
+HAL Ready: true`
+
+	props := map[string]string{}
+	DumpsysSection{Service: "thermalservice", Keys: []string{"thermal status"}}.parse(out, props)
+	if len(props) != 1 || props["thermalservice.thermal_status"] != "2" {
+		t.Errorf("selected keys: %v", props)
+	}
+
+	props = map[string]string{}
+	DumpsysSection{Service: "thermalservice"}.parse(out, props)
+	if props["thermalservice.thermal_status"] != "2" || props["thermalservice.hal_ready"] != "true" {
+		t.Errorf("all keys: %v", props)
+	}
+	if _, ok := props["thermalservice.cached_temperatures"]; ok {
+		t.Errorf("empty value kept: %v", props)
+	}
+}
+
+func TestProbe_Parse(t *testing.T) {
+	compile := func(p Probe) Probe {
+		ps, err := PropSet{Probes: []Probe{p}}.normalize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ps.Probes[0]
+	}
+	tests := []struct {
+		probe  Probe
+		output string
+		want   map[string]string
+	}{
+		{Probe{Name: "oem.fan", Command: "cat /sys/fan"}, "  1200\n", map[string]string{"oem.fan": "1200"}},
+		{Probe{Name: "oem.fan", Command: "x", Parse: `rpm=(\d+)`}, "state=on rpm=900", map[string]string{"oem.fan": "900"}},
+		{Probe{Name: "uptime", Command: "uptime", Parse: `up \S+`}, "12:00 up 3d, load", map[string]string{"uptime": "up 3d,"}},
+		{Probe{Name: "mem", Command: "x", Parse: `MemTotal:\s+(?P<total>\d+).*\nMemFree:\s+(?P<free>\d+)`},
+			"MemTotal:  4000 kB\nMemFree:   1000 kB", map[string]string{"mem.total": "4000", "mem.free": "1000"}},
+		{Probe{Name: "oem.fan", Command: "x", Parse: `rpm=(\d+)`}, "fan off", map[string]string{}},
+	}
+	for _, tt := range tests {
+		props := map[string]string{}
+		compile(tt.probe).parse(tt.output, props)
+		if len(props) != len(tt.want) {
+			t.Errorf("%s %q: got %v, want %v", tt.probe.Parse, tt.output, props, tt.want)
+			continue
+		}
+		for k, v := range tt.want {
+			if props[k] != v {
+				t.Errorf("%s %q: %s = %q, want %q", tt.probe.Parse, tt.output, k, props[k], v)
+			}
+		}
+	}
+}
+
+func TestPropStore_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "props.json")
+	s, err := OpenProps(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Get(); len(got.Props) != len(DefaultPropSet().Props) {
+		t.Fatalf("missing file: %+v", got)
+	}
+	if _, err := s.Set(PropSet{Props: []string{"1"}, Probes: []Probe{{Name: "x", Command: "id"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Set(PropSet{Props: []string{"$(id)"}}); !errors.Is(err, ErrInvalidProps) {
+		t.Fatalf("invalid set: err = %v", err)
+	}
+
+	s, err = OpenProps(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := s.Get()
+	if len(got.Props) != 1 || got.Props[0] != "1" || len(got.Probes) != 1 || got.Probes[0].Command != "id" {
+		t.Errorf("reloaded: %+v", got)
+	}
+}
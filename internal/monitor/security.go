@@ -0,0 +1,101 @@
+package monitor
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+// SecurityPrefix starts the keys of the security-relevant properties every
+// DeviceMonitor collects, whatever its PropSet. Their changes are also
+// published on their own as SecurityPropChanged:
+//
+//	security.developer_options  enabled, disabled
+//	security.adb_wifi           enabled, disabled (wireless debugging)
+//	security.adb_tcp_port       port adbd listens on, or disabled
+//	security.selinux            enforcing, permissive, disabled
+//	security.verified_boot      green, yellow, orange, red
+//	security.bootloader         locked, unlocked
+//	security.vpn                active, inactive
+//
+// A key the device does not report is left out.
+const SecurityPrefix = "security."
+
+// securityCmd prints the raw security state as key=value lines in one
+// shell round trip. settings prints "null" for an unset setting.
+const securityCmd = `echo "developer_options=$(settings get global development_settings_enabled 2>/dev/null)"; ` +
+	`echo "adb_wifi=$(settings get global adb_wifi_enabled 2>/dev/null)"; ` +
+	`echo "adb_tcp_port=$(getprop service.adb.tcp.port)"; ` +
+	`echo "selinux=$(getenforce 2>/dev/null)"; ` +
+	`echo "verified_boot=$(getprop ro.boot.verifiedbootstate)"; ` +
+	`echo "vbmeta_state=$(getprop ro.boot.vbmeta.device_state)"; ` +
+	`echo "flash_locked=$(getprop ro.boot.flash.locked)"; ` +
+	`echo "vpn_links=$(ls /sys/class/net 2>/dev/null | grep -cE '^(tun|ppp|ipsec)')"`
+
+// parseSecurity turns securityCmd output into the SecurityPrefix keys.
+func parseSecurity(out string, props map[string]string) {
+	raw := make(map[string]string)
+	for _, line := range splitLines(out) {
+		if k, v, ok := strings.Cut(trimSpace(line), "="); ok {
+			if v = trimSpace(v); v != "null" {
+				raw[k] = v
+			}
+		}
+	}
+	set := func(key, value string) {
+		if value != "" {
+			props[SecurityPrefix+key] = value
+		}
+	}
+	set("developer_options", onOff(raw["developer_options"]))
+	set("adb_wifi", onOff(raw["adb_wifi"]))
+	if port, err := strconv.Atoi(raw["adb_tcp_port"]); err == nil && port > 0 {
+		set("adb_tcp_port", strconv.Itoa(port))
+	} else {
+		set("adb_tcp_port", "disabled")
+	}
+	set("selinux", strings.ToLower(raw["selinux"]))
+	set("verified_boot", raw["verified_boot"])
+	switch {
+	case raw["vbmeta_state"] != "":
+		set("bootloader", raw["vbmeta_state"])
+	case raw["flash_locked"] == "1":
+		set("bootloader", "locked")
+	case raw["flash_locked"] == "0":
+		set("bootloader", "unlocked")
+	}
+	if n, err := strconv.Atoi(raw["vpn_links"]); err == nil {
+		if n > 0 {
+			set("vpn", "active")
+		} else {
+			set("vpn", "inactive")
+		}
+	}
+}
+
+// onOff names the value of a boolean setting.
+func onOff(v string) string {
+	switch v {
+	case "1":
+		return "enabled"
+	case "0":
+		return "disabled"
+	}
+	return ""
+}
+
+// securityChanges returns the changes of SecurityPrefix keys, or nil if
+// there are none.
+func securityChanges(changes map[string]event.PropChange) map[string]event.PropChange {
+	var out map[string]event.PropChange
+	for k, c := range changes {
+		if strings.HasPrefix(k, SecurityPrefix) {
+			if out == nil {
+				out = make(map[string]event.PropChange)
+			}
+			out[k] = c
+		}
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+func TestParseSecurity(t *testing.T) {
+	out := "developer_options=1\r\nadb_wifi=null\nadb_tcp_port=5555\nselinux=Permissive\n" +
+		"verified_boot=orange\nvbmeta_state=\nflash_locked=0\nvpn_links=1\n"
+	props := make(map[string]string)
+	parseSecurity(out, props)
+	want := map[string]string{
+		"security.developer_options": "enabled",
+		"security.adb_tcp_port":      "5555",
+		"security.selinux":           "permissive",
+		"security.verified_boot":     "orange",
+		"security.bootloader":        "unlocked",
+		"security.vpn":               "active",
+	}
+	if len(props) != len(want) {
+		t.Errorf("props = %v", props)
+	}
+	for k, v := range want {
+		if props[k] != v {
+			t.Errorf("%s = %q, want %q", k, props[k], v)
+		}
+	}
+
+	props = make(map[string]string)
+	parseSecurity("developer_options=0\nadb_wifi=0\nadb_tcp_port=-1\nvbmeta_state=locked\nvpn_links=0\n", props)
+	for k, v := range map[string]string{
+		"security.developer_options": "disabled",
+		"security.adb_wifi":          "disabled",
+		"security.adb_tcp_port":      "disabled",
+		"security.bootloader":        "locked",
+		"security.vpn":               "inactive",
+	} {
+		if props[k] != v {
+			t.Errorf("%s = %q, want %q", k, props[k], v)
+		}
+	}
+}
+
+func TestDeviceMonitor_SecurityChanges(t *testing.T) {
+	bus := event.NewBus(16)
+	events := make(chan event.Event, 16)
+	bus.Subscribe("test", func(e event.Event) { events <- e })
+	defer bus.Close()
+
+	dm := NewDeviceMonitor(nil, bus, slog.New(slog.NewTextHandler(io.Discard, nil)), "dev1", time.Minute, nil)
+	dm.suppressUnchanged = true
+	now := time.Now()
+	dm.publish(map[string]string{"battery.level": "80", "security.selinux": "enforcing"}, now)
+	dm.publish(map[string]string{"battery.level": "79", "security.selinux": "enforcing"}, now)
+	dm.publish(map[string]string{"battery.level": "79", "security.selinux": "permissive", "security.vpn": "active"}, now)
+
+	var sec []event.Event
+	timeout := time.After(time.Second)
+	for n := 0; n < 6; n++ {
+		select {
+		case e := <-events:
+			if e.Type == event.SecurityPropChanged {
+				sec = append(sec, e)
+			}
+		case <-timeout:
+			t.Fatalf("got %d events, want 6", n)
+		}
+	}
+	if len(sec) != 1 {
+		t.Fatalf("security events = %+v", sec)
+	}
+	want := map[string]event.PropChange{
+		"security.selinux": {Old: "enforcing", New: "permissive"},
+		"security.vpn":     {Old: "", New: "active"},
+	}
+	if len(sec[0].Changes) != len(want) {
+		t.Errorf("changes = %v", sec[0].Changes)
+	}
+	for k, c := range want {
+		if sec[0].Changes[k] != c {
+			t.Errorf("%s = %+v, want %+v", k, sec[0].Changes[k], c)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package netstate reads which network a device is on — the transport of
+// its default network, the Wi-Fi SSID, link speed and signal, and whether a
+// VPN is up — from `dumpsys connectivity` and `dumpsys wifi`.
+package netstate
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cmd prints the lines of both dumps that Parse reads. The full dumps run
+// to hundreds of kilobytes, so they are filtered on the device.
+const Cmd = "dumpsys connectivity | grep -E 'Active default network|NetworkAgentInfo'; " +
+	"echo '" + wifiMarker + "'; dumpsys wifi | grep -m 1 mWifiInfo"
+
+const wifiMarker = "--- wifi"
+
+// Network types.
+const (
+	TypeWifi      = "wifi"
+	TypeCellular  = "cellular"
+	TypeEthernet  = "ethernet"
+	TypeBluetooth = "bluetooth"
+	TypeNone      = "none"
+)
+
+// State is the network state of a device.
+type State struct {
+	// Type is the transport of the default network, one of the Type
+	// constants, or the lower-cased transport name for others.
+	Type string `json:"type"`
+	// VPN is true while any VPN network is connected.
+	VPN bool `json:"vpn"`
+	// The Wi-Fi fields are set while Wi-Fi is associated, even if another
+	// network is the default. SSID is empty where Android hides it from
+	// the shell user.
+	SSID          string `json:"ssid,omitempty"`
+	RSSI          int    `json:"rssi_dbm,omitempty"`
+	LinkSpeedMbps int    `json:"link_speed_mbps,omitempty"`
+	FrequencyMHz  int    `json:"frequency_mhz,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Same reports whether s and o describe the same network, ignoring when
+// they were read.
+func (s State) Same(o State) bool {
+	s.UpdatedAt, o.UpdatedAt = time.Time{}, time.Time{}
+	return s == o
+}
+
+var (
+	// Android 10 and later print "NetworkAgentInfo{network{100} ...",
+	// earlier releases "NetworkAgentInfo [WIFI () - 100] ...".
+	netIDPattern      = regexp.MustCompile(`network\{(\d+)\}|NetworkAgentInfo \[[^\]]*- (\d+)\]`)
+	transportsPattern = regexp.MustCompile(`Transports: ([A-Z_|]+)`)
+)
+
+// Parse reads the output of Cmd. ok is false if it holds neither dump.
+func Parse(out string) (s State, ok bool) {
+	conn, wifi, _ := strings.Cut(out, wifiMarker)
+
+	var (
+		defaultID string
+		types     = make(map[string]string) // network ID -> type
+		firstType string
+	)
+	for _, line := range strings.Split(conn, "\n") {
+		line = strings.TrimSpace(line)
+		if v, found := strings.CutPrefix(line, "Active default network:"); found {
+			defaultID = strings.TrimSpace(v)
+			ok = true
+			continue
+		}
+		if !strings.HasPrefix(line, "NetworkAgentInfo") {
+			continue
+		}
+		id := netIDPattern.FindStringSubmatch(line)
+		m := transportsPattern.FindStringSubmatch(line)
+		if id == nil || m == nil {
+			continue
+		}
+		ok = true
+		transports := strings.Split(m[1], "|")
+		t := transportType(transports)
+		for _, tr := range transports {
+			if tr == "VPN" {
+				s.VPN = true
+			}
+		}
+		types[id[1]+id[2]] = t
+		if firstType == "" {
+			firstType = t
+		}
+	}
+
+	s.Type = TypeNone
+	if t, found := types[defaultID]; found {
+		s.Type = t
+	}
+	// A VPN that reports no underlying transport hides the network it
+	// runs over; take the first other one.
+	if s.Type == "" {
+		s.Type = firstType
+	}
+	if s.Type == "" {
+		s.Type = TypeNone
+	}
+
+	if line := strings.TrimSpace(wifi); strings.HasPrefix(line, "mWifiInfo") {
+		ok = true
+		parseWifiInfo(strings.TrimPrefix(line, "mWifiInfo"), &s)
+	}
+	return s, ok
+}
+
+// transportType names the network of a transport list such as
+// "WIFI|VPN", or returns "" for a VPN alone.
+func transportType(transports []string) string {
+	for _, want := range []string{"WIFI", "CELLULAR", "ETHERNET", "BLUETOOTH"} {
+		for _, tr := range transports {
+			if tr == want {
+				return strings.ToLower(want)
+			}
+		}
+	}
+	for _, tr := range transports {
+		if tr != "VPN" && tr != "" {
+			return strings.ToLower(tr)
+		}
+	}
+	return ""
+}
+
+// parseWifiInfo reads the "Key: value, Key: value" fields of WifiInfo's
+// string form, leaving s alone unless Wi-Fi is associated.
+func parseWifiInfo(info string, s *State) {
+	fields := make(map[string]string)
+	for _, f := range strings.Split(info, ", ") {
+		key, value, found := strings.Cut(f, ": ")
+		if found {
+			fields[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	if fields["Supplicant state"] != "COMPLETED" {
+		return
+	}
+	if ssid := strings.Trim(fields["SSID"], `"`); ssid != "<unknown ssid>" {
+		s.SSID = ssid
+	}
+	// -127 is WifiInfo.INVALID_RSSI.
+	if n, err := strconv.Atoi(fields["RSSI"]); err == nil && n > -127 {
+		s.RSSI = n
+	}
+	if n, err := strconv.Atoi(strings.TrimSuffix(fields["Link speed"], "Mbps")); err == nil && n > 0 {
+		s.LinkSpeedMbps = n
+	}
+	if n, err := strconv.Atoi(strings.TrimSuffix(fields["Frequency"], "MHz")); err == nil && n > 0 {
+		s.FrequencyMHz = n
+	}
+}
+
+// Tracker keeps the latest state of each device. It is safe for concurrent
+// use.
+type Tracker struct {
+	mu      sync.Mutex
+	devices map[string]State
+}
+
+// NewTracker creates an empty tracker.
+func NewTracker() *Tracker {
+	return &Tracker{devices: make(map[string]State)}
+}
+
+// Update stores the device's state and reports whether it differs from the
+// previous one.
+func (t *Tracker) Update(serial string, s State) (changed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	prev, ok := t.devices[serial]
+	t.devices[serial] = s
+	return !ok || !prev.Same(s)
+}
+
+// Get returns the latest state of the device.
+func (t *Tracker) Get(serial string) (State, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.devices[serial]
+	return s, ok
+}
@@ -0,0 +1,82 @@
+package netstate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want State
+	}{
+		{
+			name: "wifi, android 12",
+			out: `Active default network: 100
+  NetworkAgentInfo{network{100}  handle{432902426637}  ni{WIFI CONNECTED extra: } Score(60 ; Policies : IS_VALIDATED)  nc{[ Transports: WIFI Capabilities: NOT_METERED&INTERNET&NOT_RESTRICTED&TRUSTED&NOT_VPN&VALIDATED LinkUpBandwidth>=13000Kbps SSID: "lab-5g"]}}
+--- wifi
+mWifiInfo SSID: "lab-5g", BSSID: 02:00:00:00:00:00, MAC: 02:00:00:00:00:00, Supplicant state: COMPLETED, Wi-Fi standard: 11ac, RSSI: -58, Link speed: 433Mbps, Tx Link speed: 433Mbps, Rx Link speed: 390Mbps, Frequency: 5180MHz, Net ID: 0
+`,
+			want: State{Type: TypeWifi, SSID: "lab-5g", RSSI: -58, LinkSpeedMbps: 433, FrequencyMHz: 5180},
+		},
+		{
+			name: "cellular with vpn, android 9",
+			out: `Active default network: 104
+  NetworkAgentInfo [MOBILE (LTE) - 101] nc{[ Transports: CELLULAR Capabilities: INTERNET&NOT_RESTRICTED]}
+  NetworkAgentInfo [VPN () - 104] nc{[ Transports: CELLULAR|VPN Capabilities: INTERNET&NOT_RESTRICTED]}
+--- wifi
+mWifiInfo SSID: <unknown ssid>, BSSID: <none>, MAC: 02:00:00:00:00:00, Supplicant state: DISCONNECTED, RSSI: -127, Link speed: -1Mbps, Frequency: -1MHz
+`,
+			want: State{Type: TypeCellular, VPN: true},
+		},
+		{
+			name: "vpn without underlying transport",
+			out: `Active default network: 105
+  NetworkAgentInfo{network{103}  nc{[ Transports: ETHERNET Capabilities: INTERNET]}}
+  NetworkAgentInfo{network{105}  nc{[ Transports: VPN Capabilities: INTERNET]}}
+--- wifi
+`,
+			want: State{Type: TypeEthernet, VPN: true},
+		},
+		{
+			name: "no network",
+			out:  "Active default network: none\n--- wifi\n",
+			want: State{Type: TypeNone},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Parse(tt.out)
+			if !ok {
+				t.Fatal("ok = false")
+			}
+			if !got.Same(tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := Parse("Can't find service: connectivity\n--- wifi\n"); ok {
+		t.Error("expected ok=false without either dump")
+	}
+}
+
+func TestTracker_Update(t *testing.T) {
+	tr := NewTracker()
+	s := State{Type: TypeWifi, SSID: "lab", UpdatedAt: time.Now()}
+	if !tr.Update("dev1", s) {
+		t.Error("first state should be a change")
+	}
+	s.UpdatedAt = s.UpdatedAt.Add(time.Minute)
+	if tr.Update("dev1", s) {
+		t.Error("same network read later should not be a change")
+	}
+	s.VPN = true
+	if !tr.Update("dev1", s) {
+		t.Error("VPN coming up should be a change")
+	}
+	if got, ok := tr.Get("dev1"); !ok || !got.VPN {
+		t.Errorf("Get = %+v, %v", got, ok)
+	}
+}
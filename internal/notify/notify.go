@@ -0,0 +1,557 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/atomicfile"
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+// Trigger names a condition that can fire a webhook.
+type Trigger string
+
+const (
+	// TriggerDeviceDisconnected fires when a device drops off the ADB server.
+	TriggerDeviceDisconnected Trigger = "device_disconnected"
+	// TriggerDeviceUnauthorized fires when a device shows up (or transitions)
+	// in the unauthorized state.
+	TriggerDeviceUnauthorized Trigger = "device_unauthorized"
+	// TriggerCaptureErrorSpike fires when a capture's error rate exceeds the
+	// configured threshold.
+	TriggerCaptureErrorSpike Trigger = "capture_error_spike"
+	// TriggerCaptureDegraded fires when a capture stream dies and is being
+	// restarted, or the capture falls back to a weaker mode.
+	TriggerCaptureDegraded Trigger = "capture_degraded"
+	// TriggerTrafficAnomaly fires when a device or app talks to a new
+	// destination or its traffic strays from its learned baseline.
+	TriggerTrafficAnomaly Trigger = "traffic_anomaly"
+	// TriggerCaptureBattery fires when a capture drains its device's
+	// battery fast, or is paused because the battery ran low.
+	TriggerCaptureBattery Trigger = "capture_battery"
+)
+
+// knownTriggers lists every trigger a webhook may subscribe to.
+var knownTriggers = map[Trigger]struct{}{
+	TriggerDeviceDisconnected: {},
+	TriggerDeviceUnauthorized: {},
+	TriggerCaptureErrorSpike:  {},
+	TriggerCaptureDegraded:    {},
+	TriggerTrafficAnomaly:     {},
+	TriggerCaptureBattery:     {},
+}
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the request body,
+	// prefixed with "sha256=", when the webhook has a secret.
+	SignatureHeader = "X-ADB-Monitor-Signature"
+	// TriggerHeader names the trigger that fired.
+	TriggerHeader = "X-ADB-Monitor-Trigger"
+
+	defaultMaxAttempts = 5
+	defaultBaseDelay   = 1 * time.Second
+	defaultMaxDelay    = 30 * time.Second
+	defaultTimeout     = 10 * time.Second
+	// queueSize is how many deliveries may wait for each webhook.
+	queueSize = 256
+)
+
+var (
+	// ErrNotFound indicates no webhook exists with the given ID.
+	ErrNotFound = errors.New("webhook not found")
+	// ErrInvalid indicates a webhook definition failed validation.
+	ErrInvalid = errors.New("invalid webhook")
+)
+
+// Webhook is a configured notification target.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Triggers  []Trigger `json:"triggers"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// wants reports whether the webhook subscribes to t. An empty trigger list
+// subscribes to everything.
+func (w Webhook) wants(t Trigger) bool {
+	if len(w.Triggers) == 0 {
+		return true
+	}
+	for _, wt := range w.Triggers {
+		if wt == t {
+			return true
+		}
+	}
+	return false
+}
+
+// redacted returns a copy safe to expose over the API.
+func (w Webhook) redacted() Webhook {
+	if w.Secret != "" {
+		w.Secret = "********"
+	}
+	return w
+}
+
+// Notification is the JSON body POSTed to webhooks.
+type Notification struct {
+	Trigger   Trigger           `json:"trigger"`
+	Serial    string            `json:"serial,omitempty"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// Config tunes delivery behaviour.
+type Config struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Timeout     time.Duration
+}
+
+// delivery is a queued notification for a single webhook. The webhook is
+// looked up again at every attempt, so an edit applies to what is queued.
+type delivery struct {
+	hookID string
+	body   []byte
+	n      Notification
+}
+
+// Notifier delivers notifications to configured webhooks. Deliveries are
+// queued and sent with exponential backoff retries, so publishers never
+// block on slow endpoints. Every webhook has its own queue and worker: one
+// endpoint that is down delays and drops only its own notifications.
+type Notifier struct {
+	log    *slog.Logger
+	cfg    Config
+	client *http.Client
+	path   string
+
+	mu     sync.RWMutex
+	hooks  map[string]Webhook
+	queues map[string]*hookQueue
+	nextID int
+	// configured are the webhooks given at startup, which are not saved
+	// since they are given again at the next start.
+	configured map[string]bool
+	// ctx is Run's context once it started; the workers of webhooks added
+	// later start under it.
+	ctx context.Context
+}
+
+// hookQueue holds the deliveries of one webhook for its worker.
+type hookQueue struct {
+	ch chan delivery
+	// stop ends the worker when the webhook is removed; nil until the
+	// worker starts.
+	stop context.CancelFunc
+}
+
+// New creates a notifier that keeps its webhooks in memory only. Call Run to
+// start delivering.
+func New(log *slog.Logger, cfg Config) *Notifier {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = defaultBaseDelay
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = defaultMaxDelay
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	return &Notifier{
+		log:        log.With("component", "notify"),
+		cfg:        cfg,
+		client:     &http.Client{Timeout: cfg.Timeout},
+		hooks:      make(map[string]Webhook),
+		queues:     make(map[string]*hookQueue),
+		configured: make(map[string]bool),
+	}
+}
+
+// Open creates a notifier with the webhooks kept at path, which it saves
+// them to as they change. A missing file has no webhooks; an empty path
+// keeps them in memory only.
+func Open(log *slog.Logger, cfg Config, path string) (*Notifier, error) {
+	n := New(log, cfg)
+	n.path = path
+	if path == "" {
+		return n, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return n, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read webhooks: %w", err)
+	}
+	var list []Webhook
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse webhooks %s: %w", path, err)
+	}
+	for _, w := range list {
+		seq, err := strconv.Atoi(strings.TrimPrefix(w.ID, "wh-"))
+		_, dup := n.hooks[w.ID]
+		if err != nil || dup || validate(w) != nil {
+			n.log.Warn("ignoring saved webhook", "id", w.ID, "url", w.URL)
+			continue
+		}
+		n.nextID = max(n.nextID, seq)
+		n.addLocked(w)
+	}
+	return n, nil
+}
+
+// Add validates and registers a webhook, assigning it an ID, and saves it.
+func (n *Notifier) Add(w Webhook) (Webhook, error) {
+	return n.add(w, false)
+}
+
+// AddConfigured registers a webhook given at startup. It works like one
+// added with Add but is not saved.
+func (n *Notifier) AddConfigured(w Webhook) (Webhook, error) {
+	return n.add(w, true)
+}
+
+func (n *Notifier) add(w Webhook, configured bool) (Webhook, error) {
+	if err := validate(w); err != nil {
+		return Webhook{}, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.nextID++
+	w.ID = "wh-" + strconv.Itoa(n.nextID)
+	w.CreatedAt = time.Now()
+	n.hooks[w.ID] = w
+	if configured {
+		n.configured[w.ID] = true
+	} else if err := n.saveLocked(); err != nil {
+		delete(n.hooks, w.ID)
+		n.nextID--
+		return Webhook{}, err
+	}
+	n.addLocked(w)
+	return w.redacted(), nil
+}
+
+// addLocked registers w and its queue, starting its worker if Run has.
+func (n *Notifier) addLocked(w Webhook) {
+	n.hooks[w.ID] = w
+	q := &hookQueue{ch: make(chan delivery, queueSize)}
+	n.queues[w.ID] = q
+	if n.ctx != nil {
+		n.startLocked(q)
+	}
+}
+
+// Update replaces the webhook with the given ID. An empty secret keeps the
+// existing one so clients can edit a hook without re-sending it.
+func (n *Notifier) Update(id string, w Webhook) (Webhook, error) {
+	if err := validate(w); err != nil {
+		return Webhook{}, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	prev, ok := n.hooks[id]
+	if !ok {
+		return Webhook{}, ErrNotFound
+	}
+	w.ID = id
+	w.CreatedAt = prev.CreatedAt
+	if w.Secret == "" {
+		w.Secret = prev.Secret
+	}
+	n.hooks[id] = w
+	if err := n.saveLocked(); err != nil {
+		n.hooks[id] = prev
+		return Webhook{}, err
+	}
+	return w.redacted(), nil
+}
+
+// Remove deletes a webhook.
+func (n *Notifier) Remove(id string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	prev, ok := n.hooks[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(n.hooks, id)
+	if err := n.saveLocked(); err != nil {
+		n.hooks[id] = prev
+		return err
+	}
+	delete(n.configured, id)
+	if q := n.queues[id]; q.stop != nil {
+		q.stop()
+	}
+	delete(n.queues, id)
+	return nil
+}
+
+// saveLocked writes the webhooks that are not configured at startup to the
+// notifier's file, if it has one.
+func (n *Notifier) saveLocked() error {
+	if n.path == "" {
+		return nil
+	}
+	list := make([]Webhook, 0, len(n.hooks))
+	for _, w := range n.hooks {
+		if !n.configured[w.ID] {
+			list = append(list, w)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(n.path, append(data, '\n')); err != nil {
+		return fmt.Errorf("save webhooks: %w", err)
+	}
+	return nil
+}
+
+// Get returns a webhook by ID with its secret redacted.
+func (n *Notifier) Get(id string) (Webhook, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	w, ok := n.hooks[id]
+	if !ok {
+		return Webhook{}, ErrNotFound
+	}
+	return w.redacted(), nil
+}
+
+// List returns all webhooks ordered by creation, secrets redacted.
+func (n *Notifier) List() []Webhook {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	hooks := make([]Webhook, 0, len(n.hooks))
+	for _, w := range n.hooks {
+		hooks = append(hooks, w.redacted())
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].CreatedAt.Before(hooks[j].CreatedAt)
+	})
+	return hooks
+}
+
+// Notify queues a notification for every enabled webhook subscribed to its
+// trigger. It never blocks; if a webhook's queue is full the delivery to it
+// is dropped.
+func (n *Notifier) Notify(note Notification) {
+	if note.Timestamp.IsZero() {
+		note.Timestamp = time.Now()
+	}
+	body, err := json.Marshal(note)
+	if err != nil {
+		return
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for _, w := range n.hooks {
+		if !w.Enabled || !w.wants(note.Trigger) {
+			continue
+		}
+		select {
+		case n.queues[w.ID].ch <- delivery{hookID: w.ID, body: body, n: note}:
+		default:
+			n.log.Warn("notification queue full, dropping", "webhook", w.ID, "trigger", note.Trigger)
+		}
+	}
+}
+
+// Test queues a test notification for a single webhook regardless of its
+// trigger subscriptions.
+func (n *Notifier) Test(id string) error {
+	n.mu.RLock()
+	q, ok := n.queues[id]
+	n.mu.RUnlock()
+	if !ok {
+		return ErrNotFound
+	}
+
+	note := Notification{Trigger: "test", Message: "test notification", Timestamp: time.Now()}
+	body, err := json.Marshal(note)
+	if err != nil {
+		return err
+	}
+	select {
+	case q.ch <- delivery{hookID: id, body: body, n: note}:
+		return nil
+	default:
+		return fmt.Errorf("notification queue full")
+	}
+}
+
+// HandleEvent maps device bus events to notifications. It is meant to be
+// registered as an event.Handler.
+func (n *Notifier) HandleEvent(e event.Event) {
+	switch e.Type {
+	case event.DeviceDisconnected:
+		n.Notify(Notification{
+			Trigger:   TriggerDeviceDisconnected,
+			Serial:    e.Serial,
+			Message:   fmt.Sprintf("device %s disconnected", e.Serial),
+			Details:   map[string]string{"last_state": string(e.OldState)},
+			Timestamp: e.Timestamp,
+		})
+	case event.DeviceConnected, event.DeviceStateChanged:
+		if e.NewState != adb.StateUnauthorized {
+			return
+		}
+		n.Notify(Notification{
+			Trigger:   TriggerDeviceUnauthorized,
+			Serial:    e.Serial,
+			Message:   fmt.Sprintf("device %s is unauthorized", e.Serial),
+			Timestamp: e.Timestamp,
+		})
+	}
+}
+
+// Run delivers queued notifications until ctx is cancelled, starting a
+// worker for every webhook, present or added later.
+func (n *Notifier) Run(ctx context.Context) {
+	n.mu.Lock()
+	n.ctx = ctx
+	for _, q := range n.queues {
+		n.startLocked(q)
+	}
+	n.mu.Unlock()
+	<-ctx.Done()
+}
+
+// startLocked starts the worker of q under Run's context.
+func (n *Notifier) startLocked(q *hookQueue) {
+	ctx, stop := context.WithCancel(n.ctx)
+	q.stop = stop
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case d := <-q.ch:
+				n.deliver(ctx, d)
+			}
+		}
+	}()
+}
+
+// deliver POSTs a notification, retrying with exponential backoff on
+// transport errors and non-2xx responses.
+func (n *Notifier) deliver(ctx context.Context, d delivery) {
+	delay := n.cfg.BaseDelay
+
+	for attempt := 1; attempt <= n.cfg.MaxAttempts; attempt++ {
+		n.mu.RLock()
+		w, ok := n.hooks[d.hookID]
+		n.mu.RUnlock()
+		if !ok {
+			n.log.Debug("webhook removed, dropping delivery", "webhook", d.hookID, "trigger", d.n.Trigger)
+			return
+		}
+		err := n.post(ctx, w, d)
+		if err == nil {
+			n.log.Debug("webhook delivered", "webhook", d.hookID, "trigger", d.n.Trigger, "attempt", attempt)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		n.log.Warn("webhook delivery failed",
+			"webhook", d.hookID,
+			"attempt", attempt,
+			"error", err,
+		)
+		if attempt == n.cfg.MaxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, n.cfg.MaxDelay)
+	}
+
+	n.log.Error("webhook delivery gave up", "webhook", d.hookID, "trigger", d.n.Trigger)
+}
+
+func (n *Notifier) post(ctx context.Context, w Webhook, d delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TriggerHeader, string(d.n.Trigger))
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.Secret, d.body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of body keyed by secret.
+// Receivers verify deliveries by recomputing it over the raw request body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func validate(w Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalid)
+	}
+	for _, t := range w.Triggers {
+		if _, ok := knownTriggers[t]; !ok {
+			return fmt.Errorf("%w: unknown trigger %q", ErrInvalid, t)
+		}
+	}
+	return nil
+}
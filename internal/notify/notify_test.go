@@ -0,0 +1,298 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestNotifier_AddValidation(t *testing.T) {
+	n := New(testLogger(), Config{})
+
+	if _, err := n.Add(Webhook{URL: "ftp://example.com"}); err == nil {
+		t.Error("expected error for non-http URL")
+	}
+	if _, err := n.Add(Webhook{URL: "https://example.com", Triggers: []Trigger{"bogus"}}); err == nil {
+		t.Error("expected error for unknown trigger")
+	}
+
+	w, err := n.Add(Webhook{URL: "https://example.com/hook", Secret: "s3cret", Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.ID == "" {
+		t.Error("expected ID to be assigned")
+	}
+	if w.Secret == "s3cret" {
+		t.Error("secret should be redacted in returned webhook")
+	}
+	if got := n.List(); len(got) != 1 {
+		t.Fatalf("List: got %d hooks, want 1", len(got))
+	}
+}
+
+func TestNotifier_UpdateKeepsSecret(t *testing.T) {
+	n := New(testLogger(), Config{})
+	w, _ := n.Add(Webhook{URL: "https://example.com/a", Secret: "keep"})
+
+	if _, err := n.Update(w.ID, Webhook{URL: "https://example.com/b"}); err != nil {
+		t.Fatal(err)
+	}
+	n.mu.RLock()
+	got := n.hooks[w.ID]
+	n.mu.RUnlock()
+	if got.Secret != "keep" || got.URL != "https://example.com/b" {
+		t.Errorf("unexpected hook after update: %+v", got)
+	}
+
+	if _, err := n.Update("missing", Webhook{URL: "https://example.com"}); err != ErrNotFound {
+		t.Errorf("Update missing: got %v, want ErrNotFound", err)
+	}
+	if err := n.Remove(w.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Remove(w.ID); err != ErrNotFound {
+		t.Errorf("second Remove: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestNotifier_DeliverySignedWithRetry(t *testing.T) {
+	var calls atomic.Int32
+	received := make(chan *http.Request, 1)
+	var body []byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer srv.Close()
+
+	n := New(testLogger(), Config{BaseDelay: time.Millisecond, MaxAttempts: 3})
+	n.Add(Webhook{
+		URL:      srv.URL,
+		Secret:   "topsecret",
+		Triggers: []Trigger{TriggerDeviceDisconnected},
+		Enabled:  true,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	n.HandleEvent(event.Event{Type: event.DeviceDisconnected, Serial: "ABC", OldState: adb.StateDevice})
+
+	select {
+	case r := <-received:
+		want := "sha256=" + Sign("topsecret", body)
+		if got := r.Header.Get(SignatureHeader); got != want {
+			t.Errorf("signature: got %q, want %q", got, want)
+		}
+		if got := r.Header.Get(TriggerHeader); got != string(TriggerDeviceDisconnected) {
+			t.Errorf("trigger header: got %q", got)
+		}
+		var note Notification
+		if err := json.Unmarshal(body, &note); err != nil {
+			t.Fatal(err)
+		}
+		if note.Serial != "ABC" {
+			t.Errorf("serial: got %q, want ABC", note.Serial)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	if calls.Load() != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls.Load())
+	}
+}
+
+func TestNotifier_TriggerFiltering(t *testing.T) {
+	n := New(testLogger(), Config{})
+	n.Add(Webhook{URL: "https://example.com/a", Triggers: []Trigger{TriggerDeviceUnauthorized}, Enabled: true})
+	n.Add(Webhook{URL: "https://example.com/b", Enabled: false})
+
+	n.HandleEvent(event.Event{Type: event.DeviceDisconnected, Serial: "X"})
+	if got := queued(n); got != 0 {
+		t.Fatalf("expected no deliveries for unsubscribed trigger, got %d", got)
+	}
+
+	n.HandleEvent(event.Event{Type: event.DeviceConnected, Serial: "X", NewState: adb.StateUnauthorized})
+	if got := queued(n); got != 1 {
+		t.Fatalf("expected 1 delivery for unauthorized device, got %d", got)
+	}
+}
+
+// queued counts the deliveries waiting in every webhook's queue.
+func queued(n *Notifier) int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	total := 0
+	for _, q := range n.queues {
+		total += len(q.ch)
+	}
+	return total
+}
+
+func TestNotifier_FailingHookDoesNotDelayOthers(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	received := make(chan struct{}, 10)
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer up.Close()
+
+	// The failing hook retries for far longer than the test waits.
+	n := New(testLogger(), Config{BaseDelay: time.Minute, MaxAttempts: 5})
+	n.Add(Webhook{URL: down.URL, Enabled: true})
+	n.Add(Webhook{URL: up.URL, Enabled: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	for i := 0; i < 3; i++ {
+		n.HandleEvent(event.Event{Type: event.DeviceDisconnected, Serial: "ABC"})
+		select {
+		case <-received:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("notification %d not delivered while another webhook is retrying", i)
+		}
+	}
+}
+
+func TestNotifier_HookAddedWhileRunning(t *testing.T) {
+	received := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer srv.Close()
+
+	n := New(testLogger(), Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+	// Let Run start the (no) workers first.
+	for {
+		n.mu.RLock()
+		started := n.ctx != nil
+		n.mu.RUnlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	w, _ := n.Add(Webhook{URL: srv.URL, Enabled: true})
+	if err := n.Test(w.ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook added after Run was not delivered")
+	}
+	if err := n.Remove(w.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotifier_UpdateAppliesToQueued(t *testing.T) {
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("delivered to the URL the webhook was edited away from")
+	}))
+	defer old.Close()
+	received := make(chan *http.Request, 1)
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer srv.Close()
+
+	n := New(testLogger(), Config{})
+	w, _ := n.Add(Webhook{URL: old.URL, Secret: "old", Enabled: true})
+	n.HandleEvent(event.Event{Type: event.DeviceDisconnected, Serial: "ABC"})
+	if _, err := n.Update(w.ID, Webhook{URL: srv.URL, Secret: "new", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	select {
+	case r := <-received:
+		if got, want := r.Header.Get(SignatureHeader), "sha256="+Sign("new", body); got != want {
+			t.Errorf("signature: got %q, want %q", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("queued notification was not delivered to the edited URL")
+	}
+}
+
+func TestOpen_SavesWebhooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	n, err := Open(testLogger(), Config{}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := n.Add(Webhook{URL: "https://example.com/a", Secret: "s", Triggers: []Trigger{TriggerCaptureDegraded}, Enabled: true})
+	b, _ := n.Add(Webhook{URL: "https://example.com/b"})
+	n.AddConfigured(Webhook{URL: "https://example.com/flag", Enabled: true})
+	if _, err := n.Update(a.ID, Webhook{URL: "https://example.com/a2", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Remove(b.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err = Open(testLogger(), Config{}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.mu.RLock()
+	got, ok := n.hooks[a.ID]
+	count := len(n.hooks)
+	n.mu.RUnlock()
+	if count != 1 || !ok {
+		t.Fatalf("reopened with %d webhooks, want only %s", count, a.ID)
+	}
+	if got.URL != "https://example.com/a2" || got.Secret != "s" || !got.Enabled {
+		t.Errorf("reopened webhook: %+v", got)
+	}
+	c, _ := n.Add(Webhook{URL: "https://example.com/c"})
+	if c.ID == a.ID {
+		t.Errorf("new webhook reused ID %s", c.ID)
+	}
+}
+
+func TestOpen_MissingFile(t *testing.T) {
+	n, err := Open(testLogger(), Config{}, filepath.Join(t.TempDir(), "none.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := n.List(); len(got) != 0 {
+		t.Errorf("got %d webhooks, want none", len(got))
+	}
+}
@@ -0,0 +1,199 @@
+package notify
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	// ErrorSpikeInterval is how often capture error counters are sampled for
+	// the capture_error_spike trigger.
+	ErrorSpikeInterval = 30 * time.Second
+	// DefaultErrorSpikeThreshold is the number of new capture errors within
+	// one sampling interval that counts as a spike.
+	DefaultErrorSpikeThreshold = 100
+
+	// degradedWindow is how far back the exported capture_degraded rule looks
+	// for supervisor restarts, the traffic_anomaly rule for anomalies and
+	// the capture_battery rule for battery warnings.
+	degradedWindow = 5 * time.Minute
+)
+
+// Metric names served by /api/metrics. The exported alerting rules query
+// these, so the exposition and the rules must agree.
+const (
+	// MetricDeviceState is 1 for each known device, labelled with its state.
+	MetricDeviceState = "adb_monitor_device_state"
+	// MetricDeviceDisconnects counts devices dropping off the ADB server.
+	MetricDeviceDisconnects = "adb_monitor_device_disconnects_total"
+	// MetricCaptureErrors is a capture's error counter; it resets when the
+	// capture is restarted.
+	MetricCaptureErrors = "adb_monitor_capture_errors_total"
+	// MetricCaptureRestarts counts supervisor restarts of a capture stream.
+	MetricCaptureRestarts = "adb_monitor_capture_restarts_total"
+	// MetricDeviceHealth is the device health score (0–100).
+	MetricDeviceHealth = "adb_monitor_device_health_score"
+	// MetricTrafficAnomalies counts traffic anomalies per device and kind.
+	MetricTrafficAnomalies = "adb_monitor_traffic_anomalies_total"
+	// MetricCaptureBatteryWarnings counts battery warnings of captures per
+	// device and kind: drain or paused.
+	MetricCaptureBatteryWarnings = "adb_monitor_capture_battery_warnings_total"
+	// MetricEventsDropped counts device events a bus subscriber lost to a
+	// full queue.
+	MetricEventsDropped = "adb_monitor_events_dropped_total"
+	// MetricEventHandlerErrors counts bus handler calls that panicked or
+	// timed out, per subscriber and kind.
+	MetricEventHandlerErrors = "adb_monitor_event_handler_errors_total"
+	// MetricPoolActive is the number of running worker pool tasks.
+	MetricPoolActive = "adb_monitor_pool_active_tasks"
+	// MetricPoolPending is the number of tasks waiting for a worker, per
+	// priority.
+	MetricPoolPending = "adb_monitor_pool_pending_tasks"
+	// MetricSinkRecords counts records sent to the output sink, per
+	// outcome: published, dropped or failed.
+	MetricSinkRecords = "adb_monitor_sink_records_total"
+	// MetricElasticDocuments counts documents sent to Elasticsearch, per
+	// outcome: indexed, dropped or failed.
+	MetricElasticDocuments = "adb_monitor_elastic_documents_total"
+	// MetricProcessorRecords counts records sent to the external
+	// processor, per outcome: annotated, unchanged, sent, timed_out,
+	// dropped or failed.
+	MetricProcessorRecords = "adb_monitor_processor_records_total"
+	// MetricProcessorRestarts counts restarts of the processor command.
+	MetricProcessorRestarts = "adb_monitor_processor_restarts_total"
+)
+
+// RuleConfig is the alerting configuration of a server, as set by its flags.
+type RuleConfig struct {
+	// Group names the Prometheus rule group.
+	Group string
+	// Triggers limits the output to these triggers; empty means all.
+	Triggers []Trigger
+	// ErrorSpikeThreshold matches bridge.Config.ErrorSpikeThreshold.
+	ErrorSpikeThreshold int
+}
+
+// PromRule is one Prometheus alerting rule.
+type PromRule struct {
+	Alert       string
+	Expr        string
+	Severity    string
+	Summary     string
+	Description string
+}
+
+// PrometheusRules translates the in-process triggers into equivalent
+// Prometheus alerting rules over the /api/metrics series, in trigger order.
+func PrometheusRules(cfg RuleConfig) ([]PromRule, error) {
+	if cfg.ErrorSpikeThreshold <= 0 {
+		cfg.ErrorSpikeThreshold = DefaultErrorSpikeThreshold
+	}
+	want := make(map[Trigger]bool, len(cfg.Triggers))
+	for _, t := range cfg.Triggers {
+		if _, ok := knownTriggers[t]; !ok {
+			return nil, fmt.Errorf("unknown trigger %q", t)
+		}
+		want[t] = true
+	}
+
+	all := []struct {
+		trigger Trigger
+		rule    PromRule
+	}{
+		{TriggerDeviceDisconnected, PromRule{
+			Alert:       "ADBDeviceDisconnected",
+			Expr:        fmt.Sprintf("increase(%s[1m]) > 0", MetricDeviceDisconnects),
+			Severity:    "warning",
+			Summary:     "Device {{ $labels.serial }} disconnected",
+			Description: "Device {{ $labels.serial }} dropped off the ADB server.",
+		}},
+		{TriggerDeviceUnauthorized, PromRule{
+			Alert:       "ADBDeviceUnauthorized",
+			Expr:        fmt.Sprintf(`%s{state="unauthorized"} == 1`, MetricDeviceState),
+			Severity:    "warning",
+			Summary:     "Device {{ $labels.serial }} is unauthorized",
+			Description: "Device {{ $labels.serial }} is waiting for the USB debugging prompt to be accepted.",
+		}},
+		{TriggerCaptureErrorSpike, PromRule{
+			Alert: "ADBCaptureErrorSpike",
+			Expr: fmt.Sprintf("increase(%s[%s]) >= %d",
+				MetricCaptureErrors, promDuration(ErrorSpikeInterval), cfg.ErrorSpikeThreshold),
+			Severity: "warning",
+			Summary:  "Capture errors spiking on {{ $labels.serial }}",
+			Description: fmt.Sprintf("Capture on {{ $labels.serial }} logged {{ $value }} errors in %s (threshold %d).",
+				ErrorSpikeInterval, cfg.ErrorSpikeThreshold),
+		}},
+		{TriggerCaptureDegraded, PromRule{
+			Alert:       "ADBCaptureDegraded",
+			Expr:        fmt.Sprintf("increase(%s[%s]) > 0", MetricCaptureRestarts, promDuration(degradedWindow)),
+			Severity:    "warning",
+			Summary:     "Capture on {{ $labels.serial }} is restarting",
+			Description: "The {{ $labels.mode }} capture stream on {{ $labels.serial }} died and is being restarted.",
+		}},
+		{TriggerTrafficAnomaly, PromRule{
+			Alert:       "ADBTrafficAnomaly",
+			Expr:        fmt.Sprintf("increase(%s[%s]) > 0", MetricTrafficAnomalies, promDuration(degradedWindow)),
+			Severity:    "warning",
+			Summary:     "Unusual traffic on {{ $labels.serial }}",
+			Description: "Device {{ $labels.serial }} reported {{ $labels.kind }} traffic anomalies against its learned baseline.",
+		}},
+		{TriggerCaptureBattery, PromRule{
+			Alert:       "ADBCaptureBattery",
+			Expr:        fmt.Sprintf("increase(%s[%s]) > 0", MetricCaptureBatteryWarnings, promDuration(degradedWindow)),
+			Severity:    "warning",
+			Summary:     "Capture on {{ $labels.serial }} is wearing down its battery",
+			Description: "The capture on {{ $labels.serial }} raised a {{ $labels.kind }} battery warning.",
+		}},
+	}
+
+	var rules []PromRule
+	for _, r := range all {
+		if len(want) == 0 || want[r.trigger] {
+			rules = append(rules, r.rule)
+		}
+	}
+	return rules, nil
+}
+
+// WritePrometheusRules writes cfg's rules as a Prometheus rule file.
+func WritePrometheusRules(w io.Writer, cfg RuleConfig) error {
+	rules, err := PrometheusRules(cfg)
+	if err != nil {
+		return err
+	}
+	group := cfg.Group
+	if group == "" {
+		group = "adb-monitor"
+	}
+
+	// Strings are emitted double-quoted; Go's escaping is valid YAML.
+	q := strconv.Quote
+	fmt.Fprintf(w, "# Generated by adb-monitor alert-rules. Do not edit; regenerate\n")
+	fmt.Fprintf(w, "# after changing the server's alerting flags.\n")
+	fmt.Fprintf(w, "groups:\n  - name: %s\n    rules:\n", q(group))
+	for _, r := range rules {
+		fmt.Fprintf(w, "      - alert: %s\n", r.Alert)
+		fmt.Fprintf(w, "        expr: %s\n", q(r.Expr))
+		fmt.Fprintf(w, "        labels:\n          severity: %s\n", q(r.Severity))
+		fmt.Fprintf(w, "        annotations:\n")
+		fmt.Fprintf(w, "          summary: %s\n", q(r.Summary))
+		if _, err := fmt.Fprintf(w, "          description: %s\n", q(r.Description)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// promDuration formats d in Prometheus duration syntax ("30s", "5m").
+func promDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return strconv.FormatInt(int64(d/time.Hour), 10) + "h"
+	case d%time.Minute == 0:
+		return strconv.FormatInt(int64(d/time.Minute), 10) + "m"
+	default:
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	}
+}
@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusRules_CoverEveryTrigger(t *testing.T) {
+	rules, err := PrometheusRules(RuleConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A new trigger needs an equivalent exported rule.
+	if len(rules) != len(knownTriggers) {
+		t.Errorf("got %d rules for %d triggers", len(rules), len(knownTriggers))
+	}
+}
+
+func TestWritePrometheusRules(t *testing.T) {
+	var b strings.Builder
+	err := WritePrometheusRules(&b, RuleConfig{
+		Triggers:            []Trigger{TriggerCaptureErrorSpike},
+		ErrorSpikeThreshold: 42,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		`- name: "adb-monitor"`,
+		"- alert: ADBCaptureErrorSpike",
+		`expr: "increase(adb_monitor_capture_errors_total[30s]) >= 42"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "ADBDeviceDisconnected") {
+		t.Errorf("unselected trigger exported:\n%s", out)
+	}
+
+	if err := WritePrometheusRules(&b, RuleConfig{Triggers: []Trigger{"bogus"}}); err == nil {
+		t.Error("expected error for unknown trigger")
+	}
+}
+
+func TestPromDuration(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+	}{
+		{30 * time.Second, "30s"},
+		{90 * time.Second, "90s"},
+		{5 * time.Minute, "5m"},
+		{2 * time.Hour, "2h"},
+	}
+	for _, tt := range tests {
+		if got := promDuration(tt.in); got != tt.want {
+			t.Errorf("promDuration(%s) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
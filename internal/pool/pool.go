@@ -2,24 +2,104 @@ package pool
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"sort"
 	"sync"
+	"time"
 )
 
+// ErrCancelled is returned by Submit when the task is cancelled with
+// Cancel while it waits for a worker.
+var ErrCancelled = errors.New("pool: task cancelled")
+
+// Priority orders tasks waiting for a worker: higher priorities start
+// first, equal ones in submission order.
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// String returns the priority's name.
+func (p Priority) String() string {
+	switch {
+	case p > PriorityNormal:
+		return "high"
+	case p < PriorityNormal:
+		return "low"
+	default:
+		return "normal"
+	}
+}
+
 // Task represents a unit of work to run in the pool.
 type Task struct {
 	Name string
 	Fn   func(ctx context.Context) error
+	// Priority decides which waiting task gets the next free worker.
+	Priority Priority
+	// Serial names the device the task works on, for the per-device cap.
+	// Empty exempts the task from it.
+	Serial string
+}
+
+// PendingTask describes a task waiting for a worker.
+type PendingTask struct {
+	ID       uint64    `json:"id"`
+	Name     string    `json:"name"`
+	Serial   string    `json:"serial,omitempty"`
+	Priority string    `json:"priority"`
+	Queued   time.Time `json:"queued"`
+}
+
+// Stats describes the pool's usage and queue.
+type Stats struct {
+	Active       int `json:"active"`
+	MaxWorkers   int `json:"max_workers"`
+	MaxPerDevice int `json:"max_per_device,omitempty"`
+	// ActiveByDevice counts running tasks per device serial.
+	ActiveByDevice map[string]int `json:"active_by_device"`
+	// Pending counts waiting tasks per priority name.
+	Pending map[string]int `json:"pending"`
+	// Queue lists waiting tasks in the order they will start, as far as
+	// the per-device cap allows.
+	Queue     []PendingTask `json:"queue"`
+	Completed uint64        `json:"completed"`
+	Failed    uint64        `json:"failed"`
+	Cancelled uint64        `json:"cancelled"`
+}
+
+type waiter struct {
+	id     uint64
+	task   Task
+	queued time.Time
+	// ready is closed when the task is given a worker, cancelled when it
+	// is removed from the queue by Cancel.
+	ready     chan struct{}
+	cancelled chan struct{}
 }
 
 // Pool manages a bounded set of worker goroutines for device operations.
 // It ensures no more than maxWorkers tasks run concurrently,
 // critical for handling 150+ devices without exhausting OS resources.
+// Tasks waiting for a worker are started by priority, and optionally no
+// more than a set number at a time per device.
 type Pool struct {
 	log        *slog.Logger
 	maxWorkers int
-	sem        chan struct{}
 	wg         sync.WaitGroup
+
+	mu           sync.Mutex
+	maxPerDevice int
+	active       int
+	byDevice     map[string]int
+	pending      []*waiter
+	nextID       uint64
+
+	completed, failed, cancelled uint64
 }
 
 // New creates a pool with the given concurrency limit.
@@ -30,38 +110,156 @@ func New(maxWorkers int, log *slog.Logger) *Pool {
 	return &Pool{
 		log:        log.With("component", "pool"),
 		maxWorkers: maxWorkers,
-		sem:        make(chan struct{}, maxWorkers),
+		byDevice:   make(map[string]int),
 	}
 }
 
-// Submit schedules a task for execution. It blocks if all workers are busy.
-// The task respects the provided context for cancellation.
+// SetMaxPerDevice caps the tasks running at once for one device serial.
+// Zero, the default, removes the cap.
+func (p *Pool) SetMaxPerDevice(n int) {
+	p.mu.Lock()
+	p.maxPerDevice = max(n, 0)
+	p.dispatchLocked()
+	p.mu.Unlock()
+}
+
+// Submit schedules a task for execution. It blocks until a worker is free
+// for it, ctx is done, or the task is cancelled with Cancel. The task
+// respects the provided context for cancellation.
 func (p *Pool) Submit(ctx context.Context, task Task) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.nextID++
+	w := &waiter{
+		id:        p.nextID,
+		task:      task,
+		queued:    time.Now(),
+		ready:     make(chan struct{}),
+		cancelled: make(chan struct{}),
+	}
+	p.pending = append(p.pending, w)
+	p.dispatchLocked()
+	p.mu.Unlock()
+
 	select {
+	case <-w.ready:
+	case <-w.cancelled:
+		return ErrCancelled
 	case <-ctx.Done():
+		p.mu.Lock()
+		started := p.removeLocked(w)
+		if started {
+			// Granted a worker just as ctx ended; hand it on.
+			p.releaseLocked(task.Serial)
+		}
+		p.cancelled++
+		p.mu.Unlock()
 		return ctx.Err()
-	case p.sem <- struct{}{}:
 	}
 
 	p.wg.Add(1)
 	go func() {
 		defer p.wg.Done()
-		defer func() { <-p.sem }()
 
-		p.log.Debug("task started", "name", task.Name)
+		p.log.Debug("task started", "name", task.Name, "priority", task.Priority, "waited", time.Since(w.queued))
 
-		if err := task.Fn(ctx); err != nil {
+		err := task.Fn(ctx)
+		if err != nil {
 			if ctx.Err() == nil {
 				p.log.Warn("task failed", "name", task.Name, "error", err)
 			}
 		} else {
 			p.log.Debug("task completed", "name", task.Name)
 		}
+
+		p.mu.Lock()
+		if err != nil {
+			p.failed++
+		} else {
+			p.completed++
+		}
+		p.releaseLocked(task.Serial)
+		p.mu.Unlock()
 	}()
 
 	return nil
 }
 
+// removeLocked takes w off the queue. It reports whether w had already
+// been given a worker instead.
+func (p *Pool) removeLocked(w *waiter) (started bool) {
+	for i, pw := range p.pending {
+		if pw == w {
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Pool) releaseLocked(serial string) {
+	p.active--
+	if serial != "" {
+		if p.byDevice[serial]--; p.byDevice[serial] <= 0 {
+			delete(p.byDevice, serial)
+		}
+	}
+	p.dispatchLocked()
+}
+
+// dispatchLocked hands free workers to waiting tasks.
+func (p *Pool) dispatchLocked() {
+	for p.active < p.maxWorkers {
+		i := p.nextLocked()
+		if i < 0 {
+			return
+		}
+		w := p.pending[i]
+		p.pending = append(p.pending[:i], p.pending[i+1:]...)
+		p.active++
+		if w.task.Serial != "" {
+			p.byDevice[w.task.Serial]++
+		}
+		close(w.ready)
+	}
+}
+
+// nextLocked returns the index of the waiting task to start next, or -1
+// if every waiting task is held back by its device's cap.
+func (p *Pool) nextLocked() int {
+	best := -1
+	for i, w := range p.pending {
+		if p.maxPerDevice > 0 && w.task.Serial != "" && p.byDevice[w.task.Serial] >= p.maxPerDevice {
+			continue
+		}
+		// The queue is in submission order, so the first of the highest
+		// priority wins.
+		if best < 0 || w.task.Priority > p.pending[best].task.Priority {
+			best = i
+		}
+	}
+	return best
+}
+
+// Cancel removes a waiting task from the queue; its Submit returns
+// ErrCancelled. It reports false if no task with that ID is waiting.
+func (p *Pool) Cancel(id uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, w := range p.pending {
+		if w.id == id {
+			p.removeLocked(w)
+			p.cancelled++
+			close(w.cancelled)
+			return true
+		}
+	}
+	return false
+}
+
 // Wait blocks until all submitted tasks complete.
 func (p *Pool) Wait() {
 	p.wg.Wait()
@@ -69,10 +267,50 @@ func (p *Pool) Wait() {
 
 // ActiveCount returns the number of currently running tasks.
 func (p *Pool) ActiveCount() int {
-	return len(p.sem)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active
 }
 
 // MaxWorkers returns the pool's concurrency limit.
 func (p *Pool) MaxWorkers() int {
 	return p.maxWorkers
 }
+
+// Stats returns the pool's usage and its waiting tasks.
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st := Stats{
+		Active:         p.active,
+		MaxWorkers:     p.maxWorkers,
+		MaxPerDevice:   p.maxPerDevice,
+		ActiveByDevice: make(map[string]int, len(p.byDevice)),
+		Pending:        map[string]int{},
+		Queue:          make([]PendingTask, 0, len(p.pending)),
+		Completed:      p.completed,
+		Failed:         p.failed,
+		Cancelled:      p.cancelled,
+	}
+	for serial, n := range p.byDevice {
+		st.ActiveByDevice[serial] = n
+	}
+	for _, prio := range []Priority{PriorityHigh, PriorityNormal, PriorityLow} {
+		st.Pending[prio.String()] = 0
+	}
+	queue := make([]*waiter, len(p.pending))
+	copy(queue, p.pending)
+	sort.SliceStable(queue, func(i, j int) bool { return queue[i].task.Priority > queue[j].task.Priority })
+	for _, w := range queue {
+		st.Pending[w.task.Priority.String()]++
+		st.Queue = append(st.Queue, PendingTask{
+			ID:       w.id,
+			Name:     w.task.Name,
+			Serial:   w.task.Serial,
+			Priority: w.task.Priority.String(),
+			Queued:   w.queued,
+		})
+	}
+	return st
+}
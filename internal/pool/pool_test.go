@@ -4,6 +4,8 @@ import (
 	"context"
 	"log/slog"
 	"os"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -96,3 +98,111 @@ func TestPool_ActiveCount(t *testing.T) {
 		t.Errorf("MaxWorkers should be 10, got %d", p.MaxWorkers())
 	}
 }
+
+// occupy fills the pool's only worker until the returned func is called.
+func occupy(t *testing.T, p *Pool, serial string) func() {
+	t.Helper()
+	release := make(chan struct{})
+	err := p.Submit(context.Background(), Task{Name: "blocker", Serial: serial, Fn: func(ctx context.Context) error {
+		<-release
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() { close(release) }
+}
+
+// waitPending waits until n tasks are queued.
+func waitPending(t *testing.T, p *Pool, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for len(p.Stats().Queue) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue = %+v, want %d tasks", p.Stats().Queue, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPool_Priority(t *testing.T) {
+	p := New(1, testLogger())
+	release := occupy(t, p, "")
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	submit := func(name string, prio Priority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Submit(context.Background(), Task{Name: name, Priority: prio, Fn: func(ctx context.Context) error {
+				mu.Lock()
+				order = append(order, name)
+				mu.Unlock()
+				return nil
+			}})
+		}()
+	}
+	submit("low", PriorityLow)
+	waitPending(t, p, 1)
+	submit("normal", PriorityNormal)
+	waitPending(t, p, 2)
+	submit("high", PriorityHigh)
+	waitPending(t, p, 3)
+
+	st := p.Stats()
+	if st.Pending["high"] != 1 || st.Pending["normal"] != 1 || st.Pending["low"] != 1 || st.Queue[0].Name != "high" {
+		t.Errorf("stats = %+v", st)
+	}
+
+	release()
+	wg.Wait()
+	p.Wait()
+	if got := strings.Join(order, ","); got != "high,normal,low" {
+		t.Errorf("order = %s", got)
+	}
+	if st := p.Stats(); st.Completed != 4 || st.Active != 0 {
+		t.Errorf("after: %+v", st)
+	}
+}
+
+func TestPool_MaxPerDevice(t *testing.T) {
+	p := New(2, testLogger())
+	p.SetMaxPerDevice(1)
+	release := occupy(t, p, "dev1")
+	defer release()
+
+	// The second dev1 task waits although a worker is free; dev2 runs.
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Submit(context.Background(), Task{Name: "dev1-2", Serial: "dev1", Fn: func(ctx context.Context) error { return nil }})
+	}()
+	waitPending(t, p, 1)
+
+	ran := make(chan struct{})
+	if err := p.Submit(context.Background(), Task{Name: "dev2", Serial: "dev2", Fn: func(ctx context.Context) error {
+		close(ran)
+		return nil
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("dev2 task starved by dev1's cap")
+	}
+
+	if st := p.Stats(); st.ActiveByDevice["dev1"] != 1 || len(st.Queue) != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+	if !p.Cancel(p.Stats().Queue[0].ID) {
+		t.Fatal("Cancel found no task")
+	}
+	if err := <-done; err != ErrCancelled {
+		t.Errorf("Submit = %v, want ErrCancelled", err)
+	}
+	if p.Cancel(12345) {
+		t.Error("Cancel of unknown task succeeded")
+	}
+}
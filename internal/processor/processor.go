@@ -0,0 +1,462 @@
+// Package processor hands captured packets, connections and device events
+// to an external processor — a command reading NDJSON on stdin, or an HTTP
+// endpoint — and applies the annotations it answers with, so enrichment
+// can be written in any language without forking the project.
+//
+// Every record is one JSON object: {"id":1,"kind":"packet","packet":{...}},
+// with kind "connection" and a "connection" field, or kind "event" and an
+// "event" field. Packets and connections carry an id and wait for an
+// annotation with the same id — {"id":1,"tags":{"owner":"payments"}} —
+// for up to the configured timeout; an empty annotation ({"id":1}) leaves
+// the record as it is. A non-empty "threat" marks the record malicious.
+// Events carry no id and are not answered. A command answers with one
+// annotation per line, in any order; an HTTP endpoint gets each record as
+// a POST and answers in the response body.
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+const (
+	// DefaultTimeout is how long a packet or connection waits for its
+	// annotation.
+	DefaultTimeout = 50 * time.Millisecond
+	// DefaultBuffer is how many records are queued for the processor;
+	// more are passed on unannotated.
+	DefaultBuffer = 4096
+
+	// restartMin and restartMax bound the wait before a command that
+	// exited is started again.
+	restartMin = time.Second
+	restartMax = 30 * time.Second
+	// maxLine bounds one annotation line.
+	maxLine = 1 << 20
+)
+
+// Record kinds.
+const (
+	KindPacket     = "packet"
+	KindConnection = "connection"
+	KindEvent      = "event"
+)
+
+// Record is one item sent to the processor.
+type Record struct {
+	ID         uint64                 `json:"id,omitempty"`
+	Kind       string                 `json:"kind"`
+	Packet     *capture.NetworkPacket `json:"packet,omitempty"`
+	Connection *capture.Connection    `json:"connection,omitempty"`
+	Event      *event.Event           `json:"event,omitempty"`
+}
+
+// Annotation is the processor's answer for the record with the same ID.
+type Annotation struct {
+	ID uint64 `json:"id"`
+	// Tags are merged into the record's tags.
+	Tags map[string]string `json:"tags,omitempty"`
+	// Threat, if set, marks the record malicious and names why.
+	Threat string `json:"threat,omitempty"`
+}
+
+// Config configures a Processor. Exactly one of Command and URL is set.
+type Config struct {
+	// Command is the program and its arguments, separated by spaces. It is
+	// started by Run and started again if it exits.
+	Command string
+	// URL is an http(s) endpoint each record is POSTed to.
+	URL string
+	// Timeout and Buffer are their defaults if zero.
+	Timeout time.Duration
+	Buffer  int
+}
+
+// Stats counts records by outcome.
+type Stats struct {
+	// Annotated records got an annotation in time, Unchanged ones an empty
+	// one. Events are counted as Sent.
+	Annotated uint64 `json:"annotated"`
+	Unchanged uint64 `json:"unchanged"`
+	Sent      uint64 `json:"sent"`
+	// TimedOut records got no annotation in time; Dropped ones found the
+	// queue full or the processor not running; Failed ones could not be
+	// delivered.
+	TimedOut uint64 `json:"timed_out"`
+	Dropped  uint64 `json:"dropped"`
+	Failed   uint64 `json:"failed"`
+	// Restarts counts the times the command was started again.
+	Restarts uint64 `json:"restarts"`
+}
+
+// Processor sends records to the external processor. It is a
+// capture.Enricher, safe for concurrent use by several engines, and its
+// Event method is an event.Handler.
+type Processor struct {
+	log     *slog.Logger
+	args    []string
+	url     string
+	timeout time.Duration
+	http    *http.Client
+	queue   chan []byte
+
+	// running is set while the command is up; records are not queued
+	// otherwise.
+	running atomic.Bool
+	seq     atomic.Uint64
+	mu      sync.Mutex
+	pending map[uint64]chan Annotation
+
+	annotated, unchanged, sent atomic.Uint64
+	timedOut, dropped, failed  atomic.Uint64
+	restarts                   atomic.Uint64
+}
+
+// New returns a processor configured by cfg. A command is not started
+// until Run.
+func New(log *slog.Logger, cfg Config) (*Processor, error) {
+	args := strings.Fields(cfg.Command)
+	if (len(args) == 0) == (cfg.URL == "") {
+		return nil, errors.New("processor: set exactly one of command and url")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = DefaultBuffer
+	}
+	p := &Processor{
+		timeout: cfg.Timeout,
+		queue:   make(chan []byte, cfg.Buffer),
+		pending: make(map[uint64]chan Annotation),
+	}
+	if cfg.URL != "" {
+		u, err := url.Parse(cfg.URL)
+		if err != nil {
+			return nil, fmt.Errorf("processor url: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("processor url %q: scheme must be http or https", u.Redacted())
+		}
+		p.url = cfg.URL
+		p.http = &http.Client{Timeout: cfg.Timeout}
+		p.log = log.With("component", "processor", "url", u.Redacted())
+		p.running.Store(true)
+	} else {
+		p.args = args
+		p.log = log.With("component", "processor", "command", p.args[0])
+	}
+	return p, nil
+}
+
+// Name implements capture.Enricher.
+func (p *Processor) Name() string {
+	return "processor"
+}
+
+// EnrichPacket sends pkt, without its raw capture line, and applies the
+// annotation.
+func (p *Processor) EnrichPacket(pkt *capture.NetworkPacket) {
+	rec := *pkt
+	rec.Raw = ""
+	if a, ok := p.annotate(Record{Kind: KindPacket, Packet: &rec}); ok {
+		pkt.Tags = merge(pkt.Tags, a.Tags)
+		if a.Threat != "" {
+			pkt.Malicious, pkt.Threat = true, a.Threat
+		}
+	}
+}
+
+// EnrichConnection sends c and applies the annotation.
+func (p *Processor) EnrichConnection(c *capture.Connection) {
+	rec := *c
+	if a, ok := p.annotate(Record{Kind: KindConnection, Connection: &rec}); ok {
+		c.Tags = merge(c.Tags, a.Tags)
+		if a.Threat != "" {
+			c.Malicious, c.Threat = true, a.Threat
+		}
+	}
+}
+
+// Event sends a device event. It is an event.Handler.
+func (p *Processor) Event(e event.Event) {
+	line, err := json.Marshal(Record{Kind: KindEvent, Event: &e})
+	if err != nil {
+		p.failed.Add(1)
+		return
+	}
+	if p.enqueue(line) {
+		p.sent.Add(1)
+	}
+}
+
+// Stats returns the record counters.
+func (p *Processor) Stats() Stats {
+	return Stats{
+		Annotated: p.annotated.Load(),
+		Unchanged: p.unchanged.Load(),
+		Sent:      p.sent.Load(),
+		TimedOut:  p.timedOut.Load(),
+		Dropped:   p.dropped.Load(),
+		Failed:    p.failed.Load(),
+		Restarts:  p.restarts.Load(),
+	}
+}
+
+// annotate sends rec and waits for its annotation. ok is false if none
+// came, or it was empty.
+func (p *Processor) annotate(rec Record) (a Annotation, ok bool) {
+	if !p.running.Load() {
+		p.dropped.Add(1)
+		return Annotation{}, false
+	}
+	rec.ID = p.seq.Add(1)
+	line, err := json.Marshal(rec)
+	if err != nil {
+		p.failed.Add(1)
+		return Annotation{}, false
+	}
+
+	if p.url != "" {
+		a, err = p.post(line)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err) {
+				p.timedOut.Add(1)
+			} else {
+				p.failed.Add(1)
+			}
+			return Annotation{}, false
+		}
+		return p.count(a)
+	}
+
+	ch := make(chan Annotation, 1)
+	p.mu.Lock()
+	p.pending[rec.ID] = ch
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, rec.ID)
+		p.mu.Unlock()
+	}()
+	if !p.enqueue(line) {
+		return Annotation{}, false
+	}
+
+	t := time.NewTimer(p.timeout)
+	defer t.Stop()
+	select {
+	case a = <-ch:
+		return p.count(a)
+	case <-t.C:
+		p.timedOut.Add(1)
+		return Annotation{}, false
+	}
+}
+
+func (p *Processor) count(a Annotation) (Annotation, bool) {
+	if len(a.Tags) == 0 && a.Threat == "" {
+		p.unchanged.Add(1)
+		return a, false
+	}
+	p.annotated.Add(1)
+	return a, true
+}
+
+func (p *Processor) enqueue(line []byte) bool {
+	if !p.running.Load() {
+		p.dropped.Add(1)
+		return false
+	}
+	select {
+	case p.queue <- line:
+		return true
+	default:
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+// post sends one record to the URL and reads the annotation from the
+// response; an empty body is an empty annotation.
+func (p *Processor) post(line []byte) (Annotation, error) {
+	resp, err := p.http.Post(p.url, "application/json", bytes.NewReader(line))
+	if err != nil {
+		return Annotation{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return Annotation{}, fmt.Errorf("processor answered %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLine))
+	if err != nil {
+		return Annotation{}, err
+	}
+	var a Annotation
+	if len(bytes.TrimSpace(body)) == 0 {
+		return a, nil
+	}
+	return a, json.Unmarshal(body, &a)
+}
+
+// Run keeps the command running, or delivers events to the URL, until ctx
+// is cancelled.
+func (p *Processor) Run(ctx context.Context) {
+	if p.url != "" {
+		p.postEvents(ctx)
+		return
+	}
+	wait := restartMin
+	for first := true; ; first = false {
+		if !first {
+			p.restarts.Add(1)
+		}
+		start := time.Now()
+		err := p.runCommand(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		p.log.Warn("processor exited, restarting", "error", err, "in", wait)
+		if time.Since(start) > restartMax {
+			wait = restartMin
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, restartMax)
+	}
+}
+
+// postEvents delivers queued events to the URL; packets and connections
+// are posted by the enricher calls themselves.
+func (p *Processor) postEvents(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case line := <-p.queue:
+			if _, err := p.post(line); err != nil {
+				p.failed.Add(1)
+				p.log.Debug("processor did not take event", "error", err)
+			}
+		}
+	}
+}
+
+// runCommand starts the command, writes queued records to its stdin and
+// hands the annotations on its stdout to the waiting records, until it
+// exits.
+func (p *Processor) runCommand(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, p.args[0], p.args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.log.Info("processor started", "pid", cmd.Process.Pid)
+	p.running.Store(true)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.readAnnotations(stdout)
+	}()
+
+	w := bufio.NewWriter(stdin)
+	writeErr := func() error {
+		for {
+			select {
+			case <-done:
+				return nil
+			case line := <-p.queue:
+				w.Write(line)
+				w.WriteByte('\n')
+				// Write out what is queued in one go, then flush.
+				for n := len(p.queue); n > 0; n-- {
+					w.Write(<-p.queue)
+					w.WriteByte('\n')
+				}
+				if err := w.Flush(); err != nil {
+					p.failed.Add(1)
+					return err
+				}
+			}
+		}
+	}()
+
+	p.running.Store(false)
+	stdin.Close()
+	<-done
+	// Records still queued would wait for a command that is gone.
+	for n := len(p.queue); n > 0; n-- {
+		<-p.queue
+		p.dropped.Add(1)
+	}
+	if err := cmd.Wait(); err != nil {
+		return err
+	}
+	return writeErr
+}
+
+// readAnnotations reads annotation lines until the command closes stdout.
+func (p *Processor) readAnnotations(r io.Reader) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), maxLine)
+	for sc.Scan() {
+		var a Annotation
+		if err := json.Unmarshal(sc.Bytes(), &a); err != nil || a.ID == 0 {
+			p.log.Debug("ignoring processor output", "line", sc.Text())
+			continue
+		}
+		p.mu.Lock()
+		ch, ok := p.pending[a.ID]
+		p.mu.Unlock()
+		if ok {
+			// Buffered for one; a duplicate answer is dropped.
+			select {
+			case ch <- a:
+			default:
+			}
+		}
+	}
+}
+
+// merge adds tags to dst, allocating it if needed.
+func merge(dst, tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]string, len(tags))
+	}
+	for k, v := range tags {
+		dst[k] = v
+	}
+	return dst
+}
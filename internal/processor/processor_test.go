@@ -0,0 +1,162 @@
+package processor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+// TestMain lets the test binary stand in for a processor command: with
+// PROCESSOR_HELPER set it tags connections to 10.0.0.1 and marks packets
+// to 6.6.6.6.
+func TestMain(m *testing.M) {
+	if os.Getenv("PROCESSOR_HELPER") == "1" {
+		runHelper()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func runHelper() {
+	sc := bufio.NewScanner(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	for sc.Scan() {
+		var rec Record
+		if json.Unmarshal(sc.Bytes(), &rec) != nil || rec.ID == 0 {
+			continue
+		}
+		enc.Encode(annotateFor(rec))
+	}
+}
+
+func annotateFor(rec Record) Annotation {
+	a := Annotation{ID: rec.ID}
+	switch {
+	case rec.Connection != nil && rec.Connection.RemoteIP == "10.0.0.1":
+		a.Tags = map[string]string{"owner": "payments"}
+	case rec.Packet != nil && rec.Packet.DstIP == "6.6.6.6":
+		a.Threat = "helper:6.6.6.6"
+	}
+	return a
+}
+
+func discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestProcessor_Command(t *testing.T) {
+	t.Setenv("PROCESSOR_HELPER", "1")
+	p, err := New(discard(), Config{Command: os.Args[0], Timeout: 2 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Not running yet: records pass through untouched.
+	c := capture.Connection{RemoteIP: "10.0.0.1"}
+	p.EnrichConnection(&c)
+	if c.Tags != nil || p.Stats().Dropped != 1 {
+		t.Fatalf("before Run: tags = %v, stats = %+v", c.Tags, p.Stats())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for !p.running.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("processor did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c = capture.Connection{RemoteIP: "10.0.0.1", Tags: map[string]string{"app": "x"}}
+	p.EnrichConnection(&c)
+	if c.Tags["owner"] != "payments" || c.Tags["app"] != "x" {
+		t.Errorf("connection tags = %v", c.Tags)
+	}
+	pkt := capture.NetworkPacket{DstIP: "6.6.6.6", Raw: "raw"}
+	p.EnrichPacket(&pkt)
+	if !pkt.Malicious || pkt.Threat != "helper:6.6.6.6" || pkt.Raw != "raw" {
+		t.Errorf("packet = %+v", pkt)
+	}
+	other := capture.NetworkPacket{DstIP: "1.1.1.1"}
+	p.EnrichPacket(&other)
+	if other.Malicious || other.Tags != nil {
+		t.Errorf("unmatched packet = %+v", other)
+	}
+	p.Event(event.Event{Type: event.DeviceConnected, Serial: "a"})
+
+	if s := p.Stats(); s.Annotated != 2 || s.Unchanged != 1 || s.Sent != 1 || s.TimedOut != 0 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestProcessor_HTTP(t *testing.T) {
+	events := make(chan Record, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rec Record
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case rec.Kind == KindEvent:
+			events <- rec
+			w.WriteHeader(http.StatusNoContent)
+		case rec.Packet != nil && rec.Packet.DstIP == "9.9.9.9":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			json.NewEncoder(w).Encode(annotateFor(rec))
+		}
+	}))
+	defer srv.Close()
+
+	p, err := New(discard(), Config{URL: srv.URL, Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	c := capture.Connection{RemoteIP: "10.0.0.1"}
+	p.EnrichConnection(&c)
+	if c.Tags["owner"] != "payments" {
+		t.Errorf("connection tags = %v", c.Tags)
+	}
+	slow := capture.NetworkPacket{DstIP: "9.9.9.9"}
+	p.EnrichPacket(&slow)
+	if slow.Malicious || slow.Tags != nil {
+		t.Errorf("slow packet = %+v", slow)
+	}
+
+	p.Event(event.Event{Type: event.DeviceConnected, Serial: "a"})
+	select {
+	case rec := <-events:
+		if rec.ID != 0 || rec.Event == nil || rec.Event.Serial != "a" {
+			t.Errorf("event record = %+v", rec)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event not posted")
+	}
+	if s := p.Stats(); s.Annotated != 1 || s.TimedOut != 1 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestNew_Config(t *testing.T) {
+	for _, cfg := range []Config{{}, {Command: "  "}, {Command: "cat", URL: "http://x"}, {URL: "ftp://x"}} {
+		if _, err := New(discard(), cfg); err == nil {
+			t.Errorf("New(%+v) succeeded", cfg)
+		}
+	}
+}
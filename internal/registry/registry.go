@@ -0,0 +1,297 @@
+// Package registry remembers every device the server has seen — when it
+// was first seen, how often it reconnected and how long it was online in
+// total — persisted to a JSON file so the history survives restarts and
+// the changing addresses of network devices.
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/atomicfile"
+)
+
+// maxSerials bounds the ADB serials remembered per device.
+const maxSerials = 16
+
+// Device is the history of one physical device. Its ID is the hardware
+// serial once known, otherwise the ADB serial it was first seen under.
+type Device struct {
+	ID string `json:"id"`
+	// HardwareSerial is ro.serialno (or ro.boot.serialno), read from
+	// network devices, whose ADB serial is an address.
+	HardwareSerial string `json:"hardware_serial,omitempty"`
+	// Serial is the latest ADB serial; Serials are all those seen, most
+	// recent last.
+	Serial  string   `json:"serial"`
+	Serials []string `json:"serials"`
+	Model   string   `json:"model,omitempty"`
+
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Connects counts the times the device came online; every one after
+	// the first is a reconnect.
+	Connects   int `json:"connects"`
+	Reconnects int `json:"reconnects"`
+	// UptimeMs is the time spent online, over every connection so far.
+	UptimeMs int64 `json:"uptime_ms"`
+	// OnlineSince is set while the device is online.
+	OnlineSince *time.Time `json:"online_since,omitempty"`
+}
+
+// Uptime returns the total time online up to now.
+func (d Device) Uptime(now time.Time) time.Duration {
+	up := time.Duration(d.UptimeMs) * time.Millisecond
+	if d.OnlineSince != nil && now.After(*d.OnlineSince) {
+		up += now.Sub(*d.OnlineSince)
+	}
+	return up
+}
+
+// Registry holds the history of every device. It is safe for concurrent
+// use.
+type Registry struct {
+	path string
+
+	mu      sync.Mutex
+	devices map[string]*Device // by ID
+	serials map[string]string  // ADB serial -> ID
+}
+
+// Open loads the registry kept at path. A missing file is an empty
+// registry; an empty path keeps it in memory only. Sessions still open in
+// the file, left by a server that did not shut down cleanly, are closed at
+// their LastSeen.
+func Open(path string) (*Registry, error) {
+	r := &Registry{path: path, devices: make(map[string]*Device), serials: make(map[string]string)}
+	if path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read device registry: %w", err)
+	}
+	var list []Device
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse device registry %s: %w", path, err)
+	}
+	for _, d := range list {
+		if d.ID == "" {
+			continue
+		}
+		d.endSession(d.LastSeen)
+		r.devices[d.ID] = &d
+		for _, s := range d.Serials {
+			r.serials[s] = d.ID
+		}
+	}
+	return r, nil
+}
+
+// Path returns the file the registry is saved to, or "" if in memory.
+func (r *Registry) Path() string {
+	return r.path
+}
+
+// Connected records that serial came online at, and saves the registry.
+// A device already online is only touched.
+func (r *Registry) Connected(serial, model string, at time.Time) (Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d := r.lookupLocked(serial)
+	if d == nil {
+		d = &Device{ID: serial, FirstSeen: at}
+		r.devices[d.ID] = d
+	}
+	d.seenAs(serial)
+	r.serials[serial] = d.ID
+	if model != "" {
+		d.Model = model
+	}
+	d.LastSeen = at
+	if d.OnlineSince == nil {
+		if d.Connects > 0 {
+			d.Reconnects++
+		}
+		d.Connects++
+		d.OnlineSince = &at
+	}
+	return *d, r.saveLocked()
+}
+
+// Disconnected records that serial went offline at, adding the session
+// to its uptime, and saves the registry.
+func (r *Registry) Disconnected(serial string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d := r.lookupLocked(serial)
+	if d == nil || d.OnlineSince == nil {
+		return nil
+	}
+	d.LastSeen = at
+	d.endSession(at)
+	return r.saveLocked()
+}
+
+// Identify records the hardware serial read from the device at serial. A
+// network device seen before under another address is merged into its
+// earlier entry, so its history continues; otherwise the entry takes the
+// hardware serial as its ID. The registry is saved.
+func (r *Registry) Identify(serial, hardware string) (Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d := r.lookupLocked(serial)
+	if d == nil {
+		return Device{}, fmt.Errorf("unknown device %s", serial)
+	}
+	if hardware == "" || d.HardwareSerial == hardware {
+		return *d, nil
+	}
+	if d.ID == hardware {
+		d.HardwareSerial = hardware
+		return *d, r.saveLocked()
+	}
+
+	if known, ok := r.devices[hardware]; ok {
+		known.merge(d)
+		delete(r.devices, d.ID)
+		d = known
+	} else {
+		delete(r.devices, d.ID)
+		d.ID = hardware
+		r.devices[d.ID] = d
+	}
+	d.HardwareSerial = hardware
+	for _, s := range d.Serials {
+		r.serials[s] = d.ID
+	}
+	return *d, r.saveLocked()
+}
+
+// Get returns the entry of the device at ADB serial.
+func (r *Registry) Get(serial string) (Device, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.lookupLocked(serial)
+	if d == nil {
+		return Device{}, false
+	}
+	return *d, true
+}
+
+// All returns every entry, most recently seen first.
+func (r *Registry) All() []Device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Device, 0, len(r.devices))
+	for _, d := range r.devices {
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].LastSeen.Equal(out[j].LastSeen) {
+			return out[i].LastSeen.After(out[j].LastSeen)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Close ends every open session at at and saves the registry; call it at
+// shutdown so uptime is counted up to then.
+func (r *Registry) Close(at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.devices {
+		if d.OnlineSince != nil {
+			d.LastSeen = at
+			d.endSession(at)
+		}
+	}
+	return r.saveLocked()
+}
+
+func (r *Registry) lookupLocked(serial string) *Device {
+	if id, ok := r.serials[serial]; ok {
+		return r.devices[id]
+	}
+	return r.devices[serial]
+}
+
+// seenAs makes serial the device's latest ADB serial.
+func (d *Device) seenAs(serial string) {
+	d.Serial = serial
+	d.Serials = slices.DeleteFunc(d.Serials, func(s string) bool { return s == serial })
+	d.Serials = append(d.Serials, serial)
+	if len(d.Serials) > maxSerials {
+		d.Serials = d.Serials[len(d.Serials)-maxSerials:]
+	}
+}
+
+func (d *Device) endSession(at time.Time) {
+	if d.OnlineSince == nil {
+		return
+	}
+	if at.After(*d.OnlineSince) {
+		d.UptimeMs += at.Sub(*d.OnlineSince).Milliseconds()
+	}
+	d.OnlineSince = nil
+}
+
+// merge folds o, a newer entry of the same device, into d. o's first
+// connect is a reconnect of d.
+func (d *Device) merge(o *Device) {
+	if o.FirstSeen.Before(d.FirstSeen) {
+		d.FirstSeen = o.FirstSeen
+	}
+	if o.LastSeen.After(d.LastSeen) {
+		d.LastSeen = o.LastSeen
+	}
+	if o.Connects > 0 && d.Connects > 0 {
+		d.Reconnects++
+	}
+	d.Connects += o.Connects
+	d.Reconnects += o.Reconnects
+	d.UptimeMs += o.UptimeMs
+	if d.OnlineSince == nil {
+		d.OnlineSince = o.OnlineSince
+	}
+	if o.Model != "" {
+		d.Model = o.Model
+	}
+	for _, s := range o.Serials {
+		d.seenAs(s)
+	}
+}
+
+// saveLocked replaces the registry file with the known devices.
+func (r *Registry) saveLocked() error {
+	if r.path == "" {
+		return nil
+	}
+	list := make([]Device, 0, len(r.devices))
+	for _, d := range r.devices {
+		list = append(list, *d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := atomicfile.WriteFile(r.path, append(data, '\n')); err != nil {
+		return fmt.Errorf("save device registry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRegistry_ReconnectsAndUptime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "devices.json")
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	r.Connected("A1", "Pixel 7", t0)
+	r.Connected("A1", "", t0.Add(time.Minute)) // state change while online
+	r.Disconnected("A1", t0.Add(10*time.Minute))
+	r.Connected("A1", "", t0.Add(time.Hour))
+
+	r2, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, ok := r2.Get("A1")
+	if !ok {
+		t.Fatal("A1 not persisted")
+	}
+	if d.Connects != 2 || d.Reconnects != 1 || !d.FirstSeen.Equal(t0) || d.Model != "Pixel 7" {
+		t.Errorf("reloaded %+v", d)
+	}
+	// The session left open by the first registry ends at LastSeen.
+	if d.OnlineSince != nil || d.Uptime(t0.Add(2*time.Hour)) != 10*time.Minute {
+		t.Errorf("uptime %s, online since %v", d.Uptime(t0.Add(2*time.Hour)), d.OnlineSince)
+	}
+
+	r2.Connected("A1", "", t0.Add(3*time.Hour))
+	if err := r2.Close(t0.Add(4 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := r2.Get("A1"); d.UptimeMs != (70 * time.Minute).Milliseconds() {
+		t.Errorf("uptime after Close: %dms", d.UptimeMs)
+	}
+}
+
+func TestRegistry_IdentifyNetworkDevice(t *testing.T) {
+	r, _ := Open("")
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// First seen over USB, then over Wi-Fi at two addresses.
+	r.Connected("HW123", "Pixel 7", t0)
+	r.Disconnected("HW123", t0.Add(time.Minute))
+	r.Connected("192.168.1.5:5555", "", t0.Add(time.Hour))
+	d, err := r.Identify("192.168.1.5:5555", "HW123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.ID != "HW123" || d.Connects != 2 || d.Reconnects != 1 || !d.FirstSeen.Equal(t0) {
+		t.Errorf("merged %+v", d)
+	}
+	r.Disconnected("192.168.1.5:5555", t0.Add(2*time.Hour))
+	r.Connected("192.168.1.9:5555", "", t0.Add(3*time.Hour))
+	r.Identify("192.168.1.9:5555", "HW123")
+
+	all := r.All()
+	if len(all) != 1 {
+		t.Fatalf("entries %+v", all)
+	}
+	d = all[0]
+	if want := []string{"HW123", "192.168.1.5:5555", "192.168.1.9:5555"}; !reflect.DeepEqual(d.Serials, want) || d.Serial != want[2] {
+		t.Errorf("serials %v (latest %s)", d.Serials, d.Serial)
+	}
+	if d.Connects != 3 || d.Reconnects != 2 || d.UptimeMs != (61*time.Minute).Milliseconds() {
+		t.Errorf("history %+v", d)
+	}
+	if got, ok := r.Get("192.168.1.5:5555"); !ok || got.ID != "HW123" {
+		t.Errorf("old address resolves to %+v", got)
+	}
+
+	// A device unknown under its hardware serial takes it as its ID.
+	r.Connected("10.0.0.7:5555", "", t0)
+	if d, _ := r.Identify("10.0.0.7:5555", "HW999"); d.ID != "HW999" || d.HardwareSerial != "HW999" {
+		t.Errorf("renamed %+v", d)
+	}
+}
@@ -0,0 +1,97 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+	"time":  func(t time.Time) string { return t.Format("2006-01-02 15:04 MST") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 0.5em 0 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.6em; text-align: left; }
+td.n { text-align: right; font-variant-numeric: tabular-nums; }
+.muted { color: #777; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{time .From}} – {{time .To}}{{if .Partial}} <span class="muted">(partial)</span>{{end}}<br>
+<span class="muted">Generated {{time .GeneratedAt}}</span></p>
+{{- if not .Devices}}
+<p>No traffic was captured.</p>
+{{- end}}
+{{- range .Devices}}
+<h2>{{.Serial}}</h2>
+<table>
+<tr><th>Bytes</th><th>Packets</th><th>Connections</th><th>Destinations</th></tr>
+<tr><td class="n">{{bytes .Bytes}}</td><td class="n">{{.Packets}}</td><td class="n">{{.Connections}}</td><td class="n">{{.Destinations}}</td></tr>
+</table>
+{{- if .TopHosts}}
+<h3>Top hosts</h3>
+{{template "hosts" .TopHosts}}
+{{- end}}
+<h3>New domains</h3>
+{{- if not .Baseline}}
+<p class="muted">No baseline yet: the device was first seen during this period.</p>
+{{- else if .NewDomains}}
+<ul>{{range .NewDomains}}<li>{{.}}</li>{{end}}</ul>
+{{- else}}
+<p class="muted">None.</p>
+{{- end}}
+{{- if .Apps}}
+<h3>Apps</h3>
+<table>
+<tr><th>App</th><th>Bytes</th><th>Packets</th><th>Connections</th><th>Destinations</th><th>Top host</th></tr>
+{{- range .Apps}}
+<tr><td>{{.App}}</td><td class="n">{{bytes .Bytes}}</td><td class="n">{{.Packets}}</td><td class="n">{{.Connections}}</td><td class="n">{{.Destinations}}</td><td>{{with .TopHosts}}{{(index . 0).Host}}{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+</body>
+</html>
+{{define "hosts"}}<table>
+<tr><th>Host</th><th>Bytes</th><th>Packets</th><th>Connections</th></tr>
+{{- range .}}
+<tr><td>{{.Host}}</td><td class="n">{{bytes .Bytes}}</td><td class="n">{{.Packets}}</td><td class="n">{{.Connections}}</td></tr>
+{{- end}}
+</table>{{end}}
+`))
+
+// Title names the report, e.g. "Daily traffic report, 2024-05-06".
+func (r *Report) Title() string {
+	kind := "Daily"
+	if r.Period == Weekly {
+		kind = "Weekly"
+	}
+	return fmt.Sprintf("%s traffic report, %s", kind, r.Period.Start(r.From).Format("2006-01-02"))
+}
+
+// WriteHTML renders the report as a standalone HTML page.
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, r)
+}
+
+// formatBytes formats n bytes with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
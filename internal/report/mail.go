@@ -0,0 +1,58 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// MailConfig is the SMTP server and addresses scheduled reports are sent
+// with. The server is asked for STARTTLS when it offers it; credentials,
+// when set, are only sent over TLS or to localhost.
+type MailConfig struct {
+	// Addr is the server's host:port.
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+func (m *MailConfig) validate() error {
+	if _, _, err := net.SplitHostPort(m.Addr); err != nil {
+		return fmt.Errorf("invalid SMTP address %q: %w", m.Addr, err)
+	}
+	if m.From == "" || len(m.To) == 0 {
+		return errors.New("report mail needs a sender and at least one recipient")
+	}
+	return nil
+}
+
+// send mails rep as an HTML message.
+func (m *MailConfig) send(rep *Report) error {
+	var body bytes.Buffer
+	if err := rep.WriteHTML(&body); err != nil {
+		return err
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", rep.Title()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, m.To, msg.Bytes())
+}
@@ -0,0 +1,639 @@
+// Package report summarizes captured traffic per device and per app over
+// days and weeks: the bytes and packets moved, the connections opened, the
+// busiest hosts, how many distinct destinations were contacted and which
+// domains were new against what the device had contacted before. Reports
+// are generated when a period ends, kept as JSON files in a directory,
+// rendered as HTML on request and optionally mailed.
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/atomicfile"
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+const (
+	// DefaultKeep is how many reports of each period are kept.
+	DefaultKeep = 60
+	// DefaultTop is how many hosts a summary lists.
+	DefaultTop = 10
+
+	// maxHosts bounds the hosts counted per device or app and period;
+	// traffic to further hosts still counts towards the totals.
+	maxHosts = 4096
+	// maxDomains bounds the domains remembered per device in the baseline;
+	// past it, domains are no longer reported as new.
+	maxDomains = 20000
+	// maxNewDomains bounds the new domains a summary lists.
+	maxNewDomains = 500
+	// connIdle is how long a connection's byte counters are kept after it
+	// was last seen.
+	connIdle = 24 * time.Hour
+
+	baselineFile = "baseline.json"
+)
+
+// ErrNotFound is returned for reports that are not kept.
+var ErrNotFound = errors.New("report not found")
+
+// Period is the span a report covers.
+type Period string
+
+const (
+	// Daily reports cover a day, from local midnight.
+	Daily Period = "daily"
+	// Weekly reports cover a week, from local midnight on Monday.
+	Weekly Period = "weekly"
+)
+
+// Periods are the periods reports are generated for.
+var Periods = []Period{Daily, Weekly}
+
+// ParsePeriod parses "daily" or "weekly".
+func ParsePeriod(s string) (Period, error) {
+	switch p := Period(s); p {
+	case Daily, Weekly:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown report period %q (want daily or weekly)", s)
+}
+
+// Start returns the start of the period that t falls in, in t's location.
+func (p Period) Start(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if p == Weekly {
+		// Monday is the first day of the week.
+		day = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return day
+}
+
+// End returns the end of the period starting at start.
+func (p Period) End(start time.Time) time.Time {
+	if p == Weekly {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Host is the traffic to one host, or IP where no hostname is known.
+type Host struct {
+	Host        string `json:"host"`
+	Bytes       int64  `json:"bytes"`
+	Packets     int    `json:"packets"`
+	Connections int    `json:"connections"`
+}
+
+// Totals is the traffic of a device or app over a period. Bytes are the
+// lengths of captured packets plus the growth of connections' byte
+// counters, so captures in either mode contribute.
+type Totals struct {
+	Bytes       int64 `json:"bytes"`
+	Packets     int   `json:"packets"`
+	Connections int   `json:"connections"`
+	// Destinations is the number of distinct hosts contacted.
+	Destinations int `json:"destinations"`
+	// TopHosts are the hosts with the most bytes, then connections.
+	TopHosts []Host `json:"top_hosts"`
+}
+
+// AppSummary is the traffic of one app of a device.
+type AppSummary struct {
+	App string `json:"app"`
+	Totals
+}
+
+// DeviceSummary is the traffic of one device.
+type DeviceSummary struct {
+	Serial string `json:"serial"`
+	Totals
+	// Baseline is set when the device's domains were known from before
+	// the period; only then are NewDomains reported.
+	Baseline bool `json:"baseline"`
+	// NewDomains are the domains contacted for the first time in the
+	// period, sorted.
+	NewDomains []string `json:"new_domains,omitempty"`
+	// Apps are the device's apps by bytes, for traffic the capture could
+	// attribute.
+	Apps []AppSummary `json:"apps,omitempty"`
+}
+
+// Report summarizes the traffic of every device over a period.
+type Report struct {
+	ID     string    `json:"id"`
+	Period Period    `json:"period"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Partial is set when the report does not cover its whole period:
+	// it was generated on demand, or observation began after the period
+	// started.
+	Partial     bool            `json:"partial"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Devices     []DeviceSummary `json:"devices"`
+}
+
+// Info describes a kept report.
+type Info struct {
+	ID          string    `json:"id"`
+	Period      Period    `json:"period"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Partial     bool      `json:"partial"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Devices     int       `json:"devices"`
+}
+
+// Config configures a Reporter. Zero Keep and Top select the defaults.
+type Config struct {
+	// Dir keeps the reports and the domain baseline.
+	Dir  string
+	Keep int
+	Top  int
+	// Mail sends each scheduled report by email when set.
+	Mail *MailConfig
+}
+
+// totals accumulates the traffic of a device or app over a period.
+type totals struct {
+	bytes       int64
+	packets     int
+	connections int
+	hosts       map[string]*Host
+}
+
+func newTotals() *totals {
+	return &totals{hosts: make(map[string]*Host)}
+}
+
+func (t *totals) add(host string, bytes int64, packets, connections int) {
+	t.bytes += bytes
+	t.packets += packets
+	t.connections += connections
+	if host == "" {
+		return
+	}
+	h, ok := t.hosts[host]
+	if !ok {
+		if len(t.hosts) >= maxHosts {
+			return
+		}
+		h = &Host{Host: host}
+		t.hosts[host] = h
+	}
+	h.Bytes += bytes
+	h.Packets += packets
+	h.Connections += connections
+}
+
+func (t *totals) summary(top int) Totals {
+	hosts := make([]Host, 0, len(t.hosts))
+	for _, h := range t.hosts {
+		hosts = append(hosts, *h)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].Bytes != hosts[j].Bytes {
+			return hosts[i].Bytes > hosts[j].Bytes
+		}
+		if hosts[i].Connections != hosts[j].Connections {
+			return hosts[i].Connections > hosts[j].Connections
+		}
+		return hosts[i].Host < hosts[j].Host
+	})
+	return Totals{
+		Bytes:        t.bytes,
+		Packets:      t.packets,
+		Connections:  t.connections,
+		Destinations: len(hosts),
+		TopHosts:     hosts[:min(top, len(hosts))],
+	}
+}
+
+// device accumulates the traffic of a device over a period.
+type device struct {
+	*totals
+	apps    map[string]*totals
+	domains map[string]struct{}
+}
+
+// period accumulates the traffic of the period from from.
+type period struct {
+	period  Period
+	from    time.Time
+	devices map[string]*device
+}
+
+func (p *period) device(serial string) *device {
+	d, ok := p.devices[serial]
+	if !ok {
+		d = &device{totals: newTotals(), apps: make(map[string]*totals), domains: make(map[string]struct{})}
+		p.devices[serial] = d
+	}
+	return d
+}
+
+// baseline is the domains a device has contacted, with when each was
+// first seen.
+type baseline struct {
+	Since   time.Time            `json:"since"`
+	Domains map[string]time.Time `json:"domains"`
+}
+
+// Reporter accumulates traffic and generates reports from it. It is safe
+// for concurrent use.
+type Reporter struct {
+	log *slog.Logger
+	cfg Config
+	now func() time.Time
+
+	mu        sync.Mutex
+	periods   []*period
+	conns     capture.ConnCounters
+	baselines map[string]*baseline
+}
+
+// New creates a reporter keeping its reports in cfg.Dir, loading the
+// domain baseline left there by an earlier run.
+func New(log *slog.Logger, cfg Config) (*Reporter, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("report directory is required")
+	}
+	if cfg.Keep <= 0 {
+		cfg.Keep = DefaultKeep
+	}
+	if cfg.Top <= 0 {
+		cfg.Top = DefaultTop
+	}
+	if cfg.Mail != nil {
+		if err := cfg.Mail.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create report dir: %w", err)
+	}
+	r := &Reporter{
+		log:       log.With("component", "report"),
+		cfg:       cfg,
+		now:       time.Now,
+		baselines: make(map[string]*baseline),
+	}
+	data, err := os.ReadFile(filepath.Join(cfg.Dir, baselineFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("load report baseline: %w", err)
+	default:
+		if err := json.Unmarshal(data, &r.baselines); err != nil {
+			return nil, fmt.Errorf("load report baseline: %w", err)
+		}
+	}
+	now := r.now()
+	for _, p := range Periods {
+		r.periods = append(r.periods, &period{period: p, from: now, devices: make(map[string]*device)})
+	}
+	return r, nil
+}
+
+// ObservePacket accounts a captured packet to its device and, when the
+// capture knows its sender, its app. Packets without a length are those a
+// capture derives from connections, which ObserveConnection accounts.
+func (r *Reporter) ObservePacket(p capture.NetworkPacket) {
+	if p.Length <= 0 {
+		return
+	}
+	host := hostOnly(p.HTTPHost)
+	if host == "" {
+		host = remoteIP(p)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	r.add(p.Serial, p.App, host, int64(p.Length), 1, 0)
+	r.seeDomain(p.Serial, host, now)
+}
+
+// ObserveConnection accounts a connection as reported by a capture: its
+// first sighting opens a connection, and growth of its byte counters is
+// traffic.
+func (r *Reporter) ObserveConnection(c capture.Connection) {
+	host := c.Hostname
+	if host == "" {
+		host = c.RemoteIP
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	bytes, known := r.conns.Observe(c, now)
+	opened := 0
+	if !known {
+		opened = 1
+	}
+	r.add(c.Serial, c.AppName, host, bytes, 0, opened)
+	r.seeDomain(c.Serial, c.Hostname, now)
+}
+
+// ObserveLookup records the domain a device looked up.
+func (r *Reporter) ObserveLookup(l capture.DNSLookup) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seeDomain(l.Serial, l.Query, r.now())
+}
+
+// remoteIP returns the remote end of a packet: the non-private address,
+// preferring the destination.
+func remoteIP(p capture.NetworkPacket) string {
+	if !isLocal(p.DstIP) || isLocal(p.SrcIP) {
+		return p.DstIP
+	}
+	return p.SrcIP
+}
+
+func isLocal(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	return addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified()
+}
+
+// hostOnly strips the port off an HTTP Host header.
+func hostOnly(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// add accounts traffic to the device and its app in every period.
+func (r *Reporter) add(serial, app, host string, bytes int64, packets, connections int) {
+	for _, p := range r.periods {
+		d := p.device(serial)
+		d.add(host, bytes, packets, connections)
+		if app != "" {
+			t, ok := d.apps[app]
+			if !ok {
+				t = newTotals()
+				d.apps[app] = t
+			}
+			t.add(host, bytes, packets, connections)
+		}
+	}
+}
+
+// seeDomain records that serial contacted domain: in every period, and in
+// its baseline when it is the first time.
+func (r *Reporter) seeDomain(serial, domain string, now time.Time) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if domain == "" || net.ParseIP(domain) != nil {
+		return
+	}
+	b, ok := r.baselines[serial]
+	if !ok {
+		b = &baseline{Since: now, Domains: make(map[string]time.Time)}
+		r.baselines[serial] = b
+	}
+	if _, ok := b.Domains[domain]; !ok && len(b.Domains) < maxDomains {
+		b.Domains[domain] = now
+	}
+	for _, p := range r.periods {
+		if d := p.device(serial); len(d.domains) < maxHosts {
+			d.domains[domain] = struct{}{}
+		}
+	}
+}
+
+// report builds the report of p up to to. Call with r.mu held.
+func (r *Reporter) report(p *period, to time.Time, partial bool) *Report {
+	rep := &Report{
+		Period:      p.period,
+		From:        p.from,
+		To:          to,
+		Partial:     partial || !p.from.Equal(p.period.Start(p.from)),
+		GeneratedAt: r.now(),
+		Devices:     make([]DeviceSummary, 0, len(p.devices)),
+	}
+	rep.ID = string(p.period) + "-" + p.period.Start(p.from).Format("2006-01-02")
+	if partial {
+		rep.ID += "-" + rep.GeneratedAt.Format("150405")
+	}
+	for serial, d := range p.devices {
+		s := DeviceSummary{Serial: serial, Totals: d.summary(r.cfg.Top)}
+		if b, ok := r.baselines[serial]; ok && b.Since.Before(p.from) {
+			s.Baseline = true
+			for domain := range d.domains {
+				if first, ok := b.Domains[domain]; ok && !first.Before(p.from) {
+					s.NewDomains = append(s.NewDomains, domain)
+				}
+			}
+			sort.Strings(s.NewDomains)
+			s.NewDomains = s.NewDomains[:min(len(s.NewDomains), maxNewDomains)]
+		}
+		for app, t := range d.apps {
+			s.Apps = append(s.Apps, AppSummary{App: app, Totals: t.summary(r.cfg.Top)})
+		}
+		sort.Slice(s.Apps, func(i, j int) bool {
+			if s.Apps[i].Bytes != s.Apps[j].Bytes {
+				return s.Apps[i].Bytes > s.Apps[j].Bytes
+			}
+			return s.Apps[i].App < s.Apps[j].App
+		})
+		rep.Devices = append(rep.Devices, s)
+	}
+	sort.Slice(rep.Devices, func(i, j int) bool { return rep.Devices[i].Serial < rep.Devices[j].Serial })
+	return rep
+}
+
+// Generate reports on the period p so far, keeps the report and returns
+// it. The period goes on accumulating.
+func (r *Reporter) Generate(p Period) (*Report, error) {
+	r.mu.Lock()
+	var rep *Report
+	for _, acc := range r.periods {
+		if acc.period == p {
+			rep = r.report(acc, r.now(), true)
+		}
+	}
+	r.mu.Unlock()
+	if rep == nil {
+		return nil, fmt.Errorf("unknown report period %q", p)
+	}
+	if err := r.save(rep); err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+// closeEnded closes the periods that ended by now, starting the next ones,
+// and returns their reports.
+func (r *Reporter) closeEnded(now time.Time) []*Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*Report
+	for i, p := range r.periods {
+		end := p.period.End(p.period.Start(p.from))
+		if now.Before(end) {
+			continue
+		}
+		out = append(out, r.report(p, end, false))
+		r.periods[i] = &period{period: p.period, from: p.period.Start(now), devices: make(map[string]*device)}
+	}
+	if len(out) > 0 {
+		r.conns.Forget(now, connIdle)
+	}
+	return out
+}
+
+// nextEnd returns when the first of the open periods ends.
+func (r *Reporter) nextEnd() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var next time.Time
+	for _, p := range r.periods {
+		if end := p.period.End(p.period.Start(p.from)); next.IsZero() || end.Before(next) {
+			next = end
+		}
+	}
+	return next
+}
+
+// Run generates the report of each period as it ends, keeping and mailing
+// it, until ctx is done. The baseline is saved with every report and when
+// Run returns.
+func (r *Reporter) Run(ctx context.Context) {
+	defer func() {
+		if err := r.saveBaseline(); err != nil {
+			r.log.Warn("failed to save report baseline", "error", err)
+		}
+	}()
+	for {
+		timer := time.NewTimer(time.Until(r.nextEnd()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		for _, rep := range r.closeEnded(r.now()) {
+			r.publish(rep)
+		}
+		if err := r.saveBaseline(); err != nil {
+			r.log.Warn("failed to save report baseline", "error", err)
+		}
+	}
+}
+
+// publish keeps a scheduled report and mails it.
+func (r *Reporter) publish(rep *Report) {
+	if err := r.save(rep); err != nil {
+		r.log.Warn("failed to save report", "id", rep.ID, "error", err)
+	}
+	r.log.Info("traffic report generated", "id", rep.ID, "devices", len(rep.Devices))
+	if r.cfg.Mail != nil {
+		if err := r.cfg.Mail.send(rep); err != nil {
+			r.log.Warn("failed to mail report", "id", rep.ID, "error", err)
+		}
+	}
+}
+
+// save writes rep to the report dir and drops the oldest reports of its
+// period past Keep.
+func (r *Reporter) save(rep *Report) error {
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(filepath.Join(r.cfg.Dir, rep.ID+".json"), append(data, '\n')); err != nil {
+		return fmt.Errorf("save report: %w", err)
+	}
+	infos, err := r.List()
+	if err != nil {
+		// The report is kept; pruning waits for the next one.
+		return nil
+	}
+	var same []Info
+	for _, info := range infos {
+		if info.Period == rep.Period {
+			same = append(same, info)
+		}
+	}
+	// List returns the newest first.
+	for _, old := range same[min(len(same), r.cfg.Keep):] {
+		os.Remove(filepath.Join(r.cfg.Dir, old.ID+".json"))
+	}
+	return nil
+}
+
+func (r *Reporter) saveBaseline() error {
+	r.mu.Lock()
+	data, err := json.Marshal(r.baselines)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(filepath.Join(r.cfg.Dir, baselineFile), append(data, '\n')); err != nil {
+		return fmt.Errorf("save report baseline: %w", err)
+	}
+	return nil
+}
+
+// List returns the kept reports, newest first.
+func (r *Reporter) List() ([]Info, error) {
+	entries, err := os.ReadDir(r.cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("list reports: %w", err)
+	}
+	var out []Info
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() || e.Name() == baselineFile {
+			continue
+		}
+		rep, err := r.Get(id)
+		if err != nil {
+			continue
+		}
+		out = append(out, Info{ID: rep.ID, Period: rep.Period, From: rep.From, To: rep.To,
+			Partial: rep.Partial, GeneratedAt: rep.GeneratedAt, Devices: len(rep.Devices)})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].To.Equal(out[j].To) {
+			return out[i].To.After(out[j].To)
+		}
+		return out[i].GeneratedAt.After(out[j].GeneratedAt)
+	})
+	return out, nil
+}
+
+// Get returns the kept report with the given ID.
+func (r *Reporter) Get(id string) (*Report, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") || id+".json" == baselineFile {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(r.cfg.Dir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read report: %w", err)
+	}
+	var rep Report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		return nil, fmt.Errorf("read report %s: %w", id, err)
+	}
+	return &rep, nil
+}
@@ -0,0 +1,140 @@
+package report
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+func newTestReporter(t *testing.T, now *time.Time) *Reporter {
+	t.Helper()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	r, err := New(log, Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.now = func() time.Time { return *now }
+	for _, p := range r.periods {
+		p.from = *now
+	}
+	return r
+}
+
+func TestPeriodStart(t *testing.T) {
+	// A Wednesday afternoon.
+	at := time.Date(2024, 5, 8, 15, 30, 0, 0, time.UTC)
+	if got := Daily.Start(at); !got.Equal(time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("daily start = %v", got)
+	}
+	if got := Weekly.Start(at); !got.Equal(time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("weekly start = %v", got)
+	}
+	if got := Weekly.End(Weekly.Start(at)); !got.Equal(time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("weekly end = %v", got)
+	}
+}
+
+func TestReporter(t *testing.T) {
+	now := time.Date(2024, 5, 8, 15, 0, 0, 0, time.UTC)
+	r := newTestReporter(t, &now)
+
+	conn := capture.Connection{Serial: "dev1", Protocol: capture.ProtoTCP, LocalIP: "10.0.0.2", LocalPort: 40000,
+		RemoteIP: "93.184.216.34", RemotePort: 443, Hostname: "example.com", AppName: "com.example.app", BytesSent: 1000}
+	r.ObserveConnection(conn)
+	conn.BytesReceived = 4000
+	r.ObserveConnection(conn)
+	r.ObservePacket(capture.NetworkPacket{Serial: "dev1", SrcIP: "10.0.0.2", DstIP: "1.1.1.1", Length: 100})
+	r.ObservePacket(capture.NetworkPacket{Serial: "dev1", SrcIP: "10.0.0.2", DstIP: "1.1.1.1"})
+
+	now = time.Date(2024, 5, 9, 0, 0, 1, 0, time.UTC)
+	reps := r.closeEnded(now)
+	if len(reps) != 1 || reps[0].Period != Daily {
+		t.Fatalf("closed %+v", reps)
+	}
+	first := reps[0]
+	if first.ID != "daily-2024-05-08" || !first.Partial || len(first.Devices) != 1 {
+		t.Fatalf("first report = %+v", first)
+	}
+	dev := first.Devices[0]
+	if dev.Bytes != 5100 || dev.Packets != 1 || dev.Connections != 1 || dev.Destinations != 2 {
+		t.Errorf("device totals = %+v", dev.Totals)
+	}
+	if dev.TopHosts[0].Host != "example.com" || dev.TopHosts[0].Bytes != 5000 {
+		t.Errorf("top hosts = %+v", dev.TopHosts)
+	}
+	if dev.Baseline || dev.NewDomains != nil {
+		t.Errorf("first period has a baseline: %+v", dev)
+	}
+	if len(dev.Apps) != 1 || dev.Apps[0].App != "com.example.app" || dev.Apps[0].Bytes != 5000 {
+		t.Errorf("apps = %+v", dev.Apps)
+	}
+
+	// The next day, one domain is known and one is new.
+	now = now.Add(time.Hour)
+	r.ObserveLookup(capture.DNSLookup{Serial: "dev1", Query: "example.com."})
+	r.ObservePacket(capture.NetworkPacket{Serial: "dev1", SrcIP: "10.0.0.2", DstIP: "5.6.7.8",
+		HTTPHost: "Tracker.example:8080", Length: 300})
+	rep, err := r.Generate(Daily)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev = rep.Devices[0]
+	if !rep.Partial || !dev.Baseline || len(dev.NewDomains) != 1 || dev.NewDomains[0] != "tracker.example" {
+		t.Errorf("on-demand report = %+v, device %+v", rep, dev)
+	}
+
+	var html bytes.Buffer
+	if err := rep.WriteHTML(&html); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Daily traffic report, 2024-05-09", "tracker.example", "300 B"} {
+		if !strings.Contains(html.String(), want) {
+			t.Errorf("HTML lacks %q", want)
+		}
+	}
+
+	if err := r.save(first); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := r.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].ID != rep.ID || infos[1].ID != first.ID {
+		t.Errorf("list = %+v", infos)
+	}
+	if got, err := r.Get(first.ID); err != nil || got.Devices[0].Bytes != 5100 {
+		t.Errorf("get = %+v, %v", got, err)
+	}
+	for _, id := range []string{"../x", "baseline", "missing"} {
+		if _, err := r.Get(id); err != ErrNotFound {
+			t.Errorf("Get(%q) = %v", id, err)
+		}
+	}
+
+	// The baseline survives a restart.
+	if err := r.saveBaseline(); err != nil {
+		t.Fatal(err)
+	}
+	r2, err := New(r.log, Config{Dir: r.cfg.Dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r2.baselines["dev1"].Domains) != 2 {
+		t.Errorf("reloaded baseline = %+v", r2.baselines["dev1"])
+	}
+}
+
+func TestNew_Mail(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, m := range []MailConfig{{Addr: "smtp.example.com", From: "a@x", To: []string{"b@x"}}, {Addr: "smtp.example.com:25"}} {
+		if _, err := New(log, Config{Dir: t.TempDir(), Mail: &m}); err == nil {
+			t.Errorf("New accepted mail config %+v", m)
+		}
+	}
+}
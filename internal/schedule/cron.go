@@ -0,0 +1,166 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronExpr is a parsed five-field cron expression: minute, hour, day of
+// month, month and day of week. Each field is a bit set of allowed values.
+type cronExpr struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a literal "*", for the classic rule that a
+	// day matches if either restricted day field does.
+	domAny, dowAny bool
+}
+
+// cronField is the range of one cron field.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are both Sunday
+}
+
+// parseCron parses expressions such as "0 9 * * 1-5" or "*/15 * * * *".
+// Fields accept *, single values, ranges (a-b), steps (*/n, a-b/n) and
+// comma-separated lists of those.
+func parseCron(s string) (cronExpr, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return cronExpr{}, fmt.Errorf("cron %q: want 5 fields (minute hour day-of-month month day-of-week), got %d", s, len(fields))
+	}
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return cronExpr{}, fmt.Errorf("cron %q: %w", s, err)
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1 // Sunday
+	}
+	return cronExpr{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: fields[2] == "*", dowAny: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(s string, f cronField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: invalid step %q", f.name, stepStr)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = cronValue(a, f); err != nil {
+				return 0, err
+			}
+			if hi, err = cronValue(b, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s: empty range %q", f.name, rng)
+			}
+		default:
+			v, err := cronValue(rng, f)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func cronValue(s string, f cronField) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s: %q is not in %d-%d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// dayMatches applies cron's day rule: when both day fields are restricted,
+// either may match.
+func (c cronExpr) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// matches reports whether the minute containing t matches.
+func (c cronExpr) matches(t time.Time) bool {
+	return c.minute&(1<<t.Minute()) != 0 &&
+		c.hour&(1<<t.Hour()) != 0 &&
+		c.month&(1<<int(t.Month())) != 0 &&
+		c.dayMatches(t)
+}
+
+// maxCronSearch bounds how far next looks ahead; every valid expression
+// matches within it, leap days included.
+const maxCronSearch = 5 * 366 * 24 * time.Hour
+
+// next returns the first matching minute strictly after t, or the zero time
+// if there is none (such as February 30th).
+func (c cronExpr) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.Add(maxCronSearch)
+	for t.Before(end) {
+		switch {
+		case c.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// prev returns the last matching minute at or before t, looking back no
+// further than limit; ok is false if there is none.
+func (c cronExpr) prev(t time.Time, limit time.Duration) (time.Time, bool) {
+	t = t.Truncate(time.Minute)
+	for start := t.Add(-limit); !t.Before(start); t = t.Add(-time.Minute) {
+		if c.matches(t) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
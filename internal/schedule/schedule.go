@@ -0,0 +1,357 @@
+// Package schedule decides when captures should run. A schedule is either
+// recurring — capture windows opening at each match of a cron expression
+// and lasting a fixed duration, e.g. "0 9 * * 1-5" for 8h — or a one-off
+// capture bounded by a duration. Schedules are persisted as JSON so they
+// survive restarts.
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/atomicfile"
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+// MaxDuration bounds the length of a capture window.
+const MaxDuration = 7 * 24 * time.Hour
+
+var (
+	// ErrNotFound indicates no schedule exists with the given ID.
+	ErrNotFound = errors.New("schedule not found")
+	// ErrInvalid indicates a schedule definition failed validation.
+	ErrInvalid = errors.New("invalid schedule")
+)
+
+// Schedule says when to capture on which devices.
+type Schedule struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+
+	// Cron opens a capture window at each match: "minute hour
+	// day-of-month month day-of-week", in Timezone. Empty for a one-off
+	// capture.
+	Cron string `json:"cron,omitempty"`
+	// Timezone is the IANA zone Cron is read in; the server's local time
+	// if empty.
+	Timezone string `json:"timezone,omitempty"`
+	// Start is when a one-off capture begins; it defaults to when the
+	// schedule is created. Recurring schedules ignore it.
+	Start *time.Time `json:"start,omitempty"`
+	// Duration is how long each window lasts, as a Go duration ("10m",
+	// "8h"), up to MaxDuration.
+	Duration string `json:"duration"`
+
+	// Serials are the devices to capture on. If empty, every online device,
+	// or those in Group and carrying Tag when given.
+	Serials []string `json:"serials,omitempty"`
+	Group   string   `json:"group,omitempty"`
+	Tag     string   `json:"tag,omitempty"`
+	// Mode is the capture mode (auto, tcpdump, procnet or ss); auto if
+	// empty.
+	Mode string `json:"mode,omitempty"`
+
+	// Disabled schedules are kept but never open windows.
+	Disabled  bool      `json:"disabled,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// compiled is a validated schedule ready for evaluation.
+type compiled struct {
+	Schedule
+	cron     *cronExpr
+	loc      *time.Location
+	duration time.Duration
+	mode     capture.Mode
+}
+
+func compile(s Schedule) (compiled, error) {
+	c := compiled{Schedule: s, loc: time.Local}
+	d, err := time.ParseDuration(s.Duration)
+	if err != nil || d < time.Minute || d > MaxDuration {
+		return c, fmt.Errorf("%w: duration must be between 1m and %s", ErrInvalid, MaxDuration)
+	}
+	c.duration = d
+	if c.mode, err = capture.ParseMode(s.Mode); err != nil {
+		return c, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if s.Timezone != "" {
+		if c.loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return c, fmt.Errorf("%w: unknown timezone %q", ErrInvalid, s.Timezone)
+		}
+	}
+	if s.Cron != "" {
+		c.Start = nil
+		expr, err := parseCron(s.Cron)
+		if err != nil {
+			return c, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if expr.next(time.Now()).IsZero() {
+			return c, fmt.Errorf("%w: cron %q never matches", ErrInvalid, s.Cron)
+		}
+		c.cron = &expr
+	} else if s.Start == nil {
+		return c, fmt.Errorf("%w: a one-off schedule needs a start", ErrInvalid)
+	}
+	return c, nil
+}
+
+// window returns the capture window containing t, if any.
+func (c compiled) window(t time.Time) (start, end time.Time, ok bool) {
+	if c.Disabled {
+		return start, end, false
+	}
+	if c.cron == nil {
+		start, end = *c.Start, c.Start.Add(c.duration)
+	} else {
+		var found bool
+		if start, found = c.cron.prev(t.In(c.loc), c.duration); !found {
+			return start, end, false
+		}
+		end = start.Add(c.duration)
+	}
+	return start, end, !t.Before(start) && t.Before(end)
+}
+
+// nextStart returns when the next window after t opens, or the zero time
+// if none will.
+func (c compiled) nextStart(t time.Time) time.Time {
+	switch {
+	case c.Disabled:
+		return time.Time{}
+	case c.cron == nil:
+		if c.Start.After(t) {
+			return *c.Start
+		}
+		return time.Time{}
+	default:
+		return c.cron.next(t.In(c.loc))
+	}
+}
+
+// finished reports whether a one-off schedule's window is over.
+func (c compiled) finished(t time.Time) bool {
+	return c.cron == nil && !t.Before(c.Start.Add(c.duration))
+}
+
+// Status is a schedule with its state at some instant.
+type Status struct {
+	Schedule
+	// Active is set while a window is open; WindowEnd is when it closes.
+	Active    bool       `json:"active"`
+	WindowEnd *time.Time `json:"window_end,omitempty"`
+	// NextStart is when the next window opens, if one will.
+	NextStart *time.Time `json:"next_start,omitempty"`
+}
+
+// Due is an open window: capture on the schedule's devices in
+// CaptureMode.
+type Due struct {
+	Schedule
+	CaptureMode capture.Mode
+}
+
+// Store holds all schedules. It is safe for concurrent use.
+type Store struct {
+	path string
+
+	mu        sync.RWMutex
+	schedules map[string]compiled
+	nextID    int
+}
+
+// Open loads the schedules kept at path. A missing file is an empty store;
+// an empty path keeps schedules in memory only.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, schedules: make(map[string]compiled)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read schedules: %w", err)
+	}
+	var list []Schedule
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse schedules %s: %w", path, err)
+	}
+	for _, sch := range list {
+		if sch.ID == "" {
+			return nil, fmt.Errorf("schedule without ID in %s", path)
+		}
+		c, err := compile(sch)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s in %s: %w", sch.ID, path, err)
+		}
+		s.schedules[sch.ID] = c
+		if n, err := strconv.Atoi(strings.TrimPrefix(sch.ID, "sch-")); err == nil && n > s.nextID {
+			s.nextID = n
+		}
+	}
+	return s, nil
+}
+
+// List returns every schedule with its state at now, ordered by creation.
+func (s *Store) List(now time.Time) []Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Status, 0, len(s.schedules))
+	for _, c := range s.schedules {
+		out = append(out, c.status(now))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Get returns a schedule with its state at now.
+func (s *Store) Get(id string, now time.Time) (Status, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.schedules[id]
+	if !ok {
+		return Status{}, ErrNotFound
+	}
+	return c.status(now), nil
+}
+
+func (c compiled) status(now time.Time) Status {
+	st := Status{Schedule: c.Schedule}
+	if _, end, ok := c.window(now); ok {
+		st.Active = true
+		st.WindowEnd = &end
+	}
+	if next := c.nextStart(now); !next.IsZero() {
+		st.NextStart = &next
+	}
+	return st
+}
+
+// Add validates and stores a new schedule. A one-off schedule without a
+// start begins now.
+func (s *Store) Add(sch Schedule, now time.Time) (Schedule, error) {
+	sch.CreatedAt = now
+	if sch.Cron == "" && sch.Start == nil {
+		sch.Start = &now
+	}
+	c, err := compile(sch)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	c.ID = "sch-" + strconv.Itoa(s.nextID)
+	s.schedules[c.ID] = c
+	if err := s.saveLocked(); err != nil {
+		delete(s.schedules, c.ID)
+		return Schedule{}, err
+	}
+	return c.Schedule, nil
+}
+
+// Update replaces the schedule with the given ID, keeping its creation
+// time, and its start when a one-off update leaves it out.
+func (s *Store) Update(id string, sch Schedule, now time.Time) (Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, ErrNotFound
+	}
+	sch.ID = id
+	sch.CreatedAt = prev.CreatedAt
+	if sch.Cron == "" && sch.Start == nil {
+		sch.Start = prev.Start
+		if sch.Start == nil || prev.Cron != "" {
+			sch.Start = &now // was recurring
+		}
+	}
+	c, err := compile(sch)
+	if err != nil {
+		return Schedule{}, err
+	}
+	s.schedules[id] = c
+	if err := s.saveLocked(); err != nil {
+		s.schedules[id] = prev
+		return Schedule{}, err
+	}
+	return c.Schedule, nil
+}
+
+// Remove deletes a schedule.
+func (s *Store) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.schedules[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.schedules, id)
+	if err := s.saveLocked(); err != nil {
+		s.schedules[id] = prev
+		return err
+	}
+	return nil
+}
+
+// Due returns the schedules with a window open at now, and removes one-off
+// schedules whose window has closed, returning those as finished.
+func (s *Store) Due(now time.Time) (due []Due, finished []Schedule, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, c := range s.schedules {
+		if _, _, ok := c.window(now); ok {
+			due = append(due, Due{Schedule: c.Schedule, CaptureMode: c.mode})
+		} else if c.finished(now) {
+			finished = append(finished, c.Schedule)
+			delete(s.schedules, id)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	if len(finished) > 0 {
+		err = s.saveLocked()
+	}
+	return due, finished, err
+}
+
+// saveLocked writes the schedules to path, replacing the old file in one
+// step.
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	list := make([]Schedule, 0, len(s.schedules))
+	for _, c := range s.schedules {
+		list = append(list, c.Schedule)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := atomicfile.WriteFile(s.path, append(data, '\n')); err != nil {
+		return fmt.Errorf("save schedules: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package schedule
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "x * * * *"} {
+		if _, err := parseCron(bad); err == nil {
+			t.Errorf("parseCron(%q): expected error", bad)
+		}
+	}
+
+	c, err := parseCron("*/15 9-17 * * 1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fri := time.Date(2024, 5, 3, 17, 50, 0, 0, time.UTC) // a Friday
+	if got, want := c.next(fri), time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("next after Fri 17:50 = %v, want %v", got, want)
+	}
+	if got, ok := c.prev(fri, time.Hour); !ok || got.Minute() != 45 {
+		t.Errorf("prev = %v, %v", got, ok)
+	}
+
+	// Both day fields restricted: either matches. 7 is Sunday.
+	c, _ = parseCron("0 0 13 * 7")
+	if got := c.next(time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)); got.Day() != 8 {
+		t.Errorf("next Sunday-or-13th = %v", got)
+	}
+	if got := c.next(time.Date(2024, 9, 9, 0, 0, 0, 0, time.UTC)); got.Day() != 13 {
+		t.Errorf("next Sunday-or-13th = %v", got)
+	}
+
+	c, _ = parseCron("0 0 30 2 *")
+	if got := c.next(time.Now()); !got.IsZero() {
+		t.Errorf("February 30th matched at %v", got)
+	}
+}
+
+func TestCompiled_Window(t *testing.T) {
+	c, err := compile(Schedule{Cron: "0 9 * * 1-5", Duration: "8h", Timezone: "Europe/Istanbul"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ist, _ := time.LoadLocation("Europe/Istanbul")
+	at := func(day, hour, min int) time.Time { return time.Date(2024, 5, day, hour, min, 0, 0, ist) }
+
+	for _, tt := range []struct {
+		t      time.Time
+		active bool
+	}{
+		{at(6, 8, 59), false}, // Monday, before 09:00
+		{at(6, 9, 0), true},
+		{at(6, 16, 59), true},
+		{at(6, 17, 0), false},
+		{at(4, 12, 0), false}, // Saturday
+		{at(6, 12, 0).UTC(), true},
+	} {
+		start, end, ok := c.window(tt.t)
+		if ok != tt.active {
+			t.Errorf("window(%v) active = %v, want %v", tt.t, ok, tt.active)
+		}
+		if ok && (!start.Equal(at(6, 9, 0)) || !end.Equal(at(6, 17, 0))) {
+			t.Errorf("window(%v) = %v-%v", tt.t, start, end)
+		}
+	}
+
+	if _, err := compile(Schedule{Cron: "0 9 * * *", Duration: "30s"}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("short duration: err = %v", err)
+	}
+	start := time.Now()
+	if _, err := compile(Schedule{Start: &start, Duration: "1m", Mode: "bogus"}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("bad mode: err = %v", err)
+	}
+}
+
+func TestStore_OneOffAndPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC)
+
+	once, err := s.Add(Schedule{Serials: []string{"X"}, Duration: "10m", Mode: "procnet"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if once.ID != "sch-1" || once.Start == nil || !once.Start.Equal(now) {
+		t.Errorf("added %+v", once)
+	}
+	daily, err := s.Add(Schedule{Cron: "0 9 * * *", Duration: "8h"}, now.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due, finished, err := s.Due(now.Add(5 * time.Minute))
+	if err != nil || len(finished) != 0 || len(due) != 2 || due[0].CaptureMode != capture.ModeProcNet {
+		t.Fatalf("Due = %+v, %+v, %v", due, finished, err)
+	}
+
+	// Schedules survive a restart; the one-off is removed once it is over.
+	s2, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := s2.List(now); len(list) != 2 || !list[0].Active || list[1].NextStart == nil {
+		t.Fatalf("reloaded = %+v", list)
+	}
+	due, finished, _ = s2.Due(now.Add(10 * time.Minute))
+	if len(due) != 1 || due[0].ID != daily.ID || len(finished) != 1 || finished[0].ID != once.ID {
+		t.Errorf("after one-off: due %+v, finished %+v", due, finished)
+	}
+	if _, err := s2.Get(once.ID, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("finished one-off still listed: %v", err)
+	}
+
+	s3, _ := Open(path)
+	if _, err := s3.Update(daily.ID, Schedule{Cron: "0 9 * * 1-5", Duration: "8h", Disabled: true}, now); err != nil {
+		t.Fatal(err)
+	}
+	if next, _ := s3.Add(Schedule{Cron: "0 9 * * *", Duration: "1h"}, now); next.ID != "sch-3" {
+		t.Errorf("IDs restart at %s after reload", next.ID)
+	}
+	if due, _, _ := s3.Due(now); len(due) != 0 {
+		t.Errorf("disabled schedule due: %+v", due)
+	}
+	if err := s3.Remove("sch-99"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Remove unknown: %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package service
+
+// scmState is a Windows service state; there are none here.
+type scmState int
+
+const (
+	scmRunning scmState = iota
+	scmStopPending
+)
+
+// scmService is never created outside Windows.
+type scmService struct{}
+
+func startSCM(string, func()) *scmService { return nil }
+
+func (*scmService) setState(scmState) {}
+func (*scmService) stop()             {}
@@ -0,0 +1,173 @@
+//go:build windows
+
+package service
+
+import (
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32                          = syscall.NewLazyDLL("advapi32.dll")
+	procStartServiceCtrlDispatcherW   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerExW = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus              = advapi32.NewProc("SetServiceStatus")
+)
+
+// scmState is a SERVICE_STATUS.dwCurrentState value.
+type scmState uint32
+
+const (
+	scmStopped      scmState = 1
+	scmStartPending scmState = 2
+	scmStopPending  scmState = 3
+	scmRunning      scmState = 4
+)
+
+const (
+	serviceWin32OwnProcess = 0x10
+
+	controlStop        = 1
+	controlInterrogate = 4
+	controlShutdown    = 5
+
+	acceptStop     = 0x1
+	acceptShutdown = 0x4
+
+	errorCallNotImplemented = 120
+
+	// pendingWaitHint is how long, in milliseconds, the SCM waits for the
+	// next report while starting or stopping.
+	pendingWaitHint = 30000
+)
+
+// serviceStatus is SERVICE_STATUS.
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// serviceTableEntry is SERVICE_TABLE_ENTRYW.
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+// scmService is the service this process runs as.
+type scmService struct {
+	name    *uint16
+	cancel  func()
+	started chan bool
+	done    chan struct{} // closed to let ServiceMain return
+	once    sync.Once
+
+	mu     sync.Mutex
+	handle uintptr
+	status serviceStatus
+}
+
+// current is the service the SCM callbacks act on; a process runs one.
+var current *scmService
+
+// startSCM hands a thread to the service control manager. Outside the SCM
+// StartServiceCtrlDispatcher fails at once and nil is returned; under it,
+// ServiceMain registers the control handler, which calls cancel when the
+// service is asked to stop.
+func startSCM(name string, cancel func()) *scmService {
+	n, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil
+	}
+	s := &scmService{name: n, cancel: cancel, started: make(chan bool, 2), done: make(chan struct{})}
+	current = s
+	go func() {
+		// The dispatcher thread runs ServiceMain and the control handler
+		// until the service stops.
+		runtime.LockOSThread()
+		table := []serviceTableEntry{{name: n, proc: syscall.NewCallback(serviceMain)}, {}}
+		if r, _, _ := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0]))); r == 0 {
+			s.started <- false
+		}
+	}()
+	if !<-s.started {
+		current = nil
+		return nil
+	}
+	return s
+}
+
+// serviceMain is the ServiceMain of the service.
+func serviceMain(argc uint32, argv **uint16) uintptr {
+	s := current
+	h, _, _ := procRegisterServiceCtrlHandlerExW.Call(uintptr(unsafe.Pointer(s.name)), syscall.NewCallback(controlHandler), 0)
+	if h == 0 {
+		s.started <- false
+		return 0
+	}
+	s.mu.Lock()
+	s.handle = h
+	s.mu.Unlock()
+	s.setState(scmStartPending)
+	s.started <- true
+	<-s.done
+	return 0
+}
+
+// controlHandler is the HandlerEx of the service.
+func controlHandler(control, eventType uint32, eventData, context uintptr) uintptr {
+	s := current
+	switch control {
+	case controlStop, controlShutdown:
+		s.setState(scmStopPending)
+		s.cancel()
+	case controlInterrogate:
+		s.mu.Lock()
+		s.reportLocked()
+		s.mu.Unlock()
+	default:
+		return errorCallNotImplemented
+	}
+	return 0
+}
+
+func (s *scmService) setState(state scmState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.status
+	if prev.CurrentState == uint32(scmStopped) {
+		return
+	}
+	s.status = serviceStatus{ServiceType: serviceWin32OwnProcess, CurrentState: uint32(state)}
+	switch state {
+	case scmStartPending, scmStopPending:
+		// Repeated reports of one pending state show progress.
+		if prev.CurrentState == uint32(state) {
+			s.status.CheckPoint = prev.CheckPoint + 1
+		}
+		s.status.WaitHint = pendingWaitHint
+	case scmRunning:
+		s.status.ControlsAccepted = acceptStop | acceptShutdown
+	}
+	s.reportLocked()
+}
+
+func (s *scmService) reportLocked() {
+	if s.handle != 0 {
+		procSetServiceStatus.Call(s.handle, uintptr(unsafe.Pointer(&s.status)))
+	}
+}
+
+// stop reports the service stopped and lets ServiceMain return.
+func (s *scmService) stop() {
+	s.once.Do(func() {
+		s.setState(scmStopped)
+		close(s.done)
+	})
+}
@@ -0,0 +1,144 @@
+// Package service runs the monitor unattended under a service manager:
+// systemd through the sd_notify protocol (readiness, status, watchdog
+// pings), or the Windows service control manager. Outside a service
+// manager every call is a no-op.
+package service
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Service is the process's link to its service manager.
+type Service struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	socket string // NOTIFY_SOCKET, empty when not under systemd
+	mu     sync.Mutex
+	scm    *scmService // nil when not run by the Windows SCM
+}
+
+// Start connects to the service manager, if any. The returned context is
+// done when parent is, or when the service manager asks the service to
+// stop. name is the Windows service name; systemd needs none.
+func Start(parent context.Context, name string) (*Service, context.Context) {
+	ctx, cancel := context.WithCancel(parent)
+	s := &Service{ctx: ctx, cancel: cancel, socket: os.Getenv("NOTIFY_SOCKET")}
+	s.scm = startSCM(name, cancel)
+	return s, ctx
+}
+
+// Managed reports whether a service manager runs the process.
+func (s *Service) Managed() bool {
+	return s.socket != "" || s.scm != nil
+}
+
+// Ready tells the service manager that startup has finished.
+func (s *Service) Ready() error {
+	if s.scm != nil {
+		s.scm.setState(scmRunning)
+	}
+	return s.notify("READY=1")
+}
+
+// Status reports a one-line status, shown by systemctl status.
+func (s *Service) Status(msg string) error {
+	return s.notify("STATUS=" + strings.ReplaceAll(msg, "\n", " "))
+}
+
+// Stopping tells the service manager that shutdown has begun.
+func (s *Service) Stopping() error {
+	if s.scm != nil {
+		s.scm.setState(scmStopPending)
+	}
+	return s.notify("STOPPING=1")
+}
+
+// Stopped tells the Windows SCM that the service has stopped; the process
+// should exit right after.
+func (s *Service) Stopped() {
+	s.cancel()
+	if s.scm != nil {
+		s.scm.stop()
+	}
+}
+
+// WatchdogInterval returns how often systemd expects watchdog pings
+// (WatchdogSec=), or 0 if it does not.
+func (s *Service) WatchdogInterval() time.Duration {
+	if s.socket == "" {
+		return 0
+	}
+	return watchdogInterval(os.Getenv("WATCHDOG_USEC"), os.Getenv("WATCHDOG_PID"), os.Getpid())
+}
+
+// Watchdog pings the systemd watchdog at half its interval for as long as
+// alive returns nil and ctx is not done. A failing check skips the ping, so
+// a hung process is restarted by systemd once the interval runs out.
+func (s *Service) Watchdog(ctx context.Context, alive func(context.Context) error, onFail func(error)) {
+	interval := s.WatchdogInterval()
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, interval/2)
+		err := alive(checkCtx)
+		cancel()
+		if err == nil {
+			s.notify("WATCHDOG=1")
+		} else if onFail != nil {
+			onFail(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// notify sends state to systemd's notification socket.
+func (s *Service) notify(state string) error {
+	if s.socket == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sdNotify(s.socket, state)
+}
+
+// sdNotify sends one datagram to the sd_notify socket at path; a leading @
+// names an abstract socket.
+func sdNotify(path, state string) error {
+	if strings.HasPrefix(path, "@") {
+		path = "\x00" + path[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval parses WATCHDOG_USEC, which applies to this process
+// unless WATCHDOG_PID names another.
+func watchdogInterval(usec, pid string, self int) time.Duration {
+	if pid != "" && pid != strconv.Itoa(self) {
+		return 0
+	}
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Microsecond
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		usec, pid string
+		want      time.Duration
+	}{
+		{"20000000", "", 20 * time.Second},
+		{"20000000", "42", 20 * time.Second},
+		{"20000000", "43", 0}, // meant for another process
+		{"", "", 0},
+		{"abc", "", 0},
+	}
+	for _, tt := range tests {
+		if got := watchdogInterval(tt.usec, tt.pid, 42); got != tt.want {
+			t.Errorf("watchdogInterval(%q, %q) = %v, want %v", tt.usec, tt.pid, got, tt.want)
+		}
+	}
+}
+
+// listen opens a notification socket like systemd's and points the
+// environment at it.
+func listen(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip("unixgram sockets unavailable:", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func read(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestService_Notify(t *testing.T) {
+	conn := listen(t)
+	s, _ := Start(context.Background(), "adb-monitor")
+	if !s.Managed() {
+		t.Fatal("not managed with NOTIFY_SOCKET set")
+	}
+
+	s.Ready()
+	if got := read(t, conn); got != "READY=1" {
+		t.Errorf("got %q", got)
+	}
+	s.Status("2 devices\nonline")
+	if got := read(t, conn); got != "STATUS=2 devices online" {
+		t.Errorf("got %q", got)
+	}
+	s.Stopping()
+	if got := read(t, conn); got != "STOPPING=1" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestService_Watchdog(t *testing.T) {
+	conn := listen(t)
+	t.Setenv("WATCHDOG_USEC", "100000")
+	t.Setenv("WATCHDOG_PID", "")
+	s, ctx := Start(context.Background(), "adb-monitor")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	healthy := make(chan bool, 1)
+	healthy <- false
+	failures := make(chan error, 10)
+	go s.Watchdog(ctx, func(context.Context) error {
+		select {
+		case ok := <-healthy:
+			if !ok {
+				return errors.New("stuck")
+			}
+		default:
+		}
+		return nil
+	}, func(err error) { failures <- err })
+
+	// The first check fails and skips its ping; the next ones ping.
+	if got := read(t, conn); got != "WATCHDOG=1" {
+		t.Errorf("got %q", got)
+	}
+	select {
+	case err := <-failures:
+		if err.Error() != "stuck" {
+			t.Errorf("failure = %v", err)
+		}
+	default:
+		t.Error("failed check not reported")
+	}
+}
+
+func TestService_Unmanaged(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	s, ctx := Start(context.Background(), "adb-monitor")
+	if s.Managed() || s.WatchdogInterval() != 0 {
+		t.Error("managed without a service manager")
+	}
+	if err := s.Ready(); err != nil {
+		t.Error(err)
+	}
+	s.Stopped()
+	if ctx.Err() == nil {
+		t.Error("Stopped did not cancel the context")
+	}
+}
@@ -0,0 +1,273 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// mqttKeepAlive is the keep-alive announced to the broker unless the
+	// URL sets one; a PINGREQ goes out every half of it.
+	mqttKeepAlive = 60 * time.Second
+	// mqttMaxRemaining is the largest remaining length MQTT can encode.
+	mqttMaxRemaining = 268435455
+)
+
+// MQTT 3.1.1 control packet types, shifted into the fixed header.
+const (
+	mqttConnect    = 0x10
+	mqttConnack    = 0x20
+	mqttPublish    = 0x30 // QoS 0, not retained
+	mqttPingreq    = 0xc0
+	mqttDisconnect = 0xe0
+)
+
+// mqttConnackErrors are the CONNACK return codes refusing a connection.
+var mqttConnackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// mqttPublisher speaks MQTT 3.1.1 over plain TCP and publishes at QoS 0:
+// the broker does not acknowledge messages, as NATS does not.
+type mqttPublisher struct {
+	addr      string
+	connect   []byte // CONNECT packet
+	keepAlive time.Duration
+
+	mu      sync.Mutex
+	conn    net.Conn
+	w       *bufio.Writer
+	done    chan struct{} // closed when conn is
+	backoff backoff
+}
+
+func newMQTT(u *url.URL) (*mqttPublisher, error) {
+	q := u.Query()
+	keepAlive := mqttKeepAlive
+	if s := q.Get("keepalive"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < time.Second || d > 18*time.Hour {
+			return nil, fmt.Errorf("sink url: keepalive %q: want a duration between 1s and 18h", s)
+		}
+		keepAlive = d
+	}
+	clientID := q.Get("client_id")
+	if clientID == "" {
+		b := make([]byte, 4)
+		rand.Read(b)
+		clientID = "go-adb-monitor-" + hex.EncodeToString(b)
+	}
+
+	flags := byte(0x02) // clean session
+	payload := mqttString(nil, clientID)
+	if u.User != nil {
+		flags |= 0x80
+		payload = mqttString(payload, u.User.Username())
+		if pass, ok := u.User.Password(); ok {
+			flags |= 0x40
+			payload = mqttString(payload, pass)
+		}
+	}
+	secs := int(keepAlive / time.Second)
+	body := append([]byte{0, 4, 'M', 'Q', 'T', 'T', 4, flags, byte(secs >> 8), byte(secs)}, payload...)
+	return &mqttPublisher{
+		addr:      portOr(u, 1883),
+		connect:   mqttPacket(mqttConnect, body),
+		keepAlive: keepAlive,
+	}, nil
+}
+
+func (p *mqttPublisher) publish(ctx context.Context, topic string, payload []byte) error {
+	body := mqttString(nil, topic)
+	if len(body)+len(payload) > mqttMaxRemaining {
+		return fmt.Errorf("%w: %d bytes", errTooLarge, len(payload))
+	}
+	pkt := mqttPacket(mqttPublish, append(body, payload...))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		if p.conn == nil {
+			if err := p.dialLocked(ctx); err != nil {
+				return err
+			}
+		}
+		p.conn.SetWriteDeadline(time.Now().Add(ioTimeout))
+		p.w.Write(pkt)
+		err := p.w.Flush()
+		if err == nil {
+			return nil
+		}
+		p.closeLocked()
+		// A connection the broker dropped while idle fails on the first
+		// write; try a fresh one once.
+		if attempt > 0 {
+			return fmt.Errorf("mqtt publish: %w", err)
+		}
+	}
+}
+
+// dialLocked connects and waits for the broker's CONNACK.
+func (p *mqttPublisher) dialLocked(ctx context.Context) error {
+	if err := p.backoff.wait(); err != nil {
+		return err
+	}
+	d := net.Dialer{Timeout: dialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		p.backoff.failed()
+		return fmt.Errorf("mqtt connect: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(ioTimeout))
+	r := bufio.NewReader(conn)
+	if err := mqttHandshake(conn, r, p.connect); err != nil {
+		conn.Close()
+		p.backoff.failed()
+		return fmt.Errorf("mqtt connect: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+	p.backoff.reset()
+	p.conn, p.w, p.done = conn, bufio.NewWriter(conn), make(chan struct{})
+	go p.readLoop(conn, r)
+	go p.pingLoop(conn, p.done)
+	return nil
+}
+
+func mqttHandshake(conn net.Conn, r *bufio.Reader, connect []byte) error {
+	if _, err := conn.Write(connect); err != nil {
+		return err
+	}
+	typ, body, err := readMQTTPacket(r)
+	if err != nil {
+		return err
+	}
+	if typ&0xf0 != mqttConnack || len(body) != 2 {
+		return fmt.Errorf("unexpected reply to CONNECT (packet type %#x)", typ)
+	}
+	if body[1] != 0 {
+		if msg, ok := mqttConnackErrors[body[1]]; ok {
+			return fmt.Errorf("broker refused: %s", msg)
+		}
+		return fmt.Errorf("broker refused: return code %d", body[1])
+	}
+	return nil
+}
+
+// readLoop discards what the broker sends (PINGRESPs) until conn fails.
+func (p *mqttPublisher) readLoop(conn net.Conn, r *bufio.Reader) {
+	for {
+		if _, _, err := readMQTTPacket(r); err != nil {
+			break
+		}
+	}
+	p.mu.Lock()
+	if p.conn == conn {
+		p.closeLocked()
+	}
+	p.mu.Unlock()
+}
+
+// pingLoop keeps an idle connection alive.
+func (p *mqttPublisher) pingLoop(conn net.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(p.keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		if p.conn == conn {
+			conn.SetWriteDeadline(time.Now().Add(ioTimeout))
+			p.w.Write([]byte{mqttPingreq, 0})
+			if p.w.Flush() != nil {
+				p.closeLocked()
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *mqttPublisher) closeLocked() {
+	if p.conn != nil {
+		p.conn.Close()
+		close(p.done)
+		p.conn, p.w, p.done = nil, nil, nil
+	}
+}
+
+func (p *mqttPublisher) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	p.conn.SetWriteDeadline(time.Now().Add(ioTimeout))
+	p.w.Write([]byte{mqttDisconnect, 0})
+	err := p.w.Flush()
+	p.closeLocked()
+	return err
+}
+
+// mqttPacket frames body as a control packet of the given first byte.
+func mqttPacket(first byte, body []byte) []byte {
+	pkt := []byte{first}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		pkt = append(pkt, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(pkt, body...)
+}
+
+// mqttString appends s as a length-prefixed UTF-8 string.
+func mqttString(b []byte, s string) []byte {
+	return append(append(b, byte(len(s)>>8), byte(len(s))), s...)
+}
+
+// readMQTTPacket reads one control packet.
+func readMQTTPacket(r *bufio.Reader) (first byte, body []byte, err error) {
+	if first, err = r.ReadByte(); err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+	}
+	body = make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return first, body, nil
+}
@@ -0,0 +1,218 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsPublisher speaks the NATS client protocol: INFO, CONNECT, PUB and
+// PING/PONG, over plain TCP.
+type natsPublisher struct {
+	addr    string
+	connect []byte // CONNECT line
+
+	mu         sync.Mutex
+	conn       net.Conn
+	w          *bufio.Writer
+	maxPayload int
+	backoff    backoff
+	// serverErr is the last -ERR the server sent without closing the
+	// connection, such as a permissions violation; the next publish
+	// reports it.
+	serverErr error
+}
+
+func newNATS(u *url.URL) (*natsPublisher, error) {
+	opts := map[string]any{
+		"verbose":  false,
+		"pedantic": false,
+		"lang":     "go",
+		"name":     "go-adb-monitor",
+		"protocol": 0,
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			opts["user"], opts["pass"] = u.User.Username(), pass
+		} else {
+			opts["auth_token"] = u.User.Username()
+		}
+	}
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &natsPublisher{addr: portOr(u, 4222), connect: []byte("CONNECT " + string(data) + "\r\n")}, nil
+}
+
+func (p *natsPublisher) publish(ctx context.Context, topic string, payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.serverErr; err != nil {
+		p.serverErr = nil
+		return fmt.Errorf("nats: %w", err)
+	}
+	for attempt := 0; ; attempt++ {
+		if p.conn == nil {
+			if err := p.dialLocked(ctx); err != nil {
+				return err
+			}
+		}
+		if p.maxPayload > 0 && len(payload) > p.maxPayload {
+			return fmt.Errorf("%w: %d bytes over %d", errTooLarge, len(payload), p.maxPayload)
+		}
+		p.conn.SetWriteDeadline(time.Now().Add(ioTimeout))
+		fmt.Fprintf(p.w, "PUB %s %d\r\n", topic, len(payload))
+		p.w.Write(payload)
+		p.w.WriteString("\r\n")
+		err := p.w.Flush()
+		if err == nil {
+			return nil
+		}
+		p.closeLocked()
+		// A connection the server dropped while idle fails on the first
+		// write; try a fresh one once.
+		if attempt > 0 {
+			return fmt.Errorf("nats publish: %w", err)
+		}
+	}
+}
+
+// dialLocked connects and completes the handshake: the server's INFO, our
+// CONNECT, and a PING answered by PONG (or -ERR when refused).
+func (p *natsPublisher) dialLocked(ctx context.Context) error {
+	if err := p.backoff.wait(); err != nil {
+		return err
+	}
+	d := net.Dialer{Timeout: dialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		p.backoff.failed()
+		return fmt.Errorf("nats connect: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(ioTimeout))
+	r := bufio.NewReader(conn)
+	maxPayload, err := natsHandshake(conn, r, p.connect)
+	if err != nil {
+		conn.Close()
+		p.backoff.failed()
+		return fmt.Errorf("nats connect: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+	p.backoff.reset()
+	p.conn, p.w, p.maxPayload = conn, bufio.NewWriter(conn), maxPayload
+	go p.readLoop(conn, r)
+	return nil
+}
+
+func natsHandshake(conn net.Conn, r *bufio.Reader, connect []byte) (maxPayload int, err error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	info, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		return 0, fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+	var si struct {
+		MaxPayload  int  `json:"max_payload"`
+		TLSRequired bool `json:"tls_required"`
+	}
+	if err := json.Unmarshal([]byte(info), &si); err != nil {
+		return 0, fmt.Errorf("server info: %w", err)
+	}
+	if si.TLSRequired {
+		return 0, errors.New("server requires TLS, which is not supported")
+	}
+	if _, err := conn.Write(slices.Concat(connect, []byte("PING\r\n"))); err != nil {
+		return 0, err
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return si.MaxPayload, nil
+		case strings.HasPrefix(line, "-ERR"):
+			return 0, fmt.Errorf("server refused: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK and INFO updates may come first.
+	}
+}
+
+// readLoop answers the server's PINGs, which it sends to find dead
+// clients, until conn fails.
+func (p *natsPublisher) readLoop(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PING":
+			p.mu.Lock()
+			if p.conn == conn {
+				conn.SetWriteDeadline(time.Now().Add(ioTimeout))
+				p.w.WriteString("PONG\r\n")
+				err = p.w.Flush()
+			}
+			p.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			// The server closes the connection itself after fatal ones.
+			p.mu.Lock()
+			if p.conn == conn {
+				p.serverErr = errors.New(strings.Trim(strings.TrimSpace(line[len("-ERR"):]), "'"))
+			}
+			p.mu.Unlock()
+		case strings.HasPrefix(line, "INFO "):
+			var si struct {
+				MaxPayload int `json:"max_payload"`
+			}
+			if json.Unmarshal([]byte(line[len("INFO "):]), &si) == nil && si.MaxPayload > 0 {
+				p.mu.Lock()
+				if p.conn == conn {
+					p.maxPayload = si.MaxPayload
+				}
+				p.mu.Unlock()
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	p.mu.Lock()
+	if p.conn == conn {
+		p.closeLocked()
+	}
+	p.mu.Unlock()
+}
+
+func (p *natsPublisher) closeLocked() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn, p.w = nil, nil
+	}
+}
+
+func (p *natsPublisher) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	p.conn.SetWriteDeadline(time.Now().Add(ioTimeout))
+	err := p.w.Flush()
+	p.closeLocked()
+	return err
+}
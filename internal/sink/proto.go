@@ -0,0 +1,185 @@
+package sink
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// encodeBatch encodes records as an adbmonitor.v1.Batch (adbmonitor.proto).
+func encodeBatch(records []Record) []byte {
+	var b []byte
+	for i := range records {
+		b = pbMessage(b, 1, encodeRecord(&records[i]))
+	}
+	return b
+}
+
+func encodeRecord(r *Record) []byte {
+	var b []byte
+	b = pbString(b, 1, r.Kind)
+	b = pbString(b, 2, r.Serial)
+	b = pbTime(b, 3, r.Timestamp)
+	switch {
+	case r.Packet != nil:
+		b = pbMessage(b, 4, encodePacket(r.Packet))
+	case r.Connection != nil:
+		b = pbMessage(b, 5, encodeConnection(r.Connection))
+	case r.Event != nil:
+		b = pbMessage(b, 6, encodeEvent(r.Event))
+	}
+	return b
+}
+
+func encodePacket(p *capture.NetworkPacket) []byte {
+	var b []byte
+	b = pbString(b, 1, p.ID)
+	b = pbString(b, 2, string(p.Protocol))
+	b = pbString(b, 3, p.SrcIP)
+	b = pbUint(b, 4, uint64(p.SrcPort))
+	b = pbString(b, 5, p.DstIP)
+	b = pbUint(b, 6, uint64(p.DstPort))
+	b = pbInt(b, 7, int64(p.Length))
+	b = pbString(b, 8, p.Flags)
+	b = pbString(b, 9, p.HTTPMethod)
+	b = pbString(b, 10, p.HTTPPath)
+	b = pbString(b, 11, p.HTTPHost)
+	b = pbInt(b, 12, int64(p.HTTPStatus))
+	b = pbString(b, 13, p.ProtocolHint)
+	for _, f := range p.H2Frames {
+		b = pbMessage(b, 14, []byte(f))
+	}
+	b = pbBool(b, 15, p.Malicious)
+	b = pbString(b, 16, p.Threat)
+	return b
+}
+
+func encodeConnection(c *capture.Connection) []byte {
+	var b []byte
+	b = pbString(b, 1, c.ID)
+	b = pbString(b, 2, string(c.Protocol))
+	b = pbString(b, 3, c.LocalIP)
+	b = pbUint(b, 4, uint64(c.LocalPort))
+	b = pbString(b, 5, c.RemoteIP)
+	b = pbUint(b, 6, uint64(c.RemotePort))
+	b = pbString(b, 7, string(c.State))
+	b = pbInt(b, 8, int64(c.UID))
+	b = pbTime(b, 9, c.FirstSeen)
+	b = pbTime(b, 10, c.LastSeen)
+	b = pbString(b, 11, c.Hostname)
+	b = pbString(b, 12, c.AppName)
+	b = pbUint(b, 13, c.BytesSent)
+	b = pbUint(b, 14, c.BytesReceived)
+	b = pbDouble(b, 15, c.RTTMs)
+	b = pbInt(b, 16, int64(c.PID))
+	b = pbString(b, 17, c.Process)
+	b = pbBool(b, 18, c.Malicious)
+	b = pbString(b, 19, c.Threat)
+	if c.ClosedAt != nil {
+		b = pbTime(b, 20, *c.ClosedAt)
+	}
+	b = pbDouble(b, 21, c.DurationMs)
+	return b
+}
+
+func encodeEvent(e *event.Event) []byte {
+	var b []byte
+	b = pbString(b, 1, string(e.Type))
+	b = pbString(b, 2, string(e.OldState))
+	b = pbString(b, 3, string(e.NewState))
+	for _, k := range sortedKeys(e.Props) {
+		var entry []byte
+		entry = pbString(entry, 1, k)
+		entry = pbString(entry, 2, e.Props[k])
+		b = pbMessage(b, 4, entry)
+	}
+	for _, k := range sortedKeys(e.Changes) {
+		var change []byte
+		change = pbString(change, 1, e.Changes[k].Old)
+		change = pbString(change, 2, e.Changes[k].New)
+		var entry []byte
+		entry = pbString(entry, 1, k)
+		entry = pbMessage(entry, 2, change)
+		b = pbMessage(b, 5, entry)
+	}
+	if e.Device != nil {
+		b = pbString(b, 6, e.Device.Model)
+	}
+	return b
+}
+
+func pbTag(b []byte, field, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wire))
+}
+
+// pbMessage appends a length-delimited field: a message, string or bytes.
+// Unlike the scalar helpers it writes empty values, as repeated fields
+// need them.
+func pbMessage(b []byte, field int, v []byte) []byte {
+	b = pbTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func pbString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = pbTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func pbUint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.AppendUvarint(pbTag(b, field, wireVarint), v)
+}
+
+// pbInt appends an int32 or int64 field; negative values take ten bytes,
+// as protobuf encodes them.
+func pbInt(b []byte, field int, v int64) []byte {
+	return pbUint(b, field, uint64(v))
+}
+
+func pbBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return pbUint(b, field, 1)
+}
+
+func pbDouble(b []byte, field int, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.LittleEndian.AppendUint64(pbTag(b, field, wireFixed64), math.Float64bits(v))
+}
+
+func pbTime(b []byte, field int, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	return pbInt(b, field, t.UnixNano())
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
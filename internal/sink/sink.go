@@ -0,0 +1,435 @@
+// Package sink publishes captured packets, connections and device events to
+// an external message broker — NATS or MQTT — in batches, serialized as JSON
+// or protobuf, so the monitor can feed a data pipeline.
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+const (
+	// DefaultBatchSize is how many records a message carries at most.
+	DefaultBatchSize = 100
+	// DefaultBatchInterval is how long a record waits for its batch to fill.
+	DefaultBatchInterval = time.Second
+	// DefaultBuffer is how many records are queued for publishing; more
+	// are dropped.
+	DefaultBuffer = 8192
+
+	// flushTimeout bounds the final flush when the sink stops.
+	flushTimeout = 5 * time.Second
+	// dialTimeout and ioTimeout bound broker connects and writes.
+	dialTimeout = 5 * time.Second
+	ioTimeout   = 10 * time.Second
+)
+
+// Record kinds.
+const (
+	KindPacket     = "packet"
+	KindConnection = "connection"
+	KindEvent      = "event"
+)
+
+// Format is how a batch of records is serialized.
+type Format string
+
+const (
+	// FormatJSON sends each batch as a JSON array of records.
+	FormatJSON Format = "json"
+	// FormatProtobuf sends each batch as an adbmonitor.v1.Batch message
+	// (see adbmonitor.proto).
+	FormatProtobuf Format = "protobuf"
+)
+
+// ParseFormat parses "json" or "protobuf".
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatJSON, FormatProtobuf:
+		return f, nil
+	case "proto":
+		return FormatProtobuf, nil
+	}
+	return "", fmt.Errorf("unknown sink format %q (want json or protobuf)", s)
+}
+
+// Topics names the subject (NATS) or topic (MQTT) of each record kind.
+// "{serial}" is replaced by the device serial, with characters brokers
+// treat specially replaced by "_". An empty topic is not published.
+type Topics struct {
+	Packets     string `json:"packets"`
+	Connections string `json:"connections"`
+	Events      string `json:"events"`
+}
+
+// DefaultTopics returns the topics used when none are configured.
+func DefaultTopics() Topics {
+	return Topics{
+		Packets:     "adbmonitor.packets",
+		Connections: "adbmonitor.connections",
+		Events:      "adbmonitor.events",
+	}
+}
+
+// ParseTopics parses "packets=subject,connections=subject,events=subject"
+// over DefaultTopics. A kind given an empty subject is not published.
+func ParseTopics(s string) (Topics, error) {
+	t := DefaultTopics()
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		kind, topic, ok := strings.Cut(part, "=")
+		if !ok {
+			return Topics{}, fmt.Errorf("sink topic %q: want kind=topic", part)
+		}
+		topic = strings.TrimSpace(topic)
+		switch strings.TrimSpace(kind) {
+		case "packets":
+			t.Packets = topic
+		case "connections":
+			t.Connections = topic
+		case "events":
+			t.Events = topic
+		default:
+			return Topics{}, fmt.Errorf("sink topic %q: kind must be packets, connections or events", part)
+		}
+	}
+	if t == (Topics{}) {
+		return Topics{}, errors.New("sink topics: every kind is disabled")
+	}
+	return t, nil
+}
+
+// Record is one published item. Exactly one of Packet, Connection and
+// Event is set, as Kind says.
+type Record struct {
+	Kind       string                 `json:"kind"`
+	Serial     string                 `json:"serial"`
+	Timestamp  time.Time              `json:"timestamp"`
+	Packet     *capture.NetworkPacket `json:"packet,omitempty"`
+	Connection *capture.Connection    `json:"connection,omitempty"`
+	Event      *event.Event           `json:"event,omitempty"`
+}
+
+// Config configures a Sink.
+type Config struct {
+	// URL is the broker: nats://[user:pass@|token@]host[:4222] or
+	// mqtt://[user:pass@]host[:1883]. MQTT takes ?client_id= and
+	// ?keepalive= (a Go duration).
+	URL string
+	// Topics is DefaultTopics if zero.
+	Topics Topics
+	// Format is FormatJSON if empty.
+	Format Format
+	// BatchSize, BatchInterval and Buffer are their defaults if zero.
+	BatchSize     int
+	BatchInterval time.Duration
+	Buffer        int
+}
+
+// Stats counts records by outcome.
+type Stats struct {
+	// Published records reached the broker.
+	Published uint64 `json:"published"`
+	// Dropped records found the queue full.
+	Dropped uint64 `json:"dropped"`
+	// Failed records were in a batch the broker did not take.
+	Failed uint64 `json:"failed"`
+}
+
+// publisher delivers messages to one broker. It is used from one
+// goroutine.
+type publisher interface {
+	publish(ctx context.Context, topic string, payload []byte) error
+	close() error
+}
+
+// errTooLarge is returned by a publisher for a payload over the broker's
+// limit; the batch is split and published again.
+var errTooLarge = errors.New("payload exceeds the broker's limit")
+
+// Sink queues records and publishes them in batches. Packet, Connection
+// and Event never block; Run does the publishing.
+type Sink struct {
+	log    *slog.Logger
+	pub    publisher
+	broker string
+	topics Topics
+	format Format
+	size   int
+	every  time.Duration
+	queue  chan Record
+
+	published, dropped, failed atomic.Uint64
+}
+
+// New returns a sink publishing to cfg.URL. It connects on the first
+// publish, so an unreachable broker is not an error here.
+func New(log *slog.Logger, cfg Config) (*Sink, error) {
+	if cfg.Topics == (Topics{}) {
+		cfg.Topics = DefaultTopics()
+	}
+	if cfg.Format == "" {
+		cfg.Format = FormatJSON
+	}
+	if _, err := ParseFormat(string(cfg.Format)); err != nil {
+		return nil, err
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.BatchInterval <= 0 {
+		cfg.BatchInterval = DefaultBatchInterval
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = DefaultBuffer
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("sink url: %w", err)
+	}
+	var pub publisher
+	switch u.Scheme {
+	case "nats":
+		pub, err = newNATS(u)
+	case "mqtt", "tcp":
+		pub, err = newMQTT(u)
+	default:
+		return nil, fmt.Errorf("sink url %q: scheme must be nats or mqtt", cfg.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, topic := range []string{cfg.Topics.Packets, cfg.Topics.Connections, cfg.Topics.Events} {
+		if err := validTopic(u.Scheme, topic); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Sink{
+		log:    log.With("component", "sink", "broker", u.Scheme+"://"+u.Host),
+		pub:    pub,
+		broker: u.Scheme + "://" + u.Host,
+		topics: cfg.Topics,
+		format: cfg.Format,
+		size:   cfg.BatchSize,
+		every:  cfg.BatchInterval,
+		queue:  make(chan Record, cfg.Buffer),
+	}, nil
+}
+
+// Broker returns the scheme and address of the broker, without
+// credentials.
+func (s *Sink) Broker() string {
+	return s.broker
+}
+
+// Packet queues a packet. Its raw capture line is left out.
+func (s *Sink) Packet(p capture.NetworkPacket) {
+	if s.topics.Packets == "" {
+		return
+	}
+	p.Raw = ""
+	s.enqueue(Record{Kind: KindPacket, Serial: p.Serial, Timestamp: p.Timestamp, Packet: &p})
+}
+
+// Connection queues a connection, new or closed.
+func (s *Sink) Connection(c capture.Connection) {
+	if s.topics.Connections == "" {
+		return
+	}
+	at := c.LastSeen
+	if c.ClosedAt != nil {
+		at = *c.ClosedAt
+	}
+	s.enqueue(Record{Kind: KindConnection, Serial: c.Serial, Timestamp: at, Connection: &c})
+}
+
+// Event queues a device event. It is an event.Handler.
+func (s *Sink) Event(e event.Event) {
+	if s.topics.Events == "" {
+		return
+	}
+	s.enqueue(Record{Kind: KindEvent, Serial: e.Serial, Timestamp: e.Timestamp, Event: &e})
+}
+
+func (s *Sink) enqueue(r Record) {
+	select {
+	case s.queue <- r:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Stats returns the record counters.
+func (s *Sink) Stats() Stats {
+	return Stats{Published: s.published.Load(), Dropped: s.dropped.Load(), Failed: s.failed.Load()}
+}
+
+// Run publishes queued records until ctx is cancelled, then flushes what
+// is queued, for up to five seconds, and disconnects.
+func (s *Sink) Run(ctx context.Context) {
+	batches := make(map[string][]Record) // topic -> records, oldest first
+	ticker := time.NewTicker(s.every)
+	defer ticker.Stop()
+
+	add := func(ctx context.Context, r Record) {
+		topic := s.topicOf(r)
+		batches[topic] = append(batches[topic], r)
+		if len(batches[topic]) >= s.size {
+			s.flush(ctx, topic, batches[topic])
+			delete(batches, topic)
+		}
+	}
+	flushAll := func(ctx context.Context) {
+		for topic, batch := range batches {
+			s.flush(ctx, topic, batch)
+		}
+		clear(batches)
+	}
+
+	for {
+		select {
+		case r := <-s.queue:
+			add(ctx, r)
+		case <-ticker.C:
+			flushAll(ctx)
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.Background(), flushTimeout)
+			for done := false; !done; {
+				select {
+				case r := <-s.queue:
+					add(final, r)
+				default:
+					done = true
+				}
+			}
+			flushAll(final)
+			cancel()
+			if err := s.pub.close(); err != nil {
+				s.log.Debug("closing broker connection", "error", err)
+			}
+			return
+		}
+	}
+}
+
+// flush publishes batch to topic, splitting it when the broker finds it
+// too large.
+func (s *Sink) flush(ctx context.Context, topic string, batch []Record) {
+	payload, err := s.encode(batch)
+	if err == nil {
+		err = s.pub.publish(ctx, topic, payload)
+	}
+	if errors.Is(err, errTooLarge) && len(batch) > 1 {
+		s.flush(ctx, topic, batch[:len(batch)/2])
+		s.flush(ctx, topic, batch[len(batch)/2:])
+		return
+	}
+	if err != nil {
+		s.failed.Add(uint64(len(batch)))
+		level := slog.LevelWarn
+		if errors.Is(err, errBackoff) {
+			// The failed connect was logged already.
+			level = slog.LevelDebug
+		}
+		s.log.Log(ctx, level, "failed to publish records", "topic", topic, "records", len(batch), "error", err)
+		return
+	}
+	s.published.Add(uint64(len(batch)))
+}
+
+func (s *Sink) encode(batch []Record) ([]byte, error) {
+	if s.format == FormatProtobuf {
+		return encodeBatch(batch), nil
+	}
+	return json.Marshal(batch)
+}
+
+// topicOf returns the topic of r, with its serial filled in.
+func (s *Sink) topicOf(r Record) string {
+	var topic string
+	switch r.Kind {
+	case KindPacket:
+		topic = s.topics.Packets
+	case KindConnection:
+		topic = s.topics.Connections
+	default:
+		topic = s.topics.Events
+	}
+	if !strings.Contains(topic, "{serial}") {
+		return topic
+	}
+	serial := r.Serial
+	if serial == "" {
+		serial = "server"
+	}
+	return strings.ReplaceAll(topic, "{serial}", topicSafe.Replace(serial))
+}
+
+// topicSafe replaces what NATS subjects and MQTT topics give a meaning:
+// token separators, wildcards and whitespace.
+var topicSafe = strings.NewReplacer(".", "_", "/", "_", "*", "_", ">", "_", "+", "_", "#", "_", " ", "_", ":", "_")
+
+// validTopic rejects topics the broker would refuse or treat as a
+// wildcard.
+func validTopic(scheme, topic string) error {
+	if topic == "" {
+		return nil
+	}
+	bad := " \t\r\n*>"
+	if scheme != "nats" {
+		bad = "+#\x00"
+	}
+	if strings.ContainsAny(strings.ReplaceAll(topic, "{serial}", ""), bad) {
+		return fmt.Errorf("sink topic %q: must not contain any of %q", topic, bad)
+	}
+	return nil
+}
+
+// backoff spaces out reconnects to a broker that is down: 1s after the
+// first failure, doubling up to 30s.
+type backoff struct {
+	delay time.Duration
+	until time.Time
+}
+
+var errBackoff = errors.New("broker unreachable; waiting before reconnecting")
+
+func (b *backoff) wait() error {
+	if time.Now().Before(b.until) {
+		return errBackoff
+	}
+	return nil
+}
+
+func (b *backoff) failed() {
+	b.delay = min(max(2*b.delay, time.Second), 30*time.Second)
+	b.until = time.Now().Add(b.delay)
+}
+
+func (b *backoff) reset() {
+	*b = backoff{}
+}
+
+// portOr returns u's host with port def when it names none.
+func portOr(u *url.URL, def int) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), strconv.Itoa(def))
+}
@@ -0,0 +1,224 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+type message struct {
+	topic   string
+	payload []byte
+}
+
+// fakeNATS accepts one client and sends what it publishes to msgs.
+func fakeNATS(t *testing.T, maxPayload int) (addr string, msgs <-chan message) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	ch := make(chan message, 64)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"max_payload\":%d}\r\n", maxPayload)
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			switch {
+			case len(fields) == 0:
+			case fields[0] == "PING":
+				io.WriteString(conn, "PONG\r\n")
+			case fields[0] == "PUB" && len(fields) == 3:
+				n, _ := strconv.Atoi(fields[2])
+				payload := make([]byte, n+2)
+				if _, err := io.ReadFull(r, payload); err != nil {
+					return
+				}
+				ch <- message{fields[1], payload[:n]}
+			}
+		}
+	}()
+	return ln.Addr().String(), ch
+}
+
+func receive(t *testing.T, msgs <-chan message) message {
+	t.Helper()
+	select {
+	case m := <-msgs:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message published")
+		return message{}
+	}
+}
+
+func newTestSink(t *testing.T, cfg Config) *Sink {
+	t.Helper()
+	s, err := New(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return s
+}
+
+func TestSink_NATSBatches(t *testing.T) {
+	addr, msgs := fakeNATS(t, 1<<20)
+	topics := DefaultTopics()
+	topics.Packets = "adb.{serial}.packets"
+	s := newTestSink(t, Config{URL: "nats://" + addr, Topics: topics, BatchSize: 2, BatchInterval: time.Hour})
+
+	now := time.Now()
+	s.Packet(capture.NetworkPacket{ID: "p1", Serial: "192.168.1.5:5555", Timestamp: now, Raw: "raw line"})
+	s.Packet(capture.NetworkPacket{ID: "p2", Serial: "192.168.1.5:5555", Timestamp: now})
+
+	m := receive(t, msgs)
+	if m.topic != "adb.192_168_1_5_5555.packets" {
+		t.Errorf("topic %q", m.topic)
+	}
+	var batch []Record
+	if err := json.Unmarshal(m.payload, &batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch) != 2 || batch[0].Kind != KindPacket || batch[0].Packet.ID != "p1" || batch[0].Packet.Raw != "" {
+		t.Errorf("batch %+v", batch)
+	}
+	if st := s.Stats(); st.Published != 2 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestSink_SplitsLargeBatches(t *testing.T) {
+	addr, msgs := fakeNATS(t, 400)
+	s := newTestSink(t, Config{URL: "nats://" + addr, BatchSize: 4, BatchInterval: time.Hour})
+	for i := range 4 {
+		s.Event(event.Event{Type: event.DeviceConnected, Serial: "dev" + strconv.Itoa(i), Timestamp: time.Now()})
+	}
+	got := 0
+	for got < 4 {
+		m := receive(t, msgs)
+		if len(m.payload) > 400 {
+			t.Fatalf("payload of %d bytes over the limit", len(m.payload))
+		}
+		var batch []Record
+		if err := json.Unmarshal(m.payload, &batch); err != nil {
+			t.Fatal(err)
+		}
+		got += len(batch)
+	}
+}
+
+func TestSink_MQTT(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	published := make(chan message, 1)
+	connected := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		_, body, err := readMQTTPacket(r)
+		if err != nil {
+			return
+		}
+		connected <- body
+		conn.Write([]byte{mqttConnack, 2, 0, 0})
+		for {
+			first, body, err := readMQTTPacket(r)
+			if err != nil {
+				return
+			}
+			if first == mqttPublish {
+				n := int(body[0])<<8 | int(body[1])
+				published <- message{string(body[2 : 2+n]), body[2+n:]}
+			}
+		}
+	}()
+
+	s := newTestSink(t, Config{URL: "mqtt://user:secret@" + ln.Addr().String() + "?client_id=lab-1", Format: FormatProtobuf, BatchSize: 1})
+	s.Connection(capture.Connection{ID: "c1", Serial: "dev1", RemoteIP: "1.2.3.4", RemotePort: 443, UID: -1})
+
+	body := <-connected
+	if !strings.Contains(string(body), "lab-1") || !strings.Contains(string(body), "secret") || body[7]&0xc0 != 0xc0 {
+		t.Errorf("CONNECT %q", body)
+	}
+	m := receive(t, published)
+	if m.topic != "adbmonitor.connections" {
+		t.Errorf("topic %q", m.topic)
+	}
+	// Batch.records (1) > Record.connection (5) > Connection.remote_port (6).
+	if m.payload[0] != 1<<3|wireBytes || !strings.Contains(string(m.payload), "1.2.3.4") ||
+		!strings.Contains(string(m.payload), string([]byte{6 << 3, 0xbb, 0x03})) {
+		t.Errorf("payload % x", m.payload)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	for _, url := range []string{"kafka://broker:9092", "nats://[::1"} {
+		if _, err := New(slog.Default(), Config{URL: url}); err == nil {
+			t.Errorf("%s: no error", url)
+		}
+	}
+	if _, err := New(slog.Default(), Config{URL: "mqtt://broker", Topics: Topics{Events: "adb/#"}}); err == nil {
+		t.Error("MQTT wildcard topic accepted")
+	}
+	topics, err := ParseTopics("packets=, events=lab.{serial}.events")
+	if err != nil || topics.Packets != "" || topics.Events != "lab.{serial}.events" || topics.Connections != DefaultTopics().Connections {
+		t.Errorf("ParseTopics: %+v, %v", topics, err)
+	}
+	if _, err := ParseTopics("flows=x"); err == nil {
+		t.Error("unknown kind accepted")
+	}
+	if _, err := ParseTopics("packets=,connections=,events="); err == nil {
+		t.Error("every kind disabled accepted")
+	}
+}
+
+func TestEncodeBatch(t *testing.T) {
+	got := encodeBatch([]Record{{Kind: KindEvent, Event: &event.Event{Type: event.DeviceConnected}}})
+	want := []byte{
+		0x0a, 0x1b, // records, 27 bytes
+		0x0a, 0x05, 'e', 'v', 'e', 'n', 't', // kind
+		0x32, 0x12, // event, 18 bytes
+		0x0a, 0x10, 'd', 'e', 'v', 'i', 'c', 'e', '_', 'c', 'o', 'n', 'n', 'e', 'c', 't', 'e', 'd',
+	}
+	if string(got) != string(want) {
+		t.Errorf("got % x\nwant % x", got, want)
+	}
+}
@@ -0,0 +1,102 @@
+package store
+
+import "time"
+
+// DefaultBatteryHistory is how many battery samples are kept per device:
+// a day at the 30s health probe interval.
+const DefaultBatteryHistory = 2880
+
+// BatterySample is one battery reading of a device.
+type BatterySample struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Level        int       `json:"level"`
+	TemperatureC float64   `json:"temperature_c"`
+	Plugged      bool      `json:"plugged"`
+	Status       string    `json:"status,omitempty"`
+}
+
+// BatteryCycles accumulates charge activity of a device since it was
+// first sampled. It is not limited by the history window.
+type BatteryCycles struct {
+	// ChargeSessions counts unplugged → plugged transitions.
+	ChargeSessions int `json:"charge_sessions"`
+	// ChargedPercent and DischargedPercent sum level increases and drops.
+	ChargedPercent    int `json:"charged_percent"`
+	DischargedPercent int `json:"discharged_percent"`
+	// EquivalentCycles is DischargedPercent / 100, the way battery wear is
+	// usually counted.
+	EquivalentCycles float64 `json:"equivalent_cycles"`
+	// Since is the time of the first sample.
+	Since time.Time `json:"since"`
+}
+
+// BatteryHistory is a device's battery samples and cycle counters.
+type BatteryHistory struct {
+	Serial  string          `json:"serial"`
+	Samples []BatterySample `json:"samples"`
+	Cycles  BatteryCycles   `json:"cycles"`
+}
+
+type batteryLog struct {
+	samples []BatterySample
+	cycles  BatteryCycles
+}
+
+// AddBatterySample records a reading and returns the previous one, if any,
+// so callers can detect threshold crossings and charging flips.
+func (s *Store) AddBatterySample(serial string, b BatterySample) (prev BatterySample, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	log := s.battery[serial]
+	if log == nil {
+		log = &batteryLog{cycles: BatteryCycles{Since: b.Timestamp}}
+		s.battery[serial] = log
+	}
+
+	if n := len(log.samples); n > 0 {
+		prev, ok = log.samples[n-1], true
+		c := &log.cycles
+		if b.Plugged && !prev.Plugged {
+			c.ChargeSessions++
+		}
+		switch d := b.Level - prev.Level; {
+		case d > 0:
+			c.ChargedPercent += d
+		case d < 0:
+			c.DischargedPercent -= d
+			c.EquivalentCycles = float64(c.DischargedPercent) / 100
+		}
+	}
+
+	if len(log.samples) >= s.batteryMaxSize {
+		// Drop the oldest; append reallocates once the slack is used up,
+		// so the backing array does not grow without bound.
+		log.samples = log.samples[1:]
+	}
+	log.samples = append(log.samples, b)
+	return prev, ok
+}
+
+// BatteryHistory returns the device's samples within [from, to] (zero
+// values are unbounded), oldest first, with its cycle counters.
+func (s *Store) BatteryHistory(serial string, from, to time.Time) (BatteryHistory, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	log, ok := s.battery[serial]
+	if !ok {
+		return BatteryHistory{}, false
+	}
+	h := BatteryHistory{Serial: serial, Samples: []BatterySample{}, Cycles: log.cycles}
+	for _, b := range log.samples {
+		if !from.IsZero() && b.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && b.Timestamp.After(to) {
+			break
+		}
+		h.Samples = append(h.Samples, b)
+	}
+	return h, true
+}
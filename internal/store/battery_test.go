@@ -0,0 +1,54 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatteryHistory(t *testing.T) {
+	s := New(Config{MaxBatterySamples: 4})
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	levels := []struct {
+		level   int
+		plugged bool
+	}{{80, false}, {60, false}, {40, true}, {70, true}, {50, false}, {30, false}}
+	for i, l := range levels {
+		prev, ok := s.AddBatterySample("dev1", BatterySample{
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+			Level:     l.level,
+			Plugged:   l.plugged,
+		})
+		if ok != (i > 0) {
+			t.Fatalf("sample %d: prev ok = %v", i, ok)
+		}
+		if i > 0 && prev.Level != levels[i-1].level {
+			t.Errorf("sample %d: prev level %d, want %d", i, prev.Level, levels[i-1].level)
+		}
+	}
+
+	h, ok := s.BatteryHistory("dev1", time.Time{}, time.Time{})
+	if !ok {
+		t.Fatal("no history")
+	}
+	if len(h.Samples) != 4 || h.Samples[0].Level != 40 || h.Samples[3].Level != 30 {
+		t.Errorf("samples: %+v", h.Samples)
+	}
+
+	c := h.Cycles
+	if c.ChargeSessions != 1 || c.ChargedPercent != 30 || c.DischargedPercent != 80 || c.EquivalentCycles != 0.8 {
+		t.Errorf("cycles: %+v", c)
+	}
+	if !c.Since.Equal(base) {
+		t.Errorf("since = %v, want %v", c.Since, base)
+	}
+
+	h, _ = s.BatteryHistory("dev1", base.Add(3*time.Minute), base.Add(4*time.Minute))
+	if len(h.Samples) != 2 || h.Samples[0].Level != 70 {
+		t.Errorf("range: %+v", h.Samples)
+	}
+
+	if _, ok := s.BatteryHistory("dev2", time.Time{}, time.Time{}); ok {
+		t.Error("unexpected history for unknown device")
+	}
+}
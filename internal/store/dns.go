@@ -0,0 +1,39 @@
+package store
+
+import "github.com/imcanugur/go-adb-monitor/internal/capture"
+
+// AddDNSLookup adds a decoded DNS lookup to its ring buffer.
+func (s *Store) AddDNSLookup(l capture.DNSLookup) {
+	s.mu.Lock()
+	s.addDNSLookupLocked(l)
+	cb := s.onChange
+	s.mu.Unlock()
+
+	if cb != nil {
+		cb(Change{Kind: DNSLookupAdded, DNSLookup: &l})
+	}
+}
+
+func (s *Store) addDNSLookupLocked(l capture.DNSLookup) {
+	s.dnsLookups[s.dnsHead%s.dnsMaxSize] = l
+	s.dnsHead++
+	if s.dnsCount < s.dnsMaxSize {
+		s.dnsCount++
+	}
+}
+
+// GetDNSLookupsBySerial returns up to n recent DNS lookups for a device,
+// newest first. An empty serial matches every device.
+func (s *Store) GetDNSLookupsBySerial(serial string, n int) []capture.DNSLookup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []capture.DNSLookup
+	for i := 0; i < s.dnsCount && len(result) < n; i++ {
+		l := &s.dnsLookups[(s.dnsHead-1-i)%s.dnsMaxSize]
+		if serial == "" || l.Serial == serial {
+			result = append(result, *l)
+		}
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"strings"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+// DefaultBackfillDepth is how many of the newest packets and connections a
+// backfill inspects.
+const DefaultBackfillDepth = 5000
+
+// BackfillHostname sets hostname on the newest depth packets and connections
+// of serial that talk to ip and are still unresolved. Packets match on either
+// endpoint since inbound packets carry the remote IP as source. It returns
+// how many entries were patched.
+func (s *Store) BackfillHostname(serial, ip, hostname string, depth int) (packets, conns int) {
+	if ip == "" || hostname == "" {
+		return 0, 0
+	}
+	if depth <= 0 {
+		depth = DefaultBackfillDepth
+	}
+
+	ip = capture.NormalizeIP(ip)
+	hostKey := "host=" + strings.ToLower(hostname)
+
+	s.mu.Lock()
+	for i := 0; i < s.pktCount && i < depth; i++ {
+		pos := s.pktHead - 1 - i
+		p := &s.packets[pos%s.pktMaxSize]
+		if p.Serial != serial || p.HTTPHost != "" {
+			continue
+		}
+		if p.DstIP == ip || p.SrcIP == ip {
+			p.HTTPHost = hostname
+			s.pktIndex.add(hostKey, pos)
+			s.pktWords.addAll(words(hostname), pos)
+			packets++
+		}
+	}
+	for i := 0; i < s.connCount && i < depth; i++ {
+		pos := s.connHead - 1 - i
+		c := &s.connections[pos%s.connMaxSize]
+		if c.Serial == serial && c.Hostname == "" && c.RemoteIP == ip {
+			c.Hostname = hostname
+			s.connIndex.add(hostKey, pos)
+			s.connWords.addAll(words(hostname), pos)
+			conns++
+		}
+	}
+	cb := s.onChange
+	s.mu.Unlock()
+
+	if cb != nil && packets+conns > 0 {
+		cb(Change{Kind: HostnameBackfilled, Backfill: &Backfill{
+			Serial: serial, IP: ip, Hostname: hostname, Packets: packets, Connections: conns,
+		}})
+	}
+	return packets, conns
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"slices"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+const (
+	// DefaultMaxDeviceEvents is how many device events are kept.
+	DefaultMaxDeviceEvents = 20000
+	// DefaultDeviceEventRetention is how long device events are kept.
+	DefaultDeviceEventRetention = 7 * 24 * time.Hour
+)
+
+// DeviceEvent is a device lifecycle or property event kept for audit.
+type DeviceEvent struct {
+	ID uint64 `json:"id"`
+	event.Event
+}
+
+// EventQuery selects device events. Zero fields match everything.
+type EventQuery struct {
+	Serial string
+	// Types keeps only events of these types.
+	Types    []event.Type
+	From, To time.Time
+	// Limit caps the result, newest first.
+	Limit int
+}
+
+func (q EventQuery) match(e *DeviceEvent) bool {
+	return (q.Serial == "" || e.Serial == q.Serial) &&
+		(len(q.Types) == 0 || slices.Contains(q.Types, e.Type)) &&
+		(q.From.IsZero() || !e.Timestamp.Before(q.From)) &&
+		(q.To.IsZero() || !e.Timestamp.After(q.To))
+}
+
+// AddDeviceEvent records e and returns it with its ID. Events older than
+// the retention, counted back from e, and the oldest over the capacity
+// are dropped.
+func (s *Store) AddDeviceEvent(e event.Event) DeviceEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.eventSeq++
+	de := DeviceEvent{ID: s.eventSeq, Event: e}
+	s.events = append(s.events, de)
+
+	drop := 0
+	if over := len(s.events) - s.eventsMaxSize; over > 0 {
+		drop = over
+	}
+	if s.eventsRetention > 0 {
+		cutoff := e.Timestamp.Add(-s.eventsRetention)
+		for drop < len(s.events) && s.events[drop].Timestamp.Before(cutoff) {
+			drop++
+		}
+	}
+	// Append reallocates once the slack is used up, so the backing array
+	// does not grow without bound.
+	s.events = s.events[drop:]
+	return de
+}
+
+// DeviceEvents returns the device events matching q, newest first.
+func (s *Store) DeviceEvents(q EventQuery) []DeviceEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := []DeviceEvent{}
+	for i := len(s.events) - 1; i >= 0; i-- {
+		e := &s.events[i]
+		if !q.match(e) {
+			continue
+		}
+		out = append(out, *e)
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+	}
+	return out
+}
+
+// DeviceEventCount returns the number of device events kept.
+func (s *Store) DeviceEventCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.events)
+}
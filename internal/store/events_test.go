@@ -0,0 +1,60 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+func TestDeviceEvents(t *testing.T) {
+	s := New(Config{MaxDeviceEvents: 4})
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	types := []event.Type{event.DeviceConnected, event.DeviceStateChanged, event.DeviceDisconnected,
+		event.DeviceConnected, event.DeviceDisconnected, event.DeviceConnected}
+	for i, typ := range types {
+		serial := "dev1"
+		if i%2 == 1 {
+			serial = "dev2"
+		}
+		e := s.AddDeviceEvent(event.Event{Type: typ, Serial: serial, Timestamp: base.Add(time.Duration(i) * time.Hour)})
+		if e.ID != uint64(i+1) {
+			t.Errorf("event %d: id %d", i, e.ID)
+		}
+	}
+
+	all := s.DeviceEvents(EventQuery{})
+	if len(all) != 4 || all[0].ID != 6 || all[3].ID != 3 {
+		t.Fatalf("capacity: got %d events, newest %d", len(all), all[0].ID)
+	}
+
+	got := s.DeviceEvents(EventQuery{Serial: "dev1", Types: []event.Type{event.DeviceDisconnected}})
+	if len(got) != 2 || got[0].ID != 5 || got[1].ID != 3 {
+		t.Errorf("serial and type: %+v", got)
+	}
+	got = s.DeviceEvents(EventQuery{From: base.Add(3 * time.Hour), To: base.Add(4 * time.Hour)})
+	if len(got) != 2 || got[0].ID != 5 || got[1].ID != 4 {
+		t.Errorf("time range: %+v", got)
+	}
+	if got = s.DeviceEvents(EventQuery{Limit: 1}); len(got) != 1 || got[0].ID != 6 {
+		t.Errorf("limit: %+v", got)
+	}
+
+	s.Clear()
+	if s.DeviceEventCount() != 4 {
+		t.Errorf("Clear dropped the event history")
+	}
+}
+
+func TestDeviceEvents_Retention(t *testing.T) {
+	s := New(Config{DeviceEventRetention: time.Hour})
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, d := range []time.Duration{0, 30 * time.Minute, 90 * time.Minute} {
+		s.AddDeviceEvent(event.Event{Type: event.DeviceConnected, Serial: "dev1", Timestamp: base.Add(d)})
+	}
+	got := s.DeviceEvents(EventQuery{})
+	if len(got) != 2 || got[1].ID != 2 {
+		t.Errorf("got %+v, want the last two events", got)
+	}
+}
@@ -0,0 +1,358 @@
+package store
+
+import (
+	"hash/fnv"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+const (
+	// flowSlack is how far outside a flow's lifetime a logged URL or a
+	// packet may be and still join it.
+	flowSlack = 30 * time.Second
+	// flowReuse is how long after a captured FIN or RST packets of the
+	// same endpoints start a new flow rather than join the closed one.
+	flowReuse = time.Minute
+)
+
+// FlowQuery selects flows. Zero-valued fields match everything; the
+// Filter time range keeps flows whose records fall in it.
+type FlowQuery struct {
+	Filter
+
+	// Host matches the hostname or the host of a request,
+	// case-insensitively.
+	Host     string
+	App      string
+	Protocol capture.Protocol
+	// Source keeps flows seen by this capture (capture.Flow.Sources).
+	Source    string
+	Malicious bool
+	// Closed keeps only flows that have ended.
+	Closed bool
+	// Limit caps the result, newest first by LastSeen.
+	Limit int
+}
+
+func (q FlowQuery) match(f *capture.Flow) bool {
+	if q.Host != "" && !strings.EqualFold(f.Hostname, q.Host) &&
+		!slices.ContainsFunc(f.Requests, func(r capture.FlowRequest) bool { return strings.EqualFold(r.Host, q.Host) }) {
+		return false
+	}
+	return (q.App == "" || strings.EqualFold(f.AppName, q.App)) &&
+		(q.Protocol == "" || f.Protocol == q.Protocol) &&
+		(q.Source == "" || slices.Contains(f.Sources, q.Source)) &&
+		(!q.Malicious || f.Malicious) &&
+		(!q.Closed || f.ClosedAt != nil)
+}
+
+// Flows merges the stored connections and packets into flows and returns
+// those matching q, newest first. Packets made up from the socket table
+// fold into their connection; logged URLs join the flow to their host
+// that was open at the time, or make a flow of their own.
+func (s *Store) Flows(q FlowQuery) []capture.Flow {
+	b := newFlowBuilder()
+	s.ScanConnections(q.Filter, func(c capture.Connection) error {
+		b.addConnection(c)
+		return nil
+	})
+	s.ScanPackets(q.Filter, func(p capture.NetworkPacket) error {
+		b.addPacket(p)
+		return nil
+	})
+
+	out := []capture.Flow{}
+	for _, f := range b.flows {
+		if f.ClosedAt != nil {
+			f.DurationMs = float64(f.ClosedAt.Sub(f.FirstSeen).Milliseconds())
+		} else {
+			f.DurationMs = float64(f.LastSeen.Sub(f.FirstSeen).Milliseconds())
+		}
+		if q.match(f) {
+			out = append(out, *f)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out
+}
+
+// flowBuilder assembles flows from connections first, then packets, each
+// oldest first.
+type flowBuilder struct {
+	flows []*capture.Flow
+	// byTuple indexes flows by device, protocol and both endpoints, in
+	// either order, oldest first.
+	byTuple map[string][]*capture.Flow
+	// byHost and byIP index flows by device and remote host or address,
+	// for logged URLs.
+	byHost map[string][]*capture.Flow
+	byIP   map[string][]*capture.Flow
+	// logcat holds the flows made of logged URLs only, by device and host.
+	logcat map[string]*capture.Flow
+}
+
+func newFlowBuilder() *flowBuilder {
+	return &flowBuilder{
+		byTuple: make(map[string][]*capture.Flow),
+		byHost:  make(map[string][]*capture.Flow),
+		byIP:    make(map[string][]*capture.Flow),
+		logcat:  make(map[string]*capture.Flow),
+	}
+}
+
+func tupleKey(serial string, proto capture.Protocol, aIP string, aPort uint16, bIP string, bPort uint16) string {
+	return serial + "|" + string(proto) + "|" + aIP + "|" + itoa(int(aPort)) + "|" + bIP + "|" + itoa(int(bPort))
+}
+
+// flowID derives a stable flow ID from what identifies it.
+func flowID(serial string, parts ...string) string {
+	h := fnv.New64a()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return serial + "-flow-" + strconv.FormatUint(h.Sum64(), 36)
+}
+
+func (b *flowBuilder) add(f *capture.Flow) {
+	b.flows = append(b.flows, f)
+	if f.LocalIP != "" || f.LocalPort != 0 {
+		k := tupleKey(f.Serial, f.Protocol, f.LocalIP, f.LocalPort, f.RemoteIP, f.RemotePort)
+		b.byTuple[k] = append(b.byTuple[k], f)
+	}
+	b.indexHost(f)
+	if f.RemoteIP != "" {
+		k := f.Serial + "|" + f.RemoteIP
+		b.byIP[k] = append(b.byIP[k], f)
+	}
+}
+
+func (b *flowBuilder) indexHost(f *capture.Flow) {
+	if f.Hostname != "" {
+		k := f.Serial + "|" + strings.ToLower(f.Hostname)
+		b.byHost[k] = append(b.byHost[k], f)
+	}
+}
+
+func addSource(f *capture.Flow, source string) {
+	if source != "" && !slices.Contains(f.Sources, source) {
+		f.Sources = append(f.Sources, source)
+	}
+}
+
+func addRequest(f *capture.Flow, r capture.FlowRequest) {
+	if len(f.Requests) == capture.MaxFlowRequests {
+		f.Requests = slices.Delete(f.Requests, 0, 1)
+	}
+	f.Requests = append(f.Requests, r)
+}
+
+func (b *flowBuilder) addConnection(c capture.Connection) {
+	f := &capture.Flow{
+		ID:            flowID(c.Serial, "conn", c.ID, c.FirstSeen.String()),
+		Serial:        c.Serial,
+		Protocol:      c.Protocol,
+		LocalIP:       c.LocalIP,
+		LocalPort:     c.LocalPort,
+		RemoteIP:      c.RemoteIP,
+		RemotePort:    c.RemotePort,
+		Sources:       []string{},
+		State:         c.State,
+		FirstSeen:     c.FirstSeen,
+		LastSeen:      c.LastSeen,
+		ClosedAt:      c.ClosedAt,
+		Hostname:      c.Hostname,
+		AppName:       c.AppName,
+		UID:           c.UID,
+		PID:           c.PID,
+		Process:       c.Process,
+		BytesSent:     c.BytesSent,
+		BytesReceived: c.BytesReceived,
+		RTTMs:         c.RTTMs,
+		Malicious:     c.Malicious,
+		Threat:        c.Threat,
+		ConnectionID:  c.ID,
+	}
+	addSource(f, c.Source)
+	b.add(f)
+}
+
+// lookup returns the latest flow of the endpoints, in either direction,
+// that a record at t may join.
+func (b *flowBuilder) lookup(p *capture.NetworkPacket) *capture.Flow {
+	for _, k := range []string{
+		tupleKey(p.Serial, p.Protocol, p.SrcIP, p.SrcPort, p.DstIP, p.DstPort),
+		tupleKey(p.Serial, p.Protocol, p.DstIP, p.DstPort, p.SrcIP, p.SrcPort),
+	} {
+		list := b.byTuple[k]
+		for i := len(list) - 1; i >= 0; i-- {
+			f := list[i]
+			if f.ConnectionID != "" {
+				if within(p.Timestamp, f) {
+					return f
+				}
+				continue
+			}
+			if f.ClosedAt == nil || p.Timestamp.Sub(*f.ClosedAt) < flowReuse {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// within reports whether t falls in f's lifetime, give or take flowSlack.
+func within(t time.Time, f *capture.Flow) bool {
+	end := f.LastSeen
+	if f.ClosedAt != nil {
+		end = *f.ClosedAt
+	}
+	return !t.Before(f.FirstSeen.Add(-flowSlack)) && !t.After(end.Add(flowSlack))
+}
+
+func (b *flowBuilder) addPacket(p capture.NetworkPacket) {
+	switch p.Source {
+	case capture.SourceLogcat:
+		b.addLogged(p)
+		return
+	case capture.ModeProcNet.String(), capture.ModeSS.String():
+		// Made up from a new socket: its connection already has it all,
+		// unless it was evicted.
+		if b.lookup(&p) == nil {
+			b.add(b.newPacketFlow(&p))
+		}
+		return
+	}
+
+	f := b.lookup(&p)
+	if f == nil {
+		f = b.newPacketFlow(&p)
+		b.add(f)
+	}
+	addSource(f, p.Source)
+	f.Packets++
+	f.Bytes += int64(p.Length)
+	if p.Timestamp.Before(f.FirstSeen) {
+		f.FirstSeen = p.Timestamp
+	}
+	if p.Timestamp.After(f.LastSeen) {
+		f.LastSeen = p.Timestamp
+	}
+	if f.ConnectionID == "" && f.ClosedAt == nil && (strings.Contains(p.Flags, "F") || strings.Contains(p.Flags, "R")) {
+		at := p.Timestamp
+		f.ClosedAt = &at
+	}
+	if p.HTTPHost != "" && f.Hostname == "" {
+		f.Hostname = p.HTTPHost
+		b.indexHost(f)
+	}
+	if p.ProtocolHint != "" {
+		f.ProtocolHint = p.ProtocolHint
+	}
+	if p.HTTPMethod != "" || p.HTTPStatus != 0 {
+		addRequest(f, capture.FlowRequest{
+			Timestamp: p.Timestamp,
+			Source:    p.Source,
+			Method:    p.HTTPMethod,
+			Host:      p.HTTPHost,
+			Path:      p.HTTPPath,
+			Status:    p.HTTPStatus,
+		})
+	}
+	if p.Malicious && !f.Malicious {
+		f.Malicious, f.Threat = true, p.Threat
+	}
+}
+
+// newPacketFlow starts a flow at p. The device is taken to be the side
+// without a well-known port, else the sender.
+func (b *flowBuilder) newPacketFlow(p *capture.NetworkPacket) *capture.Flow {
+	localIP, localPort, remoteIP, remotePort := p.SrcIP, p.SrcPort, p.DstIP, p.DstPort
+	if p.SrcPort != 0 && p.SrcPort < 1024 && (p.DstPort == 0 || p.DstPort >= 1024) {
+		localIP, localPort, remoteIP, remotePort = p.DstIP, p.DstPort, p.SrcIP, p.SrcPort
+	}
+	f := &capture.Flow{
+		ID:         flowID(p.Serial, "pkt", string(p.Protocol), localIP, itoa(int(localPort)), remoteIP, itoa(int(remotePort)), p.Timestamp.String()),
+		Serial:     p.Serial,
+		Protocol:   p.Protocol,
+		LocalIP:    localIP,
+		LocalPort:  localPort,
+		RemoteIP:   remoteIP,
+		RemotePort: remotePort,
+		Sources:    []string{},
+		FirstSeen:  p.Timestamp,
+		LastSeen:   p.Timestamp,
+		Hostname:   p.HTTPHost,
+		UID:        -1,
+		Malicious:  p.Malicious,
+		Threat:     p.Threat,
+	}
+	addSource(f, p.Source)
+	return f
+}
+
+// addLogged adds a URL an app logged to the flow to its host or address
+// open at the time, the one seen last if several were, or else to the
+// logged-only flow of its host.
+func (b *flowBuilder) addLogged(p capture.NetworkPacket) {
+	req := capture.FlowRequest{
+		Timestamp: p.Timestamp,
+		Source:    p.Source,
+		Method:    p.HTTPMethod,
+		Host:      p.HTTPHost,
+		Path:      p.HTTPPath,
+	}
+	var candidates []*capture.Flow
+	if p.HTTPHost != "" {
+		candidates = b.byHost[p.Serial+"|"+strings.ToLower(p.HTTPHost)]
+	}
+	if p.DstIP != "" {
+		candidates = append(slices.Clip(candidates), b.byIP[p.Serial+"|"+p.DstIP]...)
+	}
+	var f *capture.Flow
+	for _, c := range candidates {
+		if c.ConnectionID == "" && c.Packets == 0 {
+			continue // another logged-only flow
+		}
+		if within(p.Timestamp, c) && (f == nil || c.LastSeen.After(f.LastSeen)) {
+			f = c
+		}
+	}
+
+	if f == nil {
+		key := p.Serial + "|" + strings.ToLower(p.HTTPHost)
+		if f = b.logcat[key]; f == nil {
+			f = &capture.Flow{
+				ID:         flowID(p.Serial, "logcat", strings.ToLower(p.HTTPHost), p.Timestamp.String()),
+				Serial:     p.Serial,
+				Protocol:   p.Protocol,
+				RemoteIP:   p.DstIP,
+				RemotePort: p.DstPort,
+				Sources:    []string{},
+				FirstSeen:  p.Timestamp,
+				LastSeen:   p.Timestamp,
+				Hostname:   p.HTTPHost,
+				UID:        -1,
+			}
+			b.logcat[key] = f
+			b.flows = append(b.flows, f)
+		}
+		f.LastSeen = p.Timestamp
+		if f.RemoteIP == "" {
+			f.RemoteIP = p.DstIP
+		}
+	}
+	addSource(f, p.Source)
+	addRequest(f, req)
+	if p.Malicious && !f.Malicious {
+		f.Malicious, f.Threat = true, p.Threat
+	}
+}
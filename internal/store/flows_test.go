@@ -0,0 +1,108 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+func TestStore_Flows(t *testing.T) {
+	s := New(Config{MaxPackets: 100, MaxConnections: 100})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	s.AddConnection(capture.Connection{
+		ID: "c1", Serial: "dev1", Protocol: capture.ProtoTCP, Source: "procnet",
+		LocalIP: "10.0.0.2", LocalPort: 40000, RemoteIP: "142.250.1.1", RemotePort: 443,
+		Hostname: "google.com", AppName: "com.android.chrome", UID: 10100,
+		FirstSeen: now, LastSeen: now.Add(time.Minute),
+	})
+	pkt := func(age time.Duration, p capture.NetworkPacket) {
+		p.Serial, p.Protocol, p.Timestamp = "dev1", capture.ProtoTCP, now.Add(age)
+		if p.Source == "" {
+			p.Source = "tcpdump"
+		}
+		s.AddPacket(p)
+	}
+	// The connection's own synthetic packet folds into it, and packets of
+	// either direction join it.
+	pkt(0, capture.NetworkPacket{Source: "procnet", SrcIP: "10.0.0.2", SrcPort: 40000, DstIP: "142.250.1.1", DstPort: 443})
+	pkt(time.Second, capture.NetworkPacket{SrcIP: "10.0.0.2", SrcPort: 40000, DstIP: "142.250.1.1", DstPort: 443, Length: 100})
+	pkt(2*time.Second, capture.NetworkPacket{SrcIP: "142.250.1.1", SrcPort: 443, DstIP: "10.0.0.2", DstPort: 40000, Length: 1400})
+	// A logged URL to the connection's host joins it.
+	pkt(3*time.Second, capture.NetworkPacket{Source: capture.SourceLogcat, HTTPMethod: "GET", HTTPHost: "google.com", HTTPPath: "/search"})
+
+	// A cleartext HTTP exchange with no connection record, closed by a FIN.
+	pkt(10*time.Second, capture.NetworkPacket{SrcIP: "10.0.0.2", SrcPort: 41000, DstIP: "93.184.216.34", DstPort: 80, Length: 200,
+		HTTPMethod: "GET", HTTPHost: "example.com", HTTPPath: "/"})
+	pkt(11*time.Second, capture.NetworkPacket{SrcIP: "93.184.216.34", SrcPort: 80, DstIP: "10.0.0.2", DstPort: 41000, Length: 600, HTTPStatus: 200})
+	pkt(12*time.Second, capture.NetworkPacket{SrcIP: "93.184.216.34", SrcPort: 80, DstIP: "10.0.0.2", DstPort: 41000, Flags: "F."})
+
+	// A URL logged for a host never seen on the wire.
+	pkt(20*time.Second, capture.NetworkPacket{Source: capture.SourceLogcat, HTTPMethod: "POST", HTTPHost: "api.example.org", HTTPPath: "/v1"})
+
+	flows := s.Flows(FlowQuery{})
+	if len(flows) != 3 {
+		t.Fatalf("got %d flows, want 3: %+v", len(flows), flows)
+	}
+
+	conn := flows[0]
+	if conn.ConnectionID != "c1" || conn.Packets != 2 || conn.Bytes != 1500 || conn.UID != 10100 {
+		t.Errorf("connection flow: %+v", conn)
+	}
+	if len(conn.Sources) != 3 || conn.Sources[0] != "procnet" || conn.Sources[1] != "tcpdump" || conn.Sources[2] != "logcat" {
+		t.Errorf("connection flow sources: %v", conn.Sources)
+	}
+	if len(conn.Requests) != 1 || conn.Requests[0].Path != "/search" || conn.DurationMs != 60000 {
+		t.Errorf("connection flow: %+v", conn)
+	}
+
+	logged := flows[1]
+	if logged.Hostname != "api.example.org" || logged.UID != -1 || len(logged.Requests) != 1 || logged.Sources[0] != "logcat" {
+		t.Errorf("logged flow: %+v", logged)
+	}
+
+	http := flows[2]
+	if http.LocalPort != 41000 || http.RemotePort != 80 || http.Hostname != "example.com" || http.Packets != 3 {
+		t.Errorf("http flow: %+v", http)
+	}
+	if http.ClosedAt == nil || !http.ClosedAt.Equal(now.Add(12*time.Second)) || http.DurationMs != 2000 {
+		t.Errorf("http flow lifetime: %+v", http)
+	}
+	if len(http.Requests) != 2 || http.Requests[0].Method != "GET" || http.Requests[1].Status != 200 {
+		t.Errorf("http flow requests: %+v", http.Requests)
+	}
+
+	for _, tc := range []struct {
+		name string
+		q    FlowQuery
+		want int
+	}{
+		{"host", FlowQuery{Host: "EXAMPLE.COM"}, 1},
+		{"request host", FlowQuery{Host: "google.com"}, 1},
+		{"app", FlowQuery{App: "com.android.chrome"}, 1},
+		{"source", FlowQuery{Source: capture.SourceLogcat}, 2},
+		{"closed", FlowQuery{Closed: true}, 1},
+		{"limit", FlowQuery{Limit: 2}, 2},
+		{"other device", FlowQuery{Filter: Filter{Serial: "dev2"}}, 0},
+	} {
+		if got := len(s.Flows(tc.q)); got != tc.want {
+			t.Errorf("%s: got %d flows, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestStore_FlowsEvictedConnection(t *testing.T) {
+	s := New(Config{MaxPackets: 100, MaxConnections: 100})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Without its connection record, a synthetic packet still makes a flow.
+	s.AddPacket(capture.NetworkPacket{
+		Serial: "dev1", Timestamp: now, Protocol: capture.ProtoTCP, Source: "ss",
+		SrcIP: "10.0.0.2", SrcPort: 40000, DstIP: "1.1.1.1", DstPort: 443,
+	})
+	flows := s.Flows(FlowQuery{})
+	if len(flows) != 1 || flows[0].Packets != 0 || len(flows[0].Sources) != 1 || flows[0].Sources[0] != "ss" {
+		t.Errorf("flows: %+v", flows)
+	}
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+// DefaultForegroundHistory is how many foreground spans are kept per device.
+const DefaultForegroundHistory = 1000
+
+// ForegroundSpan is a period during which one app was in the foreground.
+type ForegroundSpan struct {
+	Package  string    `json:"package"`
+	Activity string    `json:"activity,omitempty"`
+	Start    time.Time `json:"start"`
+	// End is zero while the app is still in the foreground.
+	End time.Time `json:"end,omitempty"`
+}
+
+// covers reports how long the span overlaps [from, to), treating an open
+// span as lasting until to.
+func (f ForegroundSpan) covers(from, to time.Time) time.Duration {
+	start, end := f.Start, f.End
+	if end.IsZero() || end.After(to) {
+		end = to
+	}
+	if start.Before(from) {
+		start = from
+	}
+	return end.Sub(start)
+}
+
+// ForegroundUsage is a foreground span with the device traffic seen while
+// it lasted, so traffic spikes can be tied to the app the user had open.
+type ForegroundUsage struct {
+	ForegroundSpan
+	Packets int64 `json:"packets"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// SetForeground records that pkg (with activity) is now in the foreground
+// of the device. An empty pkg ends the current span, e.g. when the device
+// disconnects. It returns the span that was current before, and whether
+// the foreground app or activity changed.
+func (s *Store) SetForeground(serial, pkg, activity string, at time.Time) (prev ForegroundSpan, changed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spans := s.foreground[serial]
+	if n := len(spans); n > 0 && spans[n-1].End.IsZero() {
+		prev = spans[n-1]
+		if prev.Package == pkg && prev.Activity == activity {
+			return prev, false
+		}
+		spans[n-1].End = at
+	}
+	if pkg == "" {
+		return prev, prev.Package != ""
+	}
+
+	if len(spans) >= s.foregroundMaxSize {
+		spans = spans[1:]
+	}
+	s.foreground[serial] = append(spans, ForegroundSpan{Package: pkg, Activity: activity, Start: at})
+	return prev, true
+}
+
+// Foreground returns the device's current foreground app, if known.
+func (s *Store) Foreground(serial string) (ForegroundSpan, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	spans := s.foreground[serial]
+	if n := len(spans); n > 0 && spans[n-1].End.IsZero() {
+		return spans[n-1], true
+	}
+	return ForegroundSpan{}, false
+}
+
+// foregroundSpans returns a copy of the device's spans overlapping
+// [from, to] (zero values are unbounded), oldest first.
+func (s *Store) foregroundSpans(serial string, from, to time.Time) []ForegroundSpan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []ForegroundSpan
+	for _, f := range s.foreground[serial] {
+		if !from.IsZero() && !f.End.IsZero() && f.End.Before(from) {
+			continue
+		}
+		if !to.IsZero() && f.Start.After(to) {
+			break
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// ForegroundHistory returns the device's foreground spans overlapping
+// [from, to], oldest first, each with the packets captured while it lasted.
+func (s *Store) ForegroundHistory(serial string, from, to time.Time) []ForegroundUsage {
+	spans := s.foregroundSpans(serial, from, to)
+	usage := make([]ForegroundUsage, len(spans))
+	for i, f := range spans {
+		usage[i].ForegroundSpan = f
+	}
+	if len(spans) == 0 {
+		return usage
+	}
+
+	s.ScanPackets(Filter{Serial: serial, From: spans[0].Start, To: to}, func(p capture.NetworkPacket) error {
+		// The last span starting at or before the packet.
+		i := sort.Search(len(spans), func(i int) bool { return spans[i].Start.After(p.Timestamp) }) - 1
+		if i < 0 {
+			return nil
+		}
+		if end := spans[i].End; !end.IsZero() && !p.Timestamp.Before(end) {
+			return nil // between spans, e.g. while the screen was off
+		}
+		usage[i].Packets++
+		usage[i].Bytes += int64(p.Length)
+		return nil
+	})
+	return usage
+}
+
+// dominantForeground returns the package that was in the foreground for
+// most of [from, to) among spans.
+func dominantForeground(spans []ForegroundSpan, from, to time.Time) string {
+	var (
+		best    string
+		longest time.Duration
+	)
+	for _, f := range spans {
+		if d := f.covers(from, to); d > longest {
+			best, longest = f.Package, d
+		}
+	}
+	return best
+}
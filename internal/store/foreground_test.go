@@ -0,0 +1,65 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+func TestForegroundHistory(t *testing.T) {
+	s := New(Config{})
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, changed := s.SetForeground("dev1", "com.a", "com.a.Main", base); !changed {
+		t.Fatal("first app should be a change")
+	}
+	if _, changed := s.SetForeground("dev1", "com.a", "com.a.Main", base.Add(10*time.Second)); changed {
+		t.Error("same app and activity reported as a change")
+	}
+	prev, changed := s.SetForeground("dev1", "com.b", "com.b.Video", base.Add(time.Minute))
+	if !changed || prev.Package != "com.a" {
+		t.Errorf("switch to com.b: prev %+v, changed %v", prev, changed)
+	}
+	// Screen off, then com.a again.
+	s.SetForeground("dev1", "", "", base.Add(3*time.Minute))
+	s.SetForeground("dev1", "com.a", "com.a.Main", base.Add(4*time.Minute))
+
+	if cur, ok := s.Foreground("dev1"); !ok || cur.Package != "com.a" {
+		t.Errorf("current = %+v, %v", cur, ok)
+	}
+
+	for _, p := range []struct {
+		at  time.Duration
+		len int
+	}{{30 * time.Second, 100}, {90 * time.Second, 1000}, {150 * time.Second, 1000}, {200 * time.Second, 50}, {250 * time.Second, 10}} {
+		s.AddPacket(capture.NetworkPacket{Serial: "dev1", Timestamp: base.Add(p.at), Length: p.len})
+	}
+
+	h := s.ForegroundHistory("dev1", time.Time{}, time.Time{})
+	if len(h) != 3 {
+		t.Fatalf("got %d spans, want 3", len(h))
+	}
+	want := []struct {
+		pkg     string
+		packets int64
+		bytes   int64
+	}{{"com.a", 1, 100}, {"com.b", 2, 2000}, {"com.a", 1, 10}}
+	for i, w := range want {
+		if h[i].Package != w.pkg || h[i].Packets != w.packets || h[i].Bytes != w.bytes {
+			t.Errorf("span %d = %+v, want %+v", i, h[i], w)
+		}
+	}
+	if !h[1].End.Equal(base.Add(3*time.Minute)) || !h[2].End.IsZero() {
+		t.Errorf("span ends: %v, %v", h[1].End, h[2].End)
+	}
+
+	stats := s.TrafficStats(TrafficQuery{Serial: "dev1", Window: 5 * time.Minute, Now: base.Add(5 * time.Minute)})
+	var apps []string
+	for _, b := range stats.Timeline {
+		apps = append(apps, b.Foreground)
+	}
+	if got := apps[:5]; !equalIDs(got, []string{"com.a", "com.b", "com.b", "", "com.a"}) {
+		t.Errorf("timeline foreground = %v", apps)
+	}
+}
@@ -0,0 +1,265 @@
+package store
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+// DefaultPageSize is the page size used when a Query has no Limit.
+const DefaultPageSize = 200
+
+// Query selects one page of packets or connections. Zero-valued fields
+// match everything. Equality filters are answered from secondary indexes;
+// the time range is checked per entry.
+type Query struct {
+	Filter
+
+	// DstIP matches a packet's destination or a connection's remote IP, in
+	// any spelling capture.NormalizeIP accepts.
+	DstIP string
+	// Host matches a packet's HTTP host or a connection's hostname,
+	// case-insensitively.
+	Host string
+	// Port matches either port of a packet, or a connection's remote port.
+	Port     uint16
+	Protocol capture.Protocol
+	// App matches a connection's app name (connections only).
+	App string
+	// Method matches a packet's HTTP method (packets only).
+	Method string
+	// Malicious keeps only entries a threat feed flagged.
+	Malicious bool
+	// Closed keeps only connections that have closed (connections only).
+	Closed bool
+
+	// Ascending returns oldest entries first; the default is newest first.
+	Ascending bool
+	// Cursor continues after the last entry of a previous page, as
+	// returned in its Next. Zero starts at the newest (or oldest) entry.
+	Cursor int
+	// Limit caps the page size; zero means DefaultPageSize.
+	Limit int
+}
+
+// Page is one page of query results. Next is the Query.Cursor that fetches
+// the following page, or zero when this page reached the end.
+type Page[T any] struct {
+	Items []T
+	Next  int
+}
+
+// index maps a "field=value" key to the ascending ring positions of the
+// entries holding that value. Positions are absolute (head-based), so an
+// entry's slot is its position modulo the ring size.
+type index map[string][]int
+
+func (ix index) add(key string, pos int) {
+	list := ix[key]
+	if n := len(list); n == 0 || list[n-1] < pos {
+		ix[key] = append(list, pos)
+		return
+	}
+	// Out of order (a backfilled field): keep the list sorted.
+	i := sort.SearchInts(list, pos)
+	if i < len(list) && list[i] == pos {
+		return
+	}
+	list = append(list, 0)
+	copy(list[i+1:], list[i:])
+	list[i] = pos
+	ix[key] = list
+}
+
+func (ix index) remove(key string, pos int) {
+	list := ix[key]
+	i := sort.SearchInts(list, pos)
+	if i == len(list) || list[i] != pos {
+		return
+	}
+	if len(list) == 1 {
+		delete(ix, key)
+		return
+	}
+	if i == 0 {
+		// Evictions always drop the oldest position; reslicing keeps
+		// them O(1).
+		ix[key] = list[1:]
+		return
+	}
+	ix[key] = append(list[:i], list[i+1:]...)
+}
+
+func (ix index) addAll(keys []string, pos int) {
+	for _, k := range keys {
+		ix.add(k, pos)
+	}
+}
+
+func (ix index) removeAll(keys []string, pos int) {
+	for _, k := range keys {
+		ix.remove(k, pos)
+	}
+}
+
+func packetKeys(p *capture.NetworkPacket) []string {
+	if p.Serial == "" {
+		return nil // cleared slot
+	}
+	keys := []string{"serial=" + p.Serial, "dst=" + p.DstIP, "proto=" + string(p.Protocol),
+		"port=" + itoa(int(p.DstPort))}
+	if p.SrcPort != p.DstPort {
+		keys = append(keys, "port="+itoa(int(p.SrcPort)))
+	}
+	if p.HTTPHost != "" {
+		keys = append(keys, "host="+strings.ToLower(p.HTTPHost))
+	}
+	if p.HTTPMethod != "" {
+		keys = append(keys, "method="+strings.ToUpper(p.HTTPMethod))
+	}
+	return keys
+}
+
+func connectionKeys(c *capture.Connection) []string {
+	if c.Serial == "" {
+		return nil
+	}
+	keys := []string{"serial=" + c.Serial, "dst=" + c.RemoteIP, "proto=" + string(c.Protocol),
+		"port=" + itoa(int(c.RemotePort))}
+	if c.Hostname != "" {
+		keys = append(keys, "host="+strings.ToLower(c.Hostname))
+	}
+	if c.AppName != "" {
+		keys = append(keys, "app="+strings.ToLower(c.AppName))
+	}
+	return keys
+}
+
+// keys returns the index keys every match must carry.
+func (q Query) keys() []string {
+	var keys []string
+	add := func(field, value string) {
+		if value != "" {
+			keys = append(keys, field+"="+value)
+		}
+	}
+	add("serial", q.Serial)
+	add("dst", q.DstIP)
+	add("proto", string(q.Protocol))
+	add("host", strings.ToLower(q.Host))
+	add("app", strings.ToLower(q.App))
+	add("method", strings.ToUpper(q.Method))
+	if q.Port != 0 {
+		add("port", itoa(int(q.Port)))
+	}
+	return keys
+}
+
+func (q Query) matchPacket(p *capture.NetworkPacket) bool {
+	return q.Filter.matchPacket(p) &&
+		(q.DstIP == "" || p.DstIP == q.DstIP) &&
+		(q.Host == "" || strings.EqualFold(p.HTTPHost, q.Host)) &&
+		(q.Port == 0 || p.DstPort == q.Port || p.SrcPort == q.Port) &&
+		(q.Protocol == "" || p.Protocol == q.Protocol) &&
+		q.App == "" &&
+		(q.Method == "" || strings.EqualFold(p.HTTPMethod, q.Method)) &&
+		(!q.Malicious || p.Malicious) &&
+		!q.Closed
+}
+
+func (q Query) matchConnection(c *capture.Connection) bool {
+	return q.Filter.matchConnection(c) &&
+		(q.DstIP == "" || c.RemoteIP == q.DstIP) &&
+		(q.Host == "" || strings.EqualFold(c.Hostname, q.Host)) &&
+		(q.Port == 0 || c.RemotePort == q.Port) &&
+		(q.Protocol == "" || c.Protocol == q.Protocol) &&
+		(q.App == "" || strings.EqualFold(c.AppName, q.App)) &&
+		q.Method == "" &&
+		(!q.Malicious || c.Malicious) &&
+		(!q.Closed || c.ClosedAt != nil)
+}
+
+// QueryPackets returns one page of packets matching q.
+func (s *Store) QueryPackets(q Query) Page[capture.NetworkPacket] {
+	q.DstIP = capture.NormalizeIP(q.DstIP)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return runQuery(q, s.pktIndex, s.packets, s.packetAt, s.pktHead, s.pktCount, q.matchPacket)
+}
+
+// QueryConnections returns one page of connections matching q.
+func (s *Store) QueryConnections(q Query) Page[capture.Connection] {
+	q.DstIP = capture.NormalizeIP(q.DstIP)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return runQuery(q, s.connIndex, s.connections, s.connectionAt, s.connHead, s.connCount, q.matchConnection)
+}
+
+// runQuery walks the candidate positions of a ring in query order: the
+// shortest posting list among the query's keys, or the whole ring when
+// it has none. Candidates are re-checked with match, since a posting list
+// only proves one of the fields. Matches are copied out with at.
+func runQuery[T any](q Query, ix index, ring []T, at func(pos int) T, head, count int, match func(*T) bool) Page[T] {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	oldest := head - count
+
+	// Positions are walked in [lo, hi), from hi down when descending.
+	lo, hi := oldest, head
+	if q.Cursor > 0 {
+		if q.Ascending {
+			lo = max(lo, q.Cursor)
+		} else {
+			hi = min(hi, q.Cursor-1)
+		}
+	}
+
+	var page Page[T]
+	take := func(pos int) bool {
+		e := &ring[pos%len(ring)]
+		if !match(e) {
+			return true
+		}
+		page.Items = append(page.Items, at(pos))
+		if len(page.Items) == limit {
+			// Cursor positions are off by one so that zero means "start".
+			page.Next = pos + 1
+			return false
+		}
+		return true
+	}
+
+	var list []int
+	indexed := false
+	for _, k := range q.keys() {
+		l := ix[k]
+		if !indexed || len(l) < len(list) {
+			list, indexed = l, true
+		}
+	}
+
+	if !indexed {
+		if q.Ascending {
+			for pos := lo; pos < hi && take(pos); pos++ {
+			}
+		} else {
+			for pos := hi - 1; pos >= lo && take(pos); pos-- {
+			}
+		}
+		return page
+	}
+
+	from := sort.SearchInts(list, lo)
+	to := sort.SearchInts(list, hi)
+	if q.Ascending {
+		for i := from; i < to && take(list[i]); i++ {
+		}
+	} else {
+		for i := to - 1; i >= from && take(list[i]); i-- {
+		}
+	}
+	return page
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+func ids[T any](items []T, id func(T) string) []string {
+	out := make([]string, len(items))
+	for i, it := range items {
+		out[i] = id(it)
+	}
+	return out
+}
+
+func pktID(p capture.NetworkPacket) string { return p.ID }
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestQueryPackets_PaginationAndOrder(t *testing.T) {
+	s := New(Config{MaxPackets: 100})
+	for i := 0; i < 10; i++ {
+		port := uint16(443)
+		if i%2 == 1 {
+			port = 80
+		}
+		s.AddPacket(capture.NetworkPacket{ID: "p" + itoa(i), Serial: "dev1", DstIP: "1.1.1.1", DstPort: port})
+	}
+
+	// Newest first, three at a time, over the port-443 packets.
+	var got []string
+	q := Query{Port: 443, Limit: 3}
+	for {
+		page := s.QueryPackets(q)
+		got = append(got, ids(page.Items, pktID)...)
+		if page.Next == 0 {
+			break
+		}
+		q.Cursor = page.Next
+	}
+	if want := []string{"p8", "p6", "p4", "p2", "p0"}; !equalIDs(got, want) {
+		t.Errorf("desc pages = %v, want %v", got, want)
+	}
+
+	page := s.QueryPackets(Query{Ascending: true, Limit: 4})
+	if want := []string{"p0", "p1", "p2", "p3"}; !equalIDs(ids(page.Items, pktID), want) {
+		t.Errorf("asc page = %v, want %v", ids(page.Items, pktID), want)
+	}
+	page = s.QueryPackets(Query{Ascending: true, Limit: 4, Cursor: page.Next})
+	if want := []string{"p4", "p5", "p6", "p7"}; !equalIDs(ids(page.Items, pktID), want) {
+		t.Errorf("asc second page = %v, want %v", ids(page.Items, pktID), want)
+	}
+}
+
+func TestQueryPackets_Filters(t *testing.T) {
+	s := New(Config{MaxPackets: 100})
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.AddPacket(capture.NetworkPacket{ID: "a", Serial: "dev1", DstIP: "1.1.1.1", DstPort: 443, Protocol: capture.ProtoTCP, HTTPHost: "Example.com", HTTPMethod: "GET", Timestamp: base})
+	s.AddPacket(capture.NetworkPacket{ID: "b", Serial: "dev2", DstIP: "1.1.1.1", DstPort: 443, Protocol: capture.ProtoTCP, Timestamp: base.Add(time.Minute)})
+	s.AddPacket(capture.NetworkPacket{ID: "c", Serial: "dev1", DstIP: "8.8.8.8", DstPort: 53, SrcPort: 40000, Protocol: capture.ProtoUDP, Timestamp: base.Add(2 * time.Minute)})
+	s.AddPacket(capture.NetworkPacket{ID: "d", Serial: "dev1", DstIP: "1.1.1.1", DstPort: 80, Protocol: capture.ProtoTCP, HTTPMethod: "post", Timestamp: base.Add(3 * time.Minute), Malicious: true})
+
+	tests := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{"serial", Query{Filter: Filter{Serial: "dev1"}}, []string{"d", "c", "a"}},
+		{"dst and serial", Query{Filter: Filter{Serial: "dev1"}, DstIP: "1.1.1.1"}, []string{"d", "a"}},
+		{"serial set", Query{Filter: Filter{Serials: []string{"dev2", "dev3"}}}, []string{"b"}},
+		{"host ignores case", Query{Host: "example.COM"}, []string{"a"}},
+		{"source port", Query{Port: 40000}, []string{"c"}},
+		{"protocol", Query{Protocol: capture.ProtoUDP}, []string{"c"}},
+		{"method", Query{Method: "POST"}, []string{"d"}},
+		{"malicious", Query{Malicious: true}, []string{"d"}},
+		{"time range", Query{Filter: Filter{From: base.Add(30 * time.Second), To: base.Add(150 * time.Second)}}, []string{"c", "b"}},
+		{"app never matches packets", Query{App: "chrome"}, nil},
+		{"no match", Query{DstIP: "9.9.9.9"}, nil},
+	}
+	for _, tt := range tests {
+		if got := ids(s.QueryPackets(tt.q).Items, pktID); !equalIDs(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQueryPackets_IndexFollowsEvictionAndBackfill(t *testing.T) {
+	s := New(Config{MaxPackets: 3})
+	for i := 0; i < 5; i++ {
+		s.AddPacket(capture.NetworkPacket{ID: "p" + itoa(i), Serial: "dev1", DstIP: "1.1.1.1", DstPort: 443})
+	}
+	if got := ids(s.QueryPackets(Query{DstIP: "1.1.1.1"}).Items, pktID); !equalIDs(got, []string{"p4", "p3", "p2"}) {
+		t.Errorf("after eviction: %v", got)
+	}
+	if n := len(s.pktIndex["dst=1.1.1.1"]); n != 3 {
+		t.Errorf("posting list holds %d positions, want 3", n)
+	}
+
+	s.BackfillHostname("dev1", "1.1.1.1", "one.one", 0)
+	if got := ids(s.QueryPackets(Query{Host: "one.one"}).Items, pktID); !equalIDs(got, []string{"p4", "p3", "p2"}) {
+		t.Errorf("after backfill: %v", got)
+	}
+
+	s.ClearDevice("dev1")
+	if got := s.QueryPackets(Query{Filter: Filter{Serial: "dev1"}}).Items; len(got) != 0 {
+		t.Errorf("after ClearDevice: %v", got)
+	}
+	if len(s.pktIndex) != 0 {
+		t.Errorf("index not emptied: %v", s.pktIndex)
+	}
+}
+
+func TestQueryConnections(t *testing.T) {
+	s := New(Config{MaxConnections: 100})
+	s.AddConnection(capture.Connection{ID: "c1", Serial: "dev1", RemoteIP: "1.1.1.1", RemotePort: 443, LocalPort: 1, AppName: "com.android.chrome", Protocol: capture.ProtoTCP})
+	s.AddConnection(capture.Connection{ID: "c2", Serial: "dev1", RemoteIP: "1.1.1.1", RemotePort: 443, LocalPort: 2, AppName: "com.example", Protocol: capture.ProtoTCP})
+	s.AddConnection(capture.Connection{ID: "c3", Serial: "dev1", RemoteIP: "2.2.2.2", RemotePort: 53, LocalPort: 3, Protocol: capture.ProtoUDP})
+
+	connID := func(c capture.Connection) string { return c.ID }
+	if got := ids(s.QueryConnections(Query{App: "com.android.chrome"}).Items, connID); !equalIDs(got, []string{"c1"}) {
+		t.Errorf("app: %v", got)
+	}
+	if got := ids(s.QueryConnections(Query{Port: 443, Ascending: true}).Items, connID); !equalIDs(got, []string{"c1", "c2"}) {
+		t.Errorf("port asc: %v", got)
+	}
+	if got := s.QueryConnections(Query{Method: "GET"}).Items; len(got) != 0 {
+		t.Errorf("method should not match connections: %v", got)
+	}
+}
+
+func TestStore_CloseConnection(t *testing.T) {
+	s := New(Config{MaxConnections: 100})
+	var kinds []ChangeKind
+	s.SetOnChange(func(c Change) { kinds = append(kinds, c.Kind) })
+
+	opened := time.Unix(1700000000, 0)
+	conn := capture.Connection{ID: "c1", Serial: "dev1", RemoteIP: "1.1.1.1", RemotePort: 443, LocalPort: 1,
+		Protocol: capture.ProtoTCP, State: "ESTABLISHED", FirstSeen: opened, LastSeen: opened}
+	s.AddConnection(conn)
+	s.AddConnection(capture.Connection{ID: "c2", Serial: "dev1", RemoteIP: "2.2.2.2", RemotePort: 443, LocalPort: 2, Protocol: capture.ProtoTCP})
+
+	closedAt := opened.Add(90 * time.Second)
+	conn.State, conn.LastSeen, conn.ClosedAt, conn.DurationMs = "TIME_WAIT", closedAt, &closedAt, 90000
+	s.CloseConnection(conn)
+	// Never seen open: stored as it closes.
+	s.CloseConnection(capture.Connection{ID: "c3", Serial: "dev1", RemoteIP: "3.3.3.3", LocalPort: 3, ClosedAt: &closedAt})
+
+	if s.ConnectionCount() != 3 {
+		t.Fatalf("connections = %d, want 3", s.ConnectionCount())
+	}
+	closed := s.QueryConnections(Query{Closed: true, Ascending: true}).Items
+	if got := ids(closed, func(c capture.Connection) string { return c.ID }); !equalIDs(got, []string{"c1", "c3"}) {
+		t.Fatalf("closed = %v", got)
+	}
+	if c := closed[0]; c.State != "TIME_WAIT" || c.DurationMs != 90000 || !c.FirstSeen.Equal(opened) {
+		t.Errorf("closed c1 = %+v", c)
+	}
+	if got := s.QueryPackets(Query{Closed: true}).Items; len(got) != 0 {
+		t.Errorf("closed should not match packets: %v", got)
+	}
+	want := []ChangeKind{ConnectionAdded, ConnectionAdded, ConnectionUpdated, ConnectionAdded}
+	if len(kinds) != len(want) {
+		t.Fatalf("changes = %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Errorf("change %d = %v, want %v", i, kinds[i], want[i])
+		}
+	}
+}
+
+func TestQueryPackets_IPv6Spellings(t *testing.T) {
+	s := New(Config{MaxPackets: 10})
+	s.AddPacket(capture.NetworkPacket{ID: "v6", Serial: "dev1", DstIP: "2001:db8::15"})
+	s.AddPacket(capture.NetworkPacket{ID: "v4", Serial: "dev1", DstIP: "10.0.2.15"})
+
+	for q, want := range map[string]string{
+		"2001:DB8:0:0:0:0:0:15": "v6",
+		"[2001:db8::15]":        "v6",
+		"::ffff:10.0.2.15":      "v4",
+	} {
+		if got := ids(s.QueryPackets(Query{DstIP: q}).Items, pktID); !equalIDs(got, []string{want}) {
+			t.Errorf("dst_ip %s: got %v, want [%s]", q, got, want)
+		}
+	}
+}
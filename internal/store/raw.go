@@ -0,0 +1,173 @@
+package store
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// RawMode says how the store keeps the Raw line of each packet, which
+// otherwise takes about as much memory as the rest of the packet.
+type RawMode int
+
+const (
+	// RawKeep stores Raw as captured.
+	RawKeep RawMode = iota
+	// RawCompress deflates Raw lines in blocks and inflates a block when a
+	// packet in it is read back out of the store.
+	RawCompress
+	// RawDrop discards Raw.
+	RawDrop
+)
+
+// String returns the name accepted by ParseRawMode.
+func (m RawMode) String() string {
+	switch m {
+	case RawCompress:
+		return "compress"
+	case RawDrop:
+		return "drop"
+	default:
+		return "keep"
+	}
+}
+
+// ParseRawMode converts "keep", "compress" or "drop" to a RawMode.
+func ParseRawMode(s string) (RawMode, error) {
+	switch s {
+	case "", "keep":
+		return RawKeep, nil
+	case "compress":
+		return RawCompress, nil
+	case "drop":
+		return RawDrop, nil
+	default:
+		return RawKeep, fmt.Errorf("unknown raw mode %q (want keep, compress or drop)", s)
+	}
+}
+
+// rawBlockSize is the number of consecutive packets whose Raw lines are
+// deflated together. A single line is too short to compress; a block of
+// tcpdump lines shrinks to about a third.
+const rawBlockSize = 64
+
+// rawBlocks holds the Raw lines of the packet ring for RawCompress, by
+// absolute ring position. Position p belongs to block p/rawBlockSize. The
+// newest block is kept as plain strings until the ring moves past it, then
+// deflated. It is guarded by the store lock, except the decoded block
+// cache, which readers share under the read lock.
+type rawBlocks struct {
+	open    []string // lines of block openNum, by position within it
+	openNum int
+	sealed  map[int][]byte // block number -> deflated lines
+	first   int            // oldest block that may still be in sealed
+	size    int            // bytes held, compressed or not
+
+	cacheMu  sync.Mutex
+	cacheNum int
+	cache    []string
+}
+
+func newRawBlocks() *rawBlocks {
+	return &rawBlocks{
+		open:     make([]string, rawBlockSize),
+		sealed:   make(map[int][]byte),
+		cacheNum: -1,
+	}
+}
+
+// add stores the line of position pos, which is newer than every position
+// added before, and drops blocks wholly older than oldest.
+func (rb *rawBlocks) add(pos int, raw string, oldest int) {
+	if num := pos / rawBlockSize; num != rb.openNum {
+		rb.seal()
+		rb.openNum = num
+	}
+	rb.open[pos%rawBlockSize] = raw
+	rb.size += len(raw)
+
+	for ; rb.first < oldest/rawBlockSize; rb.first++ {
+		if data, ok := rb.sealed[rb.first]; ok {
+			rb.size -= len(data)
+			delete(rb.sealed, rb.first)
+		}
+	}
+}
+
+// seal deflates the open block and empties it.
+func (rb *rawBlocks) seal() {
+	var plain []byte
+	empty := true
+	for _, line := range rb.open {
+		plain = binary.AppendUvarint(plain, uint64(len(line)))
+		plain = append(plain, line...)
+		rb.size -= len(line)
+		empty = empty && line == ""
+	}
+	clear(rb.open)
+	if empty {
+		return
+	}
+
+	var buf bytes.Buffer
+	w := deflaters.Get().(*flate.Writer)
+	w.Reset(&buf)
+	w.Write(plain)
+	w.Close()
+	deflaters.Put(w)
+
+	data := bytes.Clone(buf.Bytes())
+	rb.sealed[rb.openNum] = data
+	rb.size += len(data)
+}
+
+// get returns the line of position pos, or "" if it is gone.
+func (rb *rawBlocks) get(pos int) string {
+	num := pos / rawBlockSize
+	if num == rb.openNum {
+		return rb.open[pos%rawBlockSize]
+	}
+	data, ok := rb.sealed[num]
+	if !ok {
+		return ""
+	}
+
+	rb.cacheMu.Lock()
+	defer rb.cacheMu.Unlock()
+	if rb.cacheNum != num {
+		rb.cache, rb.cacheNum = inflateBlock(data), num
+	}
+	if i := pos % rawBlockSize; i < len(rb.cache) {
+		return rb.cache[i]
+	}
+	return ""
+}
+
+var deflaters = sync.Pool{New: func() any {
+	w, _ := flate.NewWriter(nil, flate.BestSpeed)
+	return w
+}}
+
+// inflateBlock decodes a sealed block into its lines. A block that fails
+// to decode, which only a bug could cause, yields no lines.
+func inflateBlock(data []byte) []string {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil
+	}
+	lines := make([]string, 0, rawBlockSize)
+	for len(plain) > 0 {
+		n, w := binary.Uvarint(plain)
+		if w <= 0 || uint64(len(plain)-w) < n {
+			return nil
+		}
+		lines = append(lines, string(plain[w:w+int(n)]))
+		plain = plain[w+int(n):]
+	}
+	return lines
+}
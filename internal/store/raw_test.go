@@ -0,0 +1,95 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+func rawLine(i int) string {
+	return fmt.Sprintf("12:34:%02d.%06d IP 10.0.2.15.%d > 142.250.185.78.443: Flags [P.], seq 1:518, ack 1, win 502, length 517",
+		i%60, i*37%1000000, 40000+i%20000)
+}
+
+func TestStore_RawCompress(t *testing.T) {
+	const capacity = 300
+	s := New(Config{MaxPackets: capacity, RawMode: RawCompress})
+	for i := 0; i < 1000; i++ {
+		s.AddPacket(capture.NetworkPacket{ID: "pkt-" + itoa(i), Serial: "dev" + itoa(i%2), Raw: rawLine(i)})
+	}
+
+	// Reads from the open block, sealed blocks and the oldest partial one.
+	for _, p := range s.GetRecentPackets(capacity) {
+		var i int
+		fmt.Sscanf(p.ID, "pkt-%d", &i)
+		if p.Raw != rawLine(i) {
+			t.Fatalf("%s: raw = %q, want %q", p.ID, p.Raw, rawLine(i))
+		}
+	}
+	page := s.QueryPackets(Query{Filter: Filter{Serial: "dev1"}, Ascending: true, Limit: 5})
+	if len(page.Items) != 5 || page.Items[0].ID != "pkt-701" || page.Items[0].Raw != rawLine(701) {
+		t.Errorf("query = %+v", page.Items)
+	}
+
+	st := s.Stats()
+	plain := 0
+	for i := 1000 - capacity; i < 1000; i++ {
+		plain += len(rawLine(i))
+	}
+	if st.RawMode != "compress" || st.RawBytes <= 0 || st.RawBytes > plain/2 {
+		t.Errorf("raw bytes = %d of %d plain", st.RawBytes, plain)
+	}
+	// Evicted blocks are freed: at most the ring's blocks plus the open one.
+	if n := len(s.raw.sealed); n > capacity/rawBlockSize+1 {
+		t.Errorf("%d sealed blocks kept", n)
+	}
+
+	s.ClearDevice("dev0")
+	if got := s.GetRecentPackets(2); got[1].Raw != "" || got[0].Raw != rawLine(999) {
+		t.Errorf("after clearing dev0: raw = %q, %q", got[0].Raw, got[1].Raw)
+	}
+	s.Clear()
+	s.AddPacket(capture.NetworkPacket{ID: "new", Serial: "dev1", Raw: "after clear"})
+	if got := s.GetPacketsBySerial("dev1", 1); len(got) != 1 || got[0].Raw != "after clear" {
+		t.Errorf("after clear = %+v", got)
+	}
+}
+
+func TestStore_RawDrop(t *testing.T) {
+	s := New(Config{MaxPackets: 10, RawMode: RawDrop})
+	var seen string
+	s.SetOnChange(func(c Change) { seen = c.Packet.Raw })
+	s.AddPacket(capture.NetworkPacket{ID: "a", Serial: "dev1", Raw: rawLine(1)})
+	if got := s.GetRecentPackets(1); got[0].Raw != "" || seen != "" {
+		t.Errorf("raw kept: %q, change %q", got[0].Raw, seen)
+	}
+	if st := s.Stats(); st.RawBytes != 0 || st.RawMode != "drop" {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestParseRawMode(t *testing.T) {
+	for _, m := range []RawMode{RawKeep, RawCompress, RawDrop} {
+		if got, err := ParseRawMode(m.String()); err != nil || got != m {
+			t.Errorf("ParseRawMode(%q) = %v, %v", m, got, err)
+		}
+	}
+	if _, err := ParseRawMode("zstd"); err == nil {
+		t.Error("zstd accepted")
+	}
+}
+
+func BenchmarkStore_AddPacketRaw(b *testing.B) {
+	for _, mode := range []RawMode{RawKeep, RawCompress} {
+		b.Run(mode.String(), func(b *testing.B) {
+			s := New(Config{MaxPackets: DefaultMaxPackets, RawMode: mode})
+			pkt := capture.NetworkPacket{Serial: "emulator-5554", Length: 517, Raw: rawLine(1)}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				s.AddPacket(pkt)
+			}
+			b.ReportMetric(float64(s.Stats().RawBytes)/float64(min(b.N, DefaultMaxPackets)), "raw-B/pkt")
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+// maxWordLen caps the length of an indexed word. Longer runs of letters
+// and digits (tokens, hashes, base64) are indexed by their prefix, which
+// is specific enough to narrow a search.
+const maxWordLen = 32
+
+// Search selects packets and connections by text. Zero-valued Filter
+// fields match everything.
+type Search struct {
+	Filter
+
+	// Text holds whitespace-separated terms, such as "/v2/token" or
+	// "api.example.com okhttp". An entry matches when each term appears,
+	// case-insensitively, in one of its searched fields: a packet's HTTP
+	// host, path, Raw line and app, a connection's hostname and app.
+	// Terms are found through their words, so a term must start and end
+	// on word boundaries: "token" matches "/v2/token", "oken" does not.
+	Text string
+	// Limit caps the packets and the connections returned, each; zero
+	// means DefaultPageSize.
+	Limit int
+}
+
+// SearchResult holds the entries matching a Search, newest first.
+type SearchResult struct {
+	Packets     []capture.NetworkPacket `json:"packets"`
+	Connections []capture.Connection    `json:"connections"`
+}
+
+// words splits fields into the lower-cased runs of letters and digits the
+// word indexes hold, without duplicates. Single characters are left out.
+func words(fields ...string) []string {
+	var out []string
+	for _, f := range fields {
+		for _, w := range strings.FieldsFunc(strings.ToLower(f), notWordRune) {
+			if len(w) < 2 {
+				continue
+			}
+			if len(w) > maxWordLen {
+				w = w[:maxWordLen]
+			}
+			if !slices.Contains(out, w) {
+				out = append(out, w)
+			}
+		}
+	}
+	return out
+}
+
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// packetWords returns the words of p's searched fields. p must carry its
+// Raw line, as packetAt returns it.
+func packetWords(p *capture.NetworkPacket) []string {
+	if p.Serial == "" {
+		return nil // cleared slot
+	}
+	return words(p.HTTPHost, p.HTTPPath, p.Raw, p.App)
+}
+
+func connectionWords(c *capture.Connection) []string {
+	if c.Serial == "" {
+		return nil
+	}
+	return words(c.Hostname, c.AppName)
+}
+
+// Search returns the newest packets and connections matching q.
+func (s *Store) Search(q Search) SearchResult {
+	terms := strings.Fields(strings.ToLower(q.Text))
+	var res SearchResult
+	if len(terms) == 0 {
+		return res
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res.Packets = searchRing(s.pktWords, terms, s.pktHead, s.pktCount, limit, func(pos int) (capture.NetworkPacket, bool) {
+		if !q.Filter.matchPacket(&s.packets[pos%s.pktMaxSize]) {
+			return capture.NetworkPacket{}, false
+		}
+		p := s.packetAt(pos)
+		return p, containsTerms(terms, p.HTTPHost, p.HTTPPath, p.Raw, p.App)
+	})
+	res.Connections = searchRing(s.connWords, terms, s.connHead, s.connCount, limit, func(pos int) (capture.Connection, bool) {
+		c := &s.connections[pos%s.connMaxSize]
+		if !q.Filter.matchConnection(c) || !containsTerms(terms, c.Hostname, c.AppName) {
+			return capture.Connection{}, false
+		}
+		return *c, true
+	})
+	return res
+}
+
+// searchRing walks the candidate positions of a ring, newest first: the
+// shortest posting list among the words of terms, or the whole ring when
+// the terms hold no word. A word nothing holds means nothing matches.
+// Candidates are re-checked with match, since the list only proves one
+// word.
+func searchRing[T any](ix index, terms []string, head, count, limit int, match func(pos int) (T, bool)) []T {
+	var list []int
+	indexed := false
+	for _, w := range words(terms...) {
+		l, ok := ix[w]
+		if !ok {
+			return nil
+		}
+		if !indexed || len(l) < len(list) {
+			list, indexed = l, true
+		}
+	}
+
+	var out []T
+	take := func(pos int) bool {
+		if e, ok := match(pos); ok {
+			out = append(out, e)
+		}
+		return len(out) < limit
+	}
+	if !indexed {
+		for pos := head - 1; pos >= head-count && take(pos); pos-- {
+		}
+		return out
+	}
+	for i := len(list) - 1; i >= 0 && take(list[i]); i-- {
+	}
+	return out
+}
+
+// containsTerms reports whether each term is in one of fields, ignoring
+// case. Terms are lower-cased.
+func containsTerms(terms []string, fields ...string) bool {
+	for _, t := range terms {
+		if !slices.ContainsFunc(fields, func(f string) bool {
+			return strings.Contains(strings.ToLower(f), t)
+		}) {
+			return false
+		}
+	}
+	return true
+}
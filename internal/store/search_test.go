@@ -0,0 +1,69 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+func TestSearch(t *testing.T) {
+	for _, mode := range []RawMode{RawKeep, RawCompress} {
+		s := New(Config{MaxPackets: 100, MaxConnections: 100, RawMode: mode})
+		s.AddPacket(capture.NetworkPacket{ID: "a", Serial: "dev1", HTTPHost: "api.example.com", HTTPPath: "/v2/token?grant=refresh", App: "com.example"})
+		s.AddPacket(capture.NetworkPacket{ID: "b", Serial: "dev1", HTTPHost: "api.example.com", HTTPPath: "/token/v2"})
+		s.AddPacket(capture.NetworkPacket{ID: "c", Serial: "dev2", Raw: "12:00:00.000 IP 10.0.0.2.40000 > 1.1.1.1.443: Flags [S], GET /V2/Token HTTP/1.1"})
+		s.AddPacket(capture.NetworkPacket{ID: "d", Serial: "dev2", HTTPPath: "/v2/tokens"})
+		s.AddConnection(capture.Connection{ID: "c1", Serial: "dev1", LocalPort: 1, Hostname: "api.example.com", AppName: "com.example"})
+		s.AddConnection(capture.Connection{ID: "c2", Serial: "dev2", LocalPort: 2, AppName: "com.android.chrome"})
+
+		tests := []struct {
+			name    string
+			q       Search
+			packets []string
+			conns   []string
+		}{
+			{"path", Search{Text: "/v2/token"}, []string{"c", "a"}, nil},
+			{"words in any order", Search{Text: "token v2"}, []string{"c", "b", "a"}, nil},
+			{"terms across fields", Search{Text: "EXAMPLE.com grant"}, []string{"a"}, nil},
+			{"app", Search{Text: "com.example"}, []string{"a"}, []string{"c1"}},
+			{"serial", Search{Filter: Filter{Serial: "dev2"}, Text: "/v2/token"}, []string{"c"}, nil},
+			{"limit", Search{Text: "/v2/token", Limit: 1}, []string{"c"}, nil},
+			{"partial word", Search{Text: "oken"}, nil, nil},
+			{"whole words", Search{Text: "tokens"}, []string{"d"}, nil},
+			{"no word scans", Search{Text: "/"}, []string{"d", "c", "b", "a"}, nil},
+			{"empty", Search{}, nil, nil},
+		}
+		for _, tt := range tests {
+			res := s.Search(tt.q)
+			if got := ids(res.Packets, pktID); !equalIDs(got, tt.packets) {
+				t.Errorf("%v %s: packets %v, want %v", mode, tt.name, got, tt.packets)
+			}
+			if got := ids(res.Connections, func(c capture.Connection) string { return c.ID }); !equalIDs(got, tt.conns) {
+				t.Errorf("%v %s: connections %v, want %v", mode, tt.name, got, tt.conns)
+			}
+		}
+	}
+}
+
+func TestSearch_IndexFollowsEvictionAndBackfill(t *testing.T) {
+	s := New(Config{MaxPackets: 3, RawMode: RawCompress})
+	for i := 0; i < 5; i++ {
+		s.AddPacket(capture.NetworkPacket{ID: "p" + itoa(i), Serial: "dev1", DstIP: "1.1.1.1", Raw: "IP 1.1.1.1.443 seq " + itoa(1000+i)})
+	}
+	if got := ids(s.Search(Search{Text: "seq"}).Packets, pktID); !equalIDs(got, []string{"p4", "p3", "p2"}) {
+		t.Errorf("after eviction: %v", got)
+	}
+	if _, ok := s.pktWords["1000"]; ok {
+		t.Error("word of an evicted packet still indexed")
+	}
+
+	s.BackfillHostname("dev1", "1.1.1.1", "cdn.example.net", 0)
+	if got := ids(s.Search(Search{Text: "example.net"}).Packets, pktID); !equalIDs(got, []string{"p4", "p3", "p2"}) {
+		t.Errorf("after backfill: %v", got)
+	}
+
+	s.ClearDevice("dev1")
+	if len(s.pktWords) != 0 {
+		t.Errorf("word index not emptied: %v", s.pktWords)
+	}
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+// A snapshot is a gzipped JSON Lines file: a header line, then one record
+// per line, each ring oldest first, so restoring it rebuilds the rings in
+// their order.
+const (
+	snapshotFormat  = "go-adb-monitor-snapshot"
+	snapshotVersion = 1
+	// maxSnapshotLine bounds one record; a packet's Raw line is the
+	// largest field.
+	maxSnapshotLine = 16 << 20
+)
+
+type snapshotHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// snapshotRecord holds one entry; exactly one field is set.
+type snapshotRecord struct {
+	Packet     *capture.NetworkPacket `json:"packet,omitempty"`
+	Connection *capture.Connection    `json:"connection,omitempty"`
+	DNS        *capture.DNSLookup     `json:"dns,omitempty"`
+	TLS        *capture.TLSSession    `json:"tls,omitempty"`
+}
+
+// SnapshotStats counts the entries of a snapshot.
+type SnapshotStats struct {
+	Packets     int `json:"packets"`
+	Connections int `json:"connections"`
+	DNSLookups  int `json:"dns_lookups"`
+	TLSSessions int `json:"tls_sessions"`
+}
+
+// WriteSnapshot writes the packet, connection, DNS lookup and TLS session
+// rings to w. Packets and connections are copied out in chunks as by
+// ScanPackets, so the store stays writable meanwhile; entries removed by
+// ClearDevice are left out.
+func (s *Store) WriteSnapshot(w io.Writer) (SnapshotStats, error) {
+	var stats SnapshotStats
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	enc := json.NewEncoder(bw)
+
+	err := enc.Encode(snapshotHeader{Format: snapshotFormat, Version: snapshotVersion, CreatedAt: time.Now()})
+	if err == nil {
+		err = s.ScanPackets(Filter{}, func(p capture.NetworkPacket) error {
+			if p.Serial == "" {
+				return nil
+			}
+			stats.Packets++
+			return enc.Encode(snapshotRecord{Packet: &p})
+		})
+	}
+	if err == nil {
+		err = s.ScanConnections(Filter{}, func(c capture.Connection) error {
+			if c.Serial == "" {
+				return nil
+			}
+			stats.Connections++
+			return enc.Encode(snapshotRecord{Connection: &c})
+		})
+	}
+	if err == nil {
+		for _, l := range s.dnsLookupsOldestFirst() {
+			stats.DNSLookups++
+			if err = enc.Encode(snapshotRecord{DNS: &l}); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		for _, t := range s.tlsSessionsOldestFirst() {
+			stats.TLSSessions++
+			if err = enc.Encode(snapshotRecord{TLS: &t}); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	return stats, err
+}
+
+func (s *Store) dnsLookupsOldestFirst() []capture.DNSLookup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]capture.DNSLookup, 0, s.dnsCount)
+	for pos := s.dnsHead - s.dnsCount; pos < s.dnsHead; pos++ {
+		out = append(out, s.dnsLookups[pos%s.dnsMaxSize])
+	}
+	return out
+}
+
+func (s *Store) tlsSessionsOldestFirst() []capture.TLSSession {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]capture.TLSSession, 0, s.tlsCount)
+	for pos := s.tlsHead - s.tlsCount; pos < s.tlsHead; pos++ {
+		out = append(out, s.tlsSessions[pos%s.tlsMaxSize])
+	}
+	return out
+}
+
+// RestoreSnapshot adds the entries of a snapshot written by WriteSnapshot
+// to the store, after any it holds; rings smaller than the snapshot keep
+// its newest entries. The change callback is not called. Restored
+// connections are history: a live capture stores the same endpoints as a
+// new connection rather than updating one. On error, the entries read so
+// far stay restored.
+func (s *Store) RestoreSnapshot(r io.Reader) (SnapshotStats, error) {
+	var stats SnapshotStats
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return stats, fmt.Errorf("not a snapshot: %w", err)
+	}
+	defer zr.Close()
+	sc := bufio.NewScanner(zr)
+	sc.Buffer(make([]byte, 64<<10), maxSnapshotLine)
+
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return stats, err
+		}
+		return stats, errors.New("snapshot is empty")
+	}
+	var h snapshotHeader
+	if err := json.Unmarshal(sc.Bytes(), &h); err != nil || h.Format != snapshotFormat {
+		return stats, errors.New("not a snapshot")
+	}
+	if h.Version != snapshotVersion {
+		return stats, fmt.Errorf("unsupported snapshot version %d", h.Version)
+	}
+
+	for line := 2; sc.Scan(); line++ {
+		var rec snapshotRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return stats, fmt.Errorf("snapshot line %d: %w", line, err)
+		}
+		s.mu.Lock()
+		switch {
+		case rec.Packet != nil:
+			if s.rawMode == RawDrop {
+				rec.Packet.Raw = ""
+			}
+			s.addPacketLocked(*rec.Packet)
+			stats.Packets++
+		case rec.Connection != nil:
+			key := connKey(*rec.Connection)
+			live, ok := s.connMap[key]
+			s.insertConnectionLocked(*rec.Connection)
+			if ok && live >= s.connHead-s.connCount {
+				s.connMap[key] = live
+			} else {
+				delete(s.connMap, key)
+			}
+			stats.Connections++
+		case rec.DNS != nil:
+			s.addDNSLookupLocked(*rec.DNS)
+			stats.DNSLookups++
+		case rec.TLS != nil:
+			s.addTLSSessionLocked(*rec.TLS)
+			stats.TLSSessions++
+		}
+		s.mu.Unlock()
+	}
+	return stats, sc.Err()
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	src := New(Config{RawMode: RawCompress})
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	for i := range 3 {
+		src.AddPacket(capture.NetworkPacket{ID: "p" + itoa(i), Serial: "a", Timestamp: now, DstIP: "1.1.1.1", Raw: "raw " + itoa(i)})
+	}
+	src.AddConnection(capture.Connection{ID: "c1", Serial: "a", LocalIP: "10.0.0.2", LocalPort: 40000, RemoteIP: "1.1.1.1", RemotePort: 443, State: "ESTABLISHED"})
+	closed := now
+	src.CloseConnection(capture.Connection{ID: "c2", Serial: "a", LocalIP: "10.0.0.2", LocalPort: 40001, RemoteIP: "1.1.1.1", RemotePort: 80, ClosedAt: &closed})
+	src.AddDNSLookup(capture.DNSLookup{ID: "d1", Serial: "a", Query: "example.com"})
+	src.AddTLSSession(capture.TLSSession{Serial: "a", ServerIP: "1.1.1.1", Version: "TLS 1.3"})
+
+	var buf bytes.Buffer
+	stats, err := src.WriteSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SnapshotStats{Packets: 3, Connections: 2, DNSLookups: 1, TLSSessions: 1}
+	if stats != want {
+		t.Fatalf("written %+v, want %+v", stats, want)
+	}
+
+	dst := New(Config{MaxPackets: 2})
+	stats, err = dst.RestoreSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != want {
+		t.Errorf("restored %+v, want %+v", stats, want)
+	}
+	pkts := dst.GetRecentPackets(10)
+	if len(pkts) != 2 || pkts[0].ID != "p2" || pkts[0].Raw != "raw 2" {
+		t.Errorf("packets: newest kept in order with Raw: %+v", pkts)
+	}
+	if got := dst.GetConnectionsBySerial("a", 10); len(got) != 2 {
+		t.Errorf("connections: %+v", got)
+	}
+	if got := dst.GetDNSLookupsBySerial("a", 10); len(got) != 1 || got[0].Query != "example.com" {
+		t.Errorf("dns: %+v", got)
+	}
+	if got := dst.TLSSessions(TLSQuery{Limit: 10}); len(got) != 1 {
+		t.Errorf("tls: %+v", got)
+	}
+
+	// Restored connections are history; live ones are stored anew.
+	dst.AddConnection(capture.Connection{ID: "c3", Serial: "a", LocalIP: "10.0.0.2", LocalPort: 40000, RemoteIP: "1.1.1.1", RemotePort: 443})
+	if n := dst.ConnectionCount(); n != 3 {
+		t.Errorf("live connection merged into a restored one: %d stored", n)
+	}
+}
+
+func TestRestoreSnapshotRejectsOtherFiles(t *testing.T) {
+	s := New(Config{})
+	if _, err := s.RestoreSnapshot(bytes.NewReader([]byte("{}\n"))); err == nil {
+		t.Error("plain text: want error")
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(`{"format":"go-adb-monitor-snapshot","version":99}` + "\n"))
+	zw.Close()
+	if _, err := s.RestoreSnapshot(&buf); err == nil {
+		t.Error("unknown version: want error")
+	}
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"slices"
 	"sync"
 	"time"
 
@@ -12,6 +13,11 @@ const (
 	DefaultMaxPackets = 50000
 	// DefaultMaxConns is the default ring buffer capacity for connections.
 	DefaultMaxConns = 10000
+	// DefaultMaxDNSLookups is the default ring buffer capacity for DNS lookups.
+	DefaultMaxDNSLookups = 5000
+	// DefaultMaxTLSSessions is the default ring buffer capacity for TLS
+	// handshakes.
+	DefaultMaxTLSSessions = 2000
 )
 
 // Store is a thread-safe, in-memory ring buffer that holds network data.
@@ -24,23 +30,68 @@ type Store struct {
 	pktHead    int
 	pktCount   int
 	pktMaxSize int
-
-	connections    []capture.Connection
-	connHead       int
-	connCount      int
-	connMaxSize    int
-
-	// connMap tracks latest state of each connection by key.
-	connMap map[string]*capture.Connection
-
-	// onChange is called (non-blocking) when new data arrives.
-	onChange func()
+	pktIndex   index
+	// pktWords and connWords are the word indexes of Search.
+	pktWords index
+
+	rawMode RawMode
+	// raw holds the packets' Raw lines under RawCompress; otherwise they
+	// stay in the packets and rawBytes counts their size.
+	raw      *rawBlocks
+	rawBytes int
+
+	connections []capture.Connection
+	connHead    int
+	connCount   int
+	connMaxSize int
+	connIndex   index
+	connWords   index
+
+	// connMap maps the key of each open connection to the ring position
+	// of its entry.
+	connMap map[string]int
+
+	dnsLookups []capture.DNSLookup
+	dnsHead    int
+	dnsCount   int
+	dnsMaxSize int
+
+	tlsSessions []capture.TLSSession
+	tlsHead     int
+	tlsCount    int
+	tlsMaxSize  int
+
+	battery        map[string]*batteryLog // serial -> samples and cycles
+	batteryMaxSize int
+
+	foreground        map[string][]ForegroundSpan // serial -> spans, oldest first
+	foregroundMaxSize int
+
+	events          []DeviceEvent // oldest first
+	eventSeq        uint64
+	eventsMaxSize   int
+	eventsRetention time.Duration
+
+	// onChange is called, outside the lock, after every change.
+	onChange func(Change)
 }
 
 // Config configures the store capacity.
 type Config struct {
 	MaxPackets     int
 	MaxConnections int
+	MaxDNSLookups  int
+	MaxTLSSessions int
+	// MaxBatterySamples is the per-device battery history length.
+	MaxBatterySamples int
+	// MaxForegroundSpans is the per-device foreground app history length.
+	MaxForegroundSpans int
+	// MaxDeviceEvents and DeviceEventRetention bound the device event
+	// history: its length and how long an event is kept.
+	MaxDeviceEvents      int
+	DeviceEventRetention time.Duration
+	// RawMode says how packets' Raw lines are kept.
+	RawMode RawMode
 }
 
 // New creates a new data store.
@@ -51,18 +102,91 @@ func New(cfg Config) *Store {
 	if cfg.MaxConnections <= 0 {
 		cfg.MaxConnections = DefaultMaxConns
 	}
+	if cfg.MaxDNSLookups <= 0 {
+		cfg.MaxDNSLookups = DefaultMaxDNSLookups
+	}
+	if cfg.MaxTLSSessions <= 0 {
+		cfg.MaxTLSSessions = DefaultMaxTLSSessions
+	}
+	if cfg.MaxBatterySamples <= 0 {
+		cfg.MaxBatterySamples = DefaultBatteryHistory
+	}
+	if cfg.MaxForegroundSpans <= 0 {
+		cfg.MaxForegroundSpans = DefaultForegroundHistory
+	}
+	if cfg.MaxDeviceEvents <= 0 {
+		cfg.MaxDeviceEvents = DefaultMaxDeviceEvents
+	}
+	if cfg.DeviceEventRetention <= 0 {
+		cfg.DeviceEventRetention = DefaultDeviceEventRetention
+	}
 
-	return &Store{
-		packets:    make([]capture.NetworkPacket, cfg.MaxPackets),
-		pktMaxSize: cfg.MaxPackets,
+	s := &Store{
+		packets:     make([]capture.NetworkPacket, cfg.MaxPackets),
+		pktMaxSize:  cfg.MaxPackets,
+		pktIndex:    make(index),
+		pktWords:    make(index),
+		rawMode:     cfg.RawMode,
 		connections: make([]capture.Connection, cfg.MaxConnections),
 		connMaxSize: cfg.MaxConnections,
-		connMap:     make(map[string]*capture.Connection),
+		connIndex:   make(index),
+		connWords:   make(index),
+		connMap:     make(map[string]int),
+		dnsLookups:  make([]capture.DNSLookup, cfg.MaxDNSLookups),
+		dnsMaxSize:  cfg.MaxDNSLookups,
+
+		tlsSessions: make([]capture.TLSSession, cfg.MaxTLSSessions),
+		tlsMaxSize:  cfg.MaxTLSSessions,
+
+		battery:        make(map[string]*batteryLog),
+		batteryMaxSize: cfg.MaxBatterySamples,
+
+		foreground:        make(map[string][]ForegroundSpan),
+		foregroundMaxSize: cfg.MaxForegroundSpans,
+
+		eventsMaxSize:   cfg.MaxDeviceEvents,
+		eventsRetention: cfg.DeviceEventRetention,
+	}
+	if cfg.RawMode == RawCompress {
+		s.raw = newRawBlocks()
 	}
+	return s
 }
 
-// SetOnChange registers a callback invoked when data changes.
-func (s *Store) SetOnChange(fn func()) {
+// ChangeKind says what a Change is about.
+type ChangeKind string
+
+const (
+	PacketAdded        ChangeKind = "packet_added"
+	ConnectionAdded    ChangeKind = "connection_added"
+	ConnectionUpdated  ChangeKind = "connection_updated"
+	DNSLookupAdded     ChangeKind = "dns_lookup_added"
+	HostnameBackfilled ChangeKind = "hostname_backfilled"
+)
+
+// Change is one modification of the store, passed to the SetOnChange
+// callback. The field matching Kind is set and holds a copy the callback
+// may keep.
+type Change struct {
+	Kind       ChangeKind
+	Packet     *capture.NetworkPacket
+	Connection *capture.Connection
+	DNSLookup  *capture.DNSLookup
+	Backfill   *Backfill
+}
+
+// Backfill describes a BackfillHostname call that patched entries.
+type Backfill struct {
+	Serial      string
+	IP          string
+	Hostname    string
+	Packets     int
+	Connections int
+}
+
+// SetOnChange registers a callback invoked after each change. It runs on
+// the writer's goroutine, so it must not block.
+func (s *Store) SetOnChange(fn func(Change)) {
 	s.mu.Lock()
 	s.onChange = fn
 	s.mu.Unlock()
@@ -70,46 +194,163 @@ func (s *Store) SetOnChange(fn func()) {
 
 // AddPacket adds a network packet to the ring buffer.
 func (s *Store) AddPacket(pkt capture.NetworkPacket) {
+	if s.rawMode == RawDrop {
+		pkt.Raw = ""
+	}
+
 	s.mu.Lock()
-	idx := s.pktHead % s.pktMaxSize
-	s.packets[idx] = pkt
+	s.addPacketLocked(pkt)
+	cb := s.onChange
+	s.mu.Unlock()
+
+	if cb != nil {
+		cb(Change{Kind: PacketAdded, Packet: &pkt})
+	}
+}
+
+func (s *Store) addPacketLocked(pkt capture.NetworkPacket) {
+	stored := pkt
+	pos := s.pktHead
+	idx := pos % s.pktMaxSize
+	if s.pktCount == s.pktMaxSize {
+		evicted := s.packetAt(pos - s.pktMaxSize)
+		s.pktIndex.removeAll(packetKeys(&evicted), pos-s.pktMaxSize)
+		s.pktWords.removeAll(packetWords(&evicted), pos-s.pktMaxSize)
+		s.rawBytes -= len(s.packets[idx].Raw)
+	}
+	if s.raw != nil {
+		stored.Raw = ""
+	}
+	s.packets[idx] = stored
+	s.pktIndex.addAll(packetKeys(&stored), pos)
+	s.pktWords.addAll(packetWords(&pkt), pos)
 	s.pktHead++
 	if s.pktCount < s.pktMaxSize {
 		s.pktCount++
 	}
+	if s.raw != nil {
+		s.raw.add(pos, pkt.Raw, s.pktHead-s.pktCount)
+	} else {
+		s.rawBytes += len(stored.Raw)
+	}
+}
+
+// AddConnection adds a connection to the store, or updates the stored
+// entry of an open connection between the same endpoints: its LastSeen,
+// state and traffic counters. An update older than the entry's LastSeen,
+// delivered late by a concurrent writer, is ignored. State changes are
+// appended to the entry's History.
+func (s *Store) AddConnection(conn capture.Connection) {
+	key := connKey(conn)
+
+	s.mu.Lock()
+	if existing := s.openConnectionLocked(key); existing != nil {
+		if !conn.LastSeen.IsZero() && conn.LastSeen.Before(existing.LastSeen) {
+			s.mu.Unlock()
+			return
+		}
+		existing.LastSeen = conn.LastSeen
+		setState(existing, conn.State, conn.LastSeen)
+		if conn.BytesSent != 0 || conn.BytesReceived != 0 {
+			existing.BytesSent = conn.BytesSent
+			existing.BytesReceived = conn.BytesReceived
+			existing.RTTMs = conn.RTTMs
+		}
+		updated := *existing
+		cb := s.onChange
+		s.mu.Unlock()
+
+		if cb != nil {
+			cb(Change{Kind: ConnectionUpdated, Connection: &updated})
+		}
+		return
+	}
+
+	added := s.insertConnectionLocked(conn)
 	cb := s.onChange
 	s.mu.Unlock()
 
 	if cb != nil {
-		cb()
+		cb(Change{Kind: ConnectionAdded, Connection: &added})
 	}
 }
 
-// AddConnection adds or updates a connection in the store.
-func (s *Store) AddConnection(conn capture.Connection) {
+// CloseConnection records that conn has closed: the stored entry takes its
+// final state, ClosedAt and DurationMs, or conn is stored if the entry was
+// evicted. Its endpoints are released, so a later connection between them
+// is stored as a new entry.
+func (s *Store) CloseConnection(conn capture.Connection) {
 	key := connKey(conn)
 
 	s.mu.Lock()
-	if existing, ok := s.connMap[key]; ok {
+	kind := ConnectionUpdated
+	if existing := s.openConnectionLocked(key); existing != nil && existing.ID == conn.ID {
 		existing.LastSeen = conn.LastSeen
-		existing.State = conn.State
-		s.mu.Unlock()
-		return
+		setState(existing, conn.State, conn.LastSeen)
+		existing.ClosedAt = conn.ClosedAt
+		existing.DurationMs = conn.DurationMs
+		conn = *existing
+	} else {
+		kind = ConnectionAdded
+		conn = s.insertConnectionLocked(conn)
 	}
+	delete(s.connMap, key)
+	cb := s.onChange
+	s.mu.Unlock()
+
+	if cb != nil {
+		cb(Change{Kind: kind, Connection: &conn})
+	}
+}
+
+// openConnectionLocked returns the stored entry of the open connection
+// with key, or nil.
+func (s *Store) openConnectionLocked(key string) *capture.Connection {
+	pos, ok := s.connMap[key]
+	if !ok {
+		return nil
+	}
+	return &s.connections[pos%s.connMaxSize]
+}
 
-	idx := s.connHead % s.connMaxSize
+// insertConnectionLocked stores conn as a new entry, open under its key,
+// and returns the stored copy. Evicting the oldest entry releases its key
+// if it was still open, so the key never points at a reused slot.
+func (s *Store) insertConnectionLocked(conn capture.Connection) capture.Connection {
+	if len(conn.History) == 0 {
+		setState(&conn, conn.State, conn.FirstSeen)
+	}
+	pos := s.connHead
+	idx := pos % s.connMaxSize
+	if s.connCount == s.connMaxSize {
+		evicted := &s.connections[idx]
+		s.connIndex.removeAll(connectionKeys(evicted), pos-s.connMaxSize)
+		s.connWords.removeAll(connectionWords(evicted), pos-s.connMaxSize)
+		if k := connKey(*evicted); s.connMap[k] == pos-s.connMaxSize {
+			delete(s.connMap, k)
+		}
+	}
 	s.connections[idx] = conn
-	s.connMap[key] = &s.connections[idx]
+	s.connIndex.addAll(connectionKeys(&conn), pos)
+	s.connWords.addAll(connectionWords(&conn), pos)
+	s.connMap[connKey(conn)] = pos
 	s.connHead++
 	if s.connCount < s.connMaxSize {
 		s.connCount++
 	}
-	cb := s.onChange
-	s.mu.Unlock()
+	return conn
+}
 
-	if cb != nil {
-		cb()
+// setState sets c's state, recording a change in its History, which keeps
+// the last capture.MaxStateHistory. The History is reallocated rather than
+// edited in place, so copies handed out earlier stay intact.
+func setState(c *capture.Connection, state capture.ConnState, at time.Time) {
+	if len(c.History) > 0 && c.State == state {
+		return
 	}
+	c.State = state
+	h := c.History[max(0, len(c.History)-capture.MaxStateHistory+1):len(c.History):len(c.History)]
+	c.History = append(h, capture.StateChange{State: state, At: at})
 }
 
 // GetRecentPackets returns the N most recent packets, newest first.
@@ -126,16 +367,24 @@ func (s *Store) GetRecentPackets(n int) []capture.NetworkPacket {
 
 	result := make([]capture.NetworkPacket, n)
 	for i := 0; i < n; i++ {
-		idx := (s.pktHead - 1 - i)
-		if idx < 0 {
-			idx += s.pktMaxSize
-		}
-		idx = idx % s.pktMaxSize
-		result[i] = s.packets[idx]
+		result[i] = s.packetAt(s.pktHead - 1 - i)
 	}
 	return result
 }
 
+// packetAt copies out the packet at ring position pos, with its Raw line.
+func (s *Store) packetAt(pos int) capture.NetworkPacket {
+	p := s.packets[pos%s.pktMaxSize]
+	if s.raw != nil && p.Serial != "" {
+		p.Raw = s.raw.get(pos)
+	}
+	return p
+}
+
+func (s *Store) connectionAt(pos int) capture.Connection {
+	return s.connections[pos%s.connMaxSize]
+}
+
 // GetRecentConnections returns the N most recent connections, newest first.
 func (s *Store) GetRecentConnections(n int) []capture.Connection {
 	s.mu.RLock()
@@ -160,42 +409,150 @@ func (s *Store) GetRecentConnections(n int) []capture.Connection {
 	return result
 }
 
-// GetPacketsBySerial returns recent packets for a specific device.
+// GetPacketsBySerial returns recent packets for a specific device, newest
+// first. It reads the serial index, so the cost follows n rather than the
+// size of the ring.
 func (s *Store) GetPacketsBySerial(serial string, n int) []capture.NetworkPacket {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return recentBySerial(s.pktIndex, s.packetAt, serial, n)
+}
 
-	var result []capture.NetworkPacket
-	for i := 0; i < s.pktCount && len(result) < n; i++ {
-		idx := (s.pktHead - 1 - i)
-		if idx < 0 {
-			idx += s.pktMaxSize
+// GetConnectionsBySerial returns connections for a specific device, newest
+// first.
+func (s *Store) GetConnectionsBySerial(serial string, n int) []capture.Connection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return recentBySerial(s.connIndex, s.connectionAt, serial, n)
+}
+
+// recentBySerial copies the newest n entries of serial out with at, walking
+// its posting list backwards.
+func recentBySerial[T any](ix index, at func(pos int) T, serial string, n int) []T {
+	list := ix["serial="+serial]
+	if len(list) == 0 || n <= 0 {
+		return nil
+	}
+	result := make([]T, 0, min(n, len(list)))
+	for i := len(list) - 1; i >= 0 && len(result) < n; i-- {
+		result = append(result, at(list[i]))
+	}
+	return result
+}
+
+// scanChunk is the number of entries copied per lock acquisition while
+// scanning, so long exports never hold the store lock across slow writes.
+const scanChunk = 512
+
+// Filter selects entries for scans. Zero-valued fields match everything.
+type Filter struct {
+	Serial string
+	// Serials, when non-empty, limits matches to these devices, e.g. the
+	// members of a device group.
+	Serials []string
+	From    time.Time
+	To      time.Time
+}
+
+func (f Filter) matchSerial(serial string) bool {
+	return (f.Serial == "" || serial == f.Serial) &&
+		(len(f.Serials) == 0 || slices.Contains(f.Serials, serial))
+}
+
+func (f Filter) matchPacket(p *capture.NetworkPacket) bool {
+	if !f.matchSerial(p.Serial) {
+		return false
+	}
+	if !f.From.IsZero() && p.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && p.Timestamp.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// matchConnection matches connections whose lifetime overlaps [From, To].
+func (f Filter) matchConnection(c *capture.Connection) bool {
+	if !f.matchSerial(c.Serial) {
+		return false
+	}
+	if !f.From.IsZero() && c.LastSeen.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && c.FirstSeen.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// ScanPackets calls fn for every stored packet matching f, oldest first.
+// Entries are copied out in small chunks so the store stays writable while
+// fn runs; packets evicted mid-scan are skipped. Scanning stops at the first
+// error returned by fn.
+func (s *Store) ScanPackets(f Filter, fn func(capture.NetworkPacket) error) error {
+	buf := make([]capture.NetworkPacket, 0, scanChunk)
+	cursor := -1
+
+	for {
+		buf = buf[:0]
+
+		s.mu.RLock()
+		oldest := s.pktHead - s.pktCount
+		if cursor < oldest {
+			cursor = oldest
+		}
+		for ; cursor < s.pktHead && len(buf) < scanChunk; cursor++ {
+			if f.matchPacket(&s.packets[cursor%s.pktMaxSize]) {
+				buf = append(buf, s.packetAt(cursor))
+			}
 		}
-		idx = idx % s.pktMaxSize
-		if s.packets[idx].Serial == serial {
-			result = append(result, s.packets[idx])
+		done := cursor >= s.pktHead
+		s.mu.RUnlock()
+
+		for _, p := range buf {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		if done {
+			return nil
 		}
 	}
-	return result
 }
 
-// GetConnectionsBySerial returns connections for a specific device.
-func (s *Store) GetConnectionsBySerial(serial string, n int) []capture.Connection {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// ScanConnections calls fn for every stored connection matching f, oldest
+// first, with the same chunked semantics as ScanPackets.
+func (s *Store) ScanConnections(f Filter, fn func(capture.Connection) error) error {
+	buf := make([]capture.Connection, 0, scanChunk)
+	cursor := -1
 
-	var result []capture.Connection
-	for i := 0; i < s.connCount && len(result) < n; i++ {
-		idx := (s.connHead - 1 - i)
-		if idx < 0 {
-			idx += s.connMaxSize
+	for {
+		buf = buf[:0]
+
+		s.mu.RLock()
+		oldest := s.connHead - s.connCount
+		if cursor < oldest {
+			cursor = oldest
 		}
-		idx = idx % s.connMaxSize
-		if s.connections[idx].Serial == serial {
-			result = append(result, s.connections[idx])
+		for ; cursor < s.connHead && len(buf) < scanChunk; cursor++ {
+			c := &s.connections[cursor%s.connMaxSize]
+			if f.matchConnection(c) {
+				buf = append(buf, *c)
+			}
+		}
+		done := cursor >= s.connHead
+		s.mu.RUnlock()
+
+		for _, c := range buf {
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+		if done {
+			return nil
 		}
 	}
-	return result
 }
 
 // PacketCount returns total stored packets.
@@ -214,32 +571,61 @@ func (s *Store) ConnectionCount() int {
 
 // StoreStats returns current store statistics.
 type StoreStats struct {
-	PacketCount    int `json:"packet_count"`
+	PacketCount     int `json:"packet_count"`
 	ConnectionCount int `json:"connection_count"`
-	PacketCapacity int `json:"packet_capacity"`
-	ConnCapacity   int `json:"conn_capacity"`
+	PacketCapacity  int `json:"packet_capacity"`
+	ConnCapacity    int `json:"conn_capacity"`
+	DNSLookupCount  int `json:"dns_lookup_count"`
+	TLSSessionCount int `json:"tls_session_count"`
+	// RawMode is how packets' Raw lines are kept, RawBytes the memory
+	// they take.
+	RawMode  string `json:"raw_mode"`
+	RawBytes int    `json:"raw_bytes"`
 }
 
 // Stats returns store statistics.
 func (s *Store) Stats() StoreStats {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	rawBytes := s.rawBytes
+	if s.raw != nil {
+		rawBytes = s.raw.size
+	}
 	return StoreStats{
 		PacketCount:     s.pktCount,
 		ConnectionCount: s.connCount,
 		PacketCapacity:  s.pktMaxSize,
 		ConnCapacity:    s.connMaxSize,
+		DNSLookupCount:  s.dnsCount,
+		TLSSessionCount: s.tlsCount,
+		RawMode:         s.rawMode.String(),
+		RawBytes:        rawBytes,
 	}
 }
 
-// Clear removes all data from the store.
+// Clear removes all data from the store but the device event history,
+// which is an audit trail rather than captured data.
 func (s *Store) Clear() {
 	s.mu.Lock()
 	s.pktHead = 0
 	s.pktCount = 0
 	s.connHead = 0
 	s.connCount = 0
-	s.connMap = make(map[string]*capture.Connection)
+	s.connMap = make(map[string]int)
+	s.pktIndex = make(index)
+	s.connIndex = make(index)
+	s.pktWords = make(index)
+	s.connWords = make(index)
+	s.rawBytes = 0
+	if s.raw != nil {
+		s.raw = newRawBlocks()
+	}
+	s.dnsHead = 0
+	s.dnsCount = 0
+	s.tlsHead = 0
+	s.tlsCount = 0
+	s.battery = make(map[string]*batteryLog)
+	s.foreground = make(map[string][]ForegroundSpan)
 	s.mu.Unlock()
 }
 
@@ -248,13 +634,17 @@ func (s *Store) ClearDevice(serial string) {
 	// For ring buffer, we can't efficiently remove entries.
 	// Instead, mark them as empty by zeroing the serial.
 	s.mu.Lock()
-	for i := range s.packets[:s.pktCount] {
-		if s.packets[i].Serial == serial {
-			s.packets[i] = capture.NetworkPacket{}
-		}
+	// removeAll edits the posting list being walked, so walk a copy.
+	for _, pos := range slices.Clone(s.pktIndex["serial="+serial]) {
+		p := &s.packets[pos%s.pktMaxSize]
+		s.pktIndex.removeAll(packetKeys(p), pos)
+		full := s.packetAt(pos)
+		s.pktWords.removeAll(packetWords(&full), pos)
+		s.rawBytes -= len(p.Raw)
+		*p = capture.NetworkPacket{}
 	}
-	for key, conn := range s.connMap {
-		if conn.Serial == serial {
+	for key, pos := range s.connMap {
+		if s.connections[pos%s.connMaxSize].Serial == serial {
 			delete(s.connMap, key)
 		}
 	}
@@ -286,6 +676,3 @@ func uitoa(u uint) string {
 	}
 	return string(buf[i:])
 }
-
-// Unused import guard.
-var _ = time.Now
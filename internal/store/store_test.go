@@ -133,19 +133,340 @@ func TestStore_Stats(t *testing.T) {
 func TestStore_OnChange(t *testing.T) {
 	s := New(Config{MaxPackets: 100, MaxConnections: 100})
 
-	called := 0
-	s.SetOnChange(func() { called++ })
+	var changes []Change
+	s.SetOnChange(func(c Change) { changes = append(changes, c) })
 
 	s.AddPacket(capture.NetworkPacket{ID: "p1", Serial: "dev1"})
-	s.AddConnection(capture.Connection{
+	conn := capture.Connection{
 		ID: "c1", Serial: "dev1",
 		LocalIP: "1.1.1.1", LocalPort: 1, RemoteIP: "2.2.2.2", RemotePort: 2,
+		State: capture.ConnSynSent,
+	}
+	s.AddConnection(conn)
+	conn.State = capture.ConnEstablished
+	s.AddConnection(conn)
+	s.BackfillHostname("dev1", "2.2.2.2", "example.com", 0)
+
+	want := []ChangeKind{PacketAdded, ConnectionAdded, ConnectionUpdated, HostnameBackfilled}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d", len(changes), len(want))
+	}
+	for i, k := range want {
+		if changes[i].Kind != k {
+			t.Errorf("change %d: kind %s, want %s", i, changes[i].Kind, k)
+		}
+	}
+	if p := changes[0].Packet; p == nil || p.ID != "p1" {
+		t.Errorf("packet change: %+v", p)
+	}
+	if c := changes[2].Connection; c == nil || c.State != capture.ConnEstablished {
+		t.Errorf("update change: %+v", c)
+	}
+	if b := changes[3].Backfill; b == nil || b.Connections != 1 || b.Packets != 0 {
+		t.Errorf("backfill change: %+v", b)
+	}
+}
+
+func TestStore_ScanPacketsFilter(t *testing.T) {
+	s := New(Config{MaxPackets: 1000, MaxConnections: 10})
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 700; i++ {
+		serial := "dev1"
+		if i%2 == 1 {
+			serial = "dev2"
+		}
+		s.AddPacket(capture.NetworkPacket{
+			ID:        "p" + itoa(i),
+			Serial:    serial,
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	var ids []string
+	err := s.ScanPackets(Filter{
+		Serial: "dev1",
+		From:   base.Add(100 * time.Second),
+		To:     base.Add(699 * time.Second),
+	}, func(p capture.NetworkPacket) error {
+		ids = append(ids, p.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Even indices 100..698 inclusive.
+	if len(ids) != 300 {
+		t.Fatalf("expected 300 packets, got %d", len(ids))
+	}
+	if ids[0] != "p100" || ids[len(ids)-1] != "p698" {
+		t.Errorf("unexpected order: first=%s last=%s", ids[0], ids[len(ids)-1])
+	}
+}
+
+func TestStore_ScanPacketsAfterWrap(t *testing.T) {
+	s := New(Config{MaxPackets: 5, MaxConnections: 5})
+	for i := 0; i < 8; i++ {
+		s.AddPacket(capture.NetworkPacket{ID: "p" + itoa(i)})
+	}
+
+	var ids []string
+	s.ScanPackets(Filter{}, func(p capture.NetworkPacket) error {
+		ids = append(ids, p.ID)
+		return nil
+	})
+	want := []string{"p3", "p4", "p5", "p6", "p7"}
+	if len(ids) != len(want) {
+		t.Fatalf("got %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("got %v, want %v", ids, want)
+		}
+	}
+}
+
+func TestStore_ScanConnectionsOverlap(t *testing.T) {
+	s := New(Config{MaxPackets: 10, MaxConnections: 10})
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	s.AddConnection(capture.Connection{
+		ID: "old", LocalIP: "10.0.0.1", LocalPort: 1, RemoteIP: "1.1.1.1", RemotePort: 443,
+		FirstSeen: base, LastSeen: base.Add(time.Minute),
+	})
+	s.AddConnection(capture.Connection{
+		ID: "new", LocalIP: "10.0.0.1", LocalPort: 2, RemoteIP: "1.1.1.1", RemotePort: 443,
+		FirstSeen: base.Add(time.Hour), LastSeen: base.Add(2 * time.Hour),
+	})
+
+	var ids []string
+	s.ScanConnections(Filter{From: base.Add(30 * time.Second), To: base.Add(30 * time.Minute)},
+		func(c capture.Connection) error {
+			ids = append(ids, c.ID)
+			return nil
+		})
+	if len(ids) != 1 || ids[0] != "old" {
+		t.Errorf("expected [old], got %v", ids)
+	}
+}
+
+func BenchmarkStore_AddPacket(b *testing.B) {
+	s := New(Config{MaxPackets: DefaultMaxPackets, MaxConnections: DefaultMaxConns})
+	s.SetOnChange(func(Change) {})
+	pkt := capture.NetworkPacket{
+		ID: "emulator-5554-1", Serial: "emulator-5554", Timestamp: time.Now(),
+		SrcIP: "10.0.2.15", SrcPort: 43512, DstIP: "142.250.185.78", DstPort: 443,
+		Protocol: capture.ProtoTCP, Length: 517, Flags: "P.",
+		Raw: "12:34:56.789012 IP 10.0.2.15.43512 > 142.250.185.78.443: Flags [P.], seq 1:518, ack 1, win 502, length 517",
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.AddPacket(pkt)
+	}
+}
+
+func BenchmarkStore_AddPacketParallel(b *testing.B) {
+	s := New(Config{MaxPackets: DefaultMaxPackets, MaxConnections: DefaultMaxConns})
+	pkt := capture.NetworkPacket{Serial: "emulator-5554", Length: 517}
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.AddPacket(pkt)
+		}
+	})
+}
+
+// scanBySerial is the linear scan GetPacketsBySerial replaced, kept as the
+// benchmark baseline.
+func scanBySerial(s *Store, serial string, n int) []capture.NetworkPacket {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []capture.NetworkPacket
+	for i := 0; i < s.pktCount && len(result) < n; i++ {
+		if p := &s.packets[(s.pktHead-1-i)%s.pktMaxSize]; p.Serial == serial {
+			result = append(result, *p)
+		}
+	}
+	return result
+}
+
+func TestStore_GetPacketsBySerialAfterWrap(t *testing.T) {
+	s := New(Config{MaxPackets: 50})
+	for i := 0; i < 173; i++ {
+		s.AddPacket(capture.NetworkPacket{ID: "pkt-" + itoa(i), Serial: "dev" + itoa(i%3)})
+	}
+	s.ClearDevice("dev2")
+
+	for _, serial := range []string{"dev0", "dev1", "dev2"} {
+		for _, n := range []int{1, 5, 100} {
+			got := s.GetPacketsBySerial(serial, n)
+			want := scanBySerial(s, serial, n)
+			if len(got) != len(want) {
+				t.Fatalf("%s n=%d: got %d packets, want %d", serial, n, len(got), len(want))
+			}
+			for i := range want {
+				if got[i].ID != want[i].ID {
+					t.Errorf("%s n=%d [%d]: got %s, want %s", serial, n, i, got[i].ID, want[i].ID)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkStore_GetPacketsBySerial reads the 100 newest packets of a
+// device that sent one in every 100 of a full 50k ring.
+func BenchmarkStore_GetPacketsBySerial(b *testing.B) {
+	s := New(Config{MaxPackets: DefaultMaxPackets})
+	for i := 0; i < DefaultMaxPackets*2; i++ {
+		s.AddPacket(capture.NetworkPacket{Serial: "emulator-" + itoa(5554+i%100), Length: 517})
+	}
+
+	b.Run("index", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s.GetPacketsBySerial("emulator-5600", 100)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			scanBySerial(s, "emulator-5600", 100)
+		}
 	})
+}
+
+func TestStore_DNSLookups(t *testing.T) {
+	s := New(Config{MaxDNSLookups: 3})
+
+	for i := 0; i < 5; i++ {
+		serial := "dev1"
+		if i%2 == 1 {
+			serial = "dev2"
+		}
+		s.AddDNSLookup(capture.DNSLookup{ID: "dns-" + itoa(i), Serial: serial})
+	}
+
+	got := s.GetDNSLookupsBySerial("dev1", 10)
+	if len(got) != 2 || got[0].ID != "dns-4" || got[1].ID != "dns-2" {
+		t.Errorf("dev1 lookups: %+v", got)
+	}
+	if all := s.GetDNSLookupsBySerial("", 10); len(all) != 3 {
+		t.Errorf("expected ring to hold 3 lookups, got %d", len(all))
+	}
+
+	s.Clear()
+	if got := s.GetDNSLookupsBySerial("", 10); len(got) != 0 {
+		t.Errorf("expected no lookups after Clear, got %d", len(got))
+	}
+}
+
+func TestStore_BackfillHostname(t *testing.T) {
+	s := New(Config{MaxPackets: 10, MaxConnections: 10})
+
+	s.AddPacket(capture.NetworkPacket{ID: "out", Serial: "dev1", SrcIP: "10.0.0.2", DstIP: "1.2.3.4"})
+	s.AddPacket(capture.NetworkPacket{ID: "in", Serial: "dev1", SrcIP: "1.2.3.4", DstIP: "10.0.0.2"})
+	s.AddPacket(capture.NetworkPacket{ID: "named", Serial: "dev1", DstIP: "1.2.3.4", HTTPHost: "keep.example.com"})
+	s.AddPacket(capture.NetworkPacket{ID: "other", Serial: "dev2", DstIP: "1.2.3.4"})
+	s.AddConnection(capture.Connection{Serial: "dev1", LocalIP: "10.0.0.2", LocalPort: 1, RemoteIP: "1.2.3.4", RemotePort: 443})
+	s.AddConnection(capture.Connection{Serial: "dev1", LocalIP: "10.0.0.2", LocalPort: 2, RemoteIP: "5.6.7.8", RemotePort: 443})
 
-	if called != 2 {
-		t.Errorf("onChange called %d times, want 2", called)
+	pkts, conns := s.BackfillHostname("dev1", "1.2.3.4", "api.example.com", 0)
+	if pkts != 2 || conns != 1 {
+		t.Fatalf("patched %d packets, %d connections; want 2, 1", pkts, conns)
+	}
+
+	hosts := map[string]string{}
+	for _, p := range s.GetRecentPackets(10) {
+		hosts[p.ID] = p.HTTPHost
+	}
+	want := map[string]string{"out": "api.example.com", "in": "api.example.com", "named": "keep.example.com", "other": ""}
+	for id, h := range want {
+		if hosts[id] != h {
+			t.Errorf("packet %s: host %q, want %q", id, hosts[id], h)
+		}
+	}
+	if c := s.GetConnectionsBySerial("dev1", 10); c[1].Hostname != "api.example.com" || c[0].Hostname != "" {
+		t.Errorf("connections: %+v", c)
+	}
+
+	// Already resolved entries are not patched twice.
+	if pkts, conns := s.BackfillHostname("dev1", "1.2.3.4", "api.example.com", 0); pkts+conns != 0 {
+		t.Errorf("second backfill patched %d entries", pkts+conns)
+	}
+}
+
+func TestStore_ConnectionWraparound(t *testing.T) {
+	s := New(Config{MaxPackets: 10, MaxConnections: 2})
+	conn := func(port uint16, state capture.ConnState) capture.Connection {
+		return capture.Connection{Serial: "dev1", LocalIP: "10.0.0.2", LocalPort: port,
+			RemoteIP: "1.2.3.4", RemotePort: 443, State: state}
+	}
+	s.AddConnection(conn(1, capture.ConnEstablished))
+	s.AddConnection(conn(2, capture.ConnEstablished))
+	s.AddConnection(conn(3, capture.ConnEstablished)) // evicts port 1
+
+	// The evicted connection's key must not point at the reused slot.
+	s.AddConnection(conn(1, capture.ConnTimeWait))
+	conns := s.GetRecentConnections(10)
+	if len(conns) != 2 || conns[0].LocalPort != 1 || conns[1].LocalPort != 3 {
+		t.Fatalf("got %+v", conns)
+	}
+	if conns[1].State != capture.ConnEstablished {
+		t.Errorf("port 3 overwritten by an update of port 1: %s", conns[1].State)
 	}
 }
 
-// Ensure unused import.
-var _ = time.Now
+func TestStore_ConnectionStateHistory(t *testing.T) {
+	s := New(Config{MaxPackets: 10, MaxConnections: 10})
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := capture.Connection{ID: "c1", Serial: "dev1", LocalIP: "10.0.0.2", LocalPort: 1,
+		RemoteIP: "1.2.3.4", RemotePort: 443, State: capture.ConnSynSent, FirstSeen: base, LastSeen: base}
+	s.AddConnection(c)
+	c.State, c.LastSeen = capture.ConnEstablished, base.Add(time.Second)
+	s.AddConnection(c)
+	s.AddConnection(c) // no change
+	first := s.GetRecentConnections(1)[0]
+
+	// A late update from before LastSeen is ignored.
+	stale := c
+	stale.State, stale.LastSeen = capture.ConnSynSent, base
+	s.AddConnection(stale)
+
+	closed := base.Add(2 * time.Second)
+	c.State, c.LastSeen, c.ClosedAt = capture.ConnTimeWait, closed, &closed
+	s.CloseConnection(c)
+
+	got := s.GetRecentConnections(1)[0]
+	want := []capture.StateChange{
+		{State: capture.ConnSynSent, At: base},
+		{State: capture.ConnEstablished, At: base.Add(time.Second)},
+		{State: capture.ConnTimeWait, At: closed},
+	}
+	if len(got.History) != len(want) {
+		t.Fatalf("history %+v, want %+v", got.History, want)
+	}
+	for i := range want {
+		if got.History[i] != want[i] {
+			t.Errorf("history[%d] = %+v, want %+v", i, got.History[i], want[i])
+		}
+	}
+	if len(first.History) != 2 {
+		t.Errorf("an earlier copy changed: %+v", first.History)
+	}
+
+	// The history is bounded.
+	c = capture.Connection{Serial: "dev1", LocalIP: "10.0.0.2", LocalPort: 2, RemoteIP: "1.2.3.4", RemotePort: 443}
+	for i := range 2 * capture.MaxStateHistory {
+		c.State = capture.ConnEstablished
+		if i%2 == 1 {
+			c.State = capture.ConnCloseWait
+		}
+		s.AddConnection(c)
+	}
+	if h := s.GetRecentConnections(1)[0].History; len(h) != capture.MaxStateHistory || h[len(h)-1].State != capture.ConnCloseWait {
+		t.Errorf("bounded history: %d entries, last %+v", len(h), h[len(h)-1])
+	}
+}
@@ -0,0 +1,51 @@
+package store
+
+import "github.com/imcanugur/go-adb-monitor/internal/capture"
+
+// AddTLSSession adds an observed TLS handshake to its ring buffer.
+func (s *Store) AddTLSSession(t capture.TLSSession) {
+	s.mu.Lock()
+	s.addTLSSessionLocked(t)
+	s.mu.Unlock()
+}
+
+func (s *Store) addTLSSessionLocked(t capture.TLSSession) {
+	s.tlsSessions[s.tlsHead%s.tlsMaxSize] = t
+	s.tlsHead++
+	if s.tlsCount < s.tlsMaxSize {
+		s.tlsCount++
+	}
+}
+
+// TLSQuery selects stored TLS handshakes.
+type TLSQuery struct {
+	Serial string
+	// Server matches the server IP or SNI exactly.
+	Server string
+	// Deprecated keeps only handshakes below TLS 1.2.
+	Deprecated bool
+	Limit      int
+}
+
+// TLSSessions returns up to q.Limit recent TLS handshakes matching q,
+// newest first. An empty serial matches every device.
+func (s *Store) TLSSessions(q TLSQuery) []capture.TLSSession {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []capture.TLSSession{}
+	for i := 0; i < s.tlsCount && len(result) < q.Limit; i++ {
+		t := &s.tlsSessions[(s.tlsHead-1-i)%s.tlsMaxSize]
+		if q.Serial != "" && t.Serial != q.Serial {
+			continue
+		}
+		if q.Server != "" && t.ServerIP != q.Server && t.SNI != q.Server {
+			continue
+		}
+		if q.Deprecated && !t.Deprecated {
+			continue
+		}
+		result = append(result, *t)
+	}
+	return result
+}
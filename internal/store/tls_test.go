@@ -0,0 +1,30 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+func TestTLSSessions(t *testing.T) {
+	s := New(Config{MaxTLSSessions: 3})
+	s.AddTLSSession(capture.TLSSession{Serial: "a", ServerIP: "1.1.1.1", Version: "TLS 1.3"})
+	s.AddTLSSession(capture.TLSSession{Serial: "b", ServerIP: "2.2.2.2", Version: "TLS 1.2"})
+	s.AddTLSSession(capture.TLSSession{Serial: "a", ServerIP: "3.3.3.3", SNI: "old.example.com", Version: "TLS 1.0", Deprecated: true})
+	s.AddTLSSession(capture.TLSSession{Serial: "a", ServerIP: "4.4.4.4", Version: "TLS 1.3"})
+
+	got := s.TLSSessions(TLSQuery{Serial: "a", Limit: 10})
+	if len(got) != 2 || got[0].ServerIP != "4.4.4.4" || got[1].ServerIP != "3.3.3.3" {
+		t.Errorf("newest first, oldest evicted: %+v", got)
+	}
+	if got := s.TLSSessions(TLSQuery{Server: "old.example.com", Deprecated: true, Limit: 10}); len(got) != 1 {
+		t.Errorf("by SNI: %+v", got)
+	}
+	if got := s.TLSSessions(TLSQuery{Limit: 1}); len(got) != 1 {
+		t.Errorf("limit: %+v", got)
+	}
+	s.Clear()
+	if got := s.TLSSessions(TLSQuery{Limit: 10}); len(got) != 0 {
+		t.Errorf("after Clear: %+v", got)
+	}
+}
@@ -0,0 +1,270 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+// DefaultTopN is the number of hosts and apps kept in a traffic report.
+const DefaultTopN = 10
+
+// rateWindows are the rolling windows reported as requests per minute.
+var rateWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// TrafficQuery selects what TrafficStats aggregates.
+type TrafficQuery struct {
+	// Serial limits the report to one device. Empty means all devices.
+	Serial string
+	// Window is how far back from Now to aggregate.
+	Window time.Duration
+	// Now is the end of the window; zero means time.Now().
+	Now time.Time
+	// TopN caps the host and app lists; zero means DefaultTopN.
+	TopN int
+}
+
+// TrafficCounts are the counters kept for every aggregation group.
+type TrafficCounts struct {
+	Packets     int64 `json:"packets"`
+	Bytes       int64 `json:"bytes"`
+	Requests    int64 `json:"requests"`
+	Connections int   `json:"connections"`
+}
+
+// TrafficGroup is the traffic attributed to one device, host or app.
+type TrafficGroup struct {
+	Key string `json:"key"`
+	TrafficCounts
+}
+
+// RequestRate is the average HTTP request rate over a rolling window.
+type RequestRate struct {
+	Window    string  `json:"window"`
+	PerMinute float64 `json:"per_minute"`
+}
+
+// TrafficBucket holds one minute of the timeline.
+type TrafficBucket struct {
+	Start    time.Time `json:"start"`
+	Packets  int64     `json:"packets"`
+	Bytes    int64     `json:"bytes"`
+	Requests int64     `json:"requests"`
+	// Foreground is the app in the foreground for most of the minute, in
+	// single-device reports.
+	Foreground string `json:"foreground,omitempty"`
+}
+
+// TrafficStats is an aggregated view of the store over a time window.
+type TrafficStats struct {
+	Serial      string          `json:"serial,omitempty"`
+	Window      string          `json:"window"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Totals      TrafficCounts   `json:"totals"`
+	Devices     []TrafficGroup  `json:"devices"`
+	Hosts       []TrafficGroup  `json:"hosts"`
+	Apps        []TrafficGroup  `json:"apps"`
+	Rates       []RequestRate   `json:"rates"`
+	Timeline    []TrafficBucket `json:"timeline"`
+}
+
+// TrafficStats aggregates packets and connections seen within q.Window into
+// per-device, per-host and per-app counters, request rates and a per-minute
+// timeline. Packets are attributed to an app and hostname through the
+// connection sharing their local port.
+func (s *Store) TrafficStats(q TrafficQuery) TrafficStats {
+	if q.Now.IsZero() {
+		q.Now = time.Now()
+	}
+	if q.TopN <= 0 {
+		q.TopN = DefaultTopN
+	}
+	from := q.Now.Add(-q.Window)
+	// Rate windows may reach further back than the report window.
+	scanFrom := from
+	if longest := q.Now.Add(-rateWindows[len(rateWindows)-1]); longest.Before(scanFrom) {
+		scanFrom = longest
+	}
+
+	agg := newTrafficAgg()
+
+	// Connections first, so packets can be attributed to apps and hosts.
+	s.ScanConnections(Filter{Serial: q.Serial, From: from, To: q.Now}, func(c capture.Connection) error {
+		if c.Serial == "" {
+			return nil
+		}
+		agg.addConnection(c)
+		return nil
+	})
+
+	requests := make([]int64, len(rateWindows))
+	start := from.Truncate(time.Minute)
+	timeline := make([]TrafficBucket, int(q.Now.Sub(start)/time.Minute)+1)
+	for i := range timeline {
+		timeline[i].Start = start.Add(time.Duration(i) * time.Minute)
+	}
+
+	s.ScanPackets(Filter{Serial: q.Serial, From: scanFrom, To: q.Now}, func(p capture.NetworkPacket) error {
+		if p.Serial == "" {
+			return nil
+		}
+		isRequest := p.HTTPMethod != ""
+		if isRequest {
+			age := q.Now.Sub(p.Timestamp)
+			for i, w := range rateWindows {
+				if age <= w {
+					requests[i]++
+				}
+			}
+		}
+		if p.Timestamp.Before(from) {
+			return nil
+		}
+		agg.addPacket(p, isRequest)
+
+		b := &timeline[int(p.Timestamp.Sub(start)/time.Minute)]
+		b.Packets++
+		b.Bytes += int64(p.Length)
+		if isRequest {
+			b.Requests++
+		}
+		return nil
+	})
+
+	if q.Serial != "" {
+		spans := s.foregroundSpans(q.Serial, start, q.Now)
+		for i := range timeline {
+			b := &timeline[i]
+			b.Foreground = dominantForeground(spans, b.Start, b.Start.Add(time.Minute))
+		}
+	}
+
+	rates := make([]RequestRate, len(rateWindows))
+	for i, w := range rateWindows {
+		rates[i] = RequestRate{Window: w.String(), PerMinute: float64(requests[i]) / w.Minutes()}
+	}
+
+	return TrafficStats{
+		Serial:      q.Serial,
+		Window:      q.Window.String(),
+		GeneratedAt: q.Now,
+		Totals:      agg.totals,
+		Devices:     sortGroups(agg.devices, 0),
+		Hosts:       sortGroups(agg.hosts, q.TopN),
+		Apps:        sortGroups(agg.apps, q.TopN),
+		Rates:       rates,
+		Timeline:    timeline,
+	}
+}
+
+// trafficAgg accumulates counters while scanning.
+type trafficAgg struct {
+	totals  TrafficCounts
+	devices map[string]*TrafficCounts
+	hosts   map[string]*TrafficCounts
+	apps    map[string]*TrafficCounts
+
+	// ports maps "serial:localPort" to the connection using it.
+	ports map[string]capture.Connection
+	// names maps remote IPs to resolved hostnames.
+	names map[string]string
+}
+
+func newTrafficAgg() *trafficAgg {
+	return &trafficAgg{
+		devices: make(map[string]*TrafficCounts),
+		hosts:   make(map[string]*TrafficCounts),
+		apps:    make(map[string]*TrafficCounts),
+		ports:   make(map[string]capture.Connection),
+		names:   make(map[string]string),
+	}
+}
+
+func (a *trafficAgg) addConnection(c capture.Connection) {
+	a.ports[c.Serial+":"+itoa(int(c.LocalPort))] = c
+	if c.Hostname != "" {
+		a.names[c.RemoteIP] = c.Hostname
+	}
+
+	a.totals.Connections++
+	counts(a.devices, c.Serial).Connections++
+	counts(a.hosts, hostKey(c.Hostname, c.RemoteIP)).Connections++
+	if c.AppName != "" {
+		counts(a.apps, c.AppName).Connections++
+	}
+}
+
+func (a *trafficAgg) addPacket(p capture.NetworkPacket, isRequest bool) {
+	// Work out which side is the device: a known local port wins, otherwise
+	// assume the packet is outbound.
+	remoteIP := p.DstIP
+	conn, ok := a.ports[p.Serial+":"+itoa(int(p.SrcPort))]
+	if !ok {
+		if conn, ok = a.ports[p.Serial+":"+itoa(int(p.DstPort))]; ok {
+			remoteIP = p.SrcIP
+		}
+	}
+
+	host := p.HTTPHost
+	if host == "" {
+		host = hostKey(a.names[remoteIP], remoteIP)
+	}
+
+	groups := []*TrafficCounts{&a.totals, counts(a.devices, p.Serial), counts(a.hosts, host)}
+	if ok && conn.AppName != "" {
+		groups = append(groups, counts(a.apps, conn.AppName))
+	}
+	for _, g := range groups {
+		g.Packets++
+		g.Bytes += int64(p.Length)
+		if isRequest {
+			g.Requests++
+		}
+	}
+}
+
+func hostKey(hostname, ip string) string {
+	if hostname != "" {
+		return hostname
+	}
+	return ip
+}
+
+func counts(m map[string]*TrafficCounts, key string) *TrafficCounts {
+	c, ok := m[key]
+	if !ok {
+		c = &TrafficCounts{}
+		m[key] = c
+	}
+	return c
+}
+
+// sortGroups orders groups by bytes, then requests, then connections, and
+// keeps at most n of them (all when n is zero).
+func sortGroups(m map[string]*TrafficCounts, n int) []TrafficGroup {
+	groups := make([]TrafficGroup, 0, len(m))
+	for k, c := range m {
+		if k == "" {
+			continue
+		}
+		groups = append(groups, TrafficGroup{Key: k, TrafficCounts: *c})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		if a.Connections != b.Connections {
+			return a.Connections > b.Connections
+		}
+		return a.Key < b.Key
+	})
+	if n > 0 && len(groups) > n {
+		groups = groups[:n]
+	}
+	return groups
+}
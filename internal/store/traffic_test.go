@@ -0,0 +1,93 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+)
+
+func TestStore_TrafficStats(t *testing.T) {
+	s := New(Config{MaxPackets: 100, MaxConnections: 100})
+	now := time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC)
+
+	s.AddConnection(capture.Connection{
+		Serial: "dev1", LocalIP: "10.0.0.2", LocalPort: 40000,
+		RemoteIP: "142.250.1.1", RemotePort: 443,
+		Hostname: "google.com", AppName: "com.android.chrome",
+		FirstSeen: now.Add(-3 * time.Minute), LastSeen: now,
+	})
+
+	add := func(serial string, age time.Duration, src, dst uint16, length int, method string) {
+		p := capture.NetworkPacket{
+			Serial: serial, Timestamp: now.Add(-age),
+			SrcIP: "10.0.0.2", SrcPort: src, DstIP: "142.250.1.1", DstPort: dst,
+			Length: length, HTTPMethod: method,
+		}
+		if src == 443 {
+			p.SrcIP, p.DstIP = p.DstIP, p.SrcIP
+		}
+		s.AddPacket(p)
+	}
+	add("dev1", 30*time.Second, 40000, 443, 100, "GET")
+	add("dev1", 90*time.Second, 443, 40000, 1400, "")
+	add("dev2", 10*time.Second, 50000, 443, 60, "POST")
+	add("dev1", 20*time.Minute, 40000, 443, 999, "GET") // outside every window
+
+	st := s.TrafficStats(TrafficQuery{Window: 5 * time.Minute, Now: now})
+
+	if st.Totals.Packets != 3 || st.Totals.Bytes != 1560 || st.Totals.Requests != 2 {
+		t.Errorf("totals: %+v", st.Totals)
+	}
+	if st.Totals.Connections != 1 {
+		t.Errorf("connections: got %d, want 1", st.Totals.Connections)
+	}
+
+	if len(st.Devices) != 2 || st.Devices[0].Key != "dev1" || st.Devices[0].Bytes != 1500 {
+		t.Errorf("devices: %+v", st.Devices)
+	}
+
+	// Packets resolve to the connection's hostname whichever direction they
+	// travel, and dev2 reuses the name learned for the same remote IP.
+	if len(st.Hosts) != 1 || st.Hosts[0].Key != "google.com" || st.Hosts[0].Packets != 3 {
+		t.Errorf("hosts: %+v", st.Hosts)
+	}
+	if len(st.Apps) != 1 || st.Apps[0].Key != "com.android.chrome" || st.Apps[0].Bytes != 1500 {
+		t.Errorf("apps: %+v", st.Apps)
+	}
+
+	wantRates := map[string]float64{"1m0s": 2, "5m0s": 0.4, "15m0s": 2.0 / 15}
+	for _, r := range st.Rates {
+		if want := wantRates[r.Window]; r.PerMinute != want {
+			t.Errorf("rate %s: got %v, want %v", r.Window, r.PerMinute, want)
+		}
+	}
+
+	var timelineBytes int64
+	for _, b := range st.Timeline {
+		timelineBytes += b.Bytes
+	}
+	if len(st.Timeline) != 6 || timelineBytes != st.Totals.Bytes {
+		t.Errorf("timeline: %d buckets, %d bytes", len(st.Timeline), timelineBytes)
+	}
+}
+
+func TestStore_TrafficStatsSerialAndTopN(t *testing.T) {
+	s := New(Config{MaxPackets: 100, MaxConnections: 100})
+	now := time.Now()
+
+	for i, host := range []string{"a.com", "b.com", "c.com"} {
+		s.AddPacket(capture.NetworkPacket{
+			Serial: "dev1", Timestamp: now, HTTPHost: host, Length: 100 * (i + 1),
+		})
+	}
+	s.AddPacket(capture.NetworkPacket{Serial: "dev2", Timestamp: now, HTTPHost: "z.com", Length: 5000})
+
+	st := s.TrafficStats(TrafficQuery{Serial: "dev1", Window: time.Minute, Now: now, TopN: 2})
+	if len(st.Hosts) != 2 || st.Hosts[0].Key != "c.com" || st.Hosts[1].Key != "b.com" {
+		t.Errorf("hosts: %+v", st.Hosts)
+	}
+	if len(st.Devices) != 1 || st.Devices[0].Key != "dev1" {
+		t.Errorf("devices: %+v", st.Devices)
+	}
+}
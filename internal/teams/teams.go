@@ -0,0 +1,170 @@
+// Package teams assigns the devices of a shared lab to teams and gives each
+// team its own API tokens, so a team sees and controls only its devices.
+// The assignment is read from a JSON file at startup:
+//
+//	{"teams": [
+//	  {"name": "payments", "tokens": ["s3cret"], "devices": ["R58M123", "emulator-5554"]},
+//	  {"name": "maps", "tokens": ["0ther"], "devices": ["192.168.1.20:5555"]}
+//	]}
+package teams
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrInvalid indicates a team file failed validation.
+var ErrInvalid = errors.New("invalid teams")
+
+// Team is one team of the file.
+type Team struct {
+	Name string `json:"name"`
+	// Tokens are the bearer tokens of the team's members.
+	Tokens []string `json:"tokens"`
+	// Devices are the serials the team owns.
+	Devices []string `json:"devices"`
+}
+
+type file struct {
+	Teams []Team `json:"teams"`
+}
+
+// Teams maps tokens and device serials to teams. It is read-only once
+// built and safe for concurrent use. A nil *Teams has no teams.
+type Teams struct {
+	tokens []tokenTeam
+	owner  map[string]string // serial -> team
+	names  []string
+}
+
+type tokenTeam struct {
+	token, team string
+}
+
+// Load reads the teams kept at path. An empty path means no teams.
+func Load(path string) (*Teams, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read teams: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse teams %s: %w", path, err)
+	}
+	return New(f.Teams)
+}
+
+// New builds the mapping of teams. Names must be unique, and no token or
+// device may belong to two teams.
+func New(list []Team) (*Teams, error) {
+	t := &Teams{owner: make(map[string]string)}
+	seen := make(map[string]bool)
+	tokens := make(map[string]string)
+	for _, team := range list {
+		name := strings.TrimSpace(team.Name)
+		if name == "" {
+			return nil, fmt.Errorf("%w: team without a name", ErrInvalid)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: team %q listed twice", ErrInvalid, name)
+		}
+		seen[name] = true
+		t.names = append(t.names, name)
+
+		for _, tok := range team.Tokens {
+			tok = strings.TrimSpace(tok)
+			if tok == "" {
+				return nil, fmt.Errorf("%w: team %q has an empty token", ErrInvalid, name)
+			}
+			if other, ok := tokens[tok]; ok {
+				return nil, fmt.Errorf("%w: a token of team %q is also a token of team %q", ErrInvalid, name, other)
+			}
+			tokens[tok] = name
+			t.tokens = append(t.tokens, tokenTeam{token: tok, team: name})
+		}
+		for _, serial := range team.Devices {
+			serial = strings.TrimSpace(serial)
+			if serial == "" {
+				continue
+			}
+			if other, ok := t.owner[serial]; ok && other != name {
+				return nil, fmt.Errorf("%w: device %s belongs to teams %q and %q", ErrInvalid, serial, other, name)
+			}
+			t.owner[serial] = name
+		}
+	}
+	sort.Strings(t.names)
+	return t, nil
+}
+
+// Names returns the team names, sorted.
+func (t *Teams) Names() []string {
+	if t == nil {
+		return nil
+	}
+	return t.names
+}
+
+// Tokens returns the tokens of every team.
+func (t *Teams) Tokens() []string {
+	if t == nil {
+		return nil
+	}
+	out := make([]string, len(t.tokens))
+	for i, tt := range t.tokens {
+		out[i] = tt.token
+	}
+	return out
+}
+
+// TeamOf returns the team of token, or "" if it is no team's token. Every
+// token is compared, in constant time.
+func (t *Teams) TeamOf(token string) string {
+	if t == nil || token == "" {
+		return ""
+	}
+	team := ""
+	for _, tt := range t.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(tt.token)) == 1 {
+			team = tt.team
+		}
+	}
+	return team
+}
+
+// Owner returns the team owning serial, or "" if none does.
+func (t *Teams) Owner(serial string) string {
+	if t == nil {
+		return ""
+	}
+	return t.owner[serial]
+}
+
+// Owns reports whether team owns serial. Devices no team owns belong to
+// no team.
+func (t *Teams) Owns(team, serial string) bool {
+	return team != "" && t.Owner(serial) == team
+}
+
+// Devices returns the serials team owns, sorted.
+func (t *Teams) Devices(team string) []string {
+	if t == nil {
+		return nil
+	}
+	var out []string
+	for serial, owner := range t.owner {
+		if owner == team {
+			out = append(out, serial)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
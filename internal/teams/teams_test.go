@@ -0,0 +1,66 @@
+package teams
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "teams.json")
+	data := `{"teams": [
+		{"name": "payments", "tokens": ["pay-1", "pay-2"], "devices": ["R58M123", " emulator-5554 "]},
+		{"name": "maps", "tokens": ["map-1"], "devices": ["192.168.1.20:5555"]}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ts, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for tok, want := range map[string]string{"pay-1": "payments", "pay-2": "payments", "map-1": "maps", "pay": "", "": ""} {
+		if got := ts.TeamOf(tok); got != want {
+			t.Errorf("TeamOf(%q) = %q, want %q", tok, got, want)
+		}
+	}
+	if !ts.Owns("payments", "emulator-5554") || ts.Owns("maps", "R58M123") || ts.Owns("", "unowned") {
+		t.Error("Owns mismatch")
+	}
+	if got := ts.Devices("payments"); !reflect.DeepEqual(got, []string{"R58M123", "emulator-5554"}) {
+		t.Errorf("Devices = %q", got)
+	}
+	if got := ts.Names(); !reflect.DeepEqual(got, []string{"maps", "payments"}) {
+		t.Errorf("Names = %q", got)
+	}
+	if len(ts.Tokens()) != 3 {
+		t.Errorf("Tokens = %q", ts.Tokens())
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for name, list := range map[string][]Team{
+		"unnamed":       {{Tokens: []string{"a"}}},
+		"duplicate":     {{Name: "a"}, {Name: "a"}},
+		"empty token":   {{Name: "a", Tokens: []string{" "}}},
+		"shared token":  {{Name: "a", Tokens: []string{"x"}}, {Name: "b", Tokens: []string{"x"}}},
+		"shared device": {{Name: "a", Devices: []string{"S1"}}, {Name: "b", Devices: []string{"S1"}}},
+	} {
+		if _, err := New(list); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: err = %v, want ErrInvalid", name, err)
+		}
+	}
+}
+
+func TestNil(t *testing.T) {
+	var ts *Teams
+	if ts.TeamOf("x") != "" || ts.Owns("a", "S1") || ts.Devices("a") != nil || ts.Tokens() != nil {
+		t.Error("nil Teams should have no teams")
+	}
+	if ts, err := Load(""); ts != nil || err != nil {
+		t.Errorf("Load(\"\") = %v, %v", ts, err)
+	}
+}
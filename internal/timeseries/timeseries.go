@@ -0,0 +1,249 @@
+// Package timeseries keeps a bounded history of numeric device metrics —
+// battery level, health score, capture counters — as one ring of samples
+// per metric per device, optionally persisted to a JSON file so charts
+// survive restarts.
+package timeseries
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/atomicfile"
+)
+
+// DefaultCapacity is how many samples are kept per metric and device: a
+// day at the 30s health probe interval.
+const DefaultCapacity = 2880
+
+// Sample is one reading of a metric.
+type Sample struct {
+	Timestamp time.Time `json:"t"`
+	Value     float64   `json:"v"`
+}
+
+// Point is a sample or, when downsampled, the aggregate of the samples in
+// a bucket starting at Timestamp.
+type Point struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Value is the mean of the bucket.
+	Value float64 `json:"value"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// Series is the answer to a Query.
+type Series struct {
+	Serial string `json:"serial"`
+	Metric string `json:"metric"`
+	// Step is the bucket width in seconds; zero for raw samples.
+	Step   float64 `json:"step,omitempty"`
+	Points []Point `json:"points"`
+}
+
+// Query selects the samples of one metric.
+type Query struct {
+	Serial string
+	Metric string
+	// From and To bound the samples; zero values are unbounded.
+	From, To time.Time
+	// Step downsamples into buckets of this width. When zero and the range
+	// holds more than MaxPoints samples, a whole-second step giving about
+	// MaxPoints buckets is used; otherwise samples are returned raw.
+	Step      time.Duration
+	MaxPoints int
+}
+
+// Store holds the metric histories of all devices. It is safe for
+// concurrent use.
+type Store struct {
+	path     string
+	capacity int
+
+	mu     sync.RWMutex
+	series map[string]map[string][]Sample // serial -> metric -> samples
+	dirty  bool
+}
+
+// Open loads the histories kept at path, keeping up to capacity samples
+// per metric and device (DefaultCapacity if zero). A missing file is an
+// empty store; an empty path keeps the histories in memory only.
+func Open(path string, capacity int) (*Store, error) {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	s := &Store{path: path, capacity: capacity, series: make(map[string]map[string][]Sample)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read metrics: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.series); err != nil {
+		return nil, fmt.Errorf("parse metrics %s: %w", path, err)
+	}
+	for _, metrics := range s.series {
+		for m, samples := range metrics {
+			if len(samples) > capacity {
+				metrics[m] = samples[len(samples)-capacity:]
+			}
+		}
+	}
+	return s, nil
+}
+
+// Path returns the file the histories are saved to, or "" if in memory.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Add records a reading. Samples older than the last one of the series are
+// dropped so each series stays sorted.
+func (s *Store) Add(serial, metric string, t time.Time, v float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metrics := s.series[serial]
+	if metrics == nil {
+		metrics = make(map[string][]Sample)
+		s.series[serial] = metrics
+	}
+	samples := metrics[metric]
+	if n := len(samples); n > 0 && t.Before(samples[n-1].Timestamp) {
+		return
+	}
+	if len(samples) >= s.capacity {
+		// Drop the oldest; append reallocates once the slack is used up,
+		// so the backing array does not grow without bound.
+		samples = samples[1:]
+	}
+	metrics[metric] = append(samples, Sample{Timestamp: t, Value: v})
+	s.dirty = true
+}
+
+// Metrics returns the names of the metrics recorded for serial, sorted.
+func (s *Store) Metrics(serial string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]string, 0, len(s.series[serial]))
+	for m := range s.series[serial] {
+		out = append(out, m)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Query returns the samples q selects, oldest first. It reports false if
+// the metric was never recorded for the device.
+func (s *Store) Query(q Query) (Series, bool) {
+	s.mu.RLock()
+	samples, ok := s.series[q.Serial][q.Metric]
+	if ok {
+		lo := 0
+		if !q.From.IsZero() {
+			lo = sort.Search(len(samples), func(i int) bool { return !samples[i].Timestamp.Before(q.From) })
+		}
+		hi := len(samples)
+		if !q.To.IsZero() {
+			hi = sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp.After(q.To) })
+		}
+		samples = samples[lo:max(lo, hi)]
+	}
+	s.mu.RUnlock()
+	if !ok {
+		return Series{}, false
+	}
+
+	out := Series{Serial: q.Serial, Metric: q.Metric}
+	step := q.Step
+	if step <= 0 && q.MaxPoints > 0 && len(samples) > q.MaxPoints {
+		span := samples[len(samples)-1].Timestamp.Sub(samples[0].Timestamp)
+		step = (span/time.Duration(q.MaxPoints) + time.Second).Truncate(time.Second)
+	}
+	if step <= 0 {
+		out.Points = make([]Point, len(samples))
+		for i, sm := range samples {
+			out.Points[i] = Point{Timestamp: sm.Timestamp, Value: sm.Value, Min: sm.Value, Max: sm.Value, Count: 1}
+		}
+		return out, true
+	}
+
+	out.Step = step.Seconds()
+	out.Points = downsample(samples, step)
+	return out, true
+}
+
+// downsample aggregates samples into buckets of width step, aligned as by
+// time.Time.Truncate. Empty buckets are left out.
+func downsample(samples []Sample, step time.Duration) []Point {
+	points := []Point{}
+	var sum float64
+	for _, sm := range samples {
+		start := sm.Timestamp.Truncate(step)
+		if n := len(points); n > 0 && points[n-1].Timestamp.Equal(start) {
+			p := &points[n-1]
+			p.Min = min(p.Min, sm.Value)
+			p.Max = max(p.Max, sm.Value)
+			p.Count++
+			sum += sm.Value
+			p.Value = sum / float64(p.Count)
+			continue
+		}
+		sum = sm.Value
+		points = append(points, Point{Timestamp: start, Value: sm.Value, Min: sm.Value, Max: sm.Value, Count: 1})
+	}
+	return points
+}
+
+// Delete forgets every metric of serial. It reports whether there were any.
+func (s *Store) Delete(serial string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.series[serial]; !ok {
+		return false
+	}
+	delete(s.series, serial)
+	s.dirty = true
+	return true
+}
+
+// Save writes the store to its file if it changed since the last save.
+func (s *Store) Save() error {
+	if s.path == "" {
+		return nil
+	}
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(s.series)
+	s.dirty = false
+	s.mu.Unlock()
+	if err == nil {
+		err = s.write(data)
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *Store) write(data []byte) error {
+	if err := atomicfile.WriteFile(s.path, append(data, '\n')); err != nil {
+		return fmt.Errorf("save metrics: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package timeseries
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore_Query(t *testing.T) {
+	s, _ := Open("", 5)
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 8; i++ {
+		s.Add("dev1", "battery.level", base.Add(time.Duration(i)*30*time.Second), float64(100-i))
+	}
+	s.Add("dev1", "battery.level", base, 1) // out of order, dropped
+
+	all, ok := s.Query(Query{Serial: "dev1", Metric: "battery.level"})
+	if !ok || len(all.Points) != 5 || all.Points[0].Value != 97 || all.Points[4].Value != 93 {
+		t.Fatalf("all = %+v", all)
+	}
+
+	ranged, _ := s.Query(Query{Serial: "dev1", Metric: "battery.level",
+		From: base.Add(2 * time.Minute), To: base.Add(3 * time.Minute)})
+	if len(ranged.Points) != 3 || ranged.Points[0].Value != 96 || ranged.Points[2].Value != 94 {
+		t.Errorf("ranged = %+v", ranged.Points)
+	}
+
+	down, _ := s.Query(Query{Serial: "dev1", Metric: "battery.level", Step: time.Minute})
+	if down.Step != 60 || len(down.Points) != 3 {
+		t.Fatalf("downsampled = %+v", down)
+	}
+	// 1:30 alone, then 2:00+2:30, then 3:00+3:30.
+	if p := down.Points[1]; p.Count != 2 || p.Value != 95.5 || p.Min != 95 || p.Max != 96 ||
+		!p.Timestamp.Equal(base.Add(2*time.Minute)) {
+		t.Errorf("bucket = %+v", p)
+	}
+
+	capped, _ := s.Query(Query{Serial: "dev1", Metric: "battery.level", MaxPoints: 2})
+	if len(capped.Points) > 3 || capped.Step == 0 {
+		t.Errorf("max points = %+v", capped)
+	}
+
+	if _, ok := s.Query(Query{Serial: "dev1", Metric: "missing"}); ok {
+		t.Error("unknown metric found")
+	}
+	if got := s.Metrics("dev1"); len(got) != 1 || got[0] != "battery.level" {
+		t.Errorf("metrics = %v", got)
+	}
+}
+
+func TestStore_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	s, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Add("dev1", "health.score", ts, 87)
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s2, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := s2.Query(Query{Serial: "dev1", Metric: "health.score"})
+	if !ok || len(got.Points) != 1 || got.Points[0].Value != 87 || !got.Points[0].Timestamp.Equal(ts) {
+		t.Errorf("reloaded = %+v", got)
+	}
+}
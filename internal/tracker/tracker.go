@@ -2,9 +2,12 @@ package tracker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/imcanugur/go-adb-monitor/internal/adb"
@@ -27,6 +30,12 @@ type Tracker struct {
 
 	// known tracks the last-known state of all devices by serial.
 	known map[string]adb.Device
+
+	// streams counts successfully established track-devices streams.
+	streams int
+	// serverDown is set when a reconnect attempt could not reach the server,
+	// meaning the next successful stream talks to a fresh server process.
+	serverDown bool
 }
 
 // New creates a new device tracker.
@@ -55,6 +64,9 @@ func (t *Tracker) Run(ctx context.Context) error {
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
+		if errors.Is(err, adb.ErrServerNotRunning) {
+			t.serverDown = true
+		}
 
 		t.log.Warn("tracking connection lost, reconnecting",
 			"error", err,
@@ -82,6 +94,12 @@ func (t *Tracker) stream(ctx context.Context) error {
 
 	t.log.Info("track-devices stream established", "addr", t.client.Addr())
 
+	t.streams++
+	reconnected := t.streams > 1
+	serverWasDown := t.serverDown
+	t.serverDown = false
+	first := true
+
 	// Watch for context cancellation and close the connection.
 	go func() {
 		<-ctx.Done()
@@ -94,13 +112,31 @@ func (t *Tracker) stream(ctx context.Context) error {
 			if ctx.Err() != nil {
 				return ctx.Err()
 			}
-			if err == io.EOF || isClosedErr(err) {
+			if errors.Is(err, io.EOF) || isClosedErr(err) {
 				return fmt.Errorf("%w: stream terminated", adb.ErrConnectionClosed)
 			}
 			return fmt.Errorf("reading device update: %w", err)
 		}
 
 		devices := adb.ParseDeviceList(payload)
+
+		// The first list after a reconnect tells us whether we are talking to
+		// the same server process. Publish the restart before resyncing so
+		// that subscribers see it ahead of the disconnect/connect churn it
+		// causes.
+		if first {
+			first = false
+			if reconnected && (serverWasDown || t.transportReset(devices)) {
+				t.log.Warn("ADB server restarted, device transports were reset")
+				t.bus.Publish(event.Event{
+					Type:      event.ADBServerRestarted,
+					Timestamp: time.Now(),
+				})
+				t.resync(devices)
+				continue
+			}
+		}
+
 		t.diffAndEmit(devices)
 	}
 }
@@ -177,11 +213,71 @@ func (t *Tracker) diffAndEmit(current []adb.Device) {
 	}
 }
 
+// resync replaces the known state with the device list of a restarted
+// server. Every device on it has a new transport, so each is announced as
+// connected again, even if its state is unchanged; devices the new server
+// doesn't list are announced as disconnected. When each device was first
+// seen is kept.
+func (t *Tracker) resync(current []adb.Device) {
+	now := time.Now()
+	prev := t.known
+	t.known = make(map[string]adb.Device, len(current))
+	for _, dev := range current {
+		dev.FirstSeen = now
+		if p, ok := prev[dev.Serial]; ok {
+			dev.FirstSeen = p.FirstSeen
+		}
+		dev.LastSeen = now
+		t.known[dev.Serial] = dev
+	}
+
+	for serial, dev := range prev {
+		if _, ok := t.known[serial]; ok {
+			continue
+		}
+		t.log.Info("device gone after server restart", "serial", serial, "last_state", dev.State)
+		t.bus.Publish(event.Event{
+			Type:      event.DeviceDisconnected,
+			Serial:    serial,
+			Device:    &dev,
+			OldState:  dev.State,
+			Timestamp: now,
+		})
+	}
+	for _, dev := range current {
+		dev := t.known[dev.Serial]
+		t.log.Info("device resynced after server restart", "serial", dev.Serial, "state", dev.State)
+		t.bus.Publish(event.Event{
+			Type:      event.DeviceConnected,
+			Serial:    dev.Serial,
+			Device:    &dev,
+			OldState:  prev[dev.Serial].State,
+			NewState:  dev.State,
+			Timestamp: now,
+		})
+	}
+}
+
+// transportReset reports whether any device present both in the known set and
+// in current came back with a lower transport ID. The ADB server assigns
+// transport IDs from a per-process counter, so an ID going backwards means the
+// server was restarted underneath us.
+func (t *Tracker) transportReset(current []adb.Device) bool {
+	for _, dev := range current {
+		prev, ok := t.known[dev.Serial]
+		if !ok {
+			continue
+		}
+		prevID, err1 := strconv.Atoi(prev.Transport)
+		curID, err2 := strconv.Atoi(dev.Transport)
+		if err1 == nil && err2 == nil && curID < prevID {
+			return true
+		}
+	}
+	return false
+}
+
 // isClosedErr checks if an error indicates a closed connection.
 func isClosedErr(err error) bool {
-	if err == nil {
-		return false
-	}
-	return err.Error() == "use of closed network connection" ||
-		err.Error() == "read/write on closed pipe"
+	return errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe)
 }
@@ -0,0 +1,77 @@
+package tracker
+
+import (
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+func TestTransportReset(t *testing.T) {
+	tr := &Tracker{known: map[string]adb.Device{
+		"A": {Serial: "A", State: adb.StateDevice, Transport: "7"},
+		"B": {Serial: "B", State: adb.StateDevice, Transport: "8"},
+	}}
+
+	tests := []struct {
+		name    string
+		current []adb.Device
+		want    bool
+	}{
+		{"same ids", []adb.Device{{Serial: "A", Transport: "7"}, {Serial: "B", Transport: "8"}}, false},
+		{"replugged device gets higher id", []adb.Device{{Serial: "A", Transport: "9"}}, false},
+		{"ids went backwards", []adb.Device{{Serial: "A", Transport: "1"}}, true},
+		{"unknown device only", []adb.Device{{Serial: "C", Transport: "1"}}, false},
+		{"non-numeric transport", []adb.Device{{Serial: "A", Transport: ""}}, false},
+		{"empty list", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tr.transportReset(tt.current); got != tt.want {
+				t.Errorf("transportReset() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResync(t *testing.T) {
+	bus := event.NewBus(16)
+	defer bus.Close()
+	var mu sync.Mutex
+	got := map[string]event.Event{}
+	bus.Subscribe("test", func(e event.Event) {
+		mu.Lock()
+		got[e.Serial] = e
+		mu.Unlock()
+	})
+
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr := &Tracker{bus: bus, log: slog.Default(), known: map[string]adb.Device{
+		"A": {Serial: "A", State: adb.StateDevice, Transport: "7", FirstSeen: first},
+		"B": {Serial: "B", State: adb.StateDevice, Transport: "8", FirstSeen: first},
+	}}
+	tr.resync([]adb.Device{
+		{Serial: "A", State: adb.StateDevice, Transport: "1"},
+		{Serial: "C", State: adb.StateOffline, Transport: "2"},
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if e := got["A"]; e.Type != event.DeviceConnected || e.OldState != adb.StateDevice || !e.Device.FirstSeen.Equal(first) {
+		t.Errorf("A: %+v", e)
+	}
+	if e := got["B"]; e.Type != event.DeviceDisconnected {
+		t.Errorf("B: %+v", e)
+	}
+	if e := got["C"]; e.Type != event.DeviceConnected || e.OldState != "" || e.NewState != adb.StateOffline {
+		t.Errorf("C: %+v", e)
+	}
+	if len(tr.known) != 2 || tr.known["A"].Transport != "1" {
+		t.Errorf("known: %+v", tr.known)
+	}
+}
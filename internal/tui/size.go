@@ -0,0 +1,30 @@
+package tui
+
+import (
+	"io"
+	"os"
+	"strconv"
+)
+
+// Fallback size when neither the terminal nor the environment tells.
+const (
+	defaultWidth  = 120
+	defaultHeight = 40
+)
+
+// termSize returns the size of the terminal out writes to.
+func termSize(out io.Writer) (width, height int) {
+	if f, ok := out.(*os.File); ok {
+		if w, h, ok := ttySize(f); ok {
+			return w, h
+		}
+	}
+	width, height = defaultWidth, defaultHeight
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		width = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("LINES")); err == nil && n > 0 {
+		height = n
+	}
+	return width, height
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package tui
+
+import "os"
+
+func ttySize(f *os.File) (width, height int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin
+
+package tui
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ttySize asks the terminal behind f for its size.
+func ttySize(f *os.File) (width, height int, ok bool) {
+	var ws struct{ rows, cols, xpixel, ypixel uint16 }
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.cols == 0 || ws.rows == 0 {
+		return 0, 0, false
+	}
+	return int(ws.cols), int(ws.rows), true
+}
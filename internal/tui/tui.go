@@ -0,0 +1,392 @@
+// Package tui renders a live dashboard of devices, capture statistics and
+// recent traffic to an ANSI terminal, for operators working over SSH
+// without the web dashboard. It draws with plain escape sequences and needs
+// no terminal library.
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+const (
+	// DefaultRefresh is how often Run redraws the screen.
+	DefaultRefresh = time.Second
+	// maxFeed is the number of traffic lines kept for the scrolling feed.
+	maxFeed = 500
+	// minFeedLines is the feed height kept free when the device table is
+	// cut short on small terminals.
+	minFeedLines = 5
+)
+
+// ANSI sequences used by Run.
+const (
+	enterScreen = "\x1b[?1049h\x1b[?25l" // alternate screen, hide cursor
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+	home        = "\x1b[H"
+	clearLine   = "\x1b[K"
+	clearBelow  = "\x1b[J"
+)
+
+type deviceRow struct {
+	device adb.Device
+	props  map[string]string
+	engine *capture.Engine
+	// stats is the last snapshot of a capture that has ended.
+	stats *capture.CaptureStats
+}
+
+// Dashboard holds what the terminal shows. Feed it device events with
+// HandleEvent and captures with Track. It is safe for concurrent use.
+type Dashboard struct {
+	mu      sync.Mutex
+	devices map[string]*deviceRow
+	feed    []string
+	next    int // ring position once feed is full
+}
+
+// New creates an empty dashboard.
+func New() *Dashboard {
+	return &Dashboard{devices: make(map[string]*deviceRow)}
+}
+
+func (d *Dashboard) rowLocked(serial string) *deviceRow {
+	row := d.devices[serial]
+	if row == nil {
+		row = &deviceRow{device: adb.Device{Serial: serial}}
+		d.devices[serial] = row
+	}
+	return row
+}
+
+// HandleEvent applies a device event; it is an event.Handler.
+func (d *Dashboard) HandleEvent(e event.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch e.Type {
+	case event.DeviceConnected, event.DeviceStateChanged:
+		row := d.rowLocked(e.Serial)
+		if e.Device != nil {
+			row.device = *e.Device
+		}
+		if e.NewState != "" {
+			row.device.State = e.NewState
+		}
+	case event.DeviceDisconnected:
+		delete(d.devices, e.Serial)
+	case event.DeviceProperties:
+		d.rowLocked(e.Serial).props = e.Props
+	case event.DevicePropertiesChanged:
+		row := d.rowLocked(e.Serial)
+		props := make(map[string]string, len(row.props)+len(e.Changes))
+		for k, v := range row.props {
+			props[k] = v
+		}
+		for k, c := range e.Changes {
+			if c.New == "" {
+				delete(props, k)
+			} else {
+				props[k] = c.New
+			}
+		}
+		row.props = props
+	case event.ADBServerRestarted:
+		d.devices = make(map[string]*deviceRow)
+	}
+}
+
+// Track shows the statistics of engine and feeds its packets and
+// connections into the traffic feed until ctx is done. Track takes over
+// the engine's Packets, Connections and ClosedConnections channels.
+func (d *Dashboard) Track(ctx context.Context, serial string, engine *capture.Engine) {
+	d.mu.Lock()
+	row := d.rowLocked(serial)
+	row.engine, row.stats = engine, nil
+	d.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				stats := engine.Stats()
+				d.mu.Lock()
+				if row := d.devices[serial]; row != nil && row.engine == engine {
+					row.engine, row.stats = nil, &stats
+				}
+				d.mu.Unlock()
+				return
+			case pkt := <-engine.Packets():
+				d.addFeed(pkt.Timestamp, packetLine(pkt))
+			case conn := <-engine.Connections():
+				d.addFeed(conn.LastSeen, connectionLine(conn))
+			case conn := <-engine.ClosedConnections():
+				d.addFeed(*conn.ClosedAt, connectionLine(conn))
+			}
+		}
+	}()
+}
+
+func (d *Dashboard) addFeed(t time.Time, line string) {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	line = t.Format("15:04:05") + " " + line
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.feed) < maxFeed {
+		d.feed = append(d.feed, line)
+		return
+	}
+	d.feed[d.next] = line
+	d.next = (d.next + 1) % maxFeed
+}
+
+// recentLocked returns the last n feed lines, oldest first.
+func (d *Dashboard) recentLocked(n int) []string {
+	ordered := append(d.feed[d.next:len(d.feed):len(d.feed)], d.feed[:d.next]...)
+	if n < len(ordered) {
+		ordered = ordered[len(ordered)-n:]
+	}
+	return ordered
+}
+
+func packetLine(p capture.NetworkPacket) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-16s %-5s %s > %s", p.Serial, p.Protocol,
+		hostPort(p.SrcIP, p.SrcPort), hostPort(p.DstIP, p.DstPort))
+	if p.Flags != "" {
+		b.WriteString(" [" + p.Flags + "]")
+	}
+	b.WriteString(" " + formatBytes(int64(p.Length)))
+	switch {
+	case p.HTTPMethod != "":
+		fmt.Fprintf(&b, " %s %s%s", p.HTTPMethod, p.HTTPHost, p.HTTPPath)
+	case p.HTTPStatus != 0:
+		fmt.Fprintf(&b, " HTTP %d", p.HTTPStatus)
+	}
+	if p.Malicious {
+		b.WriteString(" !! " + p.Threat)
+	}
+	return b.String()
+}
+
+func connectionLine(c capture.Connection) string {
+	remote := c.RemoteIP
+	if c.Hostname != "" {
+		remote = c.Hostname
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-16s %-5s %s -> %s %s", c.Serial, c.Protocol,
+		hostPort(c.LocalIP, c.LocalPort), hostPort(remote, c.RemotePort), c.State)
+	if app := c.AppName; app != "" || c.Process != "" {
+		if app == "" {
+			app = c.Process
+		}
+		b.WriteString(" " + app)
+	}
+	if c.BytesSent > 0 || c.BytesReceived > 0 {
+		fmt.Fprintf(&b, " %s/%s", formatBytes(int64(c.BytesSent)), formatBytes(int64(c.BytesReceived)))
+	}
+	if c.ClosedAt != nil {
+		d := time.Duration(c.DurationMs) * time.Millisecond
+		fmt.Fprintf(&b, " closed after %s", d.Round(time.Second))
+	}
+	if c.Malicious {
+		b.WriteString(" !! " + c.Threat)
+	}
+	return b.String()
+}
+
+func hostPort(host string, port uint16) string {
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return host + ":" + strconv.Itoa(int(port))
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fG", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fM", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fK", float64(n)/(1<<10))
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
+
+// table columns: header and width.
+var columns = []struct {
+	name  string
+	width int
+}{
+	{"SERIAL", 20}, {"STATE", 12}, {"MODEL", 16}, {"ANDROID", 8}, {"BATT", 5},
+	{"CAPTURE", 9}, {"PACKETS", 9}, {"CONNS", 6}, {"ERRORS", 7}, {"LAST ACTIVITY", 13},
+}
+
+func (row *deviceRow) cells(now time.Time) []string {
+	dev, props := row.device, row.props
+	model := dev.Model
+	if m := props["ro.product.model"]; m != "" {
+		model = m
+	}
+	battery := props["battery.level"]
+	if battery != "" {
+		battery += "%"
+	}
+	cells := []string{dev.Serial, string(dev.State), model, props["ro.build.version.release"], battery,
+		"-", "", "", "", ""}
+
+	stats := row.stats
+	if row.engine != nil {
+		s := row.engine.Stats()
+		stats = &s
+	}
+	if stats == nil {
+		return cells
+	}
+	mode := stats.Mode
+	if row.engine == nil {
+		mode = "stopped"
+	}
+	cells[5] = mode
+	cells[6] = strconv.FormatInt(stats.PacketCount, 10)
+	cells[7] = strconv.Itoa(stats.ConnCount)
+	cells[8] = strconv.FormatInt(stats.Errors, 10)
+	if !stats.LastActivity.IsZero() {
+		cells[9] = now.Sub(stats.LastActivity).Truncate(time.Second).String() + " ago"
+	}
+	return cells
+}
+
+// Render draws one frame of width by height cells into w as plain lines,
+// without escape sequences.
+func (d *Dashboard) Render(w io.Writer, width, height int, now time.Time) {
+	for _, line := range d.lines(width, height, now) {
+		fmt.Fprintln(w, line)
+	}
+}
+
+func (d *Dashboard) lines(width, height int, now time.Time) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	serials := make([]string, 0, len(d.devices))
+	capturing := 0
+	for serial, row := range d.devices {
+		serials = append(serials, serial)
+		if row.engine != nil {
+			capturing++
+		}
+	}
+	sort.Strings(serials)
+
+	var out []string
+	add := func(s string) { out = append(out, truncate(s, width)) }
+
+	title := fmt.Sprintf("adb-monitor  %d device(s), %d capturing", len(serials), capturing)
+	clock := now.Format("15:04:05")
+	add(title + strings.Repeat(" ", max(1, width-len(title)-len(clock))) + clock)
+	add("")
+
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.name
+	}
+	add(formatRow(header))
+
+	// Leave room for the feed heading and a few feed lines.
+	shown := serials
+	if room := height - len(out) - 2 - minFeedLines; room > 0 && len(serials) > room {
+		shown = serials[:room-1]
+	}
+	for _, serial := range shown {
+		add(formatRow(d.devices[serial].cells(now)))
+	}
+	if n := len(serials) - len(shown); n > 0 {
+		add(fmt.Sprintf("... %d more", n))
+	}
+	if len(serials) == 0 {
+		add("no devices")
+	}
+
+	add("")
+	add("RECENT TRAFFIC")
+	for _, line := range d.recentLocked(max(0, height-len(out))) {
+		add(line)
+	}
+	if len(out) > height {
+		out = out[:height]
+	}
+	return out
+}
+
+func formatRow(cells []string) string {
+	var b strings.Builder
+	for i, c := range columns {
+		cell := truncate(cells[i], c.width)
+		b.WriteString(cell)
+		if i < len(columns)-1 {
+			b.WriteString(strings.Repeat(" ", c.width-len([]rune(cell))+1))
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// truncate cuts s to n runes, marking the cut with "~".
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n <= 1 {
+		return string(r[:max(n, 0)])
+	}
+	return string(r[:n-1]) + "~"
+}
+
+// Run takes over out, redrawing the dashboard every refresh interval
+// (DefaultRefresh if zero) until ctx is done, then restores the screen.
+// The size is read from the terminal when out is one, else from the
+// COLUMNS and LINES variables.
+func (d *Dashboard) Run(ctx context.Context, out io.Writer, refresh time.Duration) {
+	if refresh <= 0 {
+		refresh = DefaultRefresh
+	}
+	io.WriteString(out, enterScreen)
+	defer io.WriteString(out, leaveScreen)
+
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		width, height := termSize(out)
+		var b strings.Builder
+		b.WriteString(home)
+		for i, line := range d.lines(width, height, time.Now()) {
+			if i > 0 {
+				b.WriteString("\r\n")
+			}
+			b.WriteString(line + clearLine)
+		}
+		b.WriteString(clearBelow)
+		io.WriteString(out, b.String())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imcanugur/go-adb-monitor/internal/adb"
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+)
+
+func TestDashboard_Render(t *testing.T) {
+	d := New()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	d.HandleEvent(event.Event{Type: event.DeviceConnected, Serial: "emulator-5554",
+		Device: &adb.Device{Serial: "emulator-5554", State: adb.StateDevice, Model: "sdk_gphone"}, NewState: adb.StateDevice})
+	d.HandleEvent(event.Event{Type: event.DeviceProperties, Serial: "emulator-5554",
+		Props: map[string]string{"ro.product.model": "Pixel 7", "ro.build.version.release": "14", "battery.level": "80"}})
+	d.HandleEvent(event.Event{Type: event.DeviceConnected, Serial: "gone", NewState: adb.StateDevice})
+	d.HandleEvent(event.Event{Type: event.DeviceDisconnected, Serial: "gone"})
+
+	d.addFeed(now, packetLine(capture.NetworkPacket{Serial: "emulator-5554", Protocol: capture.ProtoTCP,
+		SrcIP: "10.0.2.15", SrcPort: 40000, DstIP: "93.184.216.34", DstPort: 80, Length: 2048,
+		HTTPMethod: "GET", HTTPHost: "example.com", HTTPPath: "/"}))
+	d.addFeed(now, connectionLine(capture.Connection{Serial: "emulator-5554", Protocol: capture.ProtoTCP,
+		LocalIP: "::1", LocalPort: 5000, RemoteIP: "8.8.8.8", RemotePort: 443, Hostname: "dns.google",
+		State: capture.ConnEstablished, AppName: "com.example", Malicious: true, Threat: "feed: dns.google"}))
+
+	var b strings.Builder
+	d.Render(&b, 120, 20, now)
+	out := b.String()
+	for _, want := range []string{
+		"1 device(s), 0 capturing",
+		"emulator-5554",
+		"Pixel 7",
+		"80%",
+		"10.0.2.15:40000 > 93.184.216.34:80 2.0K GET example.com/",
+		"[::1]:5000 -> dns.google:443 ESTABLISHED com.example !! feed: dns.google",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("render missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "gone") {
+		t.Errorf("disconnected device rendered:\n%s", out)
+	}
+	for i, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if n := len([]rune(line)); n > 120 {
+			t.Errorf("line %d is %d wide", i, n)
+		}
+	}
+}
+
+func TestDashboard_SmallScreen(t *testing.T) {
+	d := New()
+	for i := 0; i < 30; i++ {
+		d.HandleEvent(event.Event{Type: event.DeviceConnected, Serial: fmt.Sprintf("dev%02d", i), NewState: adb.StateDevice})
+	}
+	for i := 0; i < maxFeed+10; i++ {
+		d.addFeed(time.Now(), fmt.Sprintf("line %d", i))
+	}
+
+	lines := d.lines(40, 24, time.Now())
+	if len(lines) != 24 {
+		t.Fatalf("got %d lines, want 24", len(lines))
+	}
+	if last := lines[len(lines)-1]; !strings.HasSuffix(last, fmt.Sprintf("line %d", maxFeed+9)) {
+		t.Errorf("last line = %q, want newest feed line", last)
+	}
+	var more bool
+	for _, l := range lines {
+		more = more || strings.HasPrefix(l, "... ")
+	}
+	if !more {
+		t.Errorf("device table not cut short:\n%s", strings.Join(lines, "\n"))
+	}
+	if len(d.feed) != maxFeed {
+		t.Errorf("feed holds %d lines, want %d", len(d.feed), maxFeed)
+	}
+}
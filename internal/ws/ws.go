@@ -0,0 +1,349 @@
+// Package ws implements the server side of the WebSocket protocol (RFC 6455)
+// on top of net/http, covering what the dashboard needs: text and binary
+// messages, fragmentation, ping/pong and the close handshake. Extensions and
+// subprotocols are not supported.
+package ws
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message types (frame opcodes).
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+
+	opContinuation = 0
+	opClose        = 8
+	opPing         = 9
+	opPong         = 10
+)
+
+// Close status codes.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+	closeNoStatus        = 1005
+	defaultMaxMessage    = 1 << 20
+	closeHandshakeWindow = 2 * time.Second
+)
+
+// acceptGUID is the fixed GUID from RFC 6455 section 1.3.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	// ErrClosed is returned by ReadMessage after the peer sent a close frame.
+	ErrClosed = errors.New("websocket: connection closed")
+	// ErrMessageTooBig is returned when a message exceeds the read limit.
+	ErrMessageTooBig = errors.New("websocket: message too big")
+	// ErrProtocol indicates a malformed frame from the peer.
+	ErrProtocol = errors.New("websocket: protocol error")
+)
+
+// CloseError carries the status code and reason of a received close frame.
+// It unwraps to ErrClosed.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: closed (%d) %s", e.Code, e.Reason)
+}
+
+func (e *CloseError) Unwrap() error {
+	return ErrClosed
+}
+
+// Conn is a server-side WebSocket connection. One goroutine may read while
+// others write; writes are serialized internally.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	wmu    sync.Mutex
+	closed bool
+
+	maxMessage int
+}
+
+// Upgrade performs the opening handshake and hijacks the HTTP connection.
+// If the request carries an Origin header it must match the Host, which
+// stops other sites from opening sockets with the user's credentials. On
+// failure an HTTP error has already been written.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, fmt.Errorf("%w: method %s", ErrProtocol, r.Method)
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return nil, fmt.Errorf("%w: not an upgrade request", ErrProtocol)
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("%w: unsupported version", ErrProtocol)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, fmt.Errorf("%w: missing key", ErrProtocol)
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin websocket rejected", http.StatusForbidden)
+		return nil, fmt.Errorf("%w: origin %q not allowed", ErrProtocol, r.Header.Get("Origin"))
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("websocket: response does not support hijacking")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: hijack: %w", err)
+	}
+	// http.Server may have set deadlines for the request; sockets live longer.
+	conn.SetDeadline(time.Time{})
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("websocket: writing handshake: %w", err)
+	}
+
+	return &Conn{conn: conn, br: brw.Reader, maxMessage: defaultMaxMessage}, nil
+}
+
+// AcceptKey computes the Sec-WebSocket-Accept value for a client key.
+func AcceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// SetReadLimit sets the maximum size of an incoming message.
+func (c *Conn) SetReadLimit(n int) {
+	c.maxMessage = n
+}
+
+// ReadMessage returns the next complete data message. Control frames are
+// handled transparently: pings are answered, and a close frame is echoed
+// and reported as a *CloseError.
+func (c *Conn) ReadMessage() (msgType int, data []byte, err error) {
+	msgType = -1
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			ce := &CloseError{Code: closeNoStatus}
+			if len(payload) >= 2 {
+				ce.Code = int(binary.BigEndian.Uint16(payload))
+				ce.Reason = string(payload[2:])
+			}
+			c.writeClose(CloseNormal, "")
+			return 0, nil, ce
+		case TextMessage, BinaryMessage:
+			if msgType != -1 {
+				return 0, nil, c.fail(CloseProtocolError, "new message inside fragmented message")
+			}
+			msgType = op
+		case opContinuation:
+			if msgType == -1 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", op))
+		}
+
+		if len(data)+len(payload) > c.maxMessage {
+			c.writeClose(CloseMessageTooBig, "")
+			return 0, nil, ErrMessageTooBig
+		}
+		data = append(data, payload...)
+		if fin {
+			return msgType, data, nil
+		}
+	}
+}
+
+// readFrame reads and unmasks one frame.
+func (c *Conn) readFrame() (fin bool, op int, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = hdr[0]&0x80 != 0
+	op = int(hdr[0] & 0x0f)
+	if hdr[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits set")
+	}
+	if hdr[1]&0x80 == 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "client frame not masked")
+	}
+
+	length := uint64(hdr[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if op >= opClose && (length > 125 || !fin) {
+		return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+	}
+	if length > uint64(c.maxMessage) {
+		c.writeClose(CloseMessageTooBig, "")
+		return false, 0, nil, ErrMessageTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// WriteMessage sends data as a single unfragmented message.
+func (c *Conn) WriteMessage(msgType int, data []byte) error {
+	if msgType != TextMessage && msgType != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", msgType)
+	}
+	return c.writeFrame(msgType, data)
+}
+
+func (c *Conn) writeFrame(op int, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	return writeFrame(c.conn, op, payload)
+}
+
+// writeFrame writes an unmasked (server) frame.
+func writeFrame(w io.Writer, op int, payload []byte) error {
+	buf := make([]byte, 0, 10+len(payload))
+	buf = append(buf, 0x80|byte(op))
+	switch n := len(payload); {
+	case n <= 125:
+		buf = append(buf, byte(n))
+	case n <= 0xffff:
+		buf = append(buf, 126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, 127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+	buf = append(buf, payload...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// writeClose sends a close frame once; later writes fail with ErrClosed.
+func (c *Conn) writeClose(code int, reason string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	c.conn.SetWriteDeadline(time.Now().Add(closeHandshakeWindow))
+	return writeFrame(c.conn, opClose, payload)
+}
+
+// fail sends a close frame with code and returns a protocol error.
+func (c *Conn) fail(code int, reason string) error {
+	c.writeClose(code, reason)
+	return fmt.Errorf("%w: %s", ErrProtocol, reason)
+}
+
+// CloseWithReason sends a close frame with the given status and closes the
+// underlying connection.
+func (c *Conn) CloseWithReason(code int, reason string) error {
+	c.writeClose(code, reason)
+	return c.conn.Close()
+}
+
+// Close performs a normal closure.
+func (c *Conn) Close() error {
+	return c.CloseWithReason(CloseNormal, "")
+}
+
+// RemoteAddr returns the peer's network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// headerContains reports whether the comma-separated header contains token.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOrigin reports whether the Origin header (if any) matches the Host.
+// Non-browser clients do not send Origin and are allowed.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
@@ -0,0 +1,179 @@
+package ws
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// dial performs a client handshake against srv and returns the raw socket.
+func dial(t *testing.T, srv *httptest.Server, origin string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	req := "GET / HTTP/1.1\r\nHost: " + strings.TrimPrefix(srv.URL, "http://") + "\r\n" +
+		"Upgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"
+	if origin != "" {
+		req += "Origin: " + origin + "\r\n"
+	}
+	if _, err := conn.Write([]byte(req + "\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status: %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("accept key: %q", got)
+	}
+	return conn, br
+}
+
+// writeClientFrame writes a masked frame.
+func writeClientFrame(t *testing.T, w io.Writer, fin bool, op int, payload []byte) {
+	t.Helper()
+	b0 := byte(op)
+	if fin {
+		b0 |= 0x80
+	}
+	buf := []byte{b0}
+	switch n := len(payload); {
+	case n <= 125:
+		buf = append(buf, 0x80|byte(n))
+	default:
+		buf = append(buf, 0x80|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	}
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	buf = append(buf, mask[:]...)
+	for i, c := range payload {
+		buf = append(buf, c^mask[i%4])
+	}
+	if _, err := w.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readServerFrame reads one unmasked frame.
+func readServerFrame(t *testing.T, r io.Reader) (op int, payload []byte) {
+	t.Helper()
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		t.Fatal(err)
+	}
+	n := int(hdr[1] & 0x7f)
+	if n == 126 {
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return int(hdr[0] & 0x0f), payload
+}
+
+// echoServer echoes every message back and reports the final read error.
+func echoServer(t *testing.T) (*httptest.Server, chan error) {
+	done := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			typ, data, err := c.ReadMessage()
+			if err != nil {
+				done <- err
+				return
+			}
+			c.WriteMessage(typ, data)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, done
+}
+
+func TestEcho_FragmentsAndPing(t *testing.T) {
+	srv, done := echoServer(t)
+	conn, br := dial(t, srv, "")
+
+	writeClientFrame(t, conn, false, TextMessage, []byte("hel"))
+	writeClientFrame(t, conn, true, opPing, []byte("p"))
+	writeClientFrame(t, conn, true, opContinuation, []byte("lo"))
+
+	if op, data := readServerFrame(t, br); op != opPong || string(data) != "p" {
+		t.Errorf("pong: op %d data %q", op, data)
+	}
+	if op, data := readServerFrame(t, br); op != TextMessage || string(data) != "hello" {
+		t.Errorf("echo: op %d data %q", op, data)
+	}
+
+	big := []byte(strings.Repeat("x", 300))
+	writeClientFrame(t, conn, true, BinaryMessage, big)
+	if op, data := readServerFrame(t, br); op != BinaryMessage || len(data) != 300 {
+		t.Errorf("binary echo: op %d len %d", op, len(data))
+	}
+
+	writeClientFrame(t, conn, true, opClose, binary.BigEndian.AppendUint16(nil, CloseNormal))
+	if op, _ := readServerFrame(t, br); op != opClose {
+		t.Errorf("expected close frame, got op %d", op)
+	}
+	var ce *CloseError
+	if err := <-done; !errors.As(err, &ce) || ce.Code != CloseNormal {
+		t.Errorf("server error: %v", err)
+	}
+}
+
+func TestReadMessage_UnmaskedFrame(t *testing.T) {
+	srv, done := echoServer(t)
+	conn, br := dial(t, srv, "")
+
+	conn.Write([]byte{0x81, 0x01, 'x'})
+	if op, data := readServerFrame(t, br); op != opClose || binary.BigEndian.Uint16(data) != CloseProtocolError {
+		t.Errorf("expected protocol error close, got op %d data %v", op, data)
+	}
+	if err := <-done; !errors.Is(err, ErrProtocol) {
+		t.Errorf("server error: %v", err)
+	}
+}
+
+func TestUpgrade_CrossOrigin(t *testing.T) {
+	srv, _ := echoServer(t)
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Origin", "http://evil.example")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("status: got %d, want 403", resp.StatusCode)
+	}
+
+	// Same-origin browsers are accepted.
+	dial(t, srv, srv.URL)
+}
@@ -3,33 +3,152 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
 	"flag"
+	"fmt"
 	"io/fs"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/imcanugur/go-adb-monitor/internal/adb"
 	"github.com/imcanugur/go-adb-monitor/internal/adbbin"
+	"github.com/imcanugur/go-adb-monitor/internal/anomaly"
+	"github.com/imcanugur/go-adb-monitor/internal/audit"
 	"github.com/imcanugur/go-adb-monitor/internal/bridge"
+	"github.com/imcanugur/go-adb-monitor/internal/capture"
+	"github.com/imcanugur/go-adb-monitor/internal/config"
+	"github.com/imcanugur/go-adb-monitor/internal/correlate"
+	"github.com/imcanugur/go-adb-monitor/internal/downloads"
+	"github.com/imcanugur/go-adb-monitor/internal/elastic"
+	"github.com/imcanugur/go-adb-monitor/internal/event"
+	"github.com/imcanugur/go-adb-monitor/internal/intel"
+	"github.com/imcanugur/go-adb-monitor/internal/labels"
 	"github.com/imcanugur/go-adb-monitor/internal/logging"
+	"github.com/imcanugur/go-adb-monitor/internal/monitor"
+	"github.com/imcanugur/go-adb-monitor/internal/notify"
+	"github.com/imcanugur/go-adb-monitor/internal/processor"
+	"github.com/imcanugur/go-adb-monitor/internal/registry"
+	"github.com/imcanugur/go-adb-monitor/internal/report"
+	"github.com/imcanugur/go-adb-monitor/internal/schedule"
+	"github.com/imcanugur/go-adb-monitor/internal/service"
+	"github.com/imcanugur/go-adb-monitor/internal/sink"
 	"github.com/imcanugur/go-adb-monitor/internal/store"
+	"github.com/imcanugur/go-adb-monitor/internal/teams"
+	"github.com/imcanugur/go-adb-monitor/internal/timeseries"
 )
 
-// Embed the frontend assets and platform-tools (ADB) into the binary.
-// This makes the output a completely self-contained single file.
+// Static tcpdump builds pushed to rooted devices that lack one; see
+// tcpdump/README.md.
 //
-//go:embed frontend
-var frontendFS embed.FS
-
-//go:embed platform-tools
-var platformToolsFS embed.FS
+//go:embed tcpdump
+var tcpdumpFS embed.FS
 
 func main() {
-	addr := flag.String("addr", ":8080", "HTTP listen address")
+	if len(os.Args) > 1 && os.Args[1] == "alert-rules" {
+		os.Exit(runAlertRules(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	var (
+		addr           = flag.String("addr", ":8080", "HTTP listen address")
+		basePath       = flag.String("base-path", "", "Path prefix to serve the API and dashboard under, e.g. /adb-monitor behind a reverse proxy")
+		corsOrigins    = flag.String("cors-origins", "", "Comma-separated origins allowed to call the API from a browser (* = any); empty keeps it same-origin")
+		readOnly       = flag.Bool("read-only", false, "Disable capture control and clearing; keep live views and SSE")
+		adbAddr        = flag.String("adb-addr", adb.DefaultAddr, "ADB server address (host:port); a non-local address skips starting a local server")
+		maxPackets     = flag.Int("max-packets", store.DefaultMaxPackets, "Packet ring buffer capacity")
+		maxConns       = flag.Int("max-connections", store.DefaultMaxConns, "Connection ring buffer capacity")
+		eventHistory   = flag.Int("event-history", store.DefaultMaxDeviceEvents, "Device events kept for /api/events/history")
+		eventRetention = flag.Duration("event-retention", store.DefaultDeviceEventRetention, "How long device events are kept for /api/events/history")
+		storeRaw       = flag.String("store-raw", "keep", "How stored packets keep their raw capture line: keep, compress or drop")
+		maxWorkers     = flag.Int("max-workers", 100, "Maximum concurrent device tasks")
+		drainTimeout   = flag.Duration("drain-timeout", bridge.DefaultDrainTimeout, "How long shutdown waits for captures to store buffered packets and stop tcpdump on devices")
+		maxPerDevice   = flag.Int("max-per-device", 4, "Maximum concurrent tasks for one device, its capture included (0 = no cap)")
+		authToken      = flag.String("auth-token", "", "Require this bearer token on /api/ requests")
+		adbRestart     = flag.Duration("adb-restart", adbbin.DefaultCheckInterval, "How often a local ADB server is checked with host:version and restarted if it died (0 = never)")
+		adbLogMaxSize  = flag.Int64("adb-log-max-size", adbbin.DefaultLogMaxSize, "Rotate a supervised ADB server's log once it reaches this many bytes (-1 = never)")
+		adbLogKeep     = flag.Int("adb-log-keep", adbbin.DefaultLogKeep, "Rotated ADB server logs kept (-1 = none)")
+		serviceName    = flag.String("service-name", "adb-monitor", "Windows service name, when run by the service control manager")
+		authRetry      = flag.Duration("auth-retry", 0, "Reconnect devices unauthorized for this long so they prompt again (0 = never)")
+		adminToken     = flag.String("admin-token", "", "Token required by device control endpoints (reboot, root, remount); empty disables them")
+		teamsFile      = flag.String("teams-file", "", "JSON file assigning devices and tokens to teams; a team's tokens see and control only its devices (needs -auth-token)")
+		webhookURL     = flag.String("webhook-url", "", "Register a webhook notification target at startup")
+		webhookSecret  = flag.String("webhook-secret", "", "HMAC secret for -webhook-url")
+		webhookTrigger = flag.String("webhook-triggers", "", "Comma-separated triggers for -webhook-url (default: all)")
+		enableGraphQL  = flag.Bool("graphql", false, "Serve the read-only GraphQL endpoint at /api/graphql")
+		spikeThreshold = flag.Int("error-spike-threshold", notify.DefaultErrorSpikeThreshold, "Capture errors per 30s that fire capture_error_spike")
+		adbDownload    = flag.Bool("adb-download", true, "Download the official platform-tools when neither embedded nor system ADB is available")
+		devicesFile    = flag.String("devices-file", defaultConfigFile("devices.json"), "JSON file keeping the history of every device seen: first seen, reconnects, uptime (empty = memory only)")
+		auditFile      = flag.String("audit-file", defaultConfigFile("audit.jsonl"), "JSON lines file every command run on a device is appended to, rotated at 64 MiB (empty = memory only)")
+		labelsFile     = flag.String("labels-file", defaultConfigFile("labels.json"), "JSON file keeping device names, groups and tags (empty = memory only)")
+		anomalies      = flag.Bool("anomalies", true, "Learn per-device and per-app traffic baselines and report anomalies")
+		anomalyFactor  = flag.Float64("anomaly-factor", anomaly.DefaultFactor, "Report traffic volumes this many times above or below their baseline")
+		anomalyWindow  = flag.Duration("anomaly-window", anomaly.DefaultWindow, "Window traffic volumes are measured over")
+		anomalyLearn   = flag.Duration("anomaly-learning", anomaly.DefaultLearning, "How long a device or app is observed before it can raise anomalies")
+		reportsDir     = flag.String("reports-dir", defaultConfigFile("reports"), "Directory keeping daily and weekly traffic reports and the domain baseline they compare against (empty disables reports)")
+		reportsKeep    = flag.Int("reports-keep", report.DefaultKeep, "Reports kept per period; older ones are deleted")
+		reportSMTP     = flag.String("report-smtp", "", "Mail each daily and weekly report through this SMTP server, host:port (empty disables)")
+		reportSMTPUser = flag.String("report-smtp-user", "", "Username for -report-smtp")
+		reportSMTPPass = flag.String("report-smtp-pass", "", "Password for -report-smtp")
+		reportFrom     = flag.String("report-from", "", "Sender address of mailed reports")
+		reportTo       = flag.String("report-to", "", "Comma-separated recipients of mailed reports")
+		threatFeeds    = flag.String("threat-feeds", "", "Comma-separated blocklists (files or http(s) URLs, optionally name=source) of IPs, CIDRs and domains to flag as malicious")
+		threatAllow    = flag.String("threat-allowlists", "", "Comma-separated allowlists, same format as -threat-feeds, exempting traffic from the blocklists")
+		threatRefresh  = flag.Duration("threat-refresh", intel.DefaultRefresh, "How often threat feeds are reloaded")
+		procCmd        = flag.String("processor-cmd", "", "Pipe packets, connections and device events as NDJSON to this command's stdin and apply the annotations it writes to stdout (empty disables)")
+		procURL        = flag.String("processor-url", "", "POST packets, connections and device events to this http(s) endpoint and apply the annotations it answers with, instead of -processor-cmd")
+		procTimeout    = flag.Duration("processor-timeout", processor.DefaultTimeout, "How long a packet or connection waits for its -processor-cmd or -processor-url annotation")
+		sinkURL        = flag.String("sink-url", "", "Publish packets, connections and device events to this broker: nats://[user:pass@]host[:port] or mqtt://[user:pass@]host[:port] (empty disables)")
+		sinkTopics     = flag.String("sink-topics", "", "Comma-separated kind=topic overrides for -sink-url (kinds: packets, connections, events; {serial} is replaced, empty topic skips the kind)")
+		sinkFormat     = flag.String("sink-format", "json", "How -sink-url messages are serialized: json or protobuf")
+		sinkBatchSize  = flag.Int("sink-batch-size", sink.DefaultBatchSize, "Records published in one -sink-url message at most")
+		sinkBatchEvery = flag.Duration("sink-batch-interval", sink.DefaultBatchInterval, "How long a record waits for its -sink-url batch to fill")
+		esURL          = flag.String("es-url", "", "Bulk-index packets and connections into this Elasticsearch or OpenSearch cluster: http(s)://[user:pass@]host:9200 (empty disables)")
+		esAPIKey       = flag.String("es-api-key", "", "API key for -es-url, instead of basic auth")
+		esIndex        = flag.String("es-index", elastic.DefaultIndex, "Index name template for -es-url; {kind} is packets or connections, {date} the UTC day")
+		esTemplate     = flag.Bool("es-template", true, "Install an index template mapping timestamps, IP addresses and keywords for the -es-index indices")
+		esBatchSize    = flag.Int("es-batch-size", elastic.DefaultBatchSize, "Documents indexed in one -es-url bulk request at most")
+		esFlush        = flag.Duration("es-flush-interval", elastic.DefaultFlushInterval, "How long a document waits for its -es-url bulk request to fill")
+		webhooksFile   = flag.String("webhooks-file", defaultConfigFile("webhooks.json"), "JSON file keeping the webhooks created through the API (empty = memory only)")
+		propsFile      = flag.String("props-file", defaultConfigFile("props.json"), "JSON file keeping the system properties, dumpsys sections and shell probes collected from devices (empty = memory only)")
+		propInterval   = flag.Duration("prop-interval", monitor.DefaultPropInterval, "How often device properties are collected (0 = never)")
+		schedulesFile  = flag.String("schedules-file", defaultConfigFile("schedules.json"), "JSON file keeping capture schedules (empty = memory only)")
+		metricsFile    = flag.String("metrics-file", defaultConfigFile("metrics.json"), "JSON file keeping device metric histories (empty = memory only)")
+		downloadsDir   = flag.String("downloads-dir", defaultConfigFile("downloads"), "Directory keeping files pulled from devices, such as screen recordings (empty disables them)")
+		snapshotFile   = flag.String("snapshot-file", defaultCacheFile("snapshot.jsonl.gz"), "File POST /api/store/snapshot writes the captured data to (empty disables snapshots)")
+		restore        = flag.Bool("restore", false, "Load -snapshot-file into the store at startup")
+		frontendDir    = flag.String("frontend-dir", "", "Serve the dashboard from this directory instead of the embedded copy")
+		tcpdumpDir     = flag.String("tcpdump-dir", "", "Directory of static tcpdump builds to deploy to rooted devices (default: the embedded ones)")
+		vpnAPK         = flag.String("vpn-apk", "", "VpnService companion APK installed for vpn capture mode on devices that lack it")
+		captureBuffer  = flag.Int("capture-buffer", capture.DefaultBufferSize, "Packets, connections and DNS lookups queued per capture before the drop policy applies")
+		captureDrop    = flag.String("capture-drop", "drop-newest", "What a full capture queue does: drop-newest, drop-oldest, block (slows the capture stream)")
+		captureSample  = flag.Int("capture-sample", 1, "Keep one captured packet in this many")
+		captureMaxPPS  = flag.Int("capture-max-pps", 0, "Packets kept per second and capture at most (0 = no cap)")
+		captureMaxBPS  = flag.Int64("capture-max-bps", 0, "Bytes of packets kept per second and capture at most (0 = no cap)")
+		batchInterval  = flag.Duration("sse-batch-interval", bridge.DefaultPacketBatchInterval, "How often captured packets are sent to SSE clients as one packets:batch event")
+		batchSize      = flag.Int("sse-batch-size", bridge.DefaultPacketBatchSize, "Packets that trigger a packets:batch before the interval is up")
+		eventBuffer    = flag.Int("event-buffer", 1024, "Device events queued per internal subscriber worker")
+		eventOverflow  = flag.String("event-overflow", "drop-newest", "What a full event queue does: drop-newest, drop-oldest, block (waits -event-block-timeout)")
+		eventBlock     = flag.Duration("event-block-timeout", event.DefaultBlockTimeout, "How long a publisher waits for room with -event-overflow block")
+		eventWorkers   = flag.Int("event-workers", 1, "Goroutines running each internal event subscriber; a device's events stay in order")
+		eventHandlerTO = flag.Duration("event-handler-timeout", 0, "How long an internal event handler may run before its subscriber moves on (0 = unbounded)")
+		traceWindow    = flag.Duration("trace-window", correlate.DefaultWindow, "How far apart a request's logcat URL, DNS lookup and connection may be and still be traced as one flow")
+		sseClientRate  = flag.Float64("sse-client-rate", bridge.DefaultSSEClientRate, "Events per second sent to each SSE client, excess dropped (0 = unlimited)")
+		batteryPause   = flag.Int("battery-pause-level", bridge.DefaultBatteryPauseLevel, "Pause a device's capture when its unplugged battery drops to this percent (0 = never)")
+		batteryResume  = flag.Int("battery-resume-level", bridge.DefaultBatteryResumeLevel, "Resume a capture paused by -battery-pause-level once the battery has charged to this percent")
+		batteryDrain   = flag.Float64("battery-drain-warn", bridge.DefaultBatteryDrainWarn, "Warn when a capture drains its device's battery by this many percent per hour (0 = never)")
+		rolloutPar     = flag.Int("capture-rollout-parallel", bridge.DefaultCaptureRolloutParallel, "How many captures a start-all prepares at once")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n  %s [flags]\n  %s alert-rules [flags]   print Prometheus alerting rules\n\n", os.Args[0], os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\nEvery flag can also be set from the environment:\n%s\n", config.EnvUsage(flag.CommandLine))
+	}
 	flag.Parse()
 
 	log := logging.New(logging.Config{
@@ -37,15 +156,136 @@ func main() {
 		Format: "text",
 	})
 
-	// Extract embedded ADB to a temp dir and start the server.
-	adbMgr, err := adbbin.NewFromEmbed(log, platformToolsFS)
+	if err := config.ApplyEnv(flag.CommandLine, os.LookupEnv); err != nil {
+		log.Error("configuration error", "error", err)
+		os.Exit(2)
+	}
+
+	if usb := config.DetectUSB(); usb.Available {
+		log.Info("USB device tree visible", "buses", usb.Buses, "container", usb.Container)
+	} else if usb.Container {
+		log.Warn("running in a container without /dev/bus/usb; only devices known to the ADB server at -adb-addr will be visible")
+	}
+
+	base, err := bridge.NormalizeBasePath(*basePath)
+	if err != nil {
+		log.Error("configuration error", "error", err)
+		os.Exit(2)
+	}
+	var origins []string
+	for _, o := range strings.Split(*corsOrigins, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins = append(origins, strings.TrimSuffix(o, "/"))
+		}
+	}
+
+	deviceLabels, err := labels.Open(*labelsFile)
+	if err != nil {
+		log.Error("failed to load device labels", "error", err)
+		os.Exit(1)
+	}
+	deviceRegistry, err := registry.Open(*devicesFile)
+	if err != nil {
+		log.Error("failed to load device registry", "error", err)
+		os.Exit(1)
+	}
+	auditLog, err := audit.Open(*auditFile, 0)
+	if err != nil {
+		log.Error("failed to open audit log", "error", err)
+		os.Exit(1)
+	}
+	notifier, err := notify.Open(log, notify.Config{}, *webhooksFile)
+	if err != nil {
+		log.Error("failed to load webhooks", "error", err)
+		os.Exit(1)
+	}
+	deviceTeams, err := teams.Load(*teamsFile)
+	if err != nil {
+		log.Error("failed to load teams", "error", err)
+		os.Exit(1)
+	}
+	if deviceTeams != nil && *authToken == "" {
+		log.Error("configuration error", "error", "-teams-file needs -auth-token")
+		os.Exit(2)
+	}
+	if deviceTeams.TeamOf(*authToken) != "" || deviceTeams.TeamOf(*adminToken) != "" {
+		log.Error("configuration error", "error", "team tokens must differ from -auth-token and -admin-token")
+		os.Exit(2)
+	}
+	propSet, err := monitor.OpenProps(*propsFile)
+	if err != nil {
+		log.Error("failed to load device property set", "error", err)
+		os.Exit(1)
+	}
+	captureSchedules, err := schedule.Open(*schedulesFile)
 	if err != nil {
-		log.Warn("embedded ADB extraction failed, trying system ADB", "error", err)
-		// Fallback: try to find ADB on the system.
-		adbMgr, err = adbbin.New(log)
+		log.Error("failed to load capture schedules", "error", err)
+		os.Exit(1)
+	}
+	deviceMetrics, err := timeseries.Open(*metricsFile, 0)
+	if err != nil {
+		log.Error("failed to load device metrics", "error", err)
+		os.Exit(1)
+	}
+
+	overflow, err := event.ParseOverflow(*eventOverflow)
+	if err != nil {
+		log.Error("configuration error", "error", err)
+		os.Exit(2)
+	}
+	rawMode, err := store.ParseRawMode(*storeRaw)
+	if err != nil {
+		log.Error("configuration error", "error", err)
+		os.Exit(2)
+	}
+	dropPolicy, err := capture.ParseDropPolicy(*captureDrop)
+	if err != nil {
+		log.Error("configuration error", "error", err)
+		os.Exit(2)
+	}
+	if *captureBuffer <= 0 || *captureBuffer > capture.MaxBufferSize {
+		log.Error("configuration error", "error", fmt.Sprintf("-capture-buffer must be between 1 and %d", capture.MaxBufferSize))
+		os.Exit(2)
+	}
+	sampling := capture.SamplingConfig{Rate: *captureSample, MaxPPS: *captureMaxPPS, MaxBPS: *captureMaxBPS}
+	if err := sampling.Validate(); err != nil {
+		log.Error("configuration error", "error", "-capture-sample, -capture-max-pps, -capture-max-bps: "+err.Error())
+		os.Exit(2)
+	}
+
+	var webhooks []notify.Webhook
+	if *webhookURL != "" {
+		webhooks = append(webhooks, notify.Webhook{
+			URL:      *webhookURL,
+			Secret:   *webhookSecret,
+			Triggers: parseTriggers(*webhookTrigger),
+			Enabled:  true,
+		})
+	}
+
+	// Extract embedded ADB to a temp dir (or use the system's, or download
+	// it) and start the server, unless we were pointed at an ADB server
+	// elsewhere (e.g. a sidecar container).
+	var adbMgr *adbbin.Manager
+	if isLocalAddr(*adbAddr) {
+		err = errors.New("not embedded in this build")
+		if platformToolsFS != nil {
+			adbMgr, err = adbbin.NewFromEmbed(log, platformToolsFS)
+		}
 		if err != nil {
-			log.Error("ADB not available — network capture will not work", "error", err)
+			log.Warn("embedded ADB unavailable, trying system ADB", "error", err)
+			// Fallback: try to find ADB on the system.
+			adbMgr, err = adbbin.New(log)
+			if err != nil && *adbDownload {
+				log.Warn("system ADB unavailable, downloading platform-tools", "error", err)
+				adbMgr, err = adbbin.NewFromDownload(context.Background(), log, adbbin.DownloadConfig{})
+			}
+			if err != nil {
+				log.Error("ADB not available — network capture will not work", "error", err)
+			}
 		}
+	} else {
+		log.Info("using remote ADB server", "addr", *adbAddr)
 	}
 
 	if adbMgr != nil {
@@ -59,18 +299,180 @@ func main() {
 		}
 	}
 
+	var detector *anomaly.Detector
+	if *anomalies {
+		detector = anomaly.New(anomaly.Config{
+			Factor:   *anomalyFactor,
+			Window:   *anomalyWindow,
+			Learning: *anomalyLearn,
+		})
+	}
+
+	var reporter *report.Reporter
+	if *reportsDir != "" {
+		cfg := report.Config{Dir: *reportsDir, Keep: *reportsKeep}
+		if *reportSMTP != "" {
+			cfg.Mail = &report.MailConfig{
+				Addr:     *reportSMTP,
+				Username: *reportSMTPUser,
+				Password: *reportSMTPPass,
+				From:     *reportFrom,
+			}
+			for _, to := range strings.Split(*reportTo, ",") {
+				if to = strings.TrimSpace(to); to != "" {
+					cfg.Mail.To = append(cfg.Mail.To, to)
+				}
+			}
+		}
+		reporter, err = report.New(log, cfg)
+		if err != nil {
+			log.Error("configuration error", "error", err)
+			os.Exit(2)
+		}
+	}
+
+	var threats *intel.Matcher
+	if feeds := append(parseFeeds(*threatFeeds, false), parseFeeds(*threatAllow, true)...); len(feeds) > 0 {
+		threats = intel.New(log, intel.Config{Feeds: feeds, Refresh: *threatRefresh})
+	}
+
+	var proc *processor.Processor
+	if *procCmd != "" || *procURL != "" {
+		proc, err = processor.New(log, processor.Config{Command: *procCmd, URL: *procURL, Timeout: *procTimeout})
+		if err != nil {
+			log.Error("configuration error", "error", err)
+			os.Exit(2)
+		}
+	}
+
+	var output *sink.Sink
+	if *sinkURL != "" {
+		topics, err := sink.ParseTopics(*sinkTopics)
+		if err != nil {
+			log.Error("configuration error", "error", err)
+			os.Exit(2)
+		}
+		format, err := sink.ParseFormat(*sinkFormat)
+		if err != nil {
+			log.Error("configuration error", "error", err)
+			os.Exit(2)
+		}
+		output, err = sink.New(log, sink.Config{
+			URL:           *sinkURL,
+			Topics:        topics,
+			Format:        format,
+			BatchSize:     *sinkBatchSize,
+			BatchInterval: *sinkBatchEvery,
+		})
+		if err != nil {
+			log.Error("configuration error", "error", err)
+			os.Exit(2)
+		}
+		log.Info("publishing to output sink", "broker", output.Broker(), "format", format)
+	}
+
+	var exporter *elastic.Exporter
+	if *esURL != "" {
+		exporter, err = elastic.New(log, elastic.Config{
+			URL:           *esURL,
+			APIKey:        *esAPIKey,
+			Index:         *esIndex,
+			Template:      *esTemplate,
+			BatchSize:     *esBatchSize,
+			FlushInterval: *esFlush,
+		})
+		if err != nil {
+			log.Error("configuration error", "error", err)
+			os.Exit(2)
+		}
+		log.Info("indexing into Elasticsearch", "url", exporter.Endpoint(), "index", *esIndex)
+	}
+
+	tcpdumpBins, _ := fs.Sub(tcpdumpFS, "tcpdump")
+	if *tcpdumpDir != "" {
+		tcpdumpBins = os.DirFS(*tcpdumpDir)
+	}
+
 	// Build the application.
 	app := bridge.NewApp(log, bridge.Config{
-		ADBAddr:    adb.DefaultAddr,
-		MaxWorkers: 100,
+		ADBAddr:    *adbAddr,
+		ADB:        adbMgr,
+		Labels:     deviceLabels,
+		Registry:   deviceRegistry,
+		Audit:      auditLog,
+		Teams:      deviceTeams,
+		Schedules:  captureSchedules,
+		Props:      propSet,
+		Metrics:    deviceMetrics,
+		Downloads:  downloads.Open(*downloadsDir),
+		Anomalies:  detector,
+		Reports:    reporter,
+		Threats:    threats,
+		Processor:  proc,
+		Sink:       output,
+		Elastic:    exporter,
+		MaxWorkers: *maxWorkers,
 		StoreConfig: store.Config{
-			MaxPackets:     50000,
-			MaxConnections: 10000,
+			MaxPackets:     *maxPackets,
+			MaxConnections: *maxConns,
+			RawMode:        rawMode,
+
+			MaxDeviceEvents:      *eventHistory,
+			DeviceEventRetention: *eventRetention,
 		},
+		Events: event.Config{
+			BufferSize:     *eventBuffer,
+			Overflow:       overflow,
+			BlockTimeout:   *eventBlock,
+			HandlerTimeout: *eventHandlerTO,
+			Workers:        *eventWorkers,
+		},
+		ReadOnly:     *readOnly,
+		AuthRequired: *authToken != "",
+		BasePath:     base,
+		AdminToken:   *adminToken,
+		Notifier:     notifier,
+		Webhooks:     webhooks,
+
+		ErrorSpikeThreshold: *spikeThreshold,
+		SnapshotFile:        *snapshotFile,
+		MaxTasksPerDevice:   *maxPerDevice,
+		DrainTimeout:        *drainTimeout,
+		GraphQL:             *enableGraphQL,
+		TcpdumpBinaries:     tcpdumpBins,
+		VPNCompanionAPK:     *vpnAPK,
+		CaptureBuffer:       capture.BufferConfig{Size: *captureBuffer, Policy: dropPolicy},
+		CaptureSampling:     sampling,
+		AuthRetryInterval:   *authRetry,
+		ADBRestartInterval:  *adbRestart,
+		ADBLogMaxSize:       *adbLogMaxSize,
+		ADBLogKeep:          *adbLogKeep,
+		PacketBatchInterval: *batchInterval,
+		PacketBatchSize:     *batchSize,
+		SSEClientRate:       *sseClientRate,
+		TraceWindow:         *traceWindow,
+		PropInterval:        *propInterval,
+		BatteryPauseLevel:   *batteryPause,
+		BatteryResumeLevel:  *batteryResume,
+		BatteryDrainWarn:    *batteryDrain,
+
+		CaptureRolloutParallel: *rolloutPar,
 	})
 
+	// Restore an earlier investigation before any capture adds to it.
+	if *restore {
+		if _, err := app.RestoreSnapshot(); err != nil {
+			log.Error("failed to restore store snapshot", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
+	// Under systemd or the Windows SCM, report readiness and stops, and
+	// ping the watchdog while the app is responsive.
+	svc, ctx := service.Start(ctx, *serviceName)
+	defer svc.Stopped()
 
 	app.Startup(ctx)
 
@@ -78,25 +480,46 @@ func main() {
 	mux := http.NewServeMux()
 	app.RegisterRoutes(mux)
 
-	// Serve embedded frontend files.
-	frontendSub, _ := fs.Sub(frontendFS, "frontend")
-	mux.Handle("/", http.FileServer(http.FS(frontendSub)))
+	// Serve the dashboard, unless this is a headless build without one.
+	if ui := frontendRoot(*frontendDir, log); ui != nil {
+		mux.Handle("/", app.FrontendHandler(ui))
+	} else {
+		log.Info("no dashboard to serve, API only")
+	}
 
+	handler := bridge.RequireToken(*authToken, mux, append(deviceTeams.Tokens(), *adminToken)...)
 	srv := &http.Server{
 		Addr:    *addr,
-		Handler: mux,
+		Handler: bridge.CORS(origins, bridge.WithBasePath(base, handler)),
 	}
 
+	// Listen before reporting readiness, so a service manager only sees
+	// the monitor ready once it accepts connections.
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Error("server error", "error", err)
+		svc.Stopped()
+		os.Exit(1)
+	}
 	go func() {
-		log.Info("server starting", "addr", *addr, "url", "http://localhost"+*addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Info("server starting", "addr", *addr, "url", "http://localhost"+*addr+base+"/",
+			"read_only", *readOnly, "auth", *authToken != "", "teams", len(deviceTeams.Names()))
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
 			log.Error("server error", "error", err)
+			svc.Stopped()
 			os.Exit(1)
 		}
 	}()
 
+	svc.Ready()
+	svc.Status("serving on " + *addr + base + "/")
+	go svc.Watchdog(ctx, app.Alive, func(err error) {
+		log.Warn("skipping watchdog ping", "error", err)
+	})
+
 	<-ctx.Done()
 	log.Info("shutting down...")
+	svc.Stopping()
 
 	shutCtx, shutCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutCancel()
@@ -104,3 +527,69 @@ func main() {
 	srv.Shutdown(shutCtx)
 	app.Shutdown()
 }
+
+// parseFeeds parses a comma-separated list of feed sources, each optionally
+// named as name=source.
+func parseFeeds(s string, allow bool) []intel.Feed {
+	var feeds []intel.Feed
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		feed := intel.Feed{Source: f, Allow: allow}
+		if name, source, ok := strings.Cut(f, "="); ok && !strings.Contains(name, "/") {
+			feed.Name, feed.Source = name, source
+		}
+		feeds = append(feeds, feed)
+	}
+	return feeds
+}
+
+// defaultConfigFile returns name in the user's config directory, or "" if
+// there is none.
+func defaultConfigFile(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "go-adb-monitor", name)
+}
+
+// defaultCacheFile returns name in the user's cache directory, or "" if
+// there is none.
+func defaultCacheFile(name string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "go-adb-monitor", name)
+}
+
+// frontendRoot returns the dashboard files to serve: dir when given,
+// otherwise the embedded copy, which headless builds lack (nil).
+func frontendRoot(dir string, log *slog.Logger) fs.FS {
+	if dir != "" {
+		if _, err := os.Stat(filepath.Join(dir, "index.html")); err != nil {
+			log.Warn("frontend directory has no index.html", "dir", dir, "error", err)
+		}
+		return os.DirFS(dir)
+	}
+	if frontendFS == nil {
+		return nil
+	}
+	sub, _ := fs.Sub(frontendFS, "frontend")
+	return sub
+}
+
+// isLocalAddr reports whether an ADB server address points at this host.
+func isLocalAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return true
+	}
+	if host == "" || host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}